@@ -1,7 +1,14 @@
 package cmd
 
 import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
 	"github.com/accuknox/accuknox-cli-v2/pkg/api/asset"
+	apiclient "github.com/accuknox/accuknox-cli-v2/pkg/api/client"
 	"github.com/accuknox/accuknox-cli-v2/pkg/api/cluster"
 	"github.com/accuknox/accuknox-cli-v2/pkg/config"
 	"github.com/spf13/cobra"
@@ -13,6 +20,11 @@ var (
 	TOKEN     string
 	TENANT_ID string
 	CFG_FILE  string
+
+	apiProfile string
+
+	apiRequestTimeout time.Duration
+	apiRetries        int
 )
 
 // apiCmd represents the root API command
@@ -29,6 +41,51 @@ func init() {
 	apiCmd.PersistentFlags().StringVar(&TOKEN, "token", "", "Set Token")
 	apiCmd.PersistentFlags().StringVar(&TENANT_ID, "tenant-id", "", "Set Tenant-id")
 	apiCmd.PersistentFlags().StringVar(&CFG_FILE, "cfgFile", "$HOME/.accuknox.cfg", "Set Config File")
+	apiCmd.PersistentFlags().StringVar(&apiProfile, "profile", "", "Profile to use, see `knoxctl config`. Defaults to $ACCUKNOX_PROFILE or the current profile")
+
+	apiCmd.PersistentFlags().DurationVar(&apiRequestTimeout, "request-timeout", apiclient.DefaultTimeout, "Timeout of a single API request")
+	apiCmd.PersistentFlags().IntVar(&apiRetries, "retries", apiclient.DefaultMaxRetries, "Number of times a rate limited or failed API request is retried")
 
 	rootCmd.AddCommand(apiCmd)
 }
+
+// newAPIClient loads the profile, or the config file if no profile is
+// configured or --cfgFile is given, applies the flag overrides and returns a
+// client for the AccuKnox API
+func newAPIClient() (*apiclient.Client, error) {
+	profiles, err := config.LoadProfiles(config.GetProfilesFile())
+	if err != nil {
+		return nil, err
+	}
+
+	profile := ""
+	if apiCmd.PersistentFlags().Changed("cfgFile") {
+		if apiProfile != "" {
+			return nil, fmt.Errorf("--profile cannot be used with --cfgFile")
+		}
+	} else {
+		profile = config.ResolveProfile(profiles, apiProfile)
+	}
+
+	if profile != "" {
+		if err := config.LoadProfile(profiles, profile); err != nil {
+			return nil, err
+		}
+	} else if err := config.LoadConfig(CFG_FILE); err != nil {
+		return nil, err
+	}
+	config.SetConfig(CWPP_URL, CSPM_URL, TOKEN, TENANT_ID)
+	if err := config.CheckToken(time.Now()); err != nil {
+		return nil, err
+	}
+
+	return apiclient.NewFromConfig(config.Cfg,
+		apiclient.WithTimeout(apiRequestTimeout),
+		apiclient.WithRetries(apiRetries, apiclient.DefaultBackoff),
+	), nil
+}
+
+// apiContext returns the context for API requests, cancelled on interrupt
+func apiContext(cmd *cobra.Command) (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(cmd.Context(), os.Interrupt)
+}
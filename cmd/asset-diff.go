@@ -0,0 +1,28 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/accuknox/accuknox-cli-v2/pkg/api/asset"
+	"github.com/spf13/cobra"
+)
+
+var assetDiffJSON bool
+
+// assetDiffCmd represents the `diff` subcommand
+var assetDiffCmd = &cobra.Command{
+	Use:     "diff <old> <new>",
+	Short:   "Compare two asset exports",
+	Long:    `Report the assets added or removed and the vulnerability count changes between two exports of "api asset list --export".`,
+	Example: asset.AssetDiffDescription,
+	Args:    cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return asset.DiffExports(os.Stdout, args[0], args[1], assetDiffJSON)
+	},
+}
+
+func init() {
+	assetCmd.AddCommand(assetDiffCmd)
+
+	assetDiffCmd.Flags().BoolVar(&assetDiffJSON, "json", false, "Print the differences in the JSON format")
+}
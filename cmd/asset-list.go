@@ -1,9 +1,9 @@
 package cmd
 
 import (
+	"strings"
+
 	"github.com/accuknox/accuknox-cli-v2/pkg/api/asset"
-	"github.com/accuknox/accuknox-cli-v2/pkg/config"
-	"github.com/accuknox/accuknox-cli-v2/pkg/logger"
 	"github.com/spf13/cobra"
 )
 
@@ -15,13 +15,17 @@ var assetListCmd = &cobra.Command{
 	Short:   "List assets",
 	Long:    `List the assets available with optional filtering using flags.`,
 	Example: asset.AssetDescription,
-	Run: func(cmd *cobra.Command, args []string) {
-		if err := config.LoadConfig(CFG_FILE); err != nil {
-			logger.Error(err.Error())
-			return
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := asset.ValidateExport(assetOptions.Export, assetOptions.Output); err != nil {
+			return err
+		}
+		c, err := newAPIClient()
+		if err != nil {
+			return err
 		}
-		config.SetConfig(CWPP_URL, CSPM_URL, TOKEN, TENANT_ID)
-		asset.ListAssets(assetOptions)
+		ctx, cancel := apiContext(cmd)
+		defer cancel()
+		return asset.ListAssets(ctx, c, assetOptions)
 	},
 }
 
@@ -35,4 +39,6 @@ func init() {
 	assetListCmd.Flags().BoolVar(&assetOptions.NoPager, "noPager", false, "Dumps complete list without pagination")
 	assetListCmd.Flags().IntVarP(&assetOptions.Timeout, "timeout", "t", 60, "Set timeout in secs")
 	assetListCmd.Flags().BoolVar(&assetOptions.JsonFormat, "json", false, "List assets in the JSON format")
+	assetListCmd.Flags().StringVar(&assetOptions.Export, "export", "", "Export the assets with flattened columns, one of "+strings.Join(asset.ExportFormats, ", "))
+	assetListCmd.Flags().StringVarP(&assetOptions.Output, "output", "o", "", "File to write the export to, defaults to stdout")
 }
@@ -8,8 +8,8 @@ import (
 // assetCmd represents the parent command for assets
 var assetCmd = &cobra.Command{
 	Use:     "asset",
-	Short:   "Managing assets, with subcommands like `list`",
-	Long:    "Managing assets, with subcommands like `list`",
+	Short:   "Managing assets, with subcommands like `list` and `diff`",
+	Long:    "Managing assets, with subcommands like `list` and `diff`",
 	Example: asset.AssetDescription,
 }
 
@@ -1,11 +1,11 @@
 package cmd
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/accuknox/accuknox-cli-v2/pkg/api/cluster"
-	"github.com/accuknox/accuknox-cli-v2/pkg/config"
-	"github.com/accuknox/accuknox-cli-v2/pkg/logger"
+	"github.com/accuknox/accuknox-cli-v2/pkg/api/sink"
 	"github.com/spf13/cobra"
 )
 
@@ -14,21 +14,47 @@ var (
 	endTime   = time.Now().Unix()
 )
 
-var clusterAlertsOptions cluster.ClusterALertOptions
+var (
+	clusterAlertsOptions cluster.ClusterALertOptions
+	alertsSince          string
+)
 
 // clusterAlertsCmd represents the `alerts` subcommand for clusters
 var clusterAlertsCmd = &cobra.Command{
 	Use:     "alerts",
 	Short:   "Show alerts",
 	Long:    `Show alerts in the context of clusters. These alerts could be from KubeArmor, Network policies, Admission controllers or anything else as reported in "Monitors & Alerts" option in AccuKnox Control Plane.`,
-	Example: cluster.ClusterAlertDescription,
-	Run: func(cmd *cobra.Command, args []string) {
-		if err := config.LoadConfig(CFG_FILE); err != nil {
-			logger.Error(err.Error())
-			return
+	Example: cluster.ClusterAlertDescription + cluster.AlertQueryDescription + sink.SinkDescription,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if alertsSince != "" {
+			if cmd.Flags().Changed("stime") || cmd.Flags().Changed("etime") {
+				return fmt.Errorf("--since cannot be used with --stime or --etime")
+			}
+			since, err := cluster.ParseSince(alertsSince)
+			if err != nil {
+				return err
+			}
+			clusterAlertsOptions.EndTime = time.Now().Unix()
+			clusterAlertsOptions.StartTime = clusterAlertsOptions.EndTime - int64(since.Seconds())
+		}
+		if err := cluster.ValidateAlertOptions(clusterAlertsOptions); err != nil {
+			return err
+		}
+
+		c, err := newAPIClient()
+		if err != nil {
+			return err
+		}
+		ctx, cancel := apiContext(cmd)
+		defer cancel()
+		if clusterAlertsOptions.Follow {
+			// start following from now, unless asked for older alerts
+			if !cmd.Flags().Changed("stime") && alertsSince == "" {
+				clusterAlertsOptions.StartTime = time.Now().Unix()
+			}
+			return cluster.FollowClusterAlerts(ctx, c, clusterAlertsOptions)
 		}
-		config.SetConfig(CWPP_URL, CSPM_URL, TOKEN, TENANT_ID)
-		cluster.FetchClusterAlerts(clusterAlertsOptions)
+		return cluster.FetchClusterAlerts(ctx, c, clusterAlertsOptions)
 	},
 }
 
@@ -40,11 +66,26 @@ func init() {
 	clusterAlertsCmd.Flags().StringVar(&clusterAlertsOptions.LogType, "log-type", "active", "Set log type [active|suppressed|all]")
 	clusterAlertsCmd.Flags().StringVar(&clusterAlertsOptions.ClusterAlertJQ, "clusterjq", ".[]", "JQ filter for cluster list output")
 	clusterAlertsCmd.Flags().StringVar(&clusterAlertsOptions.AlertJQ, "alertjq", ".response[]", "JQ filter for alert output")
-	clusterAlertsCmd.Flags().StringVar(&clusterAlertsOptions.Filters, "filters", "", "Filters to pass to API")
+	clusterAlertsCmd.Flags().StringVar(&clusterAlertsOptions.Filters, "filters", "", "Filters to pass to API, a filter object or a list of filter objects")
+	clusterAlertsCmd.Flags().StringVar(&clusterAlertsOptions.FiltersOp, "filters-op", "and", "Combine the filters with [and|or]")
+	clusterAlertsCmd.Flags().StringVarP(&clusterAlertsOptions.Query, "query", "q", "", `Query alerts, e.g. 'severity>=5 and hostname~"store.*"'`)
+	clusterAlertsCmd.Flags().StringVar(&alertsSince, "since", "", "Only alerts of the last time window, e.g. 30m, 6h or 7d")
 	clusterAlertsCmd.Flags().Int64Var(&clusterAlertsOptions.StartTime, "stime", startTime, "Start time in epoch format (default: 2 days ago)")
 	clusterAlertsCmd.Flags().Int64Var(&clusterAlertsOptions.EndTime, "etime", endTime, "End time in epoch format (default: now)")
 	clusterAlertsCmd.Flags().BoolVar(&clusterAlertsOptions.NoPager, "noPager", false, "Dumps complete list")
 	clusterAlertsCmd.Flags().BoolVar(&clusterAlertsOptions.JsonFormat, "json", false, "Flag to list alerts in the JSON format")
 	clusterAlertsCmd.Flags().IntVar(&clusterAlertsOptions.Page, "page", 0, "Page number for alerts listing")
 	clusterAlertsCmd.Flags().IntVar(&clusterAlertsOptions.PageSize, "page-size", 50, "Number of alerts to list per page")
+	clusterAlertsCmd.Flags().BoolVar(&clusterAlertsOptions.Follow, "follow", false, "Keep polling for new alerts and print them as they arrive")
+	clusterAlertsCmd.Flags().DurationVar(&clusterAlertsOptions.PollInterval, "poll-interval", cluster.DefaultPollInterval, "Interval between two polls in follow mode")
+	clusterAlertsCmd.Flags().BoolVar(&clusterAlertsOptions.Stats, "stats", false, "Show statistics of the alerts instead of the alerts")
+	clusterAlertsCmd.Flags().StringSliceVar(&clusterAlertsOptions.StatsGroupBy, "group-by", cluster.StatsDimensions(), "Group the statistics by [cluster,namespace,policy,severity,operation,host]")
+	clusterAlertsCmd.Flags().IntVar(&clusterAlertsOptions.StatsTop, "top", cluster.DefaultStatsTop, "Number of values shown per group, 0 for all")
+	clusterAlertsCmd.Flags().StringArrayVar(&clusterAlertsOptions.Sink.Sinks, "sink", nil, "Forward alerts to a sink instead of printing them, can be repeated (syslog+udp|tcp|tls://host:port, http(s)://webhook, file:///path)")
+	clusterAlertsCmd.Flags().StringVar(&clusterAlertsOptions.Sink.Template, "sink-template", "", "Body of webhook requests: slack, teams or path of a Go template (default JSON)")
+	clusterAlertsCmd.Flags().IntVar(&clusterAlertsOptions.Sink.BatchSize, "sink-batch-size", sink.DefaultBatchSize, "Number of alerts sent to a sink at once")
+	clusterAlertsCmd.Flags().IntVar(&clusterAlertsOptions.Sink.Retries, "sink-retries", sink.DefaultRetries, "Number of times a failed delivery is retried")
+	clusterAlertsCmd.Flags().DurationVar(&clusterAlertsOptions.Sink.Backoff, "sink-backoff", sink.DefaultBackoff, "Initial wait between two deliveries, doubled after every attempt")
+	clusterAlertsCmd.Flags().StringVar(&clusterAlertsOptions.Sink.DeadLetter, "dead-letter", "$HOME/.accuknox-alerts.deadletter", "File for the alerts which could not be delivered")
+	clusterAlertsCmd.Flags().StringVar(&clusterAlertsOptions.StateFile, "state-file", cluster.DefaultFollowStateFile, "File to resume follow mode from, empty to disable, the default one is kept per query and filters")
 }
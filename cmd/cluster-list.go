@@ -2,8 +2,6 @@ package cmd
 
 import (
 	"github.com/accuknox/accuknox-cli-v2/pkg/api/cluster"
-	"github.com/accuknox/accuknox-cli-v2/pkg/config"
-	"github.com/accuknox/accuknox-cli-v2/pkg/logger"
 	"github.com/spf13/cobra"
 )
 
@@ -15,13 +13,14 @@ var clusterListCmd = &cobra.Command{
 	Short:   "List clusters and its relevant information and its corresponding entities (e.g., nodes)",
 	Long:    `The 'cluster list' command retrieves a list of onboarded clusters and optionally displays additional details like nodes within each cluster.`,
 	Example: cluster.ClusterListDescription,
-	Run: func(cmd *cobra.Command, args []string) {
-		if err := config.LoadConfig(CFG_FILE); err != nil {
-			logger.Error(err.Error())
-			return
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, err := newAPIClient()
+		if err != nil {
+			return err
 		}
-		config.SetConfig(CWPP_URL, CSPM_URL, TOKEN, TENANT_ID)
-		cluster.FetchClusterInfo(clusterListOptions)
+		ctx, cancel := apiContext(cmd)
+		defer cancel()
+		return cluster.FetchClusterInfo(ctx, c, clusterListOptions)
 	},
 }
 
@@ -36,4 +35,5 @@ func init() {
 	clusterListCmd.Flags().BoolVar(&clusterListOptions.JsonFormat, "json", false, "Flag to list cluster and nodes in the JSON format")
 	clusterListCmd.Flags().IntVar(&clusterListOptions.Page, "page", 0, "Page number for alerts listing")
 	clusterListCmd.Flags().IntVar(&clusterListOptions.PageSize, "page-size", 50, "Number of alerts to list per page")
+	clusterListCmd.Flags().IntVar(&clusterListOptions.Concurrency, "concurrency", cluster.DefaultConcurrency, "Number of clusters fetched in parallel")
 }
@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"github.com/accuknox/accuknox-cli-v2/pkg/api/cluster"
+	"github.com/spf13/cobra"
+)
+
+var policySyncOptions cluster.PolicySyncOptions
+
+// clusterPolicySyncCmd represents the `sync` subcommand for cluster policies
+var clusterPolicySyncCmd = &cobra.Command{
+	Use:     "sync",
+	Short:   "Sync a local policy directory with the cluster policies",
+	Long:    `Compare a local policy directory with the cluster policies and the state of the last sync, show the plan of changes and apply it on confirmation.`,
+	Example: cluster.ClusterPolicySyncDescription,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, err := newAPIClient()
+		if err != nil {
+			return err
+		}
+		ctx, cancel := apiContext(cmd)
+		defer cancel()
+		return cluster.SyncPolicies(ctx, c, policySyncOptions)
+	},
+}
+
+func init() {
+	clusterPolicyCmd.AddCommand(clusterPolicySyncCmd)
+
+	clusterPolicySyncCmd.Flags().StringVar(&policySyncOptions.Dir, "dir", "", "policy directory, laid out as <cluster>/<namespace>/<name>.yaml")
+	clusterPolicySyncCmd.Flags().StringVar(&policySyncOptions.ClusterListJQ, "clusterjq", ".[]", "JQ filter to apply on cluster list output")
+	clusterPolicySyncCmd.Flags().StringVar(&policySyncOptions.ClusterName, "clusterName", "", "sync policies of the given cluster only")
+	clusterPolicySyncCmd.Flags().StringVar(&policySyncOptions.Prefer, "prefer", "", "side which wins conflicts, local or remote")
+	clusterPolicySyncCmd.Flags().BoolVar(&policySyncOptions.DryRun, "dry-run", false, "show the plan without applying it")
+	clusterPolicySyncCmd.Flags().BoolVarP(&policySyncOptions.Yes, "yes", "y", false, "apply the plan without asking for a confirmation")
+	clusterPolicySyncCmd.Flags().IntVar(&policySyncOptions.Concurrency, "concurrency", cluster.DefaultConcurrency, "Number of clusters fetched in parallel")
+}
@@ -1,9 +1,9 @@
 package cmd
 
 import (
+	"strings"
+
 	"github.com/accuknox/accuknox-cli-v2/pkg/api/cluster"
-	"github.com/accuknox/accuknox-cli-v2/pkg/config"
-	"github.com/accuknox/accuknox-cli-v2/pkg/logger"
 	"github.com/spf13/cobra"
 )
 
@@ -14,13 +14,17 @@ var clusterPolicyCmd = &cobra.Command{
 	Short:   "Enlist the cluster policies. These include all policies, including, KubeArmor, Network, Admission Controller policies",
 	Long:    `Enlist the cluster policies. These include all policies, including, KubeArmor, Network, Admission Controller policies.`,
 	Example: cluster.ClusterPolicyDescription,
-	Run: func(cmd *cobra.Command, args []string) {
-		if err := config.LoadConfig(CFG_FILE); err != nil {
-			logger.Error(err.Error())
-			return
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := cluster.ValidatePolicyOptions(clusterPolicyOptions); err != nil {
+			return err
+		}
+		c, err := newAPIClient()
+		if err != nil {
+			return err
 		}
-		config.SetConfig(CWPP_URL, CSPM_URL, TOKEN, TENANT_ID)
-		cluster.FetchAndProcessPolicies(clusterPolicyOptions)
+		ctx, cancel := apiContext(cmd)
+		defer cancel()
+		return cluster.FetchAndProcessPolicies(ctx, c, clusterPolicyOptions)
 	},
 }
 
@@ -29,7 +33,15 @@ func init() {
 
 	clusterPolicyCmd.Flags().StringVar(&clusterPolicyOptions.ClusterListJQ, "clusterjq", ".[]", "JQ filter to apply on cluster list output")
 	clusterPolicyCmd.Flags().StringVar(&clusterPolicyOptions.PolicyJQ, "policyjq", ".list_of_policies[]", "JQ filter for policy")
-	clusterPolicyCmd.Flags().StringVar(&clusterPolicyOptions.Operation, "operation", "list", "operation")
+	clusterPolicyCmd.Flags().StringVar(&clusterPolicyOptions.Operation, "operation", "list", "operation, one of "+strings.Join(cluster.PolicyOperations, ", "))
 	clusterPolicyCmd.Flags().StringVar(&clusterPolicyOptions.ClusterName, "clusterName", "", "list policy for given cluster name")
 	clusterPolicyCmd.Flags().BoolVar(&clusterPolicyOptions.JsonFormat, "json", false, "print policies in json format")
+	clusterPolicyCmd.Flags().StringVarP(&clusterPolicyOptions.File, "file", "f", "", "policy YAML file to upload")
+	clusterPolicyCmd.Flags().StringVar(&clusterPolicyOptions.Namespace, "namespace", "", "namespace to upload the policy to, or of the policy to look up by name")
+	clusterPolicyCmd.Flags().StringVar(&clusterPolicyOptions.PolicyID, "policy-id", "", "ID of the policy to change")
+	clusterPolicyCmd.Flags().StringVar(&clusterPolicyOptions.PolicyName, "policy-name", "", "name of the policy to change, looked up in --clusterName")
+	clusterPolicyCmd.Flags().StringVar(&clusterPolicyOptions.Action, "action", "", "action for set-action, Audit or Block")
+	clusterPolicyCmd.Flags().BoolVar(&clusterPolicyOptions.DryRun, "dry-run", false, "show the change without applying it")
+	clusterPolicyCmd.Flags().BoolVarP(&clusterPolicyOptions.Yes, "yes", "y", false, "apply the change without asking for a confirmation")
+	clusterPolicyCmd.Flags().IntVar(&clusterPolicyOptions.Concurrency, "concurrency", cluster.DefaultConcurrency, "Number of clusters fetched in parallel")
 }
@@ -0,0 +1,179 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/accuknox/accuknox-cli-v2/pkg/config"
+	"github.com/spf13/cobra"
+)
+
+var (
+	configProfile    string
+	configTokenStore string
+	configShowToken  bool
+	configJSON       bool
+)
+
+const configDescription = `
+1. knoxctl config set cwpp_url https://cwpp.demo.accuknox.com --profile prod
+2. knoxctl config set tenant_id 42 --profile prod
+3. echo "$TOKEN" | knoxctl config set token - --profile prod
+... create the profile prod, the token is read from stdin and kept in the OS keyring if available
+
+4. knoxctl config use prod
+5. knoxctl api cluster list --profile staging
+
+Tokens are stored in the OS keyring (macOS keychain, Secret Service on Linux), in a file encrypted with
+$` + config.PassphraseEnv + `, or in the plain-text profiles file, in that order of preference. Use --token-store
+to choose one.
+`
+
+// configCmd represents the config command
+var configCmd = &cobra.Command{
+	Use:     "config",
+	Short:   "Manage the profiles used by the api commands",
+	Long:    `Manage named profiles holding the URLs, tenant and token used by the api commands.`,
+	Example: configDescription,
+}
+
+var configSetCmd = &cobra.Command{
+	Use:   "set <key> <value>",
+	Short: "Set a key of a profile, one of " + strings.Join(config.ProfileKeys, ", "),
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		profiles, err := config.LoadProfiles(config.GetProfilesFile())
+		if err != nil {
+			return err
+		}
+		name := configProfileName(profiles)
+
+		key, value := args[0], args[1]
+		if key == config.KeyToken && value == "-" {
+			line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+			if err != nil && line == "" {
+				return fmt.Errorf("error reading token from stdin: %v", err)
+			}
+			value = strings.TrimSpace(line)
+		}
+
+		if key == config.KeyToken {
+			store := ""
+			if cmd.Flags().Changed("token-store") {
+				store = configTokenStore
+			}
+			err = profiles.SetToken(name, value, store)
+		} else {
+			err = profiles.Set(name, key, value)
+		}
+		if err != nil {
+			return err
+		}
+		if err := profiles.Save(); err != nil {
+			return err
+		}
+
+		if key == config.KeyToken {
+			fmt.Printf("Token of profile %s stored in %s\n", name, profiles.Profiles[name].TokenStore)
+			if profiles.Profiles[name].TokenStore == config.StorePlain {
+				fmt.Fprintf(os.Stderr, "Warning: the token is stored in plain text in %s\n", config.GetProfilesFile())
+			}
+		}
+		return nil
+	},
+}
+
+var configGetCmd = &cobra.Command{
+	Use:   "get <key>",
+	Short: "Print a key of a profile, one of " + strings.Join(config.ProfileKeys, ", "),
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		profiles, err := config.LoadProfiles(config.GetProfilesFile())
+		if err != nil {
+			return err
+		}
+		value, err := profiles.GetValue(configProfileName(profiles), args[0])
+		if err != nil {
+			return err
+		}
+		if args[0] == config.KeyToken && !configShowToken {
+			value = config.MaskToken(value)
+		}
+		fmt.Println(value)
+		return nil
+	},
+}
+
+var configListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the profiles",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		profiles, err := config.LoadProfiles(config.GetProfilesFile())
+		if err != nil {
+			return err
+		}
+		return config.PrintProfiles(os.Stdout, profiles, configJSON)
+	},
+}
+
+var configUseCmd = &cobra.Command{
+	Use:   "use <profile>",
+	Short: "Make a profile the current one",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		profiles, err := config.LoadProfiles(config.GetProfilesFile())
+		if err != nil {
+			return err
+		}
+		if err := profiles.Use(args[0]); err != nil {
+			return err
+		}
+		if err := profiles.Save(); err != nil {
+			return err
+		}
+		fmt.Printf("Switched to profile %s\n", args[0])
+		return nil
+	},
+}
+
+var configDeleteCmd = &cobra.Command{
+	Use:   "delete <profile>",
+	Short: "Delete a profile and its stored token",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		profiles, err := config.LoadProfiles(config.GetProfilesFile())
+		if err != nil {
+			return err
+		}
+		if err := profiles.Delete(args[0]); err != nil {
+			return err
+		}
+		if err := profiles.Save(); err != nil {
+			return err
+		}
+		fmt.Printf("Deleted profile %s\n", args[0])
+		return nil
+	},
+}
+
+// configProfileName returns the profile given by --profile, then the current
+// profile, then "default"
+func configProfileName(profiles *config.Profiles) string {
+	if name := config.ResolveProfile(profiles, configProfile); name != "" {
+		return name
+	}
+	return "default"
+}
+
+func init() {
+	configCmd.PersistentFlags().StringVar(&configProfile, "profile", "", "Profile to use. Defaults to $ACCUKNOX_PROFILE or the current profile")
+
+	configSetCmd.Flags().StringVar(&configTokenStore, "token-store", config.StoreAuto, "Where to store the token, one of "+strings.Join(config.TokenStores, ", "))
+	configGetCmd.Flags().BoolVar(&configShowToken, "show-token", false, "Print the token instead of masking it")
+	configListCmd.Flags().BoolVar(&configJSON, "json", false, "Print the profiles in json format")
+
+	configCmd.AddCommand(configSetCmd, configGetCmd, configListCmd, configUseCmd, configDeleteCmd)
+	rootCmd.AddCommand(configCmd)
+}
@@ -32,14 +32,14 @@ var deboardCpNodeCmd = &cobra.Command{
 
 		switch vmMode {
 		case onboard.VMMode_Systemd:
-			_, err := deboard.Deboard(onboard.NodeType_ControlPlane, vmMode, dryRun)
+			_, err := deboard.Deboard(onboard.NodeType_ControlPlane, vmMode, containerRuntime, dryRun)
 			if err != nil {
 				logger.Error("Failed to deboard control plane node: %s", err.Error())
 				return err
 			}
 
 		case onboard.VMMode_Docker:
-			configPath, err := deboard.Deboard(onboard.NodeType_ControlPlane, vmMode, dryRun)
+			configPath, err := deboard.Deboard(onboard.NodeType_ControlPlane, vmMode, containerRuntime, dryRun)
 			if err != nil && os.IsPermission(err) {
 				logger.Warn("Please remove any remaining resources at %s", configPath)
 			} else if err != nil {
@@ -52,7 +52,7 @@ var deboardCpNodeCmd = &cobra.Command{
 		}
 		if disableVMScan {
 			logger.Info1("Removing RRA installation if it exists")
-			err := deboard.UninstallRRA()
+			err := deboard.UninstallRRA(containerRuntime)
 			if err != nil {
 				if os.IsNotExist(err) {
 					logger.Info1("RRA Installation not found")
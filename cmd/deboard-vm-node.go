@@ -35,13 +35,13 @@ var deboardNodeCmd = &cobra.Command{
 
 		switch vmMode {
 		case onboard.VMMode_Systemd:
-			_, err := deboard.Deboard(onboard.NodeType_WorkerNode, vmMode, dryRun)
+			_, err := deboard.Deboard(onboard.NodeType_WorkerNode, vmMode, containerRuntime, dryRun)
 			if err != nil {
 				logger.Error("Failed to deboard worker node: %s", err.Error())
 				return err
 			}
 		case onboard.VMMode_Docker:
-			configPath, err := deboard.Deboard(onboard.NodeType_WorkerNode, vmMode, dryRun)
+			configPath, err := deboard.Deboard(onboard.NodeType_WorkerNode, vmMode, containerRuntime, dryRun)
 			if err != nil && os.IsPermission(err) {
 				logger.Warn("Please remove any remaining resources at %s", configPath)
 			} else if err != nil {
@@ -52,7 +52,7 @@ var deboardNodeCmd = &cobra.Command{
 		}
 		if disableVMScan {
 			logger.Info1("Removing RRA installation if it exists")
-			err := deboard.UninstallRRA()
+			err := deboard.UninstallRRA(containerRuntime)
 			if err != nil {
 				if os.IsNotExist(err) {
 					logger.Info1("RRA Installation not found")
@@ -14,7 +14,7 @@ var deboardRRAScanner = &cobra.Command{
 	Short: "Deboard RRA scanner",
 	RunE: func(cmd *cobra.Command, args []string) error {
 
-		err := deboard.UninstallRRA()
+		err := deboard.UninstallRRA(containerRuntime)
 		if err != nil {
 			if os.IsNotExist(err) {
 				logger.Info1("RRA Installation not found")
@@ -15,6 +15,7 @@ var deboardVMCmd = &cobra.Command{
 
 func init() {
 	deboardCmd.PersistentFlags().StringVar((*string)(&vmMode), "vm-mode", "", "Mode of installation (systemd/docker)")
+	deboardCmd.PersistentFlags().StringVar((*string)(&containerRuntime), "container-runtime", "", "container runtime for docker mode (docker/podman/nerdctl), detected if not set")
 	deboardCmd.PersistentFlags().BoolVar(&disableVMScan, "disbale-vmscan", true, "Remove rra installation")
 	deboardCmd.AddCommand(deboardVMCmd)
 }
@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"github.com/accuknox/accuknox-cli-v2/pkg/discover"
+	"github.com/spf13/cobra"
+)
+
+var coverageOptions discover.CoverageOptions
+
+// discoverCoverageCmd represents the discover coverage command
+var discoverCoverageCmd = &cobra.Command{
+	Use:   "coverage",
+	Short: "Report which workloads are not covered by any policy",
+	Long: `Match every workload in the cluster against the selectors of the applied and discovered KubeArmor and network policies.
+The per-namespace coverage matrix lists the unprotected workloads, the ones only audited and the ones with enforcing policies.`,
+	Example: `  knoxctl discover coverage
+  knoxctl discover coverage -n default,wordpress-mysql -o markdown > coverage.md`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return discover.Coverage(client, coverageOptions)
+	},
+}
+
+func init() {
+	discoverCmd.AddCommand(discoverCoverageCmd)
+	discoverCoverageCmd.Flags().StringVar(&coverageOptions.GRPC, "gRPC", "", "gRPC server information")
+	discoverCoverageCmd.Flags().StringSliceVarP(&coverageOptions.Namespace, "namespace", "n", []string{}, "Filter by Namespace")
+	discoverCoverageCmd.Flags().StringVarP(&coverageOptions.Output, "output", "o", "table", "Output format: table, json or markdown")
+	discoverCoverageCmd.Flags().BoolVar(&coverageOptions.SkipDiscovered, "skip-discovered", false, "Only check the policies applied in the cluster")
+}
@@ -43,4 +43,6 @@ func init() {
 	discoverCmd.Flags().StringSliceVarP(&parseArgs.Namespace, "namespace", "n", []string{}, "Filter by Namespace")
 	discoverCmd.Flags().StringSliceVarP(&parseArgs.Labels, "labels", "l", []string{}, "Filter by policy Label")
 	discoverCmd.Flags().StringVarP(&parseArgs.View, "view", "v", "", "View policies as table, yaml or json.")
+	discoverCmd.Flags().BoolVar(&parseArgs.Raw, "raw", false, "Skip consolidation and show policies as discovered")
+	discoverCmd.Flags().BoolVar(&parseArgs.CollapseDirs, "collapsedirs", false, "Collapse sibling file paths into their directory while consolidating, this allows more than discovered")
 }
@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/accuknox/accuknox-cli-v2/pkg/fleet"
+	"github.com/accuknox/accuknox-cli-v2/pkg/logger"
+	"github.com/spf13/cobra"
+)
+
+var (
+	fleetInventory string
+	fleetOptions   fleet.Options
+)
+
+// fleetCmd represents the parent command for managing many VMs at once
+var fleetCmd = &cobra.Command{
+	Use:   "fleet",
+	Short: "Manage a fleet of VMs over SSH",
+	Long:  "Manage a fleet of VMs over SSH",
+}
+
+// fleetOnboardCmd onboards a control plane and its workers over SSH
+var fleetOnboardCmd = &cobra.Command{
+	Use:   "onboard",
+	Short: "Onboard a control plane and its worker nodes over SSH",
+	Long: `Onboard a control plane and its worker nodes over SSH
+
+knoxctl is pushed to every host of the inventory. The control plane is
+onboarded first, then the workers join it in parallel with its address,
+agents version and TLS material. Failed hosts are retried, and a status table
+is printed at the end.
+
+  version: v0.10.0
+  defaults:
+    user: ubuntu
+    identityFile: ~/.ssh/id_ed25519
+  controlPlane:
+    host: 10.0.0.1
+    args: [--access-key=..., --access-key-url=..., --spire-host=..., --pps-host=..., --knox-gateway=...]
+  workerArgs: [--spire-host=...]
+  workers:
+    - host: 10.0.0.2
+    - host: 10.0.0.3
+      user: ec2-user
+
+  knoxctl fleet onboard --inventory hosts.yaml --retries 2
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		inv, err := fleet.LoadInventory(fleetInventory)
+		if err != nil {
+			logger.Error("%s", err.Error())
+			return err
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+
+		results, err := fleet.Onboard(ctx, inv, fleetOptions)
+		if err != nil {
+			logger.Error("%s", err.Error())
+			return err
+		}
+		return fleet.PrintResults(os.Stdout, results)
+	},
+}
+
+func init() {
+	fleetOnboardCmd.Flags().StringVarP(&fleetInventory, "inventory", "i", "", "inventory file listing the control plane and the worker nodes")
+	fleetOnboardCmd.Flags().IntVar(&fleetOptions.Concurrency, "concurrency", fleet.DefaultConcurrency, "number of worker nodes onboarded in parallel")
+	fleetOnboardCmd.Flags().IntVar(&fleetOptions.Retries, "retries", 1, "number of times a failed host is retried")
+	fleetOnboardCmd.Flags().DurationVar(&fleetOptions.RetryDelay, "retry-delay", 10*time.Second, "delay before retrying a failed host, growing with every attempt")
+	_ = fleetOnboardCmd.MarkFlagRequired("inventory")
+
+	fleetCmd.AddCommand(fleetOnboardCmd)
+	rootCmd.AddCommand(fleetCmd)
+}
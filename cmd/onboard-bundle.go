@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/accuknox/accuknox-cli-v2/pkg/logger"
+	"github.com/accuknox/accuknox-cli-v2/pkg/onboard"
+	"github.com/spf13/cobra"
+)
+
+var (
+	bundlePath string
+
+	bundleVersion     string
+	bundleModes       []string
+	bundleOutput      string
+	bundleReleaseFile string
+	bundlePreserve    bool
+	bundleSigningKey  string
+)
+
+// onboardBundleCmd represents the sub-command for air-gapped bundles
+var onboardBundleCmd = &cobra.Command{
+	Use:   "bundle",
+	Short: "sub-command for air-gapped onboarding bundles",
+	Long:  "sub-command for air-gapped onboarding bundles",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return cmd.Help()
+	},
+}
+
+// bundleCreateCmd creates a bundle to onboard VMs without registry access
+var bundleCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Create a bundle of the agents of a release for air-gapped onboarding",
+	Long: `Create a bundle of the agents of a release for air-gapped onboarding.
+
+The bundle holds the docker images and the systemd packages of the agents,
+the release file and the checksums of all of them, signed with the key given
+with --signing-key. Copy it to the VMs and pass it to "knoxctl onboard vm
+cp-node" or "knoxctl onboard vm node" with --bundle, along with the public key
+of the signing key with --release-public-key.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := setupReleaseVerification(); err != nil {
+			logger.Error("%s", err.Error())
+			return err
+		}
+
+		var modes []onboard.VMMode
+		for _, mode := range bundleModes {
+			switch onboard.VMMode(mode) {
+			case onboard.VMMode_Docker, onboard.VMMode_Systemd:
+				modes = append(modes, onboard.VMMode(mode))
+			default:
+				return fmt.Errorf("vm mode: %s invalid, accepted values (docker/systemd)", mode)
+			}
+		}
+
+		manifest, err := onboard.CreateBundle(onboard.BundleOptions{
+			Version:            bundleVersion,
+			ReleaseFile:        bundleReleaseFile,
+			Modes:              modes,
+			Output:             bundleOutput,
+			Registry:           registry,
+			RegistryConfigPath: registryConfigPath,
+			Insecure:           insecure,
+			PlainHTTP:          plainHTTP,
+			PreserveUpstream:   bundlePreserve,
+			SigningKey:         bundleSigningKey,
+		})
+		if err != nil {
+			logger.Error("failed to create bundle: %s", err.Error())
+			return err
+		}
+
+		output := bundleOutput
+		if output == "" {
+			output = onboard.DefaultBundleFile(manifest.Version)
+		}
+		logger.PrintSuccess("Bundle of release %s created at %s (%d images, %d agents)",
+			manifest.Version, output, len(manifest.Images), len(manifest.Agents))
+		return nil
+	},
+}
+
+// openBundle opens the bundle given with --bundle, if any, and defaults the
+// release version and file to the ones of the bundle
+func openBundle() (*onboard.Bundle, error) {
+	if bundlePath == "" {
+		return nil, nil
+	}
+
+	b, err := onboard.OpenBundle(bundlePath)
+	if err != nil {
+		return nil, err
+	}
+
+	switch releaseVersion {
+	case "":
+		releaseVersion = b.Manifest.Version
+	case b.Manifest.Version:
+	default:
+		_ = b.Close()
+		return nil, fmt.Errorf("bundle is for release %s, not %s", b.Manifest.Version, releaseVersion)
+	}
+	if releaseFile == "" {
+		releaseFile = b.ReleaseFile()
+	}
+	return b, nil
+}
+
+func init() {
+	bundleCreateCmd.Flags().StringVarP(&bundleVersion, "version", "v", "", "agents release version to bundle (default latest)")
+	bundleCreateCmd.Flags().StringSliceVar(&bundleModes, "vm-mode", []string{string(onboard.VMMode_Docker), string(onboard.VMMode_Systemd)}, "modes of installation to bundle (systemd/docker)")
+	bundleCreateCmd.Flags().StringVarP(&bundleOutput, "output", "o", "", "path of the bundle (default knoxctl-bundle-<version>.tar)")
+	bundleCreateCmd.Flags().StringVar(&bundleReleaseFile, "release-file", "", "release file containing release versions of accuknox agents")
+	bundleCreateCmd.Flags().StringVar(&bundleSigningKey, "signing-key", "", "file of the base64 encoded ed25519 private key or seed signing the manifest of the bundle")
+	bundleCreateCmd.Flags().BoolVar(&bundlePreserve, "preserve-upstream-repo", true, "to keep upstream repo name e.g \"accuknox\" from accuknox/shared-informer-agent")
+
+	onboardBundleCmd.AddCommand(bundleCreateCmd)
+	onboardCmd.AddCommand(onboardBundleCmd)
+}
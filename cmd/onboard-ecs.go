@@ -0,0 +1,151 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/accuknox/accuknox-cli-v2/pkg/logger"
+	"github.com/accuknox/accuknox-cli-v2/pkg/onboard"
+	"github.com/spf13/cobra"
+)
+
+var (
+	ecsOpts        onboard.ECSOptions
+	ecsProfile     string
+	ecsEndpointURL string
+	ecsApply       bool
+	// ecsSpire is apart from spireEnabled as SPIRE is enabled by default on
+	// ECS
+	ecsSpire bool
+)
+
+// onboardECSCmd generates the ECS resources running the agents
+var onboardECSCmd = &cobra.Command{
+	Use:   "ecs",
+	Short: "Generate ECS task definitions and daemon services for onboarding ECS clusters onto SaaS",
+	Long: `Generate ECS task definitions and daemon services for onboarding ECS clusters onto SaaS.
+
+The task definition runs KubeArmor, the vm-adapter, the feeder service and,
+unless --spire=false, the SPIRE agent on every container instance of the
+cluster. The generated
+config directory must be copied to --host-config-path on the instances,
+e.g. through their user data. With --apply the task definition is registered
+and the daemon service created or updated with the aws CLI.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if ecsSpire && spireHost == "" {
+			logger.Error("SPIRE host is required")
+			return fmt.Errorf("SPIRE host is required")
+		}
+
+		if err := setupReleaseVerification(); err != nil {
+			logger.Error("%s", err.Error())
+			return err
+		}
+
+		ecsConfig, err := onboard.CreateClusterConfig(onboard.ClusterType_ECS, userConfigPath, onboard.VMMode_Docker,
+			vmAdapterTag, kubeArmorRelayServerTag, peaVersionTag, siaVersionTag,
+			feederVersionTag, sumEngineVersionTag, discoverVersionTag, hardeningAgentVersionTag, kubearmorVersion, releaseVersion, kubeArmorImage,
+			kubeArmorInitImage, kubeArmorVMAdapterImage, kubeArmorRelayServerImage, siaImage,
+			peaImage, feederImage, rmqImage, sumEngineImage, hardeningAgentImage, spireAgentImage, waitForItImage, discoverImage, nodeAddr, dryRun,
+			false, false, imagePullPolicy, visibility, hostVisibility, sumEngineVisibility, audit, block, hostAudit, hostBlock,
+			alertThrottling, maxAlertPerSec, throttleSec,
+			cidr, secureContainers, skipBTF, systemMonitorPath, rmqAddress, false, registry, registryConfigPath, insecure, plainHTTP, preserveUpstream, topicPrefix, rmqConnectionName, sumEngineCronTime, tls, false, splunk, nodeStateRefreshTime, ecsSpire, spireCert, logRotate, parallel, false, releaseFile)
+		if err != nil {
+			logger.Error("failed to create cluster config: %s", err.Error())
+			return err
+		}
+
+		if accessKey != "" {
+			if joinToken, err = ecsConfig.PopulateAccessKeyConfig(tokenURL, accessKey, ecsOpts.Cluster, "", tokenEndpoint, "vm", insecure); err != nil {
+				return err
+			}
+		}
+
+		onboardConfig := onboard.InitCPNodeConfig(*ecsConfig, joinToken, spireHost, "", knoxGateway, spireTrustBundle, spireDir, enableLogs)
+		resources, err := onboardConfig.GenerateECS(ecsOpts)
+		if err != nil {
+			logger.Error("failed to generate ECS resources: %s", err.Error())
+			return err
+		}
+
+		if err := resources.Write(); err != nil {
+			logger.Error("failed to write ECS resources: %s", err.Error())
+			return err
+		}
+		for _, file := range resources.Files() {
+			logger.Print("Created %s", file)
+		}
+
+		if !ecsApply || dryRun {
+			logger.PrintSuccess("ECS resources generated in %s", ecsOpts.Output)
+			return nil
+		}
+
+		client := onboard.AWSCLI{Region: ecsOpts.Region, Profile: ecsProfile, EndpointURL: ecsEndpointURL}
+		if err := onboard.ApplyECS(cmd.Context(), client, resources); err != nil {
+			logger.Error("%s", err.Error())
+			return err
+		}
+		logger.PrintSuccess("Service %s applied to ECS cluster %s", resources.Service.ServiceName, ecsOpts.Cluster)
+		return nil
+	},
+}
+
+func init() {
+	onboardECSCmd.Flags().StringVar(&ecsOpts.Cluster, "cluster", "", "ECS cluster to onboard")
+	onboardECSCmd.Flags().StringVar(&ecsOpts.Family, "family", onboard.DefaultECSFamily, "family of the task definition")
+	onboardECSCmd.Flags().StringVar(&ecsOpts.Service, "service", "", "name of the daemon service (default the family)")
+	onboardECSCmd.Flags().StringVarP(&ecsOpts.Output, "output", "o", "accuknox-ecs", "directory to write the ECS resources and agent config files to")
+	onboardECSCmd.Flags().StringVar(&ecsOpts.HostConfigPath, "host-config-path", onboard.DefaultECSHostConfigPath, "path of the agent config files on the container instances")
+	onboardECSCmd.Flags().StringVar(&ecsOpts.LogGroup, "log-group", "", "CloudWatch log group of the agents, logs are not sent to CloudWatch if empty")
+	onboardECSCmd.Flags().StringVar(&ecsOpts.Region, "region", "", "AWS region")
+	onboardECSCmd.Flags().StringVar(&ecsProfile, "aws-profile", "", "AWS profile used with --apply")
+	onboardECSCmd.Flags().StringVar(&ecsEndpointURL, "endpoint-url", "", "ECS endpoint used with --apply")
+	onboardECSCmd.Flags().BoolVar(&ecsApply, "apply", false, "register the task definition and apply the service with the aws CLI")
+
+	onboardECSCmd.Flags().StringVarP(&releaseVersion, "version", "v", "", "agents release version to use")
+	onboardECSCmd.Flags().StringVar(&releaseFile, "release-file", "", "release file containing release versions of accuknox agents")
+	onboardECSCmd.Flags().BoolVar(&ecsSpire, "spire", true, "run the SPIRE agent for authenticating the agents with accuknox SaaS")
+	onboardECSCmd.Flags().BoolVar(&spireCert, "spire-cert", false, "spire cert in base64 encoded format")
+	onboardECSCmd.Flags().StringVar(&spireHost, "spire-host", "", "address of spire-host to connect for authenticating with accuknox SaaS")
+	onboardECSCmd.Flags().StringVar(&knoxGateway, "knox-gateway", "", "address of knox-gateway to connect with for pushing telemetry data")
+	onboardECSCmd.Flags().StringVar(&spireTrustBundle, "spire-trust-bundle-addr", "", "address of spire trust bundle (CA cert for accuknox spire-server)")
+	onboardECSCmd.Flags().BoolVar(&enableLogs, "enable-logs", false, "enable pushing logs from feeder service")
+	onboardECSCmd.Flags().StringVar(&nodeAddr, "cp-node-addr", "", "address of a control plane node running the other agents, if any")
+	onboardECSCmd.Flags().StringVar(&accessKey, "access-key", "", "access-key for onboarding")
+	onboardECSCmd.Flags().StringVar(&tokenURL, "access-key-url", "", "access-key-url for onboarding")
+	onboardECSCmd.Flags().StringVar(&tokenEndpoint, "access-key-endpoint", "/access-token/api/v1/process", "access-key-endpoint for onboarding")
+
+	// images
+	onboardECSCmd.Flags().BoolVar(&preserveUpstream, "preserve-upstream-repo", true, "to keep upstream repo name e.g \"accuknox\" from accuknox/shared-informer-agent")
+	onboardECSCmd.Flags().StringVar(&imagePullPolicy, "image-pull-policy", "always", "image pull policy to use. Either of: missing | never | always")
+	onboardECSCmd.Flags().StringVar(&kubeArmorImage, "kubearmor-image", "", "KubeArmor image to use")
+	onboardECSCmd.Flags().StringVar(&kubeArmorInitImage, "kubearmor-init-image", "", "KubeArmor init image to use")
+	onboardECSCmd.Flags().StringVar(&kubeArmorVMAdapterImage, "kubearmor-vm-adapter-image", "", "KubeArmor vm-adapter image to use")
+	onboardECSCmd.Flags().StringVar(&vmAdapterTag, "vm-adapter-tag", "", "version tag for vm adapter")
+	onboardECSCmd.Flags().StringVar(&kubeArmorRelayServerImage, "kubearmor-relay-server", "", "KubeArmor relay-server image to use")
+	onboardECSCmd.Flags().StringVar(&kubeArmorRelayServerTag, "relayserver-version", "", "relay server version to use")
+	onboardECSCmd.Flags().StringVar(&feederImage, "feeder-image", "", "feeder-service image to use")
+	onboardECSCmd.Flags().StringVar(&feederVersionTag, "feeder-version", "", "feeder version to use")
+	onboardECSCmd.Flags().StringVar(&spireAgentImage, "spire-agent-image", "", "spire-agent image to use")
+
+	// visibility and posture
+	onboardECSCmd.Flags().StringVar(&visibility, "viz", "process,network", "Kubearmor visibility. Possible values: \"none\" or any combo of [process,network,file]")
+	onboardECSCmd.Flags().StringVar(&audit, "audit", "", "Kubearmor container audit posture. Possible values: \"all\" or combo of [file,network,capabilities]")
+	onboardECSCmd.Flags().StringVar(&block, "block", "", "Kubearmor container block posture. Possible values: \"all\" or combo of [file,network,capabilities]")
+	onboardECSCmd.Flags().StringVar(&hostVisibility, "host-viz", "process,network", "Kubearmor host visibility. Possible values: \"none\" or any combo of [process,network,file,capabilities]")
+	onboardECSCmd.Flags().StringVar(&hostAudit, "host-audit", "", "Kubearmor host audit posture. Possible values: \"all\" or combo of [file,network,capabilities]")
+	onboardECSCmd.Flags().StringVar(&hostBlock, "host-block", "", "Kubearmor host block posture. Possible values: \"all\" or combo of [file,network,capabilities]")
+	onboardECSCmd.Flags().BoolVar(&alertThrottling, "alert-throttling", true, "to toggle alert-throttling")
+	onboardECSCmd.Flags().IntVar(&maxAlertPerSec, "max-alerts-per-sec", 10, "specifies maximum alert rate past which throttling will be triggered")
+	onboardECSCmd.Flags().IntVar(&throttleSec, "throttle-sec", 30, "duration (in seconds) for which subsequent alerts will be dropped once alert throttling comes into action")
+	onboardECSCmd.Flags().IntVar(&nodeStateRefreshTime, "node-state-refresh-time", 10, "Refresh time for node state (default 10 minutes)")
+
+	if err := onboardECSCmd.MarkFlagRequired("cluster"); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	onboardECSCmd.MarkFlagsRequiredTogether("access-key", "access-key-url")
+
+	onboardCmd.AddCommand(onboardECSCmd)
+}
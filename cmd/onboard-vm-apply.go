@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/accuknox/accuknox-cli-v2/pkg/onboard"
+	"github.com/spf13/cobra"
+)
+
+// onboardVMApplyCmd onboards a node as described by a spec file
+var onboardVMApplyCmd = &cobra.Command{
+	Use:   "apply -f <spec.yaml> [flags]",
+	Short: "Onboard this node as described by a spec file",
+	Long: `Onboard this node as described by a spec file
+
+The spec is a YAML or JSON file holding the flags of "onboard vm cp-node"
+or "onboard vm node", depending on its nodeType:
+
+  apiVersion: onboard.accuknox.com/v1
+  kind: VMOnboarding
+  nodeType: control-plane
+  mode: systemd
+  version: v0.10.0
+  images:
+    kubearmor:
+      tag: v1.5.0
+  kubearmor:
+    visibility: process,network
+    block: file
+  saas:
+    ppsHost: pps.accuknox.com
+    knoxGateway: knox-gw.accuknox.com:3000
+  spire:
+    host: spire.accuknox.com
+  tls:
+    enabled: true
+    generate: true
+
+Flags of the cp-node and node commands can be given as well, they take
+precedence over the values of the spec:
+
+  knoxctl onboard vm apply -f spec.yaml --version v0.10.1
+`,
+	// the flags are those of cp-node or node, which is only known once the
+	// spec has been read
+	DisableFlagParsing: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		file, args, err := specFileArg(args)
+		if err != nil {
+			return err
+		}
+		if file == "" {
+			for _, arg := range args {
+				if arg == "-h" || arg == "--help" {
+					return cmd.Help()
+				}
+			}
+			return fmt.Errorf("a spec file is required, e.g. knoxctl onboard vm apply -f spec.yaml")
+		}
+
+		spec, err := onboard.LoadSpec(file)
+		if err != nil {
+			return err
+		}
+
+		target := cpNodeCmd
+		if spec.NodeType == onboard.NodeType_WorkerNode {
+			target = joinNodeCmd
+		}
+		if err := target.ParseFlags(args); err != nil {
+			return err
+		}
+
+		flags := target.Flags()
+		for _, f := range spec.Flags() {
+			flag := flags.Lookup(f.Name)
+			if flag == nil {
+				return fmt.Errorf("%s is not supported for %s nodes", f.Field, spec.NodeType)
+			}
+			// flags take precedence over the spec
+			if flag.Changed {
+				continue
+			}
+			for _, value := range f.Values {
+				if err := flags.Set(f.Name, value); err != nil {
+					return fmt.Errorf("invalid %s: %v", f.Field, err)
+				}
+			}
+		}
+
+		if err := target.ValidateRequiredFlags(); err != nil {
+			return err
+		}
+		if err := target.ValidateFlagGroups(); err != nil {
+			return err
+		}
+		return target.RunE(target, flags.Args())
+	},
+}
+
+// specFileArg takes the -f/--file flag out of the arguments
+func specFileArg(args []string) (string, []string, error) {
+	var (
+		file string
+		rest []string
+	)
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "-f" || arg == "--file":
+			if i+1 == len(args) {
+				return "", nil, fmt.Errorf("flag needs an argument: %s", arg)
+			}
+			file = args[i+1]
+			i++
+		case strings.HasPrefix(arg, "-f="):
+			file = strings.TrimPrefix(arg, "-f=")
+		case strings.HasPrefix(arg, "--file="):
+			file = strings.TrimPrefix(arg, "--file=")
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	return file, rest, nil
+}
+
+func init() {
+	onboardVMCmd.AddCommand(onboardVMApplyCmd)
+}
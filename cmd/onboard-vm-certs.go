@@ -0,0 +1,199 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/accuknox/accuknox-cli-v2/pkg/fleet"
+	"github.com/accuknox/accuknox-cli-v2/pkg/logger"
+	"github.com/accuknox/accuknox-cli-v2/pkg/onboard"
+	"github.com/spf13/cobra"
+)
+
+var (
+	certsJSON       bool
+	certsRotateOpts onboard.RotateCertsOptions
+	certsImportOpts onboard.ImportCertsOptions
+	certsInventory  string
+	certsYes        bool
+	certsFleetOpts  fleet.Options
+)
+
+// onboardVMCertsCmd is the parent command for the TLS certificates of
+// RabbitMQ on onboarded nodes
+var onboardVMCertsCmd = &cobra.Command{
+	Use:   "certs",
+	Short: "Manage the RabbitMQ TLS certificates of an onboarded node",
+	Long: `Manage the RabbitMQ TLS certificates of an onboarded node
+
+Nodes onboarded with --tls connect to RabbitMQ on the control plane with a CA
+generated while onboarding, or given with --ca-path. Use rotate-tls for the
+certificates of the Kubernetes webhook.`,
+}
+
+// onboardVMCertsStatusCmd shows the expiry of the certificates
+var onboardVMCertsStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the expiry of the CA and RabbitMQ certificates",
+	Long: `Show the expiry of the CA and RabbitMQ certificates
+
+Certificates expiring in less than 30 days are reported as expiring.
+
+  knoxctl onboard vm certs status
+  knoxctl onboard vm certs status --json
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		statuses, err := onboard.CertsStatus()
+		if err != nil {
+			logger.Error("%s", err.Error())
+			return err
+		}
+		return onboard.PrintCertsStatus(os.Stdout, statuses, certsJSON)
+	},
+}
+
+// onboardVMCertsRotateCmd rotates the certificates of a control plane
+var onboardVMCertsRotateCmd = &cobra.Command{
+	Use:   "rotate",
+	Short: "Rotate the RabbitMQ certificate of the control plane, and optionally its CA",
+	Long: `Rotate the RabbitMQ certificate of the control plane, and optionally its CA
+
+A new certificate is signed by the current CA, whose key is stored while
+onboarding or given with --ca-key. With --ca a new CA is generated as well:
+the agents of the control plane first trust a bundle of the current and the
+new CA, which the worker nodes must import before RabbitMQ switches to the new
+CA. With --inventory the bundle is pushed to the workers of a fleet inventory
+over SSH, otherwise the import command to run on every worker is printed and
+the rotation waits for a confirmation.
+
+RabbitMQ is restarted with the new certificate once the agents trust its CA.
+Once every worker switched, --finalize makes the agents of the control plane,
+then the workers, trust the new CA only. The replaced files are kept with a
+.bak suffix.
+
+  knoxctl onboard vm certs rotate --dns rmq.example.com --ips 10.0.0.1
+  knoxctl onboard vm certs rotate --ca --inventory hosts.yaml
+  knoxctl onboard vm certs rotate --finalize --inventory hosts.yaml
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if certsInventory != "" && !certsRotateOpts.CA && !certsRotateOpts.Finalize {
+			logger.Warn("The CA is not rotated, --inventory is ignored")
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+
+		// --ips and --dns replace the SANs given while onboarding
+		certsRotateOpts.IPs = tls.IPs
+		certsRotateOpts.DNS = tls.DNS
+		if certsRotateOpts.CA || certsRotateOpts.Finalize {
+			// RabbitMQ waits for the workers only when switching to a new CA
+			wait := !certsRotateOpts.Finalize
+			certsRotateOpts.TrustCA = func(caCert string) error {
+				return trustCA(ctx, caCert, wait)
+			}
+		}
+		rotation, err := onboard.RotateCerts(certsRotateOpts)
+		if rotation != nil && len(rotation.Restarted) > 0 {
+			logger.Print("Restarted %s", strings.Join(rotation.Restarted, ", "))
+		}
+		if err != nil {
+			logger.Error("failed to rotate the certificates: %s", err.Error())
+			return err
+		}
+		logger.PrintSuccess("Certificates rotated.")
+		return nil
+	},
+}
+
+// trustCA makes the worker nodes import the CA, over SSH with an inventory,
+// otherwise it prints the import command and, if asked to wait, returns once
+// the user confirms they ran it
+func trustCA(ctx context.Context, caCert string, wait bool) error {
+	if certsInventory == "" {
+		logger.Print("Import the CA on every worker node with:\n\n  knoxctl onboard vm certs import --ca-cert=%s\n", caCert)
+		if certsYes || !wait {
+			return nil
+		}
+		fmt.Print("Did every worker node import the CA? (y/n): ")
+		response, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("error reading response: %v", err)
+		}
+		if strings.ToLower(strings.TrimSpace(response)) != "y" {
+			return fmt.Errorf("the import was not confirmed")
+		}
+		return nil
+	}
+
+	inv, err := fleet.LoadInventory(certsInventory)
+	if err != nil {
+		return err
+	}
+	results, err := fleet.PushCA(ctx, inv, caCert, certsFleetOpts)
+	if err != nil {
+		return err
+	}
+	return fleet.PrintResults(os.Stdout, results)
+}
+
+// onboardVMCertsImportCmd imports certificates on a node
+var onboardVMCertsImportCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Import a CA, or a RabbitMQ certificate and key, on an onboarded node",
+	Long: `Import a CA, or a RabbitMQ certificate and key, on an onboarded node
+
+Control planes import a CA, a certificate and its key, or all of them, the
+certificate must be signed by the CA. Worker nodes import the CA of their
+control plane, as printed by rotate. The agents using the certificates are
+restarted.
+
+  knoxctl onboard vm certs import --ca ca.pem --cert rmq.pem --key rmq-key.pem
+  knoxctl onboard vm certs import --ca-cert=LS0tLS1CRUdJTi...
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		restarted, err := onboard.ImportCerts(certsImportOpts)
+		if err != nil {
+			logger.Error("failed to import the certificates: %s", err.Error())
+			return err
+		}
+		if len(restarted) > 0 {
+			logger.Print("Restarted %s", strings.Join(restarted, ", "))
+		}
+		logger.PrintSuccess("Certificates imported.")
+		return nil
+	},
+}
+
+func init() {
+	onboardVMCertsStatusCmd.Flags().BoolVar(&certsJSON, "json", false, "Print the certificates in the JSON format")
+
+	onboardVMCertsRotateCmd.Flags().BoolVar(&certsRotateOpts.CA, "ca", false, "generate a new CA as well, worker nodes must import it")
+	onboardVMCertsRotateCmd.Flags().StringVar(&certsRotateOpts.CAKeyPath, "ca-key", "", "key of the current CA, if it was not generated by knoxctl")
+	onboardVMCertsRotateCmd.Flags().BoolVar(&certsRotateOpts.Finalize, "finalize", false, "trust the new CA only once every worker node imported it after rotating the CA")
+	onboardVMCertsRotateCmd.Flags().StringVarP(&certsInventory, "inventory", "i", "", "fleet inventory whose worker nodes import the new CA over SSH")
+	onboardVMCertsRotateCmd.Flags().BoolVarP(&certsYes, "yes", "y", false, "switch RabbitMQ to the new CA without waiting for the worker nodes to import it")
+	onboardVMCertsRotateCmd.Flags().IntVar(&certsFleetOpts.Concurrency, "concurrency", fleet.DefaultConcurrency, "number of worker nodes updated in parallel")
+	onboardVMCertsRotateCmd.Flags().IntVar(&certsFleetOpts.Retries, "retries", 1, "number of times a failed worker node is retried")
+	onboardVMCertsRotateCmd.Flags().DurationVar(&certsFleetOpts.RetryDelay, "retry-delay", 10*time.Second, "delay before retrying a failed worker node, growing with every attempt")
+
+	onboardVMCertsRotateCmd.MarkFlagsMutuallyExclusive("ca", "finalize")
+	onboardVMCertsRotateCmd.MarkFlagsMutuallyExclusive("ca-key", "finalize")
+
+	onboardVMCertsImportCmd.Flags().StringVar(&certsImportOpts.CAPath, "ca", "", "CA file in the PEM format")
+	onboardVMCertsImportCmd.Flags().StringVar(&certsImportOpts.CertPath, "cert", "", "RabbitMQ certificate file in the PEM format, control plane only")
+	onboardVMCertsImportCmd.Flags().StringVar(&certsImportOpts.KeyPath, "key", "", "RabbitMQ key file in the PEM format, control plane only")
+	onboardVMCertsImportCmd.Flags().StringVar(&certsImportOpts.CACert, "ca-cert", "", "base64 encoded CA of the control plane")
+	onboardVMCertsImportCmd.MarkFlagsRequiredTogether("cert", "key")
+	onboardVMCertsImportCmd.MarkFlagsMutuallyExclusive("ca", "ca-cert")
+
+	onboardVMCertsCmd.AddCommand(onboardVMCertsStatusCmd)
+	onboardVMCertsCmd.AddCommand(onboardVMCertsRotateCmd)
+	onboardVMCertsCmd.AddCommand(onboardVMCertsImportCmd)
+	onboardVMCmd.AddCommand(onboardVMCertsCmd)
+}
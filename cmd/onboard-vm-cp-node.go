@@ -61,11 +61,14 @@ var cpNodeCmd = &cobra.Command{
 	Short: "Initialize a control plane node for onboarding onto SaaS",
 	Long:  "Initialize a control plane node for onboarding onto SaaS",
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := readAuthFile(); err != nil {
+			logger.Error("%s", err.Error())
+			return err
+		}
+
 		// validate environment for pre-requisites
-		var (
-			cc  onboard.ClusterConfig
-			err error
-		)
+		var err error
+		cc := onboard.ClusterConfig{ContainerRuntime: containerRuntime}
 
 		_, err = cc.ValidateEnv()
 
@@ -110,6 +113,20 @@ var cpNodeCmd = &cobra.Command{
 			}
 		}
 
+		if err := setupReleaseVerification(); err != nil {
+			logger.Error("%s", err.Error())
+			return err
+		}
+
+		bundle, err := openBundle()
+		if err != nil {
+			logger.Error("failed to open bundle: %s", err.Error())
+			return err
+		}
+		if bundle != nil {
+			defer bundle.Close()
+		}
+
 		vmConfig, err := onboard.CreateClusterConfig(onboard.ClusterType_VM, userConfigPath, vmMode,
 			vmAdapterTag, kubeArmorRelayServerTag, peaVersionTag, siaVersionTag,
 			feederVersionTag, sumEngineVersionTag, discoverVersionTag, hardeningAgentVersionTag, kubearmorVersion, releaseVersion, kubeArmorImage,
@@ -128,6 +145,14 @@ var cpNodeCmd = &cobra.Command{
 			return err
 		}
 
+		vmConfig.ContainerRuntime = cc.ContainerRuntime
+		if bundle != nil {
+			if err := vmConfig.UseBundle(bundle); err != nil {
+				logger.Error("failed to use bundle: %s", err.Error())
+				return err
+			}
+		}
+
 		if accessKey != "" {
 			if joinToken, err = vmConfig.PopulateAccessKeyConfig(tokenURL, accessKey, topicPrefix, vmName, tokenEndpoint, "vm", insecure); err != nil {
 				return err
@@ -143,6 +168,13 @@ var cpNodeCmd = &cobra.Command{
 			}
 		}()
 
+		stepOpts, closeEvents, err := onboardStepOptions()
+		if err != nil {
+			logger.Error("failed to open events file: %s", err.Error())
+			return err
+		}
+		defer closeEvents()
+
 		err = onboardConfig.CreateBaseTemplateConfig()
 		if err != nil {
 			logger.Error("failed to create base template config: %s", err.Error())
@@ -152,13 +184,13 @@ var cpNodeCmd = &cobra.Command{
 		switch vmMode {
 
 		case onboard.VMMode_Systemd:
-			err = onboardConfig.InitializeControlPlaneSD()
+			err = onboardConfig.InitializeControlPlaneSD(stepOpts)
 			if err != nil {
 				logger.Error("failed to onboard control plane node: %s", err.Error())
 				return err
 			}
 		case onboard.VMMode_Docker:
-			err = onboardConfig.InitializeControlPlane()
+			err = onboardConfig.InitializeControlPlane(stepOpts)
 			if err != nil {
 				logger.Error("failed to onboard control plane node: %s", err.Error())
 				return err
@@ -237,6 +269,7 @@ func init() {
 	}
 
 	cpNodeCmd.MarkFlagsRequiredTogether("access-key", "access-key-url")
+	addOnboardStepFlags(cpNodeCmd)
 
 	onboardVMCmd.AddCommand(cpNodeCmd)
 }
@@ -35,6 +35,11 @@ var joinNodeCmd = &cobra.Command{
 	RunE: func(cmd *cobra.Command, args []string) error {
 		var err error
 
+		if err := readAuthFile(); err != nil {
+			logger.Error("%s", err.Error())
+			return err
+		}
+
 		if spireEnabled && spireHost == "" {
 			logger.Error("spire is enabled, spire host must be specified")
 			return fmt.Errorf("spire is enabled, spire host must be specified")
@@ -53,7 +58,7 @@ var joinNodeCmd = &cobra.Command{
 			}
 		}
 		// validate environment for pre-requisites
-		var cc onboard.ClusterConfig
+		cc := onboard.ClusterConfig{ContainerRuntime: containerRuntime}
 		_, err = cc.ValidateEnv()
 		if vmMode == "" {
 			if err == nil {
@@ -90,6 +95,20 @@ var joinNodeCmd = &cobra.Command{
 			}
 		}
 
+		if err := setupReleaseVerification(); err != nil {
+			logger.Error("%s", err.Error())
+			return err
+		}
+
+		bundle, err := openBundle()
+		if err != nil {
+			logger.Error("failed to open bundle: %s", err.Error())
+			return err
+		}
+		if bundle != nil {
+			defer bundle.Close()
+		}
+
 		vmConfigs, err := onboard.CreateClusterConfig(onboard.ClusterType_VM, userConfigPath, vmMode,
 			vmAdapterTag, kubeArmorRelayServerTag, peaVersionTag, siaVersionTag,
 			feederVersionTag, sumEngineVersionTag, discoverVersionTag, hardeningAgentVersionTag, kubearmorVersion, releaseVersion, kubeArmorImage,
@@ -108,6 +127,14 @@ var joinNodeCmd = &cobra.Command{
 			return err
 		}
 
+		vmConfigs.ContainerRuntime = cc.ContainerRuntime
+		if bundle != nil {
+			if err := vmConfigs.UseBundle(bundle); err != nil {
+				logger.Error("failed to use bundle: %s", err.Error())
+				return err
+			}
+		}
+
 		if accessKey != "" {
 			if joinToken, err = vmConfigs.PopulateAccessKeyConfig(tokenURL, accessKey, topicPrefix, vmName, tokenEndpoint, "Node", insecure); err != nil {
 				return err
@@ -123,6 +150,13 @@ var joinNodeCmd = &cobra.Command{
 			}
 		}()
 
+		stepOpts, closeEvents, err := onboardStepOptions()
+		if err != nil {
+			logger.Error("failed to open events file: %s", err.Error())
+			return err
+		}
+		defer closeEvents()
+
 		err = joinConfig.CreateBaseNodeConfig()
 		if err != nil {
 			logger.Error("failed to create VM config: %s", err.Error())
@@ -132,13 +166,13 @@ var joinNodeCmd = &cobra.Command{
 		switch vmMode {
 
 		case onboard.VMMode_Systemd:
-			if err := joinConfig.JoinSystemdNode(); err != nil {
+			if err := joinConfig.JoinSystemdNode(stepOpts); err != nil {
 				logger.Error("failed to join worker node: %s", err.Error())
 				return err
 			}
 
 		case onboard.VMMode_Docker:
-			err = joinConfig.JoinWorkerNode()
+			err = joinConfig.JoinWorkerNode(stepOpts)
 			if err != nil {
 				logger.Error("failed to join worker node: %s", err.Error())
 				return err
@@ -191,6 +225,7 @@ func init() {
 	joinNodeCmd.PersistentFlags().StringVar(&tokenEndpoint, "license-key-endpoint", "/access-token/api/v1/process", "license-key-endpoint for onboarding")
 
 	joinNodeCmd.MarkFlagsRequiredTogether("license-key", "license-key-url")
+	addOnboardStepFlags(joinNodeCmd)
 
 	onboardVMCmd.AddCommand(joinNodeCmd)
 }
@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/accuknox/accuknox-cli-v2/pkg/onboard"
+	"github.com/accuknox/accuknox-cli-v2/pkg/vm"
+	"github.com/spf13/cobra"
+)
+
+var (
+	preflightNodeType string
+	preflightJSON     bool
+)
+
+// onboardVMPreflightCmd checks if a node meets the requirements for onboarding
+var onboardVMPreflightCmd = &cobra.Command{
+	Use:   "preflight",
+	Short: "Check if this node meets the requirements for onboarding",
+	Long: `Check if this node meets the requirements for onboarding
+
+The checks run depend on the mode and node type: the container runtime,
+kernel and BTF, LSMs, cgroup v2, disk space, port conflicts, DNS and TLS
+reachability of knox-gateway, SPIRE, PPS or the control plane, registry
+authentication and clock skew. Each check passes, warns or fails with a hint
+on how to fix it. Exits with a non-zero code if any check fails.
+
+  knoxctl onboard vm preflight --knox-gateway knox-gw.accuknox.com:3000 --pps-host pps.accuknox.com --spire-host spire.accuknox.com
+  knoxctl onboard vm preflight --node-type worker-node --cp-node-addr 10.0.0.1 --json
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		nodeType, ok := onboard.NodeTypeValues[preflightNodeType]
+		if !ok {
+			return fmt.Errorf("node type: %s invalid, accepted values (control-plane/worker-node)", preflightNodeType)
+		}
+
+		mode := vmMode
+		switch mode {
+		case "":
+			// same detection as cp-node and node
+			cc := onboard.ClusterConfig{ContainerRuntime: containerRuntime}
+			if _, err := cc.ValidateEnv(); err == nil {
+				mode = onboard.VMMode_Docker
+			} else {
+				mode = onboard.VMMode_Systemd
+			}
+		case onboard.VMMode_Docker, onboard.VMMode_Systemd:
+		default:
+			return fmt.Errorf("vm mode: %s invalid, accepted values (docker/systemd)", mode)
+		}
+
+		report := vm.Preflight(&vm.PreflightOptions{
+			Mode:               mode,
+			ContainerRuntime:   containerRuntime,
+			NodeType:           nodeType,
+			KnoxGateway:        knoxGateway,
+			SpireHost:          spireHost,
+			PPSHost:            ppsHost,
+			CPNodeAddr:         nodeAddr,
+			RMQAddr:            rmqAddress,
+			Registry:           registry,
+			RegistryConfigPath: registryConfigPath,
+			Insecure:           insecure,
+			PlainHTTP:          plainHTTP,
+			SkipBTFCheck:       skipBTF,
+			SystemMonitorPath:  systemMonitorPath,
+		})
+		if err := report.Print(os.Stdout, preflightJSON); err != nil {
+			return err
+		}
+
+		if report.Failed() {
+			return fmt.Errorf("preflight checks failed")
+		}
+		return nil
+	},
+}
+
+func init() {
+	onboardVMPreflightCmd.Flags().StringVar(&preflightNodeType, "node-type", string(onboard.NodeType_ControlPlane), "type of the node to check (control-plane/worker-node)")
+	onboardVMPreflightCmd.Flags().StringVar(&ppsHost, "pps-host", "", "address of policy-provider-service to check for a control plane node")
+	onboardVMPreflightCmd.Flags().StringVar(&nodeAddr, "cp-node-addr", "", "address of the control plane to check for a worker node")
+	onboardVMPreflightCmd.Flags().BoolVar(&preflightJSON, "json", false, "Print the results in the JSON format")
+
+	onboardVMCmd.AddCommand(onboardVMPreflightCmd)
+}
@@ -19,7 +19,7 @@ var onboardVmScanCmd = &cobra.Command{
 	RunE: func(cmd *cobra.Command, args []string) error {
 
 		// create cluster config
-		var cc onboard.ClusterConfig
+		cc := onboard.ClusterConfig{ContainerRuntime: containerRuntime}
 		_, err := cc.ValidateEnv()
 		if vmMode == "" {
 			if err == nil {
@@ -35,7 +35,7 @@ var onboardVmScanCmd = &cobra.Command{
 
 		}
 
-		agentsDeployed := isDeployed(vmMode)
+		agentsDeployed := isDeployed(vmMode, cc.ContainerRuntime)
 
 		configPath, err := common.GetDefaultConfigPath()
 		if err != nil {
@@ -89,11 +89,11 @@ func init() {
 	onboardVMCmd.AddCommand(onboardVmScanCmd)
 }
 
-func isDeployed(vmMode onboard.VMMode) bool {
+func isDeployed(vmMode onboard.VMMode, runtime onboard.ContainerRuntime) bool {
 
 	switch vmMode {
 	case onboard.VMMode_Docker:
-		containers, _, err := deboard.GetInstalledObjects()
+		containers, _, err := deboard.GetInstalledObjects(runtime)
 		if err != nil {
 			return false
 		}
@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/accuknox/accuknox-cli-v2/pkg/logger"
+	"github.com/accuknox/accuknox-cli-v2/pkg/onboard"
+	"github.com/spf13/cobra"
+)
+
+var (
+	upgradeVersion string
+	upgradeYes     bool
+)
+
+// onboardVMUpgradeCmd upgrades the agents of an onboarded node to a release
+var onboardVMUpgradeCmd = &cobra.Command{
+	Use:   "upgrade",
+	Short: "Upgrade the agents of an onboarded node to a release",
+	Long: `Upgrade the agents of an onboarded node to a release
+
+The knoxctl config stored while onboarding the node is compared with the
+release: only the agents whose image, config or kmux files change are
+updated and restarted. Images not matching the tag of the current release
+were set explicitly and are kept.
+
+If the upgrade fails, the files, images and release file of the node are
+rolled back.
+
+  knoxctl onboard vm upgrade --version v0.10.1
+  knoxctl onboard vm upgrade --release-file release.json --dry-run
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := setupReleaseVerification(); err != nil {
+			logger.Error("%s", err.Error())
+			return err
+		}
+
+		plan, err := onboard.PlanUpgrade(onboard.UpgradeOptions{
+			Version:            upgradeVersion,
+			ReleaseFile:        releaseFile,
+			Registry:           registry,
+			RegistryConfigPath: registryConfigPath,
+			Insecure:           insecure,
+			PlainHTTP:          plainHTTP,
+		})
+		if err != nil {
+			logger.Error("failed to plan the upgrade: %s", err.Error())
+			return err
+		}
+
+		if plan.UpToDate() {
+			logger.PrintSuccess("The node is up to date with release %s.", plan.NewVersion)
+			return nil
+		}
+		plan.Print(os.Stdout)
+
+		if dryRun {
+			return nil
+		}
+		if !upgradeYes {
+			fmt.Print("Do you want to apply the upgrade? (y/n): ")
+			response, err := bufio.NewReader(os.Stdin).ReadString('\n')
+			if err != nil {
+				return fmt.Errorf("error reading response: %v", err)
+			}
+			if strings.ToLower(strings.TrimSpace(response)) != "y" {
+				fmt.Println("Upgrade cancelled.")
+				return nil
+			}
+		}
+
+		if err := plan.Apply(); err != nil {
+			logger.Error("%s", err.Error())
+			return err
+		}
+		logger.PrintSuccess("Node upgraded to release %s.", plan.NewVersion)
+		return nil
+	},
+}
+
+func init() {
+	onboardVMUpgradeCmd.Flags().StringVarP(&upgradeVersion, "version", "v", "", "agents release version to upgrade to (default: the latest release)")
+	onboardVMUpgradeCmd.Flags().BoolVarP(&upgradeYes, "yes", "y", false, "apply the upgrade without asking for a confirmation")
+
+	onboardVMCmd.AddCommand(onboardVMUpgradeCmd)
+}
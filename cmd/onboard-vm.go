@@ -1,6 +1,12 @@
 package cmd
 
 import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
 	"github.com/accuknox/accuknox-cli-v2/pkg/onboard"
 	"github.com/spf13/cobra"
 )
@@ -8,8 +14,10 @@ import (
 var (
 	clusterType onboard.ClusterType
 	vmMode      onboard.VMMode
-	tls         onboard.TLS
-	splunk      onboard.SplunkConfig
+	// container runtime for docker mode
+	containerRuntime onboard.ContainerRuntime
+	tls              onboard.TLS
+	splunk           onboard.SplunkConfig
 
 	kubearmorVersion string
 	releaseVersion   string
@@ -76,6 +84,14 @@ var (
 	parallel int
 
 	releaseFile string
+
+	// file with the rabbitmq credentials, - for stdin
+	authFile string
+
+	// steps of onboarding to run
+	fromStep   string
+	onlyStep   string
+	eventsFile string
 )
 
 // onboardVMCmd represents the sub-command to onboard VM clusters
@@ -97,6 +113,7 @@ func init() {
 	// all flags are optional
 	// add a mode flag here for systemd or docker
 	onboardVMCmd.PersistentFlags().StringVar((*string)(&vmMode), "vm-mode", "", "Mode of installation (systemd/docker)")
+	onboardVMCmd.PersistentFlags().StringVar((*string)(&containerRuntime), "container-runtime", "", "container runtime for docker mode (docker/podman/nerdctl), detected if not set")
 	onboardVMCmd.PersistentFlags().BoolVar(&secureContainers, "secure-containers", true, "to monitor containers")
 
 	onboardVMCmd.PersistentFlags().BoolVar(&skipBTF, "skip-btf-check", false, "to install even if BTF is not present")
@@ -152,6 +169,8 @@ func init() {
 	onboardVMCmd.PersistentFlags().StringVar(&tls.CommonName, "tls-cn", "accuknox", "CommonName for TLS certificates")
 
 	onboardVMCmd.PersistentFlags().StringVar(&tls.RMQCredentials, "auth", "", "rabbitmq credentials in base64 encoded key:value format")
+	onboardVMCmd.PersistentFlags().StringVar(&authFile, "auth-file", "", "file with the rabbitmq credentials in base64 encoded key:value format, - for stdin")
+	onboardVMCmd.MarkFlagsMutuallyExclusive("auth", "auth-file")
 	onboardVMCmd.PersistentFlags().StringArrayVar(&tls.DNS, "dns", []string{}, "DNS names for TLS certificates")
 
 	onboardVMCmd.PersistentFlags().StringArrayVar(&tls.IPs, "ips", []string{}, "List of IPs for TLS certificates")
@@ -203,5 +222,59 @@ func init() {
 
 	onboardVMCmd.PersistentFlags().StringVar(&releaseFile, "release-file", "", "release file containing release versions of accuknox agents")
 
+	onboardVMCmd.PersistentFlags().StringVar(&bundlePath, "bundle", "", "air-gapped bundle created with \"knoxctl onboard bundle create\" to install the agents from")
+
 	onboardCmd.AddCommand(onboardVMCmd)
 }
+
+// addOnboardStepFlags adds the flags selecting the steps of onboarding a node
+func addOnboardStepFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&fromStep, "from-step", "", "run the onboarding steps from this one, one of validate-env, tls, generate-config, pull-images, install or wait-healthy")
+	cmd.Flags().StringVar(&onlyStep, "only-step", "", "run this onboarding step only")
+	cmd.Flags().StringVar(&eventsFile, "events-file", "", "write the progress of every onboarding step as JSON lines to this file")
+	cmd.MarkFlagsMutuallyExclusive("from-step", "only-step")
+}
+
+// readAuthFile sets the rabbitmq credentials from --auth-file, which keeps
+// them out of the process list
+func readAuthFile() error {
+	if authFile == "" {
+		return nil
+	}
+
+	var data []byte
+	var err error
+	if authFile == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(filepath.Clean(authFile))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read the rabbitmq credentials: %v", err)
+	}
+	tls.RMQCredentials = strings.TrimSpace(string(data))
+	return nil
+}
+
+// onboardStepOptions returns the steps of onboarding selected by the flags,
+// the returned func closes the events file
+func onboardStepOptions() (onboard.StepOptions, func(), error) {
+	opts := onboard.StepOptions{
+		FromStep: onboard.OnboardStep(fromStep),
+		OnlyStep: onboard.OnboardStep(onlyStep),
+	}
+	switch eventsFile {
+	case "":
+		return opts, func() {}, nil
+	case "-":
+		// stdout is shared with the logs of onboarding
+		return opts, nil, fmt.Errorf("--events-file must be a file, the events can not be written to stdout")
+	}
+
+	f, err := os.OpenFile(filepath.Clean(eventsFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return opts, nil, err
+	}
+	opts.Events = f
+	return opts, func() { _ = f.Close() }, nil
+}
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/accuknox/accuknox-cli-v2/pkg/common"
+	"github.com/accuknox/accuknox-cli-v2/pkg/logger"
 	"github.com/spf13/cobra"
 )
 
@@ -14,6 +16,9 @@ var (
 	registry           string
 	plainHTTP          bool
 	insecure           bool
+
+	skipVerification bool
+	releasePublicKey string
 )
 
 // onboardCmd represents the onboard non-k8s cluster command
@@ -31,6 +36,21 @@ var onboardCmd = &cobra.Command{
 	},
 }
 
+// setupReleaseVerification configures how release files and agent artifacts
+// are verified
+func setupReleaseVerification() error {
+	if skipVerification {
+		logger.Warn("Skipping the verification of the release file and of the agent digests")
+		common.SkipReleaseVerification = true
+	}
+	if releasePublicKey != "" {
+		if err := common.AddReleasePublicKey(releasePublicKey); err != nil {
+			return fmt.Errorf("failed to read release public key: %v", err)
+		}
+	}
+	return nil
+}
+
 func init() {
 	// local configuration
 	onboardCmd.PersistentFlags().StringVarP(&kubearmorVersion, "kubearmor-version", "", "", "version of KubeArmor to use")
@@ -53,6 +73,8 @@ func init() {
 	onboardCmd.PersistentFlags().BoolVarP(&insecure, "insecure", "", false, "skip verifying TLS certs")
 	onboardCmd.PersistentFlags().Lookup("plain-http").NoOptDefVal = "true"
 	onboardCmd.PersistentFlags().Lookup("insecure").NoOptDefVal = "true"
+	onboardCmd.PersistentFlags().BoolVar(&skipVerification, "skip-verification", false, "skip verifying the signature of the release file and the digests of the agents")
+	onboardCmd.PersistentFlags().StringVar(&releasePublicKey, "release-public-key", "", "file of base64 encoded ed25519 public keys trusted for signing release files, besides the ones shipped with knoxctl")
 	onboardCmd.PersistentFlags().StringVar(&joinToken, "join-token", "", "join-token to use")
 
 	rootCmd.AddCommand(onboardCmd)
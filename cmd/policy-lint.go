@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"errors"
+
+	"github.com/accuknox/accuknox-cli-v2/pkg/lint"
+	"github.com/spf13/cobra"
+)
+
+var lintOptions lint.Options
+
+// knoxPolicyCmd represents the parent command for working with policy files
+var knoxPolicyCmd = &cobra.Command{
+	Use:   "policy",
+	Short: "Work with KubeArmor policy files",
+	Long:  "Work with KubeArmor policy files, like validating them before they are applied",
+}
+
+// policyLintCmd represents the `lint` subcommand for policies
+var policyLintCmd = &cobra.Command{
+	Use:   "lint <files|directories>",
+	Short: "Validate KubeArmor policies",
+	Long: `Statically validate KubeArmorPolicy and KubeArmorHostPolicy files against the policy schema.
+Apart from schema errors, contradictory Allow/Block rules, unreachable fromSource paths, overly broad directories,
+unknown capabilities and protocols and missing selectors are reported. Exits with a non-zero code on errors.`,
+	Example: `  knoxctl policy lint policies/
+  knoxctl policy lint ksp-nginx.yaml hsp-host.yaml --json`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 1 {
+			return errors.New("requires at least one policy file or directory as argument")
+		}
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return lint.Lint(lintOptions, args)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(knoxPolicyCmd)
+	knoxPolicyCmd.AddCommand(policyLintCmd)
+
+	policyLintCmd.Flags().BoolVar(&lintOptions.JSON, "json", false, "Print the findings in the JSON format")
+	policyLintCmd.Flags().BoolVar(&lintOptions.Strict, "strict", false, "Treat warnings as errors")
+}
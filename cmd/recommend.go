@@ -40,5 +40,9 @@ func init() {
 	recommendCmd.Flags().StringSliceVarP(&recommendOptions.Namespace, "namespace", "n", []string{}, "Filter by Namespace")
 	recommendCmd.Flags().StringVarP(&recommendOptions.Grpc, "gRPC", "", "", "gRPC address of discovery engine")
 	recommendCmd.Flags().BoolVar(&recommendOptions.Dump, "dump", false, "Dump policies to knoxctl_out directory and skip TUI")
-	recommendCmd.Flags().StringVarP(&recommendOptions.View, "view", "v", "", "View policies as table, yaml or json.")
+	recommendCmd.Flags().StringVarP(&recommendOptions.View, "view", "v", "", "View policies as table, yaml or json, or as group for per-namespace counts by tag and severity.")
+	recommendCmd.Flags().StringSliceVarP(&recommendOptions.Labels, "labels", "l", []string{}, "Filter by policy Label")
+	recommendCmd.Flags().StringSliceVarP(&recommendOptions.Tags, "tags", "t", []string{}, "Filter by tag or compliance framework, e.g. NIST, CIS, MITRE or PCI_DSS")
+	recommendCmd.Flags().StringVarP(&recommendOptions.Severity, "severity", "s", "", "Filter by severity or severity range, e.g. 7 or 5-10")
+	recommendCmd.Flags().StringSliceVarP(&recommendOptions.Action, "action", "a", []string{}, "Filter by action: Allow|Audit|Block")
 }
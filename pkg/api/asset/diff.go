@@ -0,0 +1,141 @@
+package asset
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+
+	"github.com/olekukonko/tablewriter"
+)
+
+const AssetDiffDescription = `
+1. knoxctl api asset list --export csv -o assets-$(date +%F).csv
+... export the asset inventory with one column per vulnerability severity
+
+2. knoxctl api asset diff assets-2024-10-07.csv assets-2024-10-14.csv
+... show the assets added and removed and the vulnerability count changes between two exports
+
+Exports in csv, json and xlsx format can be compared, also with each other.
+`
+
+// VulnChange is the change of the vulnerability counts of an asset
+type VulnChange struct {
+	Asset Record         `json:"asset"`
+	Delta map[string]int `json:"delta"`
+}
+
+// Diff lists the differences between two exports
+type Diff struct {
+	Added   []Record     `json:"added"`
+	Removed []Record     `json:"removed"`
+	Changed []VulnChange `json:"changed"`
+}
+
+// DiffRecords compares two exports, assets are matched by ID
+func DiffRecords(old, current []Record) Diff {
+	before := make(map[string]Record, len(old))
+	for _, r := range old {
+		before[r.key()] = r
+	}
+
+	diff := Diff{Added: []Record{}, Removed: []Record{}, Changed: []VulnChange{}}
+	seen := make(map[string]bool, len(current))
+	for _, r := range current {
+		seen[r.key()] = true
+		prev, ok := before[r.key()]
+		if !ok {
+			diff.Added = append(diff.Added, r)
+			continue
+		}
+		delta := make(map[string]int)
+		for _, s := range Severities {
+			if d := r.Vulnerabilities[s] - prev.Vulnerabilities[s]; d != 0 {
+				delta[s] = d
+			}
+		}
+		if len(delta) > 0 {
+			diff.Changed = append(diff.Changed, VulnChange{Asset: r, Delta: delta})
+		}
+	}
+	for _, r := range old {
+		if !seen[r.key()] {
+			diff.Removed = append(diff.Removed, r)
+		}
+	}
+
+	byKey := func(records []Record) {
+		sort.Slice(records, func(i, j int) bool { return records[i].key() < records[j].key() })
+	}
+	byKey(diff.Added)
+	byKey(diff.Removed)
+	sort.Slice(diff.Changed, func(i, j int) bool { return diff.Changed[i].Asset.key() < diff.Changed[j].Asset.key() })
+	return diff
+}
+
+// DiffExports compares two export files and prints the differences
+func DiffExports(w io.Writer, oldPath, newPath string, jsonFormat bool) error {
+	old, err := ReadExport(oldPath)
+	if err != nil {
+		return err
+	}
+	current, err := ReadExport(newPath)
+	if err != nil {
+		return err
+	}
+	diff := DiffRecords(old, current)
+
+	if jsonFormat {
+		data, err := json.Marshal(diff)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, string(data))
+		return nil
+	}
+	printDiff(w, diff)
+	return nil
+}
+
+func printDiff(w io.Writer, diff Diff) {
+	fmt.Fprintf(w, "%d added, %d removed, %d with vulnerability changes\n", len(diff.Added), len(diff.Removed), len(diff.Changed))
+
+	for _, section := range []struct {
+		title   string
+		records []Record
+	}{{"Added", diff.Added}, {"Removed", diff.Removed}} {
+		if len(section.records) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "\n%s assets:\n", section.title)
+		table := tablewriter.NewWriter(w)
+		table.SetHeader(recordHeader())
+		for _, r := range section.records {
+			table.Append(r.row())
+		}
+		table.Render()
+	}
+
+	if len(diff.Changed) > 0 {
+		fmt.Fprintln(w, "\nVulnerability changes:")
+		table := tablewriter.NewWriter(w)
+		table.SetHeader(append([]string{"ID", "Name", "Category"}, Severities...))
+		for _, c := range diff.Changed {
+			row := []string{c.Asset.ID, c.Asset.Name, c.Asset.Category}
+			for _, s := range Severities {
+				row = append(row, formatDelta(c.Asset.Vulnerabilities[s], c.Delta[s]))
+			}
+			table.Append(row)
+		}
+		table.Render()
+	}
+}
+
+// formatDelta formats a count with its change, e.g. "5 (+2)"
+func formatDelta(count, delta int) string {
+	if delta == 0 {
+		return strconv.Itoa(count)
+	}
+	return fmt.Sprintf("%d (%+d)", count, delta)
+}
@@ -0,0 +1,285 @@
+package asset
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Export formats
+const (
+	ExportCSV  = "csv"
+	ExportJSON = "json"
+	ExportXLSX = "xlsx"
+)
+
+var ExportFormats = []string{ExportCSV, ExportJSON, ExportXLSX}
+
+// Severities are the vulnerability severities exported as columns
+var Severities = []string{"Critical", "High", "Medium", "Low", "Unknown"}
+
+// Record is an asset flattened for export
+type Record struct {
+	ID              string         `json:"id"`
+	Name            string         `json:"name"`
+	Category        string         `json:"category"`
+	Region          string         `json:"region"`
+	Vulnerabilities map[string]int `json:"vulnerabilities"`
+	Labels          string         `json:"labels"`
+}
+
+// key identifies an asset across exports
+func (r Record) key() string {
+	if r.ID != "" {
+		return r.ID
+	}
+	return r.Category + "/" + r.Name
+}
+
+func recordHeader() []string {
+	header := []string{"ID", "Name", "Category", "Region"}
+	header = append(header, Severities...)
+	return append(header, "Labels")
+}
+
+func (r Record) row() []string {
+	row := []string{r.ID, r.Name, r.Category, r.Region}
+	for _, s := range Severities {
+		row = append(row, strconv.Itoa(r.Vulnerabilities[s]))
+	}
+	return append(row, r.Labels)
+}
+
+// FlattenAsset returns the export record of an asset from the API
+func FlattenAsset(raw map[string]interface{}) Record {
+	r := Record{
+		ID:              firstString(raw, "id", "asset_id"),
+		Name:            firstString(raw, "name", "asset_name"),
+		Category:        firstString(raw, "asset_category", "category"),
+		Region:          firstString(raw, "region", "location", "cloud_region"),
+		Vulnerabilities: make(map[string]int),
+		Labels:          flattenLabels(raw["labels"]),
+	}
+
+	if vulns, ok := raw["vulnerabilities"].(map[string]interface{}); ok {
+		for key, value := range vulns {
+			count, ok := value.(float64)
+			if !ok {
+				continue
+			}
+			severity := "Unknown"
+			for _, s := range Severities {
+				if strings.EqualFold(key, s) {
+					severity = s
+				}
+			}
+			r.Vulnerabilities[severity] += int(count)
+		}
+	}
+	return r
+}
+
+func firstString(raw map[string]interface{}, keys ...string) string {
+	for _, key := range keys {
+		switch v := raw[key].(type) {
+		case string:
+			if v != "" {
+				return v
+			}
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64)
+		}
+	}
+	return ""
+}
+
+// flattenLabels joins labels given as strings, name/value or key/value
+// objects, or a map into "k=v; k=v"
+func flattenLabels(labels interface{}) string {
+	var out []string
+	switch v := labels.(type) {
+	case []interface{}:
+		for _, item := range v {
+			switch label := item.(type) {
+			case string:
+				out = append(out, label)
+			case map[string]interface{}:
+				name := firstString(label, "name", "key")
+				if value := firstString(label, "value"); value != "" {
+					name += "=" + value
+				}
+				out = append(out, name)
+			}
+		}
+	case map[string]interface{}:
+		for key, value := range v {
+			out = append(out, fmt.Sprintf("%s=%v", key, value))
+		}
+		sort.Strings(out)
+	case string:
+		return v
+	}
+	return strings.Join(out, "; ")
+}
+
+// Export writes the assets in the given format to path, or to stdout if the
+// path is empty
+func Export(results []interface{}, format, path string) error {
+	var records []Record
+	for _, result := range results {
+		if raw, ok := result.(map[string]interface{}); ok {
+			records = append(records, FlattenAsset(raw))
+		}
+	}
+
+	var w io.Writer = os.Stdout
+	if path != "" {
+		if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+			return fmt.Errorf("error creating export directory: %v", err)
+		}
+		f, err := os.Create(filepath.Clean(path))
+		if err != nil {
+			return fmt.Errorf("error creating export file: %v", err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	if err := writeRecords(w, records, format); err != nil {
+		return err
+	}
+	if path != "" {
+		fmt.Fprintf(os.Stderr, "Exported %d assets to %s\n", len(records), path)
+	}
+	return nil
+}
+
+func writeRecords(w io.Writer, records []Record, format string) error {
+	switch format {
+	case ExportCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(recordHeader()); err != nil {
+			return err
+		}
+		for _, r := range records {
+			if err := cw.Write(r.row()); err != nil {
+				return err
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+	case ExportJSON:
+		if records == nil {
+			records = []Record{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(records)
+	case ExportXLSX:
+		rows := [][]string{recordHeader()}
+		for _, r := range records {
+			rows = append(rows, r.row())
+		}
+		return writeXLSX(w, "Assets", rows)
+	}
+	return fmt.Errorf("invalid export format %q, must be one of %s", format, strings.Join(ExportFormats, ", "))
+}
+
+// ReadExport reads an export, the format is taken from the file extension
+func ReadExport(path string) ([]Record, error) {
+	format := strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, fmt.Errorf("error reading export: %v", err)
+	}
+
+	var rows [][]string
+	switch format {
+	case ExportJSON:
+		var records []Record
+		if err := json.Unmarshal(data, &records); err != nil {
+			return nil, fmt.Errorf("invalid export %s: %v", path, err)
+		}
+		return records, nil
+	case ExportCSV:
+		rows, err = csv.NewReader(strings.NewReader(string(data))).ReadAll()
+	case ExportXLSX:
+		rows, err = readXLSX(data)
+	default:
+		return nil, fmt.Errorf("unknown export format of %s, must be one of %s", path, strings.Join(ExportFormats, ", "))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid export %s: %v", path, err)
+	}
+	return recordsFromRows(rows)
+}
+
+// recordsFromRows parses the rows of a CSV or XLSX export, columns are
+// matched by header name so that reordered spreadsheets still work
+func recordsFromRows(rows [][]string) ([]Record, error) {
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	columns := make(map[string]int)
+	for i, name := range rows[0] {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["id"]; !ok {
+		return nil, fmt.Errorf("missing ID column")
+	}
+	cell := func(row []string, name string) string {
+		i, ok := columns[strings.ToLower(name)]
+		if !ok || i >= len(row) {
+			return ""
+		}
+		return row[i]
+	}
+
+	var records []Record
+	for _, row := range rows[1:] {
+		r := Record{
+			ID:              cell(row, "ID"),
+			Name:            cell(row, "Name"),
+			Category:        cell(row, "Category"),
+			Region:          cell(row, "Region"),
+			Labels:          cell(row, "Labels"),
+			Vulnerabilities: make(map[string]int),
+		}
+		for _, s := range Severities {
+			if v := cell(row, s); v != "" {
+				n, err := strconv.Atoi(v)
+				if err != nil {
+					return nil, fmt.Errorf("invalid %s count %q of asset %s", s, v, r.key())
+				}
+				r.Vulnerabilities[s] = n
+			}
+		}
+		records = append(records, r)
+	}
+	return records, nil
+}
+
+// ValidateExport checks the export flags
+func ValidateExport(format, path string) error {
+	if format == "" {
+		if path != "" {
+			return fmt.Errorf("--output requires --export")
+		}
+		return nil
+	}
+	for _, f := range ExportFormats {
+		if f == format {
+			if format == ExportXLSX && path == "" {
+				return fmt.Errorf("--output is required for xlsx exports")
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid export format %q, must be one of %s", format, strings.Join(ExportFormats, ", "))
+}
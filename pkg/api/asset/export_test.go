@@ -0,0 +1,148 @@
+package asset
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/accuknox/accuknox-cli-v2/pkg/api/client"
+)
+
+func testAssets() []interface{} {
+	return []interface{}{
+		map[string]interface{}{
+			"id": float64(1), "name": "web", "asset_category": "Container", "region": "us-east-1",
+			"vulnerabilities": map[string]interface{}{"Critical": float64(2), "high": float64(1), "Negligible": float64(4)},
+			"labels":          []interface{}{map[string]interface{}{"name": "env", "value": "prod"}, "pci"},
+		},
+		map[string]interface{}{
+			"id": "bucket-7", "name": "logs, 2024", "asset_category": "Storage",
+			"labels": map[string]interface{}{"team": "sec", "app": "logs"},
+		},
+	}
+}
+
+func TestFlattenAsset(t *testing.T) {
+	r := FlattenAsset(testAssets()[0].(map[string]interface{}))
+	want := Record{
+		ID: "1", Name: "web", Category: "Container", Region: "us-east-1",
+		Vulnerabilities: map[string]int{"Critical": 2, "High": 1, "Unknown": 4},
+		Labels:          "env=prod; pci",
+	}
+	if !reflect.DeepEqual(r, want) {
+		t.Errorf("FlattenAsset() = %+v, want %+v", r, want)
+	}
+	if labels := FlattenAsset(testAssets()[1].(map[string]interface{})).Labels; labels != "app=logs; team=sec" {
+		t.Errorf("labels = %q", labels)
+	}
+}
+
+func TestExportRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	var want []Record
+	for _, a := range testAssets() {
+		want = append(want, FlattenAsset(a.(map[string]interface{})))
+	}
+
+	for _, format := range ExportFormats {
+		t.Run(format, func(t *testing.T) {
+			path := filepath.Join(dir, "assets."+format)
+			if err := Export(testAssets(), format, path); err != nil {
+				t.Fatalf("Export() error = %v", err)
+			}
+			got, err := ReadExport(path)
+			if err != nil {
+				t.Fatalf("ReadExport() error = %v", err)
+			}
+			for i := range got {
+				// zero counts are only explicit in csv and xlsx exports
+				for s, n := range got[i].Vulnerabilities {
+					if n == 0 {
+						delete(got[i].Vulnerabilities, s)
+					}
+				}
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("ReadExport() = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestDiffExports(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	old := write("old.csv", "ID,Name,Category,Critical,High\n1,web,Container,2,1\n2,db,Container,0,0\n3,logs,Storage,0,0\n")
+	// columns may be reordered by a spreadsheet application
+	current := write("new.csv", "Name,ID,High,Critical,Category\nweb,1,1,5,Container\ndb,2,0,0,Container\ncache,4,3,0,Container\n")
+
+	diff := DiffRecords(mustRead(t, old), mustRead(t, current))
+	if len(diff.Added) != 1 || diff.Added[0].ID != "4" {
+		t.Errorf("added = %+v", diff.Added)
+	}
+	if len(diff.Removed) != 1 || diff.Removed[0].ID != "3" {
+		t.Errorf("removed = %+v", diff.Removed)
+	}
+	if len(diff.Changed) != 1 || !reflect.DeepEqual(diff.Changed[0].Delta, map[string]int{"Critical": 3}) {
+		t.Errorf("changed = %+v", diff.Changed)
+	}
+
+	var out strings.Builder
+	if err := DiffExports(&out, old, current, false); err != nil {
+		t.Fatalf("DiffExports() error = %v", err)
+	}
+	for _, want := range []string{"1 added, 1 removed, 1 with vulnerability changes", "5 (+3)", "cache"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output is missing %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func mustRead(t *testing.T, path string) []Record {
+	t.Helper()
+	records, err := ReadExport(path)
+	if err != nil {
+		t.Fatalf("ReadExport(%s) error = %v", path, err)
+	}
+	return records
+}
+
+func TestListAssetsTimeoutExport(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("page") != "1" {
+			// later pages are slower than the timeout
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+			return
+		}
+		fmt.Fprint(w, `{"results":[{"id":1,"name":"web"}]}`)
+	}))
+	defer srv.Close()
+
+	c := client.New(srv.URL, srv.URL, "token", "1", client.WithRetries(0, 0))
+	path := filepath.Join(t.TempDir(), "assets.csv")
+	o := Options{AssetJQ: ".results[]", PageSize: 1, Timeout: 1, Export: "csv", Output: path}
+
+	err := ListAssets(context.Background(), c, o)
+	if err == nil || !strings.Contains(err.Error(), "timed out after fetching 1 assets") {
+		t.Errorf("ListAssets() error = %v, want a time out", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("incomplete export was written: %v", err)
+	}
+}
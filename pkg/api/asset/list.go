@@ -1,16 +1,17 @@
 package asset
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
-	"net/http"
 	"os"
 	"os/exec"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/accuknox/accuknox-cli-v2/pkg/config"
+	"github.com/accuknox/accuknox-cli-v2/pkg/api/client"
 	"github.com/accuknox/accuknox-cli-v2/pkg/logger"
 	"github.com/itchyny/gojq"
 )
@@ -42,21 +43,29 @@ type Options struct {
 	Timeout    int
 	JsonFormat bool
 	NoPager    bool
+	Export     string
+	Output     string
 }
 
-func ListAssets(o Options) {
+// ListAssets lists the assets page by page until there are no more assets,
+// the requested number of pages was fetched or the timeout expired. The
+// assets fetched before the timeout are printed, but never exported.
+func ListAssets(ctx context.Context, c *client.Client, o Options) error {
 	var allResults []interface{}
+	timedOut := false
 	cursorCount := 0
 	stime := time.Now()
 	otime := stime.Add(time.Duration(o.Timeout) * time.Second)
-	apiURL := config.Cfg.CSPM_URL + "/api/v1/assets"
 	currentPage := 1
 	hasMore := true
 	cursor := [4]string{"|", "/", "—", "\\"}
 
 	done := make(chan bool)
+	stopSpinner := func() {}
 
-	if !o.JsonFormat {
+	// exports written to stdout must not be mixed with progress output
+	quiet := o.JsonFormat || (o.Export != "" && o.Output == "")
+	if !quiet {
 		go func() {
 			for {
 				select {
@@ -69,49 +78,31 @@ func ListAssets(o Options) {
 				}
 			}
 		}()
+		stopSpinner = sync.OnceFunc(func() { close(done) })
+		defer stopSpinner()
 	}
 
-	for hasMore {
-		query := fmt.Sprintf("?page=%d&page_size=%d", currentPage, o.PageSize)
-		if o.Filter != "" {
-			query += "&" + strings.TrimSpace(o.Filter)
-		}
-
-		req, err := http.NewRequest("GET", apiURL+query, nil)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error creating HTTP request: %v\n", err)
-			return
-		}
-		req.Header.Set("Authorization", "Bearer "+config.Cfg.TOKEN)
-		req.Header.Set("Content-Type", "application/json")
-		req.Header.Set("X-Tenant-ID", config.Cfg.TENANT_ID)
-
-		client := &http.Client{}
-		resp, err := client.Do(req)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error making API call: %v\n", err)
-			return
-		}
-		defer resp.Body.Close()
+	ctx, cancel := context.WithDeadline(ctx, otime)
+	defer cancel()
 
-		body, err := io.ReadAll(resp.Body)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error reading response body: %v\n", err)
-			return
+	for hasMore {
+		resp, err := c.ListAssets(ctx, client.AssetsQuery{
+			Page:     currentPage,
+			PageSize: o.PageSize,
+			Filter:   o.Filter,
+		})
+		if errors.Is(err, context.DeadlineExceeded) {
+			timedOut = true
+			break
 		}
-
-		var jsonResponse map[string]interface{}
-		err = json.Unmarshal(body, &jsonResponse)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error unmarshalling JSON: %v\n", err)
-			logger.Error("api responce: %v\n", string(body))
-			return
+			return err
 		}
 
 		// jq filtering
-		results, err := ApplyJQFilter(jsonResponse, o.AssetJQ)
+		results, err := ApplyJQFilter(resp.Raw, o.AssetJQ)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error applying jq filter: %v\n", err)
+			return fmt.Errorf("error applying jq filter: %v", err)
 		}
 
 		allResults = append(allResults, results...)
@@ -121,20 +112,26 @@ func ListAssets(o Options) {
 		if o.Page != 0 && currentPage > o.Page {
 			break
 		}
-		if !otime.After(time.Now()) {
-			if !o.JsonFormat {
-				fmt.Printf("\rRequest cancelled due to Time-Out!\n")
-			}
+		if hasMore && !otime.After(time.Now()) {
+			timedOut = true
 			break
 		}
 	}
-	if !o.JsonFormat {
-		done <- true
+	stopSpinner()
+	if timedOut {
+		if o.Export != "" {
+			return fmt.Errorf("timed out after fetching %d assets, increase --timeout to export all of them", len(allResults))
+		}
+		fmt.Fprintf(os.Stderr, "\rRequest cancelled due to Time-Out, the %d assets fetched so far are listed\n", len(allResults))
 	}
-	if !o.JsonFormat {
+	if !quiet {
 		logger.Print("\nTotal assets found: %v", len(allResults))
 	}
+	if o.Export != "" {
+		return Export(allResults, o.Export, o.Output)
+	}
 	PrintJSON(allResults, o.NoPager, o.JsonFormat)
+	return nil
 }
 
 func ApplyJQFilter(data interface{}, jqFilter string) ([]interface{}, error) {
@@ -0,0 +1,196 @@
+package asset
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// writeXLSX writes a single-sheet workbook. Numbers are written as numeric
+// cells, everything else as inline strings, so no shared string table is
+// needed.
+func writeXLSX(w io.Writer, sheet string, rows [][]string) error {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+
+	var data strings.Builder
+	data.WriteString(xml.Header)
+	data.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	for i, row := range rows {
+		fmt.Fprintf(&data, `<row r="%d">`, i+1)
+		for j, value := range row {
+			ref := columnName(j) + strconv.Itoa(i+1)
+			if n, err := strconv.Atoi(value); err == nil && i > 0 && strconv.Itoa(n) == value {
+				fmt.Fprintf(&data, `<c r="%s"><v>%s</v></c>`, ref, value)
+				continue
+			}
+			fmt.Fprintf(&data, `<c r="%s" t="inlineStr"><is><t>%s</t></is></c>`, ref, xmlEscape(value))
+		}
+		data.WriteString(`</row>`)
+	}
+	data.WriteString(`</sheetData></worksheet>`)
+
+	files := []struct{ name, content string }{
+		{"[Content_Types].xml", xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+			`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+			`<Default Extension="xml" ContentType="application/xml"/>` +
+			`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+			`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+			`</Types>`},
+		{"_rels/.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+			`</Relationships>`},
+		{"xl/workbook.xml", xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<sheets><sheet name="` + xmlEscape(sheet) + `" sheetId="1" r:id="rId1"/></sheets></workbook>`},
+		{"xl/_rels/workbook.xml.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+			`</Relationships>`},
+		{"xl/worksheets/sheet1.xml", data.String()},
+	}
+	for _, f := range files {
+		fw, err := zw.Create(f.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(fw, f.content); err != nil {
+			return err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// columnName returns the spreadsheet name of the i-th column, A, B, ..., AA
+func columnName(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
+
+// columnIndex is the inverse of columnName for a cell reference like "AB12"
+func columnIndex(ref string) int {
+	i := 0
+	for _, r := range ref {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		i = i*26 + int(r-'A'+1)
+	}
+	return i - 1
+}
+
+func xmlEscape(s string) string {
+	var buf bytes.Buffer
+	_ = xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
+
+type xlsxText struct {
+	T    string `xml:"t"`
+	Runs []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t xlsxText) String() string {
+	if len(t.Runs) == 0 {
+		return t.T
+	}
+	var s strings.Builder
+	for _, r := range t.Runs {
+		s.WriteString(r.T)
+	}
+	return s.String()
+}
+
+// readXLSX reads the rows of the first sheet of a workbook, with inline or
+// shared strings, so that exports saved again by a spreadsheet application
+// can be read
+func readXLSX(data []byte) ([][]string, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	read := func(name string) ([]byte, error) {
+		for _, f := range zr.File {
+			if f.Name == name {
+				rc, err := f.Open()
+				if err != nil {
+					return nil, err
+				}
+				defer rc.Close()
+				return io.ReadAll(io.LimitReader(rc, 512<<20))
+			}
+		}
+		return nil, nil
+	}
+
+	var shared struct {
+		Items []xlsxText `xml:"si"`
+	}
+	if content, err := read("xl/sharedStrings.xml"); err != nil {
+		return nil, err
+	} else if content != nil {
+		if err := xml.Unmarshal(content, &shared); err != nil {
+			return nil, fmt.Errorf("invalid shared strings: %v", err)
+		}
+	}
+
+	content, err := read("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	if content == nil {
+		return nil, fmt.Errorf("workbook has no sheet")
+	}
+	var sheet struct {
+		Rows []struct {
+			Cells []struct {
+				Ref    string   `xml:"r,attr"`
+				Type   string   `xml:"t,attr"`
+				Value  string   `xml:"v"`
+				Inline xlsxText `xml:"is"`
+			} `xml:"c"`
+		} `xml:"sheetData>row"`
+	}
+	if err := xml.Unmarshal(content, &sheet); err != nil {
+		return nil, fmt.Errorf("invalid sheet: %v", err)
+	}
+
+	var rows [][]string
+	for _, r := range sheet.Rows {
+		var row []string
+		for j, c := range r.Cells {
+			col := j
+			if c.Ref != "" {
+				col = columnIndex(c.Ref)
+			}
+			for len(row) <= col {
+				row = append(row, "")
+			}
+			switch c.Type {
+			case "inlineStr":
+				row[col] = c.Inline.String()
+			case "s":
+				i, err := strconv.Atoi(c.Value)
+				if err != nil || i < 0 || i >= len(shared.Items) {
+					return nil, fmt.Errorf("invalid shared string %q in cell %s", c.Value, c.Ref)
+				}
+				row[col] = shared.Items[i].String()
+			default:
+				row[col] = c.Value
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
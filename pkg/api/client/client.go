@@ -0,0 +1,326 @@
+// Package client is a typed client for the AccuKnox SaaS API, it takes care
+// of authentication, timeouts and retrying read requests which were rate
+// limited or failed with a server error
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/accuknox/accuknox-cli-v2/pkg/config"
+)
+
+const (
+	DefaultTimeout    = 30 * time.Second
+	DefaultMaxRetries = 3
+	DefaultBackoff    = 500 * time.Millisecond
+	DefaultMaxBackoff = 10 * time.Second
+)
+
+// Client for the AccuKnox SaaS API. It is safe for concurrent use.
+type Client struct {
+	cwppURL  string
+	cspmURL  string
+	token    string
+	tenantID string
+
+	httpClient *http.Client
+	maxRetries int
+	backoff    time.Duration
+	maxBackoff time.Duration
+	sleep      func(context.Context, time.Duration) error
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithHTTPClient sets the http.Client used to send requests. The client is
+// copied, so the other options never change the one passed in.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		copied := *hc
+		c.httpClient = &copied
+	}
+}
+
+// WithTransport sets the transport used to send requests, e.g. to add
+// proxies, custom TLS configuration or to record requests in tests
+func WithTransport(rt http.RoundTripper) Option {
+	return func(c *Client) {
+		copied := *c.httpClient
+		copied.Transport = rt
+		c.httpClient = &copied
+	}
+}
+
+// WithTimeout sets the timeout of a single request attempt
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		copied := *c.httpClient
+		copied.Timeout = timeout
+		c.httpClient = &copied
+	}
+}
+
+// WithRetries sets how many times a failed request is retried and the
+// initial backoff, which is doubled after every attempt
+func WithRetries(maxRetries int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.maxRetries = maxRetries
+		c.backoff = backoff
+	}
+}
+
+// WithMaxBackoff caps the time waited between two attempts
+func WithMaxBackoff(maxBackoff time.Duration) Option {
+	return func(c *Client) {
+		c.maxBackoff = maxBackoff
+	}
+}
+
+// New returns a client for the given CWPP and CSPM endpoints
+func New(cwppURL, cspmURL, token, tenantID string, opts ...Option) *Client {
+	c := &Client{
+		cwppURL:    cwppURL,
+		cspmURL:    cspmURL,
+		token:      token,
+		tenantID:   tenantID,
+		httpClient: &http.Client{Timeout: DefaultTimeout},
+		maxRetries: DefaultMaxRetries,
+		backoff:    DefaultBackoff,
+		maxBackoff: DefaultMaxBackoff,
+		sleep:      sleep,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// NewFromConfig returns a client for the endpoints and credentials of the
+// loaded configuration
+func NewFromConfig(cfg config.AccuKnoxConfig, opts ...Option) *Client {
+	return New(cfg.CWPP_URL, cfg.CSPM_URL, cfg.TOKEN, cfg.TENANT_ID, opts...)
+}
+
+// TenantID returns the tenant (workspace) the client is authenticated for
+func (c *Client) TenantID() string {
+	return c.tenantID
+}
+
+// CWPPURL returns the base URL of the CWPP endpoints of the client
+func (c *Client) CWPPURL() string {
+	return c.cwppURL
+}
+
+// APIError is returned when the API responds with a non 2xx status code
+type APIError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s %s: unexpected status code %d: %s", e.Method, e.URL, e.StatusCode, e.Body)
+}
+
+// Temporary reports whether the request may succeed when retried
+func (e *APIError) Temporary() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= http.StatusInternalServerError
+}
+
+// rawHolder is implemented by responses which keep the complete decoded JSON
+// object next to the typed fields, it is used for jq filtering
+type rawHolder interface {
+	rawObject() *map[string]interface{}
+}
+
+// retriedMethods are the idempotent methods whose requests are retried. PUT
+// and DELETE are left out, updating a policy creates a new version every time
+// and a retried delete fails once the first attempt went through.
+var retriedMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodOptions: true,
+}
+
+// do sends the request and decodes the JSON response into out. Requests of
+// the idempotent methods are retried on 429, 5xx and transport errors, the
+// other ones are sent once.
+func (c *Client) do(ctx context.Context, method, url string, payload, out interface{}) error {
+	return c.request(ctx, method, url, payload, out, retriedMethods[method])
+}
+
+// query sends a POST request which only reads data, e.g. a search with
+// filters in the body, it is retried like the idempotent methods
+func (c *Client) query(ctx context.Context, url string, payload, out interface{}) error {
+	return c.request(ctx, http.MethodPost, url, payload, out, true)
+}
+
+func (c *Client) request(ctx context.Context, method, url string, payload, out interface{}, retry bool) error {
+	var body []byte
+	if payload != nil {
+		var err error
+		body, err = json.Marshal(payload)
+		if err != nil {
+			return fmt.Errorf("error preparing request payload: %v", err)
+		}
+	}
+
+	maxRetries := c.maxRetries
+	if !retry {
+		maxRetries = 0
+	}
+
+	var lastErr error
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		if attempt > 0 {
+			if err := c.sleep(ctx, c.retryDelay(attempt, lastErr)); err != nil {
+				return err
+			}
+		}
+
+		data, err := c.send(ctx, method, url, body)
+		if err == nil {
+			return decode(data, out)
+		}
+		lastErr = err
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && !apiErr.Temporary() {
+			return err
+		}
+	}
+
+	if maxRetries == 0 {
+		return lastErr
+	}
+	return fmt.Errorf("giving up after %d attempts: %w", maxRetries+1, lastErr)
+}
+
+func (c *Client) send(ctx context.Context, method, url string, body []byte) ([]byte, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return nil, fmt.Errorf("error creating HTTP request: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Tenant-ID", c.tenantID)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error making API call: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading response body: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, &retryAfterError{
+			APIError: &APIError{
+				Method:     method,
+				URL:        url,
+				StatusCode: resp.StatusCode,
+				Body:       truncate(string(data), 512),
+			},
+			after: parseRetryAfter(resp.Header.Get("Retry-After")),
+		}
+	}
+
+	return data, nil
+}
+
+func decode(data []byte, out interface{}) error {
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("error unmarshalling response: %v: %s", err, truncate(string(data), 512))
+	}
+	if holder, ok := out.(rawHolder); ok {
+		if err := json.Unmarshal(data, holder.rawObject()); err != nil {
+			return fmt.Errorf("error unmarshalling response: %v", err)
+		}
+	}
+	return nil
+}
+
+// retryAfterError wraps an APIError along with the delay requested by the
+// server through the Retry-After header
+type retryAfterError struct {
+	*APIError
+	after time.Duration
+}
+
+func (e *retryAfterError) Unwrap() error {
+	return e.APIError
+}
+
+// retryDelay returns the exponential backoff for the attempt, or the delay
+// requested by the server if it is longer
+func (c *Client) retryDelay(attempt int, err error) time.Duration {
+	delay := c.backoff << (attempt - 1)
+	if delay > c.maxBackoff || delay <= 0 {
+		delay = c.maxBackoff
+	}
+
+	var ra *retryAfterError
+	if errors.As(err, &ra) && ra.after > delay {
+		delay = ra.after
+		if delay > c.maxBackoff {
+			delay = c.maxBackoff
+		}
+	}
+	return delay
+}
+
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(value); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
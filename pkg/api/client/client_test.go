@@ -0,0 +1,196 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	c := New(srv.URL, srv.URL, "secret", "42", WithRetries(3, time.Millisecond))
+	c.sleep = func(ctx context.Context, d time.Duration) error { return ctx.Err() }
+	return c
+}
+
+func TestRetries(t *testing.T) {
+	tests := []struct {
+		name      string
+		statuses  []int
+		wantCalls int32
+		wantErr   bool
+		wantCode  int
+	}{
+		{name: "success", statuses: []int{200}, wantCalls: 1},
+		{name: "rate limited", statuses: []int{429, 429, 200}, wantCalls: 3},
+		{name: "server error", statuses: []int{503, 200}, wantCalls: 2},
+		{name: "client error is not retried", statuses: []int{401}, wantCalls: 1, wantErr: true, wantCode: 401},
+		{name: "gives up", statuses: []int{500, 500, 500, 500}, wantCalls: 4, wantErr: true, wantCode: 500},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int32
+			c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				n := atomic.AddInt32(&calls, 1)
+				w.WriteHeader(tt.statuses[n-1])
+				_, _ = w.Write([]byte(`[]`))
+			})
+
+			_, err := c.ListClusters(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ListClusters() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("got %d calls, want %d", calls, tt.wantCalls)
+			}
+			if tt.wantErr {
+				var apiErr *APIError
+				if !errors.As(err, &apiErr) || apiErr.StatusCode != tt.wantCode {
+					t.Errorf("expected an APIError with status %d, got %v", tt.wantCode, err)
+				}
+			}
+		})
+	}
+}
+
+func TestRetriesIdempotentOnly(t *testing.T) {
+	tests := []struct {
+		name      string
+		request   func(c *Client) error
+		wantCalls int32
+	}{
+		{
+			name:      "get",
+			request:   func(c *Client) error { return c.do(context.Background(), http.MethodGet, c.cwppURL, nil, nil) },
+			wantCalls: 4,
+		},
+		{
+			name: "query",
+			request: func(c *Client) error {
+				_, err := c.ListAlerts(context.Background(), AlertsRequest{})
+				return err
+			},
+			wantCalls: 4,
+		},
+		{
+			name:      "post",
+			request:   func(c *Client) error { return c.do(context.Background(), http.MethodPost, c.cwppURL, nil, nil) },
+			wantCalls: 1,
+		},
+		{
+			name:      "delete",
+			request:   func(c *Client) error { return c.do(context.Background(), http.MethodDelete, c.cwppURL, nil, nil) },
+			wantCalls: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int32
+			c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&calls, 1)
+				w.WriteHeader(http.StatusServiceUnavailable)
+			})
+
+			var apiErr *APIError
+			if err := tt.request(c); !errors.As(err, &apiErr) {
+				t.Fatalf("request error = %v, want an APIError", err)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("got %d calls, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestWithTransport(t *testing.T) {
+	hc := &http.Client{}
+	c := New("", "", "", "", WithHTTPClient(hc), WithTransport(http.DefaultTransport), WithTimeout(time.Second))
+
+	if hc.Transport != nil || hc.Timeout != 0 {
+		t.Errorf("options changed the http.Client passed in: %+v", hc)
+	}
+	if c.httpClient.Transport != http.DefaultTransport || c.httpClient.Timeout != time.Second {
+		t.Errorf("options not applied: %+v", c.httpClient)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	c := New("", "", "", "", WithRetries(5, 100*time.Millisecond), WithMaxBackoff(time.Second))
+
+	if d := c.retryDelay(1, nil); d != 100*time.Millisecond {
+		t.Errorf("first retry waits %v, want 100ms", d)
+	}
+	if d := c.retryDelay(3, nil); d != 400*time.Millisecond {
+		t.Errorf("third retry waits %v, want 400ms", d)
+	}
+	if d := c.retryDelay(10, nil); d != time.Second {
+		t.Errorf("backoff is not capped: %v", d)
+	}
+
+	err := &retryAfterError{APIError: &APIError{StatusCode: 429}, after: 700 * time.Millisecond}
+	if d := c.retryDelay(1, err); d != 700*time.Millisecond {
+		t.Errorf("Retry-After is not honoured: %v", d)
+	}
+}
+
+func TestRequest(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" || r.Header.Get("X-Tenant-ID") != "42" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Method != http.MethodPost || r.URL.Path != "/monitors/v1/alerts/events" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		var req AlertsRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.WorkspaceID != "42" || req.PageID != 2 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_, _ = w.Write([]byte(`{"response":[{"UID":"1","HostName":"store","Severity":5,"Extra":"kept"}]}`))
+	})
+
+	resp, err := c.ListAlerts(context.Background(), AlertsRequest{PageID: 2})
+	if err != nil {
+		t.Fatalf("ListAlerts() error = %v", err)
+	}
+	if len(resp.Response) != 1 {
+		t.Fatalf("got %d alerts, want 1", len(resp.Response))
+	}
+
+	alert := resp.Response[0]
+	if alert.HostName != "store" || alert.Severity != "5" {
+		t.Errorf("unexpected alert %+v", alert)
+	}
+	if alert.Raw["Extra"] != "kept" {
+		t.Errorf("raw alert is missing fields: %v", alert.Raw)
+	}
+	if _, ok := resp.Raw["response"]; !ok {
+		t.Errorf("raw response is missing: %v", resp.Raw)
+	}
+}
+
+func TestContextCancel(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := c.ListClusters(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("ListClusters() error = %v, want context.Canceled", err)
+	}
+}
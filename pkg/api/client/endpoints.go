@@ -0,0 +1,102 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ListClusters returns the clusters onboarded in the tenant
+func (c *Client) ListClusters(ctx context.Context) ([]Cluster, error) {
+	apiURL := fmt.Sprintf("%s/cluster-onboarding/api/v1/get-onboarded-clusters?wsid=%s", c.cwppURL, url.QueryEscape(c.tenantID))
+
+	var clusters []Cluster
+	if err := c.do(ctx, http.MethodGet, apiURL, nil, &clusters); err != nil {
+		return nil, fmt.Errorf("error fetching clusters: %w", err)
+	}
+	return clusters, nil
+}
+
+// ListNodes returns a page of the nodes of the requested clusters
+func (c *Client) ListNodes(ctx context.Context, req NodesRequest) (*NodesResponse, error) {
+	apiURL := fmt.Sprintf("%s/cm/api/v1/cluster-management/nodes-in-cluster", c.cwppURL)
+
+	if req.WorkspaceID == "" {
+		req.WorkspaceID = c.tenantID
+	}
+	if req.FromTime == nil {
+		req.FromTime = []int64{}
+	}
+	if req.ToTime == nil {
+		req.ToTime = []int64{}
+	}
+
+	resp := &NodesResponse{}
+	if err := c.query(ctx, apiURL, req, resp); err != nil {
+		return nil, fmt.Errorf("error fetching nodes: %w", err)
+	}
+	return resp, nil
+}
+
+// ListAlerts returns a page of alerts, the most recent first
+func (c *Client) ListAlerts(ctx context.Context, req AlertsRequest) (*AlertsResponse, error) {
+	apiURL := fmt.Sprintf("%s/monitors/v1/alerts/events?orderby=desc", c.cwppURL)
+
+	if req.WorkspaceID == "" {
+		req.WorkspaceID = c.tenantID
+	}
+	if req.Filters == nil {
+		req.Filters = []Filter{}
+	}
+	if req.ClusterID == nil {
+		req.ClusterID = []string{}
+	}
+
+	resp := &AlertsResponse{}
+	if err := c.query(ctx, apiURL, req, resp); err != nil {
+		return nil, fmt.Errorf("error fetching alerts: %w", err)
+	}
+	return resp, nil
+}
+
+// ListPolicies returns a page of the policies matching the request filter
+func (c *Client) ListPolicies(ctx context.Context, req PolicyListRequest) (*PolicyListResponse, error) {
+	apiURL := fmt.Sprintf("%s/policymanagement/v2/list-policy", c.cwppURL)
+
+	if req.WorkspaceID == "" {
+		req.WorkspaceID = c.tenantID
+	}
+
+	resp := &PolicyListResponse{}
+	if err := c.query(ctx, apiURL, req, resp); err != nil {
+		return nil, fmt.Errorf("error fetching policies: %w", err)
+	}
+	return resp, nil
+}
+
+// GetPolicy returns a single policy
+func (c *Client) GetPolicy(ctx context.Context, policyID string) (*PolicyDetail, error) {
+	apiURL := fmt.Sprintf("%s/policymanagement/v2/policy/%s", c.cwppURL, url.PathEscape(policyID))
+
+	resp := &PolicyDetail{}
+	if err := c.do(ctx, http.MethodGet, apiURL, nil, resp); err != nil {
+		return nil, fmt.Errorf("error fetching policy %s: %w", policyID, err)
+	}
+	return resp, nil
+}
+
+// ListAssets returns a page of the assets matching the query
+func (c *Client) ListAssets(ctx context.Context, query AssetsQuery) (*AssetsResponse, error) {
+	apiURL := fmt.Sprintf("%s/api/v1/assets?page=%d&page_size=%d", c.cspmURL, query.Page, query.PageSize)
+	if filter := strings.TrimSpace(query.Filter); filter != "" {
+		apiURL += "&" + filter
+	}
+
+	resp := &AssetsResponse{}
+	if err := c.do(ctx, http.MethodGet, apiURL, nil, resp); err != nil {
+		return nil, fmt.Errorf("error fetching assets: %w", err)
+	}
+	return resp, nil
+}
@@ -0,0 +1,129 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// policy management endpoints, relative to the CWPP URL
+const (
+	policyUploadPath  = "/policymanagement/v2/upload-policy"
+	policyStatusPath  = "/policymanagement/v2/update-policy-status"
+	policyPath        = "/policymanagement/v2/policy/%s"
+	policyHistoryPath = "/policymanagement/v2/policy/%s/history"
+)
+
+// Status of a policy
+const (
+	PolicyStatusActive   = "active"
+	PolicyStatusInactive = "inactive"
+)
+
+// PolicyUploadRequest is the payload to upload a policy to a cluster, or to
+// a namespace of a cluster
+type PolicyUploadRequest struct {
+	WorkspaceID string    `json:"workspace_id"`
+	ClusterID   []float64 `json:"cluster_id"`
+	Namespace   string    `json:"namespace,omitempty"`
+	YAML        string    `json:"yaml"`
+}
+
+// PolicyUploadResponse lists the policies created or updated by an upload
+type PolicyUploadResponse struct {
+	PolicyIDs []float64              `json:"policy_id"`
+	Message   string                 `json:"message"`
+	Raw       map[string]interface{} `json:"-"`
+}
+
+func (r *PolicyUploadResponse) rawObject() *map[string]interface{} { return &r.Raw }
+
+// PolicyStatusRequest is the payload to activate or deactivate policies
+type PolicyStatusRequest struct {
+	WorkspaceID string   `json:"workspace_id"`
+	PolicyIDs   []string `json:"policy_id"`
+	Status      string   `json:"status"`
+}
+
+// PolicyUpdateRequest is the payload to replace the YAML of a policy
+type PolicyUpdateRequest struct {
+	WorkspaceID string `json:"workspace_id"`
+	YAML        string `json:"yaml"`
+}
+
+// PolicyVersion is a version of a policy
+type PolicyVersion struct {
+	Version   int    `json:"version"`
+	UpdatedAt string `json:"updated_at"`
+	UpdatedBy string `json:"updated_by"`
+	Status    string `json:"status"`
+	Comment   string `json:"comment"`
+	YAML      string `json:"yaml"`
+}
+
+// PolicyHistory lists the versions of a policy, the latest first
+type PolicyHistory struct {
+	Versions []PolicyVersion        `json:"versions"`
+	Raw      map[string]interface{} `json:"-"`
+}
+
+func (r *PolicyHistory) rawObject() *map[string]interface{} { return &r.Raw }
+
+// UploadPolicy uploads a policy
+func (c *Client) UploadPolicy(ctx context.Context, req PolicyUploadRequest) (*PolicyUploadResponse, error) {
+	if req.WorkspaceID == "" {
+		req.WorkspaceID = c.tenantID
+	}
+
+	resp := &PolicyUploadResponse{}
+	if err := c.do(ctx, http.MethodPost, c.cwppURL+policyUploadPath, req, resp); err != nil {
+		return nil, fmt.Errorf("error uploading policy: %w", err)
+	}
+	return resp, nil
+}
+
+// SetPolicyStatus activates or deactivates policies
+func (c *Client) SetPolicyStatus(ctx context.Context, status string, policyIDs ...string) error {
+	if status != PolicyStatusActive && status != PolicyStatusInactive {
+		return fmt.Errorf("invalid policy status %q", status)
+	}
+
+	req := PolicyStatusRequest{WorkspaceID: c.tenantID, PolicyIDs: policyIDs, Status: status}
+	if err := c.do(ctx, http.MethodPost, c.cwppURL+policyStatusPath, req, nil); err != nil {
+		return fmt.Errorf("error updating policy status: %w", err)
+	}
+	return nil
+}
+
+// UpdatePolicy replaces the YAML of a policy, which creates a new version
+func (c *Client) UpdatePolicy(ctx context.Context, policyID, yaml string) error {
+	apiURL := c.cwppURL + fmt.Sprintf(policyPath, url.PathEscape(policyID))
+
+	req := PolicyUpdateRequest{WorkspaceID: c.tenantID, YAML: yaml}
+	if err := c.do(ctx, http.MethodPut, apiURL, req, nil); err != nil {
+		return fmt.Errorf("error updating policy %s: %w", policyID, err)
+	}
+	return nil
+}
+
+// DeletePolicy deletes a policy
+func (c *Client) DeletePolicy(ctx context.Context, policyID string) error {
+	apiURL := c.cwppURL + fmt.Sprintf(policyPath, url.PathEscape(policyID)) + "?workspace_id=" + url.QueryEscape(c.tenantID)
+
+	if err := c.do(ctx, http.MethodDelete, apiURL, nil, nil); err != nil {
+		return fmt.Errorf("error deleting policy %s: %w", policyID, err)
+	}
+	return nil
+}
+
+// GetPolicyHistory returns the versions of a policy
+func (c *Client) GetPolicyHistory(ctx context.Context, policyID string) (*PolicyHistory, error) {
+	apiURL := c.cwppURL + fmt.Sprintf(policyHistoryPath, url.PathEscape(policyID))
+
+	resp := &PolicyHistory{}
+	if err := c.do(ctx, http.MethodGet, apiURL, nil, resp); err != nil {
+		return nil, fmt.Errorf("error fetching history of policy %s: %w", policyID, err)
+	}
+	return resp, nil
+}
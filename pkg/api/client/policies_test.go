@@ -0,0 +1,52 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"testing"
+)
+
+func TestPolicyWritesNotRetried(t *testing.T) {
+	tests := []struct {
+		name    string
+		request func(c *Client) error
+	}{
+		{
+			name: "upload",
+			request: func(c *Client) error {
+				_, err := c.UploadPolicy(context.Background(), PolicyUploadRequest{YAML: "kind: KubeArmorPolicy"})
+				return err
+			},
+		},
+		{
+			name:    "status",
+			request: func(c *Client) error { return c.SetPolicyStatus(context.Background(), PolicyStatusActive, "1") },
+		},
+		{
+			name:    "update",
+			request: func(c *Client) error { return c.UpdatePolicy(context.Background(), "1", "kind: KubeArmorPolicy") },
+		},
+		{
+			name:    "delete",
+			request: func(c *Client) error { return c.DeletePolicy(context.Background(), "1") },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int32
+			c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&calls, 1)
+				w.WriteHeader(http.StatusBadGateway)
+			})
+
+			if err := tt.request(c); err == nil {
+				t.Fatalf("request succeeded, want an error")
+			}
+			if calls != 1 {
+				t.Errorf("got %d calls, want the request sent once", calls)
+			}
+		})
+	}
+}
@@ -0,0 +1,339 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// Items of the API responses only declare the fields knoxctl works with.
+// The complete object is kept in Raw, so that jq filters written against
+// the API responses keep working.
+
+// Cluster is an onboarded cluster or VM cluster
+type Cluster struct {
+	ID          float64                `json:"ID"`
+	ClusterName string                 `json:"ClusterName"`
+	Status      string                 `json:"Status"`
+	Type        string                 `json:"type"`
+	Raw         map[string]interface{} `json:"-"`
+}
+
+func (c *Cluster) UnmarshalJSON(data []byte) error {
+	raw, err := rawMap(data)
+	if err != nil {
+		return err
+	}
+	*c = Cluster{
+		ID:          number(raw, "ID"),
+		ClusterName: str(raw, "ClusterName"),
+		Status:      str(raw, "Status"),
+		Type:        str(raw, "type"),
+		Raw:         raw,
+	}
+	return nil
+}
+
+// NodesRequest is the payload to list the nodes of clusters
+type NodesRequest struct {
+	WorkspaceID  string    `json:"workspace_id"`
+	ClusterID    []float64 `json:"cluster_id"`
+	FromTime     []int64   `json:"from_time"`
+	ToTime       []int64   `json:"to_time"`
+	PagePrevious int       `json:"page_previous"`
+	PageNext     int       `json:"page_next"`
+}
+
+// NodesResponse is a page of nodes
+type NodesResponse struct {
+	TotalRecord float64                `json:"total_record"`
+	Result      []Node                 `json:"result"`
+	Raw         map[string]interface{} `json:"-"`
+}
+
+func (r *NodesResponse) rawObject() *map[string]interface{} { return &r.Raw }
+
+// Node of a cluster
+type Node struct {
+	ID        float64                `json:"ID"`
+	ClusterID float64                `json:"ClusterID"`
+	NodeName  string                 `json:"NodeName"`
+	Status    string                 `json:"Status"`
+	Raw       map[string]interface{} `json:"-"`
+}
+
+func (n *Node) UnmarshalJSON(data []byte) error {
+	raw, err := rawMap(data)
+	if err != nil {
+		return err
+	}
+	*n = Node{
+		ID:        number(raw, "ID"),
+		ClusterID: number(raw, "ClusterID"),
+		NodeName:  str(raw, "NodeName"),
+		Status:    str(raw, "Status"),
+		Raw:       raw,
+	}
+	return nil
+}
+
+// Filter on a field of the alerts
+type Filter struct {
+	Field string `json:"field"`
+	Value string `json:"value"`
+	Op    string `json:"op"`
+}
+
+// AlertsRequest is the payload to list alerts
+type AlertsRequest struct {
+	FromTime    int64    `json:"FromTime"`
+	ToTime      int64    `json:"ToTime"`
+	PageID      int      `json:"PageId"`
+	PageSize    int      `json:"PageSize"`
+	Filters     []Filter `json:"Filters"`
+	ClusterID   []string `json:"ClusterID"`
+	View        string   `json:"View"`
+	Type        string   `json:"Type"`
+	WorkspaceID string   `json:"WorkspaceID"`
+	LogType     string   `json:"LogType"`
+}
+
+// AlertsResponse is a page of alerts
+type AlertsResponse struct {
+	Response []Alert                `json:"response"`
+	Raw      map[string]interface{} `json:"-"`
+}
+
+func (r *AlertsResponse) rawObject() *map[string]interface{} { return &r.Raw }
+
+// Alert raised by KubeArmor, network policies, admission controllers etc.
+type Alert struct {
+	UID           string                 `json:"UID"`
+	Timestamp     int64                  `json:"Timestamp"`
+	UpdatedTime   string                 `json:"UpdatedTime"`
+	ClusterName   string                 `json:"ClusterName"`
+	HostName      string                 `json:"HostName"`
+	NamespaceName string                 `json:"NamespaceName"`
+	PodName       string                 `json:"PodName"`
+	PolicyName    string                 `json:"PolicyName"`
+	Severity      string                 `json:"Severity"`
+	Operation     string                 `json:"Operation"`
+	Resource      string                 `json:"Resource"`
+	Action        string                 `json:"Action"`
+	Result        string                 `json:"Result"`
+	Raw           map[string]interface{} `json:"-"`
+}
+
+func (a *Alert) UnmarshalJSON(data []byte) error {
+	raw, err := rawMap(data)
+	if err != nil {
+		return err
+	}
+	*a = Alert{
+		UID:           str(raw, "UID"),
+		Timestamp:     int64(number(raw, "Timestamp")),
+		UpdatedTime:   str(raw, "UpdatedTime"),
+		ClusterName:   str(raw, "ClusterName"),
+		HostName:      str(raw, "HostName"),
+		NamespaceName: str(raw, "NamespaceName"),
+		PodName:       str(raw, "PodName"),
+		PolicyName:    str(raw, "PolicyName"),
+		Severity:      str(raw, "Severity"),
+		Operation:     str(raw, "Operation"),
+		Resource:      str(raw, "Resource"),
+		Action:        str(raw, "Action"),
+		Result:        str(raw, "Result"),
+		Raw:           raw,
+	}
+	return nil
+}
+
+// MarshalJSON returns the alert as received from the API
+func (a Alert) MarshalJSON() ([]byte, error) {
+	if a.Raw != nil {
+		return json.Marshal(a.Raw)
+	}
+	type alert Alert
+	return json.Marshal(alert(a))
+}
+
+// RegexFilter matches a policy attribute against a regular expression
+type RegexFilter struct {
+	Regex *string `json:"regex"`
+}
+
+// PolicyFilter selects the policies to list, nil fields match everything
+type PolicyFilter struct {
+	ClusterID   []float64   `json:"cluster_id"`
+	NamespaceID interface{} `json:"namespace_id"`
+	WorkloadID  interface{} `json:"workload_id"`
+	Kind        interface{} `json:"kind"`
+	NodeID      interface{} `json:"node_id"`
+	PodID       interface{} `json:"pod_id"`
+	Type        interface{} `json:"type"`
+	Status      interface{} `json:"status"`
+	Tags        interface{} `json:"tags"`
+	Name        RegexFilter `json:"name"`
+	TLDR        RegexFilter `json:"tldr"`
+}
+
+// PolicyListRequest is the payload to list policies
+type PolicyListRequest struct {
+	WorkspaceID  string       `json:"workspace_id"`
+	Workload     string       `json:"workload"`
+	PagePrevious int          `json:"page_previous"`
+	PageNext     int          `json:"page_next"`
+	Filter       PolicyFilter `json:"filter"`
+}
+
+// PolicyListResponse is a page of policies
+type PolicyListResponse struct {
+	ListOfPolicies []PolicySummary        `json:"list_of_policies"`
+	Raw            map[string]interface{} `json:"-"`
+}
+
+func (r *PolicyListResponse) rawObject() *map[string]interface{} { return &r.Raw }
+
+// PolicySummary is a policy as listed by the policy management API
+type PolicySummary struct {
+	PolicyID    float64                `json:"policy_id"`
+	Name        string                 `json:"name"`
+	Namespace   string                 `json:"namespace_name"`
+	Category    string                 `json:"category"`
+	Status      string                 `json:"status"`
+	ClusterName string                 `json:"cluster_name"`
+	Labels      []string               `json:"-"`
+	Raw         map[string]interface{} `json:"-"`
+}
+
+func (p *PolicySummary) UnmarshalJSON(data []byte) error {
+	raw, err := rawMap(data)
+	if err != nil {
+		return err
+	}
+	*p = PolicySummary{
+		PolicyID:    number(raw, "policy_id"),
+		Name:        str(raw, "name"),
+		Namespace:   str(raw, "namespace_name"),
+		Category:    str(raw, "category"),
+		Status:      str(raw, "status"),
+		ClusterName: str(raw, "cluster_name"),
+		Labels:      policyLabels(raw),
+		Raw:         raw,
+	}
+	return nil
+}
+
+// PolicyFromRaw returns the policy summary of a policy object, e.g. one
+// returned by a jq filter
+func PolicyFromRaw(raw map[string]interface{}) PolicySummary {
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return PolicySummary{Raw: raw}
+	}
+	var p PolicySummary
+	if err := json.Unmarshal(data, &p); err != nil {
+		return PolicySummary{Raw: raw}
+	}
+	return p
+}
+
+func policyLabels(raw map[string]interface{}) []string {
+	var labels []string
+	rawLabels, ok := raw["labels"].([]interface{})
+	if !ok {
+		return nil
+	}
+	for _, item := range rawLabels {
+		labelMap, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, nameOk := labelMap["name"].(string)
+		value, valueOk := labelMap["value"].(string)
+		if nameOk && valueOk {
+			labels = append(labels, fmt.Sprintf("%s:%s", name, value))
+		}
+	}
+	return labels
+}
+
+// PolicyDetail is a single policy along with its YAML
+type PolicyDetail struct {
+	YAML string                 `json:"yaml"`
+	Raw  map[string]interface{} `json:"-"`
+}
+
+func (r *PolicyDetail) rawObject() *map[string]interface{} { return &r.Raw }
+
+// AssetsQuery selects the page of assets to list. Filter is passed to the
+// API as is, e.g. `asset_category=Container`.
+type AssetsQuery struct {
+	Page     int
+	PageSize int
+	Filter   string
+}
+
+// AssetsResponse is a page of assets
+type AssetsResponse struct {
+	Count   int                    `json:"count"`
+	Results []Asset                `json:"results"`
+	Raw     map[string]interface{} `json:"-"`
+}
+
+func (r *AssetsResponse) rawObject() *map[string]interface{} { return &r.Raw }
+
+// Asset is a cloud or cluster asset as listed by the CSPM API
+type Asset struct {
+	ID       string                 `json:"id"`
+	Name     string                 `json:"name"`
+	Category string                 `json:"asset_category"`
+	Raw      map[string]interface{} `json:"-"`
+}
+
+func (a *Asset) UnmarshalJSON(data []byte) error {
+	raw, err := rawMap(data)
+	if err != nil {
+		return err
+	}
+	*a = Asset{
+		ID:       str(raw, "id"),
+		Name:     str(raw, "name"),
+		Category: str(raw, "asset_category"),
+		Raw:      raw,
+	}
+	return nil
+}
+
+func rawMap(data []byte) (map[string]interface{}, error) {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	return raw, nil
+}
+
+// str returns the field as string, numbers are formatted as is
+func str(raw map[string]interface{}, key string) string {
+	switch v := raw[key].(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return ""
+}
+
+// number returns the field as number, numeric strings are parsed
+func number(raw map[string]interface{}, key string) float64 {
+	switch v := raw[key].(type) {
+	case float64:
+		return v
+	case string:
+		f, _ := strconv.ParseFloat(v, 64)
+		return f
+	}
+	return 0
+}
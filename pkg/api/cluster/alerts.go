@@ -1,17 +1,16 @@
 package cluster
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
-	"io"
-	"net/http"
 	"os"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/accuknox/accuknox-cli-v2/pkg/api/asset"
-	"github.com/accuknox/accuknox-cli-v2/pkg/config"
+	"github.com/accuknox/accuknox-cli-v2/pkg/api/client"
+	"github.com/accuknox/accuknox-cli-v2/pkg/api/sink"
 	"github.com/accuknox/accuknox-cli-v2/pkg/logger"
 )
 
@@ -22,6 +21,15 @@ const ClusterAlertDescription = `
 2. knoxctl api cluster alerts --filters '{"field":"HostName","value":"store54055","op":"match"}' --alertjq '.response[] | "hostname=\(.HostName),resource=\(.Resource//""),UID=\(.UID),operation=\(.Operation)"'
 ... get all alerts for HostName="store54055" and print the response in following csv format hostname,resource,UID,operation
 
+3. knoxctl api cluster alerts --follow --json --filters '{"field":"HostName","value":"store54055","op":"match"}'
+... keep polling for new alerts of HostName="store54055" and print every new alert as a JSON line. The last alert printed is recorded in --state-file, so a restarted follow resumes where it stopped.
+
+4. knoxctl api cluster alerts --since 24h --stats --group-by namespace,policy,severity --top 5
+... count the alerts of the last day per namespace, policy and severity, along with an hourly histogram
+
+5. knoxctl api cluster alerts --follow --sink syslog+tcp://siem.example.com:601 --sink https://hooks.slack.com/services/... --sink-template slack
+... forward every new alert to a syslog server and to a Slack channel
+
 NOTE: --filters are passed directly to the AccuKnox API. --alertjq operates on the output of the AccuKnox API response. It is recommended to use --filters as far as possible. However, you can use regex/jq based matching criteria with --alertjq.
 In alertjq flag ".response[]" is an array we get from AccuKnox API response and then further we can provide a condition(on top of the array we get), as shown in above example, this condition will be applied on every alert we get and will list only which statisfy it. If no further condition is applied, it will dump all the alerts.
 
@@ -45,158 +53,171 @@ type ClusterALertOptions struct {
 	CfgFile        string
 	LogType        string
 	Cluster_id     string
+	Follow         bool
+	PollInterval   time.Duration
+	StateFile      string
+	Sink           sink.Config
+	Query          string
+	FiltersOp      string
+	Stats          bool
+	StatsGroupBy   []string
+	StatsTop       int
 }
 
-var done = make(chan bool, 1)
-
-type FilterField struct {
-	Field string `json:"field"`
-	Value string `json:"value"`
-	Op    string `json:"op"`
-}
-
-func FetchClusterAlerts(options ClusterALertOptions) {
-	cursorCount := 0
-	cursor := [4]string{"|", "/", "—", "\\"}
+// FilterField is passed to the API to filter the alerts
+type FilterField = client.Filter
 
+func FetchClusterAlerts(ctx context.Context, c *client.Client, options ClusterALertOptions) error {
+	stopSpinner := func() {}
 	if !options.JsonFormat {
-		go func() {
-			for {
-				select {
-				case <-done:
-					return
-				default:
-					fmt.Fprintf(os.Stderr, "\rFetching Alerts: %s", cursor[cursorCount])
-					cursorCount = (cursorCount + 1) % len(cursor)
-					time.Sleep(100 * time.Millisecond)
-				}
-			}
-		}()
+		stopSpinner = startSpinner("Fetching Alerts")
+		defer stopSpinner()
+	}
+
+	clusterData, clusters, err := fetchClusters(ctx, c, options.ClusterAlertJQ)
+	if err != nil {
+		return err
 	}
-	clusters := fetchClustersList(config.Cfg.CWPP_URL)
-	clusterData, _ := jqFilter(clusters, options.ClusterAlertJQ)
 	if len(clusterData) == 0 {
 		fmt.Println("No clusters found matching the provided criteria.")
-		return
+		return nil
 	}
 
 	var clusterIDs []float64
-	for _, cluster := range clusterData {
-		bytes, err := json.Marshal(cluster)
+	for _, cluster := range clusters {
+		clusterIDs = append(clusterIDs, cluster.ID)
+	}
+
+	fwd, err := newForwarder(options)
+	if err != nil {
+		return err
+	}
+
+	results, err := queryClusterAlerts(ctx, c, clusterIDs, options)
+	if err != nil {
+		return err
+	}
+	stopSpinner()
+
+	if fwd != nil {
+		defer fwd.Close()
+		return forwardAlerts(ctx, fwd, results)
+	}
+
+	if options.Stats {
+		stats, err := computeAlertStats(results, options.StatsGroupBy, options.StatsTop)
 		if err != nil {
-			logger.Error("error while marshaling: %v", err)
-			return
+			return err
 		}
-
-		if err := json.Unmarshal(bytes, &ClusterInfo); err != nil {
-			logger.Error("error while unmarshaling: %v", err)
-			return
+		if options.JsonFormat {
+			return printAlertStatsJSON(os.Stdout, stats)
 		}
-		clusterIDs = append(clusterIDs, ClusterInfo.ID)
+		printAlertStats(os.Stdout, stats)
+		return nil
 	}
 
-	queryClusterAlerts(clusterIDs, options)
+	if !options.JsonFormat {
+		logger.Print("\nTotal alerts found: %v", len(results))
+	}
+	asset.PrintJSON(results, options.NoPager, options.JsonFormat)
+	return nil
 }
 
-func queryClusterAlerts(clusterIDs []float64, options ClusterALertOptions) {
-	var allResults []interface{}
-	clusterIDsS := []string{}
+func queryClusterAlerts(ctx context.Context, c *client.Client, clusterIDs []float64, options ClusterALertOptions) ([]interface{}, error) {
+	q, err := buildAlertQuery(options)
+	if err != nil {
+		return nil, err
+	}
 
-	apiURL := fmt.Sprintf("%s/monitors/v1/alerts/events?orderby=desc", config.Cfg.CWPP_URL)
+	alerts, err := fetchAlerts(ctx, c, options, q, options.StartTime, options.EndTime, options.Page)
+	if err != nil {
+		return nil, err
+	}
+	return filterAlerts(alerts, options.AlertJQ)
+}
 
+// fetchAlerts sends one request per filter list of the query, merges the
+// alerts and keeps the ones matching the query. maxPages limits the number
+// of pages fetched per request, 0 means all.
+func fetchAlerts(ctx context.Context, c *client.Client, options ClusterALertOptions, q *alertQuery, from, to int64, maxPages int) ([]client.Alert, error) {
+	clusterIDs := []string{}
 	if options.Cluster_id != "" {
-		clusterIDsS = strings.Split(options.Cluster_id, ",")
+		clusterIDs = strings.Split(options.Cluster_id, ",")
 	}
 
-	for pageID := 1; ; pageID++ {
-		if options.Page != 0 && pageID > options.Page {
-			if !options.JsonFormat {
-				done <- true
-			}
-			break
-		}
-
-		var filter FilterField
-		var filters []FilterField
-		if options.Filters != "" {
-			err := json.Unmarshal([]byte(options.Filters), &filter)
+	var alerts []client.Alert
+	seen := make(map[string]bool)
+	for _, filters := range q.requests {
+		for pageID := 1; maxPages == 0 || pageID <= maxPages; pageID++ {
+			resp, err := c.ListAlerts(ctx, client.AlertsRequest{
+				FromTime:  from,
+				ToTime:    to,
+				PageID:    pageID,
+				PageSize:  options.PageSize,
+				Filters:   filters,
+				ClusterID: clusterIDs,
+				View:      "List",
+				Type:      options.AlertType,
+				LogType:   options.LogType,
+			})
 			if err != nil {
-				fmt.Fprintf(os.Stderr, "Invalid filters format: %v\n", err)
-				return
+				return nil, err
 			}
-		}
-
-		filters = append(filters, filter)
-
-		requestPayload := map[string]interface{}{
-			"FromTime":    options.StartTime,
-			"ToTime":      options.EndTime,
-			"PageId":      pageID,
-			"PageSize":    options.PageSize,
-			"Filters":     filters,
-			"ClusterID":   clusterIDsS,
-			"View":        "List",
-			"Type":        options.AlertType,
-			"WorkspaceID": config.Cfg.TENANT_ID,
-			"LogType":     options.LogType,
-		}
 
-		if options.Filters == "" {
-			requestPayload["Filters"] = []interface{}{}
-		}
-
-		payloadBytes, err := json.Marshal(requestPayload)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error preparing request payload: %v\n", err)
-			return
-		}
-
-		req, err := http.NewRequest("POST", apiURL, bytes.NewBuffer(payloadBytes))
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error creating HTTP request: %v\n", err)
-			return
+			for _, alert := range resp.Response {
+				if len(q.requests) > 1 {
+					key := alertKey(alert)
+					if seen[key] {
+						continue
+					}
+					seen[key] = true
+				}
+				if q.match(alert) {
+					alerts = append(alerts, alert)
+				}
+			}
+			if len(resp.Response) == 0 || len(resp.Response) < options.PageSize {
+				break
+			}
 		}
-		req.Header.Set("Authorization", "Bearer "+config.Cfg.TOKEN)
-		req.Header.Set("Content-Type", "application/json")
-		req.Header.Set("X-Tenant-ID", config.Cfg.TENANT_ID)
+	}
 
-		client := &http.Client{}
-		resp, err := client.Do(req)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error fetching nodes: %v\n", err)
-			return
-		}
-		defer resp.Body.Close()
+	if len(q.requests) > 1 {
+		sort.SliceStable(alerts, func(i, j int) bool {
+			return alerts[i].Timestamp > alerts[j].Timestamp
+		})
+	}
+	return alerts, nil
+}
 
-		body, err := io.ReadAll(resp.Body)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error reading response: %v\n", err)
-			return
-		}
+// filterAlerts applies the jq filter on the alerts, as if they were the API
+// response
+func filterAlerts(alerts []client.Alert, alertJQ string) ([]interface{}, error) {
+	raw := make([]interface{}, 0, len(alerts))
+	for _, alert := range alerts {
+		raw = append(raw, alert.Raw)
+	}
+	results, err := jqFilter(map[string]interface{}{"response": raw}, alertJQ)
+	if err != nil {
+		return nil, fmt.Errorf("error while applying jq filter: %v", err)
+	}
+	return results, nil
+}
 
-		var jsonResponse interface{}
-		err = json.Unmarshal(body, &jsonResponse)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error unmarshalling JSON: %v\n", err)
-			logger.Error("api responce: %v\n", string(body))
-			return
-		}
-		jsonMap, ok := jsonResponse.(map[string]interface{})
-		if !ok || jsonMap["response"] == nil {
-			if !options.JsonFormat {
-				done <- true
-			}
-			break
-		}
-		results, err := jqFilter(jsonResponse, options.AlertJQ)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error while applying jq filter: %v\n", err)
-			return
-		}
-		allResults = append(allResults, results...)
+// newForwarder returns the forwarder for the configured sinks, if any
+func newForwarder(options ClusterALertOptions) (*sink.Forwarder, error) {
+	if len(options.Sink.Sinks) == 0 {
+		return nil, nil
 	}
-	if !options.JsonFormat {
-		logger.Print("\nTotal alerts found: %v", len(allResults))
+	return sink.New(options.Sink)
+}
+
+// forwardAlerts sends the alerts to the sinks instead of printing them
+func forwardAlerts(ctx context.Context, fwd *sink.Forwarder, results []interface{}) error {
+	failed, err := fwd.Forward(ctx, results)
+	if err != nil {
+		return err
 	}
-	asset.PrintJSON(allResults, options.NoPager, options.JsonFormat)
+	fmt.Fprintf(os.Stderr, "\rForwarded %d alerts, %d failed\n", len(results)-failed, failed)
+	return nil
 }
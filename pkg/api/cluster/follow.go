@@ -0,0 +1,263 @@
+package cluster
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/accuknox/accuknox-cli-v2/pkg/api/client"
+)
+
+const (
+	DefaultPollInterval = 10 * time.Second
+	maxPollBackoff      = 5 * time.Minute
+
+	// DefaultFollowStateFile is replaced by a state file per query, so that
+	// follow runs with different filters do not share their high-water mark
+	DefaultFollowStateFile = "$HOME/.accuknox-alerts.state"
+)
+
+// followState is the high-water mark of the alerts already printed. Alerts
+// are only compared by their timestamp, so the keys of the alerts seen at
+// the last timestamp are kept to not print them twice.
+type followState struct {
+	LastTimestamp int64    `json:"last_timestamp"`
+	Seen          []string `json:"seen,omitempty"`
+}
+
+func loadFollowState(path string) (*followState, error) {
+	st := &followState{}
+	if path == "" {
+		return st, nil
+	}
+
+	data, err := os.ReadFile(filepath.Clean(path))
+	if errors.Is(err, os.ErrNotExist) {
+		return st, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading state file: %v", err)
+	}
+	if err := json.Unmarshal(data, st); err != nil {
+		return nil, fmt.Errorf("error parsing state file %s: %v", path, err)
+	}
+	return st, nil
+}
+
+// save writes the state to a temporary file first, so that an interrupted
+// write does not corrupt the previous state
+func (st *followState) save(path string) error {
+	if path == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return fmt.Errorf("error creating state directory: %v", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("error writing state file: %v", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// advance returns the alerts newer than the high-water mark, oldest first,
+// and moves the mark past them
+func (st *followState) advance(alerts []client.Alert) []client.Alert {
+	seen := make(map[string]bool, len(st.Seen))
+	for _, key := range st.Seen {
+		seen[key] = true
+	}
+
+	var fresh []client.Alert
+	for _, alert := range alerts {
+		if alert.Timestamp < st.LastTimestamp {
+			continue
+		}
+		key := alertKey(alert)
+		if alert.Timestamp == st.LastTimestamp && seen[key] {
+			continue
+		}
+		seen[key] = true
+		fresh = append(fresh, alert)
+	}
+
+	sort.SliceStable(fresh, func(i, j int) bool {
+		return fresh[i].Timestamp < fresh[j].Timestamp
+	})
+
+	for _, alert := range fresh {
+		if alert.Timestamp > st.LastTimestamp {
+			st.LastTimestamp = alert.Timestamp
+			st.Seen = nil
+		}
+		st.Seen = append(st.Seen, alertKey(alert))
+	}
+	return fresh
+}
+
+// alertKey identifies an alert by its UID, or by its content if it has none
+func alertKey(alert client.Alert) string {
+	if alert.UID != "" {
+		return alert.UID
+	}
+	data, _ := json.Marshal(alert.Raw)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// followStateFile returns the state file of the follow run. The default one is
+// keyed by a hash of the tenant and endpoint of the client and of everything
+// selecting the alerts followed.
+func followStateFile(c *client.Client, options ClusterALertOptions) string {
+	if options.StateFile != DefaultFollowStateFile {
+		return os.ExpandEnv(options.StateFile)
+	}
+
+	data, _ := json.Marshal([]string{
+		c.CWPPURL(), c.TenantID(), options.Cluster_id, options.AlertType, options.LogType,
+		options.Filters, options.FiltersOp, options.Query, options.AlertJQ,
+	})
+	sum := sha256.Sum256(data)
+	return os.ExpandEnv(fmt.Sprintf("$HOME/.accuknox-alerts-%s.state", hex.EncodeToString(sum[:8])))
+}
+
+// FollowClusterAlerts polls the alerts endpoint until the context is
+// cancelled and prints or forwards every new alert once
+func FollowClusterAlerts(ctx context.Context, c *client.Client, options ClusterALertOptions) error {
+	return followClusterAlerts(ctx, c, options, os.Stdout)
+}
+
+func followClusterAlerts(ctx context.Context, c *client.Client, options ClusterALertOptions, out io.Writer) error {
+	q, err := buildAlertQuery(options)
+	if err != nil {
+		return err
+	}
+
+	stateFile := followStateFile(c, options)
+	st, err := loadFollowState(stateFile)
+	if err != nil {
+		return err
+	}
+	if st.LastTimestamp == 0 {
+		st.LastTimestamp = options.StartTime
+	}
+
+	interval := options.PollInterval
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+
+	fwd, err := newForwarder(options)
+	if err != nil {
+		return err
+	}
+	if fwd != nil {
+		defer fwd.Close()
+	} else if !options.JsonFormat {
+		printAlertHeader(out)
+	}
+
+	wait := interval
+	for {
+		// the alerts are returned the most recent first, every page is fetched
+		// as the high-water mark moves past the alerts of the pages left out
+		alerts, err := fetchAlerts(ctx, c, options, q, st.LastTimestamp, time.Now().Unix(), 0)
+		switch {
+		case ctx.Err() != nil:
+			return nil
+		case err != nil:
+			var apiErr *client.APIError
+			if errors.As(err, &apiErr) && !apiErr.Temporary() {
+				return err
+			}
+			wait *= 2
+			if wait > maxPollBackoff {
+				wait = maxPollBackoff
+			}
+			fmt.Fprintf(os.Stderr, "Error polling alerts, retrying in %v: %v\n", wait, err)
+		default:
+			wait = interval
+			if fresh := st.advance(alerts); len(fresh) > 0 {
+				results, err := filterAlerts(fresh, options.AlertJQ)
+				if err != nil {
+					return err
+				}
+				if fwd != nil {
+					err = forwardAlerts(ctx, fwd, results)
+				} else {
+					err = printFollowedAlerts(out, results, options)
+				}
+				if err != nil {
+					return err
+				}
+				if err := st.save(stateFile); err != nil {
+					fmt.Fprintf(os.Stderr, "Error saving state: %v\n", err)
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(wait):
+		}
+	}
+}
+
+// printFollowedAlerts prints one line per alert
+func printFollowedAlerts(w io.Writer, results []interface{}, options ClusterALertOptions) error {
+	for _, result := range results {
+		if s, ok := result.(string); ok {
+			fmt.Fprintln(w, s)
+			continue
+		}
+
+		data, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+		m, isMap := result.(map[string]interface{})
+		if options.JsonFormat || !isMap {
+			fmt.Fprintln(w, string(data))
+			continue
+		}
+		var alert client.Alert
+		if err := json.Unmarshal(data, &alert); err != nil {
+			return err
+		}
+		alert.Raw = m
+		printAlertRow(w, alert)
+	}
+	return nil
+}
+
+const alertRowFormat = "%-19s  %-20s  %-30s  %-8s  %-9s  %-7s  %s\n"
+
+func printAlertHeader(w io.Writer) {
+	fmt.Fprintf(w, alertRowFormat, "TIME", "CLUSTER", "WORKLOAD", "SEVERITY", "OPERATION", "ACTION", "RESOURCE")
+}
+
+func printAlertRow(w io.Writer, alert client.Alert) {
+	ts := ""
+	if alert.Timestamp > 0 {
+		ts = time.Unix(alert.Timestamp, 0).Format("2006-01-02 15:04:05")
+	}
+	workload := alert.HostName
+	if alert.PodName != "" {
+		workload = alert.NamespaceName + "/" + alert.PodName
+	}
+	fmt.Fprintf(w, alertRowFormat, ts, alert.ClusterName, workload, alert.Severity, alert.Operation, alert.Action, alert.Resource)
+}
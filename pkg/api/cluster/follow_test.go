@@ -0,0 +1,185 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/accuknox/accuknox-cli-v2/pkg/api/client"
+)
+
+func testAlert(uid string, ts int64) client.Alert {
+	return client.Alert{UID: uid, Timestamp: ts, Raw: map[string]interface{}{"UID": uid, "Timestamp": float64(ts)}}
+}
+
+func TestFollowStateAdvance(t *testing.T) {
+	st := &followState{LastTimestamp: 100}
+
+	fresh := st.advance([]client.Alert{testAlert("c", 102), testAlert("a", 99), testAlert("b", 101), testAlert("d", 102)})
+	if got := uids(fresh); got != "b,c,d" {
+		t.Errorf("first poll returned %s, want b,c,d", got)
+	}
+	if st.LastTimestamp != 102 || len(st.Seen) != 2 {
+		t.Errorf("unexpected state %+v", st)
+	}
+
+	// the next poll starts at the high-water mark and returns c and d again
+	fresh = st.advance([]client.Alert{testAlert("e", 103), testAlert("d", 102), testAlert("c", 102), testAlert("f", 102)})
+	if got := uids(fresh); got != "f,e" {
+		t.Errorf("second poll returned %s, want f,e", got)
+	}
+
+	path := filepath.Join(t.TempDir(), "state", "alerts.state")
+	if err := st.save(path); err != nil {
+		t.Fatalf("save() error = %v", err)
+	}
+	loaded, err := loadFollowState(path)
+	if err != nil {
+		t.Fatalf("loadFollowState() error = %v", err)
+	}
+	if loaded.LastTimestamp != 103 || strings.Join(loaded.Seen, ",") != "e" {
+		t.Errorf("unexpected loaded state %+v", loaded)
+	}
+}
+
+func uids(alerts []client.Alert) string {
+	var ids []string
+	for _, alert := range alerts {
+		ids = append(ids, alert.UID)
+	}
+	return strings.Join(ids, ",")
+}
+
+func TestFollowClusterAlerts(t *testing.T) {
+	var polls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch atomic.AddInt32(&polls, 1) {
+		case 1:
+			fmt.Fprint(w, `{"response":[{"UID":"2","Timestamp":200,"HostName":"store"},{"UID":"1","Timestamp":100,"HostName":"db"}]}`)
+		case 2:
+			// transient errors must not stop following
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			fmt.Fprint(w, `{"response":[{"UID":"3","Timestamp":300,"HostName":"store"},{"UID":"2","Timestamp":200,"HostName":"store"}]}`)
+		}
+	}))
+	defer srv.Close()
+
+	c := client.New(srv.URL, srv.URL, "token", "1", client.WithRetries(0, 0))
+	options := ClusterALertOptions{
+		AlertJQ:      `.response[] | select(.HostName == "store")`,
+		JsonFormat:   true,
+		PageSize:     50,
+		PollInterval: time.Millisecond,
+		StateFile:    filepath.Join(t.TempDir(), "alerts.state"),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var out bytes.Buffer
+	go func() {
+		for atomic.LoadInt32(&polls) < 4 {
+			time.Sleep(time.Millisecond)
+		}
+		cancel()
+	}()
+	if err := followClusterAlerts(ctx, c, options, &out); err != nil {
+		t.Fatalf("followClusterAlerts() error = %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], `"UID":"2"`) || !strings.Contains(lines[1], `"UID":"3"`) {
+		t.Errorf("unexpected output:\n%s", out.String())
+	}
+
+	st, err := loadFollowState(options.StateFile)
+	if err != nil || st.LastTimestamp != 300 {
+		t.Errorf("state not saved: %+v, %v", st, err)
+	}
+}
+
+func TestFollowClusterAlertsBacklog(t *testing.T) {
+	// more pages than a single poll used to fetch, the most recent first
+	const backlog = 150
+	var polls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req client.AlertsRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if req.PageID == 1 {
+			atomic.AddInt32(&polls, 1)
+		}
+		if req.PageID > backlog || req.FromTime > 1 {
+			fmt.Fprint(w, `{"response":[]}`)
+			return
+		}
+		ts := backlog + 1 - req.PageID
+		fmt.Fprintf(w, `{"response":[{"UID":"%d","Timestamp":%d}]}`, ts, ts)
+	}))
+	defer srv.Close()
+
+	c := client.New(srv.URL, srv.URL, "token", "1", client.WithRetries(0, 0))
+	options := ClusterALertOptions{
+		AlertJQ:      ".response[]",
+		JsonFormat:   true,
+		PageSize:     1,
+		PollInterval: time.Millisecond,
+		StartTime:    1,
+		StateFile:    filepath.Join(t.TempDir(), "alerts.state"),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var out bytes.Buffer
+	go func() {
+		for atomic.LoadInt32(&polls) < 2 {
+			time.Sleep(time.Millisecond)
+		}
+		cancel()
+	}()
+	if err := followClusterAlerts(ctx, c, options, &out); err != nil {
+		t.Fatalf("followClusterAlerts() error = %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != backlog || !strings.Contains(lines[0], `"UID":"1"`) {
+		t.Errorf("got %d alerts starting with %s, want %d starting with UID 1", len(lines), lines[0], backlog)
+	}
+}
+
+func TestFollowStateFile(t *testing.T) {
+	t.Setenv("HOME", "/home/user")
+
+	c := client.New("https://cwpp.example.com", "", "token", "1")
+	store := ClusterALertOptions{StateFile: DefaultFollowStateFile, Filters: `{"field":"HostName","value":"store","op":"match"}`}
+	db := ClusterALertOptions{StateFile: DefaultFollowStateFile, Filters: `{"field":"HostName","value":"db","op":"match"}`}
+
+	if followStateFile(c, store) == followStateFile(c, db) {
+		t.Errorf("follow runs with different filters share the state file %s", followStateFile(c, store))
+	}
+	if followStateFile(c, store) != followStateFile(c, store) {
+		t.Errorf("state file of the same query is not stable")
+	}
+	if got := followStateFile(c, store); !strings.HasPrefix(got, "/home/user/.accuknox-alerts-") {
+		t.Errorf("followStateFile() = %s", got)
+	}
+
+	for _, other := range []*client.Client{
+		client.New("https://cwpp.example.com", "", "token", "2"),
+		client.New("https://cwpp.other.example.com", "", "token", "1"),
+	} {
+		if followStateFile(c, store) == followStateFile(other, store) {
+			t.Errorf("follow runs of another tenant or endpoint share the state file %s", followStateFile(c, store))
+		}
+	}
+
+	custom := ClusterALertOptions{StateFile: "$HOME/alerts.state", Filters: store.Filters}
+	if got := followStateFile(c, custom); got != "/home/user/alerts.state" {
+		t.Errorf("followStateFile() = %s, want the file given", got)
+	}
+}
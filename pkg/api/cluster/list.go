@@ -1,17 +1,16 @@
 package cluster
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
-	"io"
-	"net/http"
 	"os"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/accuknox/accuknox-cli-v2/pkg/api/asset"
-	"github.com/accuknox/accuknox-cli-v2/pkg/config"
+	"github.com/accuknox/accuknox-cli-v2/pkg/api/client"
 	"github.com/accuknox/accuknox-cli-v2/pkg/logger"
 	"github.com/itchyny/gojq"
 	"github.com/olekukonko/tablewriter"
@@ -68,73 +67,28 @@ type CLusterListOptions struct {
 	CfgFile       string
 	Page          int
 	PageSize      int
+	Concurrency   int
 }
 
-type Cluster struct {
-	ID          float64 `json:"ID"`
-	ClusterName string  `json:"ClusterName"`
-	Status      string  `json:"Status"`
-}
-
-type nodeInfo struct {
-	Total_Record float64 `json:"total_record"`
-	Result       []node  `json:"result"`
-}
-type node struct {
-	ID       float64 `json:"ID"`
-	NodeName string  `json:"NodeName"`
-	Status   string  `json:"Status"`
-}
-
-var ClusterInfo Cluster
+// Cluster is an onboarded cluster
+type Cluster = client.Cluster
 
-func FetchClusterInfo(options CLusterListOptions) {
-	var clustersData []Cluster
+func FetchClusterInfo(ctx context.Context, c *client.Client, options CLusterListOptions) error {
 	var table *tablewriter.Table
-	var tableNode *tablewriter.Table
-
-	cursorCount := 0
-	cursor := [4]string{"|", "/", "—", "\\"}
 
+	stopSpinner := func() {}
 	if !options.JsonFormat {
-		go func() {
-			for {
-				select {
-				case <-done:
-					return
-				default:
-					fmt.Fprintf(os.Stderr, "\rFetching clusters: %s", cursor[cursorCount])
-					cursorCount = (cursorCount + 1) % len(cursor)
-					time.Sleep(100 * time.Millisecond)
-				}
-			}
-		}()
+		stopSpinner = startSpinner("Fetching clusters")
+		defer stopSpinner()
 	}
 
-	clusters := fetchClustersList(config.Cfg.CWPP_URL)
-
-	clusterData, err := jqFilter(clusters, options.ClusterListJQ)
+	clusterData, clustersData, err := fetchClusters(ctx, c, options.ClusterListJQ)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error applying jq filter: %v\n", err)
-		return
+		return err
 	}
 	if len(clusterData) == 0 {
 		fmt.Println("No clusters found matching the provided criteria.")
-		return
-	}
-
-	for _, cluster := range clusterData {
-		bytes, err := json.Marshal(cluster)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error marshaling: %v\n", err)
-			return
-		}
-
-		if err := json.Unmarshal(bytes, &ClusterInfo); err != nil {
-			fmt.Fprintf(os.Stderr, "Error unmarshaling: %v\n", err)
-			return
-		}
-		clustersData = append(clustersData, ClusterInfo)
+		return nil
 	}
 
 	if options.ClusterName == "" && !(options.ShowNodes && options.JsonFormat) {
@@ -152,7 +106,7 @@ func FetchClusterInfo(options CLusterListOptions) {
 		}
 
 		if !options.JsonFormat {
-			done <- true
+			stopSpinner()
 			table.Render()
 		}
 		if options.JsonFormat {
@@ -160,75 +114,110 @@ func FetchClusterInfo(options CLusterListOptions) {
 		}
 	}
 
-	var clusterNodes []interface{}
-	if options.ShowNodes {
-		if !options.JsonFormat {
-			tableNode = tablewriter.NewWriter(os.Stdout)
-			tableNode.SetHeader([]string{"Node-ID", "Cluster-Name", "Node-Name", "Status"})
+	if !options.ShowNodes {
+		return nil
+	}
+
+	var selected []Cluster
+	for _, cluster := range clustersData {
+		if options.ClusterName == "" || options.ClusterName == cluster.ClusterName {
+			selected = append(selected, cluster)
 		}
-		for _, cluster := range clustersData {
-			node := fetchNodes(cluster, options, tableNode)
-			if node == nil {
-				continue
+	}
+	results := forEachCluster(ctx, selected, options.Concurrency, func(ctx context.Context, cluster Cluster) (clusterNodes, error) {
+		return fetchNodes(ctx, c, cluster, options)
+	})
+	stopSpinner()
+
+	if options.JsonFormat {
+		var nodes []interface{}
+		for _, r := range results {
+			if r.Value.json != nil {
+				nodes = append(nodes, r.Value.json)
 			}
-			clusterNodes = append(clusterNodes, node)
 		}
-
-		if !options.JsonFormat {
-			logger.Print("\nNode Information : ")
-			tableNode.Render()
-		} else {
-			asset.PrintJSON(clusterNodes, true, options.JsonFormat)
+		asset.PrintJSON(nodes, true, options.JsonFormat)
+	} else {
+		tableNode := tablewriter.NewWriter(os.Stdout)
+		tableNode.SetHeader([]string{"Node-ID", "Cluster-Name", "Node-Name", "Status"})
+		for _, r := range results {
+			tableNode.AppendBulk(r.Value.rows)
 		}
+		tableNode.SetRowLine(true)
+		logger.Print("\nNode Information : ")
+		tableNode.Render()
 	}
+	return clusterErrors(os.Stderr, results)
 }
 
-// fetchClustersList fetches the list of onboarded clusters from the API
-func fetchClustersList(url string) interface{} {
-	apiURL := fmt.Sprintf("%s/cluster-onboarding/api/v1/get-onboarded-clusters?wsid=%s", url, config.Cfg.TENANT_ID)
+// startSpinner shows a progress indicator on stderr until the returned
+// function is called
+func startSpinner(msg string) func() {
+	done := make(chan bool)
+	cursorCount := 0
+	cursor := [4]string{"|", "/", "—", "\\"}
+
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				fmt.Fprintf(os.Stderr, "\r%s: %s", msg, cursor[cursorCount])
+				cursorCount = (cursorCount + 1) % len(cursor)
+				time.Sleep(100 * time.Millisecond)
+			}
+		}
+	}()
 
-	req, err := http.NewRequest("GET", apiURL, nil)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error creating HTTP request: %v\n", err)
-		return nil
-	}
-	req.Header.Set("Authorization", "Bearer "+config.Cfg.TOKEN)
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("X-Tenant-ID", config.Cfg.TENANT_ID)
+	return sync.OnceFunc(func() { close(done) })
+}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+// fetchClusters fetches the list of onboarded clusters from the API and
+// applies the jq filter on it. It returns the filtered JSON objects along
+// with the clusters they describe.
+func fetchClusters(ctx context.Context, c *client.Client, clusterJQ string) ([]interface{}, []Cluster, error) {
+	clusters, err := c.ListClusters(ctx)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error making API call: %v\n", err)
-		return nil
+		return nil, nil, err
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error reading response body: %v\n", err)
-		return nil
+	rawClusters := make([]interface{}, 0, len(clusters))
+	for _, cluster := range clusters {
+		rawClusters = append(rawClusters, cluster.Raw)
 	}
 
-	var jsonResponse interface{}
-	err = json.Unmarshal(body, &jsonResponse)
+	clusterData, err := jqFilter(rawClusters, clusterJQ)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error unmarshalling JSON: %v\n", err)
-		logger.Error("api responce: %v\n", string(body))
-		return nil
+		return nil, nil, fmt.Errorf("error applying jq filter: %v", err)
 	}
 
-	return jsonResponse
-}
+	var clustersData []Cluster
+	for _, cluster := range clusterData {
+		bytes, err := json.Marshal(cluster)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error marshaling: %v", err)
+		}
 
-// fetchNodes fetches the nodes for a given cluster
-func fetchNodes(ClusterInfo Cluster, options CLusterListOptions, tableNode *tablewriter.Table) map[string]interface{} {
-	if options.ClusterName != "" && options.ClusterName != ClusterInfo.ClusterName {
-		return nil
+		var info Cluster
+		if err := json.Unmarshal(bytes, &info); err != nil {
+			return nil, nil, fmt.Errorf("error unmarshaling: %v", err)
+		}
+		clustersData = append(clustersData, info)
 	}
+	return clusterData, clustersData, nil
+}
 
-	apiURL := fmt.Sprintf("%s/cm/api/v1/cluster-management/nodes-in-cluster", config.Cfg.CWPP_URL)
+// clusterNodes are the nodes of a cluster, as table rows or as the JSON
+// object printed with --json
+type clusterNodes struct {
+	rows [][]string
+	json map[string]interface{}
+}
 
+// fetchNodes fetches the nodes for a given cluster
+func fetchNodes(ctx context.Context, c *client.Client, cluster Cluster, options CLusterListOptions) (clusterNodes, error) {
+	var result clusterNodes
 	var clusterNode []interface{}
 	polPerPage := options.PageSize // Number of policies per page
 	pagePrevious := 0
@@ -238,91 +227,33 @@ func fetchNodes(ClusterInfo Cluster, options CLusterListOptions, tableNode *tabl
 		}
 		pageNext := pagePrevious + polPerPage
 
-		requestPayload := map[string]interface{}{
-			"workspace_id":  config.Cfg.TENANT_ID,
-			"cluster_id":    []interface{}{ClusterInfo.ID},
-			"from_time":     []int64{},
-			"to_time":       []int64{},
-			"page_previous": pagePrevious,
-			"page_next":     pageNext,
-		}
-
-		payloadBytes, err := json.Marshal(requestPayload)
+		resp, err := c.ListNodes(ctx, client.NodesRequest{
+			ClusterID:    []float64{cluster.ID},
+			PagePrevious: pagePrevious,
+			PageNext:     pageNext,
+		})
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error preparing request payload: %v\n", err)
-			return nil
-		}
-
-		req, err := http.NewRequest("POST", apiURL, bytes.NewBuffer(payloadBytes))
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error creating HTTP request: %v\n", err)
-			return nil
-		}
-		req.Header.Set("Authorization", "Bearer "+config.Cfg.TOKEN)
-		req.Header.Set("Content-Type", "application/json")
-		req.Header.Set("X-Tenant-ID", config.Cfg.TENANT_ID)
-
-		client := &http.Client{}
-		resp, err := client.Do(req)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error fetching nodes: %v\n", err)
-			return nil
-		}
-		defer resp.Body.Close()
-
-		if resp.StatusCode != http.StatusOK {
-			body, _ := io.ReadAll(resp.Body)
-			fmt.Fprintf(os.Stderr, "Error: Received status code %d with body: %s\n", resp.StatusCode, body)
-			return nil
-		}
-
-		body, err := io.ReadAll(resp.Body)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error reading response: %v\n", err)
-			return nil
-		}
-
-		var nodeData map[string]interface{}
-		err = json.Unmarshal(body, &nodeData)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error unmarshalling nodes response: %v\n", err)
-			logger.Error("api responce: %v\n", string(body))
-			return nil
+			return result, err
 		}
 
 		// jq filtering
-		nodes, err := jqFilter(nodeData, options.NodeJQ)
+		nodes, err := jqFilter(resp.Raw, options.NodeJQ)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error applying jq filter: %v\n", err)
-			return nil
+			return result, fmt.Errorf("error applying jq filter: %v", err)
 		}
 
-		total_record, err := jqFilter(nodeData, ".total_record")
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error applying jq filter: %v\n", err)
-			return nil
-		}
-
-		var record float64
-		if len(total_record) > 0 {
-			record = total_record[0].(float64)
-		}
+		record := resp.TotalRecord
 
 		for _, nodeData := range nodes {
-			var nodeInfo node
-			nodeBytes, _ := json.MarshalIndent(nodeData, "", "  ")
-			if !options.JsonFormat {
-				err = json.Unmarshal(nodeBytes, &nodeInfo)
-				if err != nil {
-					fmt.Fprintf(os.Stderr, "Error unmarshalling node: %v\n", err)
-					return nil
-				}
-
-				fmt.Printf("\rTotal nodes found : %v, fetching nodes from: %d to next: %d for cluster %s", record, pagePrevious, pageNext, ClusterInfo.ClusterName)
-
-				tableNode.Append([]string{strconv.FormatFloat(nodeInfo.ID, 'f', -1, 64), ClusterInfo.ClusterName, nodeInfo.NodeName, nodeInfo.Status})
-				tableNode.SetRowLine(true)
+			if options.JsonFormat {
+				continue
+			}
+			var nodeInfo client.Node
+			nodeBytes, _ := json.Marshal(nodeData)
+			if err := json.Unmarshal(nodeBytes, &nodeInfo); err != nil {
+				return result, fmt.Errorf("error unmarshalling node: %v", err)
 			}
+			result.rows = append(result.rows, []string{strconv.FormatFloat(nodeInfo.ID, 'f', -1, 64), cluster.ClusterName, nodeInfo.NodeName, nodeInfo.Status})
 		}
 
 		if len(nodes) == 0 && record <= float64(pageNext) {
@@ -335,13 +266,12 @@ func fetchNodes(ClusterInfo Cluster, options CLusterListOptions, tableNode *tabl
 		pagePrevious = pageNext
 	}
 	if options.JsonFormat && clusterNode != nil {
-		clusterNodes := map[string]interface{}{
-			"cluster": ClusterInfo.ClusterName,
+		result.json = map[string]interface{}{
+			"cluster": cluster.ClusterName,
 			"result":  clusterNode,
 		}
-		return clusterNodes
 	}
-	return nil
+	return result, nil
 }
 
 func jqFilter(data interface{}, jqFilter string) ([]interface{}, error) {
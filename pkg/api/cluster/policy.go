@@ -1,19 +1,16 @@
 package cluster
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"io/ioutil"
-	"net/http"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
 
-	"github.com/accuknox/accuknox-cli-v2/pkg/api/asset"
-	"github.com/accuknox/accuknox-cli-v2/pkg/config"
+	"github.com/accuknox/accuknox-cli-v2/pkg/api/client"
 	"github.com/accuknox/accuknox-cli-v2/pkg/logger"
 	"github.com/olekukonko/tablewriter"
 )
@@ -27,6 +24,17 @@ const ClusterPolicyDescription = `
 
 NOTE: In policyjq flag ".list_of_policies[]" is an array we get from AccuKnox API response and then further we can provide a condition(on top of the array we get), as shown in above example, this condition will be applied on every policy we get and will list only which statisfy it. If no further condition is applied, it will dump all the policies.
 Here, clusterjq flag has same behaviour as of in "api cluster list" command flag.
+
+3. knoxctl api cluster policy --operation upload -f block-crypto.yaml --clusterName prod --namespace shop
+... upload the policies of a local YAML file to namespace shop of cluster prod
+
+4. knoxctl api cluster policy --operation set-action --action Block --policy-name block-crypto --clusterName prod --namespace shop --dry-run
+... show the change of a policy from Audit to Block mode without applying it
+
+5. knoxctl api cluster policy --operation deactivate --policy-id 4211 --yes
+... deactivate a policy without asking for a confirmation, e.g. from CI
+
+Other operations are activate, delete and history. Every change asks for a confirmation unless --yes is given.
 `
 
 type ClusterPolicyOptions struct {
@@ -40,97 +48,57 @@ type ClusterPolicyOptions struct {
 	Token         string
 	Tenant_id     string
 	CfgFile       string
+	File          string
+	Namespace     string
+	PolicyID      string
+	PolicyName    string
+	Action        string
+	DryRun        bool
+	Yes           bool
+	Concurrency   int
 }
 
 type Policy struct {
 	ID float64 `json:"policy_id"`
 }
 
-var PolicyInfo Policy
-var clusterPolicies []map[string]interface{}
 var polout string = "policydump"
 
-// fetchPolicies retrieves and processes policies for a given clusterID with pagination
-func fetchPolicies(clusterID string, options ClusterPolicyOptions) ([]map[string]interface{}, error) {
+// clusterPolicies are the policies of a cluster, as table rows or as the
+// JSON objects printed with --json
+type clusterPolicies struct {
+	rows [][]string
+	json []map[string]interface{}
+}
+
+// fetchPolicies retrieves the policies for a given cluster with pagination,
+// and dumps them with the dump operation
+func fetchPolicies(ctx context.Context, c *client.Client, cluster Cluster, options ClusterPolicyOptions) (clusterPolicies, error) {
+	var result clusterPolicies
 	polPerPage := 50 // Number of policies per page
 	pagePrevious := 0
-	client := &http.Client{}
-	table := tablewriter.NewWriter(os.Stdout)
 	for {
 		pageNext := pagePrevious + polPerPage
-		id, _ := strconv.ParseFloat(clusterID, 64)
 
-		requestPayload := map[string]interface{}{
-			"workspace_id":  config.Cfg.TENANT_ID,
-			"workload":      "k8s",
-			"page_previous": pagePrevious,
-			"page_next":     pageNext,
-			"filter": map[string]interface{}{
-				"cluster_id":   []interface{}{id},
-				"namespace_id": nil,
-				"workload_id":  nil,
-				"kind":         nil,
-				"node_id":      nil,
-				"pod_id":       nil,
-				"type":         nil,
-				"status":       nil,
-				"tags":         nil,
-				"name": map[string]interface{}{
-					"regex": nil,
-				},
-				"tldr": map[string]interface{}{
-					"regex": nil,
-				},
+		resp, err := c.ListPolicies(ctx, client.PolicyListRequest{
+			Workload:     "k8s",
+			PagePrevious: pagePrevious,
+			PageNext:     pageNext,
+			Filter: client.PolicyFilter{
+				ClusterID: []float64{cluster.ID},
 			},
-		}
-
-		payloadBytes, err := json.Marshal(requestPayload)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error preparing request payload: %v\n", err)
-			return nil, err
-		}
-
-		url := fmt.Sprintf("%s/policymanagement/v2/list-policy", config.Cfg.CWPP_URL)
-		req, err := http.NewRequest("POST", url, bytes.NewBuffer(payloadBytes))
+		})
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error creating HTTP request: %v\n", err)
-			return nil, err
+			return result, err
 		}
 
-		req.Header.Set("Authorization", "Bearer "+config.Cfg.TOKEN)
-		req.Header.Set("Content-Type", "application/json")
-		req.Header.Set("X-Tenant-ID", config.Cfg.TENANT_ID)
-
-		resp, err := client.Do(req)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error making API request: %v\n", err)
-			return nil, err
+		if resp.Raw["list_of_policies"] == nil {
+			return result, nil
 		}
-		defer resp.Body.Close()
 
-		body, err := io.ReadAll(resp.Body)
+		results, err := jqFilter(resp.Raw, options.PolicyJQ)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error reading response body: %v\n", err)
-			return nil, err
-		}
-
-		var jsonResponse interface{}
-		if err := json.Unmarshal(body, &jsonResponse); err != nil {
-			fmt.Fprintf(os.Stderr, "Error unmarshaling response: %v\n", err)
-			return nil, err
-		}
-		results, err := jqFilter(jsonResponse, options.PolicyJQ)
-		if err != nil {
-			if strings.Contains(err.Error(), "null") {
-				if pageNext != polPerPage && !options.JsonFormat {
-					table.Render()
-				} else if !options.JsonFormat {
-					fmt.Println("No policies available...")
-				}
-				return clusterPolicies, nil
-			}
-			fmt.Fprintf(os.Stderr, "Error jq filtering: %v\n", err)
-			return nil, err
+			return result, fmt.Errorf("error jq filtering: %v", err)
 		}
 
 		for _, policy := range results {
@@ -138,64 +106,25 @@ func fetchPolicies(clusterID string, options ClusterPolicyOptions) ([]map[string
 			if !ok {
 				continue
 			}
+			p := client.PolicyFromRaw(policyMap)
 
-			var policyID float64
-			var name string
-			var namespace, category, status, cluster string
-			if policyID, ok = policyMap["policy_id"].(float64); !ok {
-				logger.Debug("policy_id not found")
-			}
-			if name, ok = policyMap["name"].(string); !ok {
-				logger.Debug("name not found")
-			}
-			if namespace, ok = policyMap["namespace_name"].(string); !ok {
-				namespace = ""
-			}
-			if category, ok = policyMap["category"].(string); !ok {
-				category = ""
-			}
-			if status, ok = policyMap["status"].(string); !ok {
-				status = ""
-			}
-			if cluster, ok = policyMap["cluster_name"].(string); !ok {
-				cluster = ""
-			}
-
-			var labelStrings []string
-
-			if rawLabels, ok := policyMap["labels"].([]interface{}); ok {
-				for _, item := range rawLabels {
-					if labelMap, ok := item.(map[string]interface{}); ok {
-						name, nameOk := labelMap["name"].(string)
-						value, valueOk := labelMap["value"].(string)
-						if nameOk && valueOk {
-							labelStrings = append(labelStrings, fmt.Sprintf("%s:%s", name, value))
-						}
-					}
-				}
-			}
-
-			var clusterPolicy map[string]interface{}
 			if options.JsonFormat {
-				clusterPolicy = map[string]interface{}{
-					"name":      name,
-					"namespace": namespace,
-					"category":  category,
-					"status":    status,
-					"cluster":   cluster,
-					"labels":    labelStrings,
-				}
-			}
-
-			clusterPolicies = append(clusterPolicies, clusterPolicy)
-			if !options.JsonFormat {
-				table.SetHeader([]string{"Name", "Category", "Status", "Cluster", "Namespace", "Labels"})
-				table.Append([]string{name, category, status, cluster, namespace, strings.Join(labelStrings, ", ")})
-				table.SetRowLine(true)
+				result.json = append(result.json, map[string]interface{}{
+					"name":      p.Name,
+					"namespace": p.Namespace,
+					"category":  p.Category,
+					"status":    p.Status,
+					"cluster":   p.ClusterName,
+					"labels":    p.Labels,
+				})
+			} else {
+				result.rows = append(result.rows, []string{p.Name, p.Category, p.Status, p.ClusterName, p.Namespace, strings.Join(p.Labels, ", ")})
 			}
 
 			if options.Operation == "dump" {
-				fetchPolicy(options, strconv.FormatFloat(policyID, 'f', -1, 64), name, namespace)
+				if err := fetchPolicy(ctx, c, cluster.ClusterName, strconv.FormatFloat(p.PolicyID, 'f', -1, 64), p.Name, p.Namespace); err != nil {
+					return result, err
+				}
 			}
 		}
 		pagePrevious = pageNext
@@ -203,68 +132,67 @@ func fetchPolicies(clusterID string, options ClusterPolicyOptions) ([]map[string
 }
 
 // FetchAndProcessPolicies fetches and processes policies for all clusters
-func FetchAndProcessPolicies(options ClusterPolicyOptions) {
-	var policies []map[string]interface{}
-
-	clusters := fetchClustersList(config.Cfg.CWPP_URL)
+func FetchAndProcessPolicies(ctx context.Context, c *client.Client, options ClusterPolicyOptions) error {
+	if isPolicyWriteOp(options.Operation) {
+		return managePolicy(ctx, c, options, os.Stdin, os.Stdout)
+	}
 
-	clusterData, err := asset.ApplyJQFilter(clusters, options.ClusterListJQ)
+	clusterData, clusters, err := fetchClusters(ctx, c, options.ClusterListJQ)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error while applying jq filter: %v\n", err)
-		return
+		return err
 	}
 	if len(clusterData) == 0 {
 		fmt.Println("No clusters found matching the provided criteria.")
-		return
+		return nil
 	}
 
-	for _, cluster := range clusterData {
-		bytes, err := json.Marshal(cluster)
-		if err != nil {
-			logger.Error("error while marshaling: %v", err)
-			return
-		}
-
-		if err := json.Unmarshal(bytes, &ClusterInfo); err != nil {
-			logger.Error("error while unmarshaling: %v", err)
-			return
-		}
-		if options.ClusterName != "" && ClusterInfo.ClusterName != options.ClusterName {
+	var selected []Cluster
+	for _, cluster := range clusters {
+		if options.ClusterName != "" && cluster.ClusterName != options.ClusterName {
 			continue
 		}
-		if options.Operation == "dump" {
-			cpath := filepath.Join(polout, ClusterInfo.ClusterName)
-			err := os.MkdirAll(cpath, 0750)
-			if err != nil {
-				logger.Error("err: %v\n", err)
-			}
-		}
-
-		if !options.JsonFormat {
-			logger.Print("Fetching policies for cluster: %s", ClusterInfo.ClusterName)
-		}
-		if options.JsonFormat {
-			clusterPolcies, err := fetchPolicies(strconv.FormatFloat(ClusterInfo.ID, 'f', -1, 64), options)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Error fetching policies for cluster %s: %v\n", ClusterInfo.ClusterName, err)
-			}
-			policies = append(policies, clusterPolcies...)
-		} else {
-			_, err := fetchPolicies(strconv.FormatFloat(ClusterInfo.ID, 'f', -1, 64), options)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Error fetching policies for cluster %s: %v\n", ClusterInfo.ClusterName, err)
-			}
-		}
+		selected = append(selected, cluster)
+	}
 
+	stopSpinner := func() {}
+	if !options.JsonFormat {
+		stopSpinner = startSpinner(fmt.Sprintf("Fetching policies for %d clusters", len(selected)))
+		defer stopSpinner()
 	}
+	results := forEachCluster(ctx, selected, options.Concurrency, func(ctx context.Context, cluster Cluster) (clusterPolicies, error) {
+		return fetchPolicies(ctx, c, cluster, options)
+	})
+	stopSpinner()
+
 	if options.JsonFormat {
+		policies := []map[string]interface{}{}
+		for _, r := range results {
+			policies = append(policies, r.Value.json...)
+		}
 		jsonPolicies, _ := json.Marshal(policies)
 		fmt.Println(string(jsonPolicies))
+	} else {
+		for _, r := range results {
+			if r.Err != nil {
+				continue
+			}
+			logger.Print("\nPolicies for cluster: %s", r.Cluster.ClusterName)
+			if len(r.Value.rows) == 0 {
+				fmt.Println("No policies available...")
+				continue
+			}
+			table := tablewriter.NewWriter(os.Stdout)
+			table.SetHeader([]string{"Name", "Category", "Status", "Cluster", "Namespace", "Labels"})
+			table.AppendBulk(r.Value.rows)
+			table.SetRowLine(true)
+			table.Render()
+		}
 	}
+	return clusterErrors(os.Stderr, results)
 }
 
-func dumpPolicy(name, namespace, policy string) error {
-	filePath := filepath.Join(polout, ClusterInfo.ClusterName, namespace, fmt.Sprintf("%s.yaml", name))
+func dumpPolicy(clusterName, name, namespace, policy string) error {
+	filePath := filepath.Join(polout, clusterName, namespace, fmt.Sprintf("%s.yaml", name))
 	if err := os.MkdirAll(filepath.Dir(filePath), 0750); err != nil {
 		return fmt.Errorf("err: %v", err)
 	}
@@ -277,51 +205,15 @@ func dumpPolicy(name, namespace, policy string) error {
 	return nil
 }
 
-func fetchPolicy(options ClusterPolicyOptions, policyID, name, namespace string) {
-	apiURL := fmt.Sprintf("%s/policymanagement/v2/policy/%s", config.Cfg.CWPP_URL, policyID)
-
-	req, err := http.NewRequest("GET", apiURL, nil)
+// fetchPolicy fetches the YAML of a policy and dumps it
+func fetchPolicy(ctx context.Context, c *client.Client, clusterName, policyID, name, namespace string) error {
+	policy, err := c.GetPolicy(ctx, policyID)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error creating HTTP request: %v\n", err)
-		return
+		return err
 	}
-	req.Header.Set("Authorization", "Bearer "+config.Cfg.TOKEN)
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("X-Tenant-ID", config.Cfg.TENANT_ID)
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error making API call: %v\n", err)
-		return
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error reading response body: %v\n", err)
-		return
+	if policy.Raw["yaml"] == nil {
+		return fmt.Errorf("YAML field not found in the response for policy %s", name)
 	}
 
-	var jsonResponse map[string]interface{}
-	err = json.Unmarshal(body, &jsonResponse)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error unmarshalling JSON: %v\n", err)
-		logger.Error("api responce: %v\n", string(body))
-		return
-	}
-
-	yamlData, ok := jsonResponse["yaml"].(string)
-	if !ok {
-		fmt.Fprintln(os.Stderr, "YAML field not found in response")
-		return
-	}
-
-	if options.Operation == "dump" {
-		err := dumpPolicy(name, namespace, yamlData)
-		if err != nil {
-			fmt.Fprintln(os.Stderr, err)
-			return
-		}
-	}
+	return dumpPolicy(clusterName, name, namespace, policy.YAML)
 }
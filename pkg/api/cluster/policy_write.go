@@ -0,0 +1,384 @@
+package cluster
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/accuknox/accuknox-cli-v2/pkg/api/client"
+	"github.com/olekukonko/tablewriter"
+	"sigs.k8s.io/yaml"
+)
+
+// Policy operations, besides list and dump
+const (
+	PolicyOpUpload     = "upload"
+	PolicyOpActivate   = "activate"
+	PolicyOpDeactivate = "deactivate"
+	PolicyOpSetAction  = "set-action"
+	PolicyOpDelete     = "delete"
+	PolicyOpHistory    = "history"
+)
+
+// PolicyOperations are the values accepted by --operation
+var PolicyOperations = []string{"list", "dump", PolicyOpUpload, PolicyOpActivate, PolicyOpDeactivate, PolicyOpSetAction, PolicyOpDelete, PolicyOpHistory}
+
+var yamlDocSeparator = regexp.MustCompile(`(?m)^---[ \t]*$`)
+
+// isPolicyWriteOp reports whether the operation is handled by managePolicy
+func isPolicyWriteOp(op string) bool {
+	switch op {
+	case PolicyOpUpload, PolicyOpActivate, PolicyOpDeactivate, PolicyOpSetAction, PolicyOpDelete, PolicyOpHistory:
+		return true
+	}
+	return false
+}
+
+// ValidatePolicyOptions checks the flags needed by the operation
+func ValidatePolicyOptions(options ClusterPolicyOptions) error {
+	valid := false
+	for _, op := range PolicyOperations {
+		if op == options.Operation {
+			valid = true
+		}
+	}
+	if !valid {
+		return fmt.Errorf("invalid operation %q, must be one of %s", options.Operation, strings.Join(PolicyOperations, ", "))
+	}
+
+	switch options.Operation {
+	case PolicyOpUpload:
+		if options.File == "" {
+			return fmt.Errorf("--file is required to upload a policy")
+		}
+		if options.ClusterName == "" {
+			return fmt.Errorf("--clusterName is required to upload a policy")
+		}
+	case PolicyOpActivate, PolicyOpDeactivate, PolicyOpSetAction, PolicyOpDelete, PolicyOpHistory:
+		if options.PolicyID == "" && options.PolicyName == "" {
+			return fmt.Errorf("--policy-id or --policy-name is required for operation %s", options.Operation)
+		}
+		if options.PolicyID == "" && options.ClusterName == "" {
+			return fmt.Errorf("--clusterName is required to look up a policy by name")
+		}
+		if options.Operation == PolicyOpSetAction {
+			if _, err := normalizePolicyAction(options.Action); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func normalizePolicyAction(action string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(action)) {
+	case "audit":
+		return "Audit", nil
+	case "block":
+		return "Block", nil
+	}
+	return "", fmt.Errorf("invalid action %q, must be Audit or Block", action)
+}
+
+// managePolicy runs a write or history operation on a single policy, or
+// uploads the policies of a file. Changes are confirmed on in unless
+// options.Yes is set and are only described when options.DryRun is set.
+func managePolicy(ctx context.Context, c *client.Client, options ClusterPolicyOptions, in io.Reader, out io.Writer) error {
+	if err := ValidatePolicyOptions(options); err != nil {
+		return err
+	}
+
+	if options.Operation == PolicyOpUpload {
+		return uploadPolicy(ctx, c, options, in, out)
+	}
+
+	policyID, name, err := resolvePolicy(ctx, c, options)
+	if err != nil {
+		return err
+	}
+
+	switch options.Operation {
+	case PolicyOpActivate, PolicyOpDeactivate:
+		status := client.PolicyStatusActive
+		if options.Operation == PolicyOpDeactivate {
+			status = client.PolicyStatusInactive
+		}
+		msg := fmt.Sprintf("%s policy %s (%s)", options.Operation, name, policyID)
+		if ok, err := approve(options.DryRun, options.Yes, in, out, msg); !ok || err != nil {
+			return err
+		}
+		if err := c.SetPolicyStatus(ctx, status, policyID); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Policy %s is now %s\n", name, status)
+
+	case PolicyOpSetAction:
+		action, _ := normalizePolicyAction(options.Action)
+		policy, err := c.GetPolicy(ctx, policyID)
+		if err != nil {
+			return err
+		}
+		updated, previous, err := setPolicyAction(policy.YAML, action)
+		if err != nil {
+			return fmt.Errorf("policy %s: %v", name, err)
+		}
+		if previous == action {
+			fmt.Fprintf(out, "Policy %s is already in %s mode\n", name, action)
+			return nil
+		}
+		msg := fmt.Sprintf("change the action of policy %s (%s) from %s to %s", name, policyID, previous, action)
+		if ok, err := approve(options.DryRun, options.Yes, in, out, msg); !ok || err != nil {
+			return err
+		}
+		if err := c.UpdatePolicy(ctx, policyID, updated); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Policy %s is now in %s mode\n", name, action)
+
+	case PolicyOpDelete:
+		msg := fmt.Sprintf("delete policy %s (%s)", name, policyID)
+		if ok, err := approve(options.DryRun, options.Yes, in, out, msg); !ok || err != nil {
+			return err
+		}
+		if err := c.DeletePolicy(ctx, policyID); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Policy %s deleted\n", name)
+
+	case PolicyOpHistory:
+		history, err := c.GetPolicyHistory(ctx, policyID)
+		if err != nil {
+			return err
+		}
+		return printPolicyHistory(out, history, options.JsonFormat)
+	}
+	return nil
+}
+
+// approve prints what a change would do in dry-run mode, or asks for a
+// confirmation unless --yes was given
+func approve(dryRun, yes bool, in io.Reader, out io.Writer, msg string) (bool, error) {
+	if dryRun {
+		fmt.Fprintf(out, "Dry run: would %s\n", msg)
+		return false, nil
+	}
+	if yes {
+		return true, nil
+	}
+
+	fmt.Fprintf(out, "Do you want to %s? (y/n): ", msg)
+	response, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return false, fmt.Errorf("error reading response: %v", err)
+	}
+	if strings.ToLower(strings.TrimSpace(response)) != "y" {
+		fmt.Fprintln(out, "Operation cancelled.")
+		return false, nil
+	}
+	return true, nil
+}
+
+// findCluster returns the cluster with the given name
+func findCluster(ctx context.Context, c *client.Client, clusterJQ, name string) (Cluster, error) {
+	if clusterJQ == "" {
+		clusterJQ = ".[]"
+	}
+	_, clusters, err := fetchClusters(ctx, c, clusterJQ)
+	if err != nil {
+		return Cluster{}, err
+	}
+	for _, cluster := range clusters {
+		if cluster.ClusterName == name {
+			return cluster, nil
+		}
+	}
+	return Cluster{}, fmt.Errorf("cluster %s not found", name)
+}
+
+// resolvePolicy returns the ID and name of the policy selected by
+// --policy-id, or by --policy-name in --clusterName (and --namespace)
+func resolvePolicy(ctx context.Context, c *client.Client, options ClusterPolicyOptions) (string, string, error) {
+	if options.PolicyID != "" {
+		name := options.PolicyName
+		if name == "" {
+			name = options.PolicyID
+		}
+		return options.PolicyID, name, nil
+	}
+
+	cluster, err := findCluster(ctx, c, options.ClusterListJQ, options.ClusterName)
+	if err != nil {
+		return "", "", err
+	}
+
+	policies, err := listClusterPolicies(ctx, c, cluster.ID)
+	if err != nil {
+		return "", "", err
+	}
+	var matches []client.PolicySummary
+	for _, p := range policies {
+		if p.Name == options.PolicyName && (options.Namespace == "" || p.Namespace == options.Namespace) {
+			matches = append(matches, p)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return "", "", fmt.Errorf("policy %s not found in cluster %s", options.PolicyName, options.ClusterName)
+	case 1:
+		return strconv.FormatFloat(matches[0].PolicyID, 'f', -1, 64), matches[0].Name, nil
+	}
+	var namespaces []string
+	for _, p := range matches {
+		namespaces = append(namespaces, p.Namespace)
+	}
+	return "", "", fmt.Errorf("policy %s exists in several namespaces (%s), use --namespace or --policy-id", options.PolicyName, strings.Join(namespaces, ", "))
+}
+
+// listClusterPolicies returns every policy of a cluster
+func listClusterPolicies(ctx context.Context, c *client.Client, clusterID float64) ([]client.PolicySummary, error) {
+	var policies []client.PolicySummary
+	polPerPage := 50
+	for pagePrevious := 0; ; pagePrevious += polPerPage {
+		resp, err := c.ListPolicies(ctx, client.PolicyListRequest{
+			Workload:     "k8s",
+			PagePrevious: pagePrevious,
+			PageNext:     pagePrevious + polPerPage,
+			Filter: client.PolicyFilter{
+				ClusterID: []float64{clusterID},
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, resp.ListOfPolicies...)
+		if len(resp.ListOfPolicies) < polPerPage {
+			return policies, nil
+		}
+	}
+}
+
+// uploadPolicy uploads the policies of options.File to a cluster, or to a
+// namespace of the cluster
+func uploadPolicy(ctx context.Context, c *client.Client, options ClusterPolicyOptions, in io.Reader, out io.Writer) error {
+	data, err := os.ReadFile(options.File)
+	if err != nil {
+		return fmt.Errorf("failed to read policy file: %v", err)
+	}
+	names, err := policyNames(data)
+	if err != nil {
+		return fmt.Errorf("invalid policy file %s: %v", options.File, err)
+	}
+
+	cluster, err := findCluster(ctx, c, options.ClusterListJQ, options.ClusterName)
+	if err != nil {
+		return err
+	}
+
+	target := "cluster " + cluster.ClusterName
+	if options.Namespace != "" {
+		target = fmt.Sprintf("namespace %s of cluster %s", options.Namespace, cluster.ClusterName)
+	}
+	msg := fmt.Sprintf("upload %s to %s", strings.Join(names, ", "), target)
+	if ok, err := approve(options.DryRun, options.Yes, in, out, msg); !ok || err != nil {
+		return err
+	}
+
+	resp, err := c.UploadPolicy(ctx, client.PolicyUploadRequest{
+		ClusterID: []float64{cluster.ID},
+		Namespace: options.Namespace,
+		YAML:      string(data),
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Uploaded %s to %s\n", strings.Join(names, ", "), target)
+	if resp.Message != "" {
+		fmt.Fprintln(out, resp.Message)
+	}
+	return nil
+}
+
+// policyNames checks that every document of a policy file has a kind and a
+// name and returns them as kind/name
+func policyNames(data []byte) ([]string, error) {
+	var names []string
+	for i, doc := range yamlDocSeparator.Split(string(data), -1) {
+		if strings.TrimSpace(doc) == "" {
+			continue
+		}
+		var policy struct {
+			Kind     string `json:"kind"`
+			Metadata struct {
+				Name string `json:"name"`
+			} `json:"metadata"`
+		}
+		if err := yaml.Unmarshal([]byte(doc), &policy); err != nil {
+			return nil, fmt.Errorf("document %d: %v", i+1, err)
+		}
+		if policy.Kind == "" || policy.Metadata.Name == "" {
+			return nil, fmt.Errorf("document %d: kind and metadata.name are required", i+1)
+		}
+		names = append(names, policy.Kind+"/"+policy.Metadata.Name)
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no policy found")
+	}
+	return names, nil
+}
+
+// setPolicyAction sets spec.action of a policy and returns the updated YAML
+// and the previous action
+func setPolicyAction(policyYAML, action string) (string, string, error) {
+	var policy map[string]interface{}
+	if err := yaml.Unmarshal([]byte(policyYAML), &policy); err != nil {
+		return "", "", fmt.Errorf("error parsing policy: %v", err)
+	}
+	spec, ok := policy["spec"].(map[string]interface{})
+	if !ok {
+		return "", "", fmt.Errorf("policy has no spec")
+	}
+	previous, ok := spec["action"].(string)
+	if !ok {
+		return "", "", fmt.Errorf("policy has no spec.action, only Audit/Block policies are supported")
+	}
+	if previous == action {
+		return policyYAML, previous, nil
+	}
+
+	spec["action"] = action
+	data, err := yaml.Marshal(policy)
+	if err != nil {
+		return "", "", fmt.Errorf("error marshaling policy: %v", err)
+	}
+	return string(data), previous, nil
+}
+
+func printPolicyHistory(out io.Writer, history *client.PolicyHistory, jsonFormat bool) error {
+	if jsonFormat {
+		data, err := json.Marshal(history.Raw)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(out, string(data))
+		return nil
+	}
+
+	if len(history.Versions) == 0 {
+		fmt.Fprintln(out, "No history available...")
+		return nil
+	}
+	table := tablewriter.NewWriter(out)
+	table.SetHeader([]string{"Version", "Updated At", "Updated By", "Status", "Comment"})
+	for _, v := range history.Versions {
+		table.Append([]string{strconv.Itoa(v.Version), v.UpdatedAt, v.UpdatedBy, v.Status, v.Comment})
+	}
+	table.Render()
+	return nil
+}
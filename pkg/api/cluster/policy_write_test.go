@@ -0,0 +1,169 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/accuknox/accuknox-cli-v2/pkg/api/client"
+)
+
+const testPolicyYAML = `apiVersion: security.kubearmor.com/v1
+kind: KubeArmorPolicy
+metadata:
+  name: block-crypto
+  namespace: shop
+spec:
+  action: Audit
+  process:
+    matchPaths:
+    - path: /usr/bin/xmrig
+`
+
+func TestSetPolicyAction(t *testing.T) {
+	updated, previous, err := setPolicyAction(testPolicyYAML, "Block")
+	if err != nil {
+		t.Fatalf("setPolicyAction() error = %v", err)
+	}
+	if previous != "Audit" || !strings.Contains(updated, "action: Block") || !strings.Contains(updated, "path: /usr/bin/xmrig") {
+		t.Errorf("unexpected update from %s:\n%s", previous, updated)
+	}
+
+	if _, _, err := setPolicyAction("kind: NetworkPolicy\nspec:\n  podSelector: {}\n", "Block"); err == nil {
+		t.Errorf("policy without spec.action should fail")
+	}
+}
+
+func TestPolicyNames(t *testing.T) {
+	names, err := policyNames([]byte(testPolicyYAML + "---\nkind: KubeArmorHostPolicy\nmetadata:\n  name: host\n---\n"))
+	if err != nil {
+		t.Fatalf("policyNames() error = %v", err)
+	}
+	if strings.Join(names, ",") != "KubeArmorPolicy/block-crypto,KubeArmorHostPolicy/host" {
+		t.Errorf("unexpected names %v", names)
+	}
+
+	if _, err := policyNames([]byte("kind: KubeArmorPolicy\n")); err == nil {
+		t.Errorf("policy without a name should fail")
+	}
+}
+
+func TestManagePolicy(t *testing.T) {
+	var requests []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/get-onboarded-clusters"):
+			fmt.Fprint(w, `[{"ID":7,"ClusterName":"prod"}]`)
+		case strings.HasSuffix(r.URL.Path, "/list-policy"):
+			fmt.Fprint(w, `{"list_of_policies":[{"policy_id":42,"name":"block-crypto","namespace_name":"shop"},{"policy_id":43,"name":"block-crypto","namespace_name":"cart"}]}`)
+		case r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/policy/42"):
+			fmt.Fprintf(w, `{"yaml":%q}`, testPolicyYAML)
+		case r.Method == http.MethodPut:
+			if !strings.Contains(string(body), "action: Block") {
+				t.Errorf("unexpected update %s", body)
+			}
+		case strings.HasSuffix(r.URL.Path, "/upload-policy"):
+			if !strings.Contains(string(body), `"cluster_id":[7]`) || !strings.Contains(string(body), `"namespace":"shop"`) {
+				t.Errorf("unexpected upload %s", body)
+			}
+			fmt.Fprint(w, `{"policy_id":[44]}`)
+		case strings.HasSuffix(r.URL.Path, "/history"):
+			fmt.Fprint(w, `{"versions":[{"version":2,"updated_by":"ci","status":"active"},{"version":1,"updated_by":"alice"}]}`)
+		}
+	}))
+	defer srv.Close()
+	c := client.New(srv.URL, srv.URL, "token", "1", client.WithRetries(0, 0))
+
+	file := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := os.WriteFile(file, []byte(testPolicyYAML), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		options ClusterPolicyOptions
+		input   string
+		want    string
+		calls   []string
+		wantErr string
+	}{
+		{
+			name:    "ambiguous name",
+			options: ClusterPolicyOptions{Operation: PolicyOpDelete, ClusterName: "prod", PolicyName: "block-crypto"},
+			calls:   []string{"GET /cluster-onboarding/api/v1/get-onboarded-clusters", "POST /policymanagement/v2/list-policy"},
+			wantErr: "several namespaces (shop, cart)",
+		},
+		{
+			name:    "dry run does not change the policy",
+			options: ClusterPolicyOptions{Operation: PolicyOpSetAction, Action: "block", ClusterName: "prod", Namespace: "shop", PolicyName: "block-crypto", DryRun: true},
+			want:    "Dry run: would change the action of policy block-crypto (42) from Audit to Block",
+			calls:   []string{"GET /cluster-onboarding/api/v1/get-onboarded-clusters", "POST /policymanagement/v2/list-policy", "GET /policymanagement/v2/policy/42"},
+		},
+		{
+			name:    "confirmed",
+			options: ClusterPolicyOptions{Operation: PolicyOpSetAction, Action: "Block", PolicyID: "42"},
+			input:   "y\n",
+			want:    "Policy 42 is now in Block mode",
+			calls:   []string{"GET /policymanagement/v2/policy/42", "PUT /policymanagement/v2/policy/42"},
+		},
+		{
+			name:    "cancelled",
+			options: ClusterPolicyOptions{Operation: PolicyOpDelete, PolicyID: "42"},
+			input:   "n\n",
+			want:    "Operation cancelled.",
+		},
+		{
+			name:    "yes skips the confirmation",
+			options: ClusterPolicyOptions{Operation: PolicyOpDeactivate, PolicyID: "42", Yes: true},
+			want:    "Policy 42 is now inactive",
+			calls:   []string{"POST /policymanagement/v2/update-policy-status"},
+		},
+		{
+			name:    "upload",
+			options: ClusterPolicyOptions{Operation: PolicyOpUpload, File: file, ClusterName: "prod", Namespace: "shop", Yes: true},
+			want:    "Uploaded KubeArmorPolicy/block-crypto to namespace shop of cluster prod",
+			calls:   []string{"GET /cluster-onboarding/api/v1/get-onboarded-clusters", "POST /policymanagement/v2/upload-policy"},
+		},
+		{
+			name:    "history",
+			options: ClusterPolicyOptions{Operation: PolicyOpHistory, PolicyID: "42"},
+			want:    "alice",
+			calls:   []string{"GET /policymanagement/v2/policy/42/history"},
+		},
+		{
+			name:    "invalid action",
+			options: ClusterPolicyOptions{Operation: PolicyOpSetAction, Action: "Allow", PolicyID: "42"},
+			wantErr: "must be Audit or Block",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests = nil
+			var out bytes.Buffer
+			err := managePolicy(context.Background(), c, tt.options, strings.NewReader(tt.input), &out)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("managePolicy() error = %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("managePolicy() error = %v", err)
+			}
+			if !strings.Contains(out.String(), tt.want) {
+				t.Errorf("output %q does not contain %q", out.String(), tt.want)
+			}
+			if strings.Join(requests, ",") != strings.Join(tt.calls, ",") {
+				t.Errorf("requests = %v, want %v", requests, tt.calls)
+			}
+		})
+	}
+}
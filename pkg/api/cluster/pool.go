@@ -0,0 +1,78 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/olekukonko/tablewriter"
+)
+
+// DefaultConcurrency is the default number of clusters fetched in parallel
+const DefaultConcurrency = 8
+
+// clusterResult is the outcome of fetching the data of a cluster
+type clusterResult[T any] struct {
+	Cluster Cluster
+	Value   T
+	Err     error
+}
+
+// forEachCluster calls fn for every cluster with at most concurrency calls
+// running at once. The results are in the order of the clusters, whatever
+// the order the calls finish in. Clusters not yet started when ctx is
+// cancelled fail with the context error.
+func forEachCluster[T any](ctx context.Context, clusters []Cluster, concurrency int, fn func(context.Context, Cluster) (T, error)) []clusterResult[T] {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	results := make([]clusterResult[T], len(clusters))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, cluster := range clusters {
+		results[i].Cluster = cluster
+		if err := ctx.Err(); err != nil {
+			results[i].Err = err
+			continue
+		}
+
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			results[i].Err = ctx.Err()
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, cluster Cluster) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i].Value, results[i].Err = fn(ctx, cluster)
+		}(i, cluster)
+	}
+	wg.Wait()
+	return results
+}
+
+// clusterErrors prints a summary of the clusters which could not be fetched
+// and returns an error if there are any
+func clusterErrors[T any](w io.Writer, results []clusterResult[T]) error {
+	var failed [][]string
+	for _, r := range results {
+		if r.Err != nil {
+			failed = append(failed, []string{r.Cluster.ClusterName, r.Err.Error()})
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+
+	fmt.Fprintf(w, "\nFailed to fetch %d of %d clusters:\n", len(failed), len(results))
+	table := tablewriter.NewWriter(w)
+	table.SetHeader([]string{"Cluster", "Error"})
+	table.AppendBulk(failed)
+	table.Render()
+	return fmt.Errorf("failed to fetch %d of %d clusters", len(failed), len(results))
+}
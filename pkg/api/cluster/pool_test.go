@@ -0,0 +1,68 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestForEachCluster(t *testing.T) {
+	var clusters []Cluster
+	for _, name := range []string{"a", "b", "c", "d", "e", "f"} {
+		clusters = append(clusters, Cluster{ClusterName: name})
+	}
+
+	var running, peak int32
+	results := forEachCluster(context.Background(), clusters, 2, func(ctx context.Context, cluster Cluster) (string, error) {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		// later clusters finish first
+		time.Sleep(time.Duration('g'-cluster.ClusterName[0]) * time.Millisecond)
+		if cluster.ClusterName == "c" {
+			return "", errors.New("forbidden")
+		}
+		return strings.ToUpper(cluster.ClusterName), nil
+	})
+
+	if peak > 2 {
+		t.Errorf("%d clusters fetched in parallel, want at most 2", peak)
+	}
+	var got []string
+	for _, r := range results {
+		got = append(got, r.Cluster.ClusterName+"="+r.Value)
+	}
+	if strings.Join(got, ",") != "a=A,b=B,c=,d=D,e=E,f=F" {
+		t.Errorf("results = %v, want the cluster order", got)
+	}
+
+	var out bytes.Buffer
+	err := clusterErrors(&out, results)
+	if err == nil || err.Error() != "failed to fetch 1 of 6 clusters" {
+		t.Errorf("clusterErrors() = %v", err)
+	}
+	if !strings.Contains(out.String(), "forbidden") {
+		t.Errorf("summary is missing the error:\n%s", out.String())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	results = forEachCluster(ctx, clusters, 1, func(ctx context.Context, cluster Cluster) (string, error) {
+		t.Errorf("cluster %s fetched after cancel", cluster.ClusterName)
+		return "", nil
+	})
+	for _, r := range results {
+		if !errors.Is(r.Err, context.Canceled) {
+			t.Errorf("cluster %s error = %v, want context.Canceled", r.Cluster.ClusterName, r.Err)
+		}
+	}
+}
@@ -0,0 +1,574 @@
+package cluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/accuknox/accuknox-cli-v2/pkg/api/client"
+)
+
+var AlertQueryDescription = `
+Queries compare alert fields with values and are combined with and, or, not and parentheses:
+
+  severity>=5 and hostname~"store.*" and operation=File
+  (namespace=shop or namespace=cart) and not action=Audit
+
+Operators: = != ~ (regex) !~ > >= < <= (the last four for numeric fields only)
+Fields: ` + alertQueryFields() + `
+
+Equality conditions are sent to the API, the complete query is always checked again on the fetched alerts.
+`
+
+// alertField is a field of the alerts which can be filtered on
+type alertField struct {
+	name    string
+	numeric bool
+}
+
+// alertFields maps the lower case field names accepted in queries and
+// filters to the fields of the alerts
+var alertFields = map[string]alertField{
+	"action":        {name: "Action"},
+	"cluster":       {name: "ClusterName"},
+	"clustername":   {name: "ClusterName"},
+	"container":     {name: "ContainerName"},
+	"containername": {name: "ContainerName"},
+	"hostname":      {name: "HostName"},
+	"host":          {name: "HostName"},
+	"image":         {name: "ContainerImage"},
+	"labels":        {name: "Labels"},
+	"namespace":     {name: "NamespaceName"},
+	"namespacename": {name: "NamespaceName"},
+	"operation":     {name: "Operation"},
+	"pod":           {name: "PodName"},
+	"podname":       {name: "PodName"},
+	"policy":        {name: "PolicyName"},
+	"policyname":    {name: "PolicyName"},
+	"processname":   {name: "ProcessName"},
+	"resource":      {name: "Resource"},
+	"result":        {name: "Result"},
+	"severity":      {name: "Severity", numeric: true},
+	"source":        {name: "Source"},
+	"tags":          {name: "Tags"},
+	"timestamp":     {name: "Timestamp", numeric: true},
+	"type":          {name: "Type"},
+	"uid":           {name: "UID"},
+}
+
+// alertQueryFields returns the field names accepted in queries
+func alertQueryFields() string {
+	var names []string
+	for name := range alertFields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+func lookupAlertField(name string) (alertField, error) {
+	field, ok := alertFields[strings.ToLower(name)]
+	if !ok {
+		for _, f := range alertFields {
+			// the API names are accepted as well
+			if f.name == name {
+				return f, nil
+			}
+		}
+		return alertField{}, fmt.Errorf("unknown field %q, valid fields are: %s", name, alertQueryFields())
+	}
+	return field, nil
+}
+
+// queryExpr is a node of a parsed query
+type queryExpr interface {
+	match(alert map[string]interface{}) bool
+}
+
+type andExpr struct{ left, right queryExpr }
+type orExpr struct{ left, right queryExpr }
+type notExpr struct{ expr queryExpr }
+
+type compareExpr struct {
+	field  alertField
+	op     string
+	value  string
+	number float64
+	regex  *regexp.Regexp
+}
+
+func (e andExpr) match(alert map[string]interface{}) bool {
+	return e.left.match(alert) && e.right.match(alert)
+}
+
+func (e orExpr) match(alert map[string]interface{}) bool {
+	return e.left.match(alert) || e.right.match(alert)
+}
+
+func (e notExpr) match(alert map[string]interface{}) bool {
+	return !e.expr.match(alert)
+}
+
+func (e compareExpr) match(alert map[string]interface{}) bool {
+	value := fieldString(alert[e.field.name])
+
+	switch e.op {
+	case "=":
+		return strings.EqualFold(value, e.value)
+	case "!=":
+		return !strings.EqualFold(value, e.value)
+	case "~":
+		return e.regex.MatchString(value)
+	case "!~":
+		return !e.regex.MatchString(value)
+	}
+
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return false
+	}
+	switch e.op {
+	case ">":
+		return n > e.number
+	case ">=":
+		return n >= e.number
+	case "<":
+		return n < e.number
+	case "<=":
+		return n <= e.number
+	}
+	return false
+}
+
+// fieldString returns the value of an alert field as string, lists are
+// joined by commas
+func fieldString(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case []interface{}:
+		var items []string
+		for _, item := range v {
+			items = append(items, fieldString(item))
+		}
+		return strings.Join(items, ",")
+	default:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+}
+
+var queryOps = []string{">=", "<=", "!=", "!~", "=", "~", ">", "<"}
+
+type queryToken struct {
+	kind  string // ident, op, string, (, ), and, or, not
+	value string
+	pos   int
+}
+
+func tokenizeQuery(query string) ([]queryToken, error) {
+	var tokens []queryToken
+	for i := 0; i < len(query); {
+		c := rune(query[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '(' || c == ')':
+			tokens = append(tokens, queryToken{kind: string(c), pos: i})
+			i++
+		case strings.HasPrefix(query[i:], "&&"):
+			tokens = append(tokens, queryToken{kind: "and", pos: i})
+			i += 2
+		case strings.HasPrefix(query[i:], "||"):
+			tokens = append(tokens, queryToken{kind: "or", pos: i})
+			i += 2
+		case c == '"' || c == '\'':
+			end := i + 1
+			var sb strings.Builder
+			for ; end < len(query) && rune(query[end]) != c; end++ {
+				if query[end] == '\\' && end+1 < len(query) && rune(query[end+1]) == c {
+					end++
+				}
+				sb.WriteByte(query[end])
+			}
+			if end >= len(query) {
+				return nil, fmt.Errorf("unterminated string at position %d", i)
+			}
+			tokens = append(tokens, queryToken{kind: "string", value: sb.String(), pos: i})
+			i = end + 1
+		default:
+			if op := queryOpAt(query[i:]); op != "" {
+				tokens = append(tokens, queryToken{kind: "op", value: op, pos: i})
+				i += len(op)
+				continue
+			}
+			if c == '!' {
+				tokens = append(tokens, queryToken{kind: "not", pos: i})
+				i++
+				continue
+			}
+			end := i
+			for end < len(query) && !unicode.IsSpace(rune(query[end])) && !strings.ContainsRune("()\"'", rune(query[end])) && queryOpAt(query[end:]) == "" {
+				end++
+			}
+			word := query[i:end]
+			switch strings.ToLower(word) {
+			case "and", "or", "not":
+				tokens = append(tokens, queryToken{kind: strings.ToLower(word), pos: i})
+			default:
+				tokens = append(tokens, queryToken{kind: "ident", value: word, pos: i})
+			}
+			i = end
+		}
+	}
+	return tokens, nil
+}
+
+func queryOpAt(s string) string {
+	for _, op := range queryOps {
+		if strings.HasPrefix(s, op) {
+			return op
+		}
+	}
+	return ""
+}
+
+type queryParser struct {
+	tokens []queryToken
+	pos    int
+}
+
+// parseAlertQuery parses a query such as
+// `severity>=5 and hostname~"store.*" and operation=File`
+func parseAlertQuery(query string) (queryExpr, error) {
+	tokens, err := tokenizeQuery(query)
+	if err != nil {
+		return nil, fmt.Errorf("invalid query: %v", err)
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("invalid query: empty query")
+	}
+
+	p := &queryParser{tokens: tokens}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, fmt.Errorf("invalid query: %v", err)
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("invalid query: unexpected %s at position %d", p.describe(), p.tokens[p.pos].pos)
+	}
+	return expr, nil
+}
+
+func (p *queryParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos].kind
+	}
+	return ""
+}
+
+func (p *queryParser) describe() string {
+	if p.pos >= len(p.tokens) {
+		return "end of query"
+	}
+	t := p.tokens[p.pos]
+	if t.value != "" {
+		return fmt.Sprintf("%q", t.value)
+	}
+	return fmt.Sprintf("%q", t.kind)
+}
+
+func (p *queryParser) parseOr() (queryExpr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "or" {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orExpr{left, right}
+	}
+	return left, nil
+}
+
+func (p *queryParser) parseAnd() (queryExpr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "and" {
+		p.pos++
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = andExpr{left, right}
+	}
+	return left, nil
+}
+
+func (p *queryParser) parseNot() (queryExpr, error) {
+	switch p.peek() {
+	case "not":
+		p.pos++
+		expr, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return notExpr{expr}, nil
+	case "(":
+		p.pos++
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, fmt.Errorf("expected \")\", got %s", p.describe())
+		}
+		p.pos++
+		return expr, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *queryParser) parseComparison() (queryExpr, error) {
+	if p.peek() != "ident" {
+		return nil, fmt.Errorf("expected a field, got %s", p.describe())
+	}
+	name := p.tokens[p.pos].value
+	field, err := lookupAlertField(name)
+	if err != nil {
+		return nil, err
+	}
+	p.pos++
+
+	if p.peek() != "op" {
+		return nil, fmt.Errorf("expected an operator after %q, got %s", name, p.describe())
+	}
+	op := p.tokens[p.pos].value
+	p.pos++
+
+	if kind := p.peek(); kind != "ident" && kind != "string" {
+		return nil, fmt.Errorf("expected a value after %s%s, got %s", name, op, p.describe())
+	}
+	value := p.tokens[p.pos].value
+	p.pos++
+
+	expr := compareExpr{field: field, op: op, value: value}
+	switch op {
+	case "~", "!~":
+		if expr.regex, err = regexp.Compile(value); err != nil {
+			return nil, fmt.Errorf("invalid regular expression %q: %v", value, err)
+		}
+	case ">", ">=", "<", "<=":
+		if !field.numeric {
+			return nil, fmt.Errorf("operator %s is not supported by field %q", op, name)
+		}
+		if expr.number, err = strconv.ParseFloat(value, 64); err != nil {
+			return nil, fmt.Errorf("%q is not a number", value)
+		}
+	}
+	return expr, nil
+}
+
+// maxQueryBranches limits the number of requests sent for a query with or
+const maxQueryBranches = 8
+
+// apiFilters returns the API filters for the query in disjunctive normal
+// form, one filter list per request. Only equality is sent to the API,
+// queries with not are filtered on the client only.
+func apiFilters(expr queryExpr) [][]FilterField {
+	branches := dnf(expr)
+	if branches == nil || len(branches) > maxQueryBranches {
+		return [][]FilterField{{}}
+	}
+
+	var filters [][]FilterField
+	for _, branch := range branches {
+		var conj []FilterField
+		for _, c := range branch {
+			if c.op == "=" {
+				conj = append(conj, FilterField{Field: c.field.name, Value: c.value, Op: "match"})
+			}
+		}
+		if len(conj) == 0 {
+			// this branch needs every alert anyway
+			return [][]FilterField{{}}
+		}
+		filters = append(filters, conj)
+	}
+	return filters
+}
+
+// dnf returns the comparisons of every and-branch of the expression, or nil
+// if the expression contains not
+func dnf(expr queryExpr) [][]compareExpr {
+	switch e := expr.(type) {
+	case compareExpr:
+		return [][]compareExpr{{e}}
+	case orExpr:
+		left, right := dnf(e.left), dnf(e.right)
+		if left == nil || right == nil {
+			return nil
+		}
+		return append(left, right...)
+	case andExpr:
+		left, right := dnf(e.left), dnf(e.right)
+		if left == nil || right == nil {
+			return nil
+		}
+		var branches [][]compareExpr
+		for _, l := range left {
+			for _, r := range right {
+				branch := append(append([]compareExpr{}, l...), r...)
+				branches = append(branches, branch)
+			}
+		}
+		return branches
+	}
+	return nil
+}
+
+// alertQuery is what is sent to the API for the alerts options, the API
+// filters of every request and the query checked on the fetched alerts
+type alertQuery struct {
+	requests [][]FilterField
+	expr     queryExpr
+}
+
+func (q *alertQuery) match(alert client.Alert) bool {
+	return q.expr == nil || q.expr.match(alert.Raw)
+}
+
+// ValidateAlertOptions checks the filters, the query and the statistics
+// groups of the alerts options, before any request is sent
+func ValidateAlertOptions(options ClusterALertOptions) error {
+	if _, err := buildAlertQuery(options); err != nil {
+		return err
+	}
+	if options.Stats {
+		if options.Follow || len(options.Sink.Sinks) > 0 {
+			return fmt.Errorf("--stats cannot be used with --follow or --sink")
+		}
+		if _, err := computeAlertStats(nil, options.StatsGroupBy, options.StatsTop); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// buildAlertQuery combines the --filters, --filters-op and --query options
+func buildAlertQuery(options ClusterALertOptions) (*alertQuery, error) {
+	filters, err := parseAlertFilters(options.Filters)
+	if err != nil {
+		return nil, err
+	}
+
+	var requests [][]FilterField
+	switch strings.ToLower(options.FiltersOp) {
+	case "", "and":
+		requests = [][]FilterField{filters}
+	case "or":
+		for _, f := range filters {
+			requests = append(requests, []FilterField{f})
+		}
+		if len(requests) == 0 {
+			requests = [][]FilterField{{}}
+		}
+	default:
+		return nil, fmt.Errorf("invalid filters operator %q, must be and or or", options.FiltersOp)
+	}
+
+	q := &alertQuery{requests: requests}
+	if options.Query == "" {
+		return q, nil
+	}
+
+	q.expr, err = parseAlertQuery(options.Query)
+	if err != nil {
+		return nil, err
+	}
+
+	// every request of the filters is combined with every branch of the query
+	var combined [][]FilterField
+	for _, r := range requests {
+		for _, b := range apiFilters(q.expr) {
+			combined = append(combined, append(append([]FilterField{}, r...), b...))
+		}
+	}
+	if len(combined) > maxQueryBranches {
+		combined = requests
+	}
+	q.requests = combined
+	return q, nil
+}
+
+// alertFilterOps are the operators of the --filters objects supported by the
+// alerts API
+var alertFilterOps = []string{"match", "notmatch"}
+
+// parseAlertFilters parses the --filters flag, a filter object or a list of
+// filter objects
+func parseAlertFilters(value string) ([]FilterField, error) {
+	filters := []FilterField{}
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return filters, nil
+	}
+
+	if strings.HasPrefix(value, "[") {
+		if err := json.Unmarshal([]byte(value), &filters); err != nil {
+			return nil, fmt.Errorf("invalid filters format: %v", err)
+		}
+	} else {
+		var filter FilterField
+		if err := json.Unmarshal([]byte(value), &filter); err != nil {
+			return nil, fmt.Errorf("invalid filters format: %v", err)
+		}
+		filters = append(filters, filter)
+	}
+
+	for i, f := range filters {
+		field, err := lookupAlertField(f.Field)
+		if err != nil {
+			return nil, fmt.Errorf("invalid filter: %v", err)
+		}
+		if f.Op == "" {
+			return nil, fmt.Errorf("invalid filter: missing op for field %q", f.Field)
+		}
+		if !slices.Contains(alertFilterOps, f.Op) {
+			return nil, fmt.Errorf("invalid filter: unsupported op %q for field %q, supported ops are %s", f.Op, f.Field, strings.Join(alertFilterOps, ", "))
+		}
+		filters[i].Field = field.name
+	}
+	return filters, nil
+}
+
+// ParseSince parses relative time windows such as 30m, 6h or 7d
+func ParseSince(value string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid time window %q", value)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid time window %q, e.g. 30m, 6h or 7d", value)
+	}
+	return d, nil
+}
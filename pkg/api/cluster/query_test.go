@@ -0,0 +1,195 @@
+package cluster
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseAlertQuery(t *testing.T) {
+	alerts := map[string]map[string]interface{}{
+		"store-file":  {"UID": "1", "Severity": "7", "HostName": "store-1", "Operation": "File", "NamespaceName": "shop"},
+		"store-proc":  {"UID": "2", "Severity": float64(3), "HostName": "store-2", "Operation": "Process", "NamespaceName": "shop"},
+		"db-file":     {"UID": "3", "Severity": "9", "HostName": "db", "Operation": "File", "NamespaceName": "cart", "Action": "Audit"},
+		"no-severity": {"UID": "4", "HostName": "store-3", "Operation": "File"},
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{`severity>=5 and hostname~"store.*" and operation=File`, []string{"store-file"}},
+		{`operation=file`, []string{"db-file", "no-severity", "store-file"}},
+		{`severity < 5 || host = db`, []string{"db-file", "store-proc"}},
+		{`(namespace=shop or namespace=cart) and not action=Audit`, []string{"store-file", "store-proc"}},
+		{`hostname!~'^store' && !(severity>8)`, nil},
+		{`Severity>=9`, []string{"db-file"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			expr, err := parseAlertQuery(tt.query)
+			if err != nil {
+				t.Fatalf("parseAlertQuery() error = %v", err)
+			}
+			var got []string
+			for name, alert := range alerts {
+				if expr.match(alert) {
+					got = append(got, name)
+				}
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("query matched %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseAlertQueryErrors(t *testing.T) {
+	tests := map[string]string{
+		`colour=red`:                "unknown field",
+		`hostname>5`:                "not supported by field",
+		`severity>=high`:            "not a number",
+		`hostname~"store("`:         "invalid regular expression",
+		`severity>=5 and`:           "expected a field",
+		`(severity>=5`:              `expected ")"`,
+		`hostname="store`:           "unterminated string",
+		`severity 5`:                "expected an operator",
+		`severity>=5 hostname=db`:   "unexpected",
+		`operation=File or or x=1`:  "expected a field",
+		`hostname=store severity=5`: "unexpected",
+	}
+
+	for query, want := range tests {
+		_, err := parseAlertQuery(query)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("parseAlertQuery(%q) error = %v, want %q", query, err, want)
+		}
+	}
+}
+
+func TestBuildAlertQuery(t *testing.T) {
+	tests := []struct {
+		name    string
+		options ClusterALertOptions
+		want    [][]FilterField
+		wantErr string
+	}{
+		{
+			name:    "no filters",
+			options: ClusterALertOptions{},
+			want:    [][]FilterField{{}},
+		},
+		{
+			name:    "and filters",
+			options: ClusterALertOptions{Filters: `[{"field":"hostname","value":"a","op":"match"},{"field":"PodName","value":"b","op":"match"}]`},
+			want:    [][]FilterField{{{Field: "HostName", Value: "a", Op: "match"}, {Field: "PodName", Value: "b", Op: "match"}}},
+		},
+		{
+			name:    "or filters",
+			options: ClusterALertOptions{FiltersOp: "or", Filters: `[{"field":"HostName","value":"a","op":"match"},{"field":"HostName","value":"b","op":"match"}]`},
+			want:    [][]FilterField{{{Field: "HostName", Value: "a", Op: "match"}}, {{Field: "HostName", Value: "b", Op: "match"}}},
+		},
+		{
+			name:    "query branches",
+			options: ClusterALertOptions{Query: `operation=File and (host=a or host=b) and severity>=5`},
+			want: [][]FilterField{
+				{{Field: "Operation", Value: "File", Op: "match"}, {Field: "HostName", Value: "a", Op: "match"}},
+				{{Field: "Operation", Value: "File", Op: "match"}, {Field: "HostName", Value: "b", Op: "match"}},
+			},
+		},
+		{
+			name:    "query with not is filtered on the client",
+			options: ClusterALertOptions{Query: `not host=a`},
+			want:    [][]FilterField{{}},
+		},
+		{
+			name:    "branch without equality fetches everything",
+			options: ClusterALertOptions{Query: `host=a or severity>5`},
+			want:    [][]FilterField{{}},
+		},
+		{
+			name:    "unknown filter field",
+			options: ClusterALertOptions{Filters: `{"field":"colour","value":"red","op":"match"}`},
+			wantErr: "unknown field",
+		},
+		{
+			name:    "missing op",
+			options: ClusterALertOptions{Filters: `{"field":"HostName","value":"a"}`},
+			wantErr: "missing op",
+		},
+		{
+			name:    "invalid filters op",
+			options: ClusterALertOptions{FiltersOp: "xor"},
+			wantErr: "invalid filters operator",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := buildAlertQuery(tt.options)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("buildAlertQuery() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("buildAlertQuery() error = %v", err)
+			}
+			if !reflect.DeepEqual(q.requests, tt.want) {
+				t.Errorf("requests = %v, want %v", q.requests, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseAlertFilters(t *testing.T) {
+	tests := []struct {
+		name    string
+		filters string
+		wantErr string
+	}{
+		{name: "match", filters: `{"field":"HostName","value":"a","op":"match"}`},
+		{name: "notmatch", filters: `[{"field":"HostName","value":"a","op":"notmatch"}]`},
+		{name: "equals", filters: `{"field":"HostName","value":"a","op":"eq"}`, wantErr: `unsupported op "eq"`},
+		{name: "regex", filters: `{"field":"HostName","value":"a.*","op":"regex"}`, wantErr: "supported ops are match, notmatch"},
+		{name: "wrong case", filters: `[{"field":"HostName","value":"a","op":"match"},{"field":"PodName","value":"b","op":"Match"}]`, wantErr: `unsupported op "Match" for field "PodName"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseAlertFilters(tt.filters)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("parseAlertFilters() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("parseAlertFilters() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseSince(t *testing.T) {
+	tests := map[string]time.Duration{
+		"30m": 30 * time.Minute,
+		"6h":  6 * time.Hour,
+		"7d":  7 * 24 * time.Hour,
+	}
+	for value, want := range tests {
+		if got, err := ParseSince(value); err != nil || got != want {
+			t.Errorf("ParseSince(%q) = %v, %v, want %v", value, got, err, want)
+		}
+	}
+	for _, value := range []string{"", "6", "-1h", "xd"} {
+		if _, err := ParseSince(value); err == nil {
+			t.Errorf("ParseSince(%q) should fail", value)
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package cluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/olekukonko/tablewriter"
+)
+
+const (
+	DefaultStatsTop = 10
+	histogramWidth  = 50
+	maxBuckets      = 30
+)
+
+// statsDimensions are the fields alerts can be grouped by, in display order
+var statsDimensions = []struct {
+	name  string
+	field string
+}{
+	{"cluster", "ClusterName"},
+	{"namespace", "NamespaceName"},
+	{"policy", "PolicyName"},
+	{"severity", "Severity"},
+	{"operation", "Operation"},
+	{"host", "HostName"},
+}
+
+// StatsDimensions returns the names of the dimensions alerts can be grouped by
+func StatsDimensions() []string {
+	var names []string
+	for _, d := range statsDimensions {
+		names = append(names, d.name)
+	}
+	return names
+}
+
+// GroupStats is the number of alerts sharing a value of a dimension
+type GroupStats struct {
+	Value     string    `json:"value"`
+	Count     int       `json:"count"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// HistogramBucket counts the alerts raised in [Start, Start+bucket size)
+type HistogramBucket struct {
+	Start time.Time `json:"start"`
+	Count int       `json:"count"`
+}
+
+// Histogram of the alerts over time
+type Histogram struct {
+	BucketSize string            `json:"bucket_size"`
+	Buckets    []HistogramBucket `json:"buckets"`
+}
+
+// AlertStats aggregates the fetched alerts
+type AlertStats struct {
+	Total     int                     `json:"total"`
+	FirstSeen time.Time               `json:"first_seen"`
+	LastSeen  time.Time               `json:"last_seen"`
+	Groups    map[string][]GroupStats `json:"groups"`
+	Histogram Histogram               `json:"histogram"`
+}
+
+// computeAlertStats groups the alerts by the given dimensions and keeps the
+// top N values of every dimension, top <= 0 keeps every value
+func computeAlertStats(results []interface{}, groupBy []string, top int) (*AlertStats, error) {
+	dimensions := make(map[string]string)
+	for _, name := range groupBy {
+		found := false
+		for _, d := range statsDimensions {
+			if d.name == strings.ToLower(strings.TrimSpace(name)) {
+				dimensions[d.name] = d.field
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("invalid group %q, must be one of %s", name, strings.Join(StatsDimensions(), ", "))
+		}
+	}
+
+	stats := &AlertStats{Groups: make(map[string][]GroupStats)}
+	groups := make(map[string]map[string]*GroupStats)
+	var times []time.Time
+
+	for _, result := range results {
+		alert, ok := result.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		stats.Total++
+
+		var ts time.Time
+		if v, err := strconv.ParseFloat(fieldString(alert["Timestamp"]), 64); err == nil && v > 0 {
+			ts = time.Unix(int64(v), 0).UTC()
+			times = append(times, ts)
+			if stats.FirstSeen.IsZero() || ts.Before(stats.FirstSeen) {
+				stats.FirstSeen = ts
+			}
+			if ts.After(stats.LastSeen) {
+				stats.LastSeen = ts
+			}
+		}
+
+		for name, field := range dimensions {
+			value := fieldString(alert[field])
+			if value == "" {
+				value = "(none)"
+			}
+			if groups[name] == nil {
+				groups[name] = make(map[string]*GroupStats)
+			}
+			g := groups[name][value]
+			if g == nil {
+				g = &GroupStats{Value: value}
+				groups[name][value] = g
+			}
+			g.Count++
+			if !ts.IsZero() {
+				if g.FirstSeen.IsZero() || ts.Before(g.FirstSeen) {
+					g.FirstSeen = ts
+				}
+				if ts.After(g.LastSeen) {
+					g.LastSeen = ts
+				}
+			}
+		}
+	}
+
+	for name, values := range groups {
+		var list []GroupStats
+		for _, g := range values {
+			list = append(list, *g)
+		}
+		sort.Slice(list, func(i, j int) bool {
+			if list[i].Count != list[j].Count {
+				return list[i].Count > list[j].Count
+			}
+			return list[i].Value < list[j].Value
+		})
+		if top > 0 && len(list) > top {
+			list = list[:top]
+		}
+		stats.Groups[name] = list
+	}
+
+	stats.Histogram = histogram(times, stats.FirstSeen, stats.LastSeen)
+	return stats, nil
+}
+
+// bucketSizes are the candidate sizes of the histogram buckets
+var bucketSizes = []time.Duration{
+	time.Minute, 5 * time.Minute, 15 * time.Minute, 30 * time.Minute,
+	time.Hour, 3 * time.Hour, 6 * time.Hour, 12 * time.Hour,
+	24 * time.Hour, 7 * 24 * time.Hour,
+}
+
+// histogram counts the alerts in buckets of the smallest size which needs at
+// most maxBuckets buckets for the time range
+func histogram(times []time.Time, first, last time.Time) Histogram {
+	if len(times) == 0 {
+		return Histogram{}
+	}
+
+	size := bucketSizes[len(bucketSizes)-1]
+	for _, s := range bucketSizes {
+		if last.Truncate(s).Sub(first.Truncate(s))/s < maxBuckets {
+			size = s
+			break
+		}
+	}
+
+	start := first.Truncate(size)
+	n := int(last.Truncate(size).Sub(start)/size) + 1
+	h := Histogram{BucketSize: formatBucketSize(size), Buckets: make([]HistogramBucket, n)}
+	for i := range h.Buckets {
+		h.Buckets[i].Start = start.Add(time.Duration(i) * size)
+	}
+	for _, ts := range times {
+		i := int(ts.Sub(start) / size)
+		if i >= 0 && i < n {
+			h.Buckets[i].Count++
+		}
+	}
+	return h
+}
+
+func formatBucketSize(d time.Duration) string {
+	switch {
+	case d%(24*time.Hour) == 0:
+		return fmt.Sprintf("%dd", d/(24*time.Hour))
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	default:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	}
+}
+
+func printAlertStatsJSON(w io.Writer, stats *AlertStats) error {
+	data, err := json.MarshalIndent(stats, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(w, string(data))
+	return nil
+}
+
+func printAlertStats(w io.Writer, stats *AlertStats) {
+	fmt.Fprintf(w, "\nTotal alerts: %d", stats.Total)
+	if !stats.FirstSeen.IsZero() {
+		fmt.Fprintf(w, " (first seen %s, last seen %s)", formatStatsTime(stats.FirstSeen), formatStatsTime(stats.LastSeen))
+	}
+	fmt.Fprintln(w)
+
+	for _, d := range statsDimensions {
+		list, ok := stats.Groups[d.name]
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(w, "\nTop %s:\n", d.name)
+		table := tablewriter.NewWriter(w)
+		table.SetHeader([]string{strings.ToUpper(d.name), "Count", "First seen", "Last seen"})
+		for _, g := range list {
+			table.Append([]string{g.Value, strconv.Itoa(g.Count), formatStatsTime(g.FirstSeen), formatStatsTime(g.LastSeen)})
+		}
+		table.Render()
+	}
+
+	if len(stats.Histogram.Buckets) > 0 {
+		fmt.Fprintf(w, "\nAlerts per %s:\n", stats.Histogram.BucketSize)
+		printHistogram(w, stats.Histogram)
+	}
+}
+
+func printHistogram(w io.Writer, h Histogram) {
+	maxCount := 0
+	for _, b := range h.Buckets {
+		if b.Count > maxCount {
+			maxCount = b.Count
+		}
+	}
+	for _, b := range h.Buckets {
+		bar := 0
+		if maxCount > 0 {
+			bar = b.Count * histogramWidth / maxCount
+		}
+		if bar == 0 && b.Count > 0 {
+			bar = 1
+		}
+		fmt.Fprintf(w, "%s | %s%s %d\n", formatStatsTime(b.Start), strings.Repeat("█", bar), strings.Repeat(" ", histogramWidth-bar), b.Count)
+	}
+}
+
+func formatStatsTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format("2006-01-02 15:04")
+}
@@ -0,0 +1,62 @@
+package cluster
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestComputeAlertStats(t *testing.T) {
+	base := float64(time.Date(2024, 10, 14, 6, 0, 0, 0, time.UTC).Unix())
+	results := []interface{}{
+		map[string]interface{}{"ClusterName": "prod", "NamespaceName": "shop", "Severity": "8", "Timestamp": base},
+		map[string]interface{}{"ClusterName": "prod", "NamespaceName": "shop", "Severity": "8", "Timestamp": base + 3600},
+		map[string]interface{}{"ClusterName": "prod", "NamespaceName": "cart", "Severity": "5", "Timestamp": base + 7200},
+		map[string]interface{}{"ClusterName": "dev", "Severity": "2", "Timestamp": base + 7300},
+		"not an alert",
+	}
+
+	stats, err := computeAlertStats(results, []string{"cluster", "namespace"}, 1)
+	if err != nil {
+		t.Fatalf("computeAlertStats() error = %v", err)
+	}
+
+	if stats.Total != 4 {
+		t.Errorf("total = %d, want 4", stats.Total)
+	}
+	if _, ok := stats.Groups["severity"]; ok {
+		t.Errorf("severity was not requested")
+	}
+
+	cluster := stats.Groups["cluster"]
+	if len(cluster) != 1 || cluster[0].Value != "prod" || cluster[0].Count != 3 {
+		t.Fatalf("unexpected top cluster %+v", cluster)
+	}
+	if cluster[0].FirstSeen.Unix() != int64(base) || cluster[0].LastSeen.Unix() != int64(base+7200) {
+		t.Errorf("unexpected first/last seen %+v", cluster[0])
+	}
+	if ns := stats.Groups["namespace"]; ns[0].Value != "shop" || ns[0].Count != 2 {
+		t.Errorf("unexpected top namespace %+v", ns)
+	}
+
+	h := stats.Histogram
+	if h.BucketSize != "5m" || len(h.Buckets) != 25 {
+		t.Fatalf("unexpected histogram %s with %d buckets", h.BucketSize, len(h.Buckets))
+	}
+	if h.Buckets[0].Count != 1 || h.Buckets[12].Count != 1 || h.Buckets[24].Count != 2 {
+		t.Errorf("unexpected histogram counts %+v", h.Buckets)
+	}
+
+	var buf bytes.Buffer
+	printAlertStats(&buf, stats)
+	for _, want := range []string{"Total alerts: 4", "Top cluster:", "Top namespace:", "Alerts per 5m:", "█ 2"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("output is missing %q:\n%s", want, buf.String())
+		}
+	}
+
+	if _, err := computeAlertStats(results, []string{"colour"}, 0); err == nil {
+		t.Errorf("unknown group should fail")
+	}
+}
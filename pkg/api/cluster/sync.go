@@ -0,0 +1,515 @@
+package cluster
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/accuknox/accuknox-cli-v2/pkg/api/client"
+	"github.com/olekukonko/tablewriter"
+	"sigs.k8s.io/yaml"
+)
+
+const ClusterPolicySyncDescription = `
+1. knoxctl api cluster policy sync --dir policies --dry-run
+... show what would change between the policies/<cluster>/<namespace>/<name>.yaml tree and the SaaS
+
+2. knoxctl api cluster policy sync --dir policies --clusterName prod --prefer local --yes
+... sync the policies of cluster prod without asking for a confirmation, local changes win over SaaS changes
+
+The directory uses the layout written by "api cluster policy --operation dump", cluster-wide policies are stored
+as <cluster>/<name>.yaml. The state of the last sync is kept in <dir>/` + SyncLockFile + `, a change on one side only
+is applied to the other side, a change on both sides is a conflict which is skipped unless --prefer is given.
+`
+
+// SyncLockFile stores the policies as they were after the last sync
+const SyncLockFile = ".knoxctl-policy.lock"
+
+// Sync operations
+const (
+	syncCreate   = "create"
+	syncUpdate   = "update"
+	syncDelete   = "delete"
+	syncConflict = "conflict"
+)
+
+// Sync sides
+const (
+	syncLocal  = "local"
+	syncRemote = "remote"
+)
+
+type PolicySyncOptions struct {
+	Dir           string
+	ClusterListJQ string
+	ClusterName   string
+	Prefer        string
+	DryRun        bool
+	Yes           bool
+	Concurrency   int
+}
+
+// syncPolicy is a policy on one side of the sync
+type syncPolicy struct {
+	Cluster   string
+	Namespace string
+	Name      string
+	YAML      string
+	Hash      string
+	// ID of a remote policy, Path of a local one relative to the directory
+	ID   string
+	Path string
+}
+
+func (p *syncPolicy) key() string {
+	return syncKey(p.Cluster, p.Namespace, p.Name)
+}
+
+func syncKey(cluster, namespace, name string) string {
+	return cluster + "/" + namespace + "/" + name
+}
+
+// lockEntry is a policy as it was after the last sync
+type lockEntry struct {
+	PolicyID string `json:"policy_id"`
+	Hash     string `json:"hash"`
+}
+
+type syncLock struct {
+	SyncedAt time.Time            `json:"synced_at"`
+	Policies map[string]lockEntry `json:"policies"`
+}
+
+// syncAction is a change of the plan. Target is the side changed by the
+// action, the content is taken from the other side.
+type syncAction struct {
+	Key    string
+	Op     string
+	Target string
+	Local  *syncPolicy
+	Remote *syncPolicy
+}
+
+// policyHash hashes the normalized content of a policy, so that formatting
+// and key order do not count as changes
+func policyHash(policyYAML string) (string, error) {
+	var policy interface{}
+	if err := yaml.Unmarshal([]byte(policyYAML), &policy); err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(policy)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// loadLocalPolicies reads <dir>/<cluster>[/<namespace>]/<name>.yaml
+func loadLocalPolicies(dir string, clusters map[string]bool) (map[string]*syncPolicy, error) {
+	policies := make(map[string]*syncPolicy)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".") {
+			return nil
+		}
+		ext := filepath.Ext(path)
+		if ext != ".yaml" && ext != ".yml" {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		parts := strings.Split(filepath.ToSlash(rel), "/")
+		p := &syncPolicy{Cluster: parts[0], Name: strings.TrimSuffix(parts[len(parts)-1], ext), Path: rel}
+		switch len(parts) {
+		case 2:
+		case 3:
+			p.Namespace = parts[1]
+		default:
+			fmt.Fprintf(os.Stderr, "Skipping %s, expected <cluster>/[<namespace>/]<name>.yaml\n", rel)
+			return nil
+		}
+		if !clusters[p.Cluster] {
+			return nil
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %v", rel, err)
+		}
+		p.YAML = string(data)
+		if p.Hash, err = policyHash(p.YAML); err != nil {
+			return fmt.Errorf("invalid policy %s: %v", rel, err)
+		}
+		policies[p.key()] = p
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return policies, nil
+	}
+	return policies, err
+}
+
+// fetchRemotePolicies fetches the YAML of every policy of the clusters
+func fetchRemotePolicies(ctx context.Context, c *client.Client, clusters []Cluster, concurrency int) (map[string]*syncPolicy, error) {
+	results := forEachCluster(ctx, clusters, concurrency, func(ctx context.Context, cluster Cluster) ([]*syncPolicy, error) {
+		summaries, err := listClusterPolicies(ctx, c, cluster.ID)
+		if err != nil {
+			return nil, err
+		}
+		var policies []*syncPolicy
+		for _, s := range summaries {
+			id := strconv.FormatFloat(s.PolicyID, 'f', -1, 64)
+			policy, err := c.GetPolicy(ctx, id)
+			if err != nil {
+				return nil, err
+			}
+			if policy.YAML == "" {
+				continue
+			}
+			p := &syncPolicy{Cluster: cluster.ClusterName, Namespace: s.Namespace, Name: s.Name, YAML: policy.YAML, ID: id}
+			if p.Hash, err = policyHash(p.YAML); err != nil {
+				return nil, fmt.Errorf("invalid policy %s: %v", p.key(), err)
+			}
+			policies = append(policies, p)
+		}
+		return policies, nil
+	})
+
+	// a partial remote state would plan deletions, so any failure aborts
+	if err := clusterErrors(os.Stderr, results); err != nil {
+		return nil, err
+	}
+	policies := make(map[string]*syncPolicy)
+	for _, r := range results {
+		for _, p := range r.Value {
+			policies[p.key()] = p
+		}
+	}
+	return policies, nil
+}
+
+// planSync computes the three-way difference between the local and remote
+// policies and their state after the last sync
+func planSync(local, remote map[string]*syncPolicy, lock map[string]lockEntry, prefer string) []syncAction {
+	keys := make(map[string]bool)
+	for key := range local {
+		keys[key] = true
+	}
+	for key := range remote {
+		keys[key] = true
+	}
+	for key := range lock {
+		keys[key] = true
+	}
+
+	var plan []syncAction
+	for key := range keys {
+		l, r := local[key], remote[key]
+		base, synced := lock[key]
+		a := syncAction{Key: key, Local: l, Remote: r}
+
+		switch {
+		case l == nil && r == nil:
+			continue
+		case l != nil && r != nil:
+			switch {
+			case l.Hash == r.Hash:
+				continue
+			case synced && l.Hash == base.Hash:
+				a.Op, a.Target = syncUpdate, syncLocal
+			case synced && r.Hash == base.Hash:
+				a.Op, a.Target = syncUpdate, syncRemote
+			default:
+				a.Op = syncConflict
+			}
+		case r == nil:
+			switch {
+			case !synced:
+				a.Op, a.Target = syncCreate, syncRemote
+			case l.Hash == base.Hash:
+				a.Op, a.Target = syncDelete, syncLocal
+			default:
+				a.Op = syncConflict
+			}
+		default:
+			switch {
+			case !synced:
+				a.Op, a.Target = syncCreate, syncLocal
+			case r.Hash == base.Hash:
+				a.Op, a.Target = syncDelete, syncRemote
+			default:
+				a.Op = syncConflict
+			}
+		}
+
+		if a.Op == syncConflict && prefer != "" {
+			a = resolveConflict(a, prefer)
+		}
+		plan = append(plan, a)
+	}
+
+	sort.Slice(plan, func(i, j int) bool { return plan[i].Key < plan[j].Key })
+	return plan
+}
+
+// resolveConflict makes the preferred side win
+func resolveConflict(a syncAction, prefer string) syncAction {
+	source, target := a.Local, syncRemote
+	if prefer == syncRemote {
+		source, target = a.Remote, syncLocal
+	}
+	a.Target = target
+	switch {
+	case source == nil:
+		a.Op = syncDelete
+	case (target == syncRemote && a.Remote == nil) || (target == syncLocal && a.Local == nil):
+		a.Op = syncCreate
+	default:
+		a.Op = syncUpdate
+	}
+	return a
+}
+
+func printSyncPlan(out io.Writer, plan []syncAction) {
+	table := tablewriter.NewWriter(out)
+	table.SetHeader([]string{"Policy", "Operation", "Target"})
+	for _, a := range plan {
+		table.Append([]string{a.Key, a.Op, a.Target})
+	}
+	table.Render()
+}
+
+func loadSyncLock(path string) (*syncLock, error) {
+	lock := &syncLock{Policies: make(map[string]lockEntry)}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return lock, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading lock file: %v", err)
+	}
+	if err := json.Unmarshal(data, lock); err != nil {
+		return nil, fmt.Errorf("invalid lock file %s: %v", path, err)
+	}
+	if lock.Policies == nil {
+		lock.Policies = make(map[string]lockEntry)
+	}
+	return lock, nil
+}
+
+func (lock *syncLock) save(path string) error {
+	data, err := json.MarshalIndent(lock, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("error writing lock file: %v", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// SyncPolicies syncs a local policy directory with the policies of the
+// selected clusters
+func SyncPolicies(ctx context.Context, c *client.Client, options PolicySyncOptions) error {
+	return syncPolicies(ctx, c, options, os.Stdin, os.Stdout)
+}
+
+func syncPolicies(ctx context.Context, c *client.Client, options PolicySyncOptions, in io.Reader, out io.Writer) error {
+	if options.Dir == "" {
+		return fmt.Errorf("--dir is required")
+	}
+	if options.Prefer != "" && options.Prefer != syncLocal && options.Prefer != syncRemote {
+		return fmt.Errorf("invalid --prefer %q, must be local or remote", options.Prefer)
+	}
+	if options.ClusterListJQ == "" {
+		options.ClusterListJQ = ".[]"
+	}
+
+	_, allClusters, err := fetchClusters(ctx, c, options.ClusterListJQ)
+	if err != nil {
+		return err
+	}
+	var clusters []Cluster
+	inScope := make(map[string]bool)
+	clusterIDs := make(map[string]float64)
+	for _, cluster := range allClusters {
+		if options.ClusterName != "" && cluster.ClusterName != options.ClusterName {
+			continue
+		}
+		clusters = append(clusters, cluster)
+		inScope[cluster.ClusterName] = true
+		clusterIDs[cluster.ClusterName] = cluster.ID
+	}
+	if len(clusters) == 0 {
+		fmt.Fprintln(out, "No clusters found matching the provided criteria.")
+		return nil
+	}
+
+	local, err := loadLocalPolicies(options.Dir, inScope)
+	if err != nil {
+		return err
+	}
+	remote, err := fetchRemotePolicies(ctx, c, clusters, options.Concurrency)
+	if err != nil {
+		return err
+	}
+	lockPath := filepath.Join(options.Dir, SyncLockFile)
+	lock, err := loadSyncLock(lockPath)
+	if err != nil {
+		return err
+	}
+
+	// policies of clusters which are not synced keep their lock entries
+	scopedLock := make(map[string]lockEntry)
+	for key, entry := range lock.Policies {
+		if inScope[strings.SplitN(key, "/", 2)[0]] {
+			scopedLock[key] = entry
+		}
+	}
+
+	plan := planSync(local, remote, scopedLock, options.Prefer)
+	conflicts := 0
+	for _, a := range plan {
+		if a.Op == syncConflict {
+			conflicts++
+		}
+	}
+	if len(plan) == 0 {
+		fmt.Fprintln(out, "Policies are in sync.")
+	} else {
+		printSyncPlan(out, plan)
+	}
+
+	apply := len(plan) > conflicts
+	if apply {
+		msg := fmt.Sprintf("apply %d changes", len(plan)-conflicts)
+		if apply, err = approve(options.DryRun, options.Yes, in, out, msg); err != nil {
+			return err
+		}
+		// the lock file is only written once the changes were applied
+		if !apply {
+			return nil
+		}
+	}
+	if options.DryRun {
+		return nil
+	}
+
+	failed := 0
+	if apply {
+		for _, a := range plan {
+			if a.Op == syncConflict {
+				continue
+			}
+			if err := applySyncAction(ctx, c, options.Dir, clusterIDs, a, local, remote); err != nil {
+				fmt.Fprintf(os.Stderr, "Error syncing %s: %v\n", a.Key, err)
+				failed++
+				continue
+			}
+			fmt.Fprintf(out, "%s %s %s\n", a.Target, a.Op, a.Key)
+		}
+	}
+
+	// a policy is synced when both sides agree, conflicting and failed
+	// policies keep their previous lock entry
+	for key := range scopedLock {
+		delete(lock.Policies, key)
+	}
+	for key, l := range local {
+		if r := remote[key]; r != nil && r.Hash == l.Hash {
+			lock.Policies[key] = lockEntry{PolicyID: r.ID, Hash: l.Hash}
+		} else if entry, ok := scopedLock[key]; ok {
+			lock.Policies[key] = entry
+		}
+	}
+	for key, entry := range scopedLock {
+		if _, ok := lock.Policies[key]; !ok && (local[key] != nil || remote[key] != nil) {
+			lock.Policies[key] = entry
+		}
+	}
+	lock.SyncedAt = time.Now().UTC()
+	if err := lock.save(lockPath); err != nil {
+		return err
+	}
+
+	if conflicts > 0 || failed > 0 {
+		return fmt.Errorf("%d conflicts and %d failed changes left, use --prefer local|remote to resolve conflicts", conflicts, failed)
+	}
+	return nil
+}
+
+// applySyncAction applies a change and updates the local and remote sets to
+// the new state
+func applySyncAction(ctx context.Context, c *client.Client, dir string, clusterIDs map[string]float64, a syncAction, local, remote map[string]*syncPolicy) error {
+	switch a.Target {
+	case syncLocal:
+		if a.Op == syncDelete {
+			if err := os.Remove(filepath.Join(dir, a.Local.Path)); err != nil {
+				return err
+			}
+			delete(local, a.Key)
+			return nil
+		}
+		pulled := *a.Remote
+		pulled.Path = filepath.Join(a.Remote.Cluster, a.Remote.Namespace, a.Remote.Name+".yaml")
+		if a.Local != nil {
+			pulled.Path = a.Local.Path
+		}
+		path := filepath.Join(dir, pulled.Path)
+		if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, []byte(pulled.YAML), 0600); err != nil {
+			return err
+		}
+		local[a.Key] = &pulled
+
+	case syncRemote:
+		switch a.Op {
+		case syncCreate:
+			resp, err := c.UploadPolicy(ctx, client.PolicyUploadRequest{
+				ClusterID: []float64{clusterIDs[a.Local.Cluster]},
+				Namespace: a.Local.Namespace,
+				YAML:      a.Local.YAML,
+			})
+			if err != nil {
+				return err
+			}
+			created := *a.Local
+			if len(resp.PolicyIDs) > 0 {
+				created.ID = strconv.FormatFloat(resp.PolicyIDs[0], 'f', -1, 64)
+			}
+			remote[a.Key] = &created
+		case syncUpdate:
+			if err := c.UpdatePolicy(ctx, a.Remote.ID, a.Local.YAML); err != nil {
+				return err
+			}
+			updated := *a.Local
+			updated.ID = a.Remote.ID
+			remote[a.Key] = &updated
+		case syncDelete:
+			if err := c.DeletePolicy(ctx, a.Remote.ID); err != nil {
+				return err
+			}
+			delete(remote, a.Key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/accuknox/accuknox-cli-v2/pkg/api/client"
+)
+
+func testSyncPolicy(name, content string) *syncPolicy {
+	hash, _ := policyHash(content)
+	return &syncPolicy{Cluster: "prod", Namespace: "shop", Name: name, YAML: content, Hash: hash, ID: name}
+}
+
+func TestPlanSync(t *testing.T) {
+	v1, v2, v3 := "kind: P\nspec: {action: Audit}\n", "kind: P\nspec:\n  action: Block\n", "kind: P\nspec: {action: Allow}\n"
+	base := func(content string) lockEntry {
+		hash, _ := policyHash(content)
+		return lockEntry{Hash: hash}
+	}
+
+	local := map[string]*syncPolicy{}
+	remote := map[string]*syncPolicy{}
+	lock := map[string]lockEntry{}
+	set := func(m map[string]*syncPolicy, name, content string) {
+		p := testSyncPolicy(name, content)
+		m[p.key()] = p
+	}
+
+	set(local, "new-local", v1)
+	set(remote, "new-remote", v1)
+	set(local, "same", v1)
+	set(remote, "same", "kind: P\nspec:\n  action: Audit\n")
+	set(local, "changed-local", v2)
+	set(remote, "changed-local", v1)
+	lock["prod/shop/changed-local"] = base(v1)
+	set(local, "changed-remote", v1)
+	set(remote, "changed-remote", v2)
+	lock["prod/shop/changed-remote"] = base(v1)
+	set(remote, "deleted-local", v1)
+	lock["prod/shop/deleted-local"] = base(v1)
+	set(local, "deleted-remote", v1)
+	lock["prod/shop/deleted-remote"] = base(v1)
+	set(local, "both-changed", v2)
+	set(remote, "both-changed", v3)
+	lock["prod/shop/both-changed"] = base(v1)
+	set(local, "edited-deleted", v2)
+	lock["prod/shop/edited-deleted"] = base(v1)
+	lock["prod/shop/gone"] = base(v1)
+
+	var got []string
+	for _, a := range planSync(local, remote, lock, "") {
+		got = append(got, fmt.Sprintf("%s:%s:%s", strings.TrimPrefix(a.Key, "prod/shop/"), a.Op, a.Target))
+	}
+	want := []string{
+		"both-changed:conflict:",
+		"changed-local:update:remote",
+		"changed-remote:update:local",
+		"deleted-local:delete:remote",
+		"deleted-remote:delete:local",
+		"edited-deleted:conflict:",
+		"new-local:create:remote",
+		"new-remote:create:local",
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("plan = %v, want %v", got, want)
+	}
+
+	for prefer, want := range map[string]string{
+		syncLocal:  "both-changed:update:remote,edited-deleted:create:remote",
+		syncRemote: "both-changed:update:local,edited-deleted:delete:local",
+	} {
+		var got []string
+		for _, a := range planSync(local, remote, lock, prefer) {
+			if strings.Contains(a.Key, "both-changed") || strings.Contains(a.Key, "edited-deleted") {
+				got = append(got, fmt.Sprintf("%s:%s:%s", strings.TrimPrefix(a.Key, "prod/shop/"), a.Op, a.Target))
+			}
+		}
+		if strings.Join(got, ",") != want {
+			t.Errorf("prefer %s: plan = %v, want %s", prefer, got, want)
+		}
+	}
+}
+
+func TestSyncPolicies(t *testing.T) {
+	var mu sync.Mutex
+	remote := map[string]string{"1": "kind: P\nmetadata: {name: pulled}\n"}
+	names := map[string]string{"1": "pulled"}
+	var uploads []string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		body, _ := io.ReadAll(r.Body)
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/get-onboarded-clusters"):
+			fmt.Fprint(w, `[{"ID":7,"ClusterName":"prod"},{"ID":8,"ClusterName":"dev"}]`)
+		case strings.HasSuffix(r.URL.Path, "/list-policy"):
+			var list []map[string]interface{}
+			for id := range remote {
+				n, _ := strconv.Atoi(id)
+				list = append(list, map[string]interface{}{"policy_id": n, "name": names[id], "namespace_name": "shop"})
+			}
+			if !strings.Contains(string(body), `"cluster_id":[7]`) {
+				list = nil
+			}
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"list_of_policies": list})
+		case strings.HasSuffix(r.URL.Path, "/upload-policy"):
+			var req client.PolicyUploadRequest
+			_ = json.Unmarshal(body, &req)
+			uploads = append(uploads, req.Namespace)
+			remote["2"], names["2"] = req.YAML, "pushed"
+			fmt.Fprint(w, `{"policy_id":[2]}`)
+		case r.Method == http.MethodGet:
+			id := filepath.Base(r.URL.Path)
+			fmt.Fprintf(w, `{"yaml":%q}`, remote[id])
+		}
+	}))
+	defer srv.Close()
+	c := client.New(srv.URL, srv.URL, "token", "1", client.WithRetries(0, 0))
+
+	dir := t.TempDir()
+	pushed := filepath.Join(dir, "prod", "shop", "pushed.yaml")
+	if err := os.MkdirAll(filepath.Dir(pushed), 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(pushed, []byte("kind: P\nmetadata: {name: pushed}\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	options := PolicySyncOptions{Dir: dir, ClusterName: "prod", DryRun: true}
+	var out bytes.Buffer
+	if err := syncPolicies(context.Background(), c, options, nil, &out); err != nil {
+		t.Fatalf("dry run error = %v", err)
+	}
+	if len(uploads) != 0 || !strings.Contains(out.String(), "Dry run: would apply 2 changes") {
+		t.Fatalf("dry run changed the policies:\n%s", out.String())
+	}
+
+	options.DryRun = false
+	out.Reset()
+	if err := syncPolicies(context.Background(), c, options, strings.NewReader("n\n"), &out); err != nil {
+		t.Fatalf("declined sync error = %v", err)
+	}
+	if len(uploads) != 0 {
+		t.Fatalf("declined sync changed the policies:\n%s", out.String())
+	}
+	if _, err := os.Stat(filepath.Join(dir, SyncLockFile)); !os.IsNotExist(err) {
+		t.Errorf("declined sync wrote the lock file: %v", err)
+	}
+
+	out.Reset()
+	if err := syncPolicies(context.Background(), c, options, strings.NewReader("y\n"), &out); err != nil {
+		t.Fatalf("syncPolicies() error = %v\n%s", err, out.String())
+	}
+	if len(uploads) != 1 || uploads[0] != "shop" {
+		t.Errorf("unexpected uploads %v", uploads)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "prod", "shop", "pulled.yaml")); err != nil || !strings.Contains(string(data), "pulled") {
+		t.Errorf("pulled policy not written: %v", err)
+	}
+
+	lock, err := loadSyncLock(filepath.Join(dir, SyncLockFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lock.Policies["prod/shop/pushed"].PolicyID != "2" || lock.Policies["prod/shop/pulled"].PolicyID != "1" {
+		t.Errorf("unexpected lock %+v", lock.Policies)
+	}
+
+	out.Reset()
+	if err := syncPolicies(context.Background(), c, options, nil, &out); err != nil {
+		t.Fatalf("second sync error = %v", err)
+	}
+	if !strings.Contains(out.String(), "Policies are in sync.") {
+		t.Errorf("second sync is not empty:\n%s", out.String())
+	}
+}
@@ -0,0 +1,177 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	defaultMaxSize    = 10 << 20
+	defaultMaxBackups = 5
+)
+
+// fileSink writes alerts as JSON lines and rotates the file once it grows
+// over max-size, keeping max-backups old files as <path>.1, <path>.2, ...
+type fileSink struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+func newFileSink(u *url.URL) (*fileSink, error) {
+	path := u.Path
+	if u.Host != "" {
+		// file://relative/path
+		path = u.Host + u.Path
+	}
+	if path == "" {
+		return nil, fmt.Errorf("invalid sink %q: missing path", u.String())
+	}
+
+	s := &fileSink{
+		path:       filepath.Clean(path),
+		maxSize:    defaultMaxSize,
+		maxBackups: defaultMaxBackups,
+	}
+
+	query := u.Query()
+	if v := query.Get("max-size"); v != "" {
+		size, err := parseSize(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid max-size of sink %s: %v", u.String(), err)
+		}
+		s.maxSize = size
+	}
+	if v := query.Get("max-backups"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid max-backups of sink %s: %q", u.String(), v)
+		}
+		s.maxBackups = n
+	}
+	return s, nil
+}
+
+// parseSize parses sizes such as 512, 100KB or 10MB
+func parseSize(v string) (int64, error) {
+	units := []struct {
+		suffix string
+		size   int64
+	}{
+		{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1},
+	}
+
+	v = strings.ToUpper(strings.TrimSpace(v))
+	multiplier := int64(1)
+	for _, unit := range units {
+		if strings.HasSuffix(v, unit.suffix) {
+			v = strings.TrimSuffix(v, unit.suffix)
+			multiplier = unit.size
+			break
+		}
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size %q", v)
+	}
+	return n * multiplier, nil
+}
+
+func (s *fileSink) Name() string {
+	return "file://" + s.path
+}
+
+func (s *fileSink) open() error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0750); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	s.file = file
+	s.size = info.Size()
+	return nil
+}
+
+func (s *fileSink) rotate() error {
+	if err := s.file.Close(); err != nil {
+		return err
+	}
+	s.file = nil
+
+	if s.maxBackups == 0 {
+		return os.Remove(s.path)
+	}
+	for i := s.maxBackups - 1; i > 0; i-- {
+		old := fmt.Sprintf("%s.%d", s.path, i)
+		if _, err := os.Stat(old); err == nil {
+			if err := os.Rename(old, fmt.Sprintf("%s.%d", s.path, i+1)); err != nil {
+				return err
+			}
+		}
+	}
+	return os.Rename(s.path, s.path+".1")
+}
+
+func (s *fileSink) Send(_ context.Context, alerts []interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, alert := range alerts {
+		line, err := json.Marshal(alert)
+		if err != nil {
+			return err
+		}
+		line = append(line, '\n')
+
+		if s.file == nil {
+			if err := s.open(); err != nil {
+				return err
+			}
+		}
+		if s.size > 0 && s.size+int64(len(line)) > s.maxSize {
+			if err := s.rotate(); err != nil {
+				return fmt.Errorf("error rotating %s: %v", s.path, err)
+			}
+			if err := s.open(); err != nil {
+				return err
+			}
+		}
+
+		n, err := s.file.Write(line)
+		s.size += int64(n)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *fileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
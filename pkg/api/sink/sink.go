@@ -0,0 +1,230 @@
+// Package sink forwards alerts to syslog servers, webhooks and local files
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const SinkDescription = `
+Sinks are given as URLs, --sink can be repeated to forward alerts to several sinks:
+
+  syslog+udp://host:514              RFC5424 syslog over UDP
+  syslog+tcp://host:601              RFC5424 syslog over TCP, octet counted
+  syslog+tls://host:6514?ca=ca.pem   RFC5424 syslog over TLS, ?insecure=true skips verification
+  https://hooks.example.com/...      HTTP webhook, the body is rendered from --sink-template
+  file:///var/log/alerts.json        JSON lines file, ?max-size=10MB&max-backups=5 for rotation
+
+--sink-template is "slack", "teams" or the path of a Go text/template, which is executed with .Alerts and .Count.
+Alerts which could not be delivered after all retries are written to the --dead-letter file.
+`
+
+const (
+	DefaultBatchSize = 50
+	DefaultRetries   = 3
+	DefaultBackoff   = time.Second
+	DefaultTimeout   = 10 * time.Second
+)
+
+// Sink delivers batches of alerts. Alerts are the objects returned by the
+// alerts API, or whatever the jq filter made out of them.
+type Sink interface {
+	Name() string
+	Send(ctx context.Context, alerts []interface{}) error
+	Close() error
+}
+
+// Config of the forwarder
+type Config struct {
+	Sinks      []string
+	Template   string
+	BatchSize  int
+	Retries    int
+	Backoff    time.Duration
+	Timeout    time.Duration
+	DeadLetter string
+}
+
+// Forwarder splits alerts in batches and delivers them to every sink,
+// retrying failed deliveries
+type Forwarder struct {
+	sinks      []Sink
+	batchSize  int
+	retries    int
+	backoff    time.Duration
+	deadLetter string
+
+	mu sync.Mutex
+}
+
+// New parses the sink URLs and returns a forwarder for them
+func New(cfg Config) (*Forwarder, error) {
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = DefaultBatchSize
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+
+	f := &Forwarder{
+		batchSize:  cfg.BatchSize,
+		retries:    cfg.Retries,
+		backoff:    cfg.Backoff,
+		deadLetter: os.ExpandEnv(cfg.DeadLetter),
+	}
+	for _, spec := range cfg.Sinks {
+		s, err := Parse(spec, cfg)
+		if err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+		f.sinks = append(f.sinks, s)
+	}
+	return f, nil
+}
+
+// Parse returns the sink for the given URL
+func Parse(spec string, cfg Config) (Sink, error) {
+	u, err := url.Parse(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sink %q: %v", spec, err)
+	}
+
+	switch u.Scheme {
+	case "syslog+udp", "syslog+tcp", "syslog+tls":
+		return newSyslogSink(u, cfg.Timeout)
+	case "http", "https":
+		return newWebhookSink(u, cfg.Template, cfg.Timeout)
+	case "file":
+		return newFileSink(u)
+	default:
+		return nil, fmt.Errorf("invalid sink %q: unsupported scheme %q", spec, u.Scheme)
+	}
+}
+
+// Forward delivers the alerts to every sink. Batches which still fail after
+// all retries are written to the dead-letter file. The number of alerts
+// which could not be delivered is returned.
+func (f *Forwarder) Forward(ctx context.Context, alerts []interface{}) (int, error) {
+	failed := 0
+	for start := 0; start < len(alerts); start += f.batchSize {
+		end := start + f.batchSize
+		if end > len(alerts) {
+			end = len(alerts)
+		}
+		batch := alerts[start:end]
+
+		for _, s := range f.sinks {
+			err := f.send(ctx, s, batch)
+			if err == nil {
+				continue
+			}
+			if ctx.Err() != nil {
+				return failed, ctx.Err()
+			}
+
+			failed += len(batch)
+			fmt.Fprintf(os.Stderr, "Error forwarding %d alerts to %s: %v\n", len(batch), s.Name(), err)
+			if err := f.writeDeadLetter(s.Name(), err, batch); err != nil {
+				return failed, err
+			}
+		}
+	}
+	return failed, nil
+}
+
+func (f *Forwarder) send(ctx context.Context, s Sink, batch []interface{}) error {
+	var err error
+	for attempt := 0; attempt <= f.retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(f.backoff << (attempt - 1)):
+			}
+		}
+		if err = s.Send(ctx, batch); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// deadLetter is a record of the dead-letter file
+type deadLetter struct {
+	Time  time.Time   `json:"time"`
+	Sink  string      `json:"sink"`
+	Error string      `json:"error"`
+	Alert interface{} `json:"alert"`
+}
+
+func (f *Forwarder) writeDeadLetter(sink string, sendErr error, batch []interface{}) error {
+	if f.deadLetter == "" {
+		return nil
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(f.deadLetter), 0750); err != nil {
+		return fmt.Errorf("error creating dead-letter directory: %v", err)
+	}
+	file, err := os.OpenFile(filepath.Clean(f.deadLetter), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("error opening dead-letter file: %v", err)
+	}
+	defer file.Close()
+
+	enc := json.NewEncoder(file)
+	now := time.Now().UTC()
+	for _, alert := range batch {
+		if err := enc.Encode(deadLetter{Time: now, Sink: sink, Error: sendErr.Error(), Alert: alert}); err != nil {
+			return fmt.Errorf("error writing dead-letter file: %v", err)
+		}
+	}
+	return nil
+}
+
+// Close closes every sink
+func (f *Forwarder) Close() error {
+	var errs []string
+	for _, s := range f.sinks {
+		if err := s.Close(); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", s.Name(), err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("error closing sinks: %s", strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// alertField returns a field of an alert object as string
+func alertField(alert interface{}, key string) string {
+	m, ok := alert.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	switch v := m[key].(type) {
+	case string:
+		return v
+	case float64:
+		return fmt.Sprintf("%v", v)
+	}
+	return ""
+}
+
+// redact removes the credentials from a sink URL, so it can be logged
+func redact(u *url.URL) string {
+	c := *u
+	c.User = nil
+	c.RawQuery = ""
+	return c.String()
+}
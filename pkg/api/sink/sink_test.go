@@ -0,0 +1,265 @@
+package sink
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testAlerts() []interface{} {
+	return []interface{}{
+		map[string]interface{}{"UID": "1", "Timestamp": float64(1700000000), "ClusterName": "prod", "HostName": "store",
+			"NamespaceName": "shop", "PodName": "cart-1", "Severity": "8", "Operation": "File", "Resource": "/etc/shadow", "Action": "Block"},
+		map[string]interface{}{"UID": "2", "Timestamp": float64(1700000001), "ClusterName": "prod", "HostName": "db", "Severity": "2"},
+	}
+}
+
+func newTestForwarder(t *testing.T, sinks ...string) *Forwarder {
+	t.Helper()
+	f, err := New(Config{
+		Sinks:      sinks,
+		Retries:    1,
+		Backoff:    time.Millisecond,
+		Timeout:    time.Second,
+		DeadLetter: filepath.Join(t.TempDir(), "dead.jsonl"),
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	t.Cleanup(func() { _ = f.Close() })
+	return f
+}
+
+func TestFormatRFC5424(t *testing.T) {
+	msg := formatRFC5424(testAlerts()[0], "local")
+	want := `<131>1 2023-11-14T22:13:20Z store knoxctl - - [alert@32473 cluster="prod" namespace="shop" pod="cart-1" severity="8" operation="File" action="Block"] {`
+	if !strings.HasPrefix(msg, want) {
+		t.Errorf("formatRFC5424() =\n%s\nwant prefix\n%s", msg, want)
+	}
+
+	msg = formatRFC5424("plain text", "local host")
+	if !strings.Contains(msg, " localhost knoxctl - - - plain text") {
+		t.Errorf("unexpected message for a string alert: %s", msg)
+	}
+}
+
+func TestSyslogUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	f := newTestForwarder(t, "syslog+udp://"+conn.LocalAddr().String())
+	if failed, err := f.Forward(context.Background(), testAlerts()); failed != 0 || err != nil {
+		t.Fatalf("Forward() = %d, %v", failed, err)
+	}
+
+	buf := make([]byte, 4096)
+	for i := 0; i < 2; i++ {
+		_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("no syslog message received: %v", err)
+		}
+		if !strings.HasPrefix(string(buf[:n]), "<1") {
+			t.Errorf("unexpected message %q", buf[:n])
+		}
+	}
+}
+
+// readOctetCounted reads a message framed as "<length> <message>"
+func readOctetCounted(r *bufio.Reader) string {
+	length, err := r.ReadString(' ')
+	if err != nil {
+		return ""
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(length))
+	if err != nil {
+		return ""
+	}
+	msg := make([]byte, n)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return ""
+	}
+	return string(msg)
+}
+
+func TestSyslogTCPAndTLS(t *testing.T) {
+	tlsSrv := httptest.NewTLSServer(http.NotFoundHandler())
+	defer tlsSrv.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: tlsSrv.Certificate().Raw})
+	if err := os.WriteFile(caFile, caPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		listen func() (net.Listener, error)
+		sink   func(addr string) string
+	}{
+		{
+			name:   "tcp",
+			listen: func() (net.Listener, error) { return net.Listen("tcp", "127.0.0.1:0") },
+			sink:   func(addr string) string { return "syslog+tcp://" + addr },
+		},
+		{
+			name: "tls",
+			listen: func() (net.Listener, error) {
+				return tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: tlsSrv.TLS.Certificates, MinVersion: tls.VersionTLS12})
+			},
+			sink: func(addr string) string { return "syslog+tls://" + addr + "?ca=" + caFile },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ln, err := tt.listen()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer ln.Close()
+
+			received := make(chan []string, 1)
+			go func() {
+				conn, err := ln.Accept()
+				if err != nil {
+					return
+				}
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				received <- []string{readOctetCounted(r), readOctetCounted(r)}
+			}()
+
+			f := newTestForwarder(t, tt.sink(ln.Addr().String()))
+			if failed, err := f.Forward(context.Background(), testAlerts()); failed != 0 || err != nil {
+				t.Fatalf("Forward() = %d, %v", failed, err)
+			}
+
+			select {
+			case msgs := <-received:
+				if !strings.Contains(msgs[0], `"UID":"1"`) || !strings.Contains(msgs[1], `"UID":"2"`) {
+					t.Errorf("unexpected messages %q", msgs)
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatal("no syslog message received")
+			}
+		})
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	bodies := make(chan map[string]interface{}, 4)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		bodies <- body
+	}))
+	defer srv.Close()
+
+	for _, tmpl := range []string{"", "slack", "teams"} {
+		t.Run("template "+tmpl, func(t *testing.T) {
+			f, err := New(Config{Sinks: []string{srv.URL + "/hook/secret"}, Template: tmpl})
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			defer f.Close()
+
+			if failed, err := f.Forward(context.Background(), testAlerts()); failed != 0 || err != nil {
+				t.Fatalf("Forward() = %d, %v", failed, err)
+			}
+			body := <-bodies
+			switch tmpl {
+			case "":
+				if body["count"] != float64(2) {
+					t.Errorf("unexpected body %v", body)
+				}
+			case "slack":
+				if text, _ := body["text"].(string); !strings.Contains(text, "[8] prod shop/cart-1: File /etc/shadow (Block)") {
+					t.Errorf("unexpected slack body %v", body)
+				}
+			case "teams":
+				if body["@type"] != "MessageCard" || !strings.Contains(body["text"].(string), "<br>") {
+					t.Errorf("unexpected teams body %v", body)
+				}
+			}
+		})
+	}
+}
+
+func TestFileRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "alerts.json")
+	f := newTestForwarder(t, "file://"+path+"?max-size=300B&max-backups=2")
+
+	for i := 0; i < 4; i++ {
+		if failed, err := f.Forward(context.Background(), testAlerts()); failed != 0 || err != nil {
+			t.Fatalf("Forward() = %d, %v", failed, err)
+		}
+	}
+
+	for _, name := range []string{path, path + ".1", path + ".2"} {
+		info, err := os.Stat(name)
+		if err != nil {
+			t.Fatalf("missing file: %v", err)
+		}
+		if info.Size() > 300 {
+			t.Errorf("%s is larger than max-size: %d", name, info.Size())
+		}
+	}
+	if _, err := os.Stat(path + ".3"); err == nil {
+		t.Errorf("more backups than max-backups")
+	}
+}
+
+func TestDeadLetter(t *testing.T) {
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	f := newTestForwarder(t, srv.URL)
+	failed, err := f.Forward(context.Background(), testAlerts())
+	if err != nil || failed != 2 {
+		t.Fatalf("Forward() = %d, %v, want 2 failed alerts", failed, err)
+	}
+	if calls != 2 {
+		t.Errorf("got %d attempts, want 2", calls)
+	}
+
+	data, err := os.ReadFile(f.deadLetter)
+	if err != nil {
+		t.Fatalf("dead-letter file not written: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], "status code 503") {
+		t.Errorf("unexpected dead-letter file:\n%s", data)
+	}
+}
+
+func TestParse(t *testing.T) {
+	for _, spec := range []string{"ftp://host", "syslog+udp://", "file://", "https://host?x"} {
+		_, err := Parse(spec, Config{Template: "missing.tmpl"})
+		if err == nil {
+			t.Errorf("Parse(%q) should fail", spec)
+		}
+	}
+}
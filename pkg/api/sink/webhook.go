@@ -0,0 +1,151 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// templates for chat tools which expect a specific body
+var builtinTemplates = map[string]string{
+	"json":  `{"count": {{ .Count }}, "alerts": {{ json .Alerts }}}`,
+	"slack": `{"text": {{ printf "*%d AccuKnox alerts*\n%s" .Count (summary .Alerts) | json }}}`,
+	"teams": `{"@type": "MessageCard", "@context": "http://schema.org/extensions", ` +
+		`"summary": {{ printf "%d AccuKnox alerts" .Count | json }}, ` +
+		`"title": {{ printf "%d AccuKnox alerts" .Count | json }}, ` +
+		`"text": {{ summary .Alerts | replace "\n" "<br>" | json }}}`,
+}
+
+// webhookData is passed to the body template
+type webhookData struct {
+	Alerts []interface{}
+	Count  int
+}
+
+// webhookSink posts every batch of alerts as one request
+type webhookSink struct {
+	url      string
+	name     string
+	client   *http.Client
+	template *template.Template
+}
+
+func newWebhookSink(u *url.URL, tmpl string, timeout time.Duration) (*webhookSink, error) {
+	t, err := parseWebhookTemplate(tmpl)
+	if err != nil {
+		return nil, err
+	}
+	return &webhookSink{
+		url: u.String(),
+		// webhook URLs usually embed a secret, only log the host
+		name:     u.Scheme + "://" + u.Host,
+		client:   &http.Client{Timeout: timeout},
+		template: t,
+	}, nil
+}
+
+func parseWebhookTemplate(tmpl string) (*template.Template, error) {
+	funcs := template.FuncMap{
+		"json": func(v interface{}) (string, error) {
+			data, err := json.Marshal(v)
+			return string(data), err
+		},
+		"summary": summary,
+		"replace": func(old, new, s string) string {
+			return strings.ReplaceAll(s, old, new)
+		},
+	}
+
+	text, ok := builtinTemplates[tmpl]
+	if tmpl == "" {
+		text, ok = builtinTemplates["json"], true
+	}
+	if !ok {
+		data, err := os.ReadFile(filepath.Clean(tmpl))
+		if err != nil {
+			return nil, fmt.Errorf("error reading webhook template: %v", err)
+		}
+		text = string(data)
+	}
+
+	t, err := template.New("webhook").Funcs(funcs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid webhook template: %v", err)
+	}
+	return t, nil
+}
+
+// summary returns one line per alert
+func summary(alerts []interface{}) string {
+	var lines []string
+	for _, alert := range alerts {
+		if s, ok := alert.(string); ok {
+			lines = append(lines, s)
+			continue
+		}
+		workload := alertField(alert, "HostName")
+		if pod := alertField(alert, "PodName"); pod != "" {
+			workload = alertField(alert, "NamespaceName") + "/" + pod
+		}
+		lines = append(lines, fmt.Sprintf("[%s] %s %s: %s %s (%s)",
+			alertField(alert, "Severity"),
+			alertField(alert, "ClusterName"),
+			workload,
+			alertField(alert, "Operation"),
+			alertField(alert, "Resource"),
+			alertField(alert, "Action"),
+		))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (s *webhookSink) Name() string {
+	return s.name
+}
+
+func (s *webhookSink) Send(ctx context.Context, alerts []interface{}) error {
+	var body bytes.Buffer
+	if err := s.template.Execute(&body, webhookData{Alerts: alerts, Count: len(alerts)}); err != nil {
+		return fmt.Errorf("error rendering webhook body: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		// the error contains the URL, which may contain a secret
+		return fmt.Errorf("error posting to webhook: %v", unwrapURLError(err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, data)
+	}
+	return nil
+}
+
+func unwrapURLError(err error) error {
+	if urlErr, ok := err.(*url.Error); ok {
+		return urlErr.Err
+	}
+	return err
+}
+
+func (s *webhookSink) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
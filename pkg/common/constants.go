@@ -79,6 +79,8 @@ const (
 	MinDockerVersion                  = "v19.0.3"
 	MinDockerComposeVersion           = "v1.27.0"
 	MinDockerComposeWithWaitSupported = "v2.17.0"
+	MinPodmanComposeVersion           = "v1.0.6"
+	MinNerdctlVersion                 = "v1.7.0"
 
 	DownloadDir string = "/tmp/accuknox-downloads/"
 
@@ -132,12 +134,14 @@ const (
 	DefaultCAFileName      = "ca_certificate.pem"
 	DefaultCertificateName = "certificate.pem"
 	DefaultKeyFileName     = "key.pem"
+	DefaultCAKeyFileName   = "ca_key.pem"
 	DefaultEncodedFileName = "encoded.pem"
 	DefaultCACertDir       = "/cert"
 
 	SystemdKnoxctlDir     = "/opt/knoxctl"
 	KnoxctlConfigFilename = "knoxctl-config.json"
 	KnoxctlLogFilename    = "knoxctl.log"
+	OnboardStateFilename  = "onboard-state.json"
 )
 
 var (
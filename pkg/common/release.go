@@ -30,6 +30,9 @@ type ReleaseMetadata struct {
 	HardeningAgentImage   string `json:"hardening_agent_image"`
 	RraTag                string `json:"rra_tag"`
 	RraImage              string `json:"rra_image"`
+	// Digests are the digests of the agent artifacts of the release, by
+	// name and tag e.g. kubearmor-systemd:v1.5.0_linux-amd64
+	Digests map[string]string `json:"digests,omitempty"`
 }
 
 var (
@@ -82,11 +85,20 @@ func GetLatestReleaseInfoFromEmbedded() (string, ReleaseMetadata) {
 	return latestRelease, releaseInfo[latestRelease]
 }
 
+// EmbeddedReleaseInfo returns the release info shipped with knoxctl
+func EmbeddedReleaseInfo() map[string]ReleaseMetadata {
+	releaseInfo, err := unmarshal(releaseInfoFile)
+	if err != nil {
+		return map[string]ReleaseMetadata{}
+	}
+	return releaseInfo
+}
+
 func GetReleaseFromBackup(path, version string) (string, ReleaseMetadata) {
 
 	FileName := filepath.Join(filepath.Clean(path), "release.json.bak")
 
-	data, err := os.ReadFile(filepath.Clean(FileName))
+	data, err := ReadReleaseFile(FileName)
 	if err != nil {
 		return "", ReleaseMetadata{}
 	}
@@ -98,18 +110,21 @@ func GetReleaseFromBackup(path, version string) (string, ReleaseMetadata) {
 
 }
 
+// GetOrWriteReleaseInfo makes the given release file the one in use and
+// stores it with its signature in path. Without release file, the stored one
+// is verified and used, or the one shipped with knoxctl is stored.
 func GetOrWriteReleaseInfo(releaseFile, path string) (string, error) {
 
 	defaultFileName := filepath.Join(filepath.Clean(path), "release.json")
 
-	fileContent := releaseInfoFile
+	fileContent, signature := releaseInfoFile, releaseInfoSignature
 
 	if err := createDir(defaultFileName); err != nil {
 		return "", err
 	}
 
 	if releaseFile != "" {
-		data, err := os.ReadFile(filepath.Clean(releaseFile))
+		data, err := ReadReleaseFile(releaseFile)
 		if err != nil {
 			return "", err
 		}
@@ -117,18 +132,21 @@ func GetOrWriteReleaseInfo(releaseFile, path string) (string, error) {
 		if err != nil {
 			return "", err
 		}
+		signature, err = readReleaseSignature(releaseFile)
+		if err != nil {
+			return "", err
+		}
 		ReleaseInfo = releaseInfo
 		fileContent = data
-		bakFile := defaultFileName + ".bak"
 		if _, err := os.Stat(defaultFileName); err == nil {
-			if err := os.Rename(defaultFileName, bakFile); err != nil {
+			if err := MoveReleaseFile(defaultFileName, defaultFileName+".bak"); err != nil {
 				return "", err
 			}
 		}
 
 	} else {
 		if _, err := os.Stat(defaultFileName); err == nil {
-			data, err := os.ReadFile(filepath.Clean(defaultFileName))
+			data, err := ReadReleaseFile(defaultFileName)
 			if err != nil {
 				return "", err
 			}
@@ -141,7 +159,46 @@ func GetOrWriteReleaseInfo(releaseFile, path string) (string, error) {
 		}
 	}
 
-	return fmt.Sprintf("Release file written to %s", defaultFileName), os.WriteFile(defaultFileName, fileContent, 0o644) // #nosec G306
+	return fmt.Sprintf("Release file written to %s", defaultFileName), writeReleaseFile(defaultFileName, fileContent, signature)
+}
+
+// writeReleaseFile writes a release file and its signature, removing a stale
+// signature when there is none
+func writeReleaseFile(file string, data, sig []byte) error {
+	if err := os.WriteFile(file, data, 0o644); err != nil { // #nosec G306
+		return err
+	}
+	if sig == nil {
+		return removeFile(file + ReleaseSignatureExt)
+	}
+	return os.WriteFile(file+ReleaseSignatureExt, sig, 0o644) // #nosec G306
+}
+
+// MoveReleaseFile renames a release file along with its signature
+func MoveReleaseFile(from, to string) error {
+	if err := os.Rename(from, to); err != nil {
+		return err
+	}
+	err := os.Rename(from+ReleaseSignatureExt, to+ReleaseSignatureExt)
+	if os.IsNotExist(err) {
+		return removeFile(to + ReleaseSignatureExt)
+	}
+	return err
+}
+
+// RemoveReleaseFile removes a release file along with its signature
+func RemoveReleaseFile(file string) error {
+	if err := removeFile(file); err != nil {
+		return err
+	}
+	return removeFile(file + ReleaseSignatureExt)
+}
+
+func removeFile(file string) error {
+	if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
 }
 
 func createDir(path string) error {
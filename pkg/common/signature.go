@@ -0,0 +1,176 @@
+package common
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	_ "embed"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ReleaseSignatureExt is the extension of the signature stored next to a
+// release file
+const ReleaseSignatureExt = ".sig"
+
+var (
+	//go:embed release.pub
+	releasePublicKeys []byte
+
+	//go:embed release.json.sig
+	releaseInfoSignature []byte
+
+	// SkipReleaseVerification disables verifying the signature of release
+	// files and the digests of the agents
+	SkipReleaseVerification bool
+
+	// extraReleaseKeys are the keys trusted besides the embedded ones
+	extraReleaseKeys []ed25519.PublicKey
+)
+
+// parseReleaseKeys parses base64 encoded ed25519 public keys, one per line,
+// ignoring empty lines and comments
+func parseReleaseKeys(data []byte) ([]ed25519.PublicKey, error) {
+	var keys []ed25519.PublicKey
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, err := base64.StdEncoding.DecodeString(line)
+		if err != nil {
+			return nil, fmt.Errorf("invalid public key %s: %v", line, err)
+		}
+		if len(key) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid public key %s: not an ed25519 key", line)
+		}
+		keys = append(keys, ed25519.PublicKey(key))
+	}
+	return keys, scanner.Err()
+}
+
+// AddReleasePublicKey trusts the keys of a file for verifying release files
+func AddReleasePublicKey(file string) error {
+	data, err := os.ReadFile(filepath.Clean(file))
+	if err != nil {
+		return err
+	}
+	keys, err := parseReleaseKeys(data)
+	if err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		return fmt.Errorf("no public key found in %s", file)
+	}
+	extraReleaseKeys = append(extraReleaseKeys, keys...)
+	return nil
+}
+
+// VerifyRelease verifies the base64 encoded ed25519 signature of a release
+// file. The release file shipped with knoxctl needs no signature.
+func VerifyRelease(data, sig []byte) error {
+	if bytes.Equal(data, releaseInfoFile) {
+		return nil
+	}
+	return VerifySignature(data, sig)
+}
+
+// VerifySignature verifies a base64 encoded ed25519 signature made with one
+// of the trusted release keys
+func VerifySignature(data, sig []byte) error {
+	keys, err := parseReleaseKeys(releasePublicKeys)
+	if err != nil {
+		return err
+	}
+	keys = append(keys, extraReleaseKeys...)
+
+	signature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(sig)))
+	if err != nil {
+		return fmt.Errorf("invalid signature: %v", err)
+	}
+	for _, key := range keys {
+		if ed25519.Verify(key, data, signature) {
+			return nil
+		}
+	}
+	return fmt.Errorf("signature does not match any trusted key")
+}
+
+// ReadReleaseFile reads a release file given by the user and verifies it
+// with the signature stored next to it
+func ReadReleaseFile(releaseFile string) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Clean(releaseFile))
+	if err != nil {
+		return nil, err
+	}
+	if SkipReleaseVerification || bytes.Equal(data, releaseInfoFile) {
+		return data, nil
+	}
+
+	sig, err := readReleaseSignature(releaseFile)
+	if err != nil {
+		return nil, err
+	}
+	if sig == nil {
+		return nil, fmt.Errorf("release file %s is not signed: %s not found", releaseFile, releaseFile+ReleaseSignatureExt)
+	}
+	if err := VerifyRelease(data, sig); err != nil {
+		return nil, fmt.Errorf("failed to verify release file %s: %v", releaseFile, err)
+	}
+	return data, nil
+}
+
+// readReleaseSignature reads the signature stored next to a release file, nil
+// if there is none
+func readReleaseSignature(releaseFile string) ([]byte, error) {
+	sig, err := os.ReadFile(filepath.Clean(releaseFile + ReleaseSignatureExt))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return sig, err
+}
+
+// SignData returns the base64 encoded ed25519 signature of a release file or
+// of a bundle manifest
+func SignData(data []byte, key ed25519.PrivateKey) []byte {
+	return []byte(base64.StdEncoding.EncodeToString(ed25519.Sign(key, data)) + "\n")
+}
+
+// ParseReleaseSigningKey parses a base64 encoded ed25519 private key or seed
+func ParseReleaseSigningKey(data []byte) (ed25519.PrivateKey, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid signing key: %v", err)
+	}
+	switch len(key) {
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(key), nil
+	case ed25519.PrivateKeySize:
+		return ed25519.PrivateKey(key), nil
+	}
+	return nil, fmt.Errorf("invalid signing key: not an ed25519 key")
+}
+
+// LoadReleaseInfo reads the release info of a verified release file
+func LoadReleaseInfo(releaseFile string) (map[string]ReleaseMetadata, error) {
+	data, err := ReadReleaseFile(releaseFile)
+	if err != nil {
+		return nil, err
+	}
+	return unmarshal(data)
+}
+
+// EmbeddedReleaseFile returns the release file shipped with knoxctl
+func EmbeddedReleaseFile() []byte {
+	return bytes.Clone(releaseInfoFile)
+}
+
+// EmbeddedReleaseSignature returns the signature of the release file shipped
+// with knoxctl
+func EmbeddedReleaseSignature() []byte {
+	return bytes.Clone(releaseInfoSignature)
+}
@@ -0,0 +1,154 @@
+package common
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadReleaseFile(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, otherPriv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "release.pub")
+	if err := os.WriteFile(keyFile, []byte("# test key\n"+base64.StdEncoding.EncodeToString(pub)+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	defer func(keys []ed25519.PublicKey) { extraReleaseKeys = keys }(extraReleaseKeys)
+	if err := AddReleasePublicKey(keyFile); err != nil {
+		t.Fatalf("AddReleasePublicKey() error = %v", err)
+	}
+
+	release := []byte(`{"v0.10.0":{"kubearmor_tag":"v1.5.0"}}`)
+	sign := func(key ed25519.PrivateKey) string {
+		return base64.StdEncoding.EncodeToString(ed25519.Sign(key, release))
+	}
+
+	tests := []struct {
+		name    string
+		data    []byte
+		sig     string
+		wantErr string
+	}{
+		{name: "embedded", data: releaseInfoFile},
+		{name: "signed", data: release, sig: sign(priv)},
+		{name: "not signed", data: release, wantErr: "not signed"},
+		{name: "untrusted key", data: release, sig: sign(otherPriv), wantErr: "does not match"},
+		{name: "tampered", data: append([]byte(" "), release...), sig: sign(priv), wantErr: "does not match"},
+		{name: "invalid signature", data: release, sig: "!", wantErr: "invalid signature"},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(dir, string(rune('a'+i))+".json")
+			if err := os.WriteFile(file, tt.data, 0o600); err != nil {
+				t.Fatal(err)
+			}
+			if tt.sig != "" {
+				if err := os.WriteFile(file+ReleaseSignatureExt, []byte(tt.sig+"\n"), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			_, err := ReadReleaseFile(file)
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("ReadReleaseFile() error = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("ReadReleaseFile() error = %v, want it to mention %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestStoredReleaseFile(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(keys []ed25519.PublicKey, info map[string]ReleaseMetadata) {
+		extraReleaseKeys, ReleaseInfo = keys, info
+	}(extraReleaseKeys, ReleaseInfo)
+	extraReleaseKeys = append(extraReleaseKeys, pub)
+
+	dir := t.TempDir()
+	writeRelease := func(name, data string) string {
+		file := filepath.Join(dir, name)
+		if err := os.WriteFile(file, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file+ReleaseSignatureExt, SignData([]byte(data), priv), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return file
+	}
+	path := filepath.Join(dir, "opt")
+	stored := filepath.Join(path, "release.json")
+
+	if _, err := GetOrWriteReleaseInfo(writeRelease("a.json", `{"v0.10.0":{"kubearmor_tag":"v1.5.0"}}`), path); err != nil {
+		t.Fatalf("GetOrWriteReleaseInfo() error = %v", err)
+	}
+	if _, err := os.Stat(stored + ReleaseSignatureExt); err != nil {
+		t.Fatalf("signature not stored: %v", err)
+	}
+	if _, err := GetOrWriteReleaseInfo("", path); err != nil {
+		t.Errorf("GetOrWriteReleaseInfo() of the stored release error = %v", err)
+	}
+
+	if _, err := GetOrWriteReleaseInfo(writeRelease("b.json", `{"v0.11.0":{"kubearmor_tag":"v1.6.0"}}`), path); err != nil {
+		t.Fatalf("GetOrWriteReleaseInfo() error = %v", err)
+	}
+	if version, release := GetReleaseFromBackup(path, "v0.10.0"); version != "v0.10.0" || release.KubeArmorTag != "v1.5.0" {
+		t.Errorf("GetReleaseFromBackup() = %s, %+v, want the verified backup", version, release)
+	}
+
+	if err := os.WriteFile(stored, []byte(`{"v0.11.0":{"kubearmor_tag":"v9.9.9"}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetOrWriteReleaseInfo("", path); err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Errorf("GetOrWriteReleaseInfo() of a tampered release error = %v, want a verification error", err)
+	}
+	if err := os.WriteFile(stored+".bak", []byte(`{"v0.10.0":{"kubearmor_tag":"v9.9.9"}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if version, _ := GetReleaseFromBackup(path, "v0.10.0"); version != "" {
+		t.Errorf("GetReleaseFromBackup() of a tampered backup = %s, want none", version)
+	}
+}
+
+func TestParseReleaseSigningKey(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, data := range [][]byte{priv, priv.Seed()} {
+		key, err := ParseReleaseSigningKey([]byte(base64.StdEncoding.EncodeToString(data) + "\n"))
+		if err != nil {
+			t.Fatalf("ParseReleaseSigningKey() error = %v", err)
+		}
+		if !key.Public().(ed25519.PublicKey).Equal(pub) {
+			t.Errorf("ParseReleaseSigningKey() returned another key")
+		}
+	}
+	if _, err := ParseReleaseSigningKey([]byte(base64.StdEncoding.EncodeToString(pub[:16]))); err == nil {
+		t.Errorf("ParseReleaseSigningKey() of a short key succeeded")
+	}
+}
+
+func TestEmbeddedReleaseSignature(t *testing.T) {
+	if strings.TrimSpace(string(releaseInfoSignature)) == "" {
+		t.Skip("the embedded release file is signed when releasing")
+	}
+	if err := VerifySignature(releaseInfoFile, releaseInfoSignature); err != nil {
+		t.Errorf("signature of the embedded release file: %v", err)
+	}
+}
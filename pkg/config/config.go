@@ -15,6 +15,7 @@ type AccuKnoxConfig struct {
 	TENANT_ID   string
 	TOKEN       string
 	CONFIG_FILE string
+	PROFILE     string
 }
 
 var Cfg AccuKnoxConfig
@@ -0,0 +1,359 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/olekukonko/tablewriter"
+	"sigs.k8s.io/yaml"
+)
+
+const DEFAULT_PROFILES_FILE_NAME = ".accuknox.profiles"
+
+// Profile keys accepted by `knoxctl config set/get`
+const (
+	KeyCWPPURL  = "cwpp_url"
+	KeyCSPMURL  = "cspm_url"
+	KeyTenantID = "tenant_id"
+	KeyToken    = "token"
+)
+
+var ProfileKeys = []string{KeyCWPPURL, KeyCSPMURL, KeyTenantID, KeyToken}
+
+// Profile is a named set of API settings. The token is kept in TokenStore,
+// Token is only set for the plain-text store.
+type Profile struct {
+	CWPP_URL   string `json:"cwpp_url,omitempty"`
+	CSPM_URL   string `json:"cspm_url,omitempty"`
+	TENANT_ID  string `json:"tenant_id,omitempty"`
+	TokenStore string `json:"token_store,omitempty"`
+	Token      string `json:"token,omitempty"`
+}
+
+// Profiles is the content of the profiles file
+type Profiles struct {
+	Current  string              `json:"current,omitempty"`
+	Profiles map[string]*Profile `json:"profiles"`
+
+	path string
+}
+
+// GetProfilesFile returns the profiles file, ACCUKNOX_PROFILES overrides the
+// default $HOME/.accuknox.profiles
+func GetProfilesFile() string {
+	if path := os.Getenv("ACCUKNOX_PROFILES"); path != "" {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return DEFAULT_PROFILES_FILE_NAME
+	}
+	return filepath.Join(home, DEFAULT_PROFILES_FILE_NAME)
+}
+
+// LoadProfiles reads the profiles file, a missing file has no profiles
+func LoadProfiles(path string) (*Profiles, error) {
+	p := &Profiles{Profiles: make(map[string]*Profile), path: path}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return p, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading profiles file: %v", err)
+	}
+	if err := yaml.Unmarshal(data, p); err != nil {
+		return nil, fmt.Errorf("invalid profiles file %s: %v", path, err)
+	}
+	if p.Profiles == nil {
+		p.Profiles = make(map[string]*Profile)
+	}
+	return p, nil
+}
+
+// Save writes the profiles file, readable by the owner only as it may hold
+// plain-text tokens
+func (p *Profiles) Save() error {
+	data, err := yaml.Marshal(p)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p.path), 0750); err != nil {
+		return fmt.Errorf("error creating profiles directory: %v", err)
+	}
+	tmp := p.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("error writing profiles file: %v", err)
+	}
+	return os.Rename(tmp, p.path)
+}
+
+// Names returns the sorted profile names
+func (p *Profiles) Names() []string {
+	var names []string
+	for name := range p.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Get returns a profile, or an error listing the existing ones
+func (p *Profiles) Get(name string) (*Profile, error) {
+	profile, ok := p.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("profile %q not found, existing profiles: %s", name, strings.Join(p.Names(), ", "))
+	}
+	return profile, nil
+}
+
+// Set sets a key of a profile and creates the profile if needed. The token
+// is written to the token store of the profile, see SetToken.
+func (p *Profiles) Set(name, key, value string) error {
+	profile, err := p.ensure(name)
+	if err != nil {
+		return err
+	}
+
+	switch key {
+	case KeyCWPPURL:
+		profile.CWPP_URL = value
+	case KeyCSPMURL:
+		profile.CSPM_URL = value
+	case KeyTenantID:
+		profile.TENANT_ID = value
+	case KeyToken:
+		return p.SetToken(name, value, profile.TokenStore)
+	default:
+		return fmt.Errorf("invalid key %q, must be one of %s", key, strings.Join(ProfileKeys, ", "))
+	}
+	return nil
+}
+
+// ensure returns a profile and creates it if needed, the first profile
+// becomes the current one
+func (p *Profiles) ensure(name string) (*Profile, error) {
+	if name == "" {
+		return nil, fmt.Errorf("profile name is empty")
+	}
+	profile, ok := p.Profiles[name]
+	if !ok {
+		profile = &Profile{}
+		p.Profiles[name] = profile
+		if p.Current == "" {
+			p.Current = name
+		}
+	}
+	return profile, nil
+}
+
+// GetValue returns a key of a profile
+func (p *Profiles) GetValue(name, key string) (string, error) {
+	profile, err := p.Get(name)
+	if err != nil {
+		return "", err
+	}
+	switch key {
+	case KeyCWPPURL:
+		return profile.CWPP_URL, nil
+	case KeyCSPMURL:
+		return profile.CSPM_URL, nil
+	case KeyTenantID:
+		return profile.TENANT_ID, nil
+	case KeyToken:
+		return p.Token(name)
+	}
+	return "", fmt.Errorf("invalid key %q, must be one of %s", key, strings.Join(ProfileKeys, ", "))
+}
+
+// SetToken stores the token of a profile and creates the profile if needed.
+// An empty store keeps the current store of the profile, or picks the most
+// secure available one.
+func (p *Profiles) SetToken(name, token, store string) error {
+	profile, err := p.ensure(name)
+	if err != nil {
+		return err
+	}
+	if store == "" {
+		store = profile.TokenStore
+	}
+	if store == "" || store == StoreAuto {
+		store = DefaultTokenStore()
+	}
+
+	ts, err := NewTokenStore(store)
+	if err != nil {
+		return err
+	}
+	// drop the token from the previous store when moving it
+	if profile.TokenStore != "" && profile.TokenStore != store {
+		if prev, err := NewTokenStore(profile.TokenStore); err == nil {
+			_ = prev.Delete(p.path, name)
+		}
+	}
+	profile.Token = ""
+	if store == StorePlain {
+		profile.Token = token
+	} else if err := ts.Set(p.path, name, token); err != nil {
+		return err
+	}
+	profile.TokenStore = store
+	return nil
+}
+
+// Token returns the token of a profile from its token store
+func (p *Profiles) Token(name string) (string, error) {
+	profile, err := p.Get(name)
+	if err != nil {
+		return "", err
+	}
+	if profile.TokenStore == "" || profile.TokenStore == StorePlain {
+		return profile.Token, nil
+	}
+	ts, err := NewTokenStore(profile.TokenStore)
+	if err != nil {
+		return "", err
+	}
+	return ts.Get(p.path, name)
+}
+
+// Use makes a profile the current one
+func (p *Profiles) Use(name string) error {
+	if _, err := p.Get(name); err != nil {
+		return err
+	}
+	p.Current = name
+	return nil
+}
+
+// Delete removes a profile and its stored token
+func (p *Profiles) Delete(name string) error {
+	profile, err := p.Get(name)
+	if err != nil {
+		return err
+	}
+	if profile.TokenStore != "" && profile.TokenStore != StorePlain {
+		if ts, err := NewTokenStore(profile.TokenStore); err == nil {
+			if err := ts.Delete(p.path, name); err != nil {
+				return err
+			}
+		}
+	}
+	delete(p.Profiles, name)
+	if p.Current == name {
+		p.Current = ""
+	}
+	return nil
+}
+
+// ResolveProfile returns the profile to use: the given name, then
+// ACCUKNOX_PROFILE, then the current profile. An empty name means that no
+// profile is configured and the config file is used.
+func ResolveProfile(profiles *Profiles, name string) string {
+	if name != "" {
+		return name
+	}
+	if name := os.Getenv("ACCUKNOX_PROFILE"); name != "" {
+		return name
+	}
+	return profiles.Current
+}
+
+// LoadProfile loads a profile into Cfg
+func LoadProfile(profiles *Profiles, name string) error {
+	profile, err := profiles.Get(name)
+	if err != nil {
+		return err
+	}
+	token, err := profiles.Token(name)
+	if err != nil {
+		return fmt.Errorf("error reading token of profile %s: %v", name, err)
+	}
+
+	Cfg.CWPP_URL = profile.CWPP_URL
+	Cfg.CSPM_URL = profile.CSPM_URL
+	Cfg.TENANT_ID = profile.TENANT_ID
+	Cfg.TOKEN = token
+	Cfg.CONFIG_FILE = profiles.path
+	Cfg.PROFILE = name
+	return nil
+}
+
+// MaskToken hides all but the last characters of a token
+func MaskToken(token string) string {
+	if len(token) <= 8 {
+		return strings.Repeat("*", len(token))
+	}
+	return strings.Repeat("*", 8) + token[len(token)-4:]
+}
+
+type profileInfo struct {
+	Name        string `json:"name"`
+	Current     bool   `json:"current"`
+	CWPP_URL    string `json:"cwpp_url"`
+	CSPM_URL    string `json:"cspm_url"`
+	TENANT_ID   string `json:"tenant_id"`
+	TokenStore  string `json:"token_store"`
+	TokenExpiry string `json:"token_expiry"`
+}
+
+// PrintProfiles prints the profiles with the expiry of their tokens
+func PrintProfiles(w io.Writer, profiles *Profiles, jsonFormat bool) error {
+	var infos []profileInfo
+	for _, name := range profiles.Names() {
+		profile := profiles.Profiles[name]
+		info := profileInfo{
+			Name:       name,
+			Current:    name == profiles.Current,
+			CWPP_URL:   profile.CWPP_URL,
+			CSPM_URL:   profile.CSPM_URL,
+			TENANT_ID:  profile.TENANT_ID,
+			TokenStore: profile.TokenStore,
+		}
+		token, err := profiles.Token(name)
+		switch {
+		case err != nil:
+			info.TokenExpiry = "unavailable"
+		case token == "":
+			info.TokenExpiry = "no token"
+		default:
+			if expiry, ok, err := TokenExpiry(token); err == nil && ok {
+				info.TokenExpiry = expiry.Local().Format("2006-01-02 15:04")
+				if time.Now().After(expiry) {
+					info.TokenExpiry += " (expired)"
+				}
+			}
+		}
+		infos = append(infos, info)
+	}
+
+	if jsonFormat {
+		data, err := json.Marshal(infos)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, string(data))
+		return nil
+	}
+
+	if len(infos) == 0 {
+		fmt.Fprintln(w, "No profiles configured, create one with `knoxctl config set`")
+		return nil
+	}
+	table := tablewriter.NewWriter(w)
+	table.SetHeader([]string{"Current", "Name", "CWPP URL", "Tenant", "Token Store", "Token Expiry"})
+	for _, info := range infos {
+		current := ""
+		if info.Current {
+			current = "*"
+		}
+		table.Append([]string{current, info.Name, info.CWPP_URL, info.TENANT_ID, info.TokenStore, info.TokenExpiry})
+	}
+	table.Render()
+	return nil
+}
@@ -0,0 +1,125 @@
+package config
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testJWT(claims string) string {
+	enc := base64.RawURLEncoding.EncodeToString
+	return enc([]byte(`{"alg":"HS256"}`)) + "." + enc([]byte(claims)) + ".sig"
+}
+
+func TestProfiles(t *testing.T) {
+	t.Setenv(PassphraseEnv, "secret")
+	path := filepath.Join(t.TempDir(), "profiles")
+
+	profiles, err := LoadProfiles(path)
+	if err != nil {
+		t.Fatalf("LoadProfiles() error = %v", err)
+	}
+	if err := profiles.Set("prod", KeyCWPPURL, "https://cwpp.prod"); err != nil {
+		t.Fatal(err)
+	}
+	if err := profiles.SetToken("prod", "prod-token", StoreEncrypted); err != nil {
+		t.Fatalf("SetToken() error = %v", err)
+	}
+	if err := profiles.SetToken("dev", "dev-token", StorePlain); err != nil {
+		t.Fatal(err)
+	}
+	if err := profiles.Set("dev", "colour", "red"); err == nil {
+		t.Errorf("unknown key should fail")
+	}
+	if err := profiles.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	data, _ := os.ReadFile(path + ".tokens")
+	if strings.Contains(string(data), "prod-token") {
+		t.Errorf("token is stored in plain text:\n%s", data)
+	}
+
+	profiles, err = LoadProfiles(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profiles.Current != "prod" {
+		t.Errorf("current = %q, want the first profile", profiles.Current)
+	}
+	if name := ResolveProfile(profiles, ""); name != "prod" {
+		t.Errorf("ResolveProfile() = %q", name)
+	}
+	t.Setenv("ACCUKNOX_PROFILE", "dev")
+	if name := ResolveProfile(profiles, ""); name != "dev" {
+		t.Errorf("ResolveProfile() = %q, want ACCUKNOX_PROFILE", name)
+	}
+
+	if err := LoadProfile(profiles, "prod"); err != nil {
+		t.Fatalf("LoadProfile() error = %v", err)
+	}
+	if Cfg.CWPP_URL != "https://cwpp.prod" || Cfg.TOKEN != "prod-token" || Cfg.PROFILE != "prod" {
+		t.Errorf("unexpected config %+v", Cfg)
+	}
+
+	t.Setenv(PassphraseEnv, "wrong")
+	if _, err := profiles.Token("prod"); err == nil {
+		t.Errorf("wrong passphrase should fail")
+	}
+
+	if err := profiles.Delete("prod"); err != nil {
+		t.Fatal(err)
+	}
+	if profiles.Current != "" || len(profiles.Names()) != 1 {
+		t.Errorf("unexpected profiles after delete %+v", profiles)
+	}
+	if err := profiles.Use("prod"); err == nil || !strings.Contains(err.Error(), "existing profiles: dev") {
+		t.Errorf("Use() error = %v", err)
+	}
+}
+
+func TestCheckToken(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	tests := []struct {
+		token   string
+		wantErr string
+	}{
+		{token: testJWT(fmt.Sprintf(`{"exp":%d}`, now.Unix()+60))},
+		{token: testJWT(fmt.Sprintf(`{"exp":%d}`, now.Unix()-60)), wantErr: "--profile prod"},
+		{token: testJWT(`{"sub":"ci"}`)},
+		{token: "opaque-token"},
+		{token: "", wantErr: "no token configured"},
+	}
+
+	for _, tt := range tests {
+		Cfg = AccuKnoxConfig{TOKEN: tt.token, PROFILE: "prod"}
+		err := CheckToken(now)
+		if tt.wantErr == "" && err != nil {
+			t.Errorf("CheckToken(%q) error = %v", tt.token, err)
+		}
+		if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("CheckToken(%q) error = %v, want %q", tt.token, err, tt.wantErr)
+		}
+	}
+}
+
+func TestKeychainAddCommand(t *testing.T) {
+	token := testJWT(`{"sub":"ci"}`)
+	command, err := keychainAddCommand("prod", token)
+	if err != nil {
+		t.Fatalf("keychainAddCommand() error = %v", err)
+	}
+	if want := `add-generic-password -U -s "` + keyringService + `" -a "prod" -w "` + token + "\"\n"; command != want {
+		t.Errorf("keychainAddCommand() = %q, want %q", command, want)
+	}
+
+	for _, token := range []string{`a"b`, `a\b`, "a\nb"} {
+		if _, err := keychainAddCommand("prod", token); err == nil {
+			t.Errorf("keychainAddCommand(%q) should fail", token)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// TokenExpiry returns the expiry of a JWT, ok is false if the token has no
+// expiry. The signature is not verified, the API does that.
+func TokenExpiry(token string) (expiry time.Time, ok bool, err error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}, false, fmt.Errorf("token is not a JWT")
+	}
+	payload, err := jwt.DecodeSegment(parts[1])
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("error decoding token: %v", err)
+	}
+
+	var claims struct {
+		Exp json.Number `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return time.Time{}, false, fmt.Errorf("error decoding token claims: %v", err)
+	}
+	if claims.Exp == "" {
+		return time.Time{}, false, nil
+	}
+	exp, err := claims.Exp.Float64()
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("invalid token expiry %q", claims.Exp)
+	}
+	return time.Unix(int64(exp), 0), true, nil
+}
+
+// CheckToken returns an error asking to log in again if the token of Cfg
+// has expired. Tokens which are not JWTs are left to the API.
+func CheckToken(now time.Time) error {
+	if Cfg.TOKEN == "" {
+		return fmt.Errorf("no token configured, set one with `knoxctl config set token <token>` or --token")
+	}
+	expiry, ok, err := TokenExpiry(Cfg.TOKEN)
+	if err != nil || !ok || now.Before(expiry) {
+		return nil
+	}
+
+	relogin := "knoxctl config set token <token>"
+	if Cfg.PROFILE != "" {
+		relogin += " --profile " + Cfg.PROFILE
+	}
+	return fmt.Errorf("token expired at %s, create a new token in the AccuKnox console and run `%s`", expiry.Local().Format(time.RFC1123), relogin)
+}
@@ -0,0 +1,283 @@
+package config
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// Token stores
+const (
+	StoreAuto      = "auto"
+	StoreKeyring   = "keyring"
+	StoreEncrypted = "encrypted-file"
+	StorePlain     = "plain"
+)
+
+var TokenStores = []string{StoreAuto, StoreKeyring, StoreEncrypted, StorePlain}
+
+// PassphraseEnv is the environment variable holding the passphrase of the
+// encrypted token file
+const PassphraseEnv = "ACCUKNOX_TOKEN_PASSPHRASE"
+
+const keyringService = "knoxctl"
+
+// TokenStore keeps the tokens of the profiles stored in the profiles file at
+// path
+type TokenStore interface {
+	Get(path, profile string) (string, error)
+	Set(path, profile, token string) error
+	Delete(path, profile string) error
+}
+
+// NewTokenStore returns the named token store
+func NewTokenStore(name string) (TokenStore, error) {
+	switch name {
+	case StoreKeyring:
+		return keyringStore{}, nil
+	case StoreEncrypted:
+		return encryptedFileStore{passphrase: os.Getenv(PassphraseEnv)}, nil
+	case StorePlain:
+		return plainStore{}, nil
+	}
+	return nil, fmt.Errorf("invalid token store %q, must be one of %s", name, strings.Join(TokenStores, ", "))
+}
+
+// DefaultTokenStore returns the OS keyring if available, then the encrypted
+// file if a passphrase is set, and the plain-text profiles file otherwise
+func DefaultTokenStore() string {
+	if keyringAvailable() {
+		return StoreKeyring
+	}
+	if os.Getenv(PassphraseEnv) != "" {
+		return StoreEncrypted
+	}
+	return StorePlain
+}
+
+// plainStore keeps the token in the profiles file itself
+type plainStore struct{}
+
+func (plainStore) Get(string, string) (string, error) { return "", nil }
+func (plainStore) Set(string, string, string) error   { return nil }
+func (plainStore) Delete(string, string) error        { return nil }
+
+// keyringStore uses the macOS keychain through `security` and the Secret
+// Service (GNOME keyring, KWallet) through `secret-tool` on Linux
+type keyringStore struct{}
+
+func keyringAvailable() bool {
+	switch runtime.GOOS {
+	case "darwin":
+		_, err := exec.LookPath("security")
+		return err == nil
+	case "linux":
+		if _, err := exec.LookPath("secret-tool"); err != nil {
+			return false
+		}
+		return os.Getenv("DBUS_SESSION_BUS_ADDRESS") != ""
+	}
+	return false
+}
+
+func (keyringStore) Get(_, profile string) (string, error) {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("security", "find-generic-password", "-s", keyringService, "-a", profile, "-w") // #nosec G204
+	case "linux":
+		cmd = exec.Command("secret-tool", "lookup", "service", keyringService, "profile", profile) // #nosec G204
+	default:
+		return "", fmt.Errorf("OS keyring is not supported on %s", runtime.GOOS)
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("token of profile %s not found in the OS keyring: %v", profile, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func (keyringStore) Set(_, profile, token string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		// the command is read from stdin so that the token does not show up
+		// in the process list
+		command, err := keychainAddCommand(profile, token)
+		if err != nil {
+			return err
+		}
+		cmd = exec.Command("security", "-i") // #nosec G204
+		cmd.Stdin = strings.NewReader(command)
+	case "linux":
+		cmd = exec.Command("secret-tool", "store", "--label", "knoxctl "+profile, "service", keyringService, "profile", profile) // #nosec G204
+		cmd.Stdin = strings.NewReader(token)
+	default:
+		return fmt.Errorf("OS keyring is not supported on %s", runtime.GOOS)
+	}
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("error storing token in the OS keyring: %v: %s", err, bytes.TrimSpace(out))
+	}
+	// `security -i` exits successfully when a command fails, it only prints
+	// the error after its prompt
+	if msg := bytes.TrimSpace(bytes.ReplaceAll(out, []byte("security>"), nil)); len(msg) > 0 {
+		return fmt.Errorf("error storing token in the OS keyring: %s", msg)
+	}
+	return nil
+}
+
+// keychainAddCommand returns the `security -i` command storing the token
+func keychainAddCommand(profile, token string) (string, error) {
+	for _, arg := range []string{profile, token} {
+		if strings.ContainsAny(arg, "\"\\\r\n") {
+			return "", fmt.Errorf("the OS keyring does not support quotes, backslashes or line breaks in profiles and tokens")
+		}
+	}
+	return fmt.Sprintf("add-generic-password -U -s \"%s\" -a \"%s\" -w \"%s\"\n", keyringService, profile, token), nil
+}
+
+func (keyringStore) Delete(_, profile string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("security", "delete-generic-password", "-s", keyringService, "-a", profile) // #nosec G204
+	case "linux":
+		cmd = exec.Command("secret-tool", "clear", "service", keyringService, "profile", profile) // #nosec G204
+	default:
+		return nil
+	}
+	// a missing entry is not an error
+	_ = cmd.Run()
+	return nil
+}
+
+// encryptedFileStore keeps the tokens in <profiles file>.tokens, encrypted
+// with AES-GCM and a key derived from the passphrase with scrypt
+type encryptedFileStore struct {
+	passphrase string
+}
+
+const saltSize = 16
+
+func tokensFile(path string) string {
+	return path + ".tokens"
+}
+
+func (s encryptedFileStore) load(path string) (map[string]string, error) {
+	tokens := make(map[string]string)
+	data, err := os.ReadFile(tokensFile(path))
+	if os.IsNotExist(err) {
+		return tokens, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading token file: %v", err)
+	}
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return nil, fmt.Errorf("invalid token file %s: %v", tokensFile(path), err)
+	}
+	return tokens, nil
+}
+
+func (s encryptedFileStore) save(path string, tokens map[string]string) error {
+	data, err := json.MarshalIndent(tokens, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(tokensFile(path), data, 0600); err != nil {
+		return fmt.Errorf("error writing token file: %v", err)
+	}
+	return nil
+}
+
+func (s encryptedFileStore) gcm(salt []byte) (cipher.AEAD, error) {
+	if s.passphrase == "" {
+		return nil, fmt.Errorf("%s must be set to use the encrypted token file", PassphraseEnv)
+	}
+	key, err := scrypt.Key([]byte(s.passphrase), salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (s encryptedFileStore) Get(path, profile string) (string, error) {
+	tokens, err := s.load(path)
+	if err != nil {
+		return "", err
+	}
+	encoded, ok := tokens[profile]
+	if !ok {
+		return "", fmt.Errorf("token of profile %s not found in %s", profile, tokensFile(path))
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(data) < saltSize {
+		return "", fmt.Errorf("invalid token of profile %s", profile)
+	}
+
+	gcm, err := s.gcm(data[:saltSize])
+	if err != nil {
+		return "", err
+	}
+	data = data[saltSize:]
+	if len(data) < gcm.NonceSize() {
+		return "", fmt.Errorf("invalid token of profile %s", profile)
+	}
+	token, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], []byte(profile))
+	if err != nil {
+		return "", fmt.Errorf("error decrypting token of profile %s, check %s", profile, PassphraseEnv)
+	}
+	return string(token), nil
+}
+
+func (s encryptedFileStore) Set(path, profile, token string) error {
+	tokens, err := s.load(path)
+	if err != nil {
+		return err
+	}
+
+	salt := make([]byte, saltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return err
+	}
+	gcm, err := s.gcm(salt)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+
+	data := append(salt, nonce...)
+	data = gcm.Seal(data, nonce, []byte(token), []byte(profile))
+	tokens[profile] = base64.StdEncoding.EncodeToString(data)
+	return s.save(path, tokens)
+}
+
+func (s encryptedFileStore) Delete(path, profile string) error {
+	tokens, err := s.load(path)
+	if err != nil {
+		return err
+	}
+	if _, ok := tokens[profile]; !ok {
+		return nil
+	}
+	delete(tokens, profile)
+	return s.save(path, tokens)
+}
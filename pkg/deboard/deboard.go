@@ -18,7 +18,7 @@ import (
 	"github.com/fatih/color"
 )
 
-func Deboard(nodeType onboard.NodeType, vmMode onboard.VMMode, dryRun bool) (string, error) {
+func Deboard(nodeType onboard.NodeType, vmMode onboard.VMMode, runtime onboard.ContainerRuntime, dryRun bool) (string, error) {
 	fmt.Println(color.MagentaString("Deboarding VM in mode %s...", vmMode))
 
 	// check for systemd installation
@@ -33,6 +33,11 @@ func Deboard(nodeType onboard.NodeType, vmMode onboard.VMMode, dryRun bool) (str
 			return "", err
 		}
 
+		runtime, err = onboard.DetectContainerRuntime(runtime)
+		if err != nil {
+			return "", err
+		}
+
 		verifyInstallation := false
 		composeFilePath := filepath.Join(configPath, "docker-compose.yaml")
 
@@ -47,18 +52,18 @@ func Deboard(nodeType onboard.NodeType, vmMode onboard.VMMode, dryRun bool) (str
 
 		if verifyInstallation {
 			fmt.Println(color.YellowString("Docker compose file not found at %s. Checking installation of each agent...", composeFilePath))
-			installedContainers, installedVolumes, err := GetInstalledObjects()
+			installedContainers, installedVolumes, err := GetInstalledObjects(runtime)
 			if err != nil {
 				return "", err
 			}
 
-			err = removeInstalledObjects(installedContainers, installedVolumes)
+			err = removeInstalledObjects(runtime, installedContainers, installedVolumes)
 			if err != nil {
 				return "", err
 			}
 
 		} else {
-			composeCmd, composeVersion, err := onboard.GetComposeCommand()
+			composeCmd, composeVersion, err := onboard.GetComposeCommand(runtime)
 			if err != nil {
 				return configPath, err
 			}
@@ -68,13 +73,13 @@ func Deboard(nodeType onboard.NodeType, vmMode onboard.VMMode, dryRun bool) (str
 			case onboard.NodeType_ControlPlane:
 
 				// Remove VMA and then delete/down all other containers
-				vmaObj, err := getVMAContainerObject()
+				vmaObj, err := getVMAContainerObject(runtime)
 				if err != nil {
 					logger.Warn("error:%s", err.Error())
 				}
 				if len(vmaObj) > 0 {
 					fmt.Println(color.BlueString("VMA docker installation found"))
-					err = removeInstalledObjects(vmaObj, nil)
+					err = removeInstalledObjects(runtime, vmaObj, nil)
 					if err != nil {
 						fmt.Println("error", err.Error())
 					}
@@ -105,15 +110,16 @@ func Deboard(nodeType onboard.NodeType, vmMode onboard.VMMode, dryRun bool) (str
 	return "", nil
 }
 
-// returns installed containers and volumes
-func GetInstalledObjects() (map[string]dockerContainerTypes.Summary, []string, error) {
+// returns installed containers and volumes of a container runtime
+func GetInstalledObjects(runtime onboard.ContainerRuntime) (map[string]dockerContainerTypes.Summary, []string, error) {
 	allContainers := onboard.GetKnownContainerMap()
 	installedContainers := make(map[string]dockerContainerTypes.Summary, 0)
 
-	dockerClient, err := onboard.CreateDockerClient()
+	dockerClient, err := onboard.CreateContainerClient(runtime)
 	if err != nil {
-		return nil, nil, fmt.Errorf("Failed to create docker client. %s", err.Error())
+		return nil, nil, fmt.Errorf("Failed to create %s client. %s", runtime, err.Error())
 	}
+	defer dockerClient.Close()
 
 	containerList, err := dockerClient.ContainerList(context.Background(), dockerContainerTypes.ListOptions{
 		All: true,
@@ -149,11 +155,12 @@ func GetInstalledObjects() (map[string]dockerContainerTypes.Summary, []string, e
 	return installedContainers, installedVolumes, nil
 }
 
-func removeInstalledObjects(installedContainers map[string]dockerTypes.Container, installedVolumes []string) error {
-	dockerClient, err := onboard.CreateDockerClient()
+func removeInstalledObjects(runtime onboard.ContainerRuntime, installedContainers map[string]dockerTypes.Container, installedVolumes []string) error {
+	dockerClient, err := onboard.CreateContainerClient(runtime)
 	if err != nil {
-		return fmt.Errorf("Failed to create docker client. %s", err.Error())
+		return fmt.Errorf("Failed to create %s client. %s", runtime, err.Error())
 	}
+	defer dockerClient.Close()
 
 	for _, container := range installedContainers {
 		containerName := strings.TrimPrefix(container.Names[0], "/")
@@ -181,7 +188,7 @@ func removeInstalledObjects(installedContainers map[string]dockerTypes.Container
 	return nil
 }
 
-func UninstallRRA() error {
+func UninstallRRA(runtime onboard.ContainerRuntime) error {
 	//check for RRA systemd installation
 
 	exists, err := onboard.CheckRRASystemdInstallation()
@@ -201,14 +208,14 @@ func UninstallRRA() error {
 		}
 		return err
 	}
-	var cc onboard.ClusterConfig
+	cc := onboard.ClusterConfig{ContainerRuntime: runtime}
 	// validate docker environment
 	_, err = cc.ValidateEnv()
 	if err != nil {
 		return os.ErrNotExist
 	}
 	//check for RRA docker installation
-	rraObj, err := getRRAContainerObject()
+	rraObj, err := getRRAContainerObject(cc.ContainerRuntime)
 	if err != nil {
 		logger.Warn("error:%s", err.Error())
 	}
@@ -222,7 +229,7 @@ func UninstallRRA() error {
 		_, err = os.Stat(composeFilePath)
 		if err != nil {
 			if os.IsNotExist(err) {
-				err = removeInstalledObjects(rraObj, nil)
+				err = removeInstalledObjects(cc.ContainerRuntime, rraObj, nil)
 				if err != nil {
 					fmt.Println("error", err.Error())
 				}
@@ -231,7 +238,7 @@ func UninstallRRA() error {
 				return err
 			}
 		}
-		composeCmd, _, err := onboard.GetComposeCommand()
+		composeCmd, _, err := onboard.GetComposeCommand(cc.ContainerRuntime)
 		if err != nil {
 			return err
 		}
@@ -256,13 +263,14 @@ func UninstallRRA() error {
 	return os.ErrNotExist
 }
 
-func getRRAContainerObject() (map[string]dockerTypes.Container, error) {
+func getRRAContainerObject(runtime onboard.ContainerRuntime) (map[string]dockerTypes.Container, error) {
 
 	installedContainers := make(map[string]dockerTypes.Container, 0)
-	dockerClient, err := onboard.CreateDockerClient()
+	dockerClient, err := onboard.CreateContainerClient(runtime)
 	if err != nil {
-		return nil, fmt.Errorf("Failed to create docker client. %s", err.Error())
+		return nil, fmt.Errorf("Failed to create %s client. %s", runtime, err.Error())
 	}
+	defer dockerClient.Close()
 	containerList, err := dockerClient.ContainerList(context.Background(), dockerContainerTypes.ListOptions{
 		All: true,
 	})
@@ -279,13 +287,14 @@ func getRRAContainerObject() (map[string]dockerTypes.Container, error) {
 	return nil, nil
 }
 
-func getVMAContainerObject() (map[string]dockerTypes.Container, error) {
+func getVMAContainerObject(runtime onboard.ContainerRuntime) (map[string]dockerTypes.Container, error) {
 
 	installedContainers := make(map[string]dockerTypes.Container, 0)
-	dockerClient, err := onboard.CreateDockerClient()
+	dockerClient, err := onboard.CreateContainerClient(runtime)
 	if err != nil {
-		return nil, fmt.Errorf("Failed to create docker client. %s", err.Error())
+		return nil, fmt.Errorf("Failed to create %s client. %s", runtime, err.Error())
 	}
+	defer dockerClient.Close()
 	containerList, err := dockerClient.ContainerList(context.Background(), dockerContainerTypes.ListOptions{
 		All: true,
 	})
@@ -0,0 +1,423 @@
+package discover
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	policyType "github.com/accuknox/dev2/discover/pkg/common"
+)
+
+// collapseThreshold is the minimum number of sibling file paths, sharing the
+// same permissions and sources, that are collapsed into a single directory rule
+const collapseThreshold = 5
+
+// sensitiveDirs are never produced by collapsing file paths, allowing a whole
+// directory out of these would open up far more than what was discovered
+var sensitiveDirs = map[string]bool{
+	"/":          true,
+	"/bin/":      true,
+	"/boot/":     true,
+	"/dev/":      true,
+	"/etc/":      true,
+	"/proc/":     true,
+	"/root/":     true,
+	"/sbin/":     true,
+	"/sys/":      true,
+	"/usr/bin/":  true,
+	"/usr/sbin/": true,
+}
+
+// ConsolidationReport summarizes the reduction achieved by Consolidate
+type ConsolidationReport struct {
+	PoliciesBefore int
+	PoliciesAfter  int
+	RulesBefore    int
+	RulesAfter     int
+}
+
+func (r ConsolidationReport) String() string {
+	return fmt.Sprintf("Consolidated %d KubeArmor policies into %d (rules: %d -> %d)",
+		r.PoliciesBefore, r.PoliciesAfter, r.RulesBefore, r.RulesAfter)
+}
+
+// Consolidate merges the KubeArmor and KubeArmor host policies of every
+// namespace that share the same kind, action and selector, and drops rules
+// which are covered by broader ones. With collapse, sibling file paths are
+// collapsed into their directory where it is safe to do so, which allows more
+// than the discovered policies did.
+func (pf *PolicyForest) Consolidate(collapse bool) ConsolidationReport {
+	pf.Lock()
+	defer pf.Unlock()
+
+	var report ConsolidationReport
+
+	for ns, nsBucket := range pf.Namespaces {
+		if len(nsBucket.KubearmorPolicies.Policies) == 0 {
+			continue
+		}
+
+		names := make([]string, 0, len(nsBucket.KubearmorPolicies.Policies))
+		for name := range nsBucket.KubearmorPolicies.Policies {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		var merged []*policyType.KubeArmorPolicy
+		groups := make(map[string]*policyType.KubeArmorPolicy)
+
+		for _, name := range names {
+			policy := nsBucket.KubearmorPolicies.Policies[name]
+			report.PoliciesBefore++
+			report.RulesBefore += countRules(policy)
+
+			key := policy.Kind + "|" + policy.Spec.Action + "|" + serializeLabels(policySelector(policy))
+			if base, exists := groups[key]; exists {
+				mergePolicy(base, policy)
+				continue
+			}
+			groups[key] = policy
+			merged = append(merged, policy)
+		}
+
+		nsBucket.KubearmorPolicies = KubearmorPolicyBucket{}
+		for _, policy := range merged {
+			consolidateSys(&policy.Spec.Process, false)
+			consolidateSys(&policy.Spec.File, collapse)
+			policy.Spec.Network.MatchProtocols = consolidateProtocols(policy.Spec.Network.MatchProtocols)
+
+			report.PoliciesAfter++
+			report.RulesAfter += countRules(policy)
+
+			pf.AddKubearmorPolicy(ns, policy)
+		}
+	}
+
+	return report
+}
+
+// policySelector returns the labels selecting the workloads of a policy, or
+// the nodes of a host policy
+func policySelector(policy *policyType.KubeArmorPolicy) map[string]string {
+	if policy.Kind == KindKubeArmorHostPolicy {
+		return policy.Spec.NodeSelector.MatchLabels
+	}
+	return policy.Spec.Selector.MatchLabels
+}
+
+// mergePolicy appends all the rules of src into dst, the highest severity,
+// all the tags and the distinct messages of both are kept
+func mergePolicy(dst, src *policyType.KubeArmorPolicy) {
+	if src.Spec.Severity > dst.Spec.Severity {
+		dst.Spec.Severity = src.Spec.Severity
+	}
+	dst.Spec.Tags = mergeTags(dst.Spec.Tags, src.Spec.Tags)
+	dst.Spec.Message = mergeMessages(dst.Spec.Message, src.Spec.Message)
+
+	dst.Spec.Process.MatchPaths = append(dst.Spec.Process.MatchPaths, src.Spec.Process.MatchPaths...)
+	dst.Spec.Process.MatchDirectories = append(dst.Spec.Process.MatchDirectories, src.Spec.Process.MatchDirectories...)
+	dst.Spec.File.MatchPaths = append(dst.Spec.File.MatchPaths, src.Spec.File.MatchPaths...)
+	dst.Spec.File.MatchDirectories = append(dst.Spec.File.MatchDirectories, src.Spec.File.MatchDirectories...)
+	dst.Spec.Network.MatchProtocols = append(dst.Spec.Network.MatchProtocols, src.Spec.Network.MatchProtocols...)
+}
+
+func mergeTags(a, b []string) []string {
+	seen := make(map[string]bool)
+	var tags []string
+	for _, tag := range append(append([]string{}, a...), b...) {
+		if !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+func mergeMessages(a, b string) string {
+	switch {
+	case b == "":
+		return a
+	case a == "":
+		return b
+	}
+	for _, msg := range strings.Split(a, "; ") {
+		if msg == b {
+			return a
+		}
+	}
+	return a + "; " + b
+}
+
+func countRules(policy *policyType.KubeArmorPolicy) int {
+	return len(policy.Spec.Process.MatchPaths) + len(policy.Spec.Process.MatchDirectories) +
+		len(policy.Spec.File.MatchPaths) + len(policy.Spec.File.MatchDirectories) +
+		len(policy.Spec.Network.MatchProtocols)
+}
+
+// consolidateSys deduplicates the path and directory rules, optionally
+// collapses sibling paths into their directory and finally removes every
+// rule already covered by a broader directory rule.
+func consolidateSys(sys *policyType.KnoxSys, collapse bool) {
+	paths := dedupPaths(sys.MatchPaths)
+	dirs := dedupDirs(sys.MatchDirectories)
+
+	if collapse {
+		paths, dirs = collapsePaths(paths, dirs)
+		dirs = dedupDirs(dirs)
+	}
+
+	var keptDirs []policyType.KnoxMatchDirectories
+	for i, dir := range dirs {
+		covered := false
+		for j, other := range dirs {
+			if i == j {
+				continue
+			}
+			if dirCoversDir(other, dir) && (!dirCoversDir(dir, other) || j < i) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			keptDirs = append(keptDirs, dir)
+		}
+	}
+
+	var keptPaths []policyType.KnoxMatchPaths
+	for _, path := range paths {
+		covered := false
+		for _, dir := range keptDirs {
+			if dirCoversPath(dir, path) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			keptPaths = append(keptPaths, path)
+		}
+	}
+
+	sys.MatchPaths = keptPaths
+	sys.MatchDirectories = keptDirs
+}
+
+// dedupPaths merges the rules for the same path and permissions, the sources
+// of the merged rules are combined.
+func dedupPaths(paths []policyType.KnoxMatchPaths) []policyType.KnoxMatchPaths {
+	var result []policyType.KnoxMatchPaths
+	index := make(map[string]int)
+
+	for _, path := range paths {
+		key := fmt.Sprintf("%s|%t|%t", path.Path, path.ReadOnly, path.OwnerOnly)
+		if i, exists := index[key]; exists {
+			result[i].FromSource = unionSources(result[i].FromSource, path.FromSource)
+			continue
+		}
+		path.FromSource = normalizeSources(path.FromSource)
+		index[key] = len(result)
+		result = append(result, path)
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Path < result[j].Path
+	})
+	return result
+}
+
+// dedupDirs merges the rules for the same directory and permissions, the
+// sources of the merged rules are combined.
+func dedupDirs(dirs []policyType.KnoxMatchDirectories) []policyType.KnoxMatchDirectories {
+	var result []policyType.KnoxMatchDirectories
+	index := make(map[string]int)
+
+	for _, dir := range dirs {
+		key := fmt.Sprintf("%s|%t|%t|%t", dir.Dir, dir.Recursive, dir.ReadOnly, dir.OwnerOnly)
+		if i, exists := index[key]; exists {
+			result[i].FromSource = unionSources(result[i].FromSource, dir.FromSource)
+			continue
+		}
+		dir.FromSource = normalizeSources(dir.FromSource)
+		index[key] = len(result)
+		result = append(result, dir)
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Dir < result[j].Dir
+	})
+	return result
+}
+
+// unionSources combines two lists of sources. A rule without any source
+// applies to every process, so it absorbs any list it is combined with.
+func unionSources(a, b []policyType.KnoxFromSource) []policyType.KnoxFromSource {
+	if len(a) == 0 || len(b) == 0 {
+		return nil
+	}
+	return normalizeSources(append(append([]policyType.KnoxFromSource{}, a...), b...))
+}
+
+// normalizeSources removes duplicate sources and sorts them
+func normalizeSources(sources []policyType.KnoxFromSource) []policyType.KnoxFromSource {
+	seen := make(map[string]bool)
+	var result []policyType.KnoxFromSource
+	for _, src := range sources {
+		key := sourceKey(src)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		result = append(result, src)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return sourceKey(result[i]) < sourceKey(result[j])
+	})
+	return result
+}
+
+func sourceKey(src policyType.KnoxFromSource) string {
+	return fmt.Sprintf("%s|%s|%t", src.Path, src.Dir, src.Recursive)
+}
+
+func sourcesKey(sources []policyType.KnoxFromSource) string {
+	keys := make([]string, 0, len(sources))
+	for _, src := range sources {
+		keys = append(keys, sourceKey(src))
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ";")
+}
+
+// sourcesCover checks if a rule with the sources `broad` applies to at least
+// every process covered by a rule with the sources `narrow`
+func sourcesCover(broad, narrow []policyType.KnoxFromSource) bool {
+	if len(broad) == 0 {
+		return true
+	}
+	if len(narrow) == 0 {
+		return false
+	}
+
+	broadKeys := make(map[string]bool)
+	for _, src := range broad {
+		broadKeys[sourceKey(src)] = true
+	}
+	for _, src := range narrow {
+		if !broadKeys[sourceKey(src)] {
+			return false
+		}
+	}
+	return true
+}
+
+// permissionsCover checks that the broader rule does not restrict the access
+// any more than the narrower one does
+func permissionsCover(broadReadOnly, broadOwnerOnly, narrowReadOnly, narrowOwnerOnly bool) bool {
+	return (!broadReadOnly || narrowReadOnly) && (!broadOwnerOnly || narrowOwnerOnly)
+}
+
+func dirContains(dir string, recursive bool, path string) bool {
+	dir = ensureTrailingSlash(dir)
+	if !strings.HasPrefix(path, dir) || path == dir {
+		return false
+	}
+	if recursive {
+		return true
+	}
+	return !strings.Contains(strings.TrimSuffix(strings.TrimPrefix(path, dir), "/"), "/")
+}
+
+func dirCoversPath(dir policyType.KnoxMatchDirectories, path policyType.KnoxMatchPaths) bool {
+	return dirContains(dir.Dir, dir.Recursive, path.Path) &&
+		permissionsCover(dir.ReadOnly, dir.OwnerOnly, path.ReadOnly, path.OwnerOnly) &&
+		sourcesCover(dir.FromSource, path.FromSource)
+}
+
+func dirCoversDir(broad, narrow policyType.KnoxMatchDirectories) bool {
+	broadDir, narrowDir := ensureTrailingSlash(broad.Dir), ensureTrailingSlash(narrow.Dir)
+
+	var located bool
+	if broadDir == narrowDir {
+		located = broad.Recursive || !narrow.Recursive
+	} else {
+		located = broad.Recursive && strings.HasPrefix(narrowDir, broadDir)
+	}
+
+	return located &&
+		permissionsCover(broad.ReadOnly, broad.OwnerOnly, narrow.ReadOnly, narrow.OwnerOnly) &&
+		sourcesCover(broad.FromSource, narrow.FromSource)
+}
+
+// collapsePaths replaces sibling file paths with a rule for their parent
+// directory when there are enough of them sharing the same permissions and
+// sources, and the directory is not a sensitive one.
+func collapsePaths(paths []policyType.KnoxMatchPaths, dirs []policyType.KnoxMatchDirectories) ([]policyType.KnoxMatchPaths, []policyType.KnoxMatchDirectories) {
+	siblings := make(map[string][]int)
+	var order []string
+
+	for i, path := range paths {
+		parent := ensureTrailingSlash(filepath.Dir(path.Path))
+		key := fmt.Sprintf("%s|%t|%t|%s", parent, path.ReadOnly, path.OwnerOnly, sourcesKey(path.FromSource))
+		if _, exists := siblings[key]; !exists {
+			order = append(order, key)
+		}
+		siblings[key] = append(siblings[key], i)
+	}
+
+	collapsed := make(map[int]bool)
+	for _, key := range order {
+		indexes := siblings[key]
+		first := paths[indexes[0]]
+		parent := ensureTrailingSlash(filepath.Dir(first.Path))
+		if len(indexes) < collapseThreshold || sensitiveDirs[parent] {
+			continue
+		}
+
+		dirs = append(dirs, policyType.KnoxMatchDirectories{
+			Dir:        parent,
+			ReadOnly:   first.ReadOnly,
+			OwnerOnly:  first.OwnerOnly,
+			FromSource: first.FromSource,
+		})
+		for _, i := range indexes {
+			collapsed[i] = true
+		}
+	}
+
+	var remaining []policyType.KnoxMatchPaths
+	for i, path := range paths {
+		if !collapsed[i] {
+			remaining = append(remaining, path)
+		}
+	}
+
+	return remaining, dirs
+}
+
+// consolidateProtocols merges the rules for the same protocol
+func consolidateProtocols(protocols []policyType.KnoxMatchProtocols) []policyType.KnoxMatchProtocols {
+	var result []policyType.KnoxMatchProtocols
+	index := make(map[string]int)
+
+	for _, protocol := range protocols {
+		key := strings.ToLower(protocol.Protocol)
+		if i, exists := index[key]; exists {
+			result[i].FromSource = unionSources(result[i].FromSource, protocol.FromSource)
+			continue
+		}
+		protocol.FromSource = normalizeSources(protocol.FromSource)
+		index[key] = len(result)
+		result = append(result, protocol)
+	}
+
+	return result
+}
+
+func ensureTrailingSlash(dir string) string {
+	if strings.HasSuffix(dir, "/") {
+		return dir
+	}
+	return dir + "/"
+}
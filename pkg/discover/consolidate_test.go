@@ -0,0 +1,211 @@
+package discover
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	policyType "github.com/accuknox/dev2/discover/pkg/common"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func mockFilePolicy(name string, labels map[string]string, paths []policyType.KnoxMatchPaths, dirs []policyType.KnoxMatchDirectories) *policyType.KubeArmorPolicy {
+	return &policyType.KubeArmorPolicy{
+		APIVersion: "security.kubearmor.com/v1",
+		Kind:       KindKubeArmorPolicy,
+		Metadata: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+		},
+		Spec: policyType.KnoxSystemSpec{
+			Selector: policyType.Selector{
+				MatchLabels: labels,
+			},
+			File: policyType.KnoxSys{
+				MatchPaths:       paths,
+				MatchDirectories: dirs,
+			},
+			Action: "Allow",
+		},
+	}
+}
+
+func TestConsolidateMergesSameSelector(t *testing.T) {
+	pf := NewPolicyForest()
+	labels := map[string]string{"app": "web", "tier": "frontend"}
+
+	pf.AddKubearmorPolicy("default", mockFilePolicy("autopol-system-1", labels, []policyType.KnoxMatchPaths{
+		{Path: "/app/config.yaml", FromSource: []policyType.KnoxFromSource{{Path: "/app/server"}}},
+	}, nil))
+	pf.AddKubearmorPolicy("default", mockFilePolicy("autopol-system-2", labels, []policyType.KnoxMatchPaths{
+		{Path: "/app/config.yaml", FromSource: []policyType.KnoxFromSource{{Path: "/app/server"}}},
+		{Path: "/tmp/cache", FromSource: []policyType.KnoxFromSource{{Path: "/app/server"}}},
+	}, nil))
+	pf.AddKubearmorPolicy("default", mockFilePolicy("autopol-system-3", map[string]string{"app": "db"}, []policyType.KnoxMatchPaths{
+		{Path: "/var/lib/db/data"},
+	}, nil))
+
+	report := pf.Consolidate(false)
+
+	if report.PoliciesBefore != 3 || report.PoliciesAfter != 2 {
+		t.Errorf("policies = %d -> %d, want 3 -> 2", report.PoliciesBefore, report.PoliciesAfter)
+	}
+	if report.RulesBefore != 4 || report.RulesAfter != 3 {
+		t.Errorf("rules = %d -> %d, want 4 -> 3", report.RulesBefore, report.RulesAfter)
+	}
+
+	policy := pf.Namespaces["default"].KubearmorPolicies.Policies["autopol-system-1"]
+	if policy == nil {
+		t.Fatalf("merged policy autopol-system-1 not found")
+	}
+	if got := len(policy.Spec.File.MatchPaths); got != 2 {
+		t.Errorf("merged policy has %d paths, want 2", got)
+	}
+	if _, exists := pf.Namespaces["default"].KubearmorPolicies.Policies["autopol-system-2"]; exists {
+		t.Errorf("autopol-system-2 should have been merged")
+	}
+}
+
+func TestConsolidateHostPolicies(t *testing.T) {
+	pf := NewPolicyForest()
+	hostPolicy := func(name, hostname string, severity int, tags []string, message, path string) *policyType.KubeArmorPolicy {
+		policy := mockFilePolicy(name, nil, []policyType.KnoxMatchPaths{{Path: path}}, nil)
+		policy.Kind = KindKubeArmorHostPolicy
+		policy.Metadata.Namespace = ""
+		policy.Spec.NodeSelector.MatchLabels = map[string]string{"kubernetes.io/hostname": hostname}
+		policy.Spec.Severity = severity
+		policy.Spec.Tags = tags
+		policy.Spec.Message = message
+		return policy
+	}
+
+	pf.AddKubearmorPolicy("", hostPolicy("autopol-host-1", "node-a", 3, []string{"NIST"}, "allow config", "/etc/app.conf"))
+	pf.AddKubearmorPolicy("", hostPolicy("autopol-host-2", "node-a", 7, []string{"MITRE", "NIST"}, "allow logs", "/var/log/app.log"))
+	pf.AddKubearmorPolicy("", hostPolicy("autopol-host-3", "node-b", 1, nil, "", "/etc/app.conf"))
+
+	report := pf.Consolidate(false)
+	if report.PoliciesBefore != 3 || report.PoliciesAfter != 2 {
+		t.Errorf("policies = %d -> %d, want 3 -> 2, host policies of other nodes are kept apart", report.PoliciesBefore, report.PoliciesAfter)
+	}
+
+	policy := pf.Namespaces[""].KubearmorPolicies.Policies["autopol-host-1"]
+	if policy == nil {
+		t.Fatalf("merged policy autopol-host-1 not found")
+	}
+	if policy.Spec.Severity != 7 {
+		t.Errorf("merged severity = %d, want the highest 7", policy.Spec.Severity)
+	}
+	if got := strings.Join(policy.Spec.Tags, ","); got != "MITRE,NIST" {
+		t.Errorf("merged tags = %s, want MITRE,NIST", got)
+	}
+	if policy.Spec.Message != "allow config; allow logs" {
+		t.Errorf("merged message = %q", policy.Spec.Message)
+	}
+	if got := len(policy.Spec.File.MatchPaths); got != 2 {
+		t.Errorf("merged policy has %d paths, want 2", got)
+	}
+}
+
+func TestConsolidateSys(t *testing.T) {
+	server := []policyType.KnoxFromSource{{Path: "/app/server"}}
+
+	var siblings []policyType.KnoxMatchPaths
+	for i := 0; i < collapseThreshold; i++ {
+		siblings = append(siblings, policyType.KnoxMatchPaths{Path: fmt.Sprintf("/app/static/%d.js", i), ReadOnly: true, FromSource: server})
+	}
+
+	tests := []struct {
+		name      string
+		sys       policyType.KnoxSys
+		collapse  bool
+		wantPaths int
+		wantDirs  int
+	}{
+		{
+			name: "path covered by recursive directory is removed",
+			sys: policyType.KnoxSys{
+				MatchPaths:       []policyType.KnoxMatchPaths{{Path: "/app/data/a/b.txt", FromSource: server}},
+				MatchDirectories: []policyType.KnoxMatchDirectories{{Dir: "/app/data/", Recursive: true}},
+			},
+			wantPaths: 0,
+			wantDirs:  1,
+		},
+		{
+			name: "path below non recursive directory is kept",
+			sys: policyType.KnoxSys{
+				MatchPaths:       []policyType.KnoxMatchPaths{{Path: "/app/data/a/b.txt"}},
+				MatchDirectories: []policyType.KnoxMatchDirectories{{Dir: "/app/data/"}},
+			},
+			wantPaths: 1,
+			wantDirs:  1,
+		},
+		{
+			name: "read only directory does not cover writable path",
+			sys: policyType.KnoxSys{
+				MatchPaths:       []policyType.KnoxMatchPaths{{Path: "/app/data/b.txt"}},
+				MatchDirectories: []policyType.KnoxMatchDirectories{{Dir: "/app/data/", ReadOnly: true}},
+			},
+			wantPaths: 1,
+			wantDirs:  1,
+		},
+		{
+			name: "directory limited to other sources does not cover path",
+			sys: policyType.KnoxSys{
+				MatchPaths:       []policyType.KnoxMatchPaths{{Path: "/app/data/b.txt", FromSource: server}},
+				MatchDirectories: []policyType.KnoxMatchDirectories{{Dir: "/app/data/", FromSource: []policyType.KnoxFromSource{{Path: "/bin/sh"}}}},
+			},
+			wantPaths: 1,
+			wantDirs:  1,
+		},
+		{
+			name: "nested directory covered by recursive parent is removed",
+			sys: policyType.KnoxSys{
+				MatchDirectories: []policyType.KnoxMatchDirectories{{Dir: "/app/", Recursive: true}, {Dir: "/app/logs/"}},
+			},
+			wantDirs: 1,
+		},
+		{
+			name:      "sibling paths are collapsed into their directory",
+			sys:       policyType.KnoxSys{MatchPaths: siblings},
+			collapse:  true,
+			wantPaths: 0,
+			wantDirs:  1,
+		},
+		{
+			name:      "sibling paths are kept without collapsing",
+			sys:       policyType.KnoxSys{MatchPaths: siblings},
+			wantPaths: collapseThreshold,
+		},
+		{
+			name: "sensitive directories are never collapsed",
+			sys: policyType.KnoxSys{MatchPaths: []policyType.KnoxMatchPaths{
+				{Path: "/etc/passwd"}, {Path: "/etc/group"}, {Path: "/etc/hosts"}, {Path: "/etc/resolv.conf"}, {Path: "/etc/shadow"},
+			}},
+			collapse:  true,
+			wantPaths: 5,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sys := tt.sys
+			consolidateSys(&sys, tt.collapse)
+			if len(sys.MatchPaths) != tt.wantPaths || len(sys.MatchDirectories) != tt.wantDirs {
+				t.Errorf("consolidateSys() = %d paths, %d dirs, want %d paths, %d dirs",
+					len(sys.MatchPaths), len(sys.MatchDirectories), tt.wantPaths, tt.wantDirs)
+			}
+		})
+	}
+}
+
+func TestUnionSources(t *testing.T) {
+	a := []policyType.KnoxFromSource{{Path: "/bin/a"}}
+	b := []policyType.KnoxFromSource{{Path: "/bin/b"}, {Path: "/bin/a"}}
+
+	if got := unionSources(a, b); len(got) != 2 {
+		t.Errorf("unionSources() returned %d sources, want 2", len(got))
+	}
+	if got := unionSources(a, nil); len(got) != 0 {
+		t.Errorf("unionSources() with an unrestricted rule returned %d sources, want 0", len(got))
+	}
+}
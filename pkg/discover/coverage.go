@@ -0,0 +1,545 @@
+package discover
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/kubearmor/kubearmor-client/k8s"
+	"github.com/olekukonko/tablewriter"
+
+	kspAPI "github.com/kubearmor/KubeArmor/pkg/KubeArmorController/api/security.kubearmor.com/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const (
+	CoverageUnprotected = "Unprotected"
+	CoverageAudit       = "Audit only"
+	CoverageEnforcing   = "Enforcing"
+
+	FmtMarkdown = "markdown"
+
+	sourceApplied    = "applied"
+	sourceDiscovered = "discovered"
+)
+
+// CoverageOptions for the coverage report
+type CoverageOptions struct {
+	GRPC           string
+	Namespace      []string
+	Output         string
+	SkipDiscovered bool
+}
+
+// Workload is a pod controller, or a standalone pod, running in the cluster
+type Workload struct {
+	Namespace string            `json:"namespace"`
+	Kind      string            `json:"kind"`
+	Name      string            `json:"name"`
+	Labels    map[string]string `json:"labels,omitempty"`
+}
+
+// WorkloadCoverage holds the policies that select a workload
+type WorkloadCoverage struct {
+	Workload
+	Status             string   `json:"status"`
+	AppliedPolicies    []string `json:"appliedPolicies"`
+	DiscoveredPolicies []string `json:"discoveredPolicies"`
+}
+
+// NamespaceCoverage is a row of the coverage matrix
+type NamespaceCoverage struct {
+	Namespace   string `json:"namespace"`
+	Workloads   int    `json:"workloads"`
+	Unprotected int    `json:"unprotected"`
+	AuditOnly   int    `json:"auditOnly"`
+	Enforcing   int    `json:"enforcing"`
+	Discovered  int    `json:"withDiscoveredPolicies"`
+}
+
+// CoverageReport is the result of matching the workloads against the policies
+type CoverageReport struct {
+	Namespaces []NamespaceCoverage `json:"namespaces"`
+	Workloads  []WorkloadCoverage  `json:"workloads"`
+}
+
+// coveragePolicy is the common form of the KubeArmor and network policies
+// needed to check which workloads they select
+type coveragePolicy struct {
+	Source    string
+	Kind      string
+	Namespace string
+	Name      string
+	Selector  labels.Selector
+	Enforcing bool
+}
+
+// Coverage lists the workloads of the cluster along with the applied and
+// discovered policies selecting them
+func Coverage(c *k8s.Client, o CoverageOptions) error {
+	switch o.Output {
+	case "", FmtTable, FmtJSON, FmtMarkdown:
+	default:
+		return fmt.Errorf("invalid output format %s, supported formats: table, json, markdown", o.Output)
+	}
+
+	workloads, err := listWorkloads(c, o.Namespace)
+	if err != nil {
+		return err
+	}
+
+	policies, err := listAppliedPolicies(c, o.Namespace)
+	if err != nil {
+		return err
+	}
+
+	if !o.SkipDiscovered {
+		discovered, err := listDiscoveredPolicies(c, o)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: skipping discovered policies: %v\n", err)
+		}
+		policies = append(policies, discovered...)
+	}
+
+	report := computeCoverage(workloads, policies)
+
+	switch o.Output {
+	case FmtJSON:
+		out, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(out))
+	case FmtMarkdown:
+		printCoverageMarkdown(os.Stdout, report)
+	default:
+		printCoverageTable(report)
+	}
+
+	return nil
+}
+
+func namespacesToQuery(namespaces []string) []string {
+	if len(namespaces) == 0 {
+		return []string{metav1.NamespaceAll}
+	}
+	return namespaces
+}
+
+// listWorkloads returns the deployments, statefulsets, daemonsets, cronjobs,
+// the jobs not created by a cronjob and the pods which are not managed by any
+// controller
+func listWorkloads(c *k8s.Client, namespaces []string) ([]Workload, error) {
+	ctx := context.Background()
+	var workloads []Workload
+
+	for _, ns := range namespacesToQuery(namespaces) {
+		deployments, err := c.K8sClientset.AppsV1().Deployments(ns).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list deployments: %v", err)
+		}
+		for _, d := range deployments.Items {
+			workloads = append(workloads, Workload{d.Namespace, "Deployment", d.Name, d.Spec.Template.Labels})
+		}
+
+		statefulSets, err := c.K8sClientset.AppsV1().StatefulSets(ns).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list statefulsets: %v", err)
+		}
+		for _, s := range statefulSets.Items {
+			workloads = append(workloads, Workload{s.Namespace, "StatefulSet", s.Name, s.Spec.Template.Labels})
+		}
+
+		daemonSets, err := c.K8sClientset.AppsV1().DaemonSets(ns).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list daemonsets: %v", err)
+		}
+		for _, d := range daemonSets.Items {
+			workloads = append(workloads, Workload{d.Namespace, "DaemonSet", d.Name, d.Spec.Template.Labels})
+		}
+
+		cronJobs, err := c.K8sClientset.BatchV1().CronJobs(ns).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list cronjobs: %v", err)
+		}
+		for _, cj := range cronJobs.Items {
+			workloads = append(workloads, Workload{cj.Namespace, "CronJob", cj.Name, cj.Spec.JobTemplate.Spec.Template.Labels})
+		}
+
+		jobs, err := c.K8sClientset.BatchV1().Jobs(ns).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list jobs: %v", err)
+		}
+		for _, j := range jobs.Items {
+			// jobs created by a cronjob are covered by the cronjob
+			if ownedBy(j.OwnerReferences, "CronJob") {
+				continue
+			}
+			workloads = append(workloads, Workload{j.Namespace, "Job", j.Name, j.Spec.Template.Labels})
+		}
+
+		pods, err := c.K8sClientset.CoreV1().Pods(ns).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list pods: %v", err)
+		}
+		for _, p := range pods.Items {
+			if len(p.OwnerReferences) == 0 {
+				workloads = append(workloads, Workload{p.Namespace, "Pod", p.Name, p.Labels})
+			}
+		}
+	}
+
+	return workloads, nil
+}
+
+// ownedBy reports whether one of the owners is of the given kind
+func ownedBy(owners []metav1.OwnerReference, kind string) bool {
+	for _, owner := range owners {
+		if owner.Kind == kind {
+			return true
+		}
+	}
+	return false
+}
+
+func listAppliedPolicies(c *k8s.Client, namespaces []string) ([]coveragePolicy, error) {
+	ctx := context.Background()
+	var policies []coveragePolicy
+
+	for _, ns := range namespacesToQuery(namespaces) {
+		ksps, err := c.KSPClientset.KubeArmorPolicies(ns).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list KubeArmor policies: %v", err)
+		}
+		for _, ksp := range ksps.Items {
+			selector, err := kubearmorSelector(ksp.Spec.Selector)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: skipping KubeArmor policy %s/%s: %v\n", ksp.Namespace, ksp.Name, err)
+				continue
+			}
+			policies = append(policies, coveragePolicy{
+				Source:    sourceApplied,
+				Kind:      KindKubeArmorPolicy,
+				Namespace: ksp.Namespace,
+				Name:      ksp.Name,
+				Selector:  selector,
+				Enforcing: kubearmorSpecEnforces(ksp.Spec),
+			})
+		}
+
+		netpols, err := c.K8sClientset.NetworkingV1().NetworkPolicies(ns).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list network policies: %v", err)
+		}
+		for i := range netpols.Items {
+			policy, err := networkCoveragePolicy(&netpols.Items[i], sourceApplied)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: skipping network policy %s/%s: %v\n", netpols.Items[i].Namespace, netpols.Items[i].Name, err)
+				continue
+			}
+			policies = append(policies, policy)
+		}
+	}
+
+	return policies, nil
+}
+
+func listDiscoveredPolicies(c *k8s.Client, o CoverageOptions) ([]coveragePolicy, error) {
+	defer disconnect()
+
+	if err := initConnection(c, &Options{GRPC: o.GRPC}); err != nil {
+		return nil, err
+	}
+
+	pf := NewPolicyForest()
+	opts := &Options{Namespace: o.Namespace}
+	if err := getKaPolicy(c, opts, pf); err != nil {
+		return nil, err
+	}
+	if err := getNetworkPolicy(c, opts, pf); err != nil {
+		return nil, err
+	}
+
+	var policies []coveragePolicy
+	for ns, nsBucket := range pf.Namespaces {
+		for name, policy := range nsBucket.KubearmorPolicies.Policies {
+			policies = append(policies, coveragePolicy{
+				Source:    sourceDiscovered,
+				Kind:      policy.Kind,
+				Namespace: ns,
+				Name:      name,
+				Selector:  labels.SelectorFromSet(policy.Spec.Selector.MatchLabels),
+				Enforcing: policy.Spec.Action != "Audit",
+			})
+		}
+		for _, policy := range nsBucket.NetworkPolicies.Policies {
+			cp, err := networkCoveragePolicy(policy, sourceDiscovered)
+			if err != nil {
+				continue
+			}
+			policies = append(policies, cp)
+		}
+	}
+
+	return policies, nil
+}
+
+func networkCoveragePolicy(policy *networkingv1.NetworkPolicy, source string) (coveragePolicy, error) {
+	selector, err := metav1.LabelSelectorAsSelector(&policy.Spec.PodSelector)
+	if err != nil {
+		return coveragePolicy{}, err
+	}
+	return coveragePolicy{
+		Source:    source,
+		Kind:      KindK8sNetworkPolicy,
+		Namespace: policy.Namespace,
+		Name:      policy.Name,
+		Selector:  selector,
+		Enforcing: true,
+	}, nil
+}
+
+// kubearmorSelector converts the selector of a KubeArmor policy, where the
+// match expressions always apply to the labels of the workload
+func kubearmorSelector(selector kspAPI.SelectorType) (labels.Selector, error) {
+	ls := &metav1.LabelSelector{MatchLabels: selector.MatchLabels}
+	for _, expr := range selector.MatchExpressions {
+		for _, value := range expr.Values {
+			// values of label expressions are in the key=value form
+			kv := strings.SplitN(value, "=", 2)
+			if len(kv) != 2 {
+				return nil, fmt.Errorf("invalid match expression value %q", value)
+			}
+			ls.MatchExpressions = append(ls.MatchExpressions, metav1.LabelSelectorRequirement{
+				Key:      kv[0],
+				Operator: metav1.LabelSelectorOperator(expr.Operator),
+				Values:   []string{kv[1]},
+			})
+		}
+	}
+	return metav1.LabelSelectorAsSelector(ls)
+}
+
+// kubearmorSpecEnforces reports whether any rule of the policy allows or
+// blocks, rather than only audits, an operation. KubeArmor blocks when the
+// action is not set.
+func kubearmorSpecEnforces(spec kspAPI.KubeArmorPolicySpec) bool {
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return spec.Action != "Audit"
+	}
+	var raw interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return spec.Action != "Audit"
+	}
+
+	actions := collectActions(raw, nil)
+	if len(actions) == 0 {
+		return true
+	}
+	for _, action := range actions {
+		if action != "Audit" {
+			return true
+		}
+	}
+	return false
+}
+
+// collectActions returns the value of every `action` key in the spec
+func collectActions(v interface{}, actions []string) []string {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, child := range val {
+			if action, ok := child.(string); ok && k == "action" && action != "" {
+				actions = append(actions, action)
+				continue
+			}
+			actions = collectActions(child, actions)
+		}
+	case []interface{}:
+		for _, child := range val {
+			actions = collectActions(child, actions)
+		}
+	}
+	return actions
+}
+
+func computeCoverage(workloads []Workload, policies []coveragePolicy) *CoverageReport {
+	sort.Slice(workloads, func(i, j int) bool {
+		if workloads[i].Namespace != workloads[j].Namespace {
+			return workloads[i].Namespace < workloads[j].Namespace
+		}
+		if workloads[i].Kind != workloads[j].Kind {
+			return workloads[i].Kind < workloads[j].Kind
+		}
+		return workloads[i].Name < workloads[j].Name
+	})
+
+	report := &CoverageReport{
+		Namespaces: []NamespaceCoverage{},
+		Workloads:  []WorkloadCoverage{},
+	}
+	namespaces := make(map[string]*NamespaceCoverage)
+
+	for _, w := range workloads {
+		wc := WorkloadCoverage{
+			Workload:           w,
+			Status:             CoverageUnprotected,
+			AppliedPolicies:    []string{},
+			DiscoveredPolicies: []string{},
+		}
+
+		for _, p := range policies {
+			if p.Namespace != w.Namespace || !p.Selector.Matches(labels.Set(w.Labels)) {
+				continue
+			}
+			name := p.Kind + "/" + p.Name
+			if p.Source == sourceDiscovered {
+				wc.DiscoveredPolicies = append(wc.DiscoveredPolicies, name)
+				continue
+			}
+			wc.AppliedPolicies = append(wc.AppliedPolicies, name)
+			if p.Enforcing {
+				wc.Status = CoverageEnforcing
+			} else if wc.Status == CoverageUnprotected {
+				wc.Status = CoverageAudit
+			}
+		}
+		sort.Strings(wc.AppliedPolicies)
+		sort.Strings(wc.DiscoveredPolicies)
+
+		nc, exists := namespaces[w.Namespace]
+		if !exists {
+			nc = &NamespaceCoverage{Namespace: w.Namespace}
+			namespaces[w.Namespace] = nc
+		}
+		nc.Workloads++
+		switch wc.Status {
+		case CoverageUnprotected:
+			nc.Unprotected++
+		case CoverageAudit:
+			nc.AuditOnly++
+		case CoverageEnforcing:
+			nc.Enforcing++
+		}
+		if len(wc.DiscoveredPolicies) > 0 {
+			nc.Discovered++
+		}
+
+		report.Workloads = append(report.Workloads, wc)
+	}
+
+	for _, w := range report.Workloads {
+		if nc, exists := namespaces[w.Namespace]; exists {
+			report.Namespaces = append(report.Namespaces, *nc)
+			delete(namespaces, w.Namespace)
+		}
+	}
+
+	return report
+}
+
+func coverageMatrixRows(report *CoverageReport) [][]string {
+	var rows [][]string
+	var total NamespaceCoverage
+	for _, nc := range report.Namespaces {
+		rows = append(rows, []string{nc.Namespace, fmt.Sprint(nc.Workloads), fmt.Sprint(nc.Unprotected),
+			fmt.Sprint(nc.AuditOnly), fmt.Sprint(nc.Enforcing), fmt.Sprint(nc.Discovered)})
+		total.Workloads += nc.Workloads
+		total.Unprotected += nc.Unprotected
+		total.AuditOnly += nc.AuditOnly
+		total.Enforcing += nc.Enforcing
+		total.Discovered += nc.Discovered
+	}
+	rows = append(rows, []string{"Total", fmt.Sprint(total.Workloads), fmt.Sprint(total.Unprotected),
+		fmt.Sprint(total.AuditOnly), fmt.Sprint(total.Enforcing), fmt.Sprint(total.Discovered)})
+	return rows
+}
+
+var coverageMatrixHeader = []string{"Namespace", "Workloads", "Unprotected", "Audit only", "Enforcing", "With discovered policies"}
+
+// uncoveredWorkloads returns the workloads that are not enforced by any policy
+func uncoveredWorkloads(report *CoverageReport) [][]string {
+	var rows [][]string
+	for _, w := range report.Workloads {
+		if w.Status == CoverageEnforcing {
+			continue
+		}
+		rows = append(rows, []string{w.Namespace, w.Kind + "/" + w.Name, w.Status,
+			strings.Join(w.AppliedPolicies, ", "), fmt.Sprint(len(w.DiscoveredPolicies))})
+	}
+	return rows
+}
+
+var uncoveredHeader = []string{"Namespace", "Workload", "Status", "Applied policies", "Discovered policies"}
+
+func printCoverageTable(report *CoverageReport) {
+	if len(report.Workloads) == 0 {
+		fmt.Println("No workloads found.")
+		return
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader(coverageMatrixHeader)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.AppendBulk(coverageMatrixRows(report))
+	table.Render()
+
+	rows := uncoveredWorkloads(report)
+	if len(rows) == 0 {
+		return
+	}
+
+	fmt.Println("\nWorkloads without enforcing policies:")
+	table = tablewriter.NewWriter(os.Stdout)
+	table.SetHeader(uncoveredHeader)
+	table.SetAutoWrapText(false)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.AppendBulk(rows)
+	table.Render()
+}
+
+func printCoverageMarkdown(w io.Writer, report *CoverageReport) {
+	writeRow := func(cells []string) {
+		fmt.Fprintf(w, "| %s |\n", strings.Join(cells, " | "))
+	}
+	writeHeader := func(header []string) {
+		writeRow(header)
+		sep := make([]string, len(header))
+		for i := range sep {
+			sep[i] = "---"
+		}
+		writeRow(sep)
+	}
+
+	fmt.Fprintln(w, "# Policy coverage")
+	fmt.Fprintln(w)
+	if len(report.Workloads) == 0 {
+		fmt.Fprintln(w, "No workloads found.")
+		return
+	}
+
+	writeHeader(coverageMatrixHeader)
+	for _, row := range coverageMatrixRows(report) {
+		writeRow(row)
+	}
+
+	rows := uncoveredWorkloads(report)
+	if len(rows) == 0 {
+		return
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "## Workloads without enforcing policies")
+	fmt.Fprintln(w)
+	writeHeader(uncoveredHeader)
+	for _, row := range rows {
+		writeRow(row)
+	}
+}
@@ -0,0 +1,161 @@
+package discover
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	kspAPI "github.com/kubearmor/KubeArmor/pkg/KubeArmorController/api/security.kubearmor.com/v1"
+	"github.com/kubearmor/kubearmor-client/k8s"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestComputeCoverage(t *testing.T) {
+	workloads := []Workload{
+		{Namespace: "default", Kind: "Deployment", Name: "web", Labels: map[string]string{"app": "web"}},
+		{Namespace: "default", Kind: "Deployment", Name: "db", Labels: map[string]string{"app": "db"}},
+		{Namespace: "default", Kind: "Pod", Name: "debug", Labels: map[string]string{"run": "debug"}},
+		{Namespace: "shop", Kind: "StatefulSet", Name: "cart", Labels: map[string]string{"app": "cart"}},
+	}
+	policies := []coveragePolicy{
+		{Source: sourceApplied, Kind: KindKubeArmorPolicy, Namespace: "default", Name: "web-block",
+			Selector: labels.SelectorFromSet(map[string]string{"app": "web"}), Enforcing: true},
+		{Source: sourceApplied, Kind: KindKubeArmorPolicy, Namespace: "default", Name: "db-audit",
+			Selector: labels.SelectorFromSet(map[string]string{"app": "db"})},
+		{Source: sourceDiscovered, Kind: KindKubeArmorPolicy, Namespace: "default", Name: "autopol-system-1",
+			Selector: labels.SelectorFromSet(map[string]string{"run": "debug"}), Enforcing: true},
+		// same labels in another namespace must not match
+		{Source: sourceApplied, Kind: KindK8sNetworkPolicy, Namespace: "other", Name: "cart",
+			Selector: labels.SelectorFromSet(map[string]string{"app": "cart"}), Enforcing: true},
+	}
+
+	report := computeCoverage(workloads, policies)
+
+	want := map[string]string{
+		"web":   CoverageEnforcing,
+		"db":    CoverageAudit,
+		"debug": CoverageUnprotected,
+		"cart":  CoverageUnprotected,
+	}
+	for _, w := range report.Workloads {
+		if w.Status != want[w.Name] {
+			t.Errorf("workload %s has status %q, want %q", w.Name, w.Status, want[w.Name])
+		}
+	}
+
+	if len(report.Namespaces) != 2 {
+		t.Fatalf("got %d namespaces, want 2", len(report.Namespaces))
+	}
+	ns := report.Namespaces[0]
+	if ns.Namespace != "default" || ns.Workloads != 3 || ns.Unprotected != 1 || ns.AuditOnly != 1 || ns.Enforcing != 1 || ns.Discovered != 1 {
+		t.Errorf("unexpected coverage for default: %+v", ns)
+	}
+
+	var buf bytes.Buffer
+	printCoverageMarkdown(&buf, report)
+	if !strings.Contains(buf.String(), "| default | 3 | 1 | 1 | 1 | 1 |") {
+		t.Errorf("markdown output is missing the default namespace row:\n%s", buf.String())
+	}
+	if !strings.Contains(buf.String(), "| Total | 4 | 2 | 1 | 1 | 1 |") {
+		t.Errorf("markdown output is missing the total row:\n%s", buf.String())
+	}
+}
+
+func TestKubearmorSpecEnforces(t *testing.T) {
+	tests := []struct {
+		name string
+		spec kspAPI.KubeArmorPolicySpec
+		want bool
+	}{
+		{
+			name: "audit policy",
+			spec: kspAPI.KubeArmorPolicySpec{
+				Process: kspAPI.ProcessType{MatchPaths: []kspAPI.ProcessPathType{{Path: "/bin/sh"}}},
+				Action:  "Audit",
+			},
+			want: false,
+		},
+		{
+			name: "block rule in audit policy",
+			spec: kspAPI.KubeArmorPolicySpec{
+				Process: kspAPI.ProcessType{MatchPaths: []kspAPI.ProcessPathType{{Path: "/bin/sh", Action: "Block"}}},
+				Action:  "Audit",
+			},
+			want: true,
+		},
+		{
+			name: "no action defaults to block",
+			spec: kspAPI.KubeArmorPolicySpec{
+				Process: kspAPI.ProcessType{MatchPaths: []kspAPI.ProcessPathType{{Path: "/bin/sh"}}},
+			},
+			want: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := kubearmorSpecEnforces(tt.spec); got != tt.want {
+				t.Errorf("kubearmorSpecEnforces() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKubearmorSelector(t *testing.T) {
+	selector, err := kubearmorSelector(kspAPI.SelectorType{
+		MatchLabels: map[string]string{"app": "web"},
+		MatchExpressions: []kspAPI.MatchExpressionsType{
+			{Key: "label", Operator: "NotIn", Values: []string{"env=dev"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("kubearmorSelector() error = %v", err)
+	}
+	if !selector.Matches(labels.Set{"app": "web", "env": "prod"}) {
+		t.Errorf("selector should match app=web,env=prod")
+	}
+	if selector.Matches(labels.Set{"app": "web", "env": "dev"}) {
+		t.Errorf("selector should not match app=web,env=dev")
+	}
+}
+
+func TestListWorkloadsJobs(t *testing.T) {
+	template := func(app string) corev1.PodTemplateSpec {
+		return corev1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": app}}}
+	}
+	cronJobOwner := []metav1.OwnerReference{{Kind: "CronJob", Name: "backup"}}
+	jobOwner := []metav1.OwnerReference{{Kind: "Job", Name: "migrate"}}
+
+	c := &k8s.Client{K8sClientset: fake.NewSimpleClientset(
+		&batchv1.CronJob{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "backup"},
+			Spec:       batchv1.CronJobSpec{JobTemplate: batchv1.JobTemplateSpec{Spec: batchv1.JobSpec{Template: template("backup")}}},
+		},
+		&batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "backup-28000000", OwnerReferences: cronJobOwner},
+			Spec:       batchv1.JobSpec{Template: template("backup")},
+		},
+		&batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "migrate"},
+			Spec:       batchv1.JobSpec{Template: template("migrate")},
+		},
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "migrate-x7k2p", OwnerReferences: jobOwner}},
+	)}
+
+	workloads, err := listWorkloads(c, nil)
+	if err != nil {
+		t.Fatalf("listWorkloads() error = %v", err)
+	}
+	want := []Workload{
+		{Namespace: "default", Kind: "CronJob", Name: "backup", Labels: map[string]string{"app": "backup"}},
+		{Namespace: "default", Kind: "Job", Name: "migrate", Labels: map[string]string{"app": "migrate"}},
+	}
+	if !reflect.DeepEqual(workloads, want) {
+		t.Errorf("listWorkloads() = %+v, want %+v", workloads, want)
+	}
+}
@@ -4,6 +4,7 @@ package discover
 import (
 	"errors"
 	"fmt"
+	"os"
 	"strings"
 	"sync"
 
@@ -68,6 +69,11 @@ func Policy(c *k8s.Client, parsedArgs *Options) error {
 
 	wg.Wait()
 
+	if len(policyForest.Namespaces) != 0 && !parsedArgs.Raw {
+		// the report goes to stderr so that json and yaml output stay valid
+		fmt.Fprintln(os.Stderr, policyForest.Consolidate(parsedArgs.CollapseDirs))
+	}
+
 	if len(policyForest.Namespaces) != 0 {
 		switch {
 		case parsedArgs.View == FmtYAML:
@@ -86,7 +92,7 @@ func Policy(c *k8s.Client, parsedArgs *Options) error {
 			}
 
 		default:
-			StartTUI(policyForest)
+			StartTUI(c, policyForest)
 		}
 	} else {
 		fmt.Println("No policies found.")
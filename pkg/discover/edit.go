@@ -0,0 +1,523 @@
+package discover
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/clarketm/json"
+	"github.com/kubearmor/kubearmor-client/k8s"
+	"sigs.k8s.io/yaml"
+
+	policyType "github.com/accuknox/dev2/discover/pkg/common"
+	kspAPI "github.com/kubearmor/KubeArmor/pkg/KubeArmorController/api/security.kubearmor.com/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Actions a KubeArmor policy can be switched between, in the order they are
+// cycled through in the TUI
+var policyActions = []string{"Audit", "Allow", "Block"}
+
+// Policies which were modified or marked in the TUI and are yet to be written
+// out or applied, keyed by policyKey
+var pendingChanges = make(map[string]*pendingChange)
+
+// pendingChange is a policy that was modified or marked in the TUI
+type pendingChange struct {
+	Policy     interface{}
+	PolicyType string
+	Namespace  string
+	Name       string
+	Changes    []string
+	Marked     bool
+}
+
+// ruleRef points to a single rule of a KubeArmor policy, it is used as the
+// reference of the rule nodes in the policy tree
+type ruleRef struct {
+	Policy  *policyType.KubeArmorPolicy
+	Section string // process, file or network
+	Kind    string // path, dir or protocol
+	Index   int
+}
+
+// nextAction returns the action that follows the given one in policyActions
+func nextAction(action string) string {
+	for i, a := range policyActions {
+		if strings.EqualFold(a, action) {
+			return policyActions[(i+1)%len(policyActions)]
+		}
+	}
+	return policyActions[0]
+}
+
+// policyInfo returns the key, type, namespace and name of a policy held by
+// the policy tree
+func policyInfo(policy interface{}) (string, string, string, string) {
+	switch p := policy.(type) {
+	case *policyType.KubeArmorPolicy:
+		return p.Kind + "/" + p.Metadata.Namespace + "/" + p.Metadata.Name, "kubearmor_policy", p.Metadata.Namespace, p.Metadata.Name
+	case *networkingv1.NetworkPolicy:
+		return KindK8sNetworkPolicy + "/" + p.Namespace + "/" + p.Name, "network_policy", p.Namespace, p.Name
+	}
+	return "", "", "", ""
+}
+
+// trackChange records a change made to a policy in the pending changes
+func trackChange(policy interface{}, change string) *pendingChange {
+	key, polType, ns, name := policyInfo(policy)
+	pc, exists := pendingChanges[key]
+	if !exists {
+		pc = &pendingChange{
+			Policy:     policy,
+			PolicyType: polType,
+			Namespace:  ns,
+			Name:       name,
+		}
+		pendingChanges[key] = pc
+	}
+	if change != "" {
+		pc.Changes = append(pc.Changes, change)
+	}
+	return pc
+}
+
+// toggleMark marks or unmarks a policy for batch apply or export
+func toggleMark(policy interface{}) bool {
+	pc := trackChange(policy, "")
+	pc.Marked = !pc.Marked
+	if !pc.Marked && len(pc.Changes) == 0 {
+		key, _, _, _ := policyInfo(policy)
+		delete(pendingChanges, key)
+	}
+	return pc.Marked
+}
+
+// sortedPendingChanges returns the pending changes ordered by their key
+func sortedPendingChanges() []*pendingChange {
+	keys := make([]string, 0, len(pendingChanges))
+	for key := range pendingChanges {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	changes := make([]*pendingChange, 0, len(keys))
+	for _, key := range keys {
+		changes = append(changes, pendingChanges[key])
+	}
+	return changes
+}
+
+// policyRules returns a reference to every process, file and network rule of
+// a KubeArmor policy
+func policyRules(policy *policyType.KubeArmorPolicy) []ruleRef {
+	var rules []ruleRef
+	add := func(section, kind string, count int) {
+		for i := 0; i < count; i++ {
+			rules = append(rules, ruleRef{Policy: policy, Section: section, Kind: kind, Index: i})
+		}
+	}
+
+	add("process", "path", len(policy.Spec.Process.MatchPaths))
+	add("process", "dir", len(policy.Spec.Process.MatchDirectories))
+	add("file", "path", len(policy.Spec.File.MatchPaths))
+	add("file", "dir", len(policy.Spec.File.MatchDirectories))
+	add("network", "protocol", len(policy.Spec.Network.MatchProtocols))
+
+	return rules
+}
+
+func (r ruleRef) sys() *policyType.KnoxSys {
+	switch r.Section {
+	case "process":
+		return &r.Policy.Spec.Process
+	case "file":
+		return &r.Policy.Spec.File
+	}
+	return nil
+}
+
+// String returns a short description of the rule, as shown in the policy tree
+func (r ruleRef) String() string {
+	if r.Section == "network" {
+		if r.Index >= len(r.Policy.Spec.Network.MatchProtocols) {
+			return "network: <deleted>"
+		}
+		return "network: " + r.Policy.Spec.Network.MatchProtocols[r.Index].Protocol
+	}
+
+	sys := r.sys()
+	if sys == nil {
+		return r.Section + ": <unknown>"
+	}
+	switch r.Kind {
+	case "path":
+		if r.Index < len(sys.MatchPaths) {
+			return r.Section + ": " + sys.MatchPaths[r.Index].Path
+		}
+	case "dir":
+		if r.Index < len(sys.MatchDirectories) {
+			return r.Section + ": " + sys.MatchDirectories[r.Index].Dir
+		}
+	}
+	return r.Section + ": <deleted>"
+}
+
+// deleteRule removes the referenced rule from its policy. The only rule of a
+// policy is not removed, a policy without rules can not be written or applied.
+func deleteRule(r ruleRef) error {
+	if rules := policyRules(r.Policy); len(rules) == 1 && rules[0] == r {
+		return fmt.Errorf("%s is the only rule of policy %s", r, r.Policy.Metadata.Name)
+	}
+
+	if r.Section == "network" {
+		protocols := r.Policy.Spec.Network.MatchProtocols
+		if r.Index < 0 || r.Index >= len(protocols) {
+			return fmt.Errorf("rule %d not found in network rules", r.Index)
+		}
+		r.Policy.Spec.Network.MatchProtocols = append(protocols[:r.Index:r.Index], protocols[r.Index+1:]...)
+		return nil
+	}
+
+	sys := r.sys()
+	if sys == nil {
+		return fmt.Errorf("unknown rule section %s", r.Section)
+	}
+	switch r.Kind {
+	case "path":
+		if r.Index < 0 || r.Index >= len(sys.MatchPaths) {
+			return fmt.Errorf("rule %d not found in %s paths", r.Index, r.Section)
+		}
+		sys.MatchPaths = append(sys.MatchPaths[:r.Index:r.Index], sys.MatchPaths[r.Index+1:]...)
+	case "dir":
+		if r.Index < 0 || r.Index >= len(sys.MatchDirectories) {
+			return fmt.Errorf("rule %d not found in %s directories", r.Index, r.Section)
+		}
+		sys.MatchDirectories = append(sys.MatchDirectories[:r.Index:r.Index], sys.MatchDirectories[r.Index+1:]...)
+	default:
+		return fmt.Errorf("unknown rule kind %s", r.Kind)
+	}
+	return nil
+}
+
+// copyRule appends the referenced rule to the same section of dst
+func copyRule(dst *policyType.KubeArmorPolicy, r ruleRef) error {
+	if r.Section == "network" {
+		protocols := r.Policy.Spec.Network.MatchProtocols
+		if r.Index < 0 || r.Index >= len(protocols) {
+			return fmt.Errorf("rule %d not found in network rules", r.Index)
+		}
+		dst.Spec.Network.MatchProtocols = append(dst.Spec.Network.MatchProtocols, protocols[r.Index])
+		return nil
+	}
+
+	src, target := r.sys(), ruleRef{Policy: dst, Section: r.Section}.sys()
+	if src == nil {
+		return fmt.Errorf("unknown rule section %s", r.Section)
+	}
+	switch r.Kind {
+	case "path":
+		if r.Index < 0 || r.Index >= len(src.MatchPaths) {
+			return fmt.Errorf("rule %d not found in %s paths", r.Index, r.Section)
+		}
+		target.MatchPaths = append(target.MatchPaths, src.MatchPaths[r.Index])
+	case "dir":
+		if r.Index < 0 || r.Index >= len(src.MatchDirectories) {
+			return fmt.Errorf("rule %d not found in %s directories", r.Index, r.Section)
+		}
+		target.MatchDirectories = append(target.MatchDirectories, src.MatchDirectories[r.Index])
+	default:
+		return fmt.Errorf("unknown rule kind %s", r.Kind)
+	}
+	return nil
+}
+
+// toggleRuleAction switches the referenced rule to the next action. Discovered
+// rules inherit the action of their policy, so the rule is moved to a policy
+// with the same selector and the next action, which is created if needed. The
+// policy of a single rule has its action switched instead. The policy holding
+// the rule afterwards is returned.
+func (pf *PolicyForest) toggleRuleAction(r ruleRef) (*policyType.KubeArmorPolicy, error) {
+	policy := r.Policy
+	from, to := policy.Spec.Action, nextAction(policy.Spec.Action)
+	description := r.String()
+
+	if len(policyRules(policy)) == 1 {
+		policy.Spec.Action = to
+		trackChange(policy, fmt.Sprintf("action of %s %s -> %s", description, from, to))
+		pf.regroupActions()
+		return policy, nil
+	}
+
+	ns := policy.Metadata.Namespace
+	name := strings.TrimSuffix(policy.Metadata.Name, "-"+strings.ToLower(from)) + "-" + strings.ToLower(to)
+
+	var target *policyType.KubeArmorPolicy
+	if nsBucket := pf.Namespaces[ns]; nsBucket != nil {
+		target = nsBucket.KubearmorPolicies.Policies[name]
+	}
+	if target != nil && target.Spec.Action != to {
+		return nil, fmt.Errorf("policy %s already exists with action %s", name, target.Spec.Action)
+	}
+
+	created := target == nil
+	if created {
+		target = &policyType.KubeArmorPolicy{
+			APIVersion: policy.APIVersion,
+			Kind:       policy.Kind,
+			Metadata:   metav1.ObjectMeta{Name: name, Namespace: ns},
+			Spec: policyType.KnoxSystemSpec{
+				Severity:     policy.Spec.Severity,
+				Tags:         append([]string{}, policy.Spec.Tags...),
+				Message:      policy.Spec.Message,
+				Selector:     policy.Spec.Selector,
+				NodeSelector: policy.Spec.NodeSelector,
+				Action:       to,
+			},
+		}
+	}
+
+	if err := copyRule(target, r); err != nil {
+		return nil, err
+	}
+	if err := deleteRule(r); err != nil {
+		return nil, err
+	}
+	if created {
+		pf.AddKubearmorPolicy(ns, target)
+	}
+
+	trackChange(policy, fmt.Sprintf("moved %s to %s", description, name))
+	trackChange(target, fmt.Sprintf("added %s with action %s", description, to))
+	pf.regroupActions()
+	return target, nil
+}
+
+// regroupActions rebuilds the action index of every namespace, to be called
+// after the action of a policy was changed
+func (pf *PolicyForest) regroupActions() {
+	for _, nsBucket := range pf.Namespaces {
+		if nsBucket.KubearmorPolicies.Policies == nil {
+			continue
+		}
+		actions := make(map[string][]*policyType.KubeArmorPolicy)
+		for _, policy := range nsBucket.KubearmorPolicies.Policies {
+			actions[policy.Spec.Action] = append(actions[policy.Spec.Action], policy)
+		}
+		for _, policies := range actions {
+			sort.Slice(policies, func(i, j int) bool {
+				return policies[i].Metadata.Name < policies[j].Metadata.Name
+			})
+		}
+		nsBucket.KubearmorPolicies.Actions = actions
+	}
+}
+
+// editPolicy replaces the policy with the YAML returned by the editor. The
+// name and namespace of the policy can not be changed.
+func editPolicy(policy interface{}, edit func([]byte) ([]byte, error)) error {
+	var current string
+	switch p := policy.(type) {
+	case *policyType.KubeArmorPolicy:
+		current = kubearmorPolicyToString(p)
+	case *networkingv1.NetworkPolicy:
+		current = networkPolicyToString(p)
+	default:
+		return fmt.Errorf("unsupported policy type %T", policy)
+	}
+
+	edited, err := edit([]byte(current))
+	if err != nil {
+		return err
+	}
+	if string(edited) == current {
+		return nil
+	}
+
+	switch p := policy.(type) {
+	case *policyType.KubeArmorPolicy:
+		var updated policyType.KubeArmorPolicy
+		if err := yaml.Unmarshal(edited, &updated); err != nil {
+			return fmt.Errorf("failed to parse edited policy: %v", err)
+		}
+		if updated.Metadata.Name != p.Metadata.Name || updated.Metadata.Namespace != p.Metadata.Namespace {
+			return fmt.Errorf("name and namespace of the policy can not be changed")
+		}
+		*p = updated
+	case *networkingv1.NetworkPolicy:
+		var updated networkingv1.NetworkPolicy
+		if err := yaml.Unmarshal(edited, &updated); err != nil {
+			return fmt.Errorf("failed to parse edited policy: %v", err)
+		}
+		if updated.Name != p.Name || updated.Namespace != p.Namespace {
+			return fmt.Errorf("name and namespace of the policy can not be changed")
+		}
+		*p = updated
+	}
+	return nil
+}
+
+// editInEditor opens the YAML in $EDITOR (vi by default) and returns the
+// content of the file once the editor exits
+func editInEditor(content []byte) ([]byte, error) {
+	editor := os.Getenv("EDITOR")
+	if editor == "" {
+		editor = "vi"
+	}
+
+	tmp, err := os.CreateTemp("", "knoxctl-policy-*.yaml")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary file: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(content); err != nil {
+		_ = tmp.Close()
+		return nil, fmt.Errorf("failed to write temporary file: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write temporary file: %v", err)
+	}
+
+	// $EDITOR may contain arguments, e.g. "code --wait"
+	args := strings.Fields(editor)
+	// #nosec G204 -- the editor is chosen by the user running knoxctl
+	cmd := exec.Command(args[0], append(args[1:], tmp.Name())...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("editor %s failed: %v", editor, err)
+	}
+
+	return os.ReadFile(filepath.Clean(tmp.Name()))
+}
+
+// writePendingChanges writes every pending policy to the discovered policies
+// directory and clears the written ones from the pending changes
+func writePendingChanges() []string {
+	var results []string
+	for _, pc := range sortedPendingChanges() {
+		nsDirPath := filepath.Join("knoxctl_out/discovered/policies", pc.PolicyType, pc.Namespace)
+		filename := fmt.Sprintf("%s.yaml", pc.Name)
+
+		err := os.MkdirAll(nsDirPath, 0750)
+		if err == nil {
+			switch p := pc.Policy.(type) {
+			case *policyType.KubeArmorPolicy:
+				err = writePolicyToFile(p, nsDirPath, filename)
+			case *networkingv1.NetworkPolicy:
+				err = writeNetworkPolicyToFile(p, nsDirPath, filename)
+			}
+		}
+		if err != nil {
+			results = append(results, fmt.Sprintf("[red]Failed to write %s: %v[-]", pc.Name, err))
+			continue
+		}
+
+		key, _, _, _ := policyInfo(pc.Policy)
+		delete(pendingChanges, key)
+		results = append(results, fmt.Sprintf("Wrote %s", filepath.Join(nsDirPath, filename)))
+	}
+	return results
+}
+
+// markedPolicies returns the number of policies marked for apply
+func markedPolicies() int {
+	count := 0
+	for _, pc := range pendingChanges {
+		if pc.Marked {
+			count++
+		}
+	}
+	return count
+}
+
+// applyMarkedPolicies creates or updates the marked policies in the cluster
+func applyMarkedPolicies(c *k8s.Client) []string {
+	var results []string
+	for _, pc := range sortedPendingChanges() {
+		if !pc.Marked {
+			continue
+		}
+		if err := applyPolicy(c, pc.Policy); err != nil {
+			results = append(results, fmt.Sprintf("[red]Failed to apply %s: %v[-]", pc.Name, err))
+			continue
+		}
+		pc.Marked = false
+		results = append(results, fmt.Sprintf("Applied %s", pc.Name))
+	}
+	return results
+}
+
+func applyPolicy(c *k8s.Client, policy interface{}) error {
+	if c == nil {
+		return fmt.Errorf("not connected to a cluster")
+	}
+	ctx := context.Background()
+
+	switch p := policy.(type) {
+	case *networkingv1.NetworkPolicy:
+		netpol := p.DeepCopy()
+		netpol.ResourceVersion = ""
+		_, err := c.K8sClientset.NetworkingV1().NetworkPolicies(netpol.Namespace).Create(ctx, netpol, metav1.CreateOptions{})
+		if errors.IsAlreadyExists(err) {
+			existing, err := c.K8sClientset.NetworkingV1().NetworkPolicies(netpol.Namespace).Get(ctx, netpol.Name, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			netpol.ResourceVersion = existing.ResourceVersion
+			_, err = c.K8sClientset.NetworkingV1().NetworkPolicies(netpol.Namespace).Update(ctx, netpol, metav1.UpdateOptions{})
+			return err
+		}
+		return err
+
+	case *policyType.KubeArmorPolicy:
+		data, err := json.Marshal(p)
+		if err != nil {
+			return err
+		}
+
+		if p.Kind == KindKubeArmorHostPolicy {
+			var hsp kspAPI.KubeArmorHostPolicy
+			if err := yaml.Unmarshal(data, &hsp); err != nil {
+				return err
+			}
+			_, err = c.KSPClientset.KubeArmorHostPolicies().Create(ctx, &hsp, metav1.CreateOptions{})
+			if errors.IsAlreadyExists(err) {
+				existing, err := c.KSPClientset.KubeArmorHostPolicies().Get(ctx, hsp.Name, metav1.GetOptions{})
+				if err != nil {
+					return err
+				}
+				hsp.ResourceVersion = existing.ResourceVersion
+				_, err = c.KSPClientset.KubeArmorHostPolicies().Update(ctx, &hsp, metav1.UpdateOptions{})
+				return err
+			}
+			return err
+		}
+
+		var ksp kspAPI.KubeArmorPolicy
+		if err := yaml.Unmarshal(data, &ksp); err != nil {
+			return err
+		}
+		_, err = c.KSPClientset.KubeArmorPolicies(ksp.Namespace).Create(ctx, &ksp, metav1.CreateOptions{})
+		if errors.IsAlreadyExists(err) {
+			existing, err := c.KSPClientset.KubeArmorPolicies(ksp.Namespace).Get(ctx, ksp.Name, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			ksp.ResourceVersion = existing.ResourceVersion
+			_, err = c.KSPClientset.KubeArmorPolicies(ksp.Namespace).Update(ctx, &ksp, metav1.UpdateOptions{})
+			return err
+		}
+		return err
+	}
+
+	return fmt.Errorf("unsupported policy type %T", policy)
+}
@@ -0,0 +1,162 @@
+package discover
+
+import (
+	"strings"
+	"testing"
+
+	policyType "github.com/accuknox/dev2/discover/pkg/common"
+)
+
+func TestNextAction(t *testing.T) {
+	tests := []struct {
+		action string
+		want   string
+	}{
+		{"Audit", "Allow"},
+		{"Allow", "Block"},
+		{"Block", "Audit"},
+		{"block", "Audit"},
+		{"", "Audit"},
+	}
+
+	for _, tt := range tests {
+		if got := nextAction(tt.action); got != tt.want {
+			t.Errorf("nextAction(%q) = %q, want %q", tt.action, got, tt.want)
+		}
+	}
+}
+
+func TestDeleteRule(t *testing.T) {
+	policy := mockFilePolicy("autopol-system-1", map[string]string{"app": "web"}, []policyType.KnoxMatchPaths{
+		{Path: "/app/a"}, {Path: "/app/b"}, {Path: "/app/c"},
+	}, []policyType.KnoxMatchDirectories{{Dir: "/app/logs/"}})
+	policy.Spec.Network.MatchProtocols = []policyType.KnoxMatchProtocols{{Protocol: "tcp"}}
+
+	if got := len(policyRules(policy)); got != 5 {
+		t.Fatalf("policyRules() returned %d rules, want 5", got)
+	}
+
+	rule := ruleRef{Policy: policy, Section: "file", Kind: "path", Index: 1}
+	if rule.String() != "file: /app/b" {
+		t.Errorf("ruleRef.String() = %q", rule.String())
+	}
+	if err := deleteRule(rule); err != nil {
+		t.Fatalf("deleteRule() error = %v", err)
+	}
+	paths := policy.Spec.File.MatchPaths
+	if len(paths) != 2 || paths[0].Path != "/app/a" || paths[1].Path != "/app/c" {
+		t.Errorf("deleteRule() left paths %+v", paths)
+	}
+
+	if err := deleteRule(ruleRef{Policy: policy, Section: "network", Kind: "protocol"}); err != nil {
+		t.Fatalf("deleteRule() error = %v", err)
+	}
+	if len(policy.Spec.Network.MatchProtocols) != 0 {
+		t.Errorf("deleteRule() did not remove the network rule")
+	}
+
+	if err := deleteRule(ruleRef{Policy: policy, Section: "file", Kind: "dir", Index: 3}); err == nil {
+		t.Errorf("deleteRule() with an invalid index should fail")
+	}
+
+	for _, rule := range []ruleRef{
+		{Policy: policy, Section: "file", Kind: "path", Index: 1},
+		{Policy: policy, Section: "file", Kind: "path"},
+	} {
+		if err := deleteRule(rule); err != nil {
+			t.Fatalf("deleteRule() error = %v", err)
+		}
+	}
+	if err := deleteRule(ruleRef{Policy: policy, Section: "file", Kind: "dir"}); err == nil {
+		t.Errorf("deleteRule() of the only rule of the policy should fail")
+	}
+	if got := len(policyRules(policy)); got != 1 {
+		t.Errorf("policyRules() returned %d rules after deleting the only one, want 1", got)
+	}
+}
+
+func TestEditPolicy(t *testing.T) {
+	policy := mockFilePolicy("autopol-system-1", map[string]string{"app": "web"}, []policyType.KnoxMatchPaths{{Path: "/app/a"}}, nil)
+
+	err := editPolicy(policy, func(b []byte) ([]byte, error) {
+		return []byte(strings.Replace(string(b), "action: Allow", "action: Block", 1)), nil
+	})
+	if err != nil {
+		t.Fatalf("editPolicy() error = %v", err)
+	}
+	if policy.Spec.Action != "Block" {
+		t.Errorf("editPolicy() action = %q, want Block", policy.Spec.Action)
+	}
+
+	err = editPolicy(policy, func(b []byte) ([]byte, error) {
+		return []byte(strings.Replace(string(b), "name: autopol-system-1", "name: renamed", 1)), nil
+	})
+	if err == nil || policy.Metadata.Name != "autopol-system-1" {
+		t.Errorf("editPolicy() should reject renaming the policy")
+	}
+}
+
+func TestPendingChanges(t *testing.T) {
+	defer func() { pendingChanges = make(map[string]*pendingChange) }()
+
+	policy := mockFilePolicy("autopol-system-1", nil, nil, nil)
+
+	if !toggleMark(policy) {
+		t.Errorf("toggleMark() should mark the policy")
+	}
+	if got := policyNodeText(policy); got != "autopol-system-1 (marked)" {
+		t.Errorf("policyNodeText() = %q", got)
+	}
+	if toggleMark(policy) {
+		t.Errorf("toggleMark() should unmark the policy")
+	}
+	if len(pendingChanges) != 0 {
+		t.Errorf("unmarked policy without changes should not be pending")
+	}
+
+	trackChange(policy, "action Allow -> Block")
+	toggleMark(policy)
+	toggleMark(policy)
+	if got := len(sortedPendingChanges()); got != 1 {
+		t.Errorf("modified policy should stay pending, got %d pending changes", got)
+	}
+}
+
+func TestToggleRuleAction(t *testing.T) {
+	defer func() { pendingChanges = make(map[string]*pendingChange) }()
+
+	pf := NewPolicyForest()
+	policy := mockFilePolicy("autopol-system-1-allow", map[string]string{"app": "web"}, []policyType.KnoxMatchPaths{
+		{Path: "/app/a"}, {Path: "/app/b"},
+	}, nil)
+	policy.Spec.Severity = 5
+	pf.AddKubearmorPolicy("default", policy)
+
+	target, err := pf.toggleRuleAction(ruleRef{Policy: policy, Section: "file", Kind: "path", Index: 1})
+	if err != nil {
+		t.Fatalf("toggleRuleAction() error = %v", err)
+	}
+	if policy.Spec.Action != "Allow" || len(policy.Spec.File.MatchPaths) != 1 || policy.Spec.File.MatchPaths[0].Path != "/app/a" {
+		t.Errorf("toggleRuleAction() changed the other rules of the policy: %+v", policy.Spec)
+	}
+	if target.Metadata.Name != "autopol-system-1-block" || target.Spec.Action != "Block" || target.Spec.Severity != 5 {
+		t.Errorf("toggleRuleAction() target = %s %+v", target.Metadata.Name, target.Spec)
+	}
+	if paths := target.Spec.File.MatchPaths; len(paths) != 1 || paths[0].Path != "/app/b" {
+		t.Errorf("toggleRuleAction() target paths = %+v", paths)
+	}
+	if got := len(pf.Namespaces["default"].KubearmorPolicies.Actions["Block"]); got != 1 {
+		t.Errorf("toggleRuleAction() Block policies = %d, want 1", got)
+	}
+
+	// the single rule left switches the action of its policy
+	if _, err := pf.toggleRuleAction(ruleRef{Policy: policy, Section: "file", Kind: "path"}); err != nil {
+		t.Fatalf("toggleRuleAction() error = %v", err)
+	}
+	if policy.Spec.Action != "Block" {
+		t.Errorf("toggleRuleAction() action = %q, want Block", policy.Spec.Action)
+	}
+	if got := len(sortedPendingChanges()); got != 2 {
+		t.Errorf("toggleRuleAction() pending changes = %d, want 2", got)
+	}
+}
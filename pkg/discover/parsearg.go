@@ -21,6 +21,8 @@ type Options struct {
 	Source         []string `flag:"source"`
 	IncludeNetwork bool     `flag:"includenet"`
 	Glance         bool     `flag:"glance"`
+	Raw            bool     `flag:"raw"`
+	CollapseDirs   bool     `flag:"collapsedirs"`
 
 	NamespaceRegex []*regexp.Regexp
 	LabelsRegex    []*regexp.Regexp
@@ -84,6 +86,12 @@ func ProcessArgs(rawArgs string) (*Options, error) {
 		case flag == "glance":
 			parsed.Glance = true
 
+		case flag == "raw":
+			parsed.Raw = true
+
+		case flag == "collapsedirs":
+			parsed.CollapseDirs = true
+
 		default:
 			// This condition will never be hit since cobra will sort this out, just for unit tests
 			return nil, wrapErr(fmt.Errorf("unknown flag: %s", flag))
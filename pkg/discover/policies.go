@@ -3,6 +3,7 @@ package discover
 import (
 	"context"
 	"fmt"
+	"os"
 	"strings"
 	"sync"
 
@@ -39,7 +40,7 @@ func disconnect() {
 	if connection != nil {
 		err := connection.Close()
 		if err != nil {
-			fmt.Println("Failed to close connection")
+			fmt.Fprintln(os.Stderr, "Failed to close connection")
 		}
 	}
 }
@@ -65,7 +66,7 @@ func getNetworkPolicy(c *k8s.Client, p *Options, pf *PolicyForest) error {
 
 			go func() {
 				for err := range errorChan {
-					fmt.Println(err)
+					fmt.Fprintln(os.Stderr, err)
 				}
 			}()
 
@@ -94,7 +95,7 @@ func getNetworkPolicy(c *k8s.Client, p *Options, pf *PolicyForest) error {
 
 		err := bar.Finish()
 		if err != nil {
-			fmt.Println("Failed to finish progress bar")
+			fmt.Fprintln(os.Stderr, "Failed to finish progress bar")
 		}
 	}
 
@@ -117,7 +118,7 @@ func getKaHostPolicy(c *k8s.Client, p *Options, pf *PolicyForest) error {
 		errorChan := make(chan error, len(resp.Policies))
 		go func() {
 			for err := range errorChan {
-				fmt.Println(err)
+				fmt.Fprintln(os.Stderr, err)
 			}
 		}()
 
@@ -150,7 +151,7 @@ func getKaHostPolicy(c *k8s.Client, p *Options, pf *PolicyForest) error {
 
 		err := bar.Finish()
 		if err != nil {
-			fmt.Println("Failed to finish progress bar")
+			fmt.Fprintln(os.Stderr, "Failed to finish progress bar")
 		}
 	}
 
@@ -173,7 +174,7 @@ func getKaPolicy(c *k8s.Client, p *Options, pf *PolicyForest) error {
 		errorChan := make(chan error, len(resp.Policies))
 		go func() {
 			for err := range errorChan {
-				fmt.Println(err)
+				fmt.Fprintln(os.Stderr, err)
 			}
 		}()
 
@@ -204,7 +205,7 @@ func getKaPolicy(c *k8s.Client, p *Options, pf *PolicyForest) error {
 		wg.Wait()
 		err := bar.Finish()
 		if err != nil {
-			fmt.Println("Failed to finish progress bar")
+			fmt.Fprintln(os.Stderr, "Failed to finish progress bar")
 		}
 	}
 
@@ -399,6 +400,8 @@ func initializeProgressBar(totalCount int) *progressbar.ProgressBar {
 		progressbar.OptionShowCount(),
 		progressbar.OptionShowBytes(false),
 		progressbar.OptionShowIts(),
+		// stdout is kept for the policies and reports
+		progressbar.OptionSetWriter(os.Stderr),
 	)
 	return bar
 }
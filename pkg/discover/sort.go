@@ -1,6 +1,7 @@
 package discover
 
 import (
+	"sort"
 	"strings"
 	"sync"
 
@@ -184,6 +185,7 @@ func serializeLabels(labels map[string]string) string {
 	for k := range labels {
 		keys = append(keys, k)
 	}
+	sort.Strings(keys)
 
 	var sb strings.Builder
 	for _, k := range keys {
@@ -7,6 +7,7 @@ import (
 
 	"github.com/clarketm/json"
 	"github.com/gdamore/tcell/v2"
+	"github.com/kubearmor/kubearmor-client/k8s"
 	"github.com/rivo/tview"
 	"sigs.k8s.io/yaml"
 
@@ -15,7 +16,7 @@ import (
 	networkingv1 "k8s.io/api/networking/v1"
 )
 
-// Track the policies that are already saved, and dont let users save the same policy again
+// Track the policies that are already saved (by policy key), and dont let users save the same policy again
 var savedPolicies = make(map[string]bool)
 
 // Set of all policies to be dumped
@@ -29,11 +30,11 @@ type policySaveInfo struct {
 	Name       string
 }
 
-func StartTUI(pf *PolicyForest) {
+func StartTUI(c *k8s.Client, pf *PolicyForest) {
 	app := tview.NewApplication().EnableMouse(true)
 
 	grid := tview.NewGrid().
-		SetRows(1, 0, 1, 1).
+		SetRows(1, 0, 6, 1).
 		SetColumns(25, 0, 85).
 		SetBorders(true)
 	grid.SetBackgroundColor(tcell.ColorBlack.TrueColor()) // hardcore black background, will override any terminal default color
@@ -53,6 +54,13 @@ func StartTUI(pf *PolicyForest) {
 		SetScrollable(true)
 	policyDetailsView.SetBackgroundColor(tcell.ColorBlack.TrueColor())
 
+	pendingView := tview.NewTextView().
+		SetDynamicColors(true).
+		SetWordWrap(true).
+		SetScrollable(true)
+	pendingView.SetBackgroundColor(tcell.ColorBlack.TrueColor())
+	showPendingChanges(pendingView)
+
 	for ns := range pf.Namespaces {
 		namespaceList.AddItem(ns, "", 0, nil)
 	}
@@ -64,6 +72,7 @@ func StartTUI(pf *PolicyForest) {
 	grid.AddItem(namespaceList, 1, 0, 1, 1, 0, 0, true)
 	grid.AddItem(policyTree, 1, 1, 1, 1, 0, 0, true)
 	grid.AddItem(policyDetailsView, 1, 2, 1, 1, 0, 0, false)
+	grid.AddItem(pendingView, 2, 0, 1, 3, 0, 0, false)
 
 	accuKnoxLabel := tview.NewTextView().
 		SetText("[::b]AccuKnox[::-]").
@@ -71,17 +80,21 @@ func StartTUI(pf *PolicyForest) {
 		SetDynamicColors(true)
 
 	navigationCues := tview.NewTextView().
-		SetText("Navigate: Arrows | Select: Click | Save: S | Exit: Q/Esc").
+		SetText("Navigate: Arrows | Expand: Enter | Save: S | Rule action: T | Delete rule: D | Edit: E | Mark: M | Write: W | Apply marked: A | Exit: Q/Esc").
 		SetTextAlign(tview.AlignRight).
 		SetDynamicColors(true)
 
 	navFlex := tview.NewFlex().
 		AddItem(accuKnoxLabel, 0, 1, false).
-		AddItem(tview.NewBox(), 0, 1, false).
-		AddItem(navigationCues, 0, 1, false)
+		AddItem(navigationCues, 0, 5, false)
 
 	grid.AddItem(navFlex, 3, 0, 1, 3, 0, 100, false)
 
+	currentNamespace := func() string {
+		ns, _ := namespaceList.GetItemText(namespaceList.GetCurrentItem())
+		return ns
+	}
+
 	namespaceList.SetSelectedFunc(func(index int, mainText string, secondaryText string, shortcut rune) {
 		populatePolicyTree(policyTree, mainText, pf)
 		app.SetFocus(policyTree)
@@ -93,9 +106,34 @@ func StartTUI(pf *PolicyForest) {
 			policyDetailsView.SetText(networkPolicyToString(ref))
 		case *policyType.KubeArmorPolicy:
 			policyDetailsView.SetText(kubearmorPolicyToString(ref))
+		case ruleRef:
+			policyDetailsView.SetText(kubearmorPolicyToString(ref.Policy))
 		}
 	})
 
+	policyTree.SetSelectedFunc(func(node *tview.TreeNode) {
+		node.SetExpanded(!node.IsExpanded())
+	})
+
+	// refresh rebuilds the tree after a policy was changed and selects the
+	// node referencing the given policy again
+	refresh := func(selected interface{}) {
+		showPendingChanges(pendingView)
+		if pf.Namespaces[currentNamespace()] == nil {
+			return
+		}
+		populatePolicyTree(policyTree, currentNamespace(), pf)
+		selectPolicyNode(policyTree, selected)
+		if node := policyTree.GetCurrentNode(); node != nil {
+			switch ref := node.GetReference().(type) {
+			case *networkingv1.NetworkPolicy:
+				policyDetailsView.SetText(networkPolicyToString(ref))
+			case *policyType.KubeArmorPolicy:
+				policyDetailsView.SetText(kubearmorPolicyToString(ref))
+			}
+		}
+	}
+
 	app.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
 		if event.Key() == tcell.KeyEscape {
 			app.Stop()
@@ -110,18 +148,120 @@ func StartTUI(pf *PolicyForest) {
 				app.SetFocus(namespaceList)
 			}
 		}
-		if event.Rune() == 's' {
-			currentNode := policyTree.GetCurrentNode()
-			if currentNode == nil || currentNode.GetReference() == nil {
+
+		currentNode := policyTree.GetCurrentNode()
+		var reference interface{}
+		if currentNode != nil {
+			reference = currentNode.GetReference()
+		}
+
+		switch event.Rune() {
+		case 's':
+			key, _, _, _ := policyInfo(reference)
+			if key == "" {
 				policyDetailsView.SetText("Please select a policy to save")
 				return nil
 			}
-			policyName := currentNode.GetText()
-			if savedPolicies[policyName] {
+			if savedPolicies[key] {
 				policyDetailsView.SetText("Policy is already saved.")
 				return nil
 			}
 			showDetailsDialog(app, grid, policyTree, namespaceList)
+
+		case 't':
+			rule, ok := reference.(ruleRef)
+			if !ok {
+				policyDetailsView.SetText("Please select a rule of a KubeArmor policy to change the action of")
+				return nil
+			}
+			policy, err := pf.toggleRuleAction(rule)
+			if err != nil {
+				policyDetailsView.SetText(fmt.Sprintf("Failed to change the action of the rule: %v", err))
+				return nil
+			}
+			refresh(policy)
+			return nil
+
+		case 'd':
+			rule, ok := reference.(ruleRef)
+			if !ok {
+				policyDetailsView.SetText("Please select a rule of a KubeArmor policy to delete")
+				return nil
+			}
+			description := rule.String()
+			if err := deleteRule(rule); err != nil {
+				policyDetailsView.SetText(fmt.Sprintf("Failed to delete rule: %v", err))
+				return nil
+			}
+			trackChange(rule.Policy, "deleted "+description)
+			refresh(rule.Policy)
+			return nil
+
+		case 'e':
+			policy := reference
+			if rule, ok := reference.(ruleRef); ok {
+				policy = rule.Policy
+			}
+			if policy == nil {
+				policyDetailsView.SetText("Please select a policy to edit")
+				return nil
+			}
+			var err error
+			app.Suspend(func() {
+				err = editPolicy(policy, editInEditor)
+			})
+			if err != nil {
+				policyDetailsView.SetText(fmt.Sprintf("Policy was not changed: %v", err))
+				return nil
+			}
+			trackChange(policy, "edited in $EDITOR")
+			pf.regroupActions()
+			refresh(policy)
+			return nil
+
+		case 'm':
+			policy := reference
+			if rule, ok := reference.(ruleRef); ok {
+				policy = rule.Policy
+			}
+			if policy == nil {
+				policyDetailsView.SetText("Please select a policy to mark")
+				return nil
+			}
+			toggleMark(policy)
+			refresh(policy)
+			return nil
+
+		case 'w':
+			if len(pendingChanges) == 0 {
+				policyDetailsView.SetText("There are no pending changes to write")
+				return nil
+			}
+			results := writePendingChanges()
+			refresh(reference)
+			policyDetailsView.SetText(strings.Join(results, "\n"))
+			return nil
+
+		case 'a':
+			count := markedPolicies()
+			if count == 0 {
+				policyDetailsView.SetText("Please mark the policies to apply first")
+				return nil
+			}
+			confirm := tview.NewModal().
+				SetText(fmt.Sprintf("Apply %d marked policies to the cluster?", count)).
+				AddButtons([]string{"Apply", "Cancel"}).
+				SetDoneFunc(func(_ int, label string) {
+					app.SetRoot(grid, true).SetFocus(policyTree)
+					if label != "Apply" {
+						return
+					}
+					results := applyMarkedPolicies(c)
+					refresh(reference)
+					policyDetailsView.SetText(strings.Join(results, "\n"))
+				})
+			app.SetRoot(confirm, true).SetFocus(confirm)
+			return nil
 		}
 
 		return event
@@ -133,6 +273,10 @@ func StartTUI(pf *PolicyForest) {
 	}
 
 	dumpPolicies()
+
+	if len(pendingChanges) != 0 {
+		fmt.Printf("%d policies with pending changes were not written\n", len(pendingChanges))
+	}
 }
 
 func populatePolicyTree(tree *tview.TreeView, namespace string, pf *PolicyForest) {
@@ -151,9 +295,7 @@ func populatePolicyTree(tree *tview.TreeView, namespace string, pf *PolicyForest
 			SetColor(tcell.ColorGreen).SetSelectable(false)
 		kubearmorNode.AddChild(actionNode)
 		for _, policy := range policies {
-			policyNode := tview.NewTreeNode(policy.Metadata.Name).
-				SetReference(policy)
-			actionNode.AddChild(policyNode)
+			actionNode.AddChild(newKubearmorPolicyNode(policy))
 		}
 	}
 
@@ -162,9 +304,7 @@ func populatePolicyTree(tree *tview.TreeView, namespace string, pf *PolicyForest
 			SetColor(tcell.ColorGreen).SetSelectable(false)
 		kubearmorNode.AddChild(labelNode)
 		for _, policy := range policies {
-			policyNode := tview.NewTreeNode(policy.Metadata.Name).
-				SetReference(policy)
-			labelNode.AddChild(policyNode)
+			labelNode.AddChild(newKubearmorPolicyNode(policy))
 		}
 	}
 
@@ -178,7 +318,7 @@ func populatePolicyTree(tree *tview.TreeView, namespace string, pf *PolicyForest
 			SetColor(tcell.ColorGreen).SetSelectable(false)
 		networkPolicyNode.AddChild(typeNode)
 		for _, policy := range policies {
-			policyNode := tview.NewTreeNode(policy.ObjectMeta.Name).
+			policyNode := tview.NewTreeNode(policyNodeText(policy)).
 				SetReference(policy)
 			typeNode.AddChild(policyNode)
 		}
@@ -189,7 +329,7 @@ func populatePolicyTree(tree *tview.TreeView, namespace string, pf *PolicyForest
 			SetColor(tcell.ColorGreen).SetSelectable(false)
 		networkPolicyNode.AddChild(protocolNode)
 		for _, policy := range policies {
-			policyNode := tview.NewTreeNode(policy.ObjectMeta.Name).
+			policyNode := tview.NewTreeNode(policyNodeText(policy)).
 				SetReference(policy)
 			protocolNode.AddChild(policyNode)
 		}
@@ -198,6 +338,81 @@ func populatePolicyTree(tree *tview.TreeView, namespace string, pf *PolicyForest
 	tree.SetCurrentNode(root)
 }
 
+// showPendingChanges lists the modified and marked policies in the pending
+// changes pane
+func showPendingChanges(view *tview.TextView) {
+	changes := sortedPendingChanges()
+	if len(changes) == 0 {
+		view.SetText("[::b]Pending changes[::-]: none")
+		return
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "[::b]Pending changes[::-]: %d (W to write all, A to apply marked)\n", len(changes))
+	for _, pc := range changes {
+		status := ""
+		if pc.Marked {
+			status = " [yellow](marked)[-]"
+		}
+		fmt.Fprintf(&sb, "%s/%s%s: %s\n", pc.Namespace, pc.Name, status, strings.Join(pc.Changes, ", "))
+	}
+	view.SetText(sb.String())
+}
+
+// selectPolicyNode makes the first node referencing the policy the current one
+func selectPolicyNode(tree *tview.TreeView, policy interface{}) {
+	if policy == nil {
+		return
+	}
+	if rule, ok := policy.(ruleRef); ok {
+		policy = rule.Policy
+	}
+
+	tree.GetRoot().Walk(func(node, parent *tview.TreeNode) bool {
+		if node.GetReference() == policy {
+			tree.SetCurrentNode(node)
+			return false
+		}
+		return true
+	})
+}
+
+// policyNodeText returns the text of a policy node, along with whether it was
+// modified or marked in the TUI
+func policyNodeText(policy interface{}) string {
+	key, _, _, name := policyInfo(policy)
+	pc, exists := pendingChanges[key]
+	if !exists {
+		return name
+	}
+
+	var status []string
+	if len(pc.Changes) != 0 {
+		status = append(status, "modified")
+	}
+	if pc.Marked {
+		status = append(status, "marked")
+	}
+	if len(status) == 0 {
+		return name
+	}
+	return fmt.Sprintf("%s (%s)", name, strings.Join(status, ", "))
+}
+
+// newKubearmorPolicyNode returns a collapsed node for the policy with a child
+// node for each of its rules
+func newKubearmorPolicyNode(policy *policyType.KubeArmorPolicy) *tview.TreeNode {
+	policyNode := tview.NewTreeNode(policyNodeText(policy)).
+		SetReference(policy).
+		SetExpanded(false)
+	for _, rule := range policyRules(policy) {
+		policyNode.AddChild(tview.NewTreeNode(rule.String()).
+			SetReference(rule).
+			SetColor(tcell.ColorLightGray))
+	}
+	return policyNode
+}
+
 func kubearmorPolicyToString(policy *policyType.KubeArmorPolicy) string {
 	jsonBytes, err := json.Marshal(policy)
 	if err != nil {
@@ -231,14 +446,7 @@ func saveCurrentPolicy(policyTree *tview.TreeView, namespaceList *tview.List) {
 	policy := currentNode.GetReference()
 	namespaceIdx := namespaceList.GetCurrentItem()
 	namespaceTxt, _ := namespaceList.GetItemText(namespaceIdx)
-	policyName := currentNode.GetText()
-
-	var polType string
-	if strings.HasPrefix(policyName, "autopol-system-") {
-		polType = "kubearmor_policy"
-	} else {
-		polType = "network_policy"
-	}
+	_, polType, _, policyName := policyInfo(policy)
 
 	policiesToSave = append(policiesToSave, policySaveInfo{
 		Policy:     policy,
@@ -279,14 +487,14 @@ func showDetailsDialog(app *tview.Application, grid *tview.Grid, policyTree *tvi
 			detailsTextView.SetText("Please select a policy to save.")
 			return
 		}
-		policyName := currentNode.GetText()
-		if savedPolicies[policyName] {
+		key, _, _, _ := policyInfo(currentNode.GetReference())
+		if savedPolicies[key] {
 			detailsTextView.SetText("Policy is already saved.")
 			return
 		}
 
 		saveCurrentPolicy(policyTree, namespaceList)
-		savedPolicies[policyName] = true
+		savedPolicies[key] = true
 		app.SetRoot(grid, true).SetFocus(grid)
 	})
 	cancelButton := tview.NewButton("Cancel").SetSelectedFunc(func() {
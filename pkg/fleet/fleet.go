@@ -0,0 +1,428 @@
+package fleet
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"debug/elf"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	cm "github.com/accuknox/accuknox-cli-v2/pkg/common"
+	"github.com/accuknox/accuknox-cli-v2/pkg/logger"
+	"github.com/accuknox/accuknox-cli-v2/pkg/onboard"
+	"github.com/olekukonko/tablewriter"
+)
+
+// RemoteBinary is where knoxctl is installed on the hosts
+const RemoteBinary = "/usr/local/bin/knoxctl"
+
+// DefaultConcurrency is the default number of workers onboarded in parallel
+const DefaultConcurrency = 5
+
+const (
+	StatusOnboarded = "onboarded"
+	StatusUpdated   = "updated"
+	StatusFailed    = "failed"
+	StatusSkipped   = "skipped"
+)
+
+// Options are the options of onboarding a fleet
+type Options struct {
+	// Concurrency is the number of workers onboarded in parallel
+	Concurrency int
+	// Retries is the number of times a failed host is retried
+	Retries    int
+	RetryDelay time.Duration
+	// Dial connects to the hosts, DialSSH if nil
+	Dial Dialer
+}
+
+// HostResult is the outcome of onboarding or updating a host
+type HostResult struct {
+	Host     string           `json:"host"`
+	Role     onboard.NodeType `json:"role"`
+	Status   string           `json:"status"`
+	Attempts int              `json:"attempts"`
+	Duration time.Duration    `json:"duration"`
+	Error    string           `json:"error,omitempty"`
+}
+
+type binary struct {
+	data []byte
+	sum  string
+	// platform the binary was built for, as os/arch
+	platform string
+}
+
+// elfArchs maps the ELF machines to the Go architectures
+var elfArchs = map[elf.Machine]string{
+	elf.EM_X86_64:  "amd64",
+	elf.EM_AARCH64: "arm64",
+	elf.EM_386:     "386",
+	elf.EM_ARM:     "arm",
+	elf.EM_PPC64:   "ppc64le",
+	elf.EM_S390:    "s390x",
+	elf.EM_RISCV:   "riscv64",
+}
+
+// unameArchs maps the machines of `uname -m` to the Go architectures
+var unameArchs = map[string]string{
+	"x86_64":  "amd64",
+	"amd64":   "amd64",
+	"aarch64": "arm64",
+	"arm64":   "arm64",
+	"i386":    "386",
+	"i686":    "386",
+	"armv6l":  "arm",
+	"armv7l":  "arm",
+	"ppc64le": "ppc64le",
+	"s390x":   "s390x",
+	"riscv64": "riscv64",
+}
+
+func readBinary(path string) (*binary, error) {
+	if path == "" {
+		var err error
+		if path, err = os.Executable(); err != nil {
+			return nil, err
+		}
+	}
+	data, err := os.ReadFile(path) // #nosec G304 binary path given by the user
+	if err != nil {
+		return nil, fmt.Errorf("reading knoxctl binary: %v", err)
+	}
+
+	f, err := elf.NewFile(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("knoxctl binary %s is not a Linux executable, set the binary built for the hosts in the inventory", path)
+	}
+	arch, ok := elfArchs[f.Machine]
+	if !ok {
+		return nil, fmt.Errorf("knoxctl binary %s is built for the unsupported machine %s", path, f.Machine)
+	}
+
+	sum := sha256.Sum256(data)
+	return &binary{data: data, sum: hex.EncodeToString(sum[:]), platform: "linux/" + arch}, nil
+}
+
+// hostPlatform returns the os/arch of the host from the output of `uname -sm`
+func hostPlatform(uname string) (string, error) {
+	fields := strings.Fields(uname)
+	if len(fields) != 2 {
+		return "", fmt.Errorf("unexpected output of uname -sm: %q", strings.TrimSpace(uname))
+	}
+	arch, ok := unameArchs[fields[1]]
+	if !ok {
+		return "", fmt.Errorf("unsupported machine %s", fields[1])
+	}
+	return strings.ToLower(fields[0]) + "/" + arch, nil
+}
+
+// Onboard onboards the control plane of the inventory, then joins the
+// workers to it in parallel. Workers are skipped if the control plane fails.
+func Onboard(ctx context.Context, inv *Inventory, opts Options) ([]HostResult, error) {
+	if opts.Dial == nil {
+		opts.Dial = DialSSH
+	}
+	if opts.Concurrency < 1 {
+		opts.Concurrency = DefaultConcurrency
+	}
+
+	bin, err := readBinary(inv.Binary)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]HostResult, 0, len(inv.Workers)+1)
+
+	var ic onboard.InitConfig
+	cp := onboardHost(ctx, inv.ControlPlane, onboard.NodeType_ControlPlane, opts, func(c Client) error {
+		if err := push(ctx, c, inv.ControlPlane, bin); err != nil {
+			return err
+		}
+		if _, err := knoxctl(ctx, c, inv.ControlPlane, controlPlaneArgs(inv), nil); err != nil {
+			return err
+		}
+		return readStoredConfig(ctx, c, inv.ControlPlane, &ic)
+	})
+	results = append(results, cp)
+
+	if cp.Status != StatusOnboarded {
+		for _, w := range inv.Workers {
+			results = append(results, HostResult{
+				Host:   w.Host,
+				Role:   onboard.NodeType_WorkerNode,
+				Status: StatusSkipped,
+				Error:  "control plane not onboarded",
+			})
+		}
+		return results, nil
+	}
+
+	workers := eachWorker(ctx, inv, opts, func(w Host) HostResult {
+		return onboardHost(ctx, w, onboard.NodeType_WorkerNode, opts, func(c Client) error {
+			if err := push(ctx, c, w, bin); err != nil {
+				return err
+			}
+			// the credentials are passed on stdin to keep them out of the
+			// process list of the host
+			var stdin io.Reader
+			if ic.Tls.Enabled && ic.RMQCredentials != "" {
+				stdin = strings.NewReader(ic.RMQCredentials)
+			}
+			_, err := knoxctl(ctx, c, w, workerArgs(inv, w, &ic), stdin)
+			return err
+		})
+	})
+
+	return append(results, workers...), nil
+}
+
+// PushCA imports the CA of the control plane, base64 encoded, on the workers
+// of the inventory after it was rotated
+func PushCA(ctx context.Context, inv *Inventory, caCert string, opts Options) ([]HostResult, error) {
+	if opts.Dial == nil {
+		opts.Dial = DialSSH
+	}
+	if opts.Concurrency < 1 {
+		opts.Concurrency = DefaultConcurrency
+	}
+
+	bin, err := readBinary(inv.Binary)
+	if err != nil {
+		return nil, err
+	}
+
+	args := []string{"onboard", "vm", "certs", "import", "--ca-cert=" + caCert}
+	return eachWorker(ctx, inv, opts, func(w Host) HostResult {
+		return runHost(ctx, w, onboard.NodeType_WorkerNode, "importing the CA on", StatusUpdated, opts, func(c Client) error {
+			if err := push(ctx, c, w, bin); err != nil {
+				return err
+			}
+			_, err := knoxctl(ctx, c, w, args, nil)
+			return err
+		})
+	}), nil
+}
+
+// eachWorker runs fn on the workers of the inventory in parallel. The workers
+// not started when the context is cancelled are skipped.
+func eachWorker(ctx context.Context, inv *Inventory, opts Options, fn func(w Host) HostResult) []HostResult {
+	results := make([]HostResult, len(inv.Workers))
+	sem := make(chan struct{}, opts.Concurrency)
+	var wg sync.WaitGroup
+	for i, w := range inv.Workers {
+		if ctx.Err() == nil {
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+			}
+		}
+		if ctx.Err() != nil {
+			results[i] = HostResult{
+				Host:   w.Host,
+				Role:   onboard.NodeType_WorkerNode,
+				Status: StatusSkipped,
+				Error:  ctx.Err().Error(),
+			}
+			continue
+		}
+		wg.Add(1)
+		go func(i int, w Host) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = fn(w)
+		}(i, w)
+	}
+	wg.Wait()
+	return results
+}
+
+// onboardHost connects to the host and runs fn, retrying both on failure
+func onboardHost(ctx context.Context, h Host, role onboard.NodeType, opts Options, fn func(Client) error) HostResult {
+	return runHost(ctx, h, role, "onboarding", StatusOnboarded, opts, fn)
+}
+
+// runHost connects to the host and runs fn for the task, retrying both on
+// failure. The host gets the status done on success.
+func runHost(ctx context.Context, h Host, role onboard.NodeType, task, done string, opts Options, fn func(Client) error) HostResult {
+	res := HostResult{Host: h.Host, Role: role}
+	start := time.Now()
+
+	var err error
+	for res.Attempts = 1; ; res.Attempts++ {
+		logger.Print("%s: %s %s (attempt %d)", h.Host, task, role, res.Attempts)
+		err = func() error {
+			c, err := opts.Dial(h)
+			if err != nil {
+				return err
+			}
+			defer c.Close()
+			return fn(c)
+		}()
+		if err == nil || res.Attempts > opts.Retries || ctx.Err() != nil {
+			break
+		}
+
+		logger.Warn("%s: %s, retrying", h.Host, err.Error())
+		select {
+		case <-time.After(opts.RetryDelay * time.Duration(res.Attempts)):
+		case <-ctx.Done():
+		}
+	}
+
+	res.Duration = time.Since(start).Round(time.Second)
+	if err != nil {
+		res.Status = StatusFailed
+		res.Error = err.Error()
+		logger.Warn("%s: %s %s failed: %s", h.Host, task, role, err.Error())
+	} else {
+		res.Status = done
+		logger.PrintSuccess("%s: %s", h.Host, done)
+	}
+	return res
+}
+
+// sudo returns the prefix to run a command as root on the host
+func (h Host) sudo() string {
+	if h.User == "root" {
+		return ""
+	}
+	return "sudo -n "
+}
+
+// push installs the knoxctl binary on the host unless it is already there. The
+// binary must be built for the OS and architecture of the host.
+func push(ctx context.Context, c Client, h Host, bin *binary) error {
+	out, err := c.Run(ctx, "uname -sm", nil)
+	if err != nil {
+		return fmt.Errorf("detecting the platform of the host: %v: %s", err, lastLines(out, 5))
+	}
+	platform, err := hostPlatform(out)
+	if err != nil {
+		return fmt.Errorf("detecting the platform of the host: %v", err)
+	}
+	if platform != bin.platform {
+		return fmt.Errorf("knoxctl binary is built for %s but the host is %s, set the binary built for the hosts in the inventory", bin.platform, platform)
+	}
+
+	out, _ = c.Run(ctx, "sha256sum "+RemoteBinary+" 2>/dev/null", nil)
+	if strings.HasPrefix(out, bin.sum) {
+		return nil
+	}
+
+	cmd := fmt.Sprintf(`tmp=$(mktemp) && cat > "$tmp" && %sinstall -m 0755 "$tmp" %s; rc=$?; rm -f "$tmp"; exit $rc`, h.sudo(), RemoteBinary)
+	if out, err := c.Run(ctx, cmd, bytes.NewReader(bin.data)); err != nil {
+		return fmt.Errorf("pushing knoxctl: %v: %s", err, lastLines(out, 5))
+	}
+	return nil
+}
+
+// knoxctl runs knoxctl with the given args and input as root on the host
+func knoxctl(ctx context.Context, c Client, h Host, args []string, stdin io.Reader) (string, error) {
+	out, err := c.Run(ctx, h.sudo()+RemoteBinary+" "+shellJoin(args), stdin)
+	if err != nil {
+		return out, fmt.Errorf("knoxctl %s: %v: %s", strings.Join(args[:3], " "), err, lastLines(out, 10))
+	}
+	return out, nil
+}
+
+// readStoredConfig reads the config knoxctl stored while onboarding the
+// control plane, in /opt/knoxctl for systemd or in the home of root for
+// docker
+func readStoredConfig(ctx context.Context, c Client, h Host, ic *onboard.InitConfig) error {
+	systemdPath := path.Join(cm.SystemdKnoxctlDir, cm.KnoxctlConfigFilename)
+	dockerPath := `"$HOME"/` + path.Join(cm.DefaultConfigPathDirName, cm.KnoxctlConfigFilename)
+	cmd := fmt.Sprintf("%ssh -c %s", h.sudo(), shellQuote(fmt.Sprintf("cat %s 2>/dev/null || cat %s", systemdPath, dockerPath)))
+
+	out, err := c.Run(ctx, cmd, nil)
+	if err != nil {
+		return fmt.Errorf("reading the stored knoxctl config: %v: %s", err, lastLines(out, 5))
+	}
+	if err := json.Unmarshal([]byte(out), ic); err != nil {
+		return fmt.Errorf("parsing the stored knoxctl config: %v", err)
+	}
+	return nil
+}
+
+func controlPlaneArgs(inv *Inventory) []string {
+	args := []string{"onboard", "vm", "cp-node"}
+	if inv.Mode != "" {
+		args = append(args, "--vm-mode="+string(inv.Mode))
+	}
+	if inv.Version != "" {
+		args = append(args, "--version="+inv.Version)
+	}
+	return append(args, inv.ControlPlane.Args...)
+}
+
+// workerArgs returns the args joining w to the control plane, with the
+// version and TLS material of the onboarded control plane. The RabbitMQ
+// credentials are read from stdin.
+func workerArgs(inv *Inventory, w Host, ic *onboard.InitConfig) []string {
+	args := []string{"onboard", "vm", "node", "--cp-node-addr=" + inv.ControlPlane.Address}
+	if inv.Mode != "" {
+		args = append(args, "--vm-mode="+string(inv.Mode))
+	}
+
+	version := ic.AgentsVersion
+	if version == "" {
+		version = inv.Version
+	}
+	if version != "" {
+		args = append(args, "--version="+version)
+	}
+
+	if ic.Tls.Enabled {
+		args = append(args, "--tls", "--ca-cert="+ic.CaCert)
+		if ic.RMQCredentials != "" {
+			args = append(args, "--auth-file=-")
+		}
+	}
+
+	args = append(args, inv.WorkerArgs...)
+	return append(args, w.Args...)
+}
+
+func lastLines(s string, n int) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// PrintResults prints the status of every host and returns an error if any
+// host failed or was skipped
+func PrintResults(w io.Writer, results []HostResult) error {
+	table := tablewriter.NewWriter(w)
+	table.SetHeader([]string{"Host", "Role", "Status", "Attempts", "Duration", "Error"})
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetAutoWrapText(false)
+
+	var failed int
+	for _, r := range results {
+		if r.Status == StatusFailed || r.Status == StatusSkipped {
+			failed++
+		}
+		table.Append([]string{r.Host, string(r.Role), r.Status, fmt.Sprintf("%d", r.Attempts), r.Duration.String(), firstLine(r.Error)})
+	}
+	table.Render()
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d hosts failed", failed, len(results))
+	}
+	return nil
+}
+
+func firstLine(s string) string {
+	return strings.SplitN(s, "\n", 2)[0]
+}
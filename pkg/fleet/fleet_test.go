@@ -0,0 +1,318 @@
+package fleet
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/accuknox/accuknox-cli-v2/pkg/onboard"
+)
+
+const testInventory = `
+version: v0.10.0
+mode: systemd
+defaults:
+  user: ubuntu
+  identityFile: ~/.ssh/id_ed25519
+controlPlane:
+  host: 10.0.0.1
+  address: cp.internal
+  args: [--spire-host=spire.accuknox.com, --pps-host=pps.accuknox.com]
+workerArgs: [--spire-host=spire.accuknox.com]
+workers:
+  - host: 10.0.0.2
+  - host: 10.0.0.3
+    user: root
+    port: 2222
+    args: [--vm-name=worker 3]
+`
+
+func TestParseInventory(t *testing.T) {
+	inv, err := ParseInventory([]byte(testInventory))
+	if err != nil {
+		t.Fatalf("ParseInventory() error = %v", err)
+	}
+	if inv.ControlPlane.User != "ubuntu" || inv.ControlPlane.Port != defaultSSHPort {
+		t.Errorf("control plane ssh config = %+v, want the defaults", inv.ControlPlane.SSHConfig)
+	}
+	want := SSHConfig{User: "root", Port: 2222, IdentityFile: "~/.ssh/id_ed25519"}
+	if inv.Workers[1].SSHConfig != want {
+		t.Errorf("worker ssh config = %+v, want %+v", inv.Workers[1].SSHConfig, want)
+	}
+
+	invalid := []struct {
+		name, old, new, wantErr string
+	}{
+		{"unknown field", "mode: systemd", "mode: systemd\nhosts: []", "hosts"},
+		{"mode", "mode: systemd", "mode: podman", "mode"},
+		{"control plane", "  host: 10.0.0.1\n", "", "controlPlane.host"},
+		{"duplicate", "10.0.0.3", "10.0.0.2", "more than once"},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseInventory([]byte(strings.Replace(testInventory, tt.old, tt.new, 1)))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ParseInventory() error = %v, want it to mention %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	tests := map[string]string{
+		"--cp-node-addr=10.0.0.1": "--cp-node-addr=10.0.0.1",
+		"--vm-name=worker 3":      "'--vm-name=worker 3'",
+		"it's":                    `'it'\''s'`,
+		"":                        "''",
+	}
+	for in, want := range tests {
+		if got := shellQuote(in); got != want {
+			t.Errorf("shellQuote(%q) = %s, want %s", in, got, want)
+		}
+	}
+}
+
+// fakeHost records the commands run on it and fails the first failures
+// knoxctl runs
+type fakeHost struct {
+	mu       sync.Mutex
+	cmds     []string
+	stdin    []string
+	failures int
+	config   string
+	// uname is the output of uname -sm, the platform of the tests if empty
+	uname string
+}
+
+// testUname is the output of uname -sm on a host of the test platform
+func testUname() string {
+	for machine, arch := range unameArchs {
+		if arch == runtime.GOARCH && machine != arch {
+			return "Linux " + machine
+		}
+	}
+	return "Linux " + runtime.GOARCH
+}
+
+// testBinary copies the test executable, built for the test platform
+func testBinary(t *testing.T) string {
+	t.Helper()
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "knoxctl")
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+type fakeClient struct {
+	h *fakeHost
+}
+
+func (c fakeClient) Run(ctx context.Context, cmd string, stdin io.Reader) (string, error) {
+	c.h.mu.Lock()
+	defer c.h.mu.Unlock()
+	c.h.cmds = append(c.h.cmds, cmd)
+
+	switch {
+	case cmd == "uname -sm":
+		if c.h.uname != "" {
+			return c.h.uname, nil
+		}
+		return testUname(), nil
+	case strings.HasPrefix(cmd, "sha256sum"):
+		return "", errors.New("not found")
+	case strings.Contains(cmd, " sh -c "):
+		return c.h.config, nil
+	case strings.Contains(cmd, RemoteBinary+" onboard"):
+		if stdin != nil {
+			data, _ := io.ReadAll(stdin)
+			c.h.stdin = append(c.h.stdin, string(data))
+		}
+		if c.h.failures > 0 {
+			c.h.failures--
+			return "image pull failed", errors.New("exit status 1")
+		}
+	}
+	return "", nil
+}
+
+func (c fakeClient) Close() error { return nil }
+
+func testOnboard(t *testing.T, hosts map[string]*fakeHost, retries int) []HostResult {
+	t.Helper()
+	inv, err := ParseInventory([]byte(testInventory))
+	if err != nil {
+		t.Fatal(err)
+	}
+	inv.Binary = testBinary(t)
+
+	results, err := Onboard(context.Background(), inv, Options{
+		Retries: retries,
+		Dial: func(h Host) (Client, error) {
+			return fakeClient{h: hosts[h.Host]}, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("Onboard() error = %v", err)
+	}
+	for i := range results {
+		results[i].Duration = 0
+	}
+	return results
+}
+
+func TestOnboard(t *testing.T) {
+	hosts := map[string]*fakeHost{
+		"10.0.0.1": {config: `{"cluster_config":{"agents_version":"v0.10.0","ca_cert":"Y2E=","rmq_credentials":"dTpw","tls":{"enabled":true}}}`},
+		"10.0.0.2": {failures: 1},
+		"10.0.0.3": {failures: 2},
+	}
+	got := testOnboard(t, hosts, 1)
+	want := []HostResult{
+		{Host: "10.0.0.1", Role: onboard.NodeType_ControlPlane, Status: StatusOnboarded, Attempts: 1},
+		{Host: "10.0.0.2", Role: onboard.NodeType_WorkerNode, Status: StatusOnboarded, Attempts: 2},
+		{Host: "10.0.0.3", Role: onboard.NodeType_WorkerNode, Status: StatusFailed, Attempts: 2,
+			Error: "knoxctl onboard vm node: exit status 1: image pull failed"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Onboard() = %+v, want %+v", got, want)
+	}
+
+	wantCP := "sudo -n " + RemoteBinary + " onboard vm cp-node --vm-mode=systemd --version=v0.10.0 --spire-host=spire.accuknox.com --pps-host=pps.accuknox.com"
+	if cmds := hosts["10.0.0.1"].cmds; cmds[3] != wantCP {
+		t.Errorf("control plane command = %s, want %s", cmds[3], wantCP)
+	}
+	wantWorker := RemoteBinary + " onboard vm node --cp-node-addr=cp.internal --vm-mode=systemd --version=v0.10.0 --tls --ca-cert=Y2E= --auth-file=- --spire-host=spire.accuknox.com '--vm-name=worker 3'"
+	if cmds := hosts["10.0.0.3"].cmds; cmds[3] != wantWorker {
+		t.Errorf("worker command = %s, want %s", cmds[3], wantWorker)
+	}
+	if stdin := hosts["10.0.0.3"].stdin; len(stdin) == 0 || stdin[0] != "dTpw" {
+		t.Errorf("worker stdin = %q, want the rabbitmq credentials", stdin)
+	}
+}
+
+func TestOnboardPlatformMismatch(t *testing.T) {
+	hosts := map[string]*fakeHost{
+		"10.0.0.1": {uname: "Linux mips"},
+		"10.0.0.2": {},
+		"10.0.0.3": {},
+	}
+	got := testOnboard(t, hosts, 0)
+	if got[0].Status != StatusFailed || !strings.Contains(got[0].Error, "unsupported machine mips") {
+		t.Errorf("control plane result = %+v, want the unsupported machine", got[0])
+	}
+	for _, cmd := range hosts["10.0.0.1"].cmds {
+		if cmd != "uname -sm" {
+			t.Errorf("command %s run on a host of another platform", cmd)
+		}
+	}
+}
+
+func TestHostPlatform(t *testing.T) {
+	tests := []struct {
+		uname   string
+		want    string
+		wantErr bool
+	}{
+		{uname: "Linux x86_64\n", want: "linux/amd64"},
+		{uname: "Linux aarch64", want: "linux/arm64"},
+		{uname: "Darwin arm64", want: "darwin/arm64"},
+		{uname: "Linux sparc64", wantErr: true},
+		{uname: "sh: uname: not found", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := hostPlatform(tt.uname)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("hostPlatform(%q) = %s, %v, want %s", tt.uname, got, err, tt.want)
+		}
+	}
+}
+
+func TestEachWorkerCancelled(t *testing.T) {
+	inv, err := ParseInventory([]byte(testInventory))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var ran []string
+	results := eachWorker(ctx, inv, Options{Concurrency: 1}, func(w Host) HostResult {
+		ran = append(ran, w.Host)
+		// the second worker waits on the semaphore until cancelled
+		cancel()
+		return HostResult{Host: w.Host, Status: StatusOnboarded}
+	})
+	if len(ran) != 1 || results[1].Status != StatusSkipped {
+		t.Errorf("eachWorker() ran %v, results %+v, want the second worker skipped", ran, results)
+	}
+}
+
+func TestOnboardControlPlaneFailed(t *testing.T) {
+	hosts := map[string]*fakeHost{
+		"10.0.0.1": {failures: 1},
+		"10.0.0.2": {},
+		"10.0.0.3": {},
+	}
+	got := testOnboard(t, hosts, 0)
+	for _, r := range got[1:] {
+		if r.Status != StatusSkipped {
+			t.Errorf("worker %s status = %s, want %s", r.Host, r.Status, StatusSkipped)
+		}
+	}
+	if len(hosts["10.0.0.2"].cmds) != 0 {
+		t.Errorf("commands run on a worker of a failed control plane: %v", hosts["10.0.0.2"].cmds)
+	}
+}
+
+func TestPushCA(t *testing.T) {
+	inv, err := ParseInventory([]byte(testInventory))
+	if err != nil {
+		t.Fatal(err)
+	}
+	inv.Binary = testBinary(t)
+
+	hosts := map[string]*fakeHost{
+		"10.0.0.1": {},
+		"10.0.0.2": {},
+		"10.0.0.3": {},
+	}
+	results, err := PushCA(context.Background(), inv, "Y2E=", Options{
+		Dial: func(h Host) (Client, error) {
+			return fakeClient{h: hosts[h.Host]}, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("PushCA() error = %v", err)
+	}
+
+	if len(results) != 2 {
+		t.Fatalf("PushCA() = %+v, want a result per worker", results)
+	}
+	for _, r := range results {
+		if r.Status != StatusUpdated {
+			t.Errorf("worker %s status = %s, want %s", r.Host, r.Status, StatusUpdated)
+		}
+	}
+	if len(hosts["10.0.0.1"].cmds) != 0 {
+		t.Errorf("commands run on the control plane: %v", hosts["10.0.0.1"].cmds)
+	}
+	want := "sudo -n " + RemoteBinary + " onboard vm certs import --ca-cert=Y2E="
+	if cmds := hosts["10.0.0.2"].cmds; cmds[len(cmds)-1] != want {
+		t.Errorf("worker command = %s, want %s", cmds[len(cmds)-1], want)
+	}
+}
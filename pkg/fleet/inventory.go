@@ -0,0 +1,117 @@
+package fleet
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/accuknox/accuknox-cli-v2/pkg/onboard"
+	"sigs.k8s.io/yaml"
+)
+
+const defaultSSHPort = 22
+
+// SSHConfig holds how to connect to a host, unset fields are taken from the
+// inventory defaults
+type SSHConfig struct {
+	User         string `json:"user,omitempty"`
+	Port         int    `json:"port,omitempty"`
+	IdentityFile string `json:"identityFile,omitempty"`
+	// KnownHostsFile is used to verify the host keys, ~/.ssh/known_hosts by
+	// default
+	KnownHostsFile        string `json:"knownHostsFile,omitempty"`
+	InsecureIgnoreHostKey bool   `json:"insecureIgnoreHostKey,omitempty"`
+}
+
+// Host is a VM of the fleet
+type Host struct {
+	Host string `json:"host"`
+	// Address is the address the workers join the control plane at, the
+	// host by default
+	Address string `json:"address,omitempty"`
+	SSHConfig
+	// Args are the flags passed to knoxctl onboard vm cp-node or node
+	Args []string `json:"args,omitempty"`
+}
+
+// Inventory describes a control plane and the workers joining it
+type Inventory struct {
+	// Version is the agents release to onboard, the latest one by default
+	Version string         `json:"version,omitempty"`
+	Mode    onboard.VMMode `json:"mode,omitempty"`
+	// Binary is the knoxctl binary pushed to the hosts, the running one by
+	// default. It must be built for the OS and architecture of the hosts.
+	Binary   string    `json:"binary,omitempty"`
+	Defaults SSHConfig `json:"defaults,omitempty"`
+
+	ControlPlane Host   `json:"controlPlane"`
+	Workers      []Host `json:"workers,omitempty"`
+	// WorkerArgs are passed to every worker before its own args
+	WorkerArgs []string `json:"workerArgs,omitempty"`
+}
+
+// LoadInventory reads and validates an inventory file
+func LoadInventory(path string) (*Inventory, error) {
+	data, err := os.ReadFile(path) // #nosec G304 inventory path given by the user
+	if err != nil {
+		return nil, err
+	}
+	return ParseInventory(data)
+}
+
+// ParseInventory parses an inventory and fills the SSH config of every host
+// with the defaults
+func ParseInventory(data []byte) (*Inventory, error) {
+	var inv Inventory
+	if err := yaml.UnmarshalStrict(data, &inv); err != nil {
+		return nil, fmt.Errorf("invalid inventory: %v", err)
+	}
+
+	switch inv.Mode {
+	case "", onboard.VMMode_Docker, onboard.VMMode_Systemd:
+	default:
+		return nil, fmt.Errorf("invalid inventory: mode %s invalid, accepted values (docker/systemd)", inv.Mode)
+	}
+
+	if inv.ControlPlane.Host == "" {
+		return nil, fmt.Errorf("invalid inventory: controlPlane.host is required")
+	}
+	if inv.ControlPlane.Address == "" {
+		inv.ControlPlane.Address = inv.ControlPlane.Host
+	}
+	inv.ControlPlane.SSHConfig = inv.Defaults.merge(inv.ControlPlane.SSHConfig)
+
+	seen := map[string]bool{inv.ControlPlane.Host: true}
+	for i := range inv.Workers {
+		w := &inv.Workers[i]
+		if w.Host == "" {
+			return nil, fmt.Errorf("invalid inventory: workers[%d].host is required", i)
+		}
+		if seen[w.Host] {
+			return nil, fmt.Errorf("invalid inventory: host %s is listed more than once", w.Host)
+		}
+		seen[w.Host] = true
+		w.SSHConfig = inv.Defaults.merge(w.SSHConfig)
+	}
+	return &inv, nil
+}
+
+// merge returns the host config with the unset fields taken from sc
+func (sc SSHConfig) merge(host SSHConfig) SSHConfig {
+	if host.User == "" {
+		host.User = sc.User
+	}
+	if host.Port == 0 {
+		host.Port = sc.Port
+	}
+	if host.Port == 0 {
+		host.Port = defaultSSHPort
+	}
+	if host.IdentityFile == "" {
+		host.IdentityFile = sc.IdentityFile
+	}
+	if host.KnownHostsFile == "" {
+		host.KnownHostsFile = sc.KnownHostsFile
+	}
+	host.InsecureIgnoreHostKey = host.InsecureIgnoreHostKey || sc.InsecureIgnoreHostKey
+	return host
+}
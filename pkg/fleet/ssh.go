@@ -0,0 +1,167 @@
+package fleet
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const sshDialTimeout = 15 * time.Second
+
+// Client runs commands on a host
+type Client interface {
+	// Run runs cmd with stdin as its input and returns its combined output
+	Run(ctx context.Context, cmd string, stdin io.Reader) (string, error)
+	Close() error
+}
+
+// Dialer connects to a host
+type Dialer func(h Host) (Client, error)
+
+type sshClient struct {
+	client *ssh.Client
+}
+
+// DialSSH connects to a host over SSH, authenticating with its identity file
+// and the keys of the running ssh-agent
+func DialSSH(h Host) (Client, error) {
+	auth, agentConn, err := authMethods(h.IdentityFile)
+	if err != nil {
+		return nil, err
+	}
+	// the agent is only used while authenticating
+	if agentConn != nil {
+		defer agentConn.Close()
+	}
+	hostKeyCallback, err := hostKeyCallback(h.SSHConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &ssh.ClientConfig{
+		User:            h.User,
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         sshDialTimeout,
+	}
+	client, err := ssh.Dial("tcp", net.JoinHostPort(h.Host, strconv.Itoa(h.Port)), config)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to %s: %v", h.Host, err)
+	}
+	return &sshClient{client: client}, nil
+}
+
+// authMethods returns the ways to authenticate with, along with the
+// connection to the ssh-agent if one is running, which the caller closes
+func authMethods(identityFile string) ([]ssh.AuthMethod, net.Conn, error) {
+	var methods []ssh.AuthMethod
+	if identityFile != "" {
+		key, err := os.ReadFile(expandHome(identityFile))
+		if err != nil {
+			return nil, nil, fmt.Errorf("reading identity file: %v", err)
+		}
+		signer, err := ssh.ParsePrivateKey(key)
+		if err != nil {
+			return nil, nil, fmt.Errorf("parsing identity file %s: %v", identityFile, err)
+		}
+		methods = append(methods, ssh.PublicKeys(signer))
+	}
+
+	var agentConn net.Conn
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			agentConn = conn
+			methods = append(methods, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+		}
+	}
+
+	if len(methods) == 0 {
+		return nil, nil, fmt.Errorf("no SSH identity file specified and no ssh-agent running")
+	}
+	return methods, agentConn, nil
+}
+
+func hostKeyCallback(sc SSHConfig) (ssh.HostKeyCallback, error) {
+	if sc.InsecureIgnoreHostKey {
+		return ssh.InsecureIgnoreHostKey(), nil // #nosec G106 explicitly asked for in the inventory
+	}
+	path := sc.KnownHostsFile
+	if path == "" {
+		path = "~/.ssh/known_hosts"
+	}
+	callback, err := knownhosts.New(expandHome(path))
+	if err != nil {
+		return nil, fmt.Errorf("loading known hosts: %v", err)
+	}
+	return callback, nil
+}
+
+func expandHome(path string) string {
+	if !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[2:])
+}
+
+func (c *sshClient) Run(ctx context.Context, cmd string, stdin io.Reader) (string, error) {
+	session, err := c.client.NewSession()
+	if err != nil {
+		return "", err
+	}
+	defer session.Close()
+
+	var out bytes.Buffer
+	session.Stdout = &out
+	session.Stderr = &out
+	session.Stdin = stdin
+
+	done := make(chan error, 1)
+	go func() {
+		done <- session.Run(cmd)
+	}()
+
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		_ = session.Signal(ssh.SIGTERM)
+		err = ctx.Err()
+	}
+	return out.String(), err
+}
+
+func (c *sshClient) Close() error {
+	return c.client.Close()
+}
+
+// shellQuote quotes s to be passed as a single word to a POSIX shell
+func shellQuote(s string) string {
+	if s != "" && strings.IndexFunc(s, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_./:=,@+", r))
+	}) < 0 {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func shellJoin(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = shellQuote(arg)
+	}
+	return strings.Join(quoted, " ")
+}
@@ -0,0 +1,247 @@
+// Package lint statically validates KubeArmor policies before they are applied
+package lint
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/olekukonko/tablewriter"
+	"sigs.k8s.io/yaml"
+
+	katypes "github.com/kubearmor/KubeArmor/KubeArmor/types"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	KindKubeArmorPolicy     = "KubeArmorPolicy"
+	KindKubeArmorHostPolicy = "KubeArmorHostPolicy"
+
+	APIVersion = "security.kubearmor.com/v1"
+
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// Options for the lint command
+type Options struct {
+	JSON   bool
+	Strict bool
+}
+
+// Finding is a single problem reported for a policy
+type Finding struct {
+	File     string `json:"file"`
+	Policy   string `json:"policy,omitempty"`
+	Kind     string `json:"kind,omitempty"`
+	Severity string `json:"severity"`
+	Rule     string `json:"rule"`
+	Location string `json:"location,omitempty"`
+	Message  string `json:"message"`
+}
+
+// Result holds the findings of all the linted files
+type Result struct {
+	Files    int       `json:"files"`
+	Policies int       `json:"policies"`
+	Errors   int       `json:"errors"`
+	Warnings int       `json:"warnings"`
+	Findings []Finding `json:"findings"`
+}
+
+type kubeArmorPolicy struct {
+	APIVersion string               `json:"apiVersion"`
+	Kind       string               `json:"kind"`
+	Metadata   metav1.ObjectMeta    `json:"metadata"`
+	Spec       katypes.SecuritySpec `json:"spec"`
+}
+
+type kubeArmorHostPolicy struct {
+	APIVersion string                   `json:"apiVersion"`
+	Kind       string                   `json:"kind"`
+	Metadata   metav1.ObjectMeta        `json:"metadata"`
+	Spec       katypes.HostSecuritySpec `json:"spec"`
+}
+
+var docSeparator = regexp.MustCompile(`(?m)^---\s*$`)
+
+// Lint validates the policies in the given files or directories, prints the
+// findings and returns an error if any policy failed validation
+func Lint(o Options, paths []string) error {
+	files, err := expandPaths(paths)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no policy files found")
+	}
+
+	result := &Result{Findings: []Finding{}}
+	names := make(map[string]string)
+
+	for _, file := range files {
+		data, err := os.ReadFile(filepath.Clean(file))
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %v", file, err)
+		}
+		result.Files++
+
+		for _, doc := range docSeparator.Split(string(data), -1) {
+			if strings.TrimSpace(doc) == "" {
+				continue
+			}
+			result.Policies++
+			findings, id := LintDocument(file, []byte(doc))
+			if id != "" {
+				if other, exists := names[id]; exists {
+					findings = append(findings, Finding{
+						File:     file,
+						Policy:   id,
+						Severity: SeverityWarning,
+						Rule:     "duplicate",
+						Message:  fmt.Sprintf("policy is also defined in %s and one will overwrite the other", other),
+					})
+				} else {
+					names[id] = file
+				}
+			}
+			result.Findings = append(result.Findings, findings...)
+		}
+	}
+
+	for _, f := range result.Findings {
+		if f.Severity == SeverityError {
+			result.Errors++
+		} else {
+			result.Warnings++
+		}
+	}
+
+	if o.JSON {
+		out, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(out))
+	} else {
+		printTable(result)
+	}
+
+	if result.Errors > 0 || (o.Strict && result.Warnings > 0) {
+		return fmt.Errorf("policy lint failed with %d error(s) and %d warning(s)", result.Errors, result.Warnings)
+	}
+	return nil
+}
+
+// LintDocument validates a single YAML document, it returns the findings and
+// an identifier (kind/namespace/name) for the policy if one could be parsed
+func LintDocument(file string, doc []byte) ([]Finding, string) {
+	var header struct {
+		APIVersion string            `json:"apiVersion"`
+		Kind       string            `json:"kind"`
+		Metadata   metav1.ObjectMeta `json:"metadata"`
+	}
+	if err := yaml.Unmarshal(doc, &header); err != nil {
+		return []Finding{{File: file, Severity: SeverityError, Rule: "schema", Message: fmt.Sprintf("invalid YAML: %v", err)}}, ""
+	}
+
+	l := &linter{file: file, kind: header.Kind, policy: header.Metadata.Name}
+
+	if header.APIVersion != APIVersion {
+		l.errorf("schema", "apiVersion", "apiVersion must be %q, found %q", APIVersion, header.APIVersion)
+	}
+
+	switch header.Kind {
+	case KindKubeArmorPolicy:
+		var policy kubeArmorPolicy
+		if err := yaml.UnmarshalStrict(doc, &policy); err != nil {
+			l.errorf("schema", "", "%v", err)
+			return l.findings, ""
+		}
+		l.checkMetadata(policy.Metadata, true)
+		l.checkSelector(len(policy.Spec.Selector.MatchLabels) > 0 || len(policy.Spec.Selector.MatchExpressions) > 0, "spec.selector")
+		l.checkSpec(policy.Spec.Process, policy.Spec.File, policy.Spec.Network, policy.Spec.Capabilities,
+			len(policy.Spec.Syscalls.MatchSyscalls)+len(policy.Spec.Syscalls.MatchPaths)+len(policy.Spec.Presets),
+			policy.Spec.Action, policy.Spec.Severity)
+
+	case KindKubeArmorHostPolicy:
+		var policy kubeArmorHostPolicy
+		if err := yaml.UnmarshalStrict(doc, &policy); err != nil {
+			l.errorf("schema", "", "%v", err)
+			return l.findings, ""
+		}
+		l.checkMetadata(policy.Metadata, false)
+		l.checkSelector(len(policy.Spec.NodeSelector.MatchLabels) > 0, "spec.nodeSelector")
+		l.checkSpec(policy.Spec.Process, policy.Spec.File, policy.Spec.Network, policy.Spec.Capabilities,
+			len(policy.Spec.Syscalls.MatchSyscalls)+len(policy.Spec.Syscalls.MatchPaths),
+			policy.Spec.Action, policy.Spec.Severity)
+
+	default:
+		l.errorf("schema", "kind", "unsupported kind %q, expected %s or %s", header.Kind, KindKubeArmorPolicy, KindKubeArmorHostPolicy)
+		return l.findings, ""
+	}
+
+	if header.Metadata.Name == "" {
+		return l.findings, ""
+	}
+	return l.findings, header.Kind + "/" + header.Metadata.Namespace + "/" + header.Metadata.Name
+}
+
+// expandPaths walks directories and returns every YAML file found
+func expandPaths(paths []string) ([]string, error) {
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+
+		err = filepath.WalkDir(path, func(p string, d os.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if ext := filepath.Ext(p); !d.IsDir() && (ext == ".yaml" || ext == ".yml") {
+				files = append(files, p)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+func printTable(result *Result) {
+	if len(result.Findings) == 0 {
+		fmt.Printf("%d policies in %d file(s) passed validation\n", result.Policies, result.Files)
+		return
+	}
+
+	findings := append([]Finding{}, result.Findings...)
+	sort.SliceStable(findings, func(i, j int) bool {
+		if findings[i].File != findings[j].File {
+			return findings[i].File < findings[j].File
+		}
+		return findings[i].Severity < findings[j].Severity
+	})
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"File", "Policy", "Severity", "Rule", "Location", "Message"})
+	table.SetAutoWrapText(false)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	for _, f := range findings {
+		table.Append([]string{f.File, f.Policy, f.Severity, f.Rule, f.Location, f.Message})
+	}
+	table.Render()
+
+	fmt.Printf("%d policies in %d file(s): %d error(s), %d warning(s)\n", result.Policies, result.Files, result.Errors, result.Warnings)
+}
@@ -0,0 +1,247 @@
+package lint
+
+import (
+	"testing"
+)
+
+func hasFinding(findings []Finding, rule, severity string) bool {
+	for _, f := range findings {
+		if f.Rule == rule && f.Severity == severity {
+			return true
+		}
+	}
+	return false
+}
+
+func TestLintDocument(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   string
+		rule     string
+		severity string
+	}{
+		{
+			name: "unknown field fails schema validation",
+			policy: `
+apiVersion: security.kubearmor.com/v1
+kind: KubeArmorPolicy
+metadata:
+  name: ksp-unknown-field
+  namespace: default
+spec:
+  selector:
+    matchLabels:
+      app: nginx
+  file:
+    matchPath:
+    - path: /etc/passwd
+  action: Block
+`,
+			rule:     "schema",
+			severity: SeverityError,
+		},
+		{
+			name: "missing selector",
+			policy: `
+apiVersion: security.kubearmor.com/v1
+kind: KubeArmorPolicy
+metadata:
+  name: ksp-no-selector
+  namespace: default
+spec:
+  file:
+    matchPaths:
+    - path: /etc/passwd
+  action: Block
+`,
+			rule:     "selector",
+			severity: SeverityError,
+		},
+		{
+			name: "contradictory allow and block",
+			policy: `
+apiVersion: security.kubearmor.com/v1
+kind: KubeArmorPolicy
+metadata:
+  name: ksp-contradiction
+  namespace: default
+spec:
+  selector:
+    matchLabels:
+      app: nginx
+  file:
+    matchPaths:
+    - path: /etc/shadow
+      action: Allow
+    - path: /etc/shadow
+      fromSource:
+      - path: /bin/cat
+      action: Block
+  action: Audit
+`,
+			rule:     "contradiction",
+			severity: SeverityError,
+		},
+		{
+			name: "recursive root directory",
+			policy: `
+apiVersion: security.kubearmor.com/v1
+kind: KubeArmorHostPolicy
+metadata:
+  name: hsp-root
+spec:
+  nodeSelector:
+    matchLabels:
+      kubernetes.io/hostname: node-1
+  file:
+    matchDirectories:
+    - dir: /
+      recursive: true
+  action: Block
+`,
+			rule:     "broad-directory",
+			severity: SeverityError,
+		},
+		{
+			name: "unknown capability",
+			policy: `
+apiVersion: security.kubearmor.com/v1
+kind: KubeArmorPolicy
+metadata:
+  name: ksp-capability
+  namespace: default
+spec:
+  selector:
+    matchLabels:
+      app: nginx
+  capabilities:
+    matchCapabilities:
+    - capability: net_rawest
+  action: Block
+`,
+			rule:     "capability",
+			severity: SeverityError,
+		},
+		{
+			name: "source outside of the process allow list",
+			policy: `
+apiVersion: security.kubearmor.com/v1
+kind: KubeArmorPolicy
+metadata:
+  name: ksp-unreachable
+  namespace: default
+spec:
+  selector:
+    matchLabels:
+      app: nginx
+  process:
+    matchPaths:
+    - path: /usr/sbin/nginx
+  file:
+    matchDirectories:
+    - dir: /var/log/nginx/
+      fromSource:
+      - path: /usr/bin/tail
+  action: Allow
+`,
+			rule:     "unreachable-source",
+			severity: SeverityWarning,
+		},
+		{
+			name: "severity out of range",
+			policy: `
+apiVersion: security.kubearmor.com/v1
+kind: KubeArmorPolicy
+metadata:
+  name: ksp-severity
+  namespace: default
+spec:
+  severity: 11
+  selector:
+    matchLabels:
+      app: nginx
+  file:
+    matchPaths:
+    - path: /etc/passwd
+  action: Block
+`,
+			rule:     "severity",
+			severity: SeverityError,
+		},
+		{
+			name: "process rule without path or execname",
+			policy: `
+apiVersion: security.kubearmor.com/v1
+kind: KubeArmorPolicy
+metadata:
+  name: ksp-no-path
+  namespace: default
+spec:
+  selector:
+    matchLabels:
+      app: nginx
+  process:
+    matchPaths:
+    - ownerOnly: true
+  action: Block
+`,
+			rule:     "path",
+			severity: SeverityError,
+		},
+		{
+			name: "unsupported kind",
+			policy: `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: cm
+`,
+			rule:     "schema",
+			severity: SeverityError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			findings, _ := LintDocument("policy.yaml", []byte(tt.policy))
+			if !hasFinding(findings, tt.rule, tt.severity) {
+				t.Errorf("LintDocument() = %+v, want a %s finding for rule %s", findings, tt.severity, tt.rule)
+			}
+		})
+	}
+}
+
+func TestLintDocumentValid(t *testing.T) {
+	policy := `
+apiVersion: security.kubearmor.com/v1
+kind: KubeArmorPolicy
+metadata:
+  name: ksp-nginx
+  namespace: default
+spec:
+  selector:
+    matchLabels:
+      app: nginx
+  process:
+    matchPaths:
+    - path: /usr/sbin/nginx
+    - execname: nginx
+  file:
+    matchDirectories:
+    - dir: /var/log/nginx/
+      recursive: true
+      fromSource:
+      - path: /usr/sbin/nginx
+  network:
+    matchProtocols:
+    - protocol: tcp
+  action: Allow
+`
+	findings, id := LintDocument("policy.yaml", []byte(policy))
+	if len(findings) != 0 {
+		t.Errorf("LintDocument() = %+v, want no findings", findings)
+	}
+	if id != "KubeArmorPolicy/default/ksp-nginx" {
+		t.Errorf("LintDocument() id = %s", id)
+	}
+}
@@ -0,0 +1,334 @@
+package lint
+
+import (
+	"fmt"
+	"strings"
+
+	katypes "github.com/kubearmor/KubeArmor/KubeArmor/types"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	actionAllow = "Allow"
+	actionAudit = "Audit"
+	actionBlock = "Block"
+)
+
+var validActions = map[string]bool{
+	actionAllow: true,
+	actionAudit: true,
+	actionBlock: true,
+}
+
+var validProtocols = map[string]bool{
+	"all":    true,
+	"icmp":   true,
+	"icmpv6": true,
+	"raw":    true,
+	"sctp":   true,
+	"tcp":    true,
+	"udp":    true,
+}
+
+// validCapabilities as understood by KubeArmor, i.e. linux capabilities in
+// lowercase without the `cap_` prefix
+var validCapabilities = map[string]bool{
+	"audit_control": true, "audit_read": true, "audit_write": true, "block_suspend": true,
+	"bpf": true, "checkpoint_restore": true, "chown": true, "dac_override": true,
+	"dac_read_search": true, "fowner": true, "fsetid": true, "ipc_lock": true,
+	"ipc_owner": true, "kill": true, "lease": true, "linux_immutable": true,
+	"mac_admin": true, "mac_override": true, "mknod": true, "net_admin": true,
+	"net_bind_service": true, "net_broadcast": true, "net_raw": true, "perfmon": true,
+	"setfcap": true, "setgid": true, "setpcap": true, "setuid": true,
+	"sys_admin": true, "sys_boot": true, "sys_chroot": true, "sys_module": true,
+	"sys_nice": true, "sys_pacct": true, "sys_ptrace": true, "sys_rawio": true,
+	"sys_resource": true, "sys_time": true, "sys_tty_config": true, "syslog": true,
+	"wake_alarm": true,
+}
+
+type linter struct {
+	file     string
+	kind     string
+	policy   string
+	findings []Finding
+}
+
+// rule is the flattened form of any process, file, network or capability
+// rule which is used for the cross rule checks
+type rule struct {
+	location  string
+	category  string
+	target    string
+	dir       string
+	recursive bool
+	sources   []string
+	action    string
+}
+
+func (l *linter) add(severity, name, location, format string, a ...any) {
+	l.findings = append(l.findings, Finding{
+		File:     l.file,
+		Policy:   l.policy,
+		Kind:     l.kind,
+		Severity: severity,
+		Rule:     name,
+		Location: location,
+		Message:  fmt.Sprintf(format, a...),
+	})
+}
+
+func (l *linter) errorf(name, location, format string, a ...any) {
+	l.add(SeverityError, name, location, format, a...)
+}
+
+func (l *linter) warnf(name, location, format string, a ...any) {
+	l.add(SeverityWarning, name, location, format, a...)
+}
+
+func (l *linter) checkMetadata(meta metav1.ObjectMeta, namespaced bool) {
+	if meta.Name == "" {
+		l.errorf("metadata", "metadata.name", "policy name is missing")
+	}
+	if namespaced && meta.Namespace == "" {
+		l.warnf("metadata", "metadata.namespace", "namespace is not set, the policy will be applied to the namespace it is created in")
+	}
+}
+
+func (l *linter) checkSelector(present bool, location string) {
+	if !present {
+		l.errorf("selector", location, "selector is missing, the policy does not target any workload explicitly")
+	}
+}
+
+func (l *linter) checkSeverity(severity int, location string) {
+	// 0 is the default when the severity is not set
+	if severity != 0 && (severity < 1 || severity > 10) {
+		l.errorf("severity", location, "severity must be between 1 and 10 when set, found %d", severity)
+	}
+}
+
+// resolveAction returns the action of the innermost level it is set at
+func resolveAction(actions ...string) string {
+	for _, action := range actions {
+		if action != "" {
+			return action
+		}
+	}
+	return ""
+}
+
+func (l *linter) checkAction(action, location string) {
+	if action != "" && !validActions[action] {
+		l.errorf("action", location, "invalid action %q, expected one of Allow, Audit or Block", action)
+	}
+}
+
+func (l *linter) checkSpec(process katypes.ProcessType, file katypes.FileType, network katypes.NetworkType,
+	capabilities katypes.CapabilitiesType, otherRules int, action string, severity int) {
+
+	l.checkAction(action, "spec.action")
+	l.checkAction(process.Action, "spec.process.action")
+	l.checkAction(file.Action, "spec.file.action")
+	l.checkAction(network.Action, "spec.network.action")
+	l.checkAction(capabilities.Action, "spec.capabilities.action")
+	l.checkSeverity(severity, "spec.severity")
+
+	var rules []rule
+
+	for i, p := range process.MatchPaths {
+		loc := fmt.Sprintf("spec.process.matchPaths[%d]", i)
+		key := "path:" + p.Path
+		switch {
+		case p.Path != "":
+			l.checkPath(p.Path, loc)
+		case p.ExecName != "":
+			// execname matches the name of the executable, not its path
+			key = "execname:" + p.ExecName
+		default:
+			l.errorf("path", loc, "either path or execname must be set")
+		}
+		l.checkAction(p.Action, loc+".action")
+		l.checkSeverity(p.Severity, loc+".severity")
+		rules = append(rules, rule{loc, "process", key, "", false, sourcePaths(p.FromSource), resolveAction(p.Action, process.Action, action)})
+	}
+	for i, d := range process.MatchDirectories {
+		loc := fmt.Sprintf("spec.process.matchDirectories[%d]", i)
+		l.checkDir(d.Directory, d.Recursive, resolveAction(d.Action, process.Action, action), loc)
+		l.checkAction(d.Action, loc+".action")
+		l.checkSeverity(d.Severity, loc+".severity")
+		rules = append(rules, rule{loc, "process", fmt.Sprintf("dir:%s:%t", d.Directory, d.Recursive), d.Directory, d.Recursive, sourcePaths(d.FromSource), resolveAction(d.Action, process.Action, action)})
+	}
+	for i, p := range process.MatchPatterns {
+		loc := fmt.Sprintf("spec.process.matchPatterns[%d]", i)
+		l.checkAction(p.Action, loc+".action")
+		l.checkSeverity(p.Severity, loc+".severity")
+		rules = append(rules, rule{loc, "process", "pattern:" + p.Pattern, "", false, nil, resolveAction(p.Action, process.Action, action)})
+	}
+
+	for i, p := range file.MatchPaths {
+		loc := fmt.Sprintf("spec.file.matchPaths[%d]", i)
+		l.checkPath(p.Path, loc)
+		l.checkAction(p.Action, loc+".action")
+		l.checkSeverity(p.Severity, loc+".severity")
+		rules = append(rules, rule{loc, "file", fmt.Sprintf("path:%s:%t", p.Path, p.ReadOnly), "", false, sourcePaths(p.FromSource), resolveAction(p.Action, file.Action, action)})
+	}
+	for i, d := range file.MatchDirectories {
+		loc := fmt.Sprintf("spec.file.matchDirectories[%d]", i)
+		l.checkDir(d.Directory, d.Recursive, resolveAction(d.Action, file.Action, action), loc)
+		l.checkAction(d.Action, loc+".action")
+		l.checkSeverity(d.Severity, loc+".severity")
+		rules = append(rules, rule{loc, "file", fmt.Sprintf("dir:%s:%t:%t", d.Directory, d.Recursive, d.ReadOnly), "", false, sourcePaths(d.FromSource), resolveAction(d.Action, file.Action, action)})
+	}
+	for i, p := range file.MatchPatterns {
+		loc := fmt.Sprintf("spec.file.matchPatterns[%d]", i)
+		l.checkAction(p.Action, loc+".action")
+		l.checkSeverity(p.Severity, loc+".severity")
+		rules = append(rules, rule{loc, "file", fmt.Sprintf("pattern:%s:%t", p.Pattern, p.ReadOnly), "", false, nil, resolveAction(p.Action, file.Action, action)})
+	}
+
+	for i, p := range network.MatchProtocols {
+		loc := fmt.Sprintf("spec.network.matchProtocols[%d]", i)
+		if !validProtocols[strings.ToLower(p.Protocol)] {
+			l.errorf("protocol", loc, "unknown protocol %q", p.Protocol)
+		}
+		l.checkAction(p.Action, loc+".action")
+		l.checkSeverity(p.Severity, loc+".severity")
+		rules = append(rules, rule{loc, "network", "protocol:" + strings.ToLower(p.Protocol), "", false, sourcePaths(p.FromSource), resolveAction(p.Action, network.Action, action)})
+	}
+
+	for i, c := range capabilities.MatchCapabilities {
+		loc := fmt.Sprintf("spec.capabilities.matchCapabilities[%d]", i)
+		name := strings.TrimPrefix(strings.ToLower(c.Capability), "cap_")
+		if !validCapabilities[name] {
+			l.errorf("capability", loc, "unknown capability %q", c.Capability)
+		} else if name != c.Capability {
+			l.warnf("capability", loc, "capability %q should be written as %q", c.Capability, name)
+		}
+		l.checkAction(c.Action, loc+".action")
+		l.checkSeverity(c.Severity, loc+".severity")
+		rules = append(rules, rule{loc, "capabilities", "capability:" + name, "", false, sourcePaths(c.FromSource), resolveAction(c.Action, capabilities.Action, action)})
+	}
+
+	if len(rules)+otherRules == 0 {
+		l.errorf("empty", "spec", "policy does not contain any rule")
+		return
+	}
+
+	for _, r := range rules {
+		if r.action == "" {
+			l.warnf("action", r.location, "action is not set on the rule nor at the policy level")
+		}
+	}
+
+	l.checkContradictions(rules)
+	l.checkSources(rules)
+}
+
+func (l *linter) checkPath(path, location string) {
+	if !strings.HasPrefix(path, "/") || strings.HasSuffix(path, "/") {
+		l.errorf("path", location+".path", "path %q must be absolute and must not end with '/'", path)
+	}
+}
+
+func (l *linter) checkDir(dir string, recursive bool, action, location string) {
+	if !strings.HasPrefix(dir, "/") || !strings.HasSuffix(dir, "/") {
+		l.errorf("path", location+".dir", "directory %q must be absolute and must end with '/'", dir)
+	}
+	if dir == "/" && recursive {
+		if action == actionAudit {
+			l.warnf("broad-directory", location, "matching '/' recursively audits every access on the system")
+		} else {
+			l.errorf("broad-directory", location, "matching '/' recursively with action %s applies to every path on the system", action)
+		}
+	}
+}
+
+// checkContradictions flags rules for the same target where one allows and
+// the other blocks the access for an overlapping set of sources
+func (l *linter) checkContradictions(rules []rule) {
+	for i := range rules {
+		for j := i + 1; j < len(rules); j++ {
+			a, b := rules[i], rules[j]
+			if a.category != b.category || a.target != b.target || !sourcesOverlap(a.sources, b.sources) {
+				continue
+			}
+			if (a.action == actionAllow && b.action == actionBlock) || (a.action == actionBlock && b.action == actionAllow) {
+				l.errorf("contradiction", b.location, "rule contradicts %s, the same target is both allowed and blocked", a.location)
+			}
+		}
+	}
+}
+
+// checkSources flags fromSource paths which can never match, either since they
+// are malformed or since the process itself is not permitted to execute by
+// the process rules of the same policy
+func (l *linter) checkSources(rules []rule) {
+	var allowed, blocked []rule
+	for _, r := range rules {
+		if r.category != "process" || len(r.sources) > 0 {
+			continue
+		}
+		switch r.action {
+		case actionAllow:
+			allowed = append(allowed, r)
+		case actionBlock:
+			blocked = append(blocked, r)
+		}
+	}
+
+	for _, r := range rules {
+		for _, src := range r.sources {
+			if !strings.HasPrefix(src, "/") || strings.HasSuffix(src, "/") {
+				l.errorf("unreachable-source", r.location+".fromSource", "source %q must be an absolute path to an executable", src)
+				continue
+			}
+			if by := matchingRule(blocked, src); by != nil {
+				l.warnf("unreachable-source", r.location+".fromSource", "source %q is blocked from executing by %s", src, by.location)
+				continue
+			}
+			if len(allowed) > 0 && matchingRule(allowed, src) == nil {
+				l.warnf("unreachable-source", r.location+".fromSource", "source %q is not in the process allow list of this policy and can never execute", src)
+			}
+		}
+	}
+}
+
+// matchingRule returns the first process rule that matches the executable
+func matchingRule(rules []rule, executable string) *rule {
+	for i, r := range rules {
+		if r.target == "path:"+executable {
+			return &rules[i]
+		}
+		if r.dir == "" || !strings.HasPrefix(executable, r.dir) {
+			continue
+		}
+		if r.recursive || !strings.Contains(strings.TrimPrefix(executable, r.dir), "/") {
+			return &rules[i]
+		}
+	}
+	return nil
+}
+
+// sourcesOverlap reports whether two rules apply to at least one common
+// source. A rule without any source applies to every source.
+func sourcesOverlap(a, b []string) bool {
+	if len(a) == 0 || len(b) == 0 {
+		return true
+	}
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func sourcePaths(sources []katypes.MatchSourceType) []string {
+	var paths []string
+	for _, src := range sources {
+		paths = append(paths, src.Path)
+	}
+	return paths
+}
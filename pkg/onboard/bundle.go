@@ -0,0 +1,634 @@
+package onboard
+
+import (
+	"archive/tar"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	cm "github.com/accuknox/accuknox-cli-v2/pkg/common"
+	"github.com/accuknox/accuknox-cli-v2/pkg/logger"
+	"golang.org/x/mod/semver"
+)
+
+const (
+	bundleManifestFile = "manifest.json"
+	bundleReleaseFile  = "release.json"
+	bundleImagesFile   = "images/docker-images.tar"
+	bundleAgentsDir    = "systemd"
+)
+
+// bundleManifestSigFile is the signature of the manifest, covering the whole
+// bundle through its checksums
+const bundleManifestSigFile = bundleManifestFile + cm.ReleaseSignatureExt
+
+// DefaultBundleFile returns the default path of the bundle of a release
+func DefaultBundleFile(version string) string {
+	return fmt.Sprintf("knoxctl-bundle-%s.tar", version)
+}
+
+// BundleManifest describes the content of an air-gapped bundle
+type BundleManifest struct {
+	Version          string   `json:"version"`
+	CreationTime     string   `json:"creation_time"`
+	Registry         string   `json:"registry"`
+	PreserveUpstream bool     `json:"preserve_upstream"`
+	Modes            []VMMode `json:"modes"`
+	// Images are the docker images saved in the bundle
+	Images []string `json:"images,omitempty"`
+	// Agents are the systemd packages of the bundle
+	Agents []BundleAgent `json:"agents,omitempty"`
+	// Checksums are the sha256 sums of the files of the bundle
+	Checksums map[string]string `json:"checksums"`
+}
+
+// BundleAgent is a systemd package of a bundle
+type BundleAgent struct {
+	Name  string `json:"name"`
+	Image string `json:"image"`
+	File  string `json:"file"`
+	// Manifest is the OCI manifest the package was downloaded with, to
+	// verify it against the digest pinned by the release
+	Manifest string `json:"manifest,omitempty"`
+}
+
+// BundleOptions are the options of creating a bundle
+type BundleOptions struct {
+	// Version is the agents release to bundle, the latest one by default
+	Version     string
+	ReleaseFile string
+	Modes       []VMMode
+	// Output is the path of the bundle, DefaultBundleFile by default
+	Output string
+	// SigningKey is the file of the key signing the manifest of the bundle
+	SigningKey string
+
+	Registry           string
+	RegistryConfigPath string
+	Insecure           bool
+	PlainHTTP          bool
+	PreserveUpstream   bool
+}
+
+// bundleImages returns the docker images of every agent, whatever the node
+// type
+func (cc *ClusterConfig) bundleImages() []string {
+	var images []string
+	for _, image := range []string{
+		cc.KubeArmorImage, cc.KubeArmorInitImage, cc.KubeArmorVMAdapterImage,
+		cc.KubeArmorRelayServerImage, cc.SIAImage, cc.PEAImage, cc.FeederImage,
+		cc.RMQImage, cc.SumEngineImage, cc.HardeningAgentImage, cc.SPIREAgentImage,
+		cc.WaitForItImage, cc.DiscoverImage,
+	} {
+		if image != "" && !slices.Contains(images, image) {
+			images = append(images, image)
+		}
+	}
+	sort.Strings(images)
+	return images
+}
+
+// bundleAgents returns the systemd agents installed from packages
+func (cc *ClusterConfig) bundleAgents() []SystemdServiceObject {
+	var agents []SystemdServiceObject
+	for _, obj := range cc.SystemdServiceObjects {
+		if obj.AgentImage != "" && obj.PackageName != "" {
+			agents = append(agents, obj)
+		}
+	}
+	return agents
+}
+
+// CreateBundle saves the docker images and downloads the systemd packages of
+// a release into a single archive, with the checksums of its files
+func CreateBundle(o BundleOptions) (*BundleManifest, error) {
+	var (
+		releases    map[string]cm.ReleaseMetadata
+		releaseData []byte
+		err         error
+	)
+	if o.ReleaseFile != "" {
+		releaseData, err = cm.ReadReleaseFile(o.ReleaseFile)
+	} else {
+		releaseData = cm.EmbeddedReleaseFile()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(releaseData, &releases); err != nil {
+		return nil, fmt.Errorf("invalid release file: %v", err)
+	}
+
+	var signingKey ed25519.PrivateKey
+	if o.SigningKey != "" {
+		data, err := os.ReadFile(filepath.Clean(o.SigningKey))
+		if err != nil {
+			return nil, err
+		}
+		if signingKey, err = cm.ParseReleaseSigningKey(data); err != nil {
+			return nil, err
+		}
+	} else {
+		logger.Warn("No signing key given, the bundle can only be installed with --skip-verification")
+	}
+
+	version := o.Version
+	if version == "" {
+		for v := range releases {
+			if version == "" || semver.Compare(v, version) > 0 {
+				version = v
+			}
+		}
+	}
+	release, ok := releases[version]
+	if !ok {
+		return nil, fmt.Errorf("release %s not found", version)
+	}
+	if o.Output == "" {
+		o.Output = DefaultBundleFile(version)
+	}
+
+	dir, err := os.MkdirTemp("", "knoxctl-bundle-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	manifest := &BundleManifest{
+		Version:          version,
+		CreationTime:     time.Now().UTC().Format(time.RFC3339),
+		Registry:         o.Registry,
+		PreserveUpstream: o.PreserveUpstream,
+		Modes:            o.Modes,
+		Checksums:        make(map[string]string),
+	}
+
+	for _, mode := range o.Modes {
+		cc := &ClusterConfig{Mode: mode}
+		if err := cc.setImages(agentImages{}, release, o.Registry, o.PreserveUpstream); err != nil {
+			return nil, err
+		}
+
+		switch mode {
+		case VMMode_Docker:
+			if manifest.Images, err = cc.saveImages(dir); err != nil {
+				return nil, err
+			}
+		case VMMode_Systemd:
+			if manifest.Agents, err = cc.downloadBundleAgents(dir, o); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("vm mode: %s invalid, accepted values (docker/systemd)", mode)
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, bundleReleaseFile), releaseData, 0o600); err != nil {
+		return nil, err
+	}
+	// keep the signature of the release file to verify it on install
+	releaseSig := cm.EmbeddedReleaseSignature()
+	if o.ReleaseFile != "" {
+		releaseSig, err = os.ReadFile(filepath.Clean(o.ReleaseFile + cm.ReleaseSignatureExt))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	if len(releaseSig) > 0 {
+		if err := os.WriteFile(filepath.Join(dir, bundleReleaseFile+cm.ReleaseSignatureExt), releaseSig, 0o600); err != nil {
+			return nil, err
+		}
+	}
+	err = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		manifest.Checksums[filepath.ToSlash(rel)], err = fileChecksum(p)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, bundleManifestFile), data, 0o600); err != nil {
+		return nil, err
+	}
+	if signingKey != nil {
+		if err := os.WriteFile(filepath.Join(dir, bundleManifestSigFile), cm.SignData(data, signingKey), 0o600); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := writeBundle(o.Output, dir); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// saveImages pulls the docker images of the agents and saves them in dir
+func (cc *ClusterConfig) saveImages(dir string) ([]string, error) {
+	if _, err := cc.ValidateEnv(); err != nil {
+		return nil, err
+	}
+
+	images := cc.bundleImages()
+	for _, image := range images {
+		logger.Print("Pulling image %s", image)
+		if _, err := ExecDockerCommand(true, false, cc.ContainerRuntime.cli(), "pull", image); err != nil {
+			return nil, fmt.Errorf("pulling %s: %v", image, err)
+		}
+	}
+
+	file := filepath.Join(dir, filepath.FromSlash(bundleImagesFile))
+	if err := os.MkdirAll(filepath.Dir(file), 0o750); err != nil {
+		return nil, err
+	}
+	logger.Print("Saving %d images", len(images))
+	args := append([]string{"save", "-o", file}, images...)
+	if _, err := ExecDockerCommand(true, false, cc.ContainerRuntime.cli(), args...); err != nil {
+		return nil, fmt.Errorf("saving images: %v", err)
+	}
+	return images, nil
+}
+
+// downloadBundleAgents downloads the systemd packages of the agents in dir
+func (cc *ClusterConfig) downloadBundleAgents(dir string, o BundleOptions) ([]BundleAgent, error) {
+	cc.CreateSystemdServiceObjects()
+
+	loginOptions := LoginOptions{
+		Insecure:           o.Insecure,
+		PlainHTTP:          o.PlainHTTP,
+		Registry:           o.Registry,
+		RegistryConfigPath: o.RegistryConfigPath,
+	}
+	cc.PlainHTTP = loginOptions.isPlainHttp(o.Registry)
+
+	var err error
+	if cc.ORASClient, err = loginOptions.ORASGetAuthClient(); err != nil {
+		return nil, err
+	}
+
+	agentsDir := filepath.Join(dir, bundleAgentsDir)
+	var agents []BundleAgent
+	for _, obj := range cc.bundleAgents() {
+		logger.Print("Downloading Agent - %s | Image - %s", obj.AgentName, obj.AgentImage)
+		packageMeta := splitLast(obj.AgentImage, ":")
+		file, manifest, err := cc.fetchAgent(agentsDir, obj.AgentName, packageMeta[0], packageMeta[1])
+		if err != nil {
+			return nil, fmt.Errorf("downloading %s: %v", obj.AgentName, err)
+		}
+		manifestFile := strings.TrimSuffix(file, ".tar.gz") + ".manifest.json"
+		if err := os.WriteFile(manifestFile, manifest, 0o600); err != nil {
+			return nil, err
+		}
+		agents = append(agents, BundleAgent{
+			Name:     obj.AgentName,
+			Image:    obj.AgentImage,
+			File:     path.Join(bundleAgentsDir, filepath.Base(file)),
+			Manifest: path.Join(bundleAgentsDir, filepath.Base(manifestFile)),
+		})
+	}
+	return agents, nil
+}
+
+func fileChecksum(name string) (string, error) {
+	f, err := os.Open(filepath.Clean(name))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// writeBundle archives dir with the manifest first
+func writeBundle(output, dir string) error {
+	out, err := os.Create(filepath.Clean(output))
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	tw := tar.NewWriter(out)
+	files := []string{bundleManifestFile}
+	err = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err == nil && rel != bundleManifestFile {
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, name := range files {
+		if err := addTarFile(tw, filepath.Join(dir, filepath.FromSlash(name)), name); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+func addTarFile(tw *tar.Writer, file, name string) error {
+	f, err := os.Open(filepath.Clean(file))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0o644,
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+	}); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// Bundle is an extracted air-gapped bundle
+type Bundle struct {
+	Manifest BundleManifest
+	dir      string
+}
+
+// OpenBundle extracts a bundle and verifies the checksums of its files
+func OpenBundle(file string) (*Bundle, error) {
+	dir, err := os.MkdirTemp("", "knoxctl-bundle-")
+	if err != nil {
+		return nil, err
+	}
+	b := &Bundle{dir: dir}
+
+	if err := b.extract(file); err != nil {
+		_ = b.Close()
+		return nil, fmt.Errorf("invalid bundle %s: %v", file, err)
+	}
+	return b, nil
+}
+
+func (b *Bundle) extract(file string) error {
+	f, err := os.Open(filepath.Clean(file))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	sums := make(map[string]string)
+	tr := tar.NewReader(f)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		name, err := bundlePath(header.Name)
+		if err != nil {
+			return err
+		}
+		dest := filepath.Join(b.dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(dest), 0o750); err != nil {
+			return err
+		}
+		out, err := os.OpenFile(dest, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600) // #nosec G304 path checked by bundlePath
+		if err != nil {
+			return err
+		}
+		h := sha256.New()
+		_, err = io.Copy(io.MultiWriter(out, h), tr) // #nosec G110 size bounded by the bundle
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+		sums[name] = hex.EncodeToString(h.Sum(nil))
+	}
+
+	data, err := os.ReadFile(filepath.Join(b.dir, bundleManifestFile))
+	if err != nil {
+		return fmt.Errorf("reading %s: %v", bundleManifestFile, err)
+	}
+	if err := b.verifyManifest(data); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, &b.Manifest); err != nil {
+		return fmt.Errorf("parsing %s: %v", bundleManifestFile, err)
+	}
+	delete(sums, bundleManifestFile)
+	delete(sums, bundleManifestSigFile)
+	return verifyChecksums(b.Manifest.Checksums, sums)
+}
+
+// verifyManifest checks the manifest of the bundle was signed with a trusted
+// key
+func (b *Bundle) verifyManifest(data []byte) error {
+	if cm.SkipReleaseVerification {
+		return nil
+	}
+	sig, err := os.ReadFile(b.path(bundleManifestSigFile))
+	if os.IsNotExist(err) {
+		return fmt.Errorf("%s is not signed", bundleManifestFile)
+	} else if err != nil {
+		return err
+	}
+	if err := cm.VerifySignature(data, sig); err != nil {
+		return fmt.Errorf("failed to verify %s: %v", bundleManifestFile, err)
+	}
+	return nil
+}
+
+// bundlePath cleans the name of a file of a bundle, rejecting the ones
+// escaping the bundle
+func bundlePath(name string) (string, error) {
+	clean := path.Clean(name)
+	if path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", fmt.Errorf("file %s outside of the bundle", name)
+	}
+	return clean, nil
+}
+
+// verifyChecksums compares the sums of the files found in a bundle with the
+// ones of its manifest
+func verifyChecksums(want, got map[string]string) error {
+	for name, sum := range want {
+		gotSum, ok := got[name]
+		if !ok {
+			return fmt.Errorf("%s is missing", name)
+		}
+		if gotSum != sum {
+			return fmt.Errorf("checksum mismatch for %s", name)
+		}
+	}
+	for name := range got {
+		if _, ok := want[name]; !ok {
+			return fmt.Errorf("%s is not in the manifest", name)
+		}
+	}
+	return nil
+}
+
+// ReleaseFile returns the release file the bundle was created with
+func (b *Bundle) ReleaseFile() string {
+	return filepath.Join(b.dir, bundleReleaseFile)
+}
+
+// Close removes the extracted bundle
+func (b *Bundle) Close() error {
+	return os.RemoveAll(b.dir)
+}
+
+// agent returns the package of the agent with the given image
+func (b *Bundle) agent(image string) (BundleAgent, error) {
+	for _, agent := range b.Manifest.Agents {
+		if agent.Image == image {
+			return agent, nil
+		}
+	}
+	return BundleAgent{}, fmt.Errorf("%s not found in the bundle", image)
+}
+
+// path returns where a file of the bundle is extracted
+func (b *Bundle) path(name string) string {
+	return filepath.Join(b.dir, filepath.FromSlash(name))
+}
+
+// ociManifest is the part of an OCI manifest describing the files of an
+// artifact
+type ociManifest struct {
+	Layers []struct {
+		Digest      string            `json:"digest"`
+		Annotations map[string]string `json:"annotations,omitempty"`
+	} `json:"layers"`
+}
+
+// ociTitleAnnotation is the annotation holding the file name of a layer
+const ociTitleAnnotation = "org.opencontainers.image.title"
+
+// bundleAgent returns the package of an agent from the bundle, after checking
+// it matches the digest pinned by the release through the manifest it was
+// downloaded with
+func (cc *ClusterConfig) bundleAgent(agentRepo, agentTag string) (string, error) {
+	agent, err := cc.bundle.agent(agentRepo + ":" + agentTag)
+	if err != nil {
+		return "", err
+	}
+	file := cc.bundle.path(agent.File)
+	if cm.SkipReleaseVerification {
+		return file, nil
+	}
+
+	if agent.Manifest == "" {
+		return "", fmt.Errorf("bundle has no manifest for %s, use --skip-verification to install it anyway", agent.Image)
+	}
+	data, err := os.ReadFile(cc.bundle.path(agent.Manifest))
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	if err := cc.verifyDigest(agentRepo, agentTag, "sha256:"+hex.EncodeToString(sum[:])); err != nil {
+		return "", err
+	}
+
+	var manifest ociManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return "", fmt.Errorf("invalid manifest of %s: %v", agent.Image, err)
+	}
+	fileSum, err := fileChecksum(file)
+	if err != nil {
+		return "", err
+	}
+	for _, layer := range manifest.Layers {
+		if layer.Annotations[ociTitleAnnotation] != path.Base(agent.File) {
+			continue
+		}
+		if layer.Digest != "sha256:"+fileSum {
+			return "", fmt.Errorf("digest of %s does not match its manifest", agent.File)
+		}
+		return file, nil
+	}
+	return "", fmt.Errorf("%s not found in the manifest of %s", path.Base(agent.File), agent.Image)
+}
+
+// UseBundle makes the cluster install its agents from the bundle instead of
+// the registry. Docker images are loaded right away and never pulled.
+func (cc *ClusterConfig) UseBundle(b *Bundle) error {
+	if !slices.Contains(b.Manifest.Modes, cc.Mode) {
+		return fmt.Errorf("bundle has no agents for %s mode", cc.Mode)
+	}
+
+	var missing []string
+	switch cc.Mode {
+	case VMMode_Docker:
+		for _, image := range cc.bundleImages() {
+			if !slices.Contains(b.Manifest.Images, image) {
+				missing = append(missing, image)
+			}
+		}
+	case VMMode_Systemd:
+		for _, obj := range cc.bundleAgents() {
+			if _, err := b.agent(obj.AgentImage); err != nil {
+				missing = append(missing, obj.AgentImage)
+			}
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("images missing in the bundle created for registry %s (preserve upstream repo: %v): %s",
+			b.Manifest.Registry, b.Manifest.PreserveUpstream, strings.Join(missing, ", "))
+	}
+
+	cc.bundle = b
+	if cc.Mode == VMMode_Docker {
+		cc.ImagePullPolicy = ImagePullPolicy_Never
+		if cc.DryRun {
+			return nil
+		}
+		logger.Print("Loading images from the bundle")
+		if _, err := ExecDockerCommand(true, false, cc.ContainerRuntime.cli(), "load", "-i", b.path(bundleImagesFile)); err != nil {
+			return fmt.Errorf("loading images: %v", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,208 @@
+package onboard
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	cm "github.com/accuknox/accuknox-cli-v2/pkg/common"
+)
+
+var (
+	testBundleKeyOnce sync.Once
+	testBundleKey     ed25519.PrivateKey
+)
+
+// bundleKey returns the key signing test bundles, trusted as a release key
+func bundleKey(t *testing.T) ed25519.PrivateKey {
+	t.Helper()
+	testBundleKeyOnce.Do(func() {
+		pub, priv, err := ed25519.GenerateKey(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		file := filepath.Join(t.TempDir(), "bundle.pub")
+		if err := os.WriteFile(file, []byte(base64.StdEncoding.EncodeToString(pub)), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := cm.AddReleasePublicKey(file); err != nil {
+			t.Fatal(err)
+		}
+		testBundleKey = priv
+	})
+	return testBundleKey
+}
+
+// writeTestBundle writes a bundle of the given files, with a manifest holding
+// the given checksums and signed with key, if any
+func writeTestBundle(t *testing.T, files map[string]string, sums map[string]string, key ed25519.PrivateKey) string {
+	t.Helper()
+	manifest, err := json.Marshal(BundleManifest{
+		Version:   "v0.10.0",
+		Modes:     []VMMode{VMMode_Systemd},
+		Agents:    []BundleAgent{{Name: "kubearmor", Image: "docker.io/kubearmor/kubearmor-systemd:v1.5.0_linux-amd64", File: "systemd/kubearmor_v1.5.0_linux-amd64.tar.gz"}},
+		Checksums: sums,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	add := func(name, content string) {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(content))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	add(bundleManifestFile, string(manifest))
+	if key != nil {
+		add(bundleManifestSigFile, string(cm.SignData(manifest, key)))
+	}
+	for name, content := range files {
+		add(name, content)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	file := filepath.Join(t.TempDir(), "bundle.tar")
+	if err := os.WriteFile(file, buf.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func sum(s string) string {
+	h := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(h[:])
+}
+
+func TestOpenBundle(t *testing.T) {
+	const agent = "systemd/kubearmor_v1.5.0_linux-amd64.tar.gz"
+	files := map[string]string{bundleReleaseFile: "{}", agent: "package"}
+	sums := map[string]string{bundleReleaseFile: sum("{}"), agent: sum("package")}
+
+	b, err := OpenBundle(writeTestBundle(t, files, sums, bundleKey(t)))
+	if err != nil {
+		t.Fatalf("OpenBundle() error = %v", err)
+	}
+	defer b.Close()
+
+	if b.Manifest.Version != "v0.10.0" {
+		t.Errorf("version = %s, want v0.10.0", b.Manifest.Version)
+	}
+	got, err := b.agent("docker.io/kubearmor/kubearmor-systemd:v1.5.0_linux-amd64")
+	if err != nil {
+		t.Fatalf("agent() error = %v", err)
+	}
+	if data, err := os.ReadFile(b.path(got.File)); err != nil || string(data) != "package" {
+		t.Errorf("agent file = %q, %v, want %q", data, err, "package")
+	}
+	if _, err := b.agent("docker.io/accuknox/sia-systemd:v0.10.0_linux-amd64"); err == nil {
+		t.Errorf("agent() of an image not in the bundle succeeded")
+	}
+
+	_, untrusted, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	invalid := []struct {
+		name    string
+		files   map[string]string
+		sums    map[string]string
+		key     ed25519.PrivateKey
+		wantErr string
+	}{
+		{"checksum", map[string]string{agent: "tampered"}, map[string]string{agent: sum("package")}, bundleKey(t), "checksum mismatch"},
+		{"missing", map[string]string{}, map[string]string{agent: sum("package")}, bundleKey(t), "missing"},
+		{"unlisted", map[string]string{agent: "package", "extra": ""}, map[string]string{agent: sum("package")}, bundleKey(t), "not in the manifest"},
+		{"escape", map[string]string{"../escape": ""}, map[string]string{}, bundleKey(t), "outside of the bundle"},
+		{"absolute", map[string]string{"/etc/escape": ""}, map[string]string{}, bundleKey(t), "outside of the bundle"},
+		{"unsigned", files, sums, nil, "not signed"},
+		{"untrusted key", files, sums, untrusted, "does not match"},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := OpenBundle(writeTestBundle(t, tt.files, tt.sums, tt.key))
+			if err == nil {
+				b.Close()
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("OpenBundle() error = %v, want it to mention %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBundleAgent(t *testing.T) {
+	const (
+		repo = "docker.io/kubearmor/kubearmor-systemd"
+		tag  = "v1.5.0_linux-amd64"
+		file = "kubearmor_v1.5.0_linux-amd64.tar.gz"
+	)
+	manifest := func(layerSum string) string {
+		return `{"layers":[{"digest":"sha256:` + layerSum + `","annotations":{"` + ociTitleAnnotation + `":"` + file + `"}}]}`
+	}
+
+	tests := []struct {
+		name     string
+		pkg      string
+		manifest string
+		digests  map[string]string
+		wantErr  string
+	}{
+		{name: "verified", pkg: "package", manifest: manifest(sum("package"))},
+		{name: "tampered package", pkg: "tampered", manifest: manifest(sum("package")), wantErr: "does not match its manifest"},
+		{name: "tampered manifest", pkg: "tampered", manifest: manifest(sum("tampered")), digests: map[string]string{"kubearmor-systemd:" + tag: "sha256:" + sum(manifest(sum("package")))}, wantErr: "pins sha256:"},
+		{name: "no manifest", pkg: "package", wantErr: "bundle has no manifest"},
+		{name: "not pinned", pkg: "package", manifest: manifest(sum("package")), digests: map[string]string{"vm-adapter-systemd:" + tag: "sha256:" + sum("package")}, wantErr: "pins no digest"},
+		{name: "no digests in release", pkg: "package", manifest: manifest(sum("package")), digests: map[string]string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			agent := BundleAgent{Image: repo + ":" + tag, File: "systemd/" + file}
+			if err := os.MkdirAll(filepath.Join(dir, "systemd"), 0o750); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(dir, "systemd", file), []byte(tt.pkg), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			digests := tt.digests
+			if tt.manifest != "" {
+				agent.Manifest = "systemd/kubearmor.manifest.json"
+				if err := os.WriteFile(filepath.Join(dir, "systemd", "kubearmor.manifest.json"), []byte(tt.manifest), 0o600); err != nil {
+					t.Fatal(err)
+				}
+				if digests == nil {
+					digests = map[string]string{"kubearmor-systemd:" + tag: "sha256:" + sum(tt.manifest)}
+				}
+			}
+
+			cc := &ClusterConfig{
+				AgentsVersion: "v0.10.0",
+				AgentDigests:  digests,
+				bundle:        &Bundle{Manifest: BundleManifest{Agents: []BundleAgent{agent}}, dir: dir},
+			}
+			got, err := cc.bundleAgent(repo, tag)
+			if tt.wantErr == "" && (err != nil || got != filepath.Join(dir, "systemd", file)) {
+				t.Errorf("bundleAgent() = %s, %v", got, err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("bundleAgent() error = %v, want it to mention %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,736 @@
+package onboard
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	cm "github.com/accuknox/accuknox-cli-v2/pkg/common"
+	"github.com/accuknox/accuknox-cli-v2/pkg/logger"
+	"github.com/nothinux/certify"
+	"github.com/olekukonko/tablewriter"
+)
+
+const (
+	CertState_OK       = "ok"
+	CertState_Expiring = "expiring"
+	CertState_Expired  = "expired"
+)
+
+// certExpiryWarning is how long before expiry a certificate is reported as
+// expiring
+const certExpiryWarning = 30 * 24 * time.Hour
+
+// CertStatus is the expiry of a TLS certificate of the node
+type CertStatus struct {
+	Name     string    `json:"name"`
+	Path     string    `json:"path"`
+	Subject  string    `json:"subject"`
+	Issuer   string    `json:"issuer"`
+	DNS      []string  `json:"dns,omitempty"`
+	IPs      []string  `json:"ips,omitempty"`
+	NotAfter time.Time `json:"not_after"`
+	DaysLeft int       `json:"days_left"`
+	State    string    `json:"state"`
+}
+
+// certFiles are the TLS files of a node, the RabbitMQ ones only exist on the
+// control plane
+type certFiles struct {
+	ca, cert, key, caKey string
+	// encodedCA is the base64 CA the agents connect to RabbitMQ with
+	encodedCA string
+}
+
+// nodeCertFiles returns the TLS files of a node with the given config path,
+// /opt for systemd
+func nodeCertFiles(configPath string) certFiles {
+	if configPath == "" {
+		configPath = "/opt"
+	}
+	rmqDir := configPath + cm.DefaultRabbitMQDir
+	return certFiles{
+		ca:        filepath.Join(rmqDir, cm.DefaultCAFileName),
+		cert:      filepath.Join(rmqDir, cm.DefaultCertificateName),
+		key:       filepath.Join(rmqDir, cm.DefaultKeyFileName),
+		caKey:     filepath.Join(rmqDir, cm.DefaultCAKeyFileName),
+		encodedCA: filepath.Join(configPath+cm.DefaultCACertDir, cm.DefaultEncodedFileName),
+	}
+}
+
+// loadTLSNode reads the stored config of the onboarded node, which must have
+// TLS enabled
+func loadTLSNode() (upgradeNode, string, error) {
+	configPath, err := storedConfigPath()
+	if err != nil {
+		return nil, "", err
+	}
+	data, err := os.ReadFile(filepath.Clean(configPath))
+	if err != nil {
+		return nil, "", err
+	}
+	node, err := loadUpgradeNode(data)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read %s: %v", configPath, err)
+	}
+	if !node.clusterConfig().Tls.Enabled {
+		return nil, "", fmt.Errorf("the node was not onboarded with TLS")
+	}
+	return node, configPath, nil
+}
+
+// CertsStatus returns the expiry of the CA and RabbitMQ certificates of the
+// onboarded node
+func CertsStatus() ([]CertStatus, error) {
+	node, _, err := loadTLSNode()
+	if err != nil {
+		return nil, err
+	}
+	return nodeCertsStatus(node, time.Now())
+}
+
+func nodeCertsStatus(node upgradeNode, now time.Time) ([]CertStatus, error) {
+	files := nodeCertFiles(node.templateArgs().ConfigPath)
+
+	if node.clusterConfig().WorkerNode {
+		return encodedCAStatus(files.encodedCA, now)
+	}
+
+	var statuses []CertStatus
+	for _, c := range []struct{ name, path string }{
+		{"ca", files.ca},
+		{"server", files.cert},
+	} {
+		data, err := os.ReadFile(filepath.Clean(c.path))
+		if os.IsNotExist(err) && c.name == "ca" {
+			// RabbitMQ is not deployed, only the CA of the agents is there
+			cas, err := encodedCAStatus(files.encodedCA, now)
+			if err != nil {
+				return nil, err
+			}
+			statuses = append(statuses, cas...)
+			continue
+		} else if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		cert, err := certify.ParseCertificate(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %v", c.path, err)
+		}
+		statuses = append(statuses, certStatus(c.name, c.path, cert, now))
+	}
+	return statuses, nil
+}
+
+// encodedCAStatus returns the status of every CA of the base64 encoded CA of
+// the agents, which is a bundle while the CA is rotated
+func encodedCAStatus(path string, now time.Time) ([]CertStatus, error) {
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, err
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %v", path, err)
+	}
+	cas, err := parseCABundle(decoded)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+
+	var statuses []CertStatus
+	for _, ca := range cas {
+		statuses = append(statuses, certStatus("ca", path, ca, now))
+	}
+	return statuses, nil
+}
+
+func certStatus(name, path string, cert *x509.Certificate, now time.Time) CertStatus {
+	status := CertStatus{
+		Name:     name,
+		Path:     path,
+		Subject:  cert.Subject.String(),
+		Issuer:   cert.Issuer.String(),
+		DNS:      cert.DNSNames,
+		NotAfter: cert.NotAfter,
+		DaysLeft: int(cert.NotAfter.Sub(now).Hours() / 24),
+		State:    CertState_OK,
+	}
+	for _, ip := range cert.IPAddresses {
+		status.IPs = append(status.IPs, ip.String())
+	}
+	switch {
+	case !now.Before(cert.NotAfter):
+		status.State = CertState_Expired
+	case cert.NotAfter.Sub(now) < certExpiryWarning:
+		status.State = CertState_Expiring
+	}
+	return status
+}
+
+// PrintCertsStatus prints the certificate statuses as a table or as JSON
+func PrintCertsStatus(w io.Writer, statuses []CertStatus, jsonOutput bool) error {
+	if jsonOutput {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(statuses)
+	}
+
+	table := tablewriter.NewWriter(w)
+	table.SetHeader([]string{"Name", "Subject", "SANs", "Expires", "Days Left", "State"})
+	table.SetAutoWrapText(false)
+	for _, s := range statuses {
+		table.Append([]string{
+			s.Name,
+			s.Subject,
+			strings.Join(append(append([]string{}, s.DNS...), s.IPs...), ","),
+			s.NotAfter.Format(time.RFC3339),
+			fmt.Sprint(s.DaysLeft),
+			s.State,
+		})
+	}
+	table.Render()
+	return nil
+}
+
+// RotateCertsOptions are the options of rotating the certificates of a
+// control plane
+type RotateCertsOptions struct {
+	// CA generates a new CA as well, the workers must import it
+	CA bool
+	// Finalize drops the previous CA from the bundle trusted while rotating
+	// the CA, once every worker imported the bundle
+	Finalize bool
+	// CAKeyPath is the key of the current CA, if it was not generated by
+	// knoxctl
+	CAKeyPath string
+	// IPs and DNS replace the extra SANs of the RabbitMQ certificate
+	IPs []string
+	DNS []string
+	// TrustCA is called with the base64 encoded bundle of the current and the
+	// new CA before RabbitMQ switches to the new CA, the worker nodes must
+	// have imported it once it returns
+	TrustCA func(caBundle string) error
+}
+
+// CertRotation is the outcome of rotating the certificates of a control plane
+type CertRotation struct {
+	// CACert is the base64 encoded CA the workers connect with, the bundle of
+	// the previous and the new CA when the CA changed
+	CACert    string
+	CAChanged bool
+	// Restarted are the agents restarted in order
+	Restarted []string
+}
+
+// RotateCerts issues a new RabbitMQ certificate, and a new CA if asked, for
+// the onboarded control plane, then restarts RabbitMQ and the agents
+// connecting to it. With a new CA the agents trust both CAs before RabbitMQ
+// switches to it. The replaced files are kept with a .bak suffix.
+func RotateCerts(opts RotateCertsOptions) (*CertRotation, error) {
+	node, configPath, err := loadTLSNode()
+	if err != nil {
+		return nil, err
+	}
+	ic, ok := node.(*InitConfig)
+	if !ok {
+		return nil, fmt.Errorf("certificates can only be rotated on the control plane, import the CA of the control plane on worker nodes")
+	}
+
+	var restarted []string
+	apply := func(server, clients bool) error {
+		if err := DumpConfig(ic, configPath); err != nil {
+			return err
+		}
+		agents, err := restartCertAgents(ic, server, clients)
+		restarted = append(restarted, agents...)
+		return err
+	}
+	var rotation *CertRotation
+	if opts.Finalize {
+		rotation, err = ic.finalizeCA(opts, apply)
+	} else {
+		rotation, err = ic.rotateCerts(opts, apply)
+	}
+	if rotation != nil {
+		rotation.Restarted = restarted
+	}
+	return rotation, err
+}
+
+// rotateCerts writes the new certificates of the control plane, calling apply
+// to restart the agents once the files of the server or of the clients
+// changed. A new CA is first trusted by the agents of the control plane and
+// the workers, along with the current one, then RabbitMQ switches to it.
+func (ic *InitConfig) rotateCerts(opts RotateCertsOptions, apply func(server, clients bool) error) (*CertRotation, error) {
+	files := nodeCertFiles(ic.TCArgs.ConfigPath)
+
+	if len(opts.IPs) > 0 {
+		ic.Tls.IPs = opts.IPs
+	}
+	if len(opts.DNS) > 0 {
+		ic.Tls.DNS = opts.DNS
+	}
+
+	var (
+		caCert *certify.Result
+		caKey  *certify.PrivateKey
+		err    error
+	)
+	if opts.CA {
+		caCert, caKey, err = ic.GenerateCA()
+	} else {
+		caCert, caKey, err = loadCA(files.ca, files.caKey, opts.CAKeyPath)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	cert, key, err := ic.GenerateCertAndKey(caCert, caKey)
+	if err != nil {
+		return nil, err
+	}
+
+	rotation := &CertRotation{CAChanged: opts.CA}
+	newFiles := map[string]string{
+		files.cert: cert.String(),
+		files.key:  key.String(),
+	}
+	if opts.CA {
+		if err := ic.trustCA(files, caCert, apply); err != nil {
+			return nil, err
+		}
+		rotation.CACert = ic.CaCert
+		if opts.TrustCA != nil {
+			if err := opts.TrustCA(ic.CaCert); err != nil {
+				return rotation, fmt.Errorf("RabbitMQ keeps the current CA as the worker nodes did not import the new one: %v", err)
+			}
+		}
+		newFiles[files.ca] = caCert.String()
+		newFiles[files.caKey] = caKey.String()
+	}
+	if err := replaceCertFiles(newFiles); err != nil {
+		return rotation, err
+	}
+	rotation.CACert = ic.CaCert
+	return rotation, apply(true, false)
+}
+
+// trustCA makes the agents of the control plane trust the bundle of the
+// current CA and the new one
+func (ic *InitConfig) trustCA(files certFiles, caCert *certify.Result, apply func(server, clients bool) error) error {
+	current, err := os.ReadFile(filepath.Clean(files.ca))
+	if err != nil {
+		return fmt.Errorf("failed to read the CA: %v", err)
+	}
+	bundle := strings.TrimSpace(string(current)) + "\n" + caCert.String()
+
+	ic.CaCert = Encode([]byte(bundle))
+	if err := replaceCertFiles(map[string]string{files.encodedCA: ic.CaCert}); err != nil {
+		return err
+	}
+	return apply(false, true)
+}
+
+// finalizeCA makes the agents of the control plane, then the workers, trust
+// only the CA of RabbitMQ, dropping the previous CA of the bundle trusted
+// while rotating it
+func (ic *InitConfig) finalizeCA(opts RotateCertsOptions, apply func(server, clients bool) error) (*CertRotation, error) {
+	if opts.CA {
+		return nil, fmt.Errorf("a new CA can not be generated while finalizing the rotation of the CA")
+	}
+	files := nodeCertFiles(ic.TCArgs.ConfigPath)
+
+	caBytes, err := os.ReadFile(filepath.Clean(files.ca))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the CA: %v", err)
+	}
+	if _, err := parseCABundle(caBytes); err != nil {
+		return nil, err
+	}
+
+	rotation := &CertRotation{CACert: Encode(caBytes), CAChanged: true}
+	if rotation.CACert != ic.CaCert {
+		ic.CaCert = rotation.CACert
+		if err := replaceCertFiles(map[string]string{files.encodedCA: ic.CaCert}); err != nil {
+			return nil, err
+		}
+		if err := apply(false, true); err != nil {
+			return rotation, err
+		}
+	}
+	if opts.TrustCA != nil {
+		if err := opts.TrustCA(ic.CaCert); err != nil {
+			return rotation, fmt.Errorf("the worker nodes did not import the CA: %v", err)
+		}
+	}
+	return rotation, nil
+}
+
+// loadCA reads the CA and its key, stored next to it unless keyPath is given
+func loadCA(caPath, storedKeyPath, keyPath string) (*certify.Result, *certify.PrivateKey, error) {
+	caBytes, err := os.ReadFile(filepath.Clean(caPath))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read the CA: %v", err)
+	}
+	if keyPath == "" {
+		keyPath = storedKeyPath
+	}
+	keyBytes, err := os.ReadFile(filepath.Clean(keyPath))
+	if os.IsNotExist(err) {
+		return nil, nil, fmt.Errorf("the key of the CA is not found at %s, pass it with --ca-key or generate a new CA with --ca", keyPath)
+	} else if err != nil {
+		return nil, nil, fmt.Errorf("failed to read the key of the CA: %v", err)
+	}
+
+	cert, err := certify.ParseCertificate(caBytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse %s: %v", caPath, err)
+	}
+	key, err := certify.ParsePrivateKey(keyBytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse %s: %v", keyPath, err)
+	}
+	if !key.PublicKey.Equal(cert.PublicKey) {
+		return nil, nil, fmt.Errorf("%s is not the key of the CA %s", keyPath, caPath)
+	}
+	if time.Now().After(cert.NotAfter) {
+		return nil, nil, fmt.Errorf("the CA expired on %s, generate a new one with --ca", cert.NotAfter.Format(time.RFC3339))
+	}
+
+	return &certify.Result{ByteCert: cert.Raw, Cert: cert}, &certify.PrivateKey{PrivateKey: key}, nil
+}
+
+// rabbitmqUID is the user of the RabbitMQ container reading the mounted key
+const rabbitmqUID = 999
+
+// replaceCertFiles writes the certificate files in place, as RabbitMQ mounts
+// them one by one, keeping the current ones with a .bak suffix. The keys are
+// only readable by their owner, RabbitMQ for its own.
+func replaceCertFiles(files map[string]string) error {
+	for path, content := range files {
+		old, err := os.ReadFile(filepath.Clean(path))
+		if err == nil {
+			if err := os.WriteFile(path+".bak", old, 0o600); err != nil {
+				return err
+			}
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil { // #nosec G301
+			return err
+		}
+		if err := writeCertFile(path, content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeCertFile truncates and writes a certificate file, setting its mode
+// before its content as an existing file keeps its own
+func writeCertFile(path, content string) error {
+	perm := os.FileMode(0o644) // #nosec G302 read by the RabbitMQ container
+	owner := -1
+	switch filepath.Base(path) {
+	case cm.DefaultKeyFileName:
+		perm = 0o600
+		if os.Geteuid() == 0 {
+			owner = rabbitmqUID
+		}
+	case cm.DefaultCAKeyFileName:
+		perm = 0o600
+	}
+
+	f, err := os.OpenFile(filepath.Clean(path), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := f.Chmod(perm); err != nil {
+		return err
+	}
+	if owner >= 0 {
+		if err := f.Chown(owner, owner); err != nil {
+			return err
+		}
+	}
+	if _, err := f.WriteString(content); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// ImportCertsOptions are the options of importing certificates. Control
+// planes import a CA, RabbitMQ certificate and key, workers the CA of their
+// control plane.
+type ImportCertsOptions struct {
+	CAPath   string
+	CertPath string
+	KeyPath  string
+	// CACert is the base64 encoded CA, as printed by rotate
+	CACert string
+}
+
+// ImportCerts replaces the certificates of the onboarded node with the given
+// ones and restarts the agents using them
+func ImportCerts(opts ImportCertsOptions) ([]string, error) {
+	node, configPath, err := loadTLSNode()
+	if err != nil {
+		return nil, err
+	}
+
+	caBytes, err := importedCA(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var server bool
+	switch n := node.(type) {
+	case *InitConfig:
+		server, err = n.importCerts(opts, caBytes)
+	case *JoinConfig:
+		if opts.CertPath != "" || opts.KeyPath != "" {
+			return nil, fmt.Errorf("worker nodes only import the CA of the control plane")
+		}
+		err = n.importCA(caBytes)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := DumpConfig(node, configPath); err != nil {
+		return nil, err
+	}
+	return restartCertAgents(node, server, caBytes != nil)
+}
+
+// importedCA returns the PEM of the CA to import, nil if none is given
+func importedCA(opts ImportCertsOptions) ([]byte, error) {
+	var caBytes []byte
+	switch {
+	case opts.CACert != "" && opts.CAPath != "":
+		return nil, fmt.Errorf("only one of the CA file and the encoded CA can be given")
+	case opts.CACert != "":
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(opts.CACert))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode the CA: %v", err)
+		}
+		caBytes = decoded
+	case opts.CAPath != "":
+		data, err := os.ReadFile(filepath.Clean(opts.CAPath))
+		if err != nil {
+			return nil, err
+		}
+		caBytes = data
+	default:
+		return nil, nil
+	}
+
+	if _, err := parseCABundle(caBytes); err != nil {
+		return nil, err
+	}
+	return caBytes, nil
+}
+
+// parseCABundle parses the CAs of a PEM bundle, which holds the previous and
+// the new CA while rotating it
+func parseCABundle(data []byte) ([]*x509.Certificate, error) {
+	var cas []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse the CA: %v", err)
+		}
+		if !cert.IsCA {
+			return nil, fmt.Errorf("the certificate of %s is not a CA", cert.Subject)
+		}
+		cas = append(cas, cert)
+	}
+	if len(cas) == 0 {
+		return nil, fmt.Errorf("failed to parse the CA: no certificate found")
+	}
+	return cas, nil
+}
+
+// importCerts writes the given CA, certificate and key of RabbitMQ, it
+// returns whether RabbitMQ must be restarted
+func (ic *InitConfig) importCerts(opts ImportCertsOptions, caBytes []byte) (bool, error) {
+	files := nodeCertFiles(ic.TCArgs.ConfigPath)
+
+	if (opts.CertPath == "") != (opts.KeyPath == "") {
+		return false, fmt.Errorf("the certificate and the key must be imported together")
+	}
+	if opts.CertPath == "" && caBytes == nil {
+		return false, fmt.Errorf("nothing to import, give a CA, or a certificate and its key")
+	}
+
+	newFiles := make(map[string]string)
+	if opts.CertPath != "" {
+		certBytes, err := os.ReadFile(filepath.Clean(opts.CertPath))
+		if err != nil {
+			return false, err
+		}
+		keyBytes, err := os.ReadFile(filepath.Clean(opts.KeyPath))
+		if err != nil {
+			return false, err
+		}
+
+		ca := caBytes
+		if ca == nil {
+			if ca, err = os.ReadFile(filepath.Clean(files.ca)); err != nil {
+				return false, fmt.Errorf("failed to read the CA: %v", err)
+			}
+		}
+		if err := verifyCert(ca, certBytes, keyBytes); err != nil {
+			return false, err
+		}
+		newFiles[files.cert] = string(certBytes)
+		newFiles[files.key] = string(keyBytes)
+	}
+
+	if caBytes != nil {
+		ic.CaCert = Encode(caBytes)
+		newFiles[files.ca] = string(caBytes)
+		newFiles[files.encodedCA] = ic.CaCert
+		// the stored key does not belong to the imported CA
+		if err := os.Remove(files.caKey); err != nil && !os.IsNotExist(err) {
+			return false, err
+		}
+	}
+	return len(newFiles) > 0, replaceCertFiles(newFiles)
+}
+
+// verifyCert checks that the certificate is signed by the CA and matches the
+// key
+func verifyCert(caBytes, certBytes, keyBytes []byte) error {
+	cas, err := parseCABundle(caBytes)
+	if err != nil {
+		return err
+	}
+	cert, err := certify.ParseCertificate(certBytes)
+	if err != nil {
+		return fmt.Errorf("failed to parse the certificate: %v", err)
+	}
+	key, err := certify.ParsePrivateKey(keyBytes)
+	if err != nil {
+		return fmt.Errorf("failed to parse the key: %v", err)
+	}
+
+	if !key.PublicKey.Equal(cert.PublicKey) {
+		return fmt.Errorf("the key does not match the certificate")
+	}
+	for _, ca := range cas {
+		if err = cert.CheckSignatureFrom(ca); err == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("the certificate is not signed by the CA: %v", err)
+}
+
+// importCA writes the CA of the control plane on a worker
+func (jc *JoinConfig) importCA(caBytes []byte) error {
+	if caBytes == nil {
+		return fmt.Errorf("the CA of the control plane is required")
+	}
+	jc.Tls.CaCert = Encode(caBytes)
+	files := nodeCertFiles(jc.TCArgs.ConfigPath)
+	return replaceCertFiles(map[string]string{files.encodedCA: jc.Tls.CaCert})
+}
+
+// certClients are the agents connecting to RabbitMQ with the CA, in the order
+// they are restarted
+var certClients = []string{
+	cm.SIAAgent,
+	cm.PEAAgent,
+	cm.FeederService,
+	cm.SummaryEngine,
+	cm.DiscoverAgent,
+	cm.HardeningAgent,
+	cm.VMAdapter,
+}
+
+// certRestartOrder returns the agents of the node to restart after its
+// certificates changed, RabbitMQ first if its certificate changed
+func certRestartOrder(cc *ClusterConfig, server, clients bool) []string {
+	var agents []string
+	if server && cc.Mode == VMMode_Docker && cc.DeployRMQ && !cc.WorkerNode {
+		agents = append(agents, cm.Rabbitmq)
+	}
+	if !clients {
+		return agents
+	}
+	for _, name := range certClients {
+		for _, agent := range upgradeAgents {
+			if agent.name == name && cc.deploysAgent(agent) {
+				agents = append(agents, agent.key(cc.Mode))
+			}
+		}
+	}
+	return agents
+}
+
+// restartCertAgents restarts the agents using the certificates one by one
+func restartCertAgents(node upgradeNode, server, clients bool) ([]string, error) {
+	cc := node.clusterConfig()
+	agents := certRestartOrder(cc, server, clients)
+	if len(agents) == 0 {
+		return nil, nil
+	}
+
+	if cc.Mode == VMMode_Docker {
+		if _, err := cc.ValidateEnv(); err != nil {
+			return nil, err
+		}
+	}
+
+	var restarted []string
+	for _, agent := range agents {
+		logger.Print("Restarting %s...", agent)
+		if err := restartAgent(node, agent); err != nil {
+			return restarted, fmt.Errorf("failed to restart %s: %v", agent, err)
+		}
+		restarted = append(restarted, agent)
+	}
+	return restarted, nil
+}
+
+func restartAgent(node upgradeNode, agent string) error {
+	cc := node.clusterConfig()
+
+	if cc.Mode == VMMode_Docker {
+		args := []string{"-f", filepath.Join(node.templateArgs().ConfigPath, composeFileName)}
+		for _, profile := range node.composeProfiles() {
+			args = append(args, "--profile", profile)
+		}
+		args = append(args, "restart", agent)
+		_, err := ExecComposeCommand(true, false, cc.composeCmd, args...)
+		return err
+	}
+
+	obj, ok := cc.systemdService(agent)
+	if !ok {
+		return nil
+	}
+	return StartSystemdService(obj.ServiceName)
+}
@@ -0,0 +1,379 @@
+package onboard
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	cm "github.com/accuknox/accuknox-cli-v2/pkg/common"
+	"github.com/nothinux/certify"
+)
+
+// testTLSControlPlane returns a control plane with certificates generated in
+// a temporary config path, as when onboarding it
+func testTLSControlPlane(t *testing.T) (*InitConfig, certFiles) {
+	t.Helper()
+	orig := hostIPs
+	t.Cleanup(func() { hostIPs = orig })
+	hostIPs = func() []net.IP { return []net.IP{net.ParseIP("10.0.0.1")} }
+
+	ic := &InitConfig{}
+	ic.Tls = TLS{Enabled: true, Generate: true, CommonName: "rabbitmq", DNS: []string{"cp.internal"}}
+	ic.TCArgs.ConfigPath = t.TempDir()
+	files := nodeCertFiles(ic.TCArgs.ConfigPath)
+
+	storeData, caBytes, err := ic.GenerateOrUpdateCert(nil)
+	if err != nil {
+		t.Fatalf("GenerateOrUpdateCert() error = %v", err)
+	}
+	ic.CaCert = Encode(caBytes)
+	storeData[files.encodedCA] = ic.CaCert
+	if err := StoreCert(storeData); err != nil {
+		t.Fatal(err)
+	}
+	return ic, files
+}
+
+func readCert(t *testing.T, path string) *certify.Result {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := certify.ParseCertificate(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &certify.Result{ByteCert: cert.Raw, Cert: cert}
+}
+
+// restarts records the agents restarted while rotating the certificates
+type restarts [][2]bool
+
+func (r *restarts) apply(server, clients bool) error {
+	*r = append(*r, [2]bool{server, clients})
+	return nil
+}
+
+func TestRotateCerts(t *testing.T) {
+	ic, files := testTLSControlPlane(t)
+	oldCA := readCert(t, files.ca)
+	oldCert := readCert(t, files.cert)
+
+	var applied restarts
+	rotation, err := ic.rotateCerts(RotateCertsOptions{DNS: []string{"rmq.internal"}}, applied.apply)
+	if err != nil {
+		t.Fatalf("rotateCerts() error = %v", err)
+	}
+	if rotation.CAChanged {
+		t.Errorf("CA changed without --ca")
+	}
+	if want := (restarts{{true, false}}); !reflect.DeepEqual(applied, want) {
+		t.Errorf("restarts = %v, want %v", applied, want)
+	}
+	if _, err := os.Stat(files.cert + ".bak"); err != nil {
+		t.Errorf("the replaced certificate is not backed up: %v", err)
+	}
+	for _, path := range []string{files.key, files.caKey} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if perm := info.Mode().Perm(); perm != 0o600 {
+			t.Errorf("%s mode = %o, want 600", filepath.Base(path), perm)
+		}
+	}
+
+	ca := readCert(t, files.ca)
+	cert := readCert(t, files.cert)
+	if !ca.Cert.Equal(oldCA.Cert) {
+		t.Errorf("CA replaced without --ca")
+	}
+	if cert.Cert.Equal(oldCert.Cert) {
+		t.Errorf("certificate not rotated")
+	}
+	if err := cert.Cert.CheckSignatureFrom(ca.Cert); err != nil {
+		t.Errorf("certificate not signed by the CA: %v", err)
+	}
+	if want := []string{"localhost", "rabbitmq", "rmq.internal"}; !reflect.DeepEqual(cert.Cert.DNSNames, want) {
+		t.Errorf("certificate DNS names = %v, want %v", cert.Cert.DNSNames, want)
+	}
+
+	var trusted string
+	applied = nil
+	rotation, err = ic.rotateCerts(RotateCertsOptions{
+		CA: true,
+		TrustCA: func(caBundle string) error {
+			// RabbitMQ still uses the current CA while the workers import it
+			if !readCert(t, files.ca).Cert.Equal(ca.Cert) || !readCert(t, files.cert).Cert.Equal(cert.Cert) {
+				t.Errorf("RabbitMQ switched to the new CA before the workers trusted it")
+			}
+			trusted = caBundle
+			return nil
+		},
+	}, applied.apply)
+	if err != nil {
+		t.Fatalf("rotateCerts() with a new CA error = %v", err)
+	}
+	newCA := readCert(t, files.ca)
+	if !rotation.CAChanged || newCA.Cert.Equal(ca.Cert) {
+		t.Fatalf("CA not rotated with --ca")
+	}
+	if want := (restarts{{false, true}, {true, false}}); !reflect.DeepEqual(applied, want) {
+		t.Errorf("restarts = %v, want %v", applied, want)
+	}
+	if err := readCert(t, files.cert).Cert.CheckSignatureFrom(newCA.Cert); err != nil {
+		t.Errorf("certificate not signed by the new CA: %v", err)
+	}
+
+	encoded, err := os.ReadFile(files.encodedCA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(encoded) != ic.CaCert || rotation.CACert != ic.CaCert || trusted != ic.CaCert {
+		t.Errorf("encoded CA of the agents not updated")
+	}
+	bundle, err := importedCA(ImportCertsOptions{CACert: trusted})
+	if err != nil {
+		t.Fatalf("importedCA() of the bundle error = %v", err)
+	}
+	cas, err := parseCABundle(bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cas) != 2 || !cas[0].Equal(ca.Cert) || !cas[1].Equal(newCA.Cert) {
+		t.Errorf("CA bundle = %d CAs, want the current and the new CA", len(cas))
+	}
+}
+
+func TestRotateCertsUntrustedCA(t *testing.T) {
+	ic, files := testTLSControlPlane(t)
+	oldCA := readCert(t, files.ca)
+	oldCert := readCert(t, files.cert)
+
+	var applied restarts
+	_, err := ic.rotateCerts(RotateCertsOptions{
+		CA:      true,
+		TrustCA: func(string) error { return fmt.Errorf("1 of 2 hosts failed") },
+	}, applied.apply)
+	if err == nil {
+		t.Fatalf("rotateCerts() succeeded while the workers did not import the CA")
+	}
+	if !readCert(t, files.ca).Cert.Equal(oldCA.Cert) || !readCert(t, files.cert).Cert.Equal(oldCert.Cert) {
+		t.Errorf("RabbitMQ switched to the new CA the workers did not import")
+	}
+	if want := (restarts{{false, true}}); !reflect.DeepEqual(applied, want) {
+		t.Errorf("restarts = %v, want %v", applied, want)
+	}
+}
+
+func TestFinalizeCA(t *testing.T) {
+	ic, files := testTLSControlPlane(t)
+	oldCA := readCert(t, files.ca)
+
+	var applied restarts
+	if _, err := ic.rotateCerts(RotateCertsOptions{CA: true}, applied.apply); err != nil {
+		t.Fatalf("rotateCerts() error = %v", err)
+	}
+	newCA := readCert(t, files.ca)
+
+	jc := &JoinConfig{}
+	jc.WorkerNode = true
+	jc.Tls = TLS{Enabled: true}
+	jc.TCArgs.ConfigPath = t.TempDir()
+	importCA := func(caCert string) error {
+		caBytes, err := importedCA(ImportCertsOptions{CACert: caCert})
+		if err != nil {
+			return err
+		}
+		return jc.importCA(caBytes)
+	}
+	if err := importCA(ic.CaCert); err != nil {
+		t.Fatalf("importing the CA bundle error = %v", err)
+	}
+
+	statuses, err := nodeCertsStatus(jc, time.Now())
+	if err != nil {
+		t.Fatalf("nodeCertsStatus() error = %v", err)
+	}
+	if len(statuses) != 2 || statuses[0].NotAfter != oldCA.Cert.NotAfter || statuses[1].Subject != newCA.Cert.Subject.String() {
+		t.Errorf("worker statuses = %+v, want the previous and the new CA", statuses)
+	}
+
+	applied = nil
+	rotation, err := ic.finalizeCA(RotateCertsOptions{TrustCA: importCA}, applied.apply)
+	if err != nil {
+		t.Fatalf("finalizeCA() error = %v", err)
+	}
+	if want := Encode([]byte(newCA.String())); rotation.CACert != want || ic.CaCert != want || string(mustRead(t, files.encodedCA)) != want {
+		t.Errorf("encoded CA of the agents is not the new CA only")
+	}
+	if want := (restarts{{false, true}}); !reflect.DeepEqual(applied, want) {
+		t.Errorf("restarts = %v, want %v", applied, want)
+	}
+
+	statuses, err = nodeCertsStatus(jc, time.Now())
+	if err != nil {
+		t.Fatalf("nodeCertsStatus() error = %v", err)
+	}
+	if len(statuses) != 1 || statuses[0].Subject != newCA.Cert.Subject.String() || statuses[0].NotAfter != newCA.Cert.NotAfter {
+		t.Errorf("worker statuses = %+v, want the new CA only", statuses)
+	}
+
+	if _, err := ic.finalizeCA(RotateCertsOptions{CA: true}, applied.apply); err == nil {
+		t.Errorf("finalizeCA() with a new CA succeeded")
+	}
+}
+
+func TestRotateCertsWithoutCAKey(t *testing.T) {
+	ic, files := testTLSControlPlane(t)
+	if err := os.Remove(files.caKey); err != nil {
+		t.Fatal(err)
+	}
+	var applied restarts
+	if _, err := ic.rotateCerts(RotateCertsOptions{}, applied.apply); err == nil {
+		t.Errorf("rotateCerts() without the key of the CA succeeded")
+	}
+}
+
+func TestImportCA(t *testing.T) {
+	ic, files := testTLSControlPlane(t)
+	ca, err := os.ReadFile(files.ca)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jc := &JoinConfig{}
+	jc.WorkerNode = true
+	jc.Tls = TLS{Enabled: true}
+	jc.TCArgs.ConfigPath = t.TempDir()
+
+	caBytes, err := importedCA(ImportCertsOptions{CACert: ic.CaCert})
+	if err != nil {
+		t.Fatalf("importedCA() error = %v", err)
+	}
+	if err := jc.importCA(caBytes); err != nil {
+		t.Fatalf("importCA() error = %v", err)
+	}
+	if jc.Tls.CaCert != Encode(ca) {
+		t.Errorf("stored CA of the worker not updated")
+	}
+
+	statuses, err := nodeCertsStatus(jc, time.Now())
+	if err != nil {
+		t.Fatalf("nodeCertsStatus() error = %v", err)
+	}
+	if len(statuses) != 1 || statuses[0].Name != "ca" || statuses[0].State != CertState_OK {
+		t.Errorf("worker statuses = %+v, want the imported CA", statuses)
+	}
+
+	if _, err := importedCA(ImportCertsOptions{CAPath: files.cert}); err == nil {
+		t.Errorf("importedCA() accepted a certificate which is not a CA")
+	}
+}
+
+func TestImportCerts(t *testing.T) {
+	ic, files := testTLSControlPlane(t)
+	_, otherFiles := testTLSControlPlane(t)
+
+	// a certificate of another CA is refused
+	_, err := ic.importCerts(ImportCertsOptions{CertPath: otherFiles.cert, KeyPath: otherFiles.key}, nil)
+	if err == nil {
+		t.Errorf("importCerts() accepted a certificate of another CA")
+	}
+
+	server, err := ic.importCerts(ImportCertsOptions{
+		CAPath:   otherFiles.ca,
+		CertPath: otherFiles.cert,
+		KeyPath:  otherFiles.key,
+	}, mustRead(t, otherFiles.ca))
+	if err != nil {
+		t.Fatalf("importCerts() error = %v", err)
+	}
+	if !server {
+		t.Errorf("RabbitMQ not restarted after importing its certificate")
+	}
+	if !readCert(t, files.ca).Cert.Equal(readCert(t, otherFiles.ca).Cert) {
+		t.Errorf("CA not imported")
+	}
+	if _, err := os.Stat(files.caKey); !os.IsNotExist(err) {
+		t.Errorf("key of the replaced CA kept")
+	}
+}
+
+func mustRead(t *testing.T, path string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestCertStatus(t *testing.T) {
+	_, files := testTLSControlPlane(t)
+	cert := readCert(t, files.cert).Cert
+	notAfter := cert.NotAfter
+
+	tests := []struct {
+		name string
+		now  time.Time
+		want string
+	}{
+		{name: "ok", now: notAfter.Add(-90 * 24 * time.Hour), want: CertState_OK},
+		{name: "expiring", now: notAfter.Add(-10 * 24 * time.Hour), want: CertState_Expiring},
+		{name: "expired", now: notAfter.Add(time.Hour), want: CertState_Expired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status := certStatus("server", files.cert, cert, tt.now)
+			if status.State != tt.want {
+				t.Errorf("certStatus() state = %s, want %s", status.State, tt.want)
+			}
+			if !slices.Contains(status.DNS, "cp.internal") || !slices.Contains(status.IPs, "10.0.0.1") {
+				t.Errorf("certStatus() SANs = %v %v, want the generated ones", status.DNS, status.IPs)
+			}
+		})
+	}
+}
+
+func TestCertRestartOrder(t *testing.T) {
+	tests := []struct {
+		name            string
+		cc              ClusterConfig
+		server, clients bool
+		want            []string
+	}{
+		{
+			name:   "server only",
+			cc:     ClusterConfig{Mode: VMMode_Docker, DeployRMQ: true},
+			server: true,
+			want:   []string{cm.Rabbitmq},
+		},
+		{
+			name:    "control plane",
+			cc:      ClusterConfig{Mode: VMMode_Docker, DeployRMQ: true},
+			server:  true,
+			clients: true,
+			want:    []string{cm.Rabbitmq, "shared-informer-agent", "policy-enforcement-agent", "feeder-service", "summary-engine", "discover", "kubearmor-vm-adapter"},
+		},
+		{
+			name:    "worker",
+			cc:      ClusterConfig{Mode: VMMode_Systemd, WorkerNode: true},
+			clients: true,
+			want:    []string{cm.VMAdapter},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := certRestartOrder(&tt.cc, tt.server, tt.clients); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("certRestartOrder() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -14,6 +14,23 @@ import (
 	"golang.org/x/mod/semver"
 )
 
+const composeFileName = "docker-compose.yaml"
+
+// composeServices maps the agent names of the docker config files to the
+// compose services using them
+var composeServices = map[string]string{
+	"spire":                "spire-agent",
+	"sia":                  "shared-informer-agent",
+	"pea":                  "policy-enforcement-agent",
+	"feeder-service":       "feeder-service",
+	"sumengine":            "summary-engine",
+	"discover":             "discover",
+	"hardening-agent":      "hardening-agent",
+	"rabbitmq":             "rabbitmq",
+	"vm-adapter":           "kubearmor-vm-adapter",
+	"kubearmor-vm-adapter": "kubearmor-vm-adapter",
+}
+
 type agentConfigMeta struct {
 	agentName                string
 	configDir                string
@@ -133,14 +150,8 @@ func (ic *InitConfig) CreateBaseTemplateConfig() error {
 	return nil
 }
 
-func (ic *InitConfig) InitializeControlPlane() error {
-	// validate this environment
-	dockerStatus, err := ic.ValidateEnv()
-	if err != nil {
-		return err
-	}
-	logger.Info1("%s", dockerStatus)
-
+// InitializeControlPlane onboards a control plane node in docker mode
+func (ic *InitConfig) InitializeControlPlane(opts StepOptions) error {
 	configPath, err := createDefaultConfigPath()
 	if err != nil {
 		return err
@@ -176,50 +187,91 @@ func (ic *InitConfig) InitializeControlPlane() error {
 
 	ic.TCArgs.AccessKey = ic.AccessKey
 
-	kmuxConfigArgs := KmuxConfigTemplateArgs{
-		ReleaseVersion: ic.AgentsVersion,
-		StreamName:     "knox-gateway",
-		ServerURL:      ic.KnoxGateway,
-		RMQServer:      "rabbitmq:5672",
-	}
-
 	if ic.RMQServer != "" {
 		ic.TCArgs.RMQAddr = ic.RMQServer
-		kmuxConfigArgs.RMQServer = ic.RMQServer
 	} else if ic.RMQServer == "" && !ic.DeployRMQ {
 		return fmt.Errorf("RabbitMQ address must be specified if deployment is skipped")
 	}
 	if ic.Tls.Enabled {
 		ic.TCArgs.TlsEnabled = ic.Tls.Enabled
 		ic.TCArgs.TlsCertFile = fmt.Sprintf("%s%s%s/%s", ic.UserConfigPath, configPath, common.DefaultCACertDir, common.DefaultEncodedFileName)
-		if err := ic.handleTLS(); err != nil {
-			return err
-		}
 	}
-	kmuxConfigArgs.RMQUsername = ic.TCArgs.RMQUsername
-	kmuxConfigArgs.RMQPassword = ic.TCArgs.RMQPassword
-	kmuxConfigArgs.TlsEnabled = ic.TCArgs.TlsEnabled
 
 	ic.TCArgs.NodeStateRefreshTime = ic.NodeStateRefreshTime
 
 	ic.populateCommonArgs()
 
-	if ic.TCArgs.SplunkConfigObject.Enabled {
-		if err := validateSplunkCredential(ic.TCArgs.SplunkConfigObject); err != nil {
+	ic.TCArgs.EnableHardeningAgent = ic.EnableHardeningAgent
+
+	steps := []onboardStep{
+		{name: Step_ValidateEnv, run: func() error {
+			dockerStatus, err := ic.ValidateEnv()
+			if err != nil {
+				return err
+			}
+			logger.Info1("%s", dockerStatus)
+
+			if ic.TCArgs.SplunkConfigObject.Enabled {
+				return validateSplunkCredential(ic.TCArgs.SplunkConfigObject)
+			}
+			return nil
+		}},
+		// the configs are generated with the CA
+		{name: Step_TLS, run: ic.handleTLS},
+		{name: Step_GenerateConfig, run: func() error {
+			// write compose file and config files
+			files, err := ic.dockerAgentFiles(configPath)
+			if err != nil {
+				return err
+			}
+			for _, file := range files {
+				if err := file.write(); err != nil {
+					return err
+				}
+			}
+			return nil
+		}},
+	}
+	steps = append(steps, composeSteps(ic, NodeType_ControlPlane, []string{"spire-vol", "kubearmor-init-vol"})...)
+	if ic.Tls.Enabled {
+		if err := ic.prepareTLS(ic.runsStep(NodeType_ControlPlane, opts, steps, Step_GenerateConfig)); err != nil {
 			return err
 		}
 	}
+	return ic.runOnboardSteps(NodeType_ControlPlane, opts, steps)
+}
 
-	ic.TCArgs.EnableHardeningAgent = ic.EnableHardeningAgent
+// dockerKmuxConfigArgs returns the kmux config template args of the control
+// plane agents in docker mode
+func (ic *InitConfig) dockerKmuxConfigArgs() KmuxConfigTemplateArgs {
+	kmuxConfigArgs := KmuxConfigTemplateArgs{
+		ReleaseVersion: ic.AgentsVersion,
+		StreamName:     "knox-gateway",
+		ServerURL:      ic.KnoxGateway,
+		RMQServer:      "rabbitmq:5672",
+		RMQUsername:    ic.TCArgs.RMQUsername,
+		RMQPassword:    ic.TCArgs.RMQPassword,
+		TlsEnabled:     ic.TCArgs.TlsEnabled,
+	}
+	if ic.RMQServer != "" {
+		kmuxConfigArgs.RMQServer = ic.RMQServer
+	}
+	return kmuxConfigArgs
+}
 
+// dockerAgentFiles generates the compose file and the config and kmux config
+// files of the control plane agents in docker mode
+func (ic *InitConfig) dockerAgentFiles(configPath string) ([]agentFile, error) {
 	// initialize sprig for templating
 	sprigFuncs := sprig.GenericFuncMap()
 
-	// write compose file
-	composeFilePath, err := copyOrGenerateFile(ic.UserConfigPath, configPath, "docker-compose.yaml", sprigFuncs, cpComposeFileTemplate, ic.TCArgs)
+	data, err := generateFile(ic.UserConfigPath, composeFileName, sprigFuncs, cpComposeFileTemplate, ic.TCArgs)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	files := []agentFile{{dir: configPath, name: composeFileName, data: data}}
+
+	kmuxConfigArgs := ic.dockerKmuxConfigArgs()
 
 	// List of config files to be generated or copied
 	// TODO: Refactor later
@@ -235,26 +287,30 @@ func (ic *InitConfig) InitializeControlPlane() error {
 		tcArgs := ic.TCArgs
 		tcArgs.KmuxConfigPath = agentObj.kmuxConfigPath
 		agentConfigPath := filepath.Join(configPath, agentObj.configDir)
+		service := composeServices[agentObj.agentName]
 
 		// generate config file if not empty
 		if agentObj.configFilePath != "" {
 			populateAgentArgs(&tcArgs, agentObj.configDir)
-			if _, err := copyOrGenerateFile(ic.UserConfigPath, agentConfigPath, agentObj.configFilePath, sprigFuncs, agentObj.configTemplateString, tcArgs); err != nil {
-				return err
+			data, err := generateFile(ic.UserConfigPath, agentObj.configFilePath, sprigFuncs, agentObj.configTemplateString, tcArgs)
+			if err != nil {
+				return nil, err
 			}
+			files = append(files, agentFile{agent: service, dir: agentConfigPath, name: agentObj.configFilePath, data: data})
 		}
 		// generate kmux config only if it exists for this agent
 		if agentObj.kmuxConfigPath != "" {
 			populateKmuxArgs(&kmuxConfigArgs, agentObj.agentName, agentObj.kmuxConfigFileName, ic.TCArgs.RMQTopicPrefix, tcArgs.Hostname, ic.RMQConnectionName)
 			kmuxConfigArgs.UseCaFile = useCaFile(&tcArgs, agentObj.agentName, "")
-			if _, err := copyOrGenerateFile(ic.UserConfigPath, agentConfigPath, agentObj.kmuxConfigFileName, sprigFuncs, agentObj.kmuxConfigTemplateString, kmuxConfigArgs); err != nil {
-				return err
+			data, err := generateFile(ic.UserConfigPath, agentObj.kmuxConfigFileName, sprigFuncs, agentObj.kmuxConfigTemplateString, kmuxConfigArgs)
+			if err != nil {
+				return nil, err
 			}
+			files = append(files, agentFile{agent: service, dir: agentConfigPath, name: agentObj.kmuxConfigFileName, data: data})
 		}
 	}
 
-	// Diagnose if necessary and run compose command
-	return ic.runComposeCommand(composeFilePath)
+	return files, nil
 }
 
 func (ic *InitConfig) populateCommonArgs() {
@@ -339,52 +395,60 @@ func populateKmuxArgs(kmuxConfigArgs *KmuxConfigTemplateArgs, agentName, kmuxFil
 	kmuxConfigArgs.ConnectionName = connName
 }
 
-// runComposeCommand runs the Docker Compose command with the necessary arguments
-func (ic *InitConfig) runComposeCommand(composeFilePath string) error {
-	diagnosis := true
+// prepareTLS generates the RabbitMQ credentials used by the agents, unless
+// a previous run which did not complete generated them. When the configs are
+// not generated, the ones on disk are kept and so are the credentials stored
+// with them. The CA of that run, or the stored one, is loaded in case the TLS
+// step is skipped.
+func (ic *InitConfig) prepareTLS(generateConfig bool) error {
+	state := ic.savedOnboardState(NodeType_ControlPlane)
+	var stored *InitConfig
+	if !generateConfig {
+		stored = ic.storedControlPlane()
+	}
 
-	args := []string{
-		"-f", composeFilePath, "--profile", "spire-agent",
-		"--profile", "kubearmor", "--profile", "accuknox-agents",
+	if ic.RMQCredentials == "" {
+		ic.RMQCredentials = state.RMQCredentials
 	}
-	if ic.Parallel > 0 {
-		args = append(args, "--parallel", fmt.Sprintf("%v", ic.Parallel))
+	if ic.RMQCredentials == "" && stored != nil {
+		ic.RMQCredentials = stored.RMQCredentials
 	}
-
-	args = append(args, "up", "-d")
-
-	if semver.Compare(ic.composeVersion, common.MinDockerComposeWithWaitSupported) >= 0 {
-		args = append(args, "--wait", "--wait-timeout", "60")
+	if ic.RMQCredentials == "" {
+		ic.TCArgs.RMQUsername, ic.TCArgs.RMQPassword = GenerateUserAndPassword()
+		ic.RMQCredentials = Encode([]byte(ic.TCArgs.RMQUsername + ":" + ic.TCArgs.RMQPassword))
 	} else {
-		diagnosis = false
+		username, password, ok := strings.Cut(Decode(ic.RMQCredentials), ":")
+		if !ok {
+			return fmt.Errorf("invalid RabbitMQ credentials, expected base64 encoded user:password")
+		}
+		ic.TCArgs.RMQUsername, ic.TCArgs.RMQPassword = username, password
 	}
+	ic.TCArgs.RMQPasswordHash = GetHash(ic.TCArgs.RMQPassword)
+	ic.TCArgs.RMQTlsPort = "5672"
 
-	// run compose command
-	_, err := ExecComposeCommand(true, ic.DryRun, ic.composeCmd, args...)
-	if err != nil {
-		// cleanup volumes
-		_, volDelErr := ExecDockerCommand(true, false, "docker", "volume", "rm", "spire-vol", "kubearmor-init-vol")
-		if volDelErr != nil {
-			fmt.Println("Error while removing volumes:", volDelErr.Error())
-		}
-		return ic.handleComposeError(err, diagnosis)
+	switch {
+	case state.CACert != "":
+		ic.CaCert = state.CACert
+		return nil
+	case stored != nil && stored.CaCert != "":
+		ic.CaCert = stored.CaCert
+		return nil
 	}
-	return nil
+	return ic.loadStoredCA(ic.TCArgs.TlsCertFile)
 }
 
+// handleTLS generates the CA and the RabbitMQ certificate, unless a CA is
+// given or certificates were already generated
 func (ic *InitConfig) handleTLS() error {
+	if !ic.Tls.Enabled {
+		return nil
+	}
 
 	paths := oldCertPaths(ic.TCArgs.ConfigPath)
 
-	if ic.Tls.Enabled && ic.Tls.CaPath == "" && len(paths) == 0 {
+	if ic.Tls.CaPath == "" && len(paths) == 0 {
 		ic.Tls.Generate = true
 	}
-	if ic.RMQCredentials == "" {
-		ic.TCArgs.RMQUsername, ic.TCArgs.RMQPassword = GenerateUserAndPassword()
-		ic.TCArgs.RMQPasswordHash = GetHash(ic.TCArgs.RMQPassword)
-		ic.RMQCredentials = Encode([]byte(ic.TCArgs.RMQUsername + ":" + ic.TCArgs.RMQPassword))
-	}
-	ic.TCArgs.RMQTlsPort = "5672"
 
 	storeData, caBytes, err := ic.GenerateOrUpdateCert(paths)
 	if err != nil {
@@ -401,18 +465,6 @@ func (ic *InitConfig) handleTLS() error {
 	return nil
 }
 
-// handleComposeError handles errors from the Docker Compose command
-func (ic *InitConfig) handleComposeError(err error, diagnosis bool) error {
-	if diagnosis {
-		diagnosisResult, diagErr := diagnose(NodeType_ControlPlane)
-		if diagErr != nil {
-			diagnosisResult = diagErr.Error()
-		}
-		return fmt.Errorf("Error: %s.\n\nDIAGNOSIS:\n%s", err.Error(), diagnosisResult)
-	}
-	return err
-}
-
 func combineVisibilities(visibility, hostVisibility string) string {
 	visibilities := make(map[string]struct{})
 	for _, vis := range strings.Split(visibility+","+hostVisibility, ",") {
@@ -3,7 +3,6 @@ package onboard
 import (
 	"fmt"
 	"os/exec"
-	"path/filepath"
 	"strconv"
 	"strings"
 
@@ -12,7 +11,8 @@ import (
 	"github.com/accuknox/accuknox-cli-v2/pkg/logger"
 )
 
-func (ic *InitConfig) InitializeControlPlaneSD() error {
+// InitializeControlPlaneSD onboards a control plane node in systemd mode
+func (ic *InitConfig) InitializeControlPlaneSD(opts StepOptions) error {
 
 	ic.TCArgs.SpireSecretDir = ic.SpireSecretDir
 	ic.TCArgs.KubeArmorURL = "0.0.0.0:32767"
@@ -35,37 +35,95 @@ func (ic *InitConfig) InitializeControlPlaneSD() error {
 	if ic.Tls.Enabled {
 		ic.TCArgs.TlsEnabled = ic.Tls.Enabled
 		ic.TCArgs.TlsCertFile = fmt.Sprintf("%s%s%s/%s", ic.UserConfigPath, "/opt", cm.DefaultCACertDir, cm.DefaultEncodedFileName)
-		if err := ic.handleTLS(); err != nil {
-			return err
-		}
 	}
 
 	ic.TCArgs.AccessKey = ic.AccessKey
 
 	ic.populateCommonArgs()
 
-	if ic.TCArgs.SplunkConfigObject.Enabled {
-		if err := validateSplunkCredential(ic.TCArgs.SplunkConfigObject); err != nil {
-			return err
-		}
-	}
-
 	// initialize sprig for templating
 	ic.TemplateFuncs = sprig.GenericFuncMap()
 
-	// download and extract systemd packages
-	logger.Info2(("Downloading agents..."))
-	err := ic.SystemdInstall()
-	if err != nil {
-		logger.Error("Installation failed!! Cleaning up downloaded assets...")
-		// ignoring G104 - can't send nil in installation failed case
-		Deletedir(cm.DownloadDir)
-		DeboardSystemd(NodeType_ControlPlane) // #nosec G104
-		return err
+	var services []string
+	for _, obj := range ic.SystemdServiceObjects {
+		if obj.ServiceName == "" || (obj.AgentName == cm.HardeningAgent && !ic.EnableHardeningAgent) {
+			continue
+		}
+		services = append(services, obj.ServiceName)
 	}
 
-	// copy config files according to custom configuration specified by the user
+	steps := []onboardStep{
+		{name: Step_ValidateEnv, run: func() error {
+			if err := validateSystemd(); err != nil {
+				return err
+			}
+			if ic.TCArgs.SplunkConfigObject.Enabled {
+				return validateSplunkCredential(ic.TCArgs.SplunkConfigObject)
+			}
+			return nil
+		}},
+		{name: Step_PullImages, run: func() error {
+			// download and extract systemd packages
+			logger.Info2(("Downloading agents..."))
+			if err := ic.SystemdInstall(); err != nil {
+				// the onboarding progress is kept for resuming from this step
+				logger.Warn("Installation failed!! Cleaning up downloaded assets...")
+				Deletedir(cm.DownloadDir)
+				return err
+			}
+			return nil
+		}},
+		// the configs are generated with the CA
+		{name: Step_TLS, run: ic.handleTLS},
+		{name: Step_GenerateConfig, run: func() error {
+			// copy config files according to custom configuration specified by the user
+			kmuxConfigArgs := ic.systemdKmuxConfigArgs()
+
+			logger.Info2("\nConfiguring services...")
+			files, err := ic.systemdAgentFiles(ic.TCArgs, kmuxConfigArgs)
+			if err != nil {
+				return err
+			}
+			for _, file := range files {
+				if err := file.write(); err != nil {
+					return err
+				}
+			}
+			return ic.copyExtraFiles()
+		}},
+		{name: Step_Install, run: func() error {
+			// FINALLY START THE SYSTEMD SERVICES //
+			logger.Info2("\nEnabling services...")
+			for _, service := range services {
+				if err := StartSystemdService(service); err != nil {
+					logger.Warn("failed to start service %s: %s\n", service, err.Error())
+					return err
+				}
+			}
+
+			// Clean Up
+			logger.Info1("\nCleaning up downloaded assets...")
+			Deletedir(cm.DownloadDir)
+			return nil
+		}},
+		{name: Step_WaitHealthy, run: func() error {
+			if ic.DryRun {
+				return nil
+			}
+			return waitSystemdServices(services, healthTimeout, healthInterval)
+		}},
+	}
+	if ic.Tls.Enabled {
+		if err := ic.prepareTLS(ic.runsStep(NodeType_ControlPlane, opts, steps, Step_GenerateConfig)); err != nil {
+			return err
+		}
+	}
+	return ic.runOnboardSteps(NodeType_ControlPlane, opts, steps)
+}
 
+// systemdKmuxConfigArgs returns the kmux config template args of the control
+// plane agents, the RabbitMQ address is set in the template args as well
+func (ic *InitConfig) systemdKmuxConfigArgs() KmuxConfigTemplateArgs {
 	kmuxConfigArgs := KmuxConfigTemplateArgs{
 		ReleaseVersion: ic.AgentsVersion,
 		StreamName:     "knox-gateway",
@@ -88,81 +146,7 @@ func (ic *InitConfig) InitializeControlPlaneSD() error {
 		kmuxConfigArgs.RMQServer = "0.0.0.0:5672"
 	}
 
-	logger.Info2("\nConfiguring services...")
-	for _, obj := range ic.SystemdServiceObjects {
-
-		if obj.AgentName == cm.HardeningAgent && !ic.EnableHardeningAgent {
-			continue
-		}
-
-		if obj.ConfigFilePath != "" {
-			// copy template args
-			tcArgs := ic.TCArgs
-
-			// copy kmux config path for specifying in agent config
-			if obj.KmuxConfigPath != "" {
-				tcArgs.KmuxConfigPath = obj.KmuxConfigPath
-			}
-
-			_, err = copyOrGenerateFile(ic.UserConfigPath, obj.AgentDir, obj.ConfigFilePath, ic.TemplateFuncs, obj.ConfigTemplateString, tcArgs)
-			if err != nil {
-				logger.Error("err config generate: %v\n", err)
-				return err
-			}
-		}
-		// copy kmux config
-		if obj.KmuxConfigPath != "" {
-			populateKmuxArgs(&kmuxConfigArgs, obj.AgentName, obj.KmuxConfigFileName, ic.TCArgs.RMQTopicPrefix, ic.TCArgs.Hostname, ic.RMQConnectionName)
-			kmuxConfigArgs.UseCaFile = useCaFile(&ic.TCArgs, obj.AgentName, obj.AgentImage)
-			_, err = copyOrGenerateFile(ic.UserConfigPath, obj.AgentDir, obj.KmuxConfigFileName, ic.TemplateFuncs, obj.KmuxConfigTemplateString, kmuxConfigArgs)
-			if err != nil {
-				logger.Error("err kmux generate: %v\n", err)
-				return err
-			}
-		}
-
-		// copy additional files
-		for filename, srcPath := range obj.ExtraFilePathSrc {
-			if srcPath == "" {
-				continue
-			}
-
-			destPath, ok := obj.ExtraFilePathDest[filename]
-			if !ok {
-				logger.Warn("Warning! No destination for extra file %s", filename)
-				continue
-			}
-
-			srcPathDir := filepath.Dir(srcPath)
-			destPathDir := filepath.Dir(destPath)
-
-			_, err = copyOrGenerateFile(srcPathDir, destPathDir, filename, nil, "", nil)
-			if err != nil {
-				return err
-			}
-		}
-
-	}
-
-	// FINALLY START THE SYSTEMD SERVICES //
-	logger.Info2("\nEnabling services...")
-	for _, obj := range ic.SystemdServiceObjects {
-
-		if obj.AgentName == cm.HardeningAgent && !ic.EnableHardeningAgent {
-			continue
-		}
-		err = StartSystemdService(obj.ServiceName)
-		if err != nil {
-			logger.Warn("failed to start service %s: %s\n", obj.ServiceName, err.Error())
-			return err
-		}
-
-	}
-
-	// Clean Up
-	logger.Info1("\nCleaning up downloaded assets...")
-	Deletedir(cm.DownloadDir)
-	return nil
+	return kmuxConfigArgs
 }
 
 func useSystemdAppend() bool {
@@ -7,7 +7,6 @@ import (
 
 	dockerTypes "github.com/docker/docker/api/types"
 	dockerContainerTypes "github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/client"
 )
 
 const (
@@ -91,7 +90,7 @@ func containerFailed(containerJSON dockerTypes.ContainerJSON, containerName stri
 }
 
 // getContainerDiagnosis returns a diagnosis, name of the failed container or an error
-func getContainerDiagnosis(client *client.Client, knownContainerMap map[string]dockerTypes.Container, priorityList []string) (string, error) {
+func getContainerDiagnosis(client ContainerClient, runtime ContainerRuntime, knownContainerMap map[string]dockerTypes.Container, priorityList []string) (string, error) {
 	var diagnosis, failedContainer string
 
 	for _, container := range priorityList {
@@ -113,7 +112,7 @@ func getContainerDiagnosis(client *client.Client, knownContainerMap map[string]d
 				diagnosis = fmt.Sprintf("%s it failed to compile KubeArmor BPF code", diagnosis)
 			}
 
-			diagnosis = fmt.Sprintf("%s. Please checkout logs for %s container.\nCOMMAND:\ndocker logs %s", diagnosis, failedContainer, failedContainer)
+			diagnosis = fmt.Sprintf("%s. Please checkout logs for %s container.\nCOMMAND:\n%s logs %s", diagnosis, failedContainer, runtime.cli(), failedContainer)
 
 			return diagnosis, nil
 		} else {
@@ -124,14 +123,14 @@ func getContainerDiagnosis(client *client.Client, knownContainerMap map[string]d
 	return diagnosis, nil
 }
 
-func diagnose(nodeType NodeType) (string, error) {
+func diagnose(runtime ContainerRuntime, nodeType NodeType) (string, error) {
 	var (
 		diagnosis string
 	)
 
-	dockerClient, err := CreateDockerClient()
+	dockerClient, err := CreateContainerClient(runtime)
 	if err != nil {
-		return diagnosis, fmt.Errorf("Failed to create docker client. %s", err.Error())
+		return diagnosis, fmt.Errorf("Failed to create %s client. %s", runtime.cli(), err.Error())
 	}
 	defer dockerClient.Close()
 
@@ -160,7 +159,7 @@ func diagnose(nodeType NodeType) (string, error) {
 		priorityList = workerNodePriorityList
 	}
 
-	diagnosis, err = getContainerDiagnosis(dockerClient, knownContainerMap, priorityList)
+	diagnosis, err = getContainerDiagnosis(dockerClient, runtime, knownContainerMap, priorityList)
 	if err != nil {
 		return diagnosis, fmt.Errorf("Failed to get container diagnosis. %s", err.Error())
 	}
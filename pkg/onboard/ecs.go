@@ -0,0 +1,525 @@
+package onboard
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	cm "github.com/accuknox/accuknox-cli-v2/pkg/common"
+	"github.com/accuknox/accuknox-cli-v2/pkg/logger"
+	"golang.org/x/mod/semver"
+)
+
+const (
+	// DefaultECSFamily is the default family of the task definition
+	DefaultECSFamily = "accuknox-agents"
+	// DefaultECSHostConfigPath is where the agent config files are expected
+	// on the container instances
+	DefaultECSHostConfigPath = "/opt/accuknox"
+
+	ecsTaskDefinitionFile = "task-definition.json"
+	ecsServiceFile        = "service.json"
+	ecsConfigDir          = "config"
+)
+
+// ecsAgents are the compose services whose config files are needed on ECS
+var ecsAgents = []string{composeServices["spire"], composeServices["feeder-service"]}
+
+// ECSOptions are the options of generating the ECS resources
+type ECSOptions struct {
+	Cluster string
+	// Family is the family of the task definition, DefaultECSFamily by
+	// default
+	Family string
+	// Service is the name of the daemon service, the family by default
+	Service string
+	// Output is the directory the resources are written to
+	Output string
+	// HostConfigPath is where the agent config files are on the container
+	// instances, DefaultECSHostConfigPath by default
+	HostConfigPath string
+	// LogGroup sends the logs of the agents to CloudWatch if set
+	LogGroup string
+	Region   string
+}
+
+// ECSTaskDefinition is the subset of an ECS task definition used by the agents
+type ECSTaskDefinition struct {
+	Family                  string         `json:"family"`
+	NetworkMode             string         `json:"networkMode"`
+	PidMode                 string         `json:"pidMode"`
+	RequiresCompatibilities []string       `json:"requiresCompatibilities"`
+	ContainerDefinitions    []ECSContainer `json:"containerDefinitions"`
+	Volumes                 []ECSVolume    `json:"volumes"`
+}
+
+// ECSContainer is a container definition of an ECS task definition
+type ECSContainer struct {
+	Name              string               `json:"name"`
+	Image             string               `json:"image"`
+	Essential         bool                 `json:"essential"`
+	Command           []string             `json:"command,omitempty"`
+	Environment       []ECSKeyValue        `json:"environment,omitempty"`
+	MountPoints       []ECSMountPoint      `json:"mountPoints,omitempty"`
+	DependsOn         []ECSDependency      `json:"dependsOn,omitempty"`
+	Privileged        bool                 `json:"privileged,omitempty"`
+	User              string               `json:"user,omitempty"`
+	MemoryReservation int                  `json:"memoryReservation"`
+	LogConfiguration  *ECSLogConfiguration `json:"logConfiguration,omitempty"`
+}
+
+type ECSKeyValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type ECSMountPoint struct {
+	SourceVolume  string `json:"sourceVolume"`
+	ContainerPath string `json:"containerPath"`
+	ReadOnly      bool   `json:"readOnly,omitempty"`
+}
+
+type ECSDependency struct {
+	ContainerName string `json:"containerName"`
+	Condition     string `json:"condition"`
+}
+
+type ECSLogConfiguration struct {
+	LogDriver string            `json:"logDriver"`
+	Options   map[string]string `json:"options"`
+}
+
+// ECSVolume is either a host path or a docker volume
+type ECSVolume struct {
+	Name                      string                 `json:"name"`
+	Host                      *ECSHostVolume         `json:"host,omitempty"`
+	DockerVolumeConfiguration *ECSDockerVolumeConfig `json:"dockerVolumeConfiguration,omitempty"`
+}
+
+type ECSHostVolume struct {
+	SourcePath string `json:"sourcePath"`
+}
+
+type ECSDockerVolumeConfig struct {
+	Scope         string `json:"scope"`
+	Autoprovision bool   `json:"autoprovision,omitempty"`
+	Driver        string `json:"driver"`
+}
+
+// ECSService is the daemon service running the agents on every container
+// instance of the cluster
+type ECSService struct {
+	Cluster            string `json:"cluster"`
+	ServiceName        string `json:"serviceName"`
+	TaskDefinition     string `json:"taskDefinition"`
+	SchedulingStrategy string `json:"schedulingStrategy"`
+	LaunchType         string `json:"launchType"`
+}
+
+// ECSResources are the generated ECS resources and agent config files
+type ECSResources struct {
+	TaskDefinition ECSTaskDefinition
+	Service        ECSService
+	files          []agentFile
+}
+
+// Files returns the paths of the generated files
+func (r *ECSResources) Files() []string {
+	var paths []string
+	for _, f := range r.files {
+		paths = append(paths, f.path())
+	}
+	return paths
+}
+
+// Write writes the resources and the agent config files to disk
+func (r *ECSResources) Write() error {
+	for _, f := range r.files {
+		if err := f.write(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GenerateECS generates the task definition and daemon service running
+// KubeArmor, the vm-adapter, the feeder service and, if enabled, the SPIRE
+// agent on the container instances of an ECS cluster, with the config files
+// the agents expect at HostConfigPath on the instances
+func (ic *InitConfig) GenerateECS(o ECSOptions) (*ECSResources, error) {
+	if o.Cluster == "" {
+		return nil, fmt.Errorf("ECS cluster is required")
+	}
+	if ic.Tls.Enabled {
+		return nil, fmt.Errorf("TLS is not supported for ECS clusters yet")
+	}
+	if o.LogGroup != "" && o.Region == "" {
+		return nil, fmt.Errorf("region is required to send logs to CloudWatch")
+	}
+	if o.Family == "" {
+		o.Family = DefaultECSFamily
+	}
+	if o.Service == "" {
+		o.Service = o.Family
+	}
+	if o.HostConfigPath == "" {
+		o.HostConfigPath = DefaultECSHostConfigPath
+	}
+
+	// every instance registers itself with the access key
+	ic.AccessKey.NodeName = ""
+	if err := ic.CreateBaseTemplateConfig(); err != nil {
+		return nil, err
+	}
+	ic.populateECSArgs(o)
+
+	files, err := ic.dockerAgentFiles(filepath.Join(o.Output, ecsConfigDir))
+	if err != nil {
+		return nil, err
+	}
+	res := &ECSResources{
+		TaskDefinition: ic.ecsTaskDefinition(o),
+		Service: ECSService{
+			Cluster:            o.Cluster,
+			ServiceName:        o.Service,
+			TaskDefinition:     o.Family,
+			SchedulingStrategy: "DAEMON",
+			LaunchType:         "EC2",
+		},
+	}
+	for _, f := range files {
+		if f.agent == composeServices["spire"] && !ic.SpireEnabled {
+			continue
+		}
+		for _, agent := range ecsAgents {
+			if f.agent == agent {
+				res.files = append(res.files, f)
+			}
+		}
+	}
+
+	for _, r := range []struct {
+		name string
+		v    any
+	}{{ecsTaskDefinitionFile, res.TaskDefinition}, {ecsServiceFile, res.Service}} {
+		data, err := json.MarshalIndent(r.v, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		res.files = append(res.files, agentFile{dir: o.Output, name: r.name, data: append(data, '\n')})
+	}
+	return res, nil
+}
+
+// populateECSArgs sets the template args of the agents running in a task
+// with the host network
+func (ic *InitConfig) populateECSArgs(o ECSOptions) {
+	ic.TCArgs.ImagePullPolicy = string(ic.ImagePullPolicy)
+	ic.TCArgs.ConfigPath = o.HostConfigPath
+	ic.TCArgs.AccessKey = ic.AccessKey
+
+	ic.TCArgs.KubeArmorURL = "localhost:32767"
+	ic.TCArgs.KubeArmorPort = "32767"
+	ic.TCArgs.RelayServerURL = "localhost:32768"
+	ic.TCArgs.RelayServerAddr = "localhost"
+	ic.TCArgs.RelayServerPort = "32768"
+
+	// the other agents run on the control plane, if any
+	ic.TCArgs.SIAAddr, ic.TCArgs.PEAAddr, ic.TCArgs.HardenAddr = "", "", ""
+	if ic.CPNodeAddr != "" {
+		ic.TCArgs.SIAAddr = ic.CPNodeAddr + ":32769"
+		ic.TCArgs.PEAAddr = ic.CPNodeAddr + ":32770"
+		ic.TCArgs.HardenAddr = ic.CPNodeAddr + ":32771"
+	}
+
+	ic.populateCommonArgs()
+}
+
+// ecsTaskDefinition returns the task definition of the agents, the ECS
+// counterpart of the docker compose files
+func (ic *InitConfig) ecsTaskDefinition(o ECSOptions) ECSTaskDefinition {
+	tc := ic.TCArgs
+	td := ECSTaskDefinition{
+		Family:                  o.Family,
+		NetworkMode:             "host",
+		PidMode:                 "host",
+		RequiresCompatibilities: []string{"EC2"},
+		Volumes: []ECSVolume{
+			{Name: "kubearmor-init-vol", DockerVolumeConfiguration: &ECSDockerVolumeConfig{Scope: "task", Driver: "local"}},
+			hostVolume("agents-config", o.HostConfigPath),
+			hostVolume("lib-modules", "/lib/modules"),
+			hostVolume("bpf", "/sys/fs/bpf"),
+			hostVolume("kernel-security", "/sys/kernel/security"),
+			hostVolume("kernel-debug", "/sys/kernel/debug"),
+			hostVolume("os-release", "/etc/os-release"),
+			hostVolume("apparmor", "/etc/apparmor.d"),
+			hostVolume("docker-sock", "/var/run/docker.sock"),
+			hostVolume("run-docker", "/run/docker"),
+			hostVolume("var-lib-docker", "/var/lib/docker"),
+			hostVolume("var-run", "/var/run"),
+		},
+	}
+
+	// the SPIRE agent runs only when enabled, the vm-adapter and the feeder
+	// service wait for it then
+	var spireDeps []ECSDependency
+	if tc.SpireEnabled {
+		td.Volumes = append(td.Volumes,
+			ECSVolume{Name: "spire-vol", DockerVolumeConfiguration: &ECSDockerVolumeConfig{Scope: "shared", Autoprovision: true, Driver: "local"}},
+			hostVolume("spire-config", filepath.Join(o.HostConfigPath, "spire")))
+		spireDeps = []ECSDependency{{ContainerName: "spire-agent", Condition: "START"}}
+	}
+
+	spireAgent := ECSContainer{
+		Name:       "spire-agent",
+		Image:      tc.SPIREAgentImage,
+		Essential:  true,
+		Command:    []string{"-config", "/etc/spire/conf/agent.conf", "-expandEnv"},
+		Privileged: true,
+		MountPoints: []ECSMountPoint{
+			{SourceVolume: "spire-config", ContainerPath: "/etc/spire"},
+			{SourceVolume: "spire-vol", ContainerPath: tc.SpireSecretDir},
+			{SourceVolume: "var-run", ContainerPath: "/var/run"},
+		},
+		MemoryReservation: 64,
+	}
+
+	kubearmorInit := ECSContainer{
+		Name:       "kubearmor-init",
+		Image:      tc.KubeArmorInitImage,
+		User:       "root",
+		Privileged: true,
+		MountPoints: []ECSMountPoint{
+			{SourceVolume: "kubearmor-init-vol", ContainerPath: "/opt/kubearmor/BPF"},
+			{SourceVolume: "lib-modules", ContainerPath: "/lib/modules", ReadOnly: true},
+			{SourceVolume: "bpf", ContainerPath: "/sys/fs/bpf", ReadOnly: true},
+			{SourceVolume: "kernel-security", ContainerPath: "/sys/kernel/security", ReadOnly: true},
+			{SourceVolume: "kernel-debug", ContainerPath: "/sys/kernel/debug", ReadOnly: true},
+			{SourceVolume: "os-release", ContainerPath: "/media/root/etc/os-release", ReadOnly: true},
+		},
+		MemoryReservation: 128,
+	}
+
+	kubearmor := ECSContainer{
+		Name:      "kubearmor",
+		Image:     tc.KubeArmorImage,
+		Essential: true,
+		Command: []string{
+			"-k8s=false",
+			"-enableKubeArmorPolicy",
+			"-enableKubeArmorHostPolicy",
+			"-visibility=" + tc.KubeArmorVisibility,
+			"-hostVisibility=" + tc.KubeArmorHostVisibility,
+			"-criSocket=unix:///var/run/docker.sock",
+			"-enableKubeArmorStateAgent",
+			"-defaultFilePosture=" + tc.KubeArmorFilePosture,
+			"-defaultNetworkPosture=" + tc.KubeArmorNetworkPosture,
+			"-defaultCapabilitiesPosture=" + tc.KubeArmorCapPosture,
+			"-hostDefaultFilePosture=" + tc.KubeArmorHostFilePosture,
+			"-hostDefaultNetworkPosture=" + tc.KubeArmorHostNetworkPosture,
+			"-hostDefaultCapabilitiesPosture=" + tc.KubeArmorHostCapPosture,
+			"-alertThrottling=" + strconv.FormatBool(tc.KubeArmorAlertThrottling),
+			"-maxAlertPerSec=" + strconv.Itoa(tc.KubeArmorMaxAlertsPerSec),
+			"-throttleSec=" + strconv.Itoa(tc.KubeArmorThrottleSec),
+		},
+		Privileged: true,
+		MountPoints: []ECSMountPoint{
+			{SourceVolume: "kubearmor-init-vol", ContainerPath: "/opt/kubearmor/BPF"},
+			{SourceVolume: "bpf", ContainerPath: "/sys/fs/bpf"},
+			{SourceVolume: "kernel-security", ContainerPath: "/sys/kernel/security"},
+			{SourceVolume: "kernel-debug", ContainerPath: "/sys/kernel/debug"},
+			{SourceVolume: "apparmor", ContainerPath: "/etc/apparmor.d"},
+			{SourceVolume: "docker-sock", ContainerPath: "/var/run/docker.sock"},
+			{SourceVolume: "run-docker", ContainerPath: "/run/docker"},
+			{SourceVolume: "var-lib-docker", ContainerPath: "/var/lib/docker"},
+		},
+		DependsOn:         []ECSDependency{{ContainerName: "kubearmor-init", Condition: "SUCCESS"}},
+		MemoryReservation: 256,
+	}
+
+	relayServer := ECSContainer{
+		Name:              "kubearmor-relay-server",
+		Image:             tc.KubeArmorRelayServerImage,
+		Essential:         true,
+		Command:           []string{"-enableReverseLogClient", "-gRPCPort=" + tc.RelayServerPort},
+		MountPoints:       []ECSMountPoint{{SourceVolume: "agents-config", ContainerPath: cm.InContainerConfigDir}},
+		DependsOn:         []ECSDependency{{ContainerName: "kubearmor", Condition: "START"}},
+		MemoryReservation: 64,
+	}
+
+	vmAdapterCmd := []string{
+		"--kubearmor-addr=" + tc.KubeArmorURL,
+		"--relay-server-addr=" + tc.RelayServerURL,
+	}
+	if semver.Compare(tc.ReleaseVersion, "v0.9.1") > 0 {
+		vmAdapterCmd = append(vmAdapterCmd, "--node-state-refresh="+strconv.Itoa(tc.NodeStateRefreshTime))
+	}
+	if tc.SpireEnabled {
+		vmAdapterCmd = append(vmAdapterCmd, "--spire", "--spire-agent=unix:///var/run/spire/agent.sock", "--spire-cert="+strconv.FormatBool(tc.SpireCert))
+	}
+	if tc.SIAAddr != "" {
+		vmAdapterCmd = append(vmAdapterCmd, "--sia-addr="+tc.SIAAddr, "--pea-addr="+tc.PEAAddr, "--harden-addr="+tc.HardenAddr)
+	}
+	vmAdapter := ECSContainer{
+		Name:      "kubearmor-vm-adapter",
+		Image:     tc.KubeArmorVMAdapterImage,
+		Essential: true,
+		Command:   vmAdapterCmd,
+		MountPoints: []ECSMountPoint{
+			{SourceVolume: "agents-config", ContainerPath: cm.InContainerConfigDir},
+			{SourceVolume: "var-run", ContainerPath: "/var/run", ReadOnly: true},
+		},
+		DependsOn: append([]ECSDependency{
+			{ContainerName: "kubearmor", Condition: "START"},
+			{ContainerName: "kubearmor-relay-server", Condition: "START"},
+		}, spireDeps...),
+		MemoryReservation: 64,
+	}
+
+	feeder := ECSContainer{
+		Name:      "feeder-service",
+		Image:     tc.FeederImage,
+		Essential: true,
+		Environment: []ECSKeyValue{
+			{Name: "ENABLE_VM", Value: "true"},
+			{Name: "CLUSTER_NAME", Value: "default"},
+			{Name: "HUBBLE_ENABLED", Value: "false"},
+			{Name: "KAFKA_ENABLED", Value: "false"},
+			{Name: "KUBEARMOR_ENABLED", Value: "true"},
+			{Name: "KUBEARMOR_URL", Value: tc.RelayServerAddr},
+			{Name: "KUBEARMOR_PORT", Value: tc.RelayServerPort},
+			{Name: "KMUX_LOGS_ENABLED", Value: strconv.FormatBool(tc.EnableLogs)},
+			{Name: "KMUX_CONFIG_PATH", Value: filepath.Join(cm.InContainerConfigDir, "feeder-service", cm.KmuxConfigFileName)},
+			{Name: "SPIRE_AGENT_URL", Value: "unix:///var/run/spire/agent.sock"},
+			{Name: "SPIRE_ENABLED", Value: strconv.FormatBool(tc.SpireEnabled)},
+			{Name: "DEPLOY_MODE", Value: "vm"},
+		},
+		MountPoints: []ECSMountPoint{
+			{SourceVolume: "agents-config", ContainerPath: cm.InContainerConfigDir},
+			{SourceVolume: "var-run", ContainerPath: "/var/run", ReadOnly: true},
+		},
+		DependsOn: append([]ECSDependency{
+			{ContainerName: "kubearmor-relay-server", Condition: "START"},
+		}, spireDeps...),
+		MemoryReservation: 128,
+	}
+
+	td.ContainerDefinitions = []ECSContainer{kubearmorInit, kubearmor, relayServer, vmAdapter, feeder}
+	if tc.SpireEnabled {
+		td.ContainerDefinitions = append([]ECSContainer{spireAgent}, td.ContainerDefinitions...)
+	}
+	if o.LogGroup != "" {
+		for i := range td.ContainerDefinitions {
+			td.ContainerDefinitions[i].LogConfiguration = &ECSLogConfiguration{
+				LogDriver: "awslogs",
+				Options: map[string]string{
+					"awslogs-group":         o.LogGroup,
+					"awslogs-region":        o.Region,
+					"awslogs-stream-prefix": td.ContainerDefinitions[i].Name,
+					"awslogs-create-group":  "true",
+				},
+			}
+		}
+	}
+	return td
+}
+
+func hostVolume(name, path string) ECSVolume {
+	return ECSVolume{Name: name, Host: &ECSHostVolume{SourcePath: path}}
+}
+
+// ECSClient registers the ECS resources. AWSCLI is used by default, local
+// setups and tests can stub it.
+type ECSClient interface {
+	// RegisterTaskDefinition registers a revision of the task definition and
+	// returns its ARN
+	RegisterTaskDefinition(ctx context.Context, td ECSTaskDefinition) (string, error)
+	// ApplyService creates the service or updates its task definition
+	ApplyService(ctx context.Context, svc ECSService) error
+}
+
+// ApplyECS registers the task definition and points the daemon service to it
+func ApplyECS(ctx context.Context, client ECSClient, res *ECSResources) error {
+	arn, err := client.RegisterTaskDefinition(ctx, res.TaskDefinition)
+	if err != nil {
+		return fmt.Errorf("failed to register task definition: %v", err)
+	}
+	logger.Print("Registered task definition %s", arn)
+
+	svc := res.Service
+	svc.TaskDefinition = arn
+	if err := client.ApplyService(ctx, svc); err != nil {
+		return fmt.Errorf("failed to apply service %s: %v", svc.ServiceName, err)
+	}
+	return nil
+}
+
+// AWSCLI is an ECSClient running the aws CLI with its usual credentials
+type AWSCLI struct {
+	Region  string
+	Profile string
+	// EndpointURL overrides the ECS endpoint e.g. for a local emulator
+	EndpointURL string
+
+	// run runs the aws CLI, exec by default
+	run func(ctx context.Context, args ...string) (string, error)
+}
+
+func (a AWSCLI) aws(ctx context.Context, args ...string) (string, error) {
+	for _, flag := range [][2]string{{"--region", a.Region}, {"--profile", a.Profile}, {"--endpoint-url", a.EndpointURL}} {
+		if flag[1] != "" {
+			args = append(args, flag[0], flag[1])
+		}
+	}
+	if a.run != nil {
+		return a.run(ctx, args...)
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "aws", args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return "", fmt.Errorf("aws %s: %s", strings.Join(args[:2], " "), strings.TrimSpace(stderr.String()))
+		}
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func (a AWSCLI) RegisterTaskDefinition(ctx context.Context, td ECSTaskDefinition) (string, error) {
+	data, err := json.Marshal(td)
+	if err != nil {
+		return "", err
+	}
+	return a.aws(ctx, "ecs", "register-task-definition", "--cli-input-json", string(data),
+		"--query", "taskDefinition.taskDefinitionArn", "--output", "text")
+}
+
+func (a AWSCLI) ApplyService(ctx context.Context, svc ECSService) error {
+	active, err := a.aws(ctx, "ecs", "describe-services", "--cluster", svc.Cluster, "--services", svc.ServiceName,
+		"--query", "length(services[?status=='ACTIVE'])", "--output", "text")
+	if err != nil {
+		return err
+	}
+
+	if active == "0" {
+		data, err := json.Marshal(svc)
+		if err != nil {
+			return err
+		}
+		_, err = a.aws(ctx, "ecs", "create-service", "--cli-input-json", string(data))
+		return err
+	}
+	_, err = a.aws(ctx, "ecs", "update-service", "--cluster", svc.Cluster, "--service", svc.ServiceName,
+		"--task-definition", svc.TaskDefinition)
+	return err
+}
@@ -0,0 +1,175 @@
+package onboard
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestECSTaskDefinition(t *testing.T) {
+	ic := &InitConfig{}
+	ic.CPNodeAddr = "10.0.0.5"
+	ic.TCArgs.ReleaseVersion = "v0.10.0"
+	ic.TCArgs.NodeStateRefreshTime = 10
+	ic.TCArgs.SpireEnabled = true
+	ic.populateECSArgs(ECSOptions{HostConfigPath: DefaultECSHostConfigPath})
+
+	td := ic.ecsTaskDefinition(ECSOptions{Family: "agents", LogGroup: "/accuknox", Region: "us-east-1"})
+	if td.NetworkMode != "host" || td.PidMode != "host" {
+		t.Errorf("network mode = %s, pid mode = %s, want host", td.NetworkMode, td.PidMode)
+	}
+
+	containers := map[string]ECSContainer{}
+	for _, c := range td.ContainerDefinitions {
+		containers[c.Name] = c
+		if c.LogConfiguration == nil || c.LogConfiguration.Options["awslogs-group"] != "/accuknox" {
+			t.Errorf("container %s does not log to the log group", c.Name)
+		}
+	}
+	for _, name := range []string{"spire-agent", "kubearmor-init", "kubearmor", "kubearmor-relay-server", "kubearmor-vm-adapter", "feeder-service"} {
+		if _, ok := containers[name]; !ok {
+			t.Errorf("container %s missing", name)
+		}
+	}
+	if containers["kubearmor-init"].Essential {
+		t.Errorf("kubearmor-init is essential")
+	}
+
+	vmAdapter := containers["kubearmor-vm-adapter"].Command
+	for _, arg := range []string{
+		"--relay-server-addr=localhost:32768",
+		"--node-state-refresh=10",
+		"--spire",
+		"--sia-addr=10.0.0.5:32769",
+		"--harden-addr=10.0.0.5:32771",
+	} {
+		if !slices.Contains(vmAdapter, arg) {
+			t.Errorf("vm-adapter command %v is missing %s", vmAdapter, arg)
+		}
+	}
+
+	volumes := map[string]bool{}
+	for _, v := range td.Volumes {
+		volumes[v.Name] = true
+	}
+	for _, c := range td.ContainerDefinitions {
+		for _, m := range c.MountPoints {
+			if !volumes[m.SourceVolume] {
+				t.Errorf("container %s mounts undefined volume %s", c.Name, m.SourceVolume)
+			}
+		}
+	}
+}
+
+func TestECSTaskDefinitionSpire(t *testing.T) {
+	for _, enabled := range []bool{true, false} {
+		t.Run(fmt.Sprintf("spire=%v", enabled), func(t *testing.T) {
+			ic := &InitConfig{}
+			ic.TCArgs.SpireEnabled = enabled
+			ic.populateECSArgs(ECSOptions{HostConfigPath: DefaultECSHostConfigPath})
+			td := ic.ecsTaskDefinition(ECSOptions{Family: "agents", HostConfigPath: DefaultECSHostConfigPath})
+
+			var spireContainer bool
+			for _, c := range td.ContainerDefinitions {
+				if c.Name == "spire-agent" {
+					spireContainer = true
+				}
+				for _, dep := range c.DependsOn {
+					if dep.ContainerName == "spire-agent" && !enabled {
+						t.Errorf("container %s depends on the disabled spire-agent", c.Name)
+					}
+				}
+				for _, env := range c.Environment {
+					if env.Name == "SPIRE_ENABLED" && env.Value != fmt.Sprint(enabled) {
+						t.Errorf("%s SPIRE_ENABLED = %s, want %v", c.Name, env.Value, enabled)
+					}
+				}
+			}
+			if spireContainer != enabled {
+				t.Errorf("spire-agent container present = %v, want %v", spireContainer, enabled)
+			}
+			for _, v := range td.Volumes {
+				if strings.HasPrefix(v.Name, "spire-") && !enabled {
+					t.Errorf("volume %s defined with spire disabled", v.Name)
+				}
+			}
+		})
+	}
+}
+
+type fakeECSClient struct {
+	registered []string
+	services   []ECSService
+	err        error
+}
+
+func (f *fakeECSClient) RegisterTaskDefinition(_ context.Context, td ECSTaskDefinition) (string, error) {
+	if f.err != nil {
+		return "", f.err
+	}
+	f.registered = append(f.registered, td.Family)
+	return "arn:aws:ecs:us-east-1:123456789012:task-definition/" + td.Family + ":1", nil
+}
+
+func (f *fakeECSClient) ApplyService(_ context.Context, svc ECSService) error {
+	f.services = append(f.services, svc)
+	return nil
+}
+
+func TestApplyECS(t *testing.T) {
+	res := &ECSResources{
+		TaskDefinition: ECSTaskDefinition{Family: "agents"},
+		Service:        ECSService{Cluster: "prod", ServiceName: "agents", TaskDefinition: "agents"},
+	}
+
+	client := &fakeECSClient{}
+	if err := ApplyECS(context.Background(), client, res); err != nil {
+		t.Fatalf("ApplyECS() error = %v", err)
+	}
+	if len(client.registered) != 1 || len(client.services) != 1 {
+		t.Fatalf("registered %v, applied %v, want one of each", client.registered, client.services)
+	}
+	if got := client.services[0].TaskDefinition; !strings.HasSuffix(got, "task-definition/agents:1") {
+		t.Errorf("service task definition = %s, want the registered revision", got)
+	}
+
+	client = &fakeECSClient{err: fmt.Errorf("denied")}
+	if err := ApplyECS(context.Background(), client, res); err == nil || len(client.services) != 0 {
+		t.Errorf("ApplyECS() error = %v, applied %v, want the service not applied", err, client.services)
+	}
+}
+
+func TestAWSCLIApplyService(t *testing.T) {
+	svc := ECSService{Cluster: "prod", ServiceName: "agents", TaskDefinition: "arn:agents:2"}
+	tests := []struct {
+		name   string
+		active string
+		want   string
+	}{
+		{name: "create", active: "0", want: "create-service"},
+		{name: "update", active: "1", want: "update-service"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls [][]string
+			a := AWSCLI{Region: "us-east-1", run: func(_ context.Context, args ...string) (string, error) {
+				calls = append(calls, args)
+				if args[1] == "describe-services" {
+					return tt.active, nil
+				}
+				return "", nil
+			}}
+			if err := a.ApplyService(context.Background(), svc); err != nil {
+				t.Fatalf("ApplyService() error = %v", err)
+			}
+			if len(calls) != 2 || calls[1][1] != tt.want {
+				t.Fatalf("aws calls = %v, want describe-services then %s", calls, tt.want)
+			}
+			if !slices.Contains(calls[1], "--region") {
+				t.Errorf("aws call %v is missing the region", calls[1])
+			}
+		})
+	}
+}
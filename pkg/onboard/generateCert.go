@@ -71,13 +71,7 @@ func StoreCert(certPathMap map[string]string) error {
 		if err := os.MkdirAll(dirPath, os.ModeDir|os.ModePerm); err != nil {
 			return err
 		}
-		cleanPath := filepath.Clean(path)
-		file, err := os.Create(cleanPath)
-		if err != nil {
-			return err
-		}
-		defer file.Close()
-		if _, err := file.Write([]byte(cert)); err != nil {
+		if err := writeCertFile(path, cert); err != nil {
 			return err
 		}
 
@@ -89,7 +83,7 @@ func StoreCert(certPathMap map[string]string) error {
 
 func (ic *InitConfig) GenerateCertAndKey(caCert *certify.Result, caKey *certify.PrivateKey) (*certify.Result, *certify.PrivateKey, error) {
 
-	ips := getIPs()
+	ips := hostIPs()
 
 	if len(ic.Tls.IPs) > 0 {
 		for _, ip := range ic.Tls.IPs {
@@ -139,6 +133,9 @@ func getKeyIdentifier(publicKey *ecdsa.PublicKey) ([]byte, error) {
 	return ki[:], nil
 }
 
+// hostIPs returns the addresses added to the SANs of the RabbitMQ certificate
+var hostIPs = getIPs
+
 func getIPs() []net.IP {
 
 	var ips []net.IP
@@ -226,6 +223,7 @@ func (ic *InitConfig) GenerateOrUpdateCert(paths []string) (map[string]string, [
 	caPath := fmt.Sprintf("%s%s/%s", configPath, common.DefaultRabbitMQDir, common.DefaultCAFileName)
 	certPath := fmt.Sprintf("%s%s/%s", configPath, common.DefaultRabbitMQDir, common.DefaultCertificateName)
 	keyPath := fmt.Sprintf("%s%s/%s", configPath, common.DefaultRabbitMQDir, common.DefaultKeyFileName)
+	caKeyPath := fmt.Sprintf("%s%s/%s", configPath, common.DefaultRabbitMQDir, common.DefaultCAKeyFileName)
 
 	if ic.Tls.Generate {
 		caCert, caKey, err := ic.GenerateCA()
@@ -240,6 +238,8 @@ func (ic *InitConfig) GenerateOrUpdateCert(paths []string) (map[string]string, [
 		storeData[caPath] = caCert.String()
 		storeData[certPath] = cert.String()
 		storeData[keyPath] = key.String()
+		// kept for rotating the certificate later
+		storeData[caKeyPath] = caKey.String()
 
 		caCertBytes = []byte(caCert.String())
 	} else if len(paths) > 0 {
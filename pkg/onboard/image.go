@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"regexp"
 	"strings"
+
+	cm "github.com/accuknox/accuknox-cli-v2/pkg/common"
 )
 
 type imageOptions struct {
@@ -114,3 +116,209 @@ func getImage(customRegistry, defaultRegistry, defaultRepo, customImage, default
 
 	return fmt.Sprintf("%s/%s:%s", repoAndRegistry, imageName, tag), nil
 }
+
+// agentImages are the images and tags of the agents set by the user, the
+// ones of the release are used for the others
+type agentImages struct {
+	KubeArmorImage      string
+	KubeArmorInitImage  string
+	VMAdapterImage      string
+	RelayServerImage    string
+	SIAImage            string
+	PEAImage            string
+	FeederImage         string
+	RMQImage            string
+	SumEngineImage      string
+	HardeningAgentImage string
+	SPIREAgentImage     string
+	WaitForItImage      string
+	DiscoverImage       string
+
+	KubeArmorTag      string
+	VMAdapterTag      string
+	RelayServerTag    string
+	SIATag            string
+	PEATag            string
+	FeederTag         string
+	SumEngineTag      string
+	DiscoverTag       string
+	HardeningAgentTag string
+}
+
+// setImages sets the images of the agents for the mode of the cluster, from
+// the release info unless overridden
+func (cc *ClusterConfig) setImages(o agentImages, releaseInfo cm.ReleaseMetadata, registry string, preserveUpstream bool) error {
+	var err error
+	switch cc.Mode {
+	case VMMode_Docker:
+		cc.KubeArmorImage, err = getImage(registry, cm.DefaultDockerRegistry,
+			cm.DefaultKubeArmorRepo, o.KubeArmorImage, cm.DefaultKubeArmorImage,
+			o.KubeArmorTag, releaseInfo.KubeArmorTag, "", "", preserveUpstream)
+		if err != nil {
+			return err
+		}
+
+		cc.KubeArmorInitImage, err = getImage(registry, cm.DefaultDockerRegistry,
+			cm.DefaultKubeArmorRepo, o.KubeArmorInitImage, cm.DefaultKubeArmorInitImage,
+			o.KubeArmorTag, releaseInfo.KubeArmorTag, "", "", preserveUpstream)
+		if err != nil {
+			return err
+		}
+
+		cc.KubeArmorVMAdapterImage, err = getImage(registry, cm.DefaultDockerRegistry,
+			cm.DefaultAccuKnoxRepo, o.VMAdapterImage, cm.DefaultVMAdapterImage,
+			o.VMAdapterTag, releaseInfo.KubeArmorVMAdapterTag, "", "", preserveUpstream)
+		if err != nil {
+			return err
+		}
+
+		cc.KubeArmorRelayServerImage, err = getImage(registry, cm.DefaultDockerRegistry,
+			cm.DefaultAccuKnoxRepo, o.RelayServerImage, cm.DefaultRelayServerImage,
+			o.RelayServerTag, releaseInfo.KubeArmorRelayTag, "", "", preserveUpstream)
+		if err != nil {
+			return err
+		}
+
+		cc.SIAImage, err = getImage(registry, cm.DefaultDockerRegistry,
+			cm.DefaultAccuKnoxRepo, o.SIAImage, releaseInfo.SIAImage,
+			o.SIATag, releaseInfo.SIATag, "", "", preserveUpstream)
+		if err != nil {
+			return err
+		}
+
+		cc.PEAImage, err = getImage(registry, cm.DefaultDockerRegistry,
+			cm.DefaultAccuKnoxRepo, o.PEAImage, releaseInfo.PEAImage,
+			o.PEATag, releaseInfo.PEATag, "", "", preserveUpstream)
+		if err != nil {
+			return err
+		}
+
+		cc.FeederImage, err = getImage(registry, cm.DefaultDockerRegistry,
+			cm.DefaultAccuKnoxRepo, o.FeederImage, releaseInfo.FeederServiceImage,
+			o.FeederTag, releaseInfo.FeederServiceTag, "", "", preserveUpstream)
+		if err != nil {
+			return err
+		}
+
+		cc.SPIREAgentImage, err = getImage(registry, cm.DefaultDockerRegistry,
+			cm.DefaultAccuKnoxRepo, o.SPIREAgentImage, cm.DefaultSPIREAgentImage,
+			"latest", releaseInfo.SPIREAgentImageTag, "", "", preserveUpstream)
+		if err != nil {
+			return err
+		}
+
+		cc.WaitForItImage, err = getImage(registry, cm.DefaultDockerRegistry,
+			cm.DefaultAccuKnoxRepo, o.WaitForItImage, cm.DefaultWaitForItImage,
+			"latest", "", "", "", preserveUpstream)
+		if err != nil {
+			return err
+		}
+
+		cc.DiscoverImage, err = getImage(registry, cm.DefaultDockerRegistry,
+			cm.DefaultAccuKnoxRepo, o.DiscoverImage, releaseInfo.DiscoverImage,
+			o.DiscoverTag, releaseInfo.DiscoverTag, "", "", preserveUpstream)
+		if err != nil {
+			return err
+		}
+
+		cc.SumEngineImage, err = getImage(registry, cm.DefaultDockerRegistry,
+			cm.DefaultAccuKnoxRepo, o.SumEngineImage, releaseInfo.SumEngineImage,
+			o.SumEngineTag, releaseInfo.SumEngineTag, "", "", preserveUpstream)
+		if err != nil {
+			return err
+		}
+
+		cc.HardeningAgentImage, err = getImage(registry, cm.DefaultDockerRegistry,
+			cm.DefaultAccuKnoxRepo, o.HardeningAgentImage, releaseInfo.HardeningAgentImage,
+			o.HardeningAgentTag, releaseInfo.HardeningAgentTag, "", "", preserveUpstream)
+		if err != nil {
+			return err
+		}
+
+		cc.RMQImage, err = getImage(registry, cm.DefaultDockerRegistry,
+			"", o.RMQImage, cm.DefaultRMQImage,
+			"", cm.DefaultRMQImageTag, "", "", preserveUpstream)
+		if err != nil {
+			return err
+		}
+
+	case VMMode_Systemd:
+		cc.AgentDigests = releaseInfo.Digests
+
+		kaVersion := o.KubeArmorTag
+		if o.KubeArmorTag != "" && (o.KubeArmorTag == "stable" || o.KubeArmorTag == "latest") {
+			fmt.Printf("%s tag not available for systemd package. Using values from release chart", o.KubeArmorTag)
+			kaVersion = ""
+		}
+		cc.KubeArmorImage, err = getImage(registry, cm.DefaultDockerRegistry,
+			cm.DefaultKubeArmorRepo, o.KubeArmorImage, cm.AgentRepos[cm.KubeArmor],
+			kaVersion, releaseInfo.KubeArmorTag, "v", cm.SystemdTagSuffix, preserveUpstream)
+		if err != nil {
+			return err
+		}
+
+		cc.KubeArmorVMAdapterImage, err = getImage(registry, cm.DefaultDockerRegistry,
+			cm.DefaultAccuKnoxRepo, o.VMAdapterImage, cm.AgentRepos[cm.VMAdapter],
+			o.VMAdapterTag, releaseInfo.KubeArmorVMAdapterTag, "v", cm.SystemdTagSuffix, preserveUpstream)
+		if err != nil {
+			return err
+		}
+
+		cc.KubeArmorRelayServerImage, err = getImage(registry, cm.DefaultDockerRegistry,
+			cm.DefaultAccuKnoxRepo, o.RelayServerImage, cm.AgentRepos[cm.RelayServer],
+			o.RelayServerTag, releaseInfo.KubeArmorRelayTag, "v", cm.SystemdTagSuffix, preserveUpstream)
+		if err != nil {
+			return err
+		}
+
+		cc.SIAImage, err = getImage(registry, cm.DefaultDockerRegistry,
+			cm.DefaultAccuKnoxRepo, o.SIAImage, cm.AgentRepos[cm.SIAAgent],
+			o.SIATag, releaseInfo.SIATag, "v", cm.SystemdTagSuffix, preserveUpstream)
+		if err != nil {
+			return err
+		}
+
+		cc.PEAImage, err = getImage(registry, cm.DefaultDockerRegistry,
+			cm.DefaultAccuKnoxRepo, o.PEAImage, cm.AgentRepos[cm.PEAAgent],
+			o.PEATag, releaseInfo.PEATag, "v", cm.SystemdTagSuffix, preserveUpstream)
+		if err != nil {
+			return err
+		}
+
+		cc.FeederImage, err = getImage(registry, cm.DefaultDockerRegistry,
+			cm.DefaultAccuKnoxRepo, o.FeederImage, cm.AgentRepos[cm.FeederService],
+			o.FeederTag, releaseInfo.FeederServiceTag, "v", cm.SystemdTagSuffix, preserveUpstream)
+		if err != nil {
+			return err
+		}
+
+		cc.SPIREAgentImage, err = getImage(registry, cm.DefaultDockerRegistry,
+			cm.DefaultAccuKnoxRepo, o.SPIREAgentImage, cm.AgentRepos[cm.SpireAgent],
+			"", releaseInfo.SPIREAgentImageTag, "v", cm.SystemdTagSuffix, preserveUpstream)
+		if err != nil {
+			return err
+		}
+
+		cc.SumEngineImage, err = getImage(registry, cm.DefaultDockerRegistry,
+			cm.DefaultAccuKnoxRepo, o.SumEngineImage, cm.AgentRepos[cm.SummaryEngine],
+			o.SumEngineTag, releaseInfo.SumEngineTag, "v", cm.SystemdTagSuffix, preserveUpstream)
+		if err != nil {
+			return err
+		}
+
+		cc.DiscoverImage, err = getImage(registry, cm.DefaultDockerRegistry,
+			cm.DefaultAccuKnoxRepo, o.DiscoverImage, cm.AgentRepos[cm.DiscoverAgent],
+			o.DiscoverTag, releaseInfo.DiscoverTag, "v", cm.SystemdTagSuffix, preserveUpstream)
+		if err != nil {
+			return err
+		}
+
+		cc.HardeningAgentImage, err = getImage(registry, cm.DefaultDockerRegistry,
+			cm.DefaultAccuKnoxRepo, o.HardeningAgentImage, cm.AgentRepos[cm.HardeningAgent],
+			o.HardeningAgentTag, releaseInfo.HardeningAgentTag, "v", cm.SystemdTagSuffix, preserveUpstream)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
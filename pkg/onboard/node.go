@@ -7,7 +7,6 @@ import (
 
 	"github.com/Masterminds/sprig"
 	"github.com/accuknox/accuknox-cli-v2/pkg/common"
-	"golang.org/x/mod/semver"
 )
 
 func JoinClusterConfig(cc ClusterConfig, kubeArmorAddr, relayServerAddr, siaAddr, peaAddr, hardenAddr, spireHost, spireTrustBundleURL, joinToken, secretDir string) *JoinConfig {
@@ -189,14 +188,7 @@ func (jc *JoinConfig) CreateBaseNodeConfig() error {
 	return nil
 }
 
-func (jc *JoinConfig) JoinWorkerNode() error {
-	// validate this environment
-	dockerStatus, err := jc.ValidateEnv()
-	if err != nil {
-		return err
-	}
-	fmt.Println(dockerStatus)
-
+func (jc *JoinConfig) JoinWorkerNode(opts StepOptions) error {
 	configPath, err := createDefaultConfigPath()
 	if err != nil {
 		return err
@@ -224,52 +216,78 @@ func (jc *JoinConfig) JoinWorkerNode() error {
 		jc.TCArgs.RMQPassword = rmqData[1]
 	}
 
-	// initialize sprig for templating
-	sprigFuncs := sprig.GenericFuncMap()
-
 	if jc.Tls.Enabled {
 		jc.TCArgs.TlsCertFile = fmt.Sprintf("%s%s%s/%s", jc.UserConfigPath, configPath, common.DefaultCACertDir, common.DefaultEncodedFileName)
-		caPath := configPath + "/cert/encoded.pem"
-		if err := StoreCert(map[string]string{
-			caPath: jc.Tls.CaCert,
-		}); err != nil {
-			return err
-		}
 	}
 
 	jc.TCArgs.SplunkConfigObject = jc.Splunk
 
-	if jc.TCArgs.SplunkConfigObject.Enabled {
-		if err := validateSplunkCredential(jc.TCArgs.SplunkConfigObject); err != nil {
-			return err
-		}
+	steps := []onboardStep{
+		{name: Step_ValidateEnv, run: func() error {
+			dockerStatus, err := jc.ValidateEnv()
+			if err != nil {
+				return err
+			}
+			fmt.Println(dockerStatus)
 
+			if jc.TCArgs.SplunkConfigObject.Enabled {
+				return validateSplunkCredential(jc.TCArgs.SplunkConfigObject)
+			}
+			return nil
+		}},
+		{name: Step_GenerateConfig, run: func() error {
+			// write compose file and config files
+			files, err := jc.dockerAgentFiles(configPath)
+			if err != nil {
+				return err
+			}
+			for _, file := range files {
+				if err := file.write(); err != nil {
+					return err
+				}
+			}
+			return nil
+		}},
+		{name: Step_TLS, run: func() error {
+			if !jc.Tls.Enabled {
+				return nil
+			}
+			return StoreCert(map[string]string{
+				configPath + "/cert/encoded.pem": jc.Tls.CaCert,
+			})
+		}},
 	}
+	steps = append(steps, composeSteps(jc, NodeType_WorkerNode, []string{"kubearmor-init-vol"})...)
+	return jc.runOnboardSteps(NodeType_WorkerNode, opts, steps)
+}
 
-	// write compose file
-	composeFilePath, err := copyOrGenerateFile(jc.UserConfigPath, configPath, "docker-compose.yaml", sprigFuncs, workerNodeComposeFileTemplate, jc.TCArgs)
+// dockerAgentFiles generates the compose file and the config and kmux config
+// files of the worker node agents in docker mode
+func (jc *JoinConfig) dockerAgentFiles(configPath string) ([]agentFile, error) {
+	// initialize sprig for templating
+	sprigFuncs := sprig.GenericFuncMap()
+
+	data, err := generateFile(jc.UserConfigPath, composeFileName, sprigFuncs, workerNodeComposeFileTemplate, jc.TCArgs)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	files := []agentFile{{dir: configPath, name: composeFileName, data: data}}
 
-	kmuxConfigArgs := KmuxConfigTemplateArgs{
-		ReleaseVersion: jc.AgentsVersion,
-		RMQServer:      jc.RMQServer,
-		RMQUsername:    jc.TCArgs.RMQUsername,
-		RMQPassword:    jc.TCArgs.RMQPassword,
-		TlsEnabled:     jc.TCArgs.TlsEnabled,
-		TlsCertFile:    jc.TCArgs.TlsCertFile,
-	}
+	kmuxConfigArgs := jc.kmuxConfigArgs()
 
 	populateAgentArgs(&jc.TCArgs, "sumengine")
-	if _, err := copyOrGenerateFile(jc.UserConfigPath, configPath, "sumengine/config.yaml", sprigFuncs, sumEngineConfig, jc.TCArgs); err != nil {
-		return err
+	data, err = generateFile(jc.UserConfigPath, "sumengine/config.yaml", sprigFuncs, sumEngineConfig, jc.TCArgs)
+	if err != nil {
+		return nil, err
 	}
+	files = append(files, agentFile{agent: composeServices["sumengine"], dir: configPath, name: "sumengine/config.yaml", data: data})
 
 	if jc.SpireEnabled {
-		if _, err := copyOrGenerateFile(jc.UserConfigPath, configPath, "spire/conf/agent.conf", sprigFuncs, spireAgentConfig, jc.TCArgs); err != nil {
-			return err
+		data, err := generateFile(jc.UserConfigPath, "spire/conf/agent.conf", sprigFuncs, spireAgentConfig, jc.TCArgs)
+		if err != nil {
+			return nil, err
 		}
+		files = append(files, agentFile{agent: composeServices["spire"], dir: configPath, name: "spire/conf/agent.conf", data: data})
 	}
 
 	kmuxConfigFileTemplateMap := map[string]string{
@@ -286,53 +304,12 @@ func (jc *JoinConfig) JoinWorkerNode() error {
 		populateAgentArgs(&jc.TCArgs, "kubearmor-vm-adapter")
 		populateKmuxArgs(&kmuxConfigArgs, agentName, file, jc.RMQTopicPrefix, jc.TCArgs.Hostname, jc.RMQConnectionName)
 		kmuxConfigArgs.UseCaFile = useCaFile(&jc.TCArgs, agentName, "")
-		if _, err := copyOrGenerateFile(jc.UserConfigPath, configPath, filePath, sprigFuncs, templateString, kmuxConfigArgs); err != nil {
-			return err
-		}
-	}
-
-	diagnosis := true
-
-	args := []string{"-f", composeFilePath, "--profile", "kubearmor-only"}
-	if jc.DeploySumengine {
-		args = append(args, "--profile", "accuknox-agents")
-	}
-	if jc.SpireEnabled {
-		args = append(args, "--profile", "spire-agent")
-	}
-
-	if jc.Parallel > 0 {
-		args = append(args, "--parallel", fmt.Sprintf("%v", jc.Parallel))
-	}
-
-	args = append(args, "up", "-d")
-
-	// need these flags for diagnosis
-	if semver.Compare(jc.composeVersion, common.MinDockerComposeWithWaitSupported) >= 0 {
-		args = append(args, "--wait", "--wait-timeout", "60")
-	} else {
-		diagnosis = false
-	}
-
-	// run compose command
-	_, err = ExecComposeCommand(true, jc.DryRun, jc.composeCmd, args...)
-	if err != nil {
-		// cleanup volumes
-		_, volDelErr := ExecDockerCommand(true, false, "docker", "volume", "rm", "kubearmor-init-vol")
-		if volDelErr != nil {
-			fmt.Println("Error while removing volumes:", volDelErr.Error())
-		}
-
-		if diagnosis {
-			diagnosisResult, diagErr := diagnose(NodeType_WorkerNode)
-			if diagErr != nil {
-				diagnosisResult = diagErr.Error()
-			}
-			return fmt.Errorf("Error: %s.\n\nDIAGNOSIS:\n%s", err.Error(), diagnosisResult)
+		data, err := generateFile(jc.UserConfigPath, filePath, sprigFuncs, templateString, kmuxConfigArgs)
+		if err != nil {
+			return nil, err
 		}
-
-		return err
+		files = append(files, agentFile{agent: composeServices[agentName], dir: configPath, name: filePath, data: data})
 	}
 
-	return nil
+	return files, nil
 }
@@ -196,174 +196,35 @@ func CreateClusterConfig(clusterType ClusterType, userConfigPath string, vmMode
 	cc.EnableHostPolicyDiscovery = enableHostPolicyDiscovery
 
 	// mode specific config
-	switch cc.Mode {
-	case VMMode_Docker:
-		cc.KubeArmorImage, err = getImage(registry, cm.DefaultDockerRegistry,
-			cm.DefaultKubeArmorRepo, kubearmorImage, cm.DefaultKubeArmorImage,
-			kubearmorVersion, releaseInfo.KubeArmorTag, "", "", preserveUpstream)
-		if err != nil {
-			return nil, err
-		}
-
-		cc.KubeArmorInitImage, err = getImage(registry, cm.DefaultDockerRegistry,
-			cm.DefaultKubeArmorRepo, kubearmorInitImage, cm.DefaultKubeArmorInitImage,
-			kubearmorVersion, releaseInfo.KubeArmorTag, "", "", preserveUpstream)
-		if err != nil {
-			return nil, err
-		}
-
-		cc.KubeArmorVMAdapterImage, err = getImage(registry, cm.DefaultDockerRegistry,
-			cm.DefaultAccuKnoxRepo, vmAdapterImage, cm.DefaultVMAdapterImage,
-			vmAdapterTag, releaseInfo.KubeArmorVMAdapterTag, "", "", preserveUpstream)
-		if err != nil {
-			return nil, err
-		}
-
-		cc.KubeArmorRelayServerImage, err = getImage(registry, cm.DefaultDockerRegistry,
-			cm.DefaultAccuKnoxRepo, relayServerImage, cm.DefaultRelayServerImage,
-			kubeArmorRelayServerTag, releaseInfo.KubeArmorRelayTag, "", "", preserveUpstream)
-		if err != nil {
-			return nil, err
-		}
-
-		cc.SIAImage, err = getImage(registry, cm.DefaultDockerRegistry,
-			cm.DefaultAccuKnoxRepo, siaImage, releaseInfo.SIAImage,
-			siaVersionTag, releaseInfo.SIATag, "", "", preserveUpstream)
-		if err != nil {
-			return nil, err
-		}
-
-		cc.PEAImage, err = getImage(registry, cm.DefaultDockerRegistry,
-			cm.DefaultAccuKnoxRepo, peaImage, releaseInfo.PEAImage,
-			peaVersionTag, releaseInfo.PEATag, "", "", preserveUpstream)
-		if err != nil {
-			return nil, err
-		}
-
-		cc.FeederImage, err = getImage(registry, cm.DefaultDockerRegistry,
-			cm.DefaultAccuKnoxRepo, feederImage, releaseInfo.FeederServiceImage,
-			feederVersionTag, releaseInfo.FeederServiceTag, "", "", preserveUpstream)
-		if err != nil {
-			return nil, err
-		}
-
-		cc.SPIREAgentImage, err = getImage(registry, cm.DefaultDockerRegistry,
-			cm.DefaultAccuKnoxRepo, spireImage, cm.DefaultSPIREAgentImage,
-			"latest", releaseInfo.SPIREAgentImageTag, "", "", preserveUpstream)
-		if err != nil {
-			return nil, err
-		}
-
-		cc.WaitForItImage, err = getImage(registry, cm.DefaultDockerRegistry,
-			cm.DefaultAccuKnoxRepo, waitForItImage, cm.DefaultWaitForItImage,
-			"latest", "", "", "", preserveUpstream)
-		if err != nil {
-			return nil, err
-		}
-
-		cc.DiscoverImage, err = getImage(registry, cm.DefaultDockerRegistry,
-			cm.DefaultAccuKnoxRepo, discoverImage, releaseInfo.DiscoverImage,
-			discoverVersionTag, releaseInfo.DiscoverTag, "", "", preserveUpstream)
-		if err != nil {
-			return nil, err
-		}
-
-		cc.SumEngineImage, err = getImage(registry, cm.DefaultDockerRegistry,
-			cm.DefaultAccuKnoxRepo, sumEngineImage, releaseInfo.SumEngineImage,
-			sumEngineTag, releaseInfo.SumEngineTag, "", "", preserveUpstream)
-		if err != nil {
-			return nil, err
-		}
-
-		cc.HardeningAgentImage, err = getImage(registry, cm.DefaultDockerRegistry,
-			cm.DefaultAccuKnoxRepo, hardeningAgentImage, releaseInfo.HardeningAgentImage,
-			hardeningAgentVersionTag, releaseInfo.HardeningAgentTag, "", "", preserveUpstream)
-		if err != nil {
-			return nil, err
-		}
-
-		cc.RMQImage, err = getImage(registry, cm.DefaultDockerRegistry,
-			"", rmqImage, cm.DefaultRMQImage,
-			"", cm.DefaultRMQImageTag, "", "", preserveUpstream)
-		if err != nil {
-			return nil, err
-		}
-
-	case VMMode_Systemd:
-		kaVersion := kubearmorVersion
-		if kubearmorVersion != "" && (kubearmorVersion == "stable" || kubearmorVersion == "latest") {
-			fmt.Printf("%s tag not available for systemd package. Using values from release chart", kubearmorVersion)
-			kaVersion = ""
-		}
-		cc.KubeArmorImage, err = getImage(registry, cm.DefaultDockerRegistry,
-			cm.DefaultKubeArmorRepo, kubearmorImage, cm.AgentRepos[cm.KubeArmor],
-			kaVersion, releaseInfo.KubeArmorTag, "v", cm.SystemdTagSuffix, preserveUpstream)
-		if err != nil {
-			return nil, err
-		}
-
-		cc.KubeArmorVMAdapterImage, err = getImage(registry, cm.DefaultDockerRegistry,
-			cm.DefaultAccuKnoxRepo, vmAdapterImage, cm.AgentRepos[cm.VMAdapter],
-			vmAdapterTag, releaseInfo.KubeArmorVMAdapterTag, "v", cm.SystemdTagSuffix, preserveUpstream)
-		if err != nil {
-			return nil, err
-		}
-
-		cc.KubeArmorRelayServerImage, err = getImage(registry, cm.DefaultDockerRegistry,
-			cm.DefaultAccuKnoxRepo, relayServerImage, cm.AgentRepos[cm.RelayServer],
-			kubeArmorRelayServerTag, releaseInfo.KubeArmorRelayTag, "v", cm.SystemdTagSuffix, preserveUpstream)
-		if err != nil {
-			return nil, err
-		}
-
-		cc.SIAImage, err = getImage(registry, cm.DefaultDockerRegistry,
-			cm.DefaultAccuKnoxRepo, siaImage, cm.AgentRepos[cm.SIAAgent],
-			siaVersionTag, releaseInfo.SIATag, "v", cm.SystemdTagSuffix, preserveUpstream)
-		if err != nil {
-			return nil, err
-		}
-
-		cc.PEAImage, err = getImage(registry, cm.DefaultDockerRegistry,
-			cm.DefaultAccuKnoxRepo, peaImage, cm.AgentRepos[cm.PEAAgent],
-			peaVersionTag, releaseInfo.PEATag, "v", cm.SystemdTagSuffix, preserveUpstream)
-		if err != nil {
-			return nil, err
-		}
-
-		cc.FeederImage, err = getImage(registry, cm.DefaultDockerRegistry,
-			cm.DefaultAccuKnoxRepo, feederImage, cm.AgentRepos[cm.FeederService],
-			feederVersionTag, releaseInfo.FeederServiceTag, "v", cm.SystemdTagSuffix, preserveUpstream)
-		if err != nil {
-			return nil, err
-		}
-
-		cc.SPIREAgentImage, err = getImage(registry, cm.DefaultDockerRegistry,
-			cm.DefaultAccuKnoxRepo, spireImage, cm.AgentRepos[cm.SpireAgent],
-			"", releaseInfo.SPIREAgentImageTag, "v", cm.SystemdTagSuffix, preserveUpstream)
-		if err != nil {
-			return nil, err
-		}
-
-		cc.SumEngineImage, err = getImage(registry, cm.DefaultDockerRegistry,
-			cm.DefaultAccuKnoxRepo, sumEngineImage, cm.AgentRepos[cm.SummaryEngine],
-			sumEngineTag, releaseInfo.SumEngineTag, "v", cm.SystemdTagSuffix, preserveUpstream)
-		if err != nil {
-			return nil, err
-		}
-
-		cc.DiscoverImage, err = getImage(registry, cm.DefaultDockerRegistry,
-			cm.DefaultAccuKnoxRepo, discoverImage, cm.AgentRepos[cm.DiscoverAgent],
-			discoverVersionTag, releaseInfo.DiscoverTag, "v", cm.SystemdTagSuffix, preserveUpstream)
-		if err != nil {
-			return nil, err
-		}
+	err = cc.setImages(agentImages{
+		KubeArmorImage:      kubearmorImage,
+		KubeArmorInitImage:  kubearmorInitImage,
+		VMAdapterImage:      vmAdapterImage,
+		RelayServerImage:    relayServerImage,
+		SIAImage:            siaImage,
+		PEAImage:            peaImage,
+		FeederImage:         feederImage,
+		RMQImage:            rmqImage,
+		SumEngineImage:      sumEngineImage,
+		HardeningAgentImage: hardeningAgentImage,
+		SPIREAgentImage:     spireImage,
+		WaitForItImage:      waitForItImage,
+		DiscoverImage:       discoverImage,
+		KubeArmorTag:        kubearmorVersion,
+		VMAdapterTag:        vmAdapterTag,
+		RelayServerTag:      kubeArmorRelayServerTag,
+		SIATag:              siaVersionTag,
+		PEATag:              peaVersionTag,
+		FeederTag:           feederVersionTag,
+		SumEngineTag:        sumEngineTag,
+		DiscoverTag:         discoverVersionTag,
+		HardeningAgentTag:   hardeningAgentVersionTag,
+	}, releaseInfo, registry, preserveUpstream)
+	if err != nil {
+		return nil, err
+	}
 
-		cc.HardeningAgentImage, err = getImage(registry, cm.DefaultDockerRegistry,
-			cm.DefaultAccuKnoxRepo, hardeningAgentImage, cm.AgentRepos[cm.HardeningAgent],
-			hardeningAgentVersionTag, releaseInfo.HardeningAgentTag, "v", cm.SystemdTagSuffix, preserveUpstream)
-		if err != nil {
-			return nil, err
-		}
+	if cc.Mode == VMMode_Systemd {
 		// log file size
 		cc.LogRotate = strings.ToUpper(logRotate)
 		// create systemd service objects
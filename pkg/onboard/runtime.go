@@ -0,0 +1,346 @@
+package onboard
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	cm "github.com/accuknox/accuknox-cli-v2/pkg/common"
+	dockerContainerTypes "github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/client"
+	"golang.org/x/mod/semver"
+)
+
+type ContainerRuntime string
+
+const (
+	ContainerRuntime_Docker  ContainerRuntime = "docker"
+	ContainerRuntime_Podman  ContainerRuntime = "podman"
+	ContainerRuntime_Nerdctl ContainerRuntime = "nerdctl"
+)
+
+// containerRuntimes in the order they are detected
+var containerRuntimes = []ContainerRuntime{ContainerRuntime_Docker, ContainerRuntime_Podman, ContainerRuntime_Nerdctl}
+
+// composeCommands returns the compose commands of a runtime in the order they
+// are tried
+func (r ContainerRuntime) composeCommands() []string {
+	switch r {
+	case ContainerRuntime_Podman:
+		return []string{"podman compose", "podman-compose"}
+	case ContainerRuntime_Nerdctl:
+		return []string{"nerdctl compose"}
+	default:
+		return []string{"docker-compose", "docker compose"}
+	}
+}
+
+// composeRequirement is what to install when no compose command of a runtime
+// is usable
+func (r ContainerRuntime) composeRequirement() string {
+	switch r {
+	case ContainerRuntime_Podman:
+		return fmt.Sprintf("docker-compose %s+ or podman-compose %s+", cm.MinDockerComposeVersion, cm.MinPodmanComposeVersion)
+	case ContainerRuntime_Nerdctl:
+		return fmt.Sprintf("nerdctl %s+", cm.MinNerdctlVersion)
+	default:
+		return fmt.Sprintf("docker-compose %s+", cm.MinDockerComposeVersion)
+	}
+}
+
+// cli returns the command of the runtime, docker if not set
+func (r ContainerRuntime) cli() string {
+	if r == "" {
+		return string(ContainerRuntime_Docker)
+	}
+	return string(r)
+}
+
+// DetectContainerRuntime validates the given runtime or, if empty, returns the
+// first one installed. A docker command provided by podman-docker is
+// detected as podman.
+func DetectContainerRuntime(runtime ContainerRuntime) (ContainerRuntime, error) {
+	if runtime != "" {
+		known := false
+		for _, r := range containerRuntimes {
+			known = known || r == runtime
+		}
+		if !known {
+			return "", fmt.Errorf("container runtime: %s invalid, accepted values (docker/podman/nerdctl)", runtime)
+		}
+		if _, err := exec.LookPath(string(runtime)); err != nil {
+			if runtime == ContainerRuntime_Docker {
+				return "", fmt.Errorf("Error while looking for docker. Err: %s. Please install docker %s+.", err.Error(), cm.MinDockerVersion)
+			}
+			return "", fmt.Errorf("Error while looking for %s. Err: %s", runtime, err.Error())
+		}
+		return runtime, nil
+	}
+
+	for _, r := range containerRuntimes {
+		if _, err := exec.LookPath(string(r)); err != nil {
+			continue
+		}
+		if r == ContainerRuntime_Docker {
+			out, err := exec.Command("docker", "--version").Output()
+			if err == nil && strings.Contains(strings.ToLower(string(out)), "podman") {
+				return ContainerRuntime_Podman, nil
+			}
+		}
+		return r, nil
+	}
+	return "", fmt.Errorf("no container runtime found. Please install docker %s+, podman or nerdctl", cm.MinDockerVersion)
+}
+
+// knownComposeCommand checks if a command is the compose command of a runtime
+func knownComposeCommand(composeCmd string) bool {
+	for _, r := range containerRuntimes {
+		for _, command := range r.composeCommands() {
+			if command == composeCmd {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// minComposeVersion returns the minimum supported version of a compose command
+func minComposeVersion(composeCmd string) string {
+	switch composeCmd {
+	case "podman-compose":
+		return cm.MinPodmanComposeVersion
+	case "nerdctl compose":
+		return cm.MinNerdctlVersion
+	default:
+		return cm.MinDockerComposeVersion
+	}
+}
+
+// composeWaitSupported checks if "up --wait" is supported, which is needed
+// for diagnosis. Only docker compose v2 has it, podman compose may run it.
+func composeWaitSupported(composeCmd, composeVersion string) bool {
+	switch composeCmd {
+	case "docker-compose", "docker compose", "podman compose":
+		return semver.Compare(composeVersion, cm.MinDockerComposeWithWaitSupported) >= 0
+	}
+	return false
+}
+
+// composeDryRunSupported checks if a compose command supports --dry-run
+func composeDryRunSupported(composeCmd string) bool {
+	return strings.HasPrefix(composeCmd, "docker")
+}
+
+var composeVersionRegex = regexp.MustCompile(`v?(\d+\.\d+\.\d+)`)
+
+// parseComposeVersion returns the version printed by "<compose> version
+// --short", skipping the banner podman prints for external compose providers
+func parseComposeVersion(out string) string {
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, ">>>>") || strings.HasPrefix(line, "podman version") {
+			continue
+		}
+		if m := composeVersionRegex.FindStringSubmatch(line); m != nil {
+			return m[1]
+		}
+	}
+	return ""
+}
+
+// ContainerClient is the part of the docker client used for inspecting and
+// removing the agent containers
+type ContainerClient interface {
+	ContainerList(ctx context.Context, options dockerContainerTypes.ListOptions) ([]dockerContainerTypes.Summary, error)
+	ContainerInspect(ctx context.Context, containerID string) (dockerContainerTypes.InspectResponse, error)
+	ContainerStop(ctx context.Context, containerID string, options dockerContainerTypes.StopOptions) error
+	ContainerRemove(ctx context.Context, containerID string, options dockerContainerTypes.RemoveOptions) error
+	VolumeList(ctx context.Context, options volume.ListOptions) (volume.ListResponse, error)
+	VolumeRemove(ctx context.Context, volumeID string, force bool) error
+	Close() error
+}
+
+// CreateContainerClient creates a client for a runtime. Podman is used through
+// its docker compatible socket and nerdctl through its CLI.
+func CreateContainerClient(runtime ContainerRuntime) (ContainerClient, error) {
+	opts := []client.Opt{client.FromEnv, client.WithAPIVersionNegotiation()}
+
+	switch runtime {
+	case ContainerRuntime_Nerdctl:
+		return nerdctlClient{}, nil
+	case ContainerRuntime_Podman:
+		if os.Getenv(client.EnvOverrideHost) == "" {
+			socket := podmanSocket()
+			if _, err := os.Stat(socket); err != nil {
+				return nil, fmt.Errorf("podman socket %s not found, enable it with \"systemctl enable --now podman.socket\": %v", socket, err)
+			}
+			opts = append(opts, client.WithHost("unix://"+socket))
+		}
+	}
+
+	return client.NewClientWithOpts(opts...)
+}
+
+// podmanSocket returns the docker compatible socket of podman
+func podmanSocket() string {
+	if os.Geteuid() == 0 {
+		return "/run/podman/podman.sock"
+	}
+	return filepath.Join(os.Getenv("XDG_RUNTIME_DIR"), "podman", "podman.sock")
+}
+
+// nerdctlClient is a ContainerClient running nerdctl, which has no docker
+// compatible API
+type nerdctlClient struct {
+	// run runs nerdctl, exec by default
+	run func(args ...string) ([]byte, error)
+}
+
+func (n nerdctlClient) nerdctl(args ...string) ([]byte, error) {
+	if n.run != nil {
+		return n.run(args...)
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.Command("nerdctl", args...) // #nosec G204
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && stderr.Len() > 0 {
+			return nil, errors.New(strings.TrimSpace(stderr.String()))
+		}
+		return nil, err
+	}
+	return out, nil
+}
+
+// jsonLines decodes the output of a "--format '{{json .}}'" command
+func jsonLines[T any](out []byte) ([]T, error) {
+	var items []T
+	dec := json.NewDecoder(bytes.NewReader(out))
+	for dec.More() {
+		var item T
+		if err := dec.Decode(&item); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func (n nerdctlClient) ContainerList(_ context.Context, options dockerContainerTypes.ListOptions) ([]dockerContainerTypes.Summary, error) {
+	args := []string{"ps", "--format", "{{json .}}"}
+	if options.All {
+		args = append(args, "-a")
+	}
+	out, err := n.nerdctl(args...)
+	if err != nil {
+		return nil, err
+	}
+
+	containers, err := jsonLines[struct {
+		ID     string
+		Names  string
+		Image  string
+		Status string
+	}](out)
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := make([]dockerContainerTypes.Summary, 0, len(containers))
+	for _, c := range containers {
+		summaries = append(summaries, dockerContainerTypes.Summary{
+			ID:     c.ID,
+			Names:  []string{c.Names},
+			Image:  c.Image,
+			Status: c.Status,
+		})
+	}
+	return summaries, nil
+}
+
+func (n nerdctlClient) ContainerInspect(_ context.Context, containerID string) (dockerContainerTypes.InspectResponse, error) {
+	out, err := n.nerdctl("inspect", "--mode", "dockercompat", containerID)
+	if err != nil {
+		return dockerContainerTypes.InspectResponse{}, err
+	}
+
+	var containers []struct {
+		ID    string `json:"Id"`
+		Name  string
+		State *dockerContainerTypes.State
+	}
+	if err := json.Unmarshal(out, &containers); err != nil {
+		return dockerContainerTypes.InspectResponse{}, err
+	}
+	if len(containers) == 0 {
+		return dockerContainerTypes.InspectResponse{}, fmt.Errorf("container %s not found", containerID)
+	}
+	return dockerContainerTypes.InspectResponse{
+		ContainerJSONBase: &dockerContainerTypes.ContainerJSONBase{
+			ID:    containers[0].ID,
+			Name:  containers[0].Name,
+			State: containers[0].State,
+		},
+	}, nil
+}
+
+func (n nerdctlClient) ContainerStop(_ context.Context, containerID string, _ dockerContainerTypes.StopOptions) error {
+	_, err := n.nerdctl("stop", containerID)
+	return err
+}
+
+func (n nerdctlClient) ContainerRemove(_ context.Context, containerID string, options dockerContainerTypes.RemoveOptions) error {
+	args := []string{"rm"}
+	if options.Force {
+		args = append(args, "-f")
+	}
+	_, err := n.nerdctl(append(args, containerID)...)
+	return err
+}
+
+func (n nerdctlClient) VolumeList(_ context.Context, _ volume.ListOptions) (volume.ListResponse, error) {
+	out, err := n.nerdctl("volume", "ls", "--format", "{{json .}}")
+	if err != nil {
+		return volume.ListResponse{}, err
+	}
+
+	volumes, err := jsonLines[struct {
+		Name       string
+		Driver     string
+		Mountpoint string
+	}](out)
+	if err != nil {
+		return volume.ListResponse{}, err
+	}
+	var resp volume.ListResponse
+	for _, v := range volumes {
+		resp.Volumes = append(resp.Volumes, &volume.Volume{Name: v.Name, Driver: v.Driver, Mountpoint: v.Mountpoint})
+	}
+	return resp, nil
+}
+
+func (n nerdctlClient) VolumeRemove(_ context.Context, volumeID string, force bool) error {
+	args := []string{"volume", "rm"}
+	if force {
+		args = append(args, "-f")
+	}
+	_, err := n.nerdctl(append(args, volumeID)...)
+	return err
+}
+
+func (n nerdctlClient) Close() error {
+	return nil
+}
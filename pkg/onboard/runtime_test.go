@@ -0,0 +1,126 @@
+package onboard
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	dockerContainerTypes "github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/volume"
+)
+
+func TestParseComposeVersion(t *testing.T) {
+	tests := []struct {
+		out  string
+		want string
+	}{
+		{out: "2.29.1\n", want: "2.29.1"},
+		{out: "v2.24.6-desktop.1\n", want: "2.24.6"},
+		{out: ">>>> Executing external compose provider \"/usr/bin/docker-compose\". <<<<\n\n2.27.0\n", want: "2.27.0"},
+		{out: "podman-compose version 1.0.6\npodman version 4.9.4\n", want: "1.0.6"},
+		{out: "error\n", want: ""},
+	}
+	for _, tt := range tests {
+		if got := parseComposeVersion(tt.out); got != tt.want {
+			t.Errorf("parseComposeVersion(%q) = %q, want %q", tt.out, got, tt.want)
+		}
+	}
+}
+
+func TestCompareVersionsAndGetComposeCommand(t *testing.T) {
+	tests := []struct {
+		name, version, cmd, minVersion string
+		wantCmd                        string
+	}{
+		{name: "docker compose", version: "2.29.1", cmd: "docker compose", minVersion: minComposeVersion("docker compose"), wantCmd: "docker compose"},
+		{name: "old docker-compose", version: "1.25.0", cmd: "docker-compose", minVersion: minComposeVersion("docker-compose")},
+		{name: "podman-compose", version: "1.0.6", cmd: "podman-compose", minVersion: minComposeVersion("podman-compose"), wantCmd: "podman-compose"},
+		{name: "nerdctl", version: "1.7.6", cmd: "nerdctl compose", minVersion: minComposeVersion("nerdctl compose"), wantCmd: "nerdctl compose"},
+		{name: "old nerdctl", version: "1.5.0", cmd: "nerdctl compose", minVersion: minComposeVersion("nerdctl compose")},
+	}
+	for _, tt := range tests {
+		got, _ := compareVersionsAndGetComposeCommand(tt.version, tt.cmd, tt.minVersion, "", tt.minVersion)
+		if got != tt.wantCmd {
+			t.Errorf("%s: got command %q, want %q", tt.name, got, tt.wantCmd)
+		}
+	}
+}
+
+func TestComposeWaitSupported(t *testing.T) {
+	tests := []struct {
+		cmd, version string
+		want         bool
+	}{
+		{"docker compose", "v2.29.1", true},
+		{"docker-compose", "v1.29.2", false},
+		{"podman compose", "v2.27.0", true},
+		{"podman-compose", "v1.0.6", false},
+		{"nerdctl compose", "v2.0.0", false},
+	}
+	for _, tt := range tests {
+		if got := composeWaitSupported(tt.cmd, tt.version); got != tt.want {
+			t.Errorf("composeWaitSupported(%s, %s) = %v, want %v", tt.cmd, tt.version, got, tt.want)
+		}
+	}
+}
+
+func TestNerdctlClient(t *testing.T) {
+	outputs := map[string]string{
+		"ps --format {{json .}} -a": `{"ID":"abc","Names":"kubearmor","Image":"docker.io/kubearmor/kubearmor:stable","Status":"Up"}
+{"ID":"def","Names":"spire-agent","Image":"docker.io/accuknox/spire-agent:latest","Status":"Exited (1)"}
+`,
+		"inspect --mode dockercompat def": `[{"Id":"def","Name":"spire-agent","State":{"Status":"exited","ExitCode":1}}]`,
+		"volume ls --format {{json .}}":   `{"Name":"spire-vol","Driver":"local","Labels":"","Mountpoint":"/var/lib/nerdctl/volumes/spire-vol"}` + "\n",
+		"volume rm -f spire-vol":          "",
+		"rm def":                          "",
+		"stop def":                        "",
+	}
+	var calls []string
+	n := nerdctlClient{run: func(args ...string) ([]byte, error) {
+		call := strings.Join(args, " ")
+		calls = append(calls, call)
+		out, ok := outputs[call]
+		if !ok {
+			t.Fatalf("unexpected nerdctl %s", call)
+		}
+		return []byte(out), nil
+	}}
+	ctx := context.Background()
+
+	containers, err := n.ContainerList(ctx, dockerContainerTypes.ListOptions{All: true})
+	if err != nil {
+		t.Fatalf("ContainerList() error = %v", err)
+	}
+	if len(containers) != 2 || containers[1].ID != "def" || containers[1].Names[0] != "spire-agent" {
+		t.Errorf("ContainerList() = %+v", containers)
+	}
+
+	inspect, err := n.ContainerInspect(ctx, "def")
+	if err != nil {
+		t.Fatalf("ContainerInspect() error = %v", err)
+	}
+	if !containerFailed(inspect, spireAgentName) {
+		t.Errorf("exited spire-agent not reported as failed: %+v", inspect.State)
+	}
+
+	volumes, err := n.VolumeList(ctx, volume.ListOptions{})
+	if err != nil {
+		t.Fatalf("VolumeList() error = %v", err)
+	}
+	if len(volumes.Volumes) != 1 || volumes.Volumes[0].Name != "spire-vol" {
+		t.Errorf("VolumeList() = %+v", volumes.Volumes)
+	}
+
+	if err := n.ContainerStop(ctx, "def", dockerContainerTypes.StopOptions{}); err != nil {
+		t.Errorf("ContainerStop() error = %v", err)
+	}
+	if err := n.ContainerRemove(ctx, "def", dockerContainerTypes.RemoveOptions{}); err != nil {
+		t.Errorf("ContainerRemove() error = %v", err)
+	}
+	if err := n.VolumeRemove(ctx, "spire-vol", true); err != nil {
+		t.Errorf("VolumeRemove() error = %v", err)
+	}
+	if len(calls) != len(outputs) {
+		t.Errorf("nerdctl calls = %v", calls)
+	}
+}
@@ -177,7 +177,7 @@ func (cc *ClusterConfig) InstallRRA() error {
 	switch cc.Mode {
 	case VMMode_Docker:
 		var err error
-		cc.composeCmd, cc.composeVersion, err = GetComposeCommand()
+		cc.composeCmd, cc.composeVersion, err = GetComposeCommand(cc.ContainerRuntime)
 		if err != nil {
 			return err
 		}
@@ -0,0 +1,415 @@
+package onboard
+
+import (
+	_ "embed"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xeipuuv/gojsonschema"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	SpecAPIVersion = "onboard.accuknox.com/v1"
+	SpecKind       = "VMOnboarding"
+)
+
+//go:embed templates/vm-onboarding.schema.json
+var specSchema string
+
+// Spec describes the onboarding of a VM node, it is the file form of the
+// flags of "onboard vm cp-node" and "onboard vm node"
+type Spec struct {
+	APIVersion string   `json:"apiVersion"`
+	Kind       string   `json:"kind"`
+	NodeType   NodeType `json:"nodeType"`
+	Mode       VMMode   `json:"mode,omitempty"`
+
+	Version          string `json:"version,omitempty"`
+	ReleaseFile      string `json:"releaseFile,omitempty"`
+	ConfigPath       string `json:"configPath,omitempty"`
+	ControlPlaneAddr string `json:"controlPlaneAddr,omitempty"`
+	VMName           string `json:"vmName,omitempty"`
+
+	Registry      RegistrySpec         `json:"registry,omitempty"`
+	Images        map[string]ImageSpec `json:"images,omitempty"`
+	KubeArmor     KubeArmorSpec        `json:"kubearmor,omitempty"`
+	SummaryEngine SummaryEngineSpec    `json:"summaryEngine,omitempty"`
+	SaaS          SaaSSpec             `json:"saas,omitempty"`
+	Spire         SpireSpec            `json:"spire,omitempty"`
+	RMQ           RMQSpec              `json:"rmq,omitempty"`
+	TLS           TLSSpec              `json:"tls,omitempty"`
+	Splunk        SplunkSpec           `json:"splunk,omitempty"`
+	RRA           RRASpec              `json:"rra,omitempty"`
+	Agents        AgentAddrSpec        `json:"agents,omitempty"`
+	Features      FeatureSpec          `json:"features,omitempty"`
+
+	NetworkCIDR          string `json:"networkCIDR,omitempty"`
+	LogRotate            string `json:"logRotate,omitempty"`
+	NodeStateRefreshTime *int   `json:"nodeStateRefreshTime,omitempty"`
+}
+
+type RegistrySpec struct {
+	Address          string `json:"address,omitempty"`
+	ConfigPath       string `json:"configPath,omitempty"`
+	Insecure         *bool  `json:"insecure,omitempty"`
+	PlainHTTP        *bool  `json:"plainHTTP,omitempty"`
+	PreserveUpstream *bool  `json:"preserveUpstream,omitempty"`
+	PullPolicy       string `json:"pullPolicy,omitempty"`
+	Parallel         *int   `json:"parallel,omitempty"`
+}
+
+type ImageSpec struct {
+	Image string `json:"image,omitempty"`
+	Tag   string `json:"tag,omitempty"`
+}
+
+type KubeArmorSpec struct {
+	Visibility        string `json:"visibility,omitempty"`
+	HostVisibility    string `json:"hostVisibility,omitempty"`
+	Audit             string `json:"audit,omitempty"`
+	Block             string `json:"block,omitempty"`
+	HostAudit         string `json:"hostAudit,omitempty"`
+	HostBlock         string `json:"hostBlock,omitempty"`
+	AlertThrottling   *bool  `json:"alertThrottling,omitempty"`
+	MaxAlertsPerSec   *int   `json:"maxAlertsPerSec,omitempty"`
+	ThrottleSec       *int   `json:"throttleSec,omitempty"`
+	SecureContainers  *bool  `json:"secureContainers,omitempty"`
+	SkipBTFCheck      *bool  `json:"skipBTFCheck,omitempty"`
+	SystemMonitorPath string `json:"systemMonitorPath,omitempty"`
+}
+
+type SummaryEngineSpec struct {
+	Deploy     *bool  `json:"deploy,omitempty"`
+	Visibility string `json:"visibility,omitempty"`
+	CronTime   string `json:"cronTime,omitempty"`
+}
+
+type SaaSSpec struct {
+	PPSHost     string        `json:"ppsHost,omitempty"`
+	KnoxGateway string        `json:"knoxGateway,omitempty"`
+	EnableLogs  *bool         `json:"enableLogs,omitempty"`
+	JoinToken   string        `json:"joinToken,omitempty"`
+	AccessKey   AccessKeySpec `json:"accessKey,omitempty"`
+}
+
+type AccessKeySpec struct {
+	Key      string `json:"key,omitempty"`
+	URL      string `json:"url,omitempty"`
+	Endpoint string `json:"endpoint,omitempty"`
+}
+
+type SpireSpec struct {
+	Host           string `json:"host,omitempty"`
+	TrustBundleURL string `json:"trustBundleURL,omitempty"`
+	Enabled        *bool  `json:"enabled,omitempty"`
+	Cert           *bool  `json:"cert,omitempty"`
+}
+
+type RMQSpec struct {
+	Deploy         *bool  `json:"deploy,omitempty"`
+	Address        string `json:"address,omitempty"`
+	ConnectionName string `json:"connectionName,omitempty"`
+	TopicPrefix    string `json:"topicPrefix,omitempty"`
+}
+
+type TLSSpec struct {
+	Enabled      *bool    `json:"enabled,omitempty"`
+	Generate     *bool    `json:"generate,omitempty"`
+	CaPath       string   `json:"caPath,omitempty"`
+	CaCert       string   `json:"caCert,omitempty"`
+	Credentials  string   `json:"credentials,omitempty"`
+	Organization []string `json:"organization,omitempty"`
+	CommonName   string   `json:"commonName,omitempty"`
+	IPs          []string `json:"ips,omitempty"`
+	DNS          []string `json:"dns,omitempty"`
+}
+
+type SplunkSpec struct {
+	Enabled     *bool  `json:"enabled,omitempty"`
+	URL         string `json:"url,omitempty"`
+	Token       string `json:"token,omitempty"`
+	Index       string `json:"index,omitempty"`
+	Source      string `json:"source,omitempty"`
+	SourceType  string `json:"sourceType,omitempty"`
+	Certificate string `json:"certificate,omitempty"`
+	SkipTLS     *bool  `json:"skipTLS,omitempty"`
+}
+
+type RRASpec struct {
+	Enabled     *bool  `json:"enabled,omitempty"`
+	Profile     string `json:"profile,omitempty"`
+	Benchmark   string `json:"benchmark,omitempty"`
+	Schedule    string `json:"schedule,omitempty"`
+	AuthToken   string `json:"authToken,omitempty"`
+	URL         string `json:"url,omitempty"`
+	TenantID    string `json:"tenantID,omitempty"`
+	ClusterName string `json:"clusterName,omitempty"`
+	ClusterID   string `json:"clusterID,omitempty"`
+	Label       string `json:"label,omitempty"`
+}
+
+// AgentAddrSpec are the addresses of the control plane agents for worker
+// nodes which don't reach them through controlPlaneAddr
+type AgentAddrSpec struct {
+	KubeArmor   string `json:"kubearmor,omitempty"`
+	RelayServer string `json:"relayServer,omitempty"`
+	SIA         string `json:"sia,omitempty"`
+	PEA         string `json:"pea,omitempty"`
+	Harden      string `json:"harden,omitempty"`
+}
+
+type FeatureSpec struct {
+	HostPolicyDiscovery *bool `json:"hostPolicyDiscovery,omitempty"`
+	HardeningAgent      *bool `json:"hardeningAgent,omitempty"`
+}
+
+// specImages maps the components of the images section to their image and
+// tag flags, an empty tag flag means the tag is part of the image
+var specImages = map[string]struct{ image, tag string }{
+	"kubearmor":      {"kubearmor-image", "kubearmor-version"},
+	"kubearmorInit":  {"kubearmor-init-image", ""},
+	"vmAdapter":      {"kubearmor-vm-adapter-image", "vm-adapter-tag"},
+	"relayServer":    {"kubearmor-relay-server", "relayserver-version"},
+	"sia":            {"sia-image", "sia-version"},
+	"pea":            {"pea-image", "pea-version"},
+	"feeder":         {"feeder-image", "feeder-version"},
+	"discover":       {"discover-image", "discover-version"},
+	"sumEngine":      {"sumengine-image", "sumengine-version"},
+	"hardeningAgent": {"hardening-agent-image", "hardening-agent-version"},
+	"rmq":            {"rmq-image", ""},
+	"spireAgent":     {"spire-agent-image", ""},
+	"waitForIt":      {"wait-for-it-image", ""},
+	"rra":            {"rra-image", "rra-tag"},
+}
+
+// LoadSpec reads an onboarding spec in YAML or JSON format and validates it
+// against the schema
+func LoadSpec(path string) (*Spec, error) {
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, fmt.Errorf("error reading spec: %v", err)
+	}
+	spec, err := ParseSpec(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid spec %s: %v", path, err)
+	}
+	return spec, nil
+}
+
+// ParseSpec parses and validates an onboarding spec
+func ParseSpec(data []byte) (*Spec, error) {
+	doc, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := gojsonschema.Validate(gojsonschema.NewStringLoader(specSchema), gojsonschema.NewBytesLoader(doc))
+	if err != nil {
+		return nil, err
+	}
+	if !result.Valid() {
+		var errs []string
+		for _, e := range result.Errors() {
+			switch e.(type) {
+			case *gojsonschema.ConditionThenError, *gojsonschema.ConditionElseError, *gojsonschema.NumberNotError:
+				// the node type conditions, reported by the errors below
+			case *gojsonschema.InvalidPropertyNameError:
+				errs = append(errs, fmt.Sprintf("%s.%v is not supported for this node type", e.Field(), e.Details()["property"]))
+			case *gojsonschema.FalseError:
+				errs = append(errs, fmt.Sprintf("%s is not supported for this node type", e.Field()))
+			default:
+				errs = append(errs, e.String())
+			}
+		}
+		return nil, fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+
+	spec := new(Spec)
+	if err := yaml.UnmarshalStrict(doc, spec); err != nil {
+		return nil, err
+	}
+	if err := spec.Validate(); err != nil {
+		return nil, err
+	}
+	return spec, nil
+}
+
+// Validate checks the values the schema can't
+func (s *Spec) Validate() error {
+	for name, image := range s.Images {
+		if image.Tag != "" && specImages[name].tag == "" {
+			return fmt.Errorf("images.%s: tag is not supported, set the tag in the image", name)
+		}
+	}
+	if s.SummaryEngine.CronTime != "" {
+		if _, err := time.ParseDuration(s.SummaryEngine.CronTime); err != nil {
+			return fmt.Errorf("summaryEngine.cronTime: %v", err)
+		}
+	}
+	if s.NetworkCIDR != "" {
+		if _, _, err := net.ParseCIDR(s.NetworkCIDR); err != nil {
+			return fmt.Errorf("networkCIDR: %v", err)
+		}
+	}
+	if s.TLS.CaPath != "" && s.TLS.Generate != nil && *s.TLS.Generate {
+		return fmt.Errorf("tls.caPath and tls.generate are mutually exclusive")
+	}
+	return nil
+}
+
+// SpecFlag is the value of a command line flag taken from a spec field
+type SpecFlag struct {
+	Field  string
+	Name   string
+	Values []string
+}
+
+type specFlags []SpecFlag
+
+func (f *specFlags) str(field, name, value string) {
+	if value != "" {
+		*f = append(*f, SpecFlag{Field: field, Name: name, Values: []string{value}})
+	}
+}
+
+func (f *specFlags) boolean(field, name string, value *bool) {
+	if value != nil {
+		f.str(field, name, strconv.FormatBool(*value))
+	}
+}
+
+func (f *specFlags) integer(field, name string, value *int) {
+	if value != nil {
+		f.str(field, name, strconv.Itoa(*value))
+	}
+}
+
+func (f *specFlags) list(field, name string, values []string) {
+	if len(values) > 0 {
+		*f = append(*f, SpecFlag{Field: field, Name: name, Values: values})
+	}
+}
+
+// Flags returns the flags of the onboarding commands set by the spec. Access
+// key flags are named license-key* for worker nodes.
+func (s *Spec) Flags() []SpecFlag {
+	var f specFlags
+
+	f.str("mode", "vm-mode", string(s.Mode))
+	f.str("version", "version", s.Version)
+	f.str("releaseFile", "release-file", s.ReleaseFile)
+	f.str("configPath", "config-path", s.ConfigPath)
+	f.str("controlPlaneAddr", "cp-node-addr", s.ControlPlaneAddr)
+	f.str("vmName", "vm-name", s.VMName)
+
+	f.str("registry.address", "registry", s.Registry.Address)
+	f.str("registry.configPath", "registry-config-path", s.Registry.ConfigPath)
+	f.boolean("registry.insecure", "insecure", s.Registry.Insecure)
+	f.boolean("registry.plainHTTP", "plain-http", s.Registry.PlainHTTP)
+	f.boolean("registry.preserveUpstream", "preserve-upstream-repo", s.Registry.PreserveUpstream)
+	f.str("registry.pullPolicy", "image-pull-policy", s.Registry.PullPolicy)
+	f.integer("registry.parallel", "parallel", s.Registry.Parallel)
+
+	names := make([]string, 0, len(s.Images))
+	for name := range s.Images {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		image, flags := s.Images[name], specImages[name]
+		f.str("images."+name+".image", flags.image, image.Image)
+		f.str("images."+name+".tag", flags.tag, image.Tag)
+	}
+
+	ka := s.KubeArmor
+	f.str("kubearmor.visibility", "viz", ka.Visibility)
+	f.str("kubearmor.hostVisibility", "host-viz", ka.HostVisibility)
+	f.str("kubearmor.audit", "audit", ka.Audit)
+	f.str("kubearmor.block", "block", ka.Block)
+	f.str("kubearmor.hostAudit", "host-audit", ka.HostAudit)
+	f.str("kubearmor.hostBlock", "host-block", ka.HostBlock)
+	f.boolean("kubearmor.alertThrottling", "alert-throttling", ka.AlertThrottling)
+	f.integer("kubearmor.maxAlertsPerSec", "max-alerts-per-sec", ka.MaxAlertsPerSec)
+	f.integer("kubearmor.throttleSec", "throttle-sec", ka.ThrottleSec)
+	f.boolean("kubearmor.secureContainers", "secure-containers", ka.SecureContainers)
+	f.boolean("kubearmor.skipBTFCheck", "skip-btf-check", ka.SkipBTFCheck)
+	f.str("kubearmor.systemMonitorPath", "system-monitor-path", ka.SystemMonitorPath)
+
+	f.boolean("summaryEngine.deploy", "deploy-summary-engine", s.SummaryEngine.Deploy)
+	f.str("summaryEngine.visibility", "sumengine-viz", s.SummaryEngine.Visibility)
+	f.str("summaryEngine.cronTime", "sumengine-cron-time", s.SummaryEngine.CronTime)
+
+	accessKey := "access-key"
+	if s.NodeType == NodeType_WorkerNode {
+		accessKey = "license-key"
+	}
+	f.str("saas.ppsHost", "pps-host", s.SaaS.PPSHost)
+	f.str("saas.knoxGateway", "knox-gateway", s.SaaS.KnoxGateway)
+	f.boolean("saas.enableLogs", "enable-logs", s.SaaS.EnableLogs)
+	f.str("saas.joinToken", "join-token", s.SaaS.JoinToken)
+	f.str("saas.accessKey.key", accessKey, s.SaaS.AccessKey.Key)
+	f.str("saas.accessKey.url", accessKey+"-url", s.SaaS.AccessKey.URL)
+	f.str("saas.accessKey.endpoint", accessKey+"-endpoint", s.SaaS.AccessKey.Endpoint)
+
+	f.str("spire.host", "spire-host", s.Spire.Host)
+	f.str("spire.trustBundleURL", "spire-trust-bundle-addr", s.Spire.TrustBundleURL)
+	f.boolean("spire.enabled", "spire", s.Spire.Enabled)
+	f.boolean("spire.cert", "spire-cert", s.Spire.Cert)
+
+	f.boolean("rmq.deploy", "deploy-rmq", s.RMQ.Deploy)
+	f.str("rmq.address", "rmq-address", s.RMQ.Address)
+	f.str("rmq.connectionName", "rmq-connection-name", s.RMQ.ConnectionName)
+	f.str("rmq.topicPrefix", "cp-name", s.RMQ.TopicPrefix)
+
+	f.boolean("tls.enabled", "tls", s.TLS.Enabled)
+	f.boolean("tls.generate", "tls-gen", s.TLS.Generate)
+	f.str("tls.caPath", "ca-path", s.TLS.CaPath)
+	f.str("tls.caCert", "ca-cert", s.TLS.CaCert)
+	f.str("tls.credentials", "auth", s.TLS.Credentials)
+	f.list("tls.organization", "tls-org", s.TLS.Organization)
+	f.str("tls.commonName", "tls-cn", s.TLS.CommonName)
+	f.list("tls.ips", "ips", s.TLS.IPs)
+	f.list("tls.dns", "dns", s.TLS.DNS)
+
+	f.boolean("splunk.enabled", "splunk", s.Splunk.Enabled)
+	f.str("splunk.url", "splunk-url", s.Splunk.URL)
+	f.str("splunk.token", "splunk-token", s.Splunk.Token)
+	f.str("splunk.index", "splunk-index", s.Splunk.Index)
+	f.str("splunk.source", "splunk-source", s.Splunk.Source)
+	f.str("splunk.sourceType", "splunk-sourcetype", s.Splunk.SourceType)
+	f.str("splunk.certificate", "splunk-cert", s.Splunk.Certificate)
+	f.boolean("splunk.skipTLS", "splunk-skip-tls", s.Splunk.SkipTLS)
+
+	f.boolean("rra.enabled", "enable-vmscan", s.RRA.Enabled)
+	f.str("rra.profile", "profile", s.RRA.Profile)
+	f.str("rra.benchmark", "benchmark", s.RRA.Benchmark)
+	f.str("rra.schedule", "schedule", s.RRA.Schedule)
+	f.str("rra.authToken", "auth-token", s.RRA.AuthToken)
+	f.str("rra.url", "url", s.RRA.URL)
+	f.str("rra.tenantID", "tenant-id", s.RRA.TenantID)
+	f.str("rra.clusterName", "cluster-name", s.RRA.ClusterName)
+	f.str("rra.clusterID", "cluster-id", s.RRA.ClusterID)
+	f.str("rra.label", "label", s.RRA.Label)
+
+	f.str("agents.kubearmor", "kubearmor-addr", s.Agents.KubeArmor)
+	f.str("agents.relayServer", "relay-server-addr", s.Agents.RelayServer)
+	f.str("agents.sia", "sia-addr", s.Agents.SIA)
+	f.str("agents.pea", "pea-addr", s.Agents.PEA)
+	f.str("agents.harden", "harden-addr", s.Agents.Harden)
+
+	f.boolean("features.hostPolicyDiscovery", "enable-host-policy-discovery", s.Features.HostPolicyDiscovery)
+	f.boolean("features.hardeningAgent", "enable-hardening-agent", s.Features.HardeningAgent)
+
+	f.str("networkCIDR", "network-cidr", s.NetworkCIDR)
+	f.str("logRotate", "log-rotate", s.LogRotate)
+	f.integer("nodeStateRefreshTime", "node-state-refresh-time", s.NodeStateRefreshTime)
+
+	return f
+}
@@ -0,0 +1,149 @@
+package onboard
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testSpec = `
+apiVersion: onboard.accuknox.com/v1
+kind: VMOnboarding
+nodeType: control-plane
+mode: systemd
+version: v0.10.0
+registry:
+  pullPolicy: missing
+  preserveUpstream: false
+images:
+  kubearmor:
+    tag: v1.5.0
+  sia:
+    image: registry.local/sia:dev
+kubearmor:
+  block: file,network
+  alertThrottling: false
+saas:
+  ppsHost: pps.accuknox.com
+  accessKey:
+    key: abc
+    url: cwpp.accuknox.com
+spire:
+  host: spire.accuknox.com
+tls:
+  enabled: true
+  ips: [10.0.0.1, 10.0.0.2]
+`
+
+func TestParseSpec(t *testing.T) {
+	spec, err := ParseSpec([]byte(testSpec))
+	if err != nil {
+		t.Fatalf("ParseSpec() error = %v", err)
+	}
+
+	got := make(map[string][]string)
+	for _, f := range spec.Flags() {
+		got[f.Name] = f.Values
+	}
+	want := map[string][]string{
+		"vm-mode":                {"systemd"},
+		"version":                {"v0.10.0"},
+		"image-pull-policy":      {"missing"},
+		"preserve-upstream-repo": {"false"},
+		"kubearmor-version":      {"v1.5.0"},
+		"sia-image":              {"registry.local/sia:dev"},
+		"block":                  {"file,network"},
+		"alert-throttling":       {"false"},
+		"pps-host":               {"pps.accuknox.com"},
+		"access-key":             {"abc"},
+		"access-key-url":         {"cwpp.accuknox.com"},
+		"spire-host":             {"spire.accuknox.com"},
+		"tls":                    {"true"},
+		"ips":                    {"10.0.0.1", "10.0.0.2"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Flags() = %v, want %v", got, want)
+	}
+
+	worker := strings.Replace(testSpec, "control-plane", "worker-node", 1)
+	worker = strings.Replace(worker, "  ppsHost: pps.accuknox.com\n", "", 1)
+	worker = strings.Replace(worker, "  sia:\n    image: registry.local/sia:dev\n", "", 1)
+	spec, err = ParseSpec([]byte(worker))
+	if err != nil {
+		t.Fatalf("ParseSpec(worker) error = %v", err)
+	}
+	for _, f := range spec.Flags() {
+		if strings.HasPrefix(f.Name, "access-key") {
+			t.Errorf("worker node spec sets %s, want license-key flags", f.Name)
+		}
+	}
+}
+
+func TestParseSpecInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		old     string
+		new     string
+		wantErr string
+	}{
+		{"api version", "onboard.accuknox.com/v1", "onboard.accuknox.com/v2", "apiVersion"},
+		{"unknown field", "mode: systemd", "mode: systemd\nvmMode: docker", "vmMode"},
+		{"mode", "mode: systemd", "mode: podman", "mode"},
+		{"posture", "block: file,network", "block: file,process", "kubearmor.block"},
+		{"type", "alertThrottling: false", "alertThrottling: \"no\"", "alertThrottling"},
+		{"worker only field", "enabled: true", "enabled: true\n  caCert: Y2E=", "caCert"},
+		{"cp only field", "nodeType: control-plane", "nodeType: worker-node", "ppsHost"},
+		{"rra", "mode: systemd", "mode: systemd\nrra:\n  enabled: true", "profile"},
+		{"tag", "  sia:\n", "  rmq:\n    tag: v1\n  sia:\n", "images.rmq: tag is not supported"},
+		{"tls", "enabled: true", "enabled: true\n  generate: true\n  caPath: /ca.pem", "mutually exclusive"},
+		{"cron time", "mode: systemd", "mode: systemd\nsummaryEngine:\n  cronTime: 15", "cronTime"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := strings.Replace(testSpec, tt.old, tt.new, 1)
+			_, err := ParseSpec([]byte(data))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ParseSpec() error = %v, want it to mention %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// every field of the spec must be in the schema, or it is rejected as an
+// additional property
+func TestSpecSchemaFields(t *testing.T) {
+	var schema struct {
+		Properties map[string]json.RawMessage `json:"properties"`
+	}
+	if err := json.Unmarshal([]byte(specSchema), &schema); err != nil {
+		t.Fatalf("invalid schema: %v", err)
+	}
+
+	typ := reflect.TypeOf(Spec{})
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		prop, ok := schema.Properties[name]
+		if !ok {
+			t.Errorf("%s is missing in the schema", name)
+			continue
+		}
+		if field.Type.Kind() != reflect.Struct {
+			continue
+		}
+
+		var section struct {
+			Properties map[string]json.RawMessage `json:"properties"`
+		}
+		if err := json.Unmarshal(prop, &section); err != nil {
+			t.Fatalf("invalid schema of %s: %v", name, err)
+		}
+		for j := 0; j < field.Type.NumField(); j++ {
+			sub := strings.Split(field.Type.Field(j).Tag.Get("json"), ",")[0]
+			if _, ok := section.Properties[sub]; !ok {
+				t.Errorf("%s.%s is missing in the schema", name, sub)
+			}
+		}
+	}
+}
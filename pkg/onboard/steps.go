@@ -0,0 +1,564 @@
+package onboard
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	cm "github.com/accuknox/accuknox-cli-v2/pkg/common"
+	"github.com/accuknox/accuknox-cli-v2/pkg/logger"
+	dockerContainerTypes "github.com/docker/docker/api/types/container"
+)
+
+// OnboardStep is a named step of onboarding a node
+type OnboardStep string
+
+const (
+	Step_ValidateEnv    OnboardStep = "validate-env"
+	Step_TLS            OnboardStep = "tls"
+	Step_GenerateConfig OnboardStep = "generate-config"
+	Step_PullImages     OnboardStep = "pull-images"
+	Step_Install        OnboardStep = "install"
+	Step_WaitHealthy    OnboardStep = "wait-healthy"
+)
+
+const (
+	StepStatus_Started   = "started"
+	StepStatus_Completed = "completed"
+	StepStatus_Skipped   = "skipped"
+	StepStatus_Failed    = "failed"
+)
+
+// healthTimeout is how long the agents have to become healthy after they are
+// started
+var healthTimeout = 2 * time.Minute
+
+// healthInterval is how often the agents are checked while waiting for them
+var healthInterval = 2 * time.Second
+
+// StepOptions select the steps of onboarding to run. By default, onboarding
+// resumes from the step which failed in the previous run.
+type StepOptions struct {
+	// FromStep runs the steps from this one
+	FromStep OnboardStep
+	// OnlyStep runs this step only
+	OnlyStep OnboardStep
+	// Events receives the progress of every step as JSON lines
+	Events io.Writer
+}
+
+// StepEvent is the progress of a step
+type StepEvent struct {
+	Time     time.Time   `json:"time"`
+	NodeType NodeType    `json:"node_type"`
+	Step     OnboardStep `json:"step"`
+	Index    int         `json:"index"`
+	Total    int         `json:"total"`
+	Status   string      `json:"status"`
+	Duration string      `json:"duration,omitempty"`
+	Error    string      `json:"error,omitempty"`
+}
+
+// onboardState is the progress of onboarding persisted between runs
+type onboardState struct {
+	NodeType NodeType `json:"node_type"`
+	Mode     VMMode   `json:"mode"`
+	// Next is the step to resume from, the failed one if any
+	Next      OnboardStep `json:"next,omitempty"`
+	Error     string      `json:"error,omitempty"`
+	UpdatedAt time.Time   `json:"updated_at"`
+	// RMQCredentials and CACert of a control plane are reused when resuming,
+	// the configs generated in the previous run use them
+	RMQCredentials string `json:"rmq_credentials,omitempty"`
+	CACert         string `json:"ca_cert,omitempty"`
+}
+
+type onboardStep struct {
+	name OnboardStep
+	run  func() error
+}
+
+// stepRunner runs the steps of onboarding a node and persists its progress
+type stepRunner struct {
+	nodeType  NodeType
+	mode      VMMode
+	opts      StepOptions
+	statePath string
+	// dryRun runs the steps without persisting the progress
+	dryRun bool
+	// record adds the outputs of the steps to the persisted progress
+	record func(state *onboardState)
+}
+
+// onboardStatePath returns where the progress of onboarding is persisted,
+// next to the stored knoxctl config
+func onboardStatePath(mode VMMode) (string, error) {
+	if mode == VMMode_Systemd {
+		return filepath.Join(cm.SystemdKnoxctlDir, cm.OnboardStateFilename), nil
+	}
+	configPath, err := cm.GetDefaultConfigPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configPath, cm.OnboardStateFilename), nil
+}
+
+// newStepRunner returns the runner of the steps of onboarding a node
+func (cc *ClusterConfig) newStepRunner(nodeType NodeType, opts StepOptions) (stepRunner, error) {
+	statePath, err := onboardStatePath(cc.Mode)
+	if err != nil {
+		return stepRunner{}, err
+	}
+	return stepRunner{nodeType: nodeType, mode: cc.Mode, opts: opts, statePath: statePath, dryRun: cc.DryRun}, nil
+}
+
+// runOnboardSteps runs the steps of onboarding a node in the given mode
+func (cc *ClusterConfig) runOnboardSteps(nodeType NodeType, opts StepOptions, steps []onboardStep) error {
+	r, err := cc.newStepRunner(nodeType, opts)
+	if err != nil {
+		return err
+	}
+	if nodeType == NodeType_ControlPlane {
+		r.record = func(state *onboardState) {
+			state.RMQCredentials = cc.RMQCredentials
+			state.CACert = cc.CaCert
+		}
+	}
+	return r.run(steps)
+}
+
+// savedOnboardState returns the progress of onboarding the node persisted by a
+// previous run, an empty one if there is none
+func (cc *ClusterConfig) savedOnboardState(nodeType NodeType) onboardState {
+	r, err := cc.newStepRunner(nodeType, StepOptions{})
+	if err != nil {
+		return onboardState{NodeType: nodeType, Mode: cc.Mode}
+	}
+	return r.loadState()
+}
+
+// runsStep returns whether running the steps of onboarding the node runs the
+// named one, given the selected steps and the persisted progress
+func (cc *ClusterConfig) runsStep(nodeType NodeType, opts StepOptions, steps []onboardStep, name OnboardStep) bool {
+	r, err := cc.newStepRunner(nodeType, opts)
+	if err != nil {
+		return true
+	}
+	start, end, err := r.selectSteps(steps, r.loadState())
+	if err != nil {
+		// the steps are not run at all
+		return true
+	}
+	for _, s := range steps[start:end] {
+		if s.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// storedControlPlane returns the control plane config stored by a previous
+// onboarding in the same mode, nil if there is none
+func (cc *ClusterConfig) storedControlPlane() *InitConfig {
+	path := filepath.Join(cm.SystemdKnoxctlDir, cm.KnoxctlConfigFilename)
+	if cc.Mode != VMMode_Systemd {
+		configPath, err := cm.GetDefaultConfigPath()
+		if err != nil {
+			return nil
+		}
+		path = filepath.Join(configPath, cm.KnoxctlConfigFilename)
+	}
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil
+	}
+	node, err := loadUpgradeNode(data)
+	if err != nil {
+		logger.Warn("Ignoring the stored config at %s: %s", path, err.Error())
+		return nil
+	}
+	ic, _ := node.(*InitConfig)
+	return ic
+}
+
+// selectSteps returns the range of the steps to run, the selected ones or
+// the ones from the persisted progress
+func (r *stepRunner) selectSteps(steps []onboardStep, state onboardState) (start, end int, err error) {
+	index := func(name OnboardStep) (int, error) {
+		var names []string
+		for i, s := range steps {
+			if s.name == name {
+				return i, nil
+			}
+			names = append(names, string(s.name))
+		}
+		return 0, fmt.Errorf("step %s invalid, accepted values (%s)", name, strings.Join(names, "/"))
+	}
+
+	start, end = 0, len(steps)
+	switch {
+	case r.opts.OnlyStep != "":
+		i, err := index(r.opts.OnlyStep)
+		if err != nil {
+			return 0, 0, err
+		}
+		start, end = i, i+1
+	case r.opts.FromStep != "":
+		i, err := index(r.opts.FromStep)
+		if err != nil {
+			return 0, 0, err
+		}
+		start = i
+	case state.Next != "":
+		if i, err := index(state.Next); err == nil {
+			start = i
+		}
+	}
+	return start, end, nil
+}
+
+func (r *stepRunner) run(steps []onboardStep) error {
+	state := r.loadState()
+	start, end, err := r.selectSteps(steps, state)
+	if err != nil {
+		return err
+	}
+	if r.opts.OnlyStep == "" && r.opts.FromStep == "" && state.Next != "" && steps[start].name == state.Next {
+		logger.Info1("Resuming onboarding from step %s", state.Next)
+		if state.Error != "" {
+			logger.Info1("It failed in the previous run: %s", firstErrorLine(state.Error))
+		}
+	}
+	if r.opts.OnlyStep == "" {
+		state.Next = steps[start].name
+	}
+
+	for i, s := range steps[:end] {
+		event := StepEvent{NodeType: r.nodeType, Step: s.name, Index: i + 1, Total: len(steps)}
+		if i < start {
+			event.Status = StepStatus_Skipped
+			r.emit(event)
+			continue
+		}
+
+		logger.Info2("\n[%d/%d] %s", i+1, len(steps), s.name)
+		event.Status = StepStatus_Started
+		r.emit(event)
+
+		begin := time.Now()
+		err := s.run()
+		event.Duration = time.Since(begin).Round(time.Millisecond).String()
+		if err != nil {
+			event.Status = StepStatus_Failed
+			event.Error = err.Error()
+			r.emit(event)
+
+			state.Next = s.name
+			state.Error = err.Error()
+			r.saveState(state)
+			return fmt.Errorf("step %s failed: %v\nFix the issue and rerun the command to resume from this step", s.name, err)
+		}
+		event.Status = StepStatus_Completed
+		r.emit(event)
+
+		if state.Next == s.name {
+			state.Next = ""
+			if i+1 < len(steps) {
+				state.Next = steps[i+1].name
+			}
+			state.Error = ""
+		}
+		r.saveState(state)
+	}
+	return nil
+}
+
+// loadState returns the persisted progress of onboarding the same kind of
+// node, an empty one if there is none
+func (r *stepRunner) loadState() onboardState {
+	empty := onboardState{NodeType: r.nodeType, Mode: r.mode}
+
+	data, err := os.ReadFile(filepath.Clean(r.statePath))
+	if err != nil {
+		return empty
+	}
+	var state onboardState
+	if err := json.Unmarshal(data, &state); err != nil {
+		logger.Warn("Ignoring the onboarding progress at %s: %s", r.statePath, err.Error())
+		return empty
+	}
+	if state.NodeType != r.nodeType || state.Mode != r.mode {
+		return empty
+	}
+	return state
+}
+
+// saveState persists the progress, it is removed once every step completed
+func (r *stepRunner) saveState(state onboardState) {
+	if r.dryRun {
+		return
+	}
+	if state.Next == "" {
+		if err := os.Remove(r.statePath); err != nil && !os.IsNotExist(err) {
+			logger.Warn("Failed to remove the onboarding progress at %s: %s", r.statePath, err.Error())
+		}
+		return
+	}
+
+	if r.record != nil {
+		r.record(&state)
+	}
+	state.UpdatedAt = time.Now()
+	data, err := json.Marshal(state)
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(r.statePath), 0o755) // #nosec G301 same perms as the config dir
+	}
+	if err == nil {
+		// the progress holds the RabbitMQ credentials
+		err = os.WriteFile(r.statePath, data, 0o600)
+	}
+	if err == nil {
+		err = os.Chmod(r.statePath, 0o600)
+	}
+	if err != nil {
+		logger.Warn("Failed to save the onboarding progress at %s: %s", r.statePath, err.Error())
+	}
+}
+
+func (r *stepRunner) emit(event StepEvent) {
+	if r.opts.Events == nil {
+		return
+	}
+	event.Time = time.Now()
+	if err := json.NewEncoder(r.opts.Events).Encode(event); err != nil {
+		logger.Warn("Failed to write the progress of step %s: %s", event.Step, err.Error())
+	}
+}
+
+func firstErrorLine(s string) string {
+	return strings.SplitN(s, "\n", 2)[0]
+}
+
+// composeFileArgs returns the args selecting the compose file and the
+// profiles of the node
+func composeFileArgs(node upgradeNode) []string {
+	args := []string{"-f", filepath.Join(node.templateArgs().ConfigPath, composeFileName)}
+	for _, profile := range node.composeProfiles() {
+		args = append(args, "--profile", profile)
+	}
+	if parallel := node.clusterConfig().Parallel; parallel > 0 {
+		args = append(args, "--parallel", fmt.Sprintf("%v", parallel))
+	}
+	return args
+}
+
+// composeSteps returns the steps pulling, starting and waiting for the agents
+// of a node in docker mode. The volumes are removed if the agents fail to
+// start.
+func composeSteps(node upgradeNode, nodeType NodeType, volumes []string) []onboardStep {
+	cc := node.clusterConfig()
+	return []onboardStep{
+		{name: Step_PullImages, run: func() error {
+			if cc.ImagePullPolicy == ImagePullPolicy_Never {
+				logger.Print("Image pull policy is %s, skipping", cc.ImagePullPolicy)
+				return nil
+			}
+			composeCmd, err := cc.composeCommand()
+			if err != nil {
+				return err
+			}
+			_, err = ExecComposeCommand(true, cc.DryRun, composeCmd, append(composeFileArgs(node), "pull")...)
+			return err
+		}},
+		{name: Step_Install, run: func() error {
+			composeCmd, err := cc.composeCommand()
+			if err != nil {
+				return err
+			}
+			args := append(composeFileArgs(node), "up", "-d")
+			wait := composeWaitSupported(composeCmd, cc.composeVersion)
+			if wait {
+				args = append(args, "--wait", "--wait-timeout", "60")
+			}
+			_, err = ExecComposeCommand(true, cc.DryRun, composeCmd, args...)
+			if err == nil {
+				return nil
+			}
+			// cleanup volumes
+			args = append([]string{"volume", "rm"}, volumes...)
+			if _, volDelErr := ExecDockerCommand(true, false, cc.ContainerRuntime.cli(), args...); volDelErr != nil {
+				fmt.Println("Error while removing volumes:", volDelErr.Error())
+			}
+			if wait {
+				return diagnoseError(cc.ContainerRuntime, nodeType, err)
+			}
+			return err
+		}},
+		{name: Step_WaitHealthy, run: func() error {
+			if cc.DryRun {
+				return nil
+			}
+			client, err := CreateContainerClient(cc.ContainerRuntime)
+			if err != nil {
+				return fmt.Errorf("Failed to create %s client. %s", cc.ContainerRuntime.cli(), err.Error())
+			}
+			defer client.Close()
+
+			err = waitContainers(client, healthContainers(nodeType), healthTimeout, healthInterval)
+			if err != nil {
+				return diagnoseError(cc.ContainerRuntime, nodeType, err)
+			}
+			return nil
+		}},
+	}
+}
+
+// diagnoseError adds the diagnosis of the failed containers to an error
+func diagnoseError(runtime ContainerRuntime, nodeType NodeType, err error) error {
+	diagnosisResult, diagErr := diagnose(runtime, nodeType)
+	if diagErr != nil {
+		diagnosisResult = diagErr.Error()
+	}
+	return fmt.Errorf("Error: %s.\n\nDIAGNOSIS:\n%s", err.Error(), diagnosisResult)
+}
+
+// composeCommand returns the compose command found while validating the
+// environment, looking it up if that step was skipped
+func (cc *ClusterConfig) composeCommand() (string, error) {
+	if cc.composeCmd != "" {
+		return cc.composeCmd, nil
+	}
+	runtime, err := DetectContainerRuntime(cc.ContainerRuntime)
+	if err != nil {
+		return "", err
+	}
+	cc.ContainerRuntime = runtime
+	cc.composeCmd, cc.composeVersion, err = GetComposeCommand(runtime)
+	return cc.composeCmd, err
+}
+
+// healthContainers returns the containers of a node to wait for, the ones
+// not deployed are ignored
+func healthContainers(nodeType NodeType) []string {
+	if nodeType == NodeType_WorkerNode {
+		return append(append([]string{}, workerNodePriorityList...), summaryEngineName)
+	}
+	return append(append([]string{}, cpNodePriorityList...), summaryEngineName, discoveryName, hardeningAgentName)
+}
+
+// containerReady checks if a container is running and healthy, or exited
+// successfully for the ones expected to exit
+func containerReady(container dockerContainerTypes.InspectResponse, name string) bool {
+	if container.ContainerJSONBase == nil || container.State == nil {
+		return false
+	}
+	state := container.State
+	switch state.Status {
+	case "running":
+		return state.Health == nil || state.Health.Status == "" || state.Health.Status == "healthy"
+	case "exited":
+		return state.ExitCode == 0 && (name == waitForItName || name == kubeArmorInitName)
+	}
+	return false
+}
+
+// waitContainers waits until the given containers which exist are ready, it
+// fails as soon as one of them failed
+func waitContainers(client ContainerClient, names []string, timeout, interval time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		list, err := client.ContainerList(context.Background(), dockerContainerTypes.ListOptions{All: true})
+		if err != nil {
+			return fmt.Errorf("Failed to list containers. %s", err.Error())
+		}
+		ids := make(map[string]string)
+		for _, c := range list {
+			if len(c.Names) > 0 {
+				ids[strings.TrimPrefix(c.Names[0], "/")] = c.ID
+			}
+		}
+
+		var pending []string
+		for _, name := range names {
+			id, ok := ids[name]
+			if !ok {
+				continue
+			}
+			container, err := client.ContainerInspect(context.Background(), id)
+			if err != nil {
+				return err
+			}
+			if containerFailed(container, name) {
+				return fmt.Errorf("container %s failed", name)
+			}
+			if !containerReady(container, name) {
+				pending = append(pending, name)
+			}
+		}
+		if len(pending) == 0 {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out after %s waiting for %s", timeout, strings.Join(pending, ", "))
+		}
+		time.Sleep(interval)
+	}
+}
+
+// validateSystemd checks that the services of the agents can be installed
+func validateSystemd() error {
+	if _, err := exec.LookPath("systemctl"); err != nil {
+		return fmt.Errorf("systemd not found: %v", err)
+	}
+	return nil
+}
+
+// waitSystemdServices waits until the given services are active
+func waitSystemdServices(services []string, timeout, interval time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		var pending []string
+		for _, service := range services {
+			status, err := GetSystemdServiceStatus(service)
+			if err != nil {
+				return err
+			}
+			switch status {
+			case "active":
+			case "failed":
+				return fmt.Errorf("service %s failed, check its logs with: journalctl -u %s", service, service)
+			default:
+				pending = append(pending, service)
+			}
+		}
+		if len(pending) == 0 {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out after %s waiting for %s", timeout, strings.Join(pending, ", "))
+		}
+		time.Sleep(interval)
+	}
+}
+
+// loadStoredCA reads the encoded CA written by the TLS step, for when it is
+// skipped
+func (cc *ClusterConfig) loadStoredCA(tlsCertFile string) error {
+	data, err := os.ReadFile(filepath.Clean(tlsCertFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	cc.CaCert = strings.TrimSpace(string(data))
+	return nil
+}
@@ -0,0 +1,309 @@
+package onboard
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	dockerContainerTypes "github.com/docker/docker/api/types/container"
+)
+
+// testSteps returns steps recording the ones run, the step named fail fails
+func testSteps(ran *[]OnboardStep, fail OnboardStep) []onboardStep {
+	var steps []onboardStep
+	for _, name := range []OnboardStep{Step_ValidateEnv, Step_GenerateConfig, Step_TLS, Step_Install} {
+		steps = append(steps, onboardStep{name: name, run: func() error {
+			*ran = append(*ran, name)
+			if name == fail {
+				return errors.New("boom")
+			}
+			return nil
+		}})
+	}
+	return steps
+}
+
+func TestRunStepsResume(t *testing.T) {
+	r := stepRunner{nodeType: NodeType_ControlPlane, mode: VMMode_Docker, statePath: filepath.Join(t.TempDir(), "state.json")}
+
+	var ran []OnboardStep
+	err := r.run(testSteps(&ran, Step_TLS))
+	if err == nil || !strings.Contains(err.Error(), "step tls failed") {
+		t.Fatalf("run() error = %v, want the tls step failed", err)
+	}
+	if state := r.loadState(); state.Next != Step_TLS || state.Error != "boom" {
+		t.Errorf("saved state = %+v, want resuming from tls", state)
+	}
+
+	// another kind of node does not resume
+	other := r
+	other.nodeType = NodeType_WorkerNode
+	if state := other.loadState(); state.Next != "" {
+		t.Errorf("worker node state = %+v, want none", state)
+	}
+
+	ran = nil
+	if err := r.run(testSteps(&ran, "")); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+	if want := []OnboardStep{Step_TLS, Step_Install}; !reflect.DeepEqual(ran, want) {
+		t.Errorf("resumed steps = %v, want %v", ran, want)
+	}
+	if state := r.loadState(); state.Next != "" {
+		t.Errorf("state = %+v, want removed once every step completed", state)
+	}
+}
+
+func TestRunStepsRecord(t *testing.T) {
+	r := stepRunner{nodeType: NodeType_ControlPlane, mode: VMMode_Docker, statePath: filepath.Join(t.TempDir(), "state.json")}
+	r.record = func(state *onboardState) {
+		state.RMQCredentials = "dXNlcjpwYXNz"
+		state.CACert = "Y2E="
+	}
+
+	var ran []OnboardStep
+	if err := r.run(testSteps(&ran, Step_Install)); err == nil {
+		t.Fatalf("run() succeeded, want the install step failed")
+	}
+	state := r.loadState()
+	if state.RMQCredentials != "dXNlcjpwYXNz" || state.CACert != "Y2E=" {
+		t.Errorf("saved state = %+v, want the credentials and the CA of the run", state)
+	}
+	info, err := os.Stat(r.statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("state mode = %o, want 600", perm)
+	}
+}
+
+func TestRunStepsSelection(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    StepOptions
+		want    []OnboardStep
+		wantErr bool
+	}{
+		{
+			name: "all",
+			want: []OnboardStep{Step_ValidateEnv, Step_GenerateConfig, Step_TLS, Step_Install},
+		},
+		{
+			name: "from step",
+			opts: StepOptions{FromStep: Step_TLS},
+			want: []OnboardStep{Step_TLS, Step_Install},
+		},
+		{
+			name: "only step",
+			opts: StepOptions{OnlyStep: Step_GenerateConfig},
+			want: []OnboardStep{Step_GenerateConfig},
+		},
+		{
+			name:    "unknown step",
+			opts:    StepOptions{FromStep: Step_PullImages},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := stepRunner{nodeType: NodeType_WorkerNode, mode: VMMode_Systemd, opts: tt.opts, statePath: filepath.Join(t.TempDir(), "state.json")}
+
+			var ran []OnboardStep
+			err := r.run(testSteps(&ran, ""))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("run() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(ran, tt.want) {
+				t.Errorf("run() steps = %v, want %v", ran, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelectSteps(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  StepOptions
+		state onboardState
+		want  []OnboardStep
+	}{
+		{
+			name: "all",
+			want: []OnboardStep{Step_ValidateEnv, Step_GenerateConfig, Step_TLS, Step_Install},
+		},
+		{
+			name:  "resumed",
+			state: onboardState{Next: Step_TLS},
+			want:  []OnboardStep{Step_TLS, Step_Install},
+		},
+		{
+			name:  "from step over resumed",
+			opts:  StepOptions{FromStep: Step_GenerateConfig},
+			state: onboardState{Next: Step_Install},
+			want:  []OnboardStep{Step_GenerateConfig, Step_TLS, Step_Install},
+		},
+		{
+			name:  "only step",
+			opts:  StepOptions{OnlyStep: Step_Install},
+			state: onboardState{Next: Step_GenerateConfig},
+			want:  []OnboardStep{Step_Install},
+		},
+		{
+			name:  "unknown resumed step",
+			state: onboardState{Next: Step_PullImages},
+			want:  []OnboardStep{Step_ValidateEnv, Step_GenerateConfig, Step_TLS, Step_Install},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := stepRunner{nodeType: NodeType_ControlPlane, mode: VMMode_Docker, opts: tt.opts}
+
+			var ran []OnboardStep
+			steps := testSteps(&ran, "")
+			start, end, err := r.selectSteps(steps, tt.state)
+			if err != nil {
+				t.Fatalf("selectSteps() error = %v", err)
+			}
+			var got []OnboardStep
+			for _, s := range steps[start:end] {
+				got = append(got, s.name)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("selectSteps() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunStepsEvents(t *testing.T) {
+	var events bytes.Buffer
+	r := stepRunner{
+		nodeType:  NodeType_ControlPlane,
+		mode:      VMMode_Docker,
+		opts:      StepOptions{FromStep: Step_TLS, Events: &events},
+		statePath: filepath.Join(t.TempDir(), "state.json"),
+		dryRun:    true,
+	}
+
+	var ran []OnboardStep
+	if err := r.run(testSteps(&ran, Step_Install)); err == nil {
+		t.Fatalf("run() succeeded, want the install step failed")
+	}
+	if state := r.loadState(); state.Next != "" {
+		t.Errorf("state = %+v, want none saved in dry run", state)
+	}
+
+	var got []string
+	dec := json.NewDecoder(&events)
+	for dec.More() {
+		var event StepEvent
+		if err := dec.Decode(&event); err != nil {
+			t.Fatal(err)
+		}
+		if event.Total != 4 || event.NodeType != NodeType_ControlPlane {
+			t.Errorf("event = %+v, want 4 steps of the control plane", event)
+		}
+		got = append(got, string(event.Step)+":"+event.Status)
+	}
+	want := []string{
+		"validate-env:skipped", "generate-config:skipped",
+		"tls:started", "tls:completed",
+		"install:started", "install:failed",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("events = %v, want %v", got, want)
+	}
+}
+
+// fakeContainerClient lists the given containers, whose inspect results are
+// returned in turn
+type fakeContainerClient struct {
+	ContainerClient
+	states map[string][]dockerContainerTypes.State
+}
+
+func (f *fakeContainerClient) ContainerList(_ context.Context, _ dockerContainerTypes.ListOptions) ([]dockerContainerTypes.Summary, error) {
+	var list []dockerContainerTypes.Summary
+	for name := range f.states {
+		list = append(list, dockerContainerTypes.Summary{ID: name, Names: []string{"/" + name}})
+	}
+	return list, nil
+}
+
+func (f *fakeContainerClient) ContainerInspect(_ context.Context, id string) (dockerContainerTypes.InspectResponse, error) {
+	state := f.states[id][0]
+	if len(f.states[id]) > 1 {
+		f.states[id] = f.states[id][1:]
+	}
+	return dockerContainerTypes.InspectResponse{
+		ContainerJSONBase: &dockerContainerTypes.ContainerJSONBase{State: &state},
+	}, nil
+}
+
+func TestWaitContainers(t *testing.T) {
+	running := dockerContainerTypes.State{Status: "running"}
+	starting := dockerContainerTypes.State{Status: "running", Health: &dockerContainerTypes.Health{Status: "starting"}}
+	healthy := dockerContainerTypes.State{Status: "running", Health: &dockerContainerTypes.Health{Status: "healthy"}}
+	exited := dockerContainerTypes.State{Status: "exited"}
+	crashed := dockerContainerTypes.State{Status: "exited", ExitCode: 1}
+
+	tests := []struct {
+		name    string
+		states  map[string][]dockerContainerTypes.State
+		wantErr string
+	}{
+		{
+			name: "healthy",
+			states: map[string][]dockerContainerTypes.State{
+				kubeArmorInitName: {exited},
+				kubeArmorName:     {starting, healthy},
+				summaryEngineName: {running},
+			},
+		},
+		{
+			name: "failed",
+			states: map[string][]dockerContainerTypes.State{
+				kubeArmorName:          {running},
+				kubearmorVMAdapterName: {crashed},
+			},
+			wantErr: "container kubearmor-vm-adapter failed",
+		},
+		{
+			name: "unexpected exit",
+			states: map[string][]dockerContainerTypes.State{
+				kubeArmorName: {exited},
+			},
+			wantErr: "container kubearmor failed",
+		},
+		{
+			name: "timed out",
+			states: map[string][]dockerContainerTypes.State{
+				kubeArmorName: {starting},
+			},
+			wantErr: "waiting for kubearmor",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &fakeContainerClient{states: tt.states}
+			err := waitContainers(client, healthContainers(NodeType_WorkerNode), 20*time.Millisecond, time.Millisecond)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("waitContainers() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("waitContainers() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
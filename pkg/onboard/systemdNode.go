@@ -2,7 +2,6 @@ package onboard
 
 import (
 	"fmt"
-	"path/filepath"
 	"strings"
 
 	"github.com/Masterminds/sprig"
@@ -11,20 +10,10 @@ import (
 	"golang.org/x/mod/semver"
 )
 
-func (jc *JoinConfig) JoinSystemdNode() error {
+func (jc *JoinConfig) JoinSystemdNode(opts StepOptions) error {
 	// initialize template funcs
 	jc.TemplateFuncs = sprig.GenericFuncMap()
 
-	// Download and install agents
-	logger.Info2("Downloading agents...")
-	err := jc.SystemdInstall()
-	if err != nil {
-		logger.Error("Installation failed!! Error: %s.\nCleaning up downloaded assets...", err.Error())
-		Deletedir(cm.DownloadDir)
-		DeboardSystemd(NodeType_WorkerNode) // #nosec G104
-		return err
-	}
-
 	jc.TCArgs.SpireSecretDir = jc.SpireSecretDir
 
 	jc.TCArgs.TlsEnabled = jc.Tls.Enabled
@@ -43,110 +32,102 @@ func (jc *JoinConfig) JoinSystemdNode() error {
 
 	if jc.Tls.Enabled {
 		jc.TCArgs.TlsCertFile = "/opt" + cm.DefaultCACertDir + "/" + cm.DefaultEncodedFileName
-		if err := StoreCert(map[string]string{
-			jc.TCArgs.TlsCertFile: jc.Tls.CaCert,
-		}); err != nil {
-			return err
-		}
 	}
 
 	jc.TCArgs.SplunkConfigObject = jc.Splunk
 
-	if jc.TCArgs.SplunkConfigObject.Enabled {
-		if err := validateSplunkCredential(jc.TCArgs.SplunkConfigObject); err != nil {
-			return err
-		}
-	}
-
 	jc.TCArgs.ReleaseVersion = jc.AgentsVersion
 
-	// config services
-	kmuxConfigArgs := KmuxConfigTemplateArgs{
-		ReleaseVersion: jc.AgentsVersion,
-		RMQServer:      jc.RMQServer,
-		RMQUsername:    jc.TCArgs.RMQUsername,
-		RMQPassword:    jc.TCArgs.RMQPassword,
-		TlsEnabled:     jc.TCArgs.TlsEnabled,
-		TlsCertFile:    jc.TCArgs.TlsCertFile,
-	}
-
-	logger.Info2("\nConfiguring services...")
+	var services []string
 	for _, obj := range jc.SystemdServiceObjects {
-		if !obj.InstallOnWorkerNode {
+		if !obj.InstallOnWorkerNode || obj.ServiceName == "" {
 			continue
 		}
 		if obj.AgentName == cm.SummaryEngine && !jc.DeploySumengine {
 			continue
 		}
-		if obj.ConfigFilePath != "" {
-			// copy template args
-			tcArgs := jc.TCArgs
+		if obj.AgentName == cm.HardeningAgent && semver.Compare(jc.TCArgs.ReleaseVersion, "v0.9.4") >= 0 {
+			continue
+		}
+		services = append(services, obj.ServiceName)
+	}
 
-			// copy kmux config path for specifying in agent config
-			if obj.KmuxConfigPath != "" {
-				tcArgs.KmuxConfigPath = obj.KmuxConfigPath
+	return jc.runOnboardSteps(NodeType_WorkerNode, opts, []onboardStep{
+		{name: Step_ValidateEnv, run: func() error {
+			if err := validateSystemd(); err != nil {
+				return err
 			}
-
-			// copy generic config files
-			_, err = copyOrGenerateFile(jc.UserConfigPath, obj.AgentDir, obj.ConfigFilePath, jc.TemplateFuncs, obj.ConfigTemplateString, tcArgs)
-			if err != nil {
+			if jc.TCArgs.SplunkConfigObject.Enabled {
+				return validateSplunkCredential(jc.TCArgs.SplunkConfigObject)
+			}
+			return nil
+		}},
+		{name: Step_PullImages, run: func() error {
+			// Download and install agents
+			logger.Info2("Downloading agents...")
+			if err := jc.SystemdInstall(); err != nil {
+				// the onboarding progress is kept for resuming from this step
+				logger.Warn("Installation failed!! Error: %s.\nCleaning up downloaded assets...", err.Error())
+				Deletedir(cm.DownloadDir)
 				return err
 			}
-		}
-		// copy kmux config
-		if obj.KmuxConfigPath != "" {
-			populateKmuxArgs(&kmuxConfigArgs, obj.AgentName, obj.KmuxConfigFileName, jc.RMQTopicPrefix, jc.TCArgs.Hostname, jc.RMQConnectionName)
-			kmuxConfigArgs.UseCaFile = useCaFile(&jc.TCArgs, obj.AgentName, obj.AgentImage)
-			// copy generic config files
-			_, err = copyOrGenerateFile(jc.UserConfigPath, obj.AgentDir, obj.KmuxConfigFileName, jc.TemplateFuncs, obj.KmuxConfigTemplateString, kmuxConfigArgs)
+			return nil
+		}},
+		{name: Step_GenerateConfig, run: func() error {
+			// config services
+			logger.Info2("\nConfiguring services...")
+			files, err := jc.systemdAgentFiles(jc.TCArgs, jc.kmuxConfigArgs())
 			if err != nil {
 				return err
 			}
-		}
-
-		// copy additional files
-		for filename, srcPath := range obj.ExtraFilePathSrc {
-			if srcPath == "" {
-				continue
+			for _, file := range files {
+				if err := file.write(); err != nil {
+					return err
+				}
 			}
-
-			destPath, ok := obj.ExtraFilePathDest[filename]
-			if !ok {
-				logger.Warn("Warning! No destination for extra file %s", filename)
-				continue
+			return jc.copyExtraFiles()
+		}},
+		{name: Step_TLS, run: func() error {
+			if !jc.Tls.Enabled {
+				return nil
 			}
-
-			srcPathDir := filepath.Dir(srcPath)
-			destPathDir := filepath.Dir(destPath)
-
-			_, err = copyOrGenerateFile(srcPathDir, destPathDir, filename, nil, "", nil)
-			if err != nil {
-				return err
+			return StoreCert(map[string]string{
+				jc.TCArgs.TlsCertFile: jc.Tls.CaCert,
+			})
+		}},
+		{name: Step_Install, run: func() error {
+			// Start services
+			logger.Info2("\nEnabling services...")
+			for _, service := range services {
+				if err := StartSystemdService(service); err != nil {
+					logger.Debug("failed to start service %s: %s\n", service, err.Error())
+					return err
+				}
 			}
-		}
-	}
+			logger.PrintSuccess("\nAll services enabled successfully.")
+
+			logger.Info1("\nCleaning up downloaded assets...")
+			Deletedir(cm.DownloadDir)
+			return nil
+		}},
+		{name: Step_WaitHealthy, run: func() error {
+			if jc.DryRun {
+				return nil
+			}
+			return waitSystemdServices(services, healthTimeout, healthInterval)
+		}},
+	})
+}
 
-	// Start services
-	logger.Info2("\nEnabling services...")
-	for _, obj := range jc.SystemdServiceObjects {
-		if !obj.InstallOnWorkerNode {
-			continue
-		}
-		if obj.AgentName == cm.SummaryEngine && !jc.DeploySumengine {
-			continue
-		}
-		if obj.AgentName == cm.HardeningAgent && semver.Compare(jc.TCArgs.ReleaseVersion, "v0.9.4") >= 0 {
-			continue
-		}
-		err = StartSystemdService(obj.ServiceName)
-		if err != nil {
-			logger.Debug("failed to start service %s: %s\n", obj.ServiceName, err.Error())
-			return err
-		}
+// kmuxConfigArgs returns the kmux config template args of the worker node
+// agents
+func (jc *JoinConfig) kmuxConfigArgs() KmuxConfigTemplateArgs {
+	return KmuxConfigTemplateArgs{
+		ReleaseVersion: jc.AgentsVersion,
+		RMQServer:      jc.RMQServer,
+		RMQUsername:    jc.TCArgs.RMQUsername,
+		RMQPassword:    jc.TCArgs.RMQPassword,
+		TlsEnabled:     jc.TCArgs.TlsEnabled,
+		TlsCertFile:    jc.TCArgs.TlsCertFile,
 	}
-	logger.PrintSuccess("\nAll services enabled successfully.")
-
-	logger.Info1("\nCleaning up downloaded assets...")
-	Deletedir(cm.DownloadDir)
-	return nil
 }
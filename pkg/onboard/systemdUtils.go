@@ -21,6 +21,7 @@ import (
 	"github.com/coreos/go-systemd/v22/dbus"
 	"golang.org/x/mod/semver"
 	"oras.land/oras-go/v2"
+	"oras.land/oras-go/v2/content"
 	"oras.land/oras-go/v2/content/file"
 	"oras.land/oras-go/v2/registry/remote"
 )
@@ -329,6 +330,86 @@ func getSystemdAgentsKmuxConfigs(cc *ClusterConfig) []SystemdServiceObject {
 	}
 }
 
+// configuresSystemdAgent returns whether the agent of a service object is
+// set up on this node
+func (cc *ClusterConfig) configuresSystemdAgent(obj SystemdServiceObject) bool {
+	if cc.WorkerNode {
+		return obj.InstallOnWorkerNode && (obj.AgentName != cm.SummaryEngine || cc.DeploySumengine)
+	}
+	return obj.AgentName != cm.HardeningAgent || cc.EnableHardeningAgent
+}
+
+// systemdAgentFiles generates the config and kmux config files of the agents
+// set up on this node
+func (cc *ClusterConfig) systemdAgentFiles(tcArgs TemplateConfigArgs, kmuxConfigArgs KmuxConfigTemplateArgs) ([]agentFile, error) {
+	var files []agentFile
+	for _, obj := range cc.SystemdServiceObjects {
+		if !cc.configuresSystemdAgent(obj) {
+			continue
+		}
+
+		if obj.ConfigFilePath != "" {
+			// copy template args
+			args := tcArgs
+
+			// copy kmux config path for specifying in agent config
+			if obj.KmuxConfigPath != "" {
+				args.KmuxConfigPath = obj.KmuxConfigPath
+			}
+
+			data, err := generateFile(cc.UserConfigPath, obj.ConfigFilePath, cc.TemplateFuncs, obj.ConfigTemplateString, args)
+			if err != nil {
+				return nil, fmt.Errorf("err config generate: %v", err)
+			}
+			files = append(files, agentFile{agent: obj.AgentName, dir: obj.AgentDir, name: obj.ConfigFilePath, data: data})
+		}
+
+		if obj.KmuxConfigPath != "" {
+			populateKmuxArgs(&kmuxConfigArgs, obj.AgentName, obj.KmuxConfigFileName, cc.RMQTopicPrefix, tcArgs.Hostname, cc.RMQConnectionName)
+			kmuxConfigArgs.UseCaFile = useCaFile(&tcArgs, obj.AgentName, obj.AgentImage)
+			data, err := generateFile(cc.UserConfigPath, obj.KmuxConfigFileName, cc.TemplateFuncs, obj.KmuxConfigTemplateString, kmuxConfigArgs)
+			if err != nil {
+				return nil, fmt.Errorf("err kmux generate: %v", err)
+			}
+			files = append(files, agentFile{agent: obj.AgentName, dir: obj.AgentDir, name: obj.KmuxConfigFileName, data: data})
+		}
+	}
+
+	return files, nil
+}
+
+// copyExtraFiles copies additional files given by the user, like the system
+// monitor, to the agent directories
+func (cc *ClusterConfig) copyExtraFiles() error {
+	for _, obj := range cc.SystemdServiceObjects {
+		if !cc.configuresSystemdAgent(obj) {
+			continue
+		}
+
+		for filename, srcPath := range obj.ExtraFilePathSrc {
+			if srcPath == "" {
+				continue
+			}
+
+			destPath, ok := obj.ExtraFilePathDest[filename]
+			if !ok {
+				logger.Warn("Warning! No destination for extra file %s", filename)
+				continue
+			}
+
+			srcPathDir := filepath.Dir(srcPath)
+			destPathDir := filepath.Dir(destPath)
+
+			_, err := copyOrGenerateFile(srcPathDir, destPathDir, filename, nil, "", nil)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
 // placeServiceFiles copies service files
 func (cc *ClusterConfig) placeServiceFiles() error {
 	configArgs := map[string]any{
@@ -399,10 +480,17 @@ func (cc *ClusterConfig) placeServiceFiles() error {
 }
 
 // downloadAgent downloads agents as OCI artifacts
-func (cc *ClusterConfig) downloadAgent(agentName, agentRepo, agentTag string) (string, error) {
-	fs, err := file.New(cm.DownloadDir)
+func (cc *ClusterConfig) downloadAgent(dir, agentName, agentRepo, agentTag string) (string, error) {
+	fileName, _, err := cc.fetchAgent(dir, agentName, agentRepo, agentTag)
+	return fileName, err
+}
+
+// fetchAgent downloads an agent as an OCI artifact and returns its file with
+// the manifest of the artifact
+func (cc *ClusterConfig) fetchAgent(dir, agentName, agentRepo, agentTag string) (string, []byte, error) {
+	fs, err := file.New(dir)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 	defer fs.Close()
 
@@ -410,61 +498,161 @@ func (cc *ClusterConfig) downloadAgent(agentName, agentRepo, agentTag string) (s
 	ctx := context.Background()
 	repo, err := remote.NewRepository(agentRepo)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 
 	repo.Client = cc.ORASClient
 	repo.PlainHTTP = cc.PlainHTTP
 
-	_, err = oras.Copy(ctx, repo, agentTag, fs, agentTag, oras.DefaultCopyOptions)
+	// resolve the tag and copy by digest so that the verified artifact is
+	// the one downloaded
+	desc, err := repo.Resolve(ctx, agentTag)
 	if err != nil {
-		return "", err
+		return "", nil, err
+	}
+	if err := cc.verifyDigest(agentRepo, agentTag, desc.Digest.String()); err != nil {
+		return "", nil, err
 	}
 
-	filepath := path.Join(cm.DownloadDir, agentName+"_"+agentTag+".tar.gz")
-	return filepath, nil
+	_, err = oras.Copy(ctx, repo, desc.Digest.String(), fs, agentTag, oras.DefaultCopyOptions)
+	if err != nil {
+		return "", nil, err
+	}
+	manifest, err := content.FetchAll(ctx, fs, desc)
+	if err != nil {
+		return "", nil, err
+	}
+
+	filepath := path.Join(dir, agentName+"_"+agentTag+".tar.gz")
+	return filepath, manifest, nil
 }
 
-// extractAgent extracts agent tar
-func extractAgent(fileName string) error {
+// verifyDigest checks the digest of an agent artifact against the one pinned
+// by the release. Agents a release pinning digests leaves out are refused
+// unless verification is skipped, releases pinning none are only warned
+// about.
+func (cc *ClusterConfig) verifyDigest(agentRepo, agentTag, digest string) error {
+	if cm.SkipReleaseVerification {
+		return nil
+	}
+
+	name := path.Base(agentRepo) + ":" + agentTag
+	want, ok := cc.AgentDigests[name]
+	switch {
+	case len(cc.AgentDigests) == 0:
+		logger.Warn("Release %s pins no digests, %s is installed without verifying it", cc.AgentsVersion, name)
+	case !ok:
+		return fmt.Errorf("release %s pins no digest for %s, use --skip-verification to install it anyway", cc.AgentsVersion, name)
+	case want != digest:
+		return fmt.Errorf("digest of %s is %s, release %s pins %s", name, digest, cc.AgentsVersion, want)
+	}
+	return nil
+}
+
+// ReleaseAgentDigests resolves the digests of the systemd agents of a release
+// for the given architectures, keyed like the digests pinned by releases
+func ReleaseAgentDigests(release cm.ReleaseMetadata, archs []string) (map[string]string, error) {
+	cc := &ClusterConfig{Mode: VMMode_Systemd}
+	if err := cc.setImages(agentImages{}, release, "", false); err != nil {
+		return nil, err
+	}
+	cc.CreateSystemdServiceObjects()
+
+	ctx := context.Background()
+	digests := make(map[string]string)
+	for _, obj := range cc.bundleAgents() {
+		packageMeta := splitLast(obj.AgentImage, ":")
+		repo, err := remote.NewRepository(packageMeta[0])
+		if err != nil {
+			return nil, err
+		}
+		for _, arch := range archs {
+			tag := strings.TrimSuffix(packageMeta[1], cm.SystemdTagSuffix) + "_linux-" + arch
+			name := path.Base(packageMeta[0]) + ":" + tag
+			if _, ok := digests[name]; ok {
+				continue
+			}
+			desc, err := repo.Resolve(ctx, tag)
+			if err != nil {
+				return nil, fmt.Errorf("resolving %s: %v", name, err)
+			}
+			digests[name] = desc.Digest.String()
+		}
+	}
+	return digests, nil
+}
+
+// agentDirs are the directories agent packages are extracted to
+var agentDirs = []string{"opt", "usr/lib/systemd/system", "usr/local/bin", "etc/logrotate.d"}
+
+// agentPath returns where an entry of an agent package is extracted, failing
+// for entries outside of agentDirs
+func agentPath(name string) (string, error) {
+	clean := strings.TrimPrefix(path.Clean("/"+name), "/")
+	if clean != strings.TrimPrefix(path.Clean(name), "/") {
+		return "", fmt.Errorf("entry %s escapes the package", name)
+	}
+	for _, dir := range agentDirs {
+		if clean == dir || strings.HasPrefix(clean, dir+"/") {
+			return "/" + clean, nil
+		}
+	}
+	return "", fmt.Errorf("entry %s outside of %s", name, strings.Join(agentDirs, ", "))
+}
+
+// walkAgent calls fn with the path of every file of an agent package
+func walkAgent(fileName string, fn func(header *tar.Header, filename string, r io.Reader) error) error {
 	file, err := os.Open(filepath.Clean(fileName))
 	if err != nil {
-		fmt.Println("Error opening file:", fileName, err)
 		return err
 	}
 	defer file.Close()
 
 	gzipReader, err := gzip.NewReader(file)
 	if err != nil {
-		fmt.Println("Error creating gzip reader:", err)
-		return err
+		return fmt.Errorf("reading %s: %v", fileName, err)
 	}
 	defer gzipReader.Close()
 
 	tarReader := tar.NewReader(gzipReader)
-
 	for {
 		header, err := tarReader.Next()
-
 		if err == io.EOF {
-			break
+			return nil
 		}
-
 		if err != nil {
-			fmt.Println("Error reading tar header:", err)
-			return err
+			return fmt.Errorf("reading %s: %v", fileName, err)
 		}
-		if header.Typeflag == tar.TypeDir {
+
+		switch header.Typeflag {
+		case tar.TypeDir, tar.TypeXGlobalHeader:
 			continue
+		case tar.TypeReg:
+		default:
+			return fmt.Errorf("entry %s of %s is not a regular file", header.Name, fileName)
 		}
-		rootDir := "/"
 
-		// Extract the file
-		filename := filepath.Join(rootDir, header.Name) // #nosec G305
+		filename, err := agentPath(header.Name)
+		if err != nil {
+			return fmt.Errorf("invalid package %s: %v", fileName, err)
+		}
+		if err := fn(header, filename, tarReader); err != nil {
+			return err
+		}
+	}
+}
 
-		// Create parent directories if not exist
+// extractAgent extracts agent tar. All the entries are checked before
+// anything is written.
+func extractAgent(fileName string) error {
+	err := walkAgent(fileName, func(*tar.Header, string, io.Reader) error { return nil })
+	if err != nil {
+		return err
+	}
 
-		err = os.MkdirAll(filepath.Dir(filename), 0755) // #nosec G301
+	return walkAgent(fileName, func(header *tar.Header, filename string, r io.Reader) error {
+		// Create parent directories if not exist
+		err := os.MkdirAll(filepath.Dir(filename), 0755) // #nosec G301
 		if err != nil {
 			return err
 		}
@@ -474,28 +662,32 @@ func extractAgent(fileName string) error {
 		}
 		defer file.Close()
 
-		_, err = io.Copy(file, tarReader) // #nosec G110
+		_, err = io.Copy(file, r) // #nosec G110
 		if err != nil {
 			return err
 		}
 
 		// Set execute permissions for the binaries
-
 		if header.Mode&0111 != 0 {
-			err := os.Chmod(filename, 0755) // #nosec G302
-			if err != nil {
-				return err
-			}
+			return os.Chmod(filename, 0755) // #nosec G302
 		}
-	}
-
-	return nil
+		return nil
+	})
 }
 
-// InstallAgent downloads agent using downloadAgent.
+// InstallAgent downloads agent using downloadAgent, or takes it from the
+// bundle in use.
 // It disables the systemd service first if it is running
 func (cc *ClusterConfig) installAgent(agentName, agentRepo, agentTag string) error {
-	fileName, err := cc.downloadAgent(agentName, agentRepo, agentTag)
+	var (
+		fileName string
+		err      error
+	)
+	if cc.bundle != nil {
+		fileName, err = cc.bundleAgent(agentRepo, agentTag)
+	} else {
+		fileName, err = cc.downloadAgent(cm.DownloadDir, agentName, agentRepo, agentTag)
+	}
 	if err != nil {
 		return err
 	}
@@ -698,6 +890,11 @@ func DeboardSystemd(nodeType NodeType) error {
 		logger.Warn("Failed to remove dir %s: %s", knoxctlDir, err.Error())
 	}
 
+	statePath := filepath.Join(cm.SystemdKnoxctlDir, cm.OnboardStateFilename)
+	if err := os.Remove(statePath); err != nil && !os.IsNotExist(err) {
+		logger.Warn("Failed to remove %s: %s", statePath, err.Error())
+	}
+
 	return nil
 }
 
@@ -0,0 +1,96 @@
+package onboard
+
+import (
+	"path"
+	"strings"
+	"testing"
+
+	cm "github.com/accuknox/accuknox-cli-v2/pkg/common"
+)
+
+func TestAgentPath(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    string
+		wantErr string
+	}{
+		{name: "opt/kubearmor/kubearmor", want: "/opt/kubearmor/kubearmor"},
+		{name: "./usr/lib/systemd/system/kubearmor.service", want: "/usr/lib/systemd/system/kubearmor.service"},
+		{name: "/opt/kubearmor/kubearmor.yaml", want: "/opt/kubearmor/kubearmor.yaml"},
+		{name: "../../etc/passwd", wantErr: "escapes"},
+		{name: "opt/../../etc/passwd", wantErr: "escapes"},
+		{name: "opt/../etc/passwd", wantErr: "outside"},
+		{name: "etc/cron.d/job", wantErr: "outside"},
+		{name: "optional/file", wantErr: "outside"},
+	}
+	for _, tt := range tests {
+		got, err := agentPath(tt.name)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("agentPath(%s) = %s, %v, want error mentioning %q", tt.name, got, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("agentPath(%s) = %s, %v, want %s", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestVerifyDigest(t *testing.T) {
+	const (
+		repo   = "docker.io/kubearmor/kubearmor-systemd"
+		tag    = "v1.5.0_linux-amd64"
+		digest = "sha256:aaaa"
+	)
+	tests := []struct {
+		name    string
+		digests map[string]string
+		skip    bool
+		wantErr string
+	}{
+		{name: "pinned", digests: map[string]string{"kubearmor-systemd:" + tag: digest}},
+		{name: "no digests in release"},
+		{name: "mismatch", digests: map[string]string{"kubearmor-systemd:" + tag: "sha256:bbbb"}, wantErr: "pins sha256:bbbb"},
+		{name: "not pinned", digests: map[string]string{"vm-adapter-systemd:" + tag: digest}, wantErr: "pins no digest"},
+		{name: "verification skipped", skip: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func(skip bool) { cm.SkipReleaseVerification = skip }(cm.SkipReleaseVerification)
+			cm.SkipReleaseVerification = tt.skip
+			cc := &ClusterConfig{AgentsVersion: "v0.10.0", AgentDigests: tt.digests}
+			err := cc.verifyDigest(repo, tag, digest)
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("verifyDigest() error = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("verifyDigest() error = %v, want it to mention %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyDigestEmbeddedRelease(t *testing.T) {
+	version, release := cm.GetLatestReleaseInfoFromEmbedded()
+	cc := &ClusterConfig{Mode: VMMode_Systemd, AgentsVersion: version}
+	if err := cc.setImages(agentImages{}, release, "", false); err != nil {
+		t.Fatalf("setImages() error = %v", err)
+	}
+	cc.CreateSystemdServiceObjects()
+
+	agents := cc.bundleAgents()
+	if len(agents) == 0 {
+		t.Fatalf("release %s installs no agents", version)
+	}
+	for _, obj := range agents {
+		packageMeta := splitLast(obj.AgentImage, ":")
+		digest, ok := release.Digests[path.Base(packageMeta[0])+":"+packageMeta[1]]
+		if !ok {
+			digest = "sha256:" + strings.Repeat("0", 64)
+		}
+		if err := cc.verifyDigest(packageMeta[0], packageMeta[1], digest); err != nil {
+			t.Errorf("verifyDigest() of %s from the embedded release %s error = %v", obj.AgentImage, version, err)
+		}
+	}
+}
@@ -114,6 +114,8 @@ type ClusterConfig struct {
 
 	//kubearmor systemd configs
 	Mode VMMode `json:"mode,omitempty"`
+	// ContainerRuntime runs the agents in docker mode, detected if not set
+	ContainerRuntime ContainerRuntime `json:"container_runtime,omitempty"`
 
 	// container security
 	SecureContainers bool `json:"secure_containers,omitempty"`
@@ -136,6 +138,11 @@ type ClusterConfig struct {
 	PlainHTTP   bool         `json:"plain_http,omitempty"`
 	InsecureTLS bool         `json:"insecure_tls,omitempty"`
 	ORASClient  *auth.Client `json:"-"`
+	// AgentDigests are the digests the agent artifacts are pinned to
+	AgentDigests map[string]string `json:"-"`
+
+	// bundle the agents are installed from instead of the registry
+	bundle *Bundle
 
 	// tls configs
 	CaCert         string `json:"ca_cert,omitempty"`
@@ -0,0 +1,809 @@
+package onboard
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/sprig"
+	cm "github.com/accuknox/accuknox-cli-v2/pkg/common"
+	"github.com/accuknox/accuknox-cli-v2/pkg/logger"
+	"github.com/olekukonko/tablewriter"
+	"golang.org/x/mod/semver"
+	"sigs.k8s.io/yaml"
+)
+
+// upgradeAgent is an agent whose image follows the agents release
+type upgradeAgent struct {
+	// name is the systemd agent name
+	name string
+	// service is the compose service of the agent
+	service string
+	// mode the agent is deployed in the release version, empty for both
+	mode VMMode
+
+	image   func(cc *ClusterConfig) *string
+	tcImage func(tcArgs *TemplateConfigArgs) *string
+	tag     func(release cm.ReleaseMetadata) string
+}
+
+var upgradeAgents = []upgradeAgent{
+	{
+		name:    cm.KubeArmor,
+		service: "kubearmor",
+		image:   func(cc *ClusterConfig) *string { return &cc.KubeArmorImage },
+		tcImage: func(tcArgs *TemplateConfigArgs) *string { return &tcArgs.KubeArmorImage },
+		tag:     func(release cm.ReleaseMetadata) string { return release.KubeArmorTag },
+	},
+	{
+		name:    "kubearmor-init",
+		service: "kubearmor-init",
+		mode:    VMMode_Docker,
+		image:   func(cc *ClusterConfig) *string { return &cc.KubeArmorInitImage },
+		tcImage: func(tcArgs *TemplateConfigArgs) *string { return &tcArgs.KubeArmorInitImage },
+		tag:     func(release cm.ReleaseMetadata) string { return release.KubeArmorTag },
+	},
+	{
+		name:    cm.VMAdapter,
+		service: "kubearmor-vm-adapter",
+		image:   func(cc *ClusterConfig) *string { return &cc.KubeArmorVMAdapterImage },
+		tcImage: func(tcArgs *TemplateConfigArgs) *string { return &tcArgs.KubeArmorVMAdapterImage },
+		tag:     func(release cm.ReleaseMetadata) string { return release.KubeArmorVMAdapterTag },
+	},
+	{
+		name:    cm.RelayServer,
+		service: "kubearmor-relay-server",
+		image:   func(cc *ClusterConfig) *string { return &cc.KubeArmorRelayServerImage },
+		tcImage: func(tcArgs *TemplateConfigArgs) *string { return &tcArgs.KubeArmorRelayServerImage },
+		tag:     func(release cm.ReleaseMetadata) string { return release.KubeArmorRelayTag },
+	},
+	{
+		// the docker image of spire-agent is always the latest one
+		name:    cm.SpireAgent,
+		service: "spire-agent",
+		mode:    VMMode_Systemd,
+		image:   func(cc *ClusterConfig) *string { return &cc.SPIREAgentImage },
+		tcImage: func(tcArgs *TemplateConfigArgs) *string { return &tcArgs.SPIREAgentImage },
+		tag:     func(release cm.ReleaseMetadata) string { return release.SPIREAgentImageTag },
+	},
+	{
+		name:    cm.SIAAgent,
+		service: "shared-informer-agent",
+		image:   func(cc *ClusterConfig) *string { return &cc.SIAImage },
+		tcImage: func(tcArgs *TemplateConfigArgs) *string { return &tcArgs.SIAImage },
+		tag:     func(release cm.ReleaseMetadata) string { return release.SIATag },
+	},
+	{
+		name:    cm.PEAAgent,
+		service: "policy-enforcement-agent",
+		image:   func(cc *ClusterConfig) *string { return &cc.PEAImage },
+		tcImage: func(tcArgs *TemplateConfigArgs) *string { return &tcArgs.PEAImage },
+		tag:     func(release cm.ReleaseMetadata) string { return release.PEATag },
+	},
+	{
+		name:    cm.FeederService,
+		service: "feeder-service",
+		image:   func(cc *ClusterConfig) *string { return &cc.FeederImage },
+		tcImage: func(tcArgs *TemplateConfigArgs) *string { return &tcArgs.FeederImage },
+		tag:     func(release cm.ReleaseMetadata) string { return release.FeederServiceTag },
+	},
+	{
+		name:    cm.SummaryEngine,
+		service: "summary-engine",
+		image:   func(cc *ClusterConfig) *string { return &cc.SumEngineImage },
+		tcImage: func(tcArgs *TemplateConfigArgs) *string { return &tcArgs.SumEngineImage },
+		tag:     func(release cm.ReleaseMetadata) string { return release.SumEngineTag },
+	},
+	{
+		name:    cm.DiscoverAgent,
+		service: "discover",
+		image:   func(cc *ClusterConfig) *string { return &cc.DiscoverImage },
+		tcImage: func(tcArgs *TemplateConfigArgs) *string { return &tcArgs.DiscoverImage },
+		tag:     func(release cm.ReleaseMetadata) string { return release.DiscoverTag },
+	},
+	{
+		name:    cm.HardeningAgent,
+		service: "hardening-agent",
+		image:   func(cc *ClusterConfig) *string { return &cc.HardeningAgentImage },
+		tcImage: func(tcArgs *TemplateConfigArgs) *string { return &tcArgs.HardeningAgentImage },
+		tag:     func(release cm.ReleaseMetadata) string { return release.HardeningAgentTag },
+	},
+}
+
+// key returns the name of the agent in the given mode
+func (a upgradeAgent) key(mode VMMode) string {
+	if mode == VMMode_Systemd {
+		return a.name
+	}
+	return a.service
+}
+
+// deploysAgent returns whether the agent runs on this node
+func (cc *ClusterConfig) deploysAgent(agent upgradeAgent) bool {
+	if agent.mode != "" && agent.mode != cc.Mode {
+		return false
+	}
+	switch agent.name {
+	case cm.KubeArmor, "kubearmor-init", cm.VMAdapter:
+		return true
+	case cm.SummaryEngine:
+		return !cc.WorkerNode || cc.DeploySumengine
+	case cm.SpireAgent:
+		return !cc.WorkerNode || cc.SpireEnabled
+	case cm.HardeningAgent:
+		return !cc.WorkerNode && cc.EnableHardeningAgent
+	}
+	return !cc.WorkerNode
+}
+
+// releaseImage returns the image with the tag of a release
+func releaseImage(image, tag string, mode VMMode) (string, error) {
+	if mode == VMMode_Systemd {
+		return getImage("", "", "", image, "", tag, "", "v", cm.SystemdTagSuffix, false)
+	}
+	return getImage("", "", "", image, "", tag, "", "", "", false)
+}
+
+// AgentChange is the planned change of an agent
+type AgentChange struct {
+	Agent    string `json:"agent"`
+	Image    string `json:"image,omitempty"`
+	NewImage string `json:"new_image,omitempty"`
+	// Pinned is set if the image was not the one of the current release
+	// and is kept as is
+	Pinned bool     `json:"pinned,omitempty"`
+	Files  []string `json:"files,omitempty"`
+}
+
+func (c AgentChange) restart() bool {
+	return c.NewImage != c.Image || len(c.Files) > 0
+}
+
+// planImages returns the image changes of the agents of the node for the
+// target release. The images not matching the tag of the current release
+// were set by the user and are kept; current is nil if the current release
+// is unknown.
+func planImages(cc *ClusterConfig, current *cm.ReleaseMetadata, target cm.ReleaseMetadata) ([]AgentChange, error) {
+	var changes []AgentChange
+	for _, agent := range upgradeAgents {
+		image := *agent.image(cc)
+		if image == "" || !cc.deploysAgent(agent) {
+			continue
+		}
+		tag := agent.tag(target)
+		if tag == "" {
+			continue
+		}
+
+		change := AgentChange{Agent: agent.key(cc.Mode), Image: image, NewImage: image}
+		if current != nil && agent.tag(*current) != "" {
+			currentImage, err := releaseImage(image, agent.tag(*current), cc.Mode)
+			if err != nil {
+				return nil, err
+			}
+			if currentImage != image {
+				change.Pinned = true
+				changes = append(changes, change)
+				continue
+			}
+		}
+
+		newImage, err := releaseImage(image, tag, cc.Mode)
+		if err != nil {
+			return nil, err
+		}
+		if newImage != image {
+			change.NewImage = newImage
+			changes = append(changes, change)
+		}
+	}
+	return changes, nil
+}
+
+var unixTimestamp = regexp.MustCompile(`-[0-9]{10}\b`)
+
+// sameContent compares two config files ignoring the creation timestamps in
+// kmux queue and connection names
+func sameContent(a, b []byte) bool {
+	return bytes.Equal(unixTimestamp.ReplaceAll(a, nil), unixTimestamp.ReplaceAll(b, nil))
+}
+
+// composeChanges returns the services defined differently in two compose
+// files
+func composeChanges(current, target []byte) ([]string, error) {
+	var a, b struct {
+		Services map[string]any `json:"services"`
+	}
+	if err := yaml.Unmarshal(current, &a); err != nil {
+		return nil, fmt.Errorf("invalid compose file: %v", err)
+	}
+	if err := yaml.Unmarshal(target, &b); err != nil {
+		return nil, fmt.Errorf("invalid compose file: %v", err)
+	}
+
+	var services []string
+	for name, service := range b.Services {
+		if !reflect.DeepEqual(service, a.Services[name]) {
+			services = append(services, name)
+		}
+	}
+	sort.Strings(services)
+	return services, nil
+}
+
+// upgradeNode is the stored onboarding config of a control plane or worker
+// node
+type upgradeNode interface {
+	clusterConfig() *ClusterConfig
+	templateArgs() *TemplateConfigArgs
+	agentFiles() ([]agentFile, error)
+	composeProfiles() []string
+}
+
+func (ic *InitConfig) clusterConfig() *ClusterConfig     { return &ic.ClusterConfig }
+func (ic *InitConfig) templateArgs() *TemplateConfigArgs { return &ic.TCArgs }
+
+func (ic *InitConfig) agentFiles() ([]agentFile, error) {
+	if ic.Mode == VMMode_Systemd {
+		kmuxConfigArgs := ic.systemdKmuxConfigArgs()
+		return ic.systemdAgentFiles(ic.TCArgs, kmuxConfigArgs)
+	}
+	return ic.dockerAgentFiles(ic.TCArgs.ConfigPath)
+}
+
+func (ic *InitConfig) composeProfiles() []string {
+	return []string{"spire-agent", "kubearmor", "accuknox-agents"}
+}
+
+func (jc *JoinConfig) clusterConfig() *ClusterConfig     { return &jc.ClusterConfig }
+func (jc *JoinConfig) templateArgs() *TemplateConfigArgs { return &jc.TCArgs }
+
+func (jc *JoinConfig) agentFiles() ([]agentFile, error) {
+	if jc.Mode == VMMode_Systemd {
+		return jc.systemdAgentFiles(jc.TCArgs, jc.kmuxConfigArgs())
+	}
+	return jc.dockerAgentFiles(jc.TCArgs.ConfigPath)
+}
+
+func (jc *JoinConfig) composeProfiles() []string {
+	profiles := []string{"kubearmor-only"}
+	if jc.DeploySumengine {
+		profiles = append(profiles, "accuknox-agents")
+	}
+	if jc.SpireEnabled {
+		profiles = append(profiles, "spire-agent")
+	}
+	return profiles
+}
+
+// loadUpgradeNode reads the stored knoxctl config of a node
+func loadUpgradeNode(data []byte) (upgradeNode, error) {
+	var hunchConfig struct {
+		ClusterConfig `json:"cluster_config"`
+	}
+	if err := json.Unmarshal(data, &hunchConfig); err != nil {
+		return nil, err
+	}
+	if hunchConfig.AgentsVersion == "" {
+		return nil, fmt.Errorf("the node was not onboarded successfully")
+	}
+
+	var node upgradeNode = new(InitConfig)
+	if hunchConfig.WorkerNode {
+		node = new(JoinConfig)
+	}
+	if err := json.Unmarshal(data, node); err != nil {
+		return nil, err
+	}
+
+	// fields which are not stored
+	cc := node.clusterConfig()
+	if cc.Mode == "" {
+		cc.Mode = VMMode_Docker
+	}
+	cc.TemplateFuncs = sprig.GenericFuncMap()
+	node.templateArgs().SplunkConfigObject = cc.Splunk
+	if cc.Mode == VMMode_Systemd {
+		cc.CreateSystemdServiceObjects()
+	}
+	return node, nil
+}
+
+// storedConfigPath returns the path of the knoxctl config of the onboarded
+// node, the systemd one is looked up first
+func storedConfigPath() (string, error) {
+	path := filepath.Join(cm.SystemdKnoxctlDir, cm.KnoxctlConfigFilename)
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+
+	configPath, err := cm.GetDefaultConfigPath()
+	if err != nil {
+		return "", err
+	}
+	dockerPath := filepath.Join(configPath, cm.KnoxctlConfigFilename)
+	if _, err := os.Stat(dockerPath); err != nil {
+		return "", fmt.Errorf("no onboarded node found, neither %s nor %s exist", path, dockerPath)
+	}
+	return dockerPath, nil
+}
+
+// UpgradeOptions are the options of upgrading an onboarded node
+type UpgradeOptions struct {
+	// Version is the release to upgrade to, the latest one if empty
+	Version     string
+	ReleaseFile string
+
+	Registry           string
+	RegistryConfigPath string
+	Insecure           bool
+	PlainHTTP          bool
+}
+
+// UpgradePlan holds the changes needed to move an onboarded node to a
+// release
+type UpgradePlan struct {
+	NodeType   NodeType      `json:"node_type"`
+	Mode       VMMode        `json:"mode"`
+	Version    string        `json:"version"`
+	NewVersion string        `json:"new_version"`
+	Changes    []AgentChange `json:"changes,omitempty"`
+
+	opts        UpgradeOptions
+	node        upgradeNode
+	configPath  string
+	config      []byte
+	releasePath string
+	files       []agentFile
+	// currentDigests are pinned by the release of the node, the agents are
+	// reinstalled with them on rollback
+	currentDigests map[string]string
+}
+
+// PlanUpgrade compares the stored knoxctl config of the onboarded node with
+// a release and returns the changes of the agent images, config and kmux
+// files
+func PlanUpgrade(opts UpgradeOptions) (*UpgradePlan, error) {
+	configPath, err := storedConfigPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(filepath.Clean(configPath))
+	if err != nil {
+		return nil, err
+	}
+	node, err := loadUpgradeNode(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", configPath, err)
+	}
+	cc := node.clusterConfig()
+
+	plan := &UpgradePlan{
+		NodeType:   NodeType_ControlPlane,
+		Mode:       cc.Mode,
+		Version:    cc.AgentsVersion,
+		opts:       opts,
+		node:       node,
+		configPath: configPath,
+		config:     data,
+	}
+	if cc.WorkerNode {
+		plan.NodeType = NodeType_WorkerNode
+	}
+
+	plan.releasePath = "/opt"
+	if cc.Mode == VMMode_Docker {
+		plan.releasePath, err = cm.GetDefaultConfigPath()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	releases, err := upgradeReleases(opts.ReleaseFile, plan.releasePath)
+	if err != nil {
+		return nil, err
+	}
+
+	plan.NewVersion = opts.Version
+	if plan.NewVersion == "" {
+		for version := range releases {
+			if plan.NewVersion == "" || semver.Compare(version, plan.NewVersion) > 0 {
+				plan.NewVersion = version
+			}
+		}
+	}
+	target, ok := releases[plan.NewVersion]
+	if !ok {
+		return nil, fmt.Errorf("release %s not found", plan.NewVersion)
+	}
+
+	var current *cm.ReleaseMetadata
+	if release, ok := releases[plan.Version]; ok {
+		current = &release
+	} else if version, release := cm.GetReleaseFromBackup(plan.releasePath, plan.Version); version != "" {
+		current = &release
+	} else {
+		logger.Warn("Release %s of the node not found, all images are upgraded", plan.Version)
+	}
+	if current != nil {
+		plan.currentDigests = current.Digests
+	}
+
+	plan.Changes, err = planImages(cc, current, target)
+	if err != nil {
+		return nil, err
+	}
+
+	// move the config to the target release and render its files
+	tcArgs := node.templateArgs()
+	for _, change := range plan.Changes {
+		for _, agent := range upgradeAgents {
+			if agent.key(cc.Mode) == change.Agent {
+				*agent.image(cc) = change.NewImage
+				*agent.tcImage(tcArgs) = change.NewImage
+			}
+		}
+	}
+	cc.AgentsVersion = plan.NewVersion
+	cc.AgentDigests = target.Digests
+	tcArgs.ReleaseVersion = plan.NewVersion
+	if cc.Mode == VMMode_Systemd {
+		cc.CreateSystemdServiceObjects()
+	}
+
+	files, err := node.agentFiles()
+	if err != nil {
+		return nil, err
+	}
+	if err := plan.addFiles(files); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// upgradeReleases returns the known releases: the ones shipped with knoxctl,
+// then the release file of the node and the given release file
+func upgradeReleases(releaseFile, releasePath string) (map[string]cm.ReleaseMetadata, error) {
+	releases := cm.EmbeddedReleaseInfo()
+
+	nodeReleases, err := cm.LoadReleaseInfo(filepath.Join(releasePath, "release.json"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	maps.Copy(releases, nodeReleases)
+
+	if releaseFile != "" {
+		fileReleases, err := cm.LoadReleaseInfo(releaseFile)
+		if err != nil {
+			return nil, err
+		}
+		maps.Copy(releases, fileReleases)
+	}
+	return releases, nil
+}
+
+// addFiles adds the files differing from the ones on disk to the plan
+func (p *UpgradePlan) addFiles(files []agentFile) error {
+	for _, file := range files {
+		current, err := os.ReadFile(file.path())
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err == nil && sameContent(current, file.data) {
+			continue
+		}
+		p.files = append(p.files, file)
+
+		agents := []string{file.agent}
+		if file.agent == "" && file.name == composeFileName {
+			agents, err = composeChanges(current, file.data)
+			if err != nil {
+				return err
+			}
+		}
+		for _, agent := range agents {
+			p.addFile(agent, file.path())
+		}
+	}
+	return nil
+}
+
+func (p *UpgradePlan) addFile(agent, path string) {
+	for i := range p.Changes {
+		if p.Changes[i].Agent == agent {
+			p.Changes[i].Files = append(p.Changes[i].Files, path)
+			return
+		}
+	}
+	p.Changes = append(p.Changes, AgentChange{Agent: agent, Files: []string{path}})
+}
+
+// UpToDate returns whether there is nothing to change
+func (p *UpgradePlan) UpToDate() bool {
+	for _, change := range p.Changes {
+		if change.restart() {
+			return false
+		}
+	}
+	return true
+}
+
+// Print writes the plan as a table
+func (p *UpgradePlan) Print(w io.Writer) {
+	fmt.Fprintf(w, "Upgrading %s node (%s) from %s to %s\n", p.NodeType, p.Mode, p.Version, p.NewVersion)
+
+	table := tablewriter.NewWriter(w)
+	table.SetHeader([]string{"Agent", "Image", "New Image", "Files"})
+	table.SetAutoWrapText(false)
+	for _, change := range p.Changes {
+		newImage := change.NewImage
+		if change.Pinned {
+			newImage = "(pinned)"
+		} else if newImage == change.Image {
+			newImage = "-"
+		}
+		table.Append([]string{change.Agent, change.Image, newImage, strings.Join(change.Files, "\n")})
+	}
+	table.Render()
+}
+
+// Apply upgrades the node as planned, only the agents with changes are
+// restarted. On failure, the files, images and release file of the node are
+// rolled back.
+func (p *UpgradePlan) Apply() error {
+	if p.UpToDate() {
+		return nil
+	}
+	cc := p.node.clusterConfig()
+
+	switch cc.Mode {
+	case VMMode_Systemd:
+		loginOptions := LoginOptions{
+			Insecure:           p.opts.Insecure || cc.InsecureTLS,
+			PlainHTTP:          p.opts.PlainHTTP || cc.PlainHTTP,
+			Registry:           p.opts.Registry,
+			RegistryConfigPath: p.opts.RegistryConfigPath,
+		}
+		loginOptions.PlainHTTP = loginOptions.isPlainHttp(p.opts.Registry)
+		cc.PlainHTTP = loginOptions.PlainHTTP
+
+		var err error
+		cc.ORASClient, err = loginOptions.ORASGetAuthClient()
+		if err != nil {
+			return err
+		}
+	case VMMode_Docker:
+		if _, err := cc.ValidateEnv(); err != nil {
+			return err
+		}
+	}
+
+	releaseFile := filepath.Join(p.releasePath, "release.json")
+	_, statErr := os.Stat(releaseFile)
+	releaseExisted := statErr == nil
+	if p.opts.ReleaseFile != "" {
+		msg, err := cm.GetOrWriteReleaseInfo(p.opts.ReleaseFile, p.releasePath)
+		if err != nil {
+			return err
+		}
+		logger.Info1("%v", msg)
+	}
+
+	backups := make(map[string]*fileBackup)
+	err := p.apply(backups)
+	if err == nil {
+		return DumpConfig(p.node, p.configPath)
+	}
+
+	logger.Warn("Upgrade failed: %s\nRolling back...", err.Error())
+	var rollbackErrs []string
+	if rbErr := p.rollback(backups); rbErr != nil {
+		rollbackErrs = append(rollbackErrs, rbErr.Error())
+	}
+	if p.opts.ReleaseFile != "" {
+		if rbErr := restoreReleaseInfo(releaseFile, releaseExisted); rbErr != nil {
+			rollbackErrs = append(rollbackErrs, rbErr.Error())
+		}
+	}
+	if len(rollbackErrs) > 0 {
+		return fmt.Errorf("upgrade failed: %v, rollback failed: %s", err, strings.Join(rollbackErrs, ", "))
+	}
+	return fmt.Errorf("upgrade failed and was rolled back: %v", err)
+}
+
+// fileBackup is the content and mode of a file replaced by an upgrade
+type fileBackup struct {
+	data []byte
+	mode os.FileMode
+}
+
+// apply writes the files and restarts the changed agents, the replaced
+// files are saved in backups
+func (p *UpgradePlan) apply(backups map[string]*fileBackup) error {
+	cc := p.node.clusterConfig()
+
+	if cc.Mode == VMMode_Systemd {
+		for _, change := range p.Changes {
+			if !change.restart() {
+				continue
+			}
+			obj, ok := cc.systemdService(change.Agent)
+			if !ok {
+				continue
+			}
+
+			// stop the service first otherwise errors are encountered due to
+			// busy binary
+			if err := StopSystemdService(obj.ServiceName, true, false); err != nil {
+				logger.Warn("Failed to stop systemd service %s: %s", obj.ServiceName, err.Error())
+			}
+			if change.NewImage == change.Image {
+				continue
+			}
+
+			logger.Print("Downloading Agent - %s | Image - %s", obj.AgentName, change.NewImage)
+			packageMeta := splitLast(change.NewImage, ":")
+			if err := cc.installAgent(obj.AgentName, packageMeta[0], packageMeta[1]); err != nil {
+				return err
+			}
+		}
+		defer Deletedir(cm.DownloadDir)
+	}
+
+	for _, file := range p.files {
+		info, err := os.Stat(file.path())
+		if os.IsNotExist(err) {
+			// nil for files which did not exist
+			backups[file.path()] = nil
+		} else if err != nil {
+			return err
+		} else {
+			data, err := os.ReadFile(file.path())
+			if err != nil {
+				return err
+			}
+			backups[file.path()] = &fileBackup{data: data, mode: info.Mode().Perm()}
+		}
+		if err := file.write(); err != nil {
+			return err
+		}
+	}
+
+	return p.restart(p.node)
+}
+
+// restart restarts the changed agents with the config of the node
+func (p *UpgradePlan) restart(node upgradeNode) error {
+	cc := node.clusterConfig()
+
+	if cc.Mode == VMMode_Docker {
+		var services []string
+		for _, change := range p.Changes {
+			if change.restart() {
+				services = append(services, change.Agent)
+			}
+		}
+
+		args := []string{"-f", filepath.Join(node.templateArgs().ConfigPath, composeFileName)}
+		for _, profile := range node.composeProfiles() {
+			args = append(args, "--profile", profile)
+		}
+		args = append(args, "up", "-d", "--no-deps", "--force-recreate")
+		if semver.Compare(cc.composeVersion, cm.MinDockerComposeWithWaitSupported) >= 0 {
+			args = append(args, "--wait", "--wait-timeout", "60")
+		}
+		args = append(args, services...)
+
+		_, err := ExecComposeCommand(true, false, cc.composeCmd, args...)
+		return err
+	}
+
+	if err := cc.placeServiceFiles(); err != nil {
+		return err
+	}
+	for _, change := range p.Changes {
+		if !change.restart() {
+			continue
+		}
+		obj, ok := cc.systemdService(change.Agent)
+		if !ok {
+			continue
+		}
+		if err := StartSystemdService(obj.ServiceName); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rollback restores the replaced files and the previous images of the
+// agents, then restarts them
+func (p *UpgradePlan) rollback(backups map[string]*fileBackup) error {
+	for path, backup := range backups {
+		if backup == nil {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			continue
+		}
+		if err := os.WriteFile(path, backup.data, backup.mode); err != nil {
+			return err
+		}
+		// WriteFile keeps the mode of an existing file
+		if err := os.Chmod(path, backup.mode); err != nil {
+			return err
+		}
+	}
+
+	node, err := p.rollbackNode()
+	if err != nil {
+		return err
+	}
+	cc := node.clusterConfig()
+
+	if cc.Mode == VMMode_Systemd {
+		for _, change := range p.Changes {
+			if change.NewImage == change.Image {
+				continue
+			}
+			obj, ok := cc.systemdService(change.Agent)
+			if !ok {
+				continue
+			}
+			if err := StopSystemdService(obj.ServiceName, true, false); err != nil {
+				logger.Warn("Failed to stop systemd service %s: %s", obj.ServiceName, err.Error())
+			}
+			packageMeta := splitLast(change.Image, ":")
+			if err := cc.installAgent(obj.AgentName, packageMeta[0], packageMeta[1]); err != nil {
+				return err
+			}
+		}
+		defer Deletedir(cm.DownloadDir)
+	}
+
+	return p.restart(node)
+}
+
+// rollbackNode returns the node as stored before the upgrade, with the
+// clients of the upgrade and the digests of its release, which are not stored
+func (p *UpgradePlan) rollbackNode() (upgradeNode, error) {
+	node, err := loadUpgradeNode(p.config)
+	if err != nil {
+		return nil, err
+	}
+	cc := node.clusterConfig()
+	cc.ORASClient = p.node.clusterConfig().ORASClient
+	cc.PlainHTTP = p.node.clusterConfig().PlainHTTP
+	cc.ContainerRuntime = p.node.clusterConfig().ContainerRuntime
+	cc.composeCmd = p.node.clusterConfig().composeCmd
+	cc.composeVersion = p.node.clusterConfig().composeVersion
+	cc.AgentDigests = p.currentDigests
+	return node, nil
+}
+
+// systemdService returns the service object installing an agent
+func (cc *ClusterConfig) systemdService(agentName string) (SystemdServiceObject, bool) {
+	for _, obj := range cc.SystemdServiceObjects {
+		if obj.AgentName == agentName && obj.ServiceName != "" {
+			return obj, true
+		}
+	}
+	return SystemdServiceObject{}, false
+}
+
+// restoreReleaseInfo puts back the release file saved as release.json.bak
+// when a release file was given
+func restoreReleaseInfo(releaseFile string, existed bool) error {
+	if !existed {
+		return cm.RemoveReleaseFile(releaseFile)
+	}
+	return cm.MoveReleaseFile(releaseFile+".bak", releaseFile)
+}
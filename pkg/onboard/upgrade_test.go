@@ -0,0 +1,167 @@
+package onboard
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	cm "github.com/accuknox/accuknox-cli-v2/pkg/common"
+)
+
+func TestPlanImages(t *testing.T) {
+	current := cm.ReleaseMetadata{KubeArmorTag: "v1.4.0", KubeArmorVMAdapterTag: "v0.9.0", SIATag: "v0.9.0", SumEngineTag: "v0.9.0"}
+	target := cm.ReleaseMetadata{KubeArmorTag: "v1.5.0", KubeArmorVMAdapterTag: "v0.9.0", SIATag: "v0.10.0", SumEngineTag: "v0.10.0"}
+
+	tests := []struct {
+		name    string
+		cc      ClusterConfig
+		current *cm.ReleaseMetadata
+		want    []AgentChange
+	}{
+		{
+			name: "docker worker node",
+			cc: ClusterConfig{
+				Mode:                    VMMode_Docker,
+				WorkerNode:              true,
+				KubeArmorImage:          "docker.io/kubearmor/kubearmor:v1.4.0",
+				KubeArmorVMAdapterImage: "docker.io/accuknox/vm-adapter:v0.9.0",
+				SIAImage:                "docker.io/accuknox/sia:v0.9.0",
+				SumEngineImage:          "docker.io/accuknox/sumengine:v0.9.0",
+			},
+			current: &current,
+			want: []AgentChange{
+				{Agent: "kubearmor", Image: "docker.io/kubearmor/kubearmor:v1.4.0", NewImage: "docker.io/kubearmor/kubearmor:v1.5.0"},
+			},
+		},
+		{
+			name: "systemd control plane node",
+			cc: ClusterConfig{
+				Mode:           VMMode_Systemd,
+				KubeArmorImage: "docker.io/kubearmor/kubearmor-systemd:1.4.0" + cm.SystemdTagSuffix,
+				SIAImage:       "docker.io/accuknox/sia-systemd:0.9.0" + cm.SystemdTagSuffix,
+				SumEngineImage: "docker.io/accuknox/sumengine-systemd:0.9.0" + cm.SystemdTagSuffix,
+			},
+			current: &current,
+			want: []AgentChange{
+				{Agent: cm.KubeArmor, Image: "docker.io/kubearmor/kubearmor-systemd:1.4.0" + cm.SystemdTagSuffix, NewImage: "docker.io/kubearmor/kubearmor-systemd:1.5.0" + cm.SystemdTagSuffix},
+				{Agent: cm.SIAAgent, Image: "docker.io/accuknox/sia-systemd:0.9.0" + cm.SystemdTagSuffix, NewImage: "docker.io/accuknox/sia-systemd:0.10.0" + cm.SystemdTagSuffix},
+				{Agent: cm.SummaryEngine, Image: "docker.io/accuknox/sumengine-systemd:0.9.0" + cm.SystemdTagSuffix, NewImage: "docker.io/accuknox/sumengine-systemd:0.10.0" + cm.SystemdTagSuffix},
+			},
+		},
+		{
+			name: "pinned image",
+			cc: ClusterConfig{
+				Mode:           VMMode_Docker,
+				KubeArmorImage: "registry.local/kubearmor/kubearmor:dev",
+				SIAImage:       "docker.io/accuknox/sia:v0.9.0",
+			},
+			current: &current,
+			want: []AgentChange{
+				{Agent: "kubearmor", Image: "registry.local/kubearmor/kubearmor:dev", NewImage: "registry.local/kubearmor/kubearmor:dev", Pinned: true},
+				{Agent: "shared-informer-agent", Image: "docker.io/accuknox/sia:v0.9.0", NewImage: "docker.io/accuknox/sia:v0.10.0"},
+			},
+		},
+		{
+			name: "unknown current release",
+			cc: ClusterConfig{
+				Mode:           VMMode_Docker,
+				KubeArmorImage: "registry.local/kubearmor/kubearmor:dev",
+			},
+			want: []AgentChange{
+				{Agent: "kubearmor", Image: "registry.local/kubearmor/kubearmor:dev", NewImage: "registry.local/kubearmor/kubearmor:v1.5.0"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := planImages(&tt.cc, tt.current, target)
+			if err != nil {
+				t.Fatalf("planImages() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("planImages() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSameContent(t *testing.T) {
+	a := []byte("queue: agents-policies-vm-1-1712345678\nconnection: agents-vm-1-sia-1712345678\n")
+	b := []byte("queue: agents-policies-vm-1-1723456789\nconnection: agents-vm-1-sia-1723456789\n")
+	if !sameContent(a, b) {
+		t.Errorf("sameContent() = false for files differing only in timestamps")
+	}
+	if sameContent(a, []byte("queue: agents-policies-vm-2-1712345678\n")) {
+		t.Errorf("sameContent() = true for different files")
+	}
+}
+
+func TestComposeChanges(t *testing.T) {
+	current := []byte(`
+services:
+  kubearmor:
+    image: kubearmor/kubearmor:v1.4.0
+  kubearmor-vm-adapter:
+    image: accuknox/vm-adapter:v0.9.0
+`)
+	target := []byte(`
+services:
+  kubearmor:
+    image: kubearmor/kubearmor:v1.5.0
+  kubearmor-vm-adapter:
+    image: accuknox/vm-adapter:v0.9.0
+  summary-engine:
+    image: accuknox/sumengine:v0.10.0
+`)
+	got, err := composeChanges(current, target)
+	if err != nil {
+		t.Fatalf("composeChanges() error = %v", err)
+	}
+	want := []string{"kubearmor", "summary-engine"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("composeChanges() = %v, want %v", got, want)
+	}
+}
+
+func TestRollbackNodeDigests(t *testing.T) {
+	defer func(skip bool) { cm.SkipReleaseVerification = skip }(cm.SkipReleaseVerification)
+	cm.SkipReleaseVerification = false
+
+	const (
+		repo   = "docker.io/kubearmor/kubearmor-systemd"
+		digest = "sha256:aaaa"
+	)
+	tag := "1.4.0" + cm.SystemdTagSuffix
+	stored := &InitConfig{ClusterConfig: ClusterConfig{
+		Mode:           VMMode_Systemd,
+		AgentsVersion:  "v0.9.0",
+		KubeArmorImage: repo + ":" + tag,
+	}}
+	config, err := json.Marshal(stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	upgraded, err := loadUpgradeNode(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	upgraded.clusterConfig().AgentDigests = map[string]string{"kubearmor-systemd:1.5.0" + cm.SystemdTagSuffix: "sha256:bbbb"}
+	p := &UpgradePlan{
+		node:           upgraded,
+		config:         config,
+		currentDigests: map[string]string{"kubearmor-systemd:" + tag: digest},
+	}
+
+	node, err := p.rollbackNode()
+	if err != nil {
+		t.Fatalf("rollbackNode() error = %v", err)
+	}
+	cc := node.clusterConfig()
+	if err := cc.verifyDigest(repo, tag, digest); err != nil {
+		t.Errorf("verifyDigest() of the previous agent error = %v", err)
+	}
+	if err := cc.verifyDigest(repo, tag, "sha256:bbbb"); err == nil {
+		t.Errorf("verifyDigest() of a tampered previous agent succeeded")
+	}
+}
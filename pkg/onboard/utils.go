@@ -17,7 +17,6 @@ import (
 
 	cm "github.com/accuknox/accuknox-cli-v2/pkg/common"
 	se_splunk "github.com/accuknox/dev2/sumengine/pkg/sumengine/kubearmor"
-	"github.com/docker/docker/client"
 	"github.com/golang-jwt/jwt"
 	"golang.org/x/mod/semver"
 )
@@ -83,6 +82,17 @@ func parseURL(address string) (string, string, error) {
 
 // copyOrGenerateFile copies a a config file from userConfigDir to the given path or writes file with the given template at the given path
 func copyOrGenerateFile(userConfigDir, dirPath, filePath string, tempFuncs template.FuncMap, templateString string, templateArgs interface{}) (string, error) {
+	data, err := generateFile(userConfigDir, filePath, tempFuncs, templateString, templateArgs)
+	if err != nil {
+		return "", err
+	}
+
+	return writeFile(dirPath, filePath, data)
+}
+
+// generateFile returns the content of a config file, read from the config
+// path given by the user or generated with the template
+func generateFile(userConfigDir, filePath string, tempFuncs template.FuncMap, templateString string, templateArgs interface{}) ([]byte, error) {
 	dataFile := &bytes.Buffer{}
 
 	// if user specified a config path - read if the given file
@@ -90,14 +100,14 @@ func copyOrGenerateFile(userConfigDir, dirPath, filePath string, tempFuncs templ
 	if userConfigDir != "" {
 		userConfigFilePath := filepath.Join(userConfigDir, filePath)
 		if _, err := os.Stat(userConfigFilePath); err != nil {
-			return "", fmt.Errorf("error while opening user specified file: %s", err.Error())
+			return nil, fmt.Errorf("error while opening user specified file: %s", err.Error())
 		}
 
 		userFileBytes, err := os.ReadFile(userConfigFilePath) // #nosec G304
 		if err != nil {
-			return "", err
+			return nil, err
 		} else if len(userFileBytes) == 0 {
-			return "", fmt.Errorf("empty config file given at %s", userConfigFilePath)
+			return nil, fmt.Errorf("empty config file given at %s", userConfigFilePath)
 		}
 
 		dataFile = bytes.NewBuffer(userFileBytes)
@@ -106,19 +116,24 @@ func copyOrGenerateFile(userConfigDir, dirPath, filePath string, tempFuncs templ
 		// generate the file with the template
 		templateFile, err := template.New(filePath).Funcs(tempFuncs).Parse(templateString)
 		if err != nil {
-			return "", err
+			return nil, err
 		}
 
 		err = templateFile.Execute(dataFile, templateArgs)
 		if err != nil {
-			return "", err
+			return nil, err
 		}
 	}
 
 	if dataFile == nil || len(dataFile.Bytes()) == 0 {
-		return "", fmt.Errorf("Failed to read config file for %s: Empty file", filePath)
+		return nil, fmt.Errorf("Failed to read config file for %s: Empty file", filePath)
 	}
 
+	return dataFile.Bytes(), nil
+}
+
+// writeFile writes a config file at dirPath/filePath
+func writeFile(dirPath, filePath string, data []byte) (string, error) {
 	fullFilePath := filepath.Join(dirPath, filePath)
 	fullFileDir := filepath.Dir(fullFilePath)
 
@@ -139,7 +154,7 @@ func copyOrGenerateFile(userConfigDir, dirPath, filePath string, tempFuncs templ
 	}
 	defer resultFile.Close()
 
-	_, err = dataFile.WriteTo(resultFile)
+	_, err = resultFile.Write(data)
 	if err != nil {
 		return "", err
 	}
@@ -147,7 +162,25 @@ func copyOrGenerateFile(userConfigDir, dirPath, filePath string, tempFuncs templ
 	return fullFilePath, nil
 }
 
-func compareVersionsAndGetComposeCommand(v1, v1Cmd, v2, v2Cmd string) (string, string) {
+// agentFile is a generated config or kmux config file of an agent
+type agentFile struct {
+	// agent is the systemd agent name or the compose service using the file
+	agent string
+	dir   string
+	name  string
+	data  []byte
+}
+
+func (f agentFile) path() string {
+	return filepath.Join(f.dir, f.name)
+}
+
+func (f agentFile) write() error {
+	_, err := writeFile(f.dir, f.name, f.data)
+	return err
+}
+
+func compareVersionsAndGetComposeCommand(v1, v1Cmd, v2, v2Cmd, minVersion string) (string, string) {
 	v1Clean := strings.TrimSpace(string(v1))
 	v2Clean := strings.TrimSpace(string(v2))
 
@@ -160,9 +193,9 @@ func compareVersionsAndGetComposeCommand(v1, v1Cmd, v2, v2Cmd string) (string, s
 			v2Clean = "v" + v2Clean
 		}
 
-		if semver.Compare(v1Clean, v2Clean) >= 0 && semver.Compare(v1Clean, cm.MinDockerComposeVersion) >= 0 {
+		if semver.Compare(v1Clean, v2Clean) >= 0 && semver.Compare(v1Clean, minVersion) >= 0 {
 			return v1Cmd, v1Clean
-		} else if semver.Compare(v1Clean, v2Clean) <= 0 && semver.Compare(v2Clean, cm.MinDockerComposeVersion) >= 0 {
+		} else if semver.Compare(v1Clean, v2Clean) <= 0 && semver.Compare(v2Clean, minVersion) >= 0 {
 			return v2Cmd, v2Clean
 		} else {
 			return "", ""
@@ -173,7 +206,7 @@ func compareVersionsAndGetComposeCommand(v1, v1Cmd, v2, v2Cmd string) (string, s
 			v1Clean = "v" + v1Clean
 		}
 
-		if semver.Compare(v1Clean, cm.MinDockerComposeVersion) >= 0 {
+		if semver.Compare(v1Clean, minVersion) >= 0 {
 			return v1Cmd, v1Clean
 		} else {
 			return "", ""
@@ -183,7 +216,7 @@ func compareVersionsAndGetComposeCommand(v1, v1Cmd, v2, v2Cmd string) (string, s
 			v2Clean = "v" + v2Clean
 		}
 
-		if semver.Compare(v2Clean, cm.MinDockerComposeVersion) >= 0 {
+		if semver.Compare(v2Clean, minVersion) >= 0 {
 			return v2Cmd, v2Clean
 		} else {
 			return "", ""
@@ -193,17 +226,18 @@ func compareVersionsAndGetComposeCommand(v1, v1Cmd, v2, v2Cmd string) (string, s
 	return "", ""
 }
 
-// GetComposeCommand gets the compose command with perfect version
+// GetComposeCommand gets the compose command of a container runtime with
+// perfect version, the runtime is detected if empty
 // caller must check for empty
-func GetComposeCommand() (string, string, error) {
-	var (
-		err            error
-		tryComposeCMDs = []string{"docker-compose", "docker compose"}
-		minVersion     = cm.MinDockerComposeVersion
-		prevCommand    = ""
-	)
-
-	for _, command := range tryComposeCMDs {
+func GetComposeCommand(runtime ContainerRuntime) (string, string, error) {
+	runtime, err := DetectContainerRuntime(runtime)
+	if err != nil {
+		return "", "", err
+	}
+
+	var prevCommand string
+	for _, command := range runtime.composeCommands() {
+		minVersion := minComposeVersion(command)
 		version, execErr := ExecComposeCommand(false, false, command, "version", "--short")
 		if execErr != nil {
 			if err != nil {
@@ -215,7 +249,7 @@ func GetComposeCommand() (string, string, error) {
 			continue
 		}
 
-		composeCmd, finalVersion := compareVersionsAndGetComposeCommand(version, command, minVersion, prevCommand)
+		composeCmd, finalVersion := compareVersionsAndGetComposeCommand(parseComposeVersion(version), command, minVersion, prevCommand, minVersion)
 		if composeCmd != "" {
 			return composeCmd, finalVersion, nil
 		}
@@ -225,16 +259,20 @@ func GetComposeCommand() (string, string, error) {
 	}
 
 	if err != nil {
-		return "", "", fmt.Errorf("docker requirements not met: %s", err.Error())
+		return "", "", fmt.Errorf("%s requirements not met: %s", runtime, err.Error())
 	}
 
-	return "", "", fmt.Errorf("docker requirements not met")
+	return "", "", fmt.Errorf("%s requirements not met", runtime)
 }
 
 func ExecComposeCommand(setStdOut, dryRun bool, tryCmd string, args ...string) (string, error) {
-	if !strings.Contains(tryCmd, "docker") {
+	if !knownComposeCommand(tryCmd) {
 		return "", fmt.Errorf("Command %s not supported", tryCmd)
 	}
+	if dryRun && !composeDryRunSupported(tryCmd) {
+		fmt.Printf("Dry run, skipping: %s %s\n", tryCmd, strings.Join(args, " "))
+		return "", nil
+	}
 
 	composeCmd := new(exec.Cmd)
 
@@ -314,21 +352,38 @@ func ExecDockerCommand(setStdOut, dryRun bool, tryCmd string, args ...string) (s
 	return string(stdout), nil
 }
 
-// validate the environment
+// validate the environment, detecting the container runtime if not set
 func (cc *ClusterConfig) ValidateEnv() (string, error) {
-	// check if docker exists
-	_, err := exec.LookPath("docker")
+	runtime, err := DetectContainerRuntime(cc.ContainerRuntime)
 	if err != nil {
-		return "", fmt.Errorf("Error while looking for docker. Err: %s. Please install docker %s+.", err.Error(), cm.MinDockerVersion)
+		return "", err
 	}
+	if runtime == ContainerRuntime_Docker {
+		if err := validateDockerVersion(); err != nil {
+			return "", err
+		}
+	}
+
+	composeCmd, composeVersion, err := GetComposeCommand(runtime)
+	if err != nil {
+		return "", fmt.Errorf("Error: %s. Please install %s", err.Error(), runtime.composeRequirement())
+	}
+	cc.ContainerRuntime = runtime
+	cc.composeCmd = composeCmd
+	cc.composeVersion = composeVersion
 
+	return fmt.Sprintf("Using %s version %s\n", composeCmd, composeVersion), nil
+}
+
+// validateDockerVersion checks the version of the docker server
+func validateDockerVersion() error {
 	serverVersionCmd := exec.Command("docker", "version", "-f", "{{.Server.Version}}")
 	serverVersion, err := serverVersionCmd.Output()
 	if err != nil {
 		if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
-			return "", errors.New(string(exitErr.Stderr))
+			return errors.New(string(exitErr.Stderr))
 		}
-		return "", err
+		return err
 	}
 
 	serverVersionStr := strings.TrimSpace(string(serverVersion))
@@ -338,28 +393,11 @@ func (cc *ClusterConfig) ValidateEnv() (string, error) {
 		}
 
 		if semver.Compare(serverVersionStr, cm.MinDockerVersion) < 0 {
-			return "", fmt.Errorf("docker version %s not supported", serverVersionStr)
+			return fmt.Errorf("docker version %s not supported", serverVersionStr)
 		}
 	}
 
-	composeCmd, composeVersion, err := GetComposeCommand()
-	if err != nil {
-		return "", fmt.Errorf("Error: %s. Please install docker-compose %s+", err.Error(), cm.MinDockerComposeVersion)
-	}
-	cc.composeCmd = composeCmd
-	cc.composeVersion = composeVersion
-
-	return fmt.Sprintf("Using %s version %s\n", composeCmd, composeVersion), nil
-}
-
-func CreateDockerClient() (*client.Client, error) {
-
-	dockerClient, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
-	if err != nil {
-		return nil, err
-	}
-
-	return dockerClient, nil
+	return nil
 }
 
 func verifyBTF() (bool, error) {
@@ -0,0 +1,146 @@
+package recommend
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	policyType "github.com/accuknox/dev2/hardening/pkg/types"
+)
+
+const (
+	minSeverity = 1
+	maxSeverity = 10
+)
+
+// parseSeverity parses a comma separated list of severities and severity
+// ranges, e.g. `7`, `5-8` or `1,4-6`, and returns every severity included
+func parseSeverity(value string) ([]int, error) {
+	var severities []int
+	seen := make(map[int]bool)
+
+	for _, part := range strings.Split(strings.Trim(value, "\"'"), ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		from, to := part, part
+		if i := strings.Index(part, "-"); i != -1 {
+			from, to = part[:i], part[i+1:]
+		}
+
+		low, err := strconv.Atoi(from)
+		if err != nil {
+			return nil, fmt.Errorf("invalid severity %q", part)
+		}
+		high, err := strconv.Atoi(to)
+		if err != nil {
+			return nil, fmt.Errorf("invalid severity %q", part)
+		}
+		if low > high || low < minSeverity || high > maxSeverity {
+			return nil, fmt.Errorf("invalid severity range %q, severities are between %d and %d", part, minSeverity, maxSeverity)
+		}
+
+		for s := low; s <= high; s++ {
+			if !seen[s] {
+				seen[s] = true
+				severities = append(severities, s)
+			}
+		}
+	}
+
+	if len(severities) == 0 {
+		return nil, fmt.Errorf("no severity found in %q", value)
+	}
+	return severities, nil
+}
+
+// matchTag reports whether any of the policy tags belongs to the given tag or
+// compliance framework. `NIST` matches `NIST` as well as `NIST_800-53_SI-4`.
+func matchTag(tags []string, filter string) bool {
+	for _, tag := range tags {
+		if strings.EqualFold(tag, filter) {
+			return true
+		}
+		if len(tag) > len(filter) && strings.EqualFold(tag[:len(filter)], filter) && strings.ContainsRune("_- ", rune(tag[len(filter)])) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterPolicy applies the severity, tag, action and label filters to a
+// policy. Filters are ORed within a flag and ANDed across flags.
+func (o *Options) filterPolicy(policy *policyType.KubeArmorPolicy) bool {
+	if len(o.SeveritySlice) > 0 {
+		matched := false
+		for _, s := range o.SeveritySlice {
+			if policy.Spec.Severity == s {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	if len(o.Tags) > 0 || len(o.TagsRegex) > 0 {
+		matched := false
+		for _, tag := range o.Tags {
+			if matchTag(policy.Spec.Tags, tag) {
+				matched = true
+				break
+			}
+		}
+		for _, regex := range o.TagsRegex {
+			for _, tag := range policy.Spec.Tags {
+				if regex.MatchString(tag) {
+					matched = true
+					break
+				}
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	if len(o.Action) > 0 {
+		matched := false
+		for _, action := range o.Action {
+			if strings.EqualFold(policy.Spec.Action, action) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	if len(o.Labels) > 0 || len(o.LabelsRegex) > 0 {
+		matched := false
+		for _, label := range o.Labels {
+			kv := strings.SplitN(label, "=", 2)
+			if len(kv) == 2 && policy.Spec.Selector.MatchLabels[kv[0]] == kv[1] {
+				matched = true
+				break
+			}
+		}
+		for _, regex := range o.LabelsRegex {
+			for k, v := range policy.Spec.Selector.MatchLabels {
+				if regex.MatchString(k + "=" + v) {
+					matched = true
+					break
+				}
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	return true
+}
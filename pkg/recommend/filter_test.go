@@ -0,0 +1,73 @@
+package recommend
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+
+	policyType "github.com/accuknox/dev2/hardening/pkg/types"
+)
+
+func TestParseSeverity(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected []int
+		err      bool
+	}{
+		{"7", []int{7}, false},
+		{"5-8", []int{5, 6, 7, 8}, false},
+		{"1,4-6", []int{1, 4, 5, 6}, false},
+		{"4-6,5", []int{4, 5, 6}, false},
+		{"\"9-10\"", []int{9, 10}, false},
+		{"8-5", nil, true},
+		{"0-3", nil, true},
+		{"11", nil, true},
+		{"high", nil, true},
+		{"", nil, true},
+	}
+
+	for _, test := range tests {
+		got, err := parseSeverity(test.value)
+		if (err != nil) != test.err {
+			t.Errorf("parseSeverity(%q) error = %v, expected error: %v", test.value, err, test.err)
+		}
+		if !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("parseSeverity(%q) = %v, expected %v", test.value, got, test.expected)
+		}
+	}
+}
+
+func TestFilterPolicy(t *testing.T) {
+	policy := &policyType.KubeArmorPolicy{}
+	policy.Spec.Severity = 5
+	policy.Spec.Action = "Block"
+	policy.Spec.Tags = []string{"NIST", "NIST_800-53_SI-4", "MITRE_T1036_masquerading"}
+	policy.Spec.Selector.MatchLabels = map[string]string{"app": "nginx"}
+
+	tests := []struct {
+		name     string
+		options  Options
+		expected bool
+	}{
+		{"no filters", Options{}, true},
+		{"severity in range", Options{SeveritySlice: []int{4, 5, 6}}, true},
+		{"severity out of range", Options{SeveritySlice: []int{7, 8}}, false},
+		{"framework tag", Options{Tags: []string{"mitre"}}, true},
+		{"any of the tags", Options{Tags: []string{"CIS", "NIST"}}, true},
+		{"tag prefix must end at a separator", Options{Tags: []string{"NIS"}}, false},
+		{"missing framework", Options{Tags: []string{"PCI_DSS"}}, false},
+		{"tag regex", Options{TagsRegex: []*regexp.Regexp{regexp.MustCompile("SI-[0-9]")}}, true},
+		{"action", Options{Action: []string{"block"}}, true},
+		{"other action", Options{Action: []string{"Audit"}}, false},
+		{"label", Options{Labels: []string{"app=nginx"}}, true},
+		{"all filters are required", Options{SeveritySlice: []int{5}, Tags: []string{"NIST"}, Action: []string{"Audit"}}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.options.filterPolicy(policy); got != test.expected {
+				t.Errorf("filterPolicy() = %v, expected %v", got, test.expected)
+			}
+		})
+	}
+}
@@ -12,6 +12,8 @@ type Options struct {
 	Namespace []string `flag:"namespace"`
 	Labels    []string `flag:"labels"`
 	Tags      []string `flag:"tags"`
+	Action    []string `flag:"action"`
+	Severity  string   `flag:"severity"`
 	Policy    []string `flag:"policy"`
 	Outdir    string   `flag:"out"`
 	Grpc      string   `flag:"gRPC"`
@@ -24,8 +26,10 @@ type Options struct {
 	SeveritySlice  []int
 }
 
-func (o *Options) noFilter() bool {
-	return len(o.Namespace) == 0 && len(o.Labels) == 0 && len(o.Tags) == 0 && len(o.NamespaceRegex) == 0 && len(o.LabelsRegex) == 0 && len(o.TagsRegex) == 0
+// noNamespaceFilter reports whether policies of all the namespaces are to be
+// fetched, the remaining filters are applied on the fetched policies
+func (o *Options) noNamespaceFilter() bool {
+	return len(o.Namespace) == 0 && len(o.NamespaceRegex) == 0
 }
 
 func ProcessArgs(rawArgs string) (*Options, error) {
@@ -59,7 +63,16 @@ func ProcessArgs(rawArgs string) (*Options, error) {
 			parsedOption.View, err = parser.ParseString(rawArgs, flag)
 
 		case flag == "severity" || flag == "s":
-			parsedOption.SeveritySlice, err = parser.ParseInt(rawArgs, flag)
+			parsedOption.Severity = values
+			parsedOption.SeveritySlice, err = parseSeverity(values)
+
+		case flag == "action" || flag == "a":
+			parsedOption.Action, err = parser.ParseStringSlice(rawArgs, flag)
+			for _, action := range parsedOption.Action {
+				if !isValidAction(action) {
+					err = fmt.Errorf("invalid action %s, expected one of Allow, Audit or Block", action)
+				}
+			}
 
 		case flag == "namespace" || flag == "n":
 			parsedOption.Namespace, regexList, err = parser.ParseRegexSlice(values, flag)
@@ -88,6 +101,15 @@ func ProcessArgs(rawArgs string) (*Options, error) {
 	return parsedOption, nil
 }
 
+func isValidAction(action string) bool {
+	for _, valid := range []string{"Allow", "Audit", "Block"} {
+		if strings.EqualFold(action, valid) {
+			return true
+		}
+	}
+	return false
+}
+
 func wrapErr(err error) error {
 	if err != nil {
 		return fmt.Errorf("error parsing flag: %v", err)
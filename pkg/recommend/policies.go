@@ -61,7 +61,9 @@ func getKaPolicy(c *k8s.Client, o *Options) error {
 					continue
 				}
 
-				policyBucket.AddPolicy(policy.Namespace, &kaPolicy)
+				if o.filterPolicy(&kaPolicy) {
+					policyBucket.AddPolicy(policy.Namespace, &kaPolicy)
+				}
 
 				_ = bar.Add(1)
 			}
@@ -90,7 +92,9 @@ func getKaPolicy(c *k8s.Client, o *Options) error {
 					return err
 				}
 
-				policyBucket.AddPolicy(policy.Namespace, &kaPolicy)
+				if o.filterPolicy(&kaPolicy) {
+					policyBucket.AddPolicy(policy.Namespace, &kaPolicy)
+				}
 
 				_ = bar.Add(1)
 			}
@@ -100,7 +104,7 @@ func getKaPolicy(c *k8s.Client, o *Options) error {
 		return nil
 	}
 
-	if o.noFilter() {
+	if o.noNamespaceFilter() {
 		err := getAllPolicies()
 		if err != nil {
 			return err
@@ -156,6 +160,9 @@ func getKaPolicy(c *k8s.Client, o *Options) error {
 	case o.View == "table":
 		printTable(policyBucket)
 
+	case o.View == "group":
+		printGroupedTable(policyBucket)
+
 	case o.Dump:
 		err := dump(policyBucket)
 		if err != nil {
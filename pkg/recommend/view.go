@@ -4,9 +4,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"sort"
 	"strings"
 
 	"github.com/olekukonko/tablewriter"
+
+	policyType "github.com/accuknox/dev2/hardening/pkg/types"
 )
 
 func printJSON(pb *PolicyBucket) {
@@ -67,6 +70,92 @@ func printTable(pb *PolicyBucket) {
 	table.Render()
 }
 
+// printGroupedTable prints the number of policies per namespace and tag,
+// split by severity, to help adopting the policies one framework at a time
+func printGroupedTable(pb *PolicyBucket) {
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetAutoMergeCellsByColumnIndex([]int{0})
+
+	rows, severities := groupByTagAndSeverity(pb)
+
+	header := []string{"Namespace", "Tag", "Policies"}
+	for _, severity := range severities {
+		header = append(header, fmt.Sprintf("Severity %d", severity))
+	}
+	table.SetHeader(header)
+	table.AppendBulk(rows)
+	table.Render()
+}
+
+// groupByTagAndSeverity returns a row per namespace and tag with the policy
+// count for each of the returned severities
+func groupByTagAndSeverity(pb *PolicyBucket) ([][]string, []int) {
+	var severities []int
+	for _, ab := range pb.Namespaces {
+		for severity := range ab.Severties {
+			if !containsInt(severities, int(severity)) {
+				severities = append(severities, int(severity))
+			}
+		}
+	}
+	sort.Ints(severities)
+
+	namespaces := make([]string, 0, len(pb.Namespaces))
+	for ns := range pb.Namespaces {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+
+	var rows [][]string
+	for _, ns := range namespaces {
+		ab := pb.Namespaces[ns]
+
+		tags := make([]string, 0, len(ab.Tags))
+		for tag := range ab.Tags {
+			tags = append(tags, string(tag))
+		}
+		sort.Strings(tags)
+
+		groups := make(map[string][]*policyType.KubeArmorPolicy)
+		for _, tag := range tags {
+			groups[tag] = ab.Tags[Tag(tag)]
+		}
+		for _, policy := range getAllPoliciesInBucket(ab) {
+			if len(policy.Spec.Tags) == 0 {
+				groups["(untagged)"] = append(groups["(untagged)"], policy)
+			}
+		}
+		if _, exists := groups["(untagged)"]; exists {
+			tags = append(tags, "(untagged)")
+		}
+
+		for _, tag := range tags {
+			counts := make(map[int]int)
+			for _, policy := range groups[tag] {
+				counts[policy.Spec.Severity]++
+			}
+
+			row := []string{ns, tag, fmt.Sprintf("%d", len(groups[tag]))}
+			for _, severity := range severities {
+				row = append(row, fmt.Sprintf("%d", counts[severity]))
+			}
+			rows = append(rows, row)
+		}
+	}
+
+	return rows, severities
+}
+
+func containsInt(values []int, value int) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
 func formatLabels(labels map[string]string) string {
 	var sb strings.Builder
 	for k, v := range labels {
@@ -0,0 +1,506 @@
+package vm
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	cm "github.com/accuknox/accuknox-cli-v2/pkg/common"
+	"github.com/accuknox/accuknox-cli-v2/pkg/onboard"
+	"github.com/olekukonko/tablewriter"
+	"github.com/shirou/gopsutil/disk"
+	"oras.land/oras-go/v2/registry"
+	"oras.land/oras-go/v2/registry/remote"
+)
+
+// CheckStatus is the outcome of a preflight check
+type CheckStatus string
+
+const (
+	CheckPass CheckStatus = "pass"
+	CheckWarn CheckStatus = "warn"
+	CheckFail CheckStatus = "fail"
+)
+
+const (
+	minFreeDisk         uint64 = 2 << 30
+	recommendedFreeDisk uint64 = 10 << 30
+
+	maxWarnClockSkew = 30 * time.Second
+	maxClockSkew     = 5 * time.Minute
+
+	preflightTimeout = 5 * time.Second
+)
+
+// CheckResult is the result of a single preflight check
+type CheckResult struct {
+	Name    string      `json:"name"`
+	Status  CheckStatus `json:"status"`
+	Message string      `json:"message"`
+	Hint    string      `json:"hint,omitempty"`
+}
+
+// PreflightOptions describes the node about to be onboarded
+type PreflightOptions struct {
+	Mode     onboard.VMMode
+	NodeType onboard.NodeType
+	// ContainerRuntime of docker mode, detected if empty
+	ContainerRuntime onboard.ContainerRuntime
+
+	KnoxGateway string
+	SpireHost   string
+	PPSHost     string
+	CPNodeAddr  string
+	RMQAddr     string
+
+	Registry           string
+	RegistryConfigPath string
+	Insecure           bool
+	PlainHTTP          bool
+
+	SkipBTFCheck      bool
+	SystemMonitorPath string
+}
+
+// PreflightReport holds the results of all the checks run for a node
+type PreflightReport struct {
+	Mode     onboard.VMMode   `json:"mode"`
+	NodeType onboard.NodeType `json:"node_type"`
+	Checks   []CheckResult    `json:"checks"`
+}
+
+type preflightCheck func(o *PreflightOptions) []CheckResult
+
+// Preflight runs every check needed to onboard a node in the given mode and
+// node type. The runtime is detected first as other checks depend on it, the
+// remaining checks run concurrently but are reported in a fixed order.
+func Preflight(o *PreflightOptions) *PreflightReport {
+	report := &PreflightReport{Mode: o.Mode, NodeType: o.NodeType}
+	report.Checks = append(report.Checks, checkRuntime(o)...)
+
+	checks := []preflightCheck{
+		checkKernel,
+		checkLSM,
+		checkCgroup,
+		checkDisk,
+		checkPortConflicts,
+		checkEndpoints,
+		checkRegistry,
+		checkClockSkew,
+	}
+
+	var wg sync.WaitGroup
+	results := make([][]CheckResult, len(checks))
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check preflightCheck) {
+			defer wg.Done()
+			results[i] = check(o)
+		}(i, check)
+	}
+	wg.Wait()
+
+	for _, r := range results {
+		report.Checks = append(report.Checks, r...)
+	}
+	return report
+}
+
+// Failed returns true if any of the checks failed
+func (r *PreflightReport) Failed() bool {
+	for _, c := range r.Checks {
+		if c.Status == CheckFail {
+			return true
+		}
+	}
+	return false
+}
+
+// Print writes the report as a table, or as JSON if asked to
+func (r *PreflightReport) Print(w io.Writer, asJSON bool) error {
+	if asJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(r)
+	}
+
+	table := tablewriter.NewWriter(w)
+	table.SetHeader([]string{"CHECK", "STATUS", "MESSAGE", "HINT"})
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetAutoWrapText(false)
+	for _, c := range r.Checks {
+		status := string(c.Status)
+		switch c.Status {
+		case CheckPass:
+			status = green(status)
+		case CheckFail:
+			status = red(status)
+		}
+		table.Append([]string{c.Name, status, c.Message, c.Hint})
+	}
+	table.Render()
+	return nil
+}
+
+func result(name string, status CheckStatus, hint, msg string, a ...any) []CheckResult {
+	return []CheckResult{{Name: name, Status: status, Message: fmt.Sprintf(msg, a...), Hint: hint}}
+}
+
+func checkRuntime(o *PreflightOptions) []CheckResult {
+	switch o.Mode {
+	case onboard.VMMode_Docker:
+		cc := onboard.ClusterConfig{ContainerRuntime: o.ContainerRuntime}
+		msg, err := cc.ValidateEnv()
+		if err != nil {
+			return result("docker", CheckFail,
+				fmt.Sprintf("install docker %s+ and docker compose %s+, podman with a compose provider or nerdctl, or onboard with --vm-mode=systemd", cm.MinDockerVersion, cm.MinDockerComposeVersion),
+				"%s", err.Error())
+		}
+		// the detected runtime is used by the other checks
+		o.ContainerRuntime = cc.ContainerRuntime
+		return result("docker", CheckPass, "", "%s", strings.TrimSpace(msg))
+	default:
+		if _, err := exec.LookPath("systemctl"); err != nil {
+			return result("systemd", CheckFail, "systemd mode needs a systemd based distribution, use --vm-mode=docker instead",
+				"systemctl not found")
+		}
+		if os.Geteuid() != 0 {
+			return result("systemd", CheckWarn, "run knoxctl with sudo to onboard in systemd mode",
+				"not running as root")
+		}
+		return result("systemd", CheckPass, "", "systemctl found")
+	}
+}
+
+func checkKernel(o *PreflightOptions) []CheckResult {
+	kernel, err := GetKernelVersion()
+	if err != nil {
+		kernel = "unknown"
+	}
+
+	if CheckBtfSupport() == "yes" {
+		return result("kernel", CheckPass, "", "kernel %s, BTF available", kernel)
+	}
+	if o.SystemMonitorPath != "" {
+		return result("kernel", CheckWarn, "", "kernel %s, BTF not available, using system monitor %s", kernel, o.SystemMonitorPath)
+	}
+	if o.SkipBTFCheck {
+		return result("kernel", CheckWarn, "KubeArmor may fail to start without a system monitor built for this kernel",
+			"kernel %s, BTF not available, check skipped", kernel)
+	}
+	return result("kernel", CheckFail, "use a kernel built with CONFIG_DEBUG_INFO_BTF=y or pass --system-monitor-path",
+		"kernel %s, BTF not available (/sys/kernel/btf/vmlinux)", kernel)
+}
+
+func checkLSM(o *PreflightOptions) []CheckResult {
+	enforcer := DetectEnforcer(LsmOrder)
+	if enforcer == "apparmor" && !CheckIfApparmorFsPresent() {
+		enforcer = "NA"
+	}
+	if enforcer == "" || enforcer == "NA" {
+		return result("lsm", CheckWarn, "enable BPF-LSM (lsm=...,bpf boot parameter), AppArmor or SELinux to enforce policies",
+			"no LSM supported by KubeArmor is enabled, policies will only be audited")
+	}
+	return result("lsm", CheckPass, "", "%s", enforcer)
+}
+
+func checkCgroup(o *PreflightOptions) []CheckResult {
+	if cgroupV2("/") {
+		return result("cgroup", CheckPass, "", "cgroup v2")
+	}
+	return result("cgroup", CheckWarn, "boot with systemd.unified_cgroup_hierarchy=1 to use cgroup v2",
+		"cgroup v1, container visibility may be limited")
+}
+
+// cgroupV2 returns true if the unified cgroup hierarchy is mounted under root
+func cgroupV2(root string) bool {
+	_, err := os.Stat(filepath.Join(root, "sys", "fs", "cgroup", "cgroup.controllers"))
+	return err == nil
+}
+
+func checkDisk(o *PreflightOptions) []CheckResult {
+	path := "/opt"
+	if o.Mode == onboard.VMMode_Docker {
+		switch o.ContainerRuntime {
+		case onboard.ContainerRuntime_Podman:
+			path = "/var/lib/containers"
+		case onboard.ContainerRuntime_Nerdctl:
+			path = "/var/lib/containerd"
+		default:
+			path = "/var/lib/docker"
+		}
+	}
+	for {
+		if _, err := os.Stat(path); err == nil || path == "/" {
+			break
+		}
+		path = filepath.Dir(path)
+	}
+
+	usage, err := disk.Usage(path)
+	if err != nil {
+		return result("disk", CheckWarn, "", "failed to get disk usage of %s: %v", path, err)
+	}
+
+	status := diskStatus(usage.Free)
+	var hint string
+	if status != CheckPass {
+		hint = fmt.Sprintf("free up space on %s, at least %s is recommended", path, formatBytes(recommendedFreeDisk))
+	}
+	return result("disk", status, hint, "%s free on %s", formatBytes(usage.Free), path)
+}
+
+func diskStatus(free uint64) CheckStatus {
+	switch {
+	case free < minFreeDisk:
+		return CheckFail
+	case free < recommendedFreeDisk:
+		return CheckWarn
+	}
+	return CheckPass
+}
+
+func formatBytes(b uint64) string {
+	return fmt.Sprintf("%.1fGiB", float64(b)/(1<<30))
+}
+
+// preflightPorts returns the ports the agents listen on for the node
+func preflightPorts(o *PreflightOptions) []string {
+	ports := []string{"32767"}
+	if o.NodeType == onboard.NodeType_ControlPlane {
+		ports = append(ports, "32768", "32769", "32770", "32771")
+		if o.RMQAddr == "" {
+			ports = append(ports, fmt.Sprintf("%d", cm.AMQPPort))
+		}
+	}
+	if o.SpireHost != "" {
+		ports = append(ports, "9090", "9091")
+	}
+	return ports
+}
+
+func checkPortConflicts(o *PreflightOptions) []CheckResult {
+	listening, err := getListeningPorts()
+	if err != nil {
+		return result("ports", CheckWarn, "", "failed to list listening ports: %v", err)
+	}
+
+	ports := preflightPorts(o)
+	var used []string
+	for _, port := range ports {
+		usage, ok := listening[port]
+		if !ok {
+			continue
+		}
+		if usage.ProcessName != "" {
+			used = append(used, fmt.Sprintf("%s (%s, pid %d)", port, usage.ProcessName, usage.PID))
+		} else {
+			used = append(used, fmt.Sprintf("%s (pid %d)", port, usage.PID))
+		}
+	}
+	if len(used) > 0 {
+		return result("ports", CheckFail, "stop the processes using the ports or deboard the agents already installed",
+			"in use: %s", strings.Join(used, ", "))
+	}
+	return result("ports", CheckPass, "", "%s available", strings.Join(ports, ", "))
+}
+
+type endpoint struct {
+	name     string
+	addr     string
+	port     string
+	tls      bool
+	required bool
+}
+
+func preflightEndpoints(o *PreflightOptions) []endpoint {
+	var endpoints []endpoint
+	if o.NodeType == onboard.NodeType_ControlPlane {
+		endpoints = append(endpoints,
+			endpoint{name: "knox-gateway", addr: o.KnoxGateway, port: "3000", tls: true, required: true},
+			endpoint{name: "pps", addr: o.PPSHost, port: "443", tls: true, required: true},
+		)
+	} else {
+		endpoints = append(endpoints,
+			endpoint{name: "relay-server", addr: o.CPNodeAddr, port: "32768", required: true},
+			endpoint{name: "sia", addr: o.CPNodeAddr, port: "32769", required: true},
+			endpoint{name: "pea", addr: o.CPNodeAddr, port: "32770", required: true},
+		)
+		if o.RMQAddr != "" {
+			endpoints = append(endpoints, endpoint{name: "rabbitmq", addr: o.RMQAddr, port: fmt.Sprintf("%d", cm.AMQPPort)})
+		}
+	}
+	endpoints = append(endpoints, endpoint{name: "spire", addr: o.SpireHost, port: "8081"})
+	return endpoints
+}
+
+// hostPort splits an address which may be a URL or host[:port]
+func hostPort(addr, defaultPort string) (string, string) {
+	addr = strings.TrimPrefix(strings.TrimPrefix(addr, "https://"), "http://")
+	addr = strings.SplitN(addr, "/", 2)[0]
+	if host, port, err := net.SplitHostPort(addr); err == nil {
+		return host, port
+	}
+	return addr, defaultPort
+}
+
+func checkEndpoints(o *PreflightOptions) []CheckResult {
+	endpoints := preflightEndpoints(o)
+	results := make([]CheckResult, len(endpoints))
+
+	var wg sync.WaitGroup
+	for i, ep := range endpoints {
+		wg.Add(1)
+		go func(i int, ep endpoint) {
+			defer wg.Done()
+			results[i] = checkEndpoint(ep, o.Insecure)
+		}(i, ep)
+	}
+	wg.Wait()
+	return results
+}
+
+func checkEndpoint(ep endpoint, insecure bool) CheckResult {
+	res := CheckResult{Name: "reach " + ep.name}
+	if ep.addr == "" {
+		res.Status = CheckPass
+		res.Message = "not configured, skipped"
+		if ep.required {
+			res.Status = CheckWarn
+			res.Message = "address not specified, skipped"
+			res.Hint = fmt.Sprintf("pass the %s address to check its reachability", ep.name)
+		}
+		return res
+	}
+
+	host, port := hostPort(ep.addr, ep.port)
+	addr := net.JoinHostPort(host, port)
+
+	if net.ParseIP(host) == nil {
+		if _, err := net.LookupHost(host); err != nil {
+			res.Status = CheckFail
+			res.Message = fmt.Sprintf("failed to resolve %s: %v", host, err)
+			res.Hint = "check the DNS configuration of the node (/etc/resolv.conf)"
+			return res
+		}
+	}
+
+	conn, err := net.DialTimeout("tcp", addr, preflightTimeout)
+	if err != nil {
+		res.Status = CheckFail
+		res.Message = fmt.Sprintf("failed to connect to %s: %v", addr, err)
+		res.Hint = fmt.Sprintf("allow outbound TCP connections to %s in the firewall and proxy", addr)
+		return res
+	}
+	_ = conn.Close()
+
+	if ep.tls {
+		dialer := &net.Dialer{Timeout: preflightTimeout}
+		// ignoring G402 - upto user to use secure connection
+		tlsConn, err := tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{
+			ServerName:         host,
+			InsecureSkipVerify: insecure, // #nosec G402
+		})
+		if err != nil {
+			res.Status = CheckFail
+			res.Message = fmt.Sprintf("TLS handshake with %s failed: %v", addr, err)
+			res.Hint = "check that no proxy intercepts TLS and that the system CA certificates are up to date"
+			return res
+		}
+		_ = tlsConn.Close()
+		res.Message = fmt.Sprintf("%s reachable over TLS", addr)
+	} else {
+		res.Message = fmt.Sprintf("%s reachable", addr)
+	}
+	res.Status = CheckPass
+	return res
+}
+
+func checkRegistry(o *PreflightOptions) []CheckResult {
+	hint := fmt.Sprintf("log in with knoxctl onboard login %s or pass --registry-config-path", o.Registry)
+
+	loginOptions := onboard.LoginOptions{
+		Registry:           o.Registry,
+		RegistryConfigPath: o.RegistryConfigPath,
+		Insecure:           o.Insecure,
+		PlainHTTP:          o.PlainHTTP,
+	}
+	authClient, err := loginOptions.ORASGetAuthClient()
+	if err != nil {
+		return result("registry", CheckFail, hint, "failed to load credentials for %s: %v", o.Registry, err)
+	}
+
+	reg, err := remote.NewRegistry(o.Registry)
+	if err != nil {
+		return result("registry", CheckFail, "", "invalid registry %s: %v", o.Registry, err)
+	}
+	reg.Client = authClient
+	reg.PlainHTTP = o.PlainHTTP
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*preflightTimeout)
+	defer cancel()
+	if err := reg.Ping(ctx); err != nil {
+		return result("registry", CheckFail, hint, "failed to authenticate with %s: %v", o.Registry, err)
+	}
+	return result("registry", CheckPass, "", "authenticated with %s", o.Registry)
+}
+
+func checkClockSkew(o *PreflightOptions) []CheckResult {
+	scheme := "https"
+	if o.PlainHTTP {
+		scheme = "http"
+	}
+	url := fmt.Sprintf("%s://%s/v2/", scheme, registry.Reference{Registry: o.Registry}.Host())
+
+	client := &http.Client{
+		Timeout: preflightTimeout,
+		Transport: &http.Transport{
+			// ignoring G402 - only the Date header is read
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true}, // #nosec G402
+		},
+	}
+	start := time.Now()
+	resp, err := client.Head(url)
+	if err != nil {
+		return result("clock", CheckWarn, "", "failed to get the time from %s: %v", url, err)
+	}
+	_ = resp.Body.Close()
+
+	date, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return result("clock", CheckWarn, "", "no valid Date header from %s", url)
+	}
+	// the Date header has a second precision, compare with the middle of the request
+	local := start.Add(time.Since(start) / 2)
+	skew := local.Sub(date).Round(time.Second)
+
+	status := skewStatus(skew)
+	var hint string
+	if status != CheckPass {
+		hint = "sync the clock with NTP (timedatectl set-ntp true), SPIRE and TLS validation need an accurate clock"
+	}
+	return result("clock", status, hint, "clock skew %s", skew)
+}
+
+func skewStatus(skew time.Duration) CheckStatus {
+	if skew < 0 {
+		skew = -skew
+	}
+	switch {
+	case skew > maxClockSkew:
+		return CheckFail
+	case skew > maxWarnClockSkew:
+		return CheckWarn
+	}
+	return CheckPass
+}
@@ -0,0 +1,112 @@
+package vm
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/accuknox/accuknox-cli-v2/pkg/onboard"
+)
+
+func TestSkewStatus(t *testing.T) {
+	tests := []struct {
+		skew time.Duration
+		want CheckStatus
+	}{
+		{0, CheckPass},
+		{-10 * time.Second, CheckPass},
+		{45 * time.Second, CheckWarn},
+		{-2 * time.Minute, CheckWarn},
+		{10 * time.Minute, CheckFail},
+		{-6 * time.Minute, CheckFail},
+	}
+	for _, tt := range tests {
+		if got := skewStatus(tt.skew); got != tt.want {
+			t.Errorf("skewStatus(%s) = %s, want %s", tt.skew, got, tt.want)
+		}
+	}
+}
+
+func TestDiskStatus(t *testing.T) {
+	tests := []struct {
+		free uint64
+		want CheckStatus
+	}{
+		{1 << 30, CheckFail},
+		{5 << 30, CheckWarn},
+		{20 << 30, CheckPass},
+	}
+	for _, tt := range tests {
+		if got := diskStatus(tt.free); got != tt.want {
+			t.Errorf("diskStatus(%d) = %s, want %s", tt.free, got, tt.want)
+		}
+	}
+}
+
+func TestCgroupV2(t *testing.T) {
+	root := t.TempDir()
+	if cgroupV2(root) {
+		t.Errorf("cgroupV2() = true without cgroup.controllers")
+	}
+
+	dir := filepath.Join(root, "sys", "fs", "cgroup")
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "cgroup.controllers"), []byte("cpu memory pids"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if !cgroupV2(root) {
+		t.Errorf("cgroupV2() = false with cgroup.controllers")
+	}
+}
+
+func TestPreflightPorts(t *testing.T) {
+	tests := []struct {
+		name string
+		opts PreflightOptions
+		want []string
+	}{
+		{
+			name: "control plane",
+			opts: PreflightOptions{NodeType: onboard.NodeType_ControlPlane, SpireHost: "spire.accuknox.com"},
+			want: []string{"32767", "32768", "32769", "32770", "32771", "5672", "9090", "9091"},
+		},
+		{
+			name: "control plane with external rabbitmq",
+			opts: PreflightOptions{NodeType: onboard.NodeType_ControlPlane, RMQAddr: "10.0.0.2:5672"},
+			want: []string{"32767", "32768", "32769", "32770", "32771"},
+		},
+		{
+			name: "worker node",
+			opts: PreflightOptions{NodeType: onboard.NodeType_WorkerNode, CPNodeAddr: "10.0.0.1"},
+			want: []string{"32767"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := preflightPorts(&tt.opts); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("preflightPorts() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHostPort(t *testing.T) {
+	tests := []struct {
+		addr, host, port string
+	}{
+		{"knox-gw.accuknox.com:3000", "knox-gw.accuknox.com", "3000"},
+		{"https://pps.accuknox.com", "pps.accuknox.com", "443"},
+		{"http://spire.accuknox.com:8081/ready", "spire.accuknox.com", "8081"},
+		{"10.0.0.1", "10.0.0.1", "443"},
+	}
+	for _, tt := range tests {
+		host, port := hostPort(tt.addr, "443")
+		if host != tt.host || port != tt.port {
+			t.Errorf("hostPort(%q) = %s, %s, want %s, %s", tt.addr, host, port, tt.host, tt.port)
+		}
+	}
+}
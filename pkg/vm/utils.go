@@ -308,7 +308,7 @@ func getInstalledAgents() (map[string]string, onboard.VMMode, onboard.NodeType)
 	if err != nil {
 		return nil, "", ""
 	}
-	installedContainers, _, err := deboard.GetInstalledObjects()
+	installedContainers, _, err := deboard.GetInstalledObjects(cc.ContainerRuntime)
 	if err != nil {
 		return nil, "", ""
 	}
@@ -0,0 +1,88 @@
+// release pins the digests of the systemd agents of a release in the release
+// file shipped with knoxctl and signs it with the key of the
+// RELEASE_SIGNING_KEY environment variable. It runs before building a release
+// and does nothing for snapshots or when no key is set.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	cm "github.com/accuknox/accuknox-cli-v2/pkg/common"
+	"github.com/accuknox/accuknox-cli-v2/pkg/onboard"
+	"golang.org/x/mod/semver"
+)
+
+func main() {
+	var (
+		releaseFile string
+		version     string
+		archs       string
+		snapshot    bool
+	)
+	flag.StringVar(&releaseFile, "file", "pkg/common/release.json", "release file to pin and sign")
+	flag.StringVar(&version, "version", "", "release to pin the digests of, the latest one by default")
+	flag.StringVar(&archs, "archs", "amd64,arm64", "architectures of the agents to pin")
+	flag.BoolVar(&snapshot, "snapshot", false, "skip pinning and signing, for snapshot builds")
+	flag.Parse()
+
+	if snapshot {
+		fmt.Println("Snapshot build, the release file is not pinned nor signed")
+		return
+	}
+	if os.Getenv("RELEASE_SIGNING_KEY") == "" {
+		fmt.Fprintln(os.Stderr, "RELEASE_SIGNING_KEY is not set, the release file is not pinned nor signed")
+		return
+	}
+
+	if err := run(releaseFile, version, strings.Split(archs, ",")); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(releaseFile, version string, archs []string) error {
+	key, err := cm.ParseReleaseSigningKey([]byte(os.Getenv("RELEASE_SIGNING_KEY")))
+	if err != nil {
+		return fmt.Errorf("RELEASE_SIGNING_KEY: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Clean(releaseFile))
+	if err != nil {
+		return err
+	}
+	releases := make(map[string]cm.ReleaseMetadata)
+	if err := json.Unmarshal(data, &releases); err != nil {
+		return fmt.Errorf("invalid release file: %v", err)
+	}
+
+	if version == "" {
+		for v := range releases {
+			if version == "" || semver.Compare(v, version) > 0 {
+				version = v
+			}
+		}
+	}
+	release, ok := releases[version]
+	if !ok {
+		return fmt.Errorf("release %s not found", version)
+	}
+	if release.Digests, err = onboard.ReleaseAgentDigests(release, archs); err != nil {
+		return err
+	}
+	releases[version] = release
+	fmt.Printf("Pinned %d digests for release %s\n", len(release.Digests), version)
+
+	if data, err = json.MarshalIndent(releases, "", "  "); err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if err := os.WriteFile(releaseFile, data, 0o644); err != nil { // #nosec G306
+		return err
+	}
+	return os.WriteFile(releaseFile+cm.ReleaseSignatureExt, cm.SignData(data, key), 0o644) // #nosec G306
+}